@@ -4,8 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
@@ -20,6 +30,8 @@ steps:
     rooms: ["Bedroom"]
   - type: play
     query: "Morning Mix"
+  - type: play
+    station: "Apple Music 1"
   - type: volume.set
     value: 30
   - type: wait
@@ -49,7 +61,7 @@ func TestAutomationValidateRejectsInvalidPlayStep(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected validation error")
 	}
-	if !strings.Contains(err.Error(), "exactly one of query or playlistId") {
+	if !strings.Contains(err.Error(), "exactly one of query, playlistId, or station") {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -141,6 +153,45 @@ func TestExecuteAutomationSteps_StopsOnFailure(t *testing.T) {
 	}
 }
 
+func TestExecuteAutomationStepResolvesRooms(t *testing.T) {
+	origSetCurrentOutputs, origSetDeviceVolume, origList := setCurrentOutputs, setDeviceVolume, listAirPlayDevices
+	t.Cleanup(func() {
+		setCurrentOutputs, setDeviceVolume, listAirPlayDevices = origSetCurrentOutputs, origSetDeviceVolume, origList
+	})
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Kitchen HomePod"}, {Name: "Bedroom"}}, nil
+	}
+	var outputs []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		outputs = rooms
+		return nil
+	}
+	volumes := map[string]int{}
+	setDeviceVolume = func(_ context.Context, room string, v int) error {
+		volumes[room] = v
+		return nil
+	}
+	cfg := &native.Config{Groups: map[string][]string{"upstairs": {"bed"}}}
+	defaults := automationDefaults{Backend: "airplay"}
+	v := 30
+
+	if err := executeAutomationStep(context.Background(), cfg, "t", defaults, automationStep{Type: "out.set", Rooms: []string{"kitch", "upstairs"}}); err != nil {
+		t.Fatalf("out.set: %v", err)
+	}
+	if !reflect.DeepEqual(outputs, []string{"Kitchen HomePod", "Bedroom"}) {
+		t.Fatalf("outputs=%v", outputs)
+	}
+	if err := executeAutomationStep(context.Background(), cfg, "t", defaults, automationStep{Type: "volume.set", Value: &v, Rooms: []string{"kitchen"}}); err != nil {
+		t.Fatalf("volume.set: %v", err)
+	}
+	if volumes["Kitchen HomePod"] != 30 || len(volumes) != 1 {
+		t.Fatalf("volumes=%v", volumes)
+	}
+	if err := executeAutomationStep(context.Background(), cfg, "t", defaults, automationStep{Type: "out.set", Rooms: []string{"Garage"}}); err == nil {
+		t.Fatalf("expected an unknown room to fail out.set")
+	}
+}
+
 func TestExecuteAutomationPlayNative(t *testing.T) {
 	origRunShortcut := runNativeShortcut
 	t.Cleanup(func() { runNativeShortcut = origRunShortcut })
@@ -152,8 +203,8 @@ func TestExecuteAutomationPlayNative(t *testing.T) {
 	}
 	cfg := &native.Config{
 		Native: native.NativeConfig{
-			Playlists: map[string]map[string]string{
-				"Bedroom": {"Focus": "BR Focus"},
+			Playlists: map[string]map[string]native.PlaylistShortcut{
+				"Bedroom": {"Focus": {Shortcut: "BR Focus"}},
 			},
 		},
 	}
@@ -168,3 +219,877 @@ func TestExecuteAutomationPlayNative(t *testing.T) {
 		t.Fatalf("runNativeShortcut calls=%d, want 1", called)
 	}
 }
+
+func TestAutomationValidateTransportAndPlayerSteps(t *testing.T) {
+	t.Parallel()
+	doc, err := parseAutomationBytes([]byte(`version: "1"
+name: controls
+steps:
+  - type: transport
+    action: playpause
+  - type: transport
+    action: next
+  - type: shuffle.set
+    enabled: true
+  - type: shuffle.set
+    mode: albums
+  - type: repeat.set
+    mode: all
+  - type: repeat.set
+    mode: One
+  - type: seek
+    position: 42.5
+  - type: duck
+    value: 10
+    for: 2m
+  - type: unduck
+    rooms: [Kitchen]
+`))
+	if err != nil {
+		t.Fatalf("parseAutomationBytes: %v", err)
+	}
+	if err := validateAutomation(doc); err != nil {
+		t.Fatalf("validateAutomation: %v", err)
+	}
+
+	bad := []automationStep{
+		{Type: "transport", Action: "rewind"},
+		{Type: "shuffle.set"},
+		{Type: "shuffle.set", Mode: "all"},
+		{Type: "crossfade.set"},
+		{Type: "repeat.set", Mode: "sometimes"},
+		{Type: "repeat.set", Mode: "albums"},
+		{Type: "seek"},
+		{Type: "seek", Position: floatPtr(-1)},
+		{Type: "volume.set", Value: intPtr(20), Synchronized: true},
+		{Type: "duck", Value: intPtr(101)},
+		{Type: "duck", For: "soon"},
+	}
+	for _, st := range bad {
+		if err := validateAutomationStep(0, st); err == nil {
+			t.Fatalf("expected validation error for %+v", st)
+		}
+	}
+}
+
+func TestExecuteAutomationStep_PlayerControls(t *testing.T) {
+	origActions := transportActions
+	origSetShuffle := setShuffle
+	origSetShuffleMode := setShuffleMode
+	origSetSongRepeat := setSongRepeat
+	origSetPlayerPosition := setPlayerPosition
+	t.Cleanup(func() {
+		transportActions = origActions
+		setShuffle = origSetShuffle
+		setShuffleMode = origSetShuffleMode
+		setSongRepeat = origSetSongRepeat
+		setPlayerPosition = origSetPlayerPosition
+	})
+
+	var calls []string
+	transportActions = map[string]func(context.Context) error{
+		"next": func(context.Context) error { calls = append(calls, "next"); return nil },
+	}
+	setShuffle = func(_ context.Context, enabled bool) error {
+		calls = append(calls, "shuffle="+strconv.FormatBool(enabled))
+		return nil
+	}
+	setShuffleMode = func(_ context.Context, mode string) error {
+		calls = append(calls, "shuffleMode="+mode)
+		return nil
+	}
+	setSongRepeat = func(_ context.Context, mode string) error {
+		calls = append(calls, "repeat="+mode)
+		return nil
+	}
+	setPlayerPosition = func(_ context.Context, seconds float64) error {
+		calls = append(calls, "seek")
+		if seconds != 30 {
+			t.Fatalf("seconds=%v, want 30", seconds)
+		}
+		return nil
+	}
+
+	steps := []automationStep{
+		{Type: "transport", Action: "next"},
+		{Type: "shuffle.set", Enabled: boolPtr(false)},
+		{Type: "shuffle.set", Enabled: boolPtr(true), Mode: "groupings"},
+		{Type: "repeat.set", Mode: "one"},
+		{Type: "seek", Position: floatPtr(30)},
+	}
+	for _, st := range steps {
+		if err := executeAutomationStep(context.Background(), &native.Config{}, "test", automationDefaults{}, st); err != nil {
+			t.Fatalf("executeAutomationStep(%s): %v", st.Type, err)
+		}
+	}
+	want := "next,shuffle=false,shuffleMode=groupings,shuffle=true,repeat=one,seek"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("calls=%s, want %s", got, want)
+	}
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestParseWaitCondition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw     string
+		want    waitCondition
+		wantErr bool
+	}{
+		{raw: "track.changed", want: waitCondition{Kind: "track.changed"}},
+		{raw: "playlist Morning Mix", want: waitCondition{Kind: "playlist", Arg: "Morning Mix"}},
+		{raw: `output.selected "Bedroom"`, want: waitCondition{Kind: "output.selected", Arg: "Bedroom"}},
+		{raw: "volume >= 30", want: waitCondition{Kind: "volume", Op: ">=", Value: 30}},
+		{raw: "volume ~ 30", wantErr: true},
+		{raw: "volume >= 130", wantErr: true},
+		{raw: "output.selected", wantErr: true},
+		{raw: "track.changed now", wantErr: true},
+		{raw: "lights.on", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parseWaitCondition(tc.raw)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("parseWaitCondition(%q) expected error", tc.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseWaitCondition(%q): %v", tc.raw, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("parseWaitCondition(%q)=%+v, want %+v", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestWaitConditionMet(t *testing.T) {
+	t.Parallel()
+
+	np := music.NowPlaying{
+		PlaylistName: "Morning Mix",
+		Track:        music.NowPlayingTrack{PersistentID: "T2"},
+		Outputs: []music.AirPlayDevice{
+			{Name: "Bedroom", Volume: 40},
+			{Name: "Kitchen", Volume: 20},
+		},
+	}
+	cases := []struct {
+		cond  waitCondition
+		rooms []string
+		want  bool
+	}{
+		{cond: waitCondition{Kind: "track.changed"}, want: true},
+		{cond: waitCondition{Kind: "playlist", Arg: "morning mix"}, want: true},
+		{cond: waitCondition{Kind: "output.selected", Arg: "Kitchen"}, want: true},
+		{cond: waitCondition{Kind: "output.selected", Arg: "Office"}, want: false},
+		{cond: waitCondition{Kind: "volume", Op: ">=", Value: 30}, want: true},
+		{cond: waitCondition{Kind: "volume", Op: ">=", Value: 30}, rooms: []string{"Kitchen"}, want: false},
+		{cond: waitCondition{Kind: "volume", Op: ">=", Value: 30}, rooms: []string{"Office"}, want: false},
+	}
+	for _, tc := range cases {
+		if got := tc.cond.met(np, "T1", tc.rooms); got != tc.want {
+			t.Fatalf("%s rooms=%v met=%t, want %t", tc.cond, tc.rooms, got, tc.want)
+		}
+	}
+}
+
+func TestExecuteAutomationWaitUntil_TrackChanged(t *testing.T) {
+	origGetNowPlaying, origList := getNowPlaying, listAirPlayDevices
+	origSleep := sleepCtx
+	t.Cleanup(func() {
+		getNowPlaying, listAirPlayDevices = origGetNowPlaying, origList
+		sleepCtx = origSleep
+	})
+
+	polls := 0
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		polls++
+		id := "T1"
+		if polls >= 3 {
+			id = "T2"
+		}
+		return music.NowPlaying{Track: music.NowPlayingTrack{PersistentID: id}}, nil
+	}
+	sleepCtx = func(ctx context.Context, _ time.Duration) error { return ctx.Err() }
+
+	if err := executeAutomationWaitUntil(context.Background(), nil, "track.changed", "10s", nil); err != nil {
+		t.Fatalf("executeAutomationWaitUntil: %v", err)
+	}
+	if polls != 3 {
+		t.Fatalf("polls=%d, want 3", polls)
+	}
+
+	// output.selected resolves its argument like a room: device aliases,
+	// groups, and partial names.
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Kitchen HomePod"}, {Name: "Bedroom"}}, nil
+	}
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{Outputs: []music.AirPlayDevice{{Name: "Kitchen HomePod"}, {Name: "Bedroom"}}}, nil
+	}
+	cfg := &native.Config{
+		Devices: map[string]string{"kitchen": "Kitchen HomePod"},
+		Groups:  map[string][]string{"upstairs": {"bed"}},
+	}
+	for _, until := range []string{"output.selected kitchen", "output.selected upstairs", "output.selected kitch"} {
+		if err := executeAutomationWaitUntil(context.Background(), cfg, until, "10ms", nil); err != nil {
+			t.Fatalf("%s: %v", until, err)
+		}
+	}
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{Outputs: []music.AirPlayDevice{{Name: "Bedroom"}}}, nil
+	}
+	if err := executeAutomationWaitUntil(context.Background(), cfg, "output.selected kitchen", "10ms", nil); err == nil || !strings.Contains(err.Error(), "wait timeout") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestAutomationValidateWaitRequiresStateOrUntil(t *testing.T) {
+	t.Parallel()
+
+	both := automationStep{Type: "wait", State: "playing", Until: "track.changed", Timeout: "10s"}
+	if err := validateAutomationStep(0, both); err == nil || !strings.Contains(err.Error(), "exactly one of state or until") {
+		t.Fatalf("expected exclusivity error, got %v", err)
+	}
+	until := automationStep{Type: "wait", Until: "output.selected Bedroom", Timeout: "30s"}
+	if err := validateAutomationStep(0, until); err != nil {
+		t.Fatalf("validateAutomationStep(until): %v", err)
+	}
+}
+
+func TestAutomationValidateNotifyWebhookAndShortcut(t *testing.T) {
+	t.Parallel()
+	doc, err := parseAutomationBytes([]byte(`version: "1"
+name: evening
+steps:
+  - type: notify
+    message: "Playing {{.Track.Name}}"
+  - type: webhook
+    url: https://hooks.example.com/music?token=secret
+    timeout: 5s
+    retries: 2
+    payload:
+      event: started
+      rooms: ["{{join .Route \",\"}}"]
+  - type: shortcut
+    name: Evening Lights
+    input: "{{.Track.Artist}}"
+`))
+	if err != nil {
+		t.Fatalf("parseAutomationBytes: %v", err)
+	}
+	if err := validateAutomation(doc); err != nil {
+		t.Fatalf("validateAutomation: %v", err)
+	}
+	steps := resolveAutomationSteps(&native.Config{}, doc)
+	if r := steps[0].Resolved.(map[string]any); r["title"] != "evening" {
+		t.Fatalf("notify resolved=%v", r)
+	}
+	if r := steps[1].Resolved.(map[string]any); r["url"] != "https://hooks.example.com/music" || r["retries"] != 2 {
+		t.Fatalf("webhook resolved=%v", r)
+	}
+	if r := steps[2].Resolved.(map[string]any); r["name"] != "Evening Lights" || r["input"] != "{{.Track.Artist}}" {
+		t.Fatalf("shortcut resolved=%v", r)
+	}
+
+	bad := []automationStep{
+		{Type: "notify"},
+		{Type: "notify", Message: "{{.Track.Name"},
+		{Type: "webhook"},
+		{Type: "webhook", URL: "ftp://example.com"},
+		{Type: "webhook", URL: "https://example.com", Timeout: "5m"},
+		{Type: "webhook", URL: "https://example.com", Retries: intPtr(6)},
+		{Type: "webhook", URL: "https://example.com", Payload: map[string]any{"a": []any{"{{"}}},
+		{Type: "shortcut"},
+		{Type: "shortcut", Name: "Lights", Input: "{{.Track"},
+	}
+	for _, st := range bad {
+		if err := validateAutomationStep(0, st); err == nil {
+			t.Fatalf("expected validation error for %+v", st)
+		}
+	}
+}
+
+func TestExecuteAutomationNotifyWebhookAndShortcut(t *testing.T) {
+	origLookPath, origGetNowPlaying := lookPath, getNowPlaying
+	origPostNotification, origSleep := postNotification, sleepFn
+	origRunWithInput := runNativeShortcutWithInput
+	t.Cleanup(func() {
+		lookPath, getNowPlaying = origLookPath, origGetNowPlaying
+		postNotification, sleepFn = origPostNotification, origSleep
+		runNativeShortcutWithInput = origRunWithInput
+	})
+	lookPath = func(string) (string, error) { return "/usr/bin/osascript", nil }
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{
+			PlayerState: "playing",
+			Track:       music.NowPlayingTrack{Name: "Kerala", Artist: "Bonobo"},
+			Outputs:     []music.AirPlayDevice{{Name: "Kitchen", Volume: 30}},
+		}, nil
+	}
+	sleepFn = func(time.Duration) {}
+	var note native.Notification
+	postNotification = func(_ context.Context, n native.Notification) error {
+		note = n
+		return nil
+	}
+
+	st := automationStep{Type: "notify", Message: "{{.Track.Name}} in {{join .Route \", \"}}"}
+	if err := executeAutomationStep(context.Background(), &native.Config{}, "evening", automationDefaults{}, st); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if note.Title != "evening" || note.Message != "Kerala in Kitchen" {
+		t.Fatalf("notification=%+v", note)
+	}
+
+	var ran string
+	runNativeShortcutWithInput = func(_ context.Context, name, input string) (string, error) {
+		ran = name + ":" + input
+		return "", nil
+	}
+	st = automationStep{Type: "shortcut", Name: "Evening Lights", Input: "{{.Track.Artist}}"}
+	if err := executeAutomationStep(context.Background(), &native.Config{}, "evening", automationDefaults{}, st); err != nil || ran != "Evening Lights:Bonobo" {
+		t.Fatalf("shortcut ran=%q err=%v", ran, err)
+	}
+
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("body err=%v content-type=%q", err, r.Header.Get("Content-Type"))
+		}
+		bodies = append(bodies, body)
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	st = automationStep{Type: "webhook", URL: srv.URL, Retries: intPtr(1), Payload: map[string]any{"track": "{{.Track.Name}}", "n": 1}}
+	if err := executeAutomationStep(context.Background(), &native.Config{}, "evening", automationDefaults{}, st); err != nil {
+		t.Fatalf("webhook: %v", err)
+	}
+	if len(bodies) != 2 || bodies[1]["track"] != "Kerala" || bodies[1]["n"] != float64(1) {
+		t.Fatalf("bodies=%v", bodies)
+	}
+
+	bodies = nil
+	st = automationStep{Type: "webhook", URL: srv.URL}
+	if err := executeAutomationStep(context.Background(), &native.Config{}, "evening", automationDefaults{}, st); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected 503 without retries, got %v", err)
+	}
+	if len(bodies) != 1 || bodies[0]["automation"] != "evening" || bodies[0]["status"] == nil {
+		t.Fatalf("default payload=%v", bodies)
+	}
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	st = automationStep{Type: "webhook", URL: down.URL + "/hook?token=s3cret"}
+	err := executeAutomationStep(context.Background(), &native.Config{}, "evening", automationDefaults{}, st)
+	if err == nil || strings.Contains(err.Error(), "s3cret") || !strings.Contains(err.Error(), down.URL+"/hook") {
+		t.Fatalf("unreachable webhook err=%v", err)
+	}
+}
+
+func TestSceneAutomationAndRun(t *testing.T) {
+	raw := func(s string) json.RawMessage { return json.RawMessage(s) }
+	cfg := &native.Config{
+		Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Living Room"}},
+		Scenes: map[string]native.Scene{
+			"movie": {Description: "lights down, soundtrack up", Steps: []json.RawMessage{
+				raw(`{"type":"shortcut","name":"Dim Lights"}`),
+				raw(`{"type":"volume.set","value":25}`),
+			}},
+			"broken": {Steps: []json.RawMessage{raw(`{"type":"volume.set","value":130}`)}},
+			"empty":  {},
+		},
+	}
+	doc, err := sceneAutomation(cfg, "movie")
+	if err != nil || doc.Name != "movie" || len(doc.Steps) != 2 || doc.Steps[0].Name != "Dim Lights" {
+		t.Fatalf("doc=%+v err=%v", doc, err)
+	}
+	for name, want := range map[string]string{
+		"broken":  "scenes.broken.steps[0].value",
+		"empty":   "scenes.empty.steps: must contain at least one step",
+		"missing": "unknown scene",
+	} {
+		if _, err := sceneAutomation(cfg, name); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: err=%v, want %q", name, err, want)
+		}
+	}
+	if issues := strings.Join(validateConfigValues(cfg), "\n"); !strings.Contains(issues, "scenes.broken") || strings.Contains(issues, "scenes.movie") {
+		t.Fatalf("issues=%s", issues)
+	}
+
+	out := captureStdout(t, func() { cmdScene(context.Background(), cfg, []string{"run", "movie", "--dry-run", "--json"}) })
+	var res automationCommandResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("json: %v\n%s", err, out)
+	}
+	if res.Name != "movie" || res.Mode != "dry-run" || len(res.Steps) != 2 {
+		t.Fatalf("res=%+v", res)
+	}
+	if r := res.Steps[1].Resolved.(map[string]any); r["value"] != float64(25) {
+		t.Fatalf("resolved=%v", r)
+	}
+
+	delete(cfg.Scenes, "broken")
+	if got := captureStdout(t, func() { cmdScene(context.Background(), cfg, []string{"list", "--plain"}) }); got != "empty  0  \nmovie  2  lights down, soundtrack up\n" {
+		t.Fatalf("list=%q", got)
+	}
+}
+
+func TestAutomationParallelBlock(t *testing.T) {
+	origRunWithInput := runNativeShortcutWithInput
+	t.Cleanup(func() { runNativeShortcutWithInput = origRunWithInput })
+	var mu sync.Mutex
+	running, peak := 0, 0
+	runNativeShortcutWithInput = func(_ context.Context, name, _ string) (string, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if name == "Broken" {
+			return "", errors.New("shortcut failed")
+		}
+		return "", nil
+	}
+
+	doc, err := parseAutomationBytes([]byte(`version: "1"
+name: scene
+steps:
+  - type: parallel
+    concurrency: 2
+    steps:
+      - {type: shortcut, name: Lights}
+      - {type: shortcut, name: Blinds}
+      - {type: shortcut, name: Broken}
+`))
+	if err != nil {
+		t.Fatalf("parseAutomationBytes: %v", err)
+	}
+	if err := validateAutomation(doc); err != nil {
+		t.Fatalf("validateAutomation: %v", err)
+	}
+	plan := resolveAutomationSteps(&native.Config{}, doc)
+	if r := plan[0].Resolved.(map[string]any); r["concurrency"] != 2 || r["failOn"] != "any" || len(plan[0].Branches) != 3 {
+		t.Fatalf("plan=%+v", plan[0])
+	}
+
+	results, ok := executeAutomationSteps(context.Background(), &native.Config{}, doc)
+	if ok || peak != 2 || len(results[0].Branches) != 3 {
+		t.Fatalf("ok=%t peak=%d results=%+v", ok, peak, results)
+	}
+	if b := results[0].Branches; !b[0].OK || !b[1].OK || b[2].OK || b[2].Error != "shortcut failed" || b[0].DurationMS < 20 {
+		t.Fatalf("branches=%+v", b)
+	}
+	if !strings.Contains(results[0].Error, "1 of 3 branches failed") {
+		t.Fatalf("error=%q", results[0].Error)
+	}
+
+	doc.Steps[0].FailOn = "all"
+	if _, ok := executeAutomationSteps(context.Background(), &native.Config{}, doc); !ok {
+		t.Fatalf("failOn=all should tolerate one failed branch")
+	}
+
+	bad := []automationStep{
+		{Type: "parallel"},
+		{Type: "parallel", Steps: []automationStep{{Type: "transport", Action: "next"}}, Concurrency: intPtr(0)},
+		{Type: "parallel", Steps: []automationStep{{Type: "transport", Action: "next"}}, FailOn: "some"},
+		{Type: "parallel", Steps: []automationStep{{Type: "transport", Action: "rewind"}}},
+		{Type: "parallel", Steps: []automationStep{{Type: "parallel", Steps: []automationStep{{Type: "transport", Action: "next"}}}}},
+	}
+	for _, st := range bad {
+		if err := validateAutomationStep(0, st); err == nil || !strings.Contains(err.Error(), "steps[0]") {
+			t.Fatalf("expected validation error for %+v, got %v", st, err)
+		}
+	}
+	if err := validateAutomationStep(1, bad[3]); err == nil || !strings.HasPrefix(err.Error(), "steps[1].steps[0].action") {
+		t.Fatalf("nested path err=%v", err)
+	}
+}
+
+func TestAutomationRunsHistoryAndStatus(t *testing.T) {
+	origPath, origRunWithInput := automationRunsPath, runNativeShortcutWithInput
+	t.Cleanup(func() { automationRunsPath, runNativeShortcutWithInput = origPath, origRunWithInput })
+	path := filepath.Join(t.TempDir(), "state", "automation-runs.jsonl")
+	automationRunsPath = func() (string, error) { return path, nil }
+	runNativeShortcutWithInput = func(context.Context, string, string) (string, error) { return "", nil }
+
+	doc := &automationFile{Version: "1", Name: "evening", Steps: []automationStep{{Type: "shortcut", Name: "Lights"}}}
+	captureStdout(t, func() { runAutomationDoc(context.Background(), &native.Config{}, doc, "evening.yaml", true, true) })
+	if runs, err := readAutomationRuns(); err != nil || len(runs) != 0 {
+		t.Fatalf("dry run recorded: runs=%+v err=%v", runs, err)
+	}
+	captureStdout(t, func() { runAutomationDoc(context.Background(), &native.Config{}, doc, "evening.yaml", false, true) })
+	failed := automationRun{
+		automationCommandResult: automationCommandResult{Name: "evening", Mode: "run", StartedAt: "2026-01-02T21:00:00Z", Steps: []automationStepResult{
+			{Index: 0, Type: "shortcut", OK: true},
+			{Index: 1, Type: "volume", Error: "no such room"},
+		}},
+		Source: "evening.yaml",
+	}
+	if err := appendAutomationRun(failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendAutomationRun(automationRun{automationCommandResult: automationCommandResult{Name: "movie", Mode: "run", OK: true, StartedAt: "2026-01-03T07:00:00Z"}, Source: "scene"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var runs []automationRun
+	out := captureStdout(t, func() { cmdAutomation(context.Background(), nil, []string{"history", "--name", "evening", "--json"}) })
+	if err := json.Unmarshal([]byte(out), &runs); err != nil {
+		t.Fatalf("decode history: %v out=%s", err, out)
+	}
+	if len(runs) != 2 || !runs[0].OK || runs[0].Source != "evening.yaml" || len(runs[0].Steps) != 1 || runs[0].StartedAt == "" || runs[1].OK {
+		t.Fatalf("history=%+v", runs)
+	}
+
+	var rows []automationStatusRow
+	out = captureStdout(t, func() { cmdAutomation(context.Background(), nil, []string{"status", "--json"}) })
+	if err := json.Unmarshal([]byte(out), &rows); err != nil {
+		t.Fatalf("decode status: %v out=%s", err, out)
+	}
+	if len(rows) != 2 || rows[0].Name != "evening" || rows[1].Name != "movie" {
+		t.Fatalf("status=%+v", rows)
+	}
+	if r := rows[0]; r.OK || r.Runs != 2 || r.Failures != 1 || r.FailedStep != "2:volume" || r.Error != "no such room" || r.LastRun != "2026-01-02T21:00:00Z" {
+		t.Fatalf("evening status=%+v", r)
+	}
+	out = captureStdout(t, func() { cmdAutomation(context.Background(), nil, []string{"history", "--limit", "1", "--plain"}) })
+	if out != "2026-01-03T07:00:00Z  movie  0  ok  0ms\n" {
+		t.Fatalf("plain history=%q", out)
+	}
+}
+
+func TestAutomationRunRedactsWebhookTokens(t *testing.T) {
+	origPath := automationRunsPath
+	t.Cleanup(func() { automationRunsPath = origPath })
+	path := filepath.Join(t.TempDir(), "automation-runs.jsonl")
+	automationRunsPath = func() (string, error) { return path, nil }
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	hook := automationStep{Type: "webhook", URL: srv.URL + "/hook?token=s3cret", Payload: map[string]any{"n": 1}}
+	doc := &automationFile{Version: "1", Name: "evening", Steps: []automationStep{
+		hook,
+		{Type: "parallel", Steps: []automationStep{hook}},
+	}}
+	out := captureStdout(t, func() { runAutomationDoc(context.Background(), &native.Config{}, doc, "evening.yaml", false, true) })
+	if !strings.Contains(out, `"ok": true`) || !strings.Contains(out, srv.URL+"/hook") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := captureStdout(t, func() { runAutomationDoc(context.Background(), &native.Config{}, doc, "evening.yaml", true, true) })
+	for name, s := range map[string]string{"output": out, "saved run": string(saved), "dry run": plan} {
+		if strings.Contains(s, "s3cret") {
+			t.Fatalf("%s leaks the webhook token: %s", name, s)
+		}
+	}
+	if doc.Steps[0].URL != srv.URL+"/hook?token=s3cret" || doc.Steps[1].Steps[0].URL != srv.URL+"/hook?token=s3cret" {
+		t.Fatalf("document modified: %+v", doc.Steps)
+	}
+}
+
+func TestAutomationServeHandler(t *testing.T) {
+	origPath, origRunWithInput := automationRunsPath, runNativeShortcutWithInput
+	t.Cleanup(func() { automationRunsPath, runNativeShortcutWithInput = origPath, origRunWithInput })
+	tmp := t.TempDir()
+	automationRunsPath = func() (string, error) { return filepath.Join(tmp, "automation-runs.jsonl"), nil }
+	var ran []string
+	runNativeShortcutWithInput = func(_ context.Context, name, _ string) (string, error) {
+		ran = append(ran, name)
+		switch name {
+		case "Broken":
+			return "", errors.New("shortcut failed")
+		case "Panic":
+			panic("shortcut panicked")
+		}
+		return "", nil
+	}
+	dir := filepath.Join(tmp, "routines")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"morning.yaml": "version: \"1\"\nname: morning\nsteps:\n  - type: shortcut\n    name: Blinds Up\n",
+		"broken.json":  `{"version":"1","name":"broken","steps":[{"type":"shortcut","name":"Broken"}]}`,
+		"invalid.yaml": "version: \"1\"\nname: invalid\nsteps:\n  - type: bogus\n",
+		"panic.yaml":   "version: \"1\"\nname: panic\nsteps:\n  - type: shortcut\n    name: Panic\n",
+		"notes.txt":    "not a routine",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &native.Config{Scenes: map[string]native.Scene{
+		"movie": {Steps: []json.RawMessage{json.RawMessage(`{"type":"shortcut","name":"Lights Down"}`)}},
+	}}
+	s := &automationServer{ctx: context.Background(), cfg: cfg, dir: dir, auth: serveAuth{token: "s3cret", loopbackOnly: true}}
+	srv := httptest.NewUnstartedServer(s.handler())
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.Start()
+	defer srv.Close()
+
+	var host, origin string
+	do := func(method, path, token string) (int, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if host != "" {
+			req.Host = host
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, b
+	}
+
+	if code, body := do("POST", "/run/morning", ""); code != http.StatusUnauthorized || !strings.Contains(string(body), "bearer token") {
+		t.Fatalf("no token: code=%d body=%s", code, body)
+	}
+	if code, _ := do("POST", "/run/morning", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: code=%d", code)
+	}
+	host = "evil.example:8765"
+	if code, _ := do("POST", "/run/morning", "s3cret"); code != http.StatusForbidden {
+		t.Fatalf("rebound host: code=%d", code)
+	}
+	host, origin = "", "https://evil.example"
+	if code, _ := do("POST", "/run/morning", "s3cret"); code != http.StatusForbidden {
+		t.Fatalf("foreign origin: code=%d", code)
+	}
+	origin = ""
+	if len(ran) != 0 {
+		t.Fatalf("rejected requests ran %v", ran)
+	}
+	// A panicking run must not keep the run lock: the runs below would hang.
+	req, err := http.NewRequest("POST", srv.URL+"/run/panic", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer s3cret")
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatalf("panic: status=%d, expected the connection to be dropped", resp.StatusCode)
+	}
+	ran = ran[:len(ran)-1]
+
+	var result automationCommandResult
+	code, body := do("POST", "/run/morning", "s3cret")
+	if err := json.Unmarshal(body, &result); err != nil || code != http.StatusOK || !result.OK || result.Mode != "run" {
+		t.Fatalf("morning: code=%d body=%s err=%v", code, body, err)
+	}
+	code, body = do("POST", "/run/movie?dryRun=true", "s3cret")
+	if err := json.Unmarshal(body, &result); err != nil || code != http.StatusOK || result.Mode != "dry-run" {
+		t.Fatalf("movie dry run: code=%d body=%s err=%v", code, body, err)
+	}
+	if code, body = do("POST", "/run/broken", "s3cret"); code != http.StatusInternalServerError || !strings.Contains(string(body), "shortcut failed") {
+		t.Fatalf("broken: code=%d body=%s", code, body)
+	}
+	if code, body = do("POST", "/run/invalid", "s3cret"); code != http.StatusUnprocessableEntity || !strings.Contains(string(body), "AUTOMATION_VALIDATION_ERROR") {
+		t.Fatalf("invalid: code=%d body=%s", code, body)
+	}
+	for _, path := range []string{"/run/missing", "/run/..%2Fmorning", "/run/notes"} {
+		if code, _ = do("POST", path, "s3cret"); code != http.StatusNotFound {
+			t.Fatalf("%s: code=%d", path, code)
+		}
+	}
+	if strings.Join(ran, ",") != "Blinds Up,Broken" {
+		t.Fatalf("ran=%v", ran)
+	}
+
+	var routines []routineRow
+	code, body = do("GET", "/routines", "s3cret")
+	if err := json.Unmarshal(body, &routines); err != nil || code != http.StatusOK {
+		t.Fatalf("routines: code=%d body=%s err=%v", code, body, err)
+	}
+	var names []string
+	for _, r := range routines {
+		names = append(names, r.Name)
+	}
+	if strings.Join(names, ",") != "movie,broken,invalid,morning,panic" || routines[0].Source != "scene" {
+		t.Fatalf("routines=%+v", routines)
+	}
+
+	runs, err := readAutomationRuns()
+	if err != nil || len(runs) != 2 || runs[0].Source != filepath.Join(dir, "morning.yaml") || runs[1].OK {
+		t.Fatalf("recorded runs=%+v err=%v", runs, err)
+	}
+	if !isLoopbackHost("127.0.0.1") || !isLoopbackHost("localhost") || isLoopbackHost("") || isLoopbackHost("0.0.0.0") {
+		t.Fatalf("isLoopbackHost")
+	}
+	lan := serveAuth{token: "s3cret"}
+	for h, want := range map[string]bool{"mac.local": true, "192.168.1.20": true, "::1": true, "evil.example": false} {
+		if got := lan.allowedHost(h); got != want {
+			t.Fatalf("allowedHost(%q)=%t, want %t", h, got, want)
+		}
+	}
+}
+
+func TestAutomationRecord(t *testing.T) {
+	origHistory, origRecording := historyPath, automationRecordingPath
+	t.Cleanup(func() { historyPath, automationRecordingPath = origHistory, origRecording })
+	tmp := t.TempDir()
+	historyPath = func() (string, error) { return filepath.Join(tmp, "history.jsonl"), nil }
+	automationRecordingPath = func() (string, error) { return filepath.Join(tmp, "recording.json"), nil }
+	out := filepath.Join(tmp, "evening.yaml")
+
+	if err := appendHistory(historyEntry{Time: "2020-01-01T00:00:00Z", Command: "pause", OK: true}); err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() { cmdAutomationRecord([]string{"--out", out}) })
+	_, recovered := captureStdoutAndRecover(t, func() { cmdAutomationRecord([]string{"--out", out}) })
+	if fatal, ok := recovered.(cliFatal); !ok || !strings.Contains(fatal.err.Error(), "already recording") {
+		t.Fatalf("second start: recovered=%#v", recovered)
+	}
+
+	result := func(v any) json.RawMessage {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	on := true
+	fade := 4
+	entries := []historyEntry{
+		{Command: "play", Args: []string{"chill", "--room", "Kitchen", "--volume", "30"}, OK: true,
+			Result: result(actionResult{OK: true, Action: "play", Backend: "airplay", Rooms: []string{"Kitchen"}, Playlist: "chill", PlaylistID: "ABC"})},
+		{Command: "volume", Args: []string{"+5", "Kitchen", "Den"}, OK: true,
+			Result: result(actionResult{OK: true, Action: "volume", Backend: "airplay", Rooms: []string{"Kitchen", "Den"}, NowPlaying: &music.NowPlaying{
+				Outputs: []music.AirPlayDevice{{Name: "Kitchen", Volume: 35}, {Name: "Den", Volume: 20}},
+			}})},
+		{Command: "out", Args: []string{"add", "Bedroom"}, OK: true, Result: result(actionResult{OK: true, Action: "out.add", Backend: "airplay", Rooms: []string{"Kitchen", "Den", "Bedroom"}})},
+		{Command: "next", OK: true, Result: result(actionResult{OK: true, Action: "next"})},
+		{Command: "shuffle", Args: []string{"on"}, OK: true, Result: result(playbackModeResult{OK: true, Action: "shuffle", Shuffle: &on})},
+		{Command: "crossfade", Args: []string{"4"}, OK: true, Result: result(playbackModeResult{OK: true, Action: "crossfade", Crossfade: &fade})},
+		{Command: "love", OK: true},
+		{Command: "stop", OK: false, ExitCode: 1},
+	}
+	for _, e := range entries {
+		e.Time = now
+		if err := appendHistory(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var res automationRecordResult
+	stdout := captureStdout(t, func() { cmdAutomationRecord([]string{"--stop", "--json"}) })
+	if err := json.Unmarshal([]byte(stdout), &res); err != nil {
+		t.Fatalf("decode: %v out=%s", err, stdout)
+	}
+	if res.Action != "record.stop" || res.Name != "evening" || res.Steps != 8 || strings.Join(res.Skipped, ",") != "crossfade 4,love" {
+		t.Fatalf("result=%+v", res)
+	}
+	doc, err := loadAutomationFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, st := range doc.Steps {
+		types = append(types, st.Type)
+	}
+	if got := strings.Join(types, ","); got != "out.set,volume.set,play,volume.set,volume.set,out.set,transport,shuffle.set" {
+		t.Fatalf("steps=%s", got)
+	}
+	if st := doc.Steps[2]; st.Query != "chill" || st.PlaylistID != "" {
+		t.Fatalf("play=%+v", st)
+	}
+	if st := doc.Steps[3]; *st.Value != 35 || strings.Join(st.Rooms, ",") != "Kitchen" {
+		t.Fatalf("volume=%+v", st)
+	}
+	if rec, err := loadAutomationRecording(); err != nil || rec != nil {
+		t.Fatalf("recording left behind: %+v err=%v", rec, err)
+	}
+	_, recovered = captureStdoutAndRecover(t, func() { cmdAutomationRecord([]string{"--cancel"}) })
+	if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+		t.Fatalf("cancel without recording: recovered=%#v", recovered)
+	}
+}
+
+func TestPreflightAutomation(t *testing.T) {
+	origList, origSearch, origName := listAirPlayDevices, searchPlaylists, findPlaylistNameByID
+	t.Cleanup(func() { listAirPlayDevices, searchPlaylists, findPlaylistNameByID = origList, origSearch, origName })
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Kitchen", Available: true, Selected: true, Volume: 20},
+			{Name: "Bedroom HomePod", Available: true, Volume: 10},
+			{Name: "Office", Available: false, Volume: 40},
+		}, nil
+	}
+	searchPlaylists = func(_ context.Context, q string) ([]music.UserPlaylist, error) {
+		if q == "Morning" {
+			return []music.UserPlaylist{{PersistentID: "PL1", Name: "Morning Mix"}}, nil
+		}
+		return nil, nil
+	}
+	findPlaylistNameByID = func(context.Context, string) (string, error) { return "", errors.New("not found") }
+
+	ceiling := 50
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", MaxVolume: &ceiling}}
+	doc := &automationFile{Version: "1", Name: "morning", Defaults: automationDefaults{Rooms: []string{"bedroom"}, Volume: intPtr(30)}, Steps: []automationStep{
+		{Type: "out.set", Rooms: []string{"Bedroom"}},
+		{Type: "play", Query: "Morning"},
+		{Type: "volume.set", Value: intPtr(70)},
+	}}
+	steps, ok, err := preflightAutomation(context.Background(), cfg, doc)
+	if err != nil || !ok {
+		t.Fatalf("ok=%t err=%v steps=%+v", ok, err, steps)
+	}
+	play := steps[1].Preflight
+	if play == nil || play.Playlist == nil || play.Playlist.ID != "PL1" || !play.Playlist.Resolved {
+		t.Fatalf("play preflight=%+v", play)
+	}
+	if len(play.Rooms) != 1 || play.Rooms[0].Device != "Bedroom HomePod" || !play.Rooms[0].Selected {
+		t.Fatalf("play rooms=%+v (out.set should have selected Bedroom)", play.Rooms)
+	}
+	if v := steps[2].Preflight.Volumes; len(v) != 1 || v[0].From != 30 || v[0].To != 50 || v[0].Limit != "maxVolume 50" {
+		t.Fatalf("volume.set volumes=%+v", v)
+	}
+
+	doc.Steps = []automationStep{
+		{Type: "play", PlaylistID: "GONE"},
+		{Type: "volume.set", Value: intPtr(20), Rooms: []string{"Office", "Attic"}},
+		{Type: "play", Query: "Jazz"},
+	}
+	steps, ok, err = preflightAutomation(context.Background(), cfg, doc)
+	if err != nil || ok {
+		t.Fatalf("ok=%t err=%v", ok, err)
+	}
+	if steps[0].OK || !strings.Contains(steps[0].Error, "playlistId GONE") {
+		t.Fatalf("step 0=%+v", steps[0])
+	}
+	if steps[1].OK || !strings.Contains(steps[1].Error, "Office is not available") || !strings.Contains(steps[1].Error, "Attic") {
+		t.Fatalf("step 1 error=%q", steps[1].Error)
+	}
+	if steps[2].OK || !strings.Contains(steps[2].Error, `no playlists match "Jazz"`) {
+		t.Fatalf("step 2 error=%q", steps[2].Error)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
 
@@ -22,6 +26,75 @@ func TestWantsJSONErrors(t *testing.T) {
 	if wantsJSONErrors([]string{"status", "--json=false"}) {
 		t.Fatalf("did not expect --json=false to enable JSON errors")
 	}
+	cases := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"status", "--json-stream"}, true},
+		{[]string{"play", "chill", "--json", "false"}, false},
+		{[]string{"play", "chill", "--json", "true", "--room", "Bedroom"}, true},
+		{[]string{"playlists", "--query", "--json"}, false},
+		{[]string{"alias", "sequence", "add", "evening", "--", "--json"}, false},
+		{[]string{"--timeout", "5s", "volume", "40", "--json"}, true},
+		{[]string{"status", "--output", "status.json"}, true},
+	}
+	for _, tc := range cases {
+		if got := wantsJSONErrors(tc.args); got != tc.want {
+			t.Fatalf("wantsJSONErrors(%v)=%t want %t", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	stdout := os.Stdout
+
+	if err := beginOutputFile(path); err != nil {
+		t.Fatalf("beginOutputFile: %v", err)
+	}
+	writeJSON(map[string]any{"ok": true})
+	if err := commitOutputFile(); err != nil {
+		t.Fatalf("commitOutputFile: %v", err)
+	}
+	if os.Stdout != stdout {
+		t.Fatalf("stdout was not restored")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || string(b) != "{\n  \"ok\": true\n}\n" {
+		t.Fatalf("file=%q err=%v", b, err)
+	}
+
+	if err := beginOutputFile(path); err != nil {
+		t.Fatalf("beginOutputFile: %v", err)
+	}
+	writeJSON(map[string]any{"ok": false})
+	abortOutputFile()
+	if after, _ := os.ReadFile(path); string(after) != string(b) {
+		t.Fatalf("aborted run replaced the file: %q", after)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Fatalf("temporary file left behind: %v", entries)
+	}
+
+	if err := checkOutputFileSupported("status", []string{"--fields", "track"}); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, tc := range []struct {
+		cmd  string
+		args []string
+	}{
+		{"status", []string{"--watch", "2s"}},
+		{"devices", []string{"--json-stream"}},
+		{"watch", nil},
+		{"tui", nil},
+	} {
+		if err := checkOutputFileSupported(tc.cmd, tc.args); err == nil || classifyExitCode(err) != exitUsage {
+			t.Fatalf("checkOutputFileSupported(%s, %v) = %v, want usage error", tc.cmd, tc.args, err)
+		}
+	}
+	if got := strings.Join(withJSONFlag([]string{"add", "x", "--", "--json"}), " "); got != "add x --json -- --json" {
+		t.Fatalf("withJSONFlag = %q", got)
+	}
 }
 
 func TestClassifyErrorCode(t *testing.T) {
@@ -77,6 +150,44 @@ func TestParsePlanArgsAndNormalizeTarget(t *testing.T) {
 	}
 }
 
+func TestNormalizePlanTarget_Subcommands(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{{"pause"}, {"automation", "validate", "-f", "x.yaml"}, {"eq", "set", "Rock"}, {"scene", "run", "movie"}} {
+		if _, _, err := normalizePlanTarget(args[0], args[1:]); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	for _, args := range [][]string{{"status"}, {"out", "list"}, {"automation", "init"}, {"eq"}} {
+		if _, _, err := normalizePlanTarget(args[0], args[1:]); err == nil || classifyExitCode(err) != exitUsage {
+			t.Fatalf("%v: expected usage error, got %v", args, err)
+		}
+	}
+}
+
+func TestRunPlanTargetInProcess(t *testing.T) {
+	env := &commandEnv{ctx: context.Background(), cfg: &native.Config{}}
+	cmd, args, err := normalizePlanTarget("next", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := runPlanTarget(env, cmd, args)
+	if err != nil {
+		t.Fatalf("runPlanTarget: %v", err)
+	}
+	if payload["action"] != "next" || payload["dryRun"] != true || dryRunAll {
+		t.Fatalf("payload=%v dryRunAll=%t", payload, dryRunAll)
+	}
+	// The plan comes from the resolved result, not the printed output.
+	payload, err = runPlanTarget(env, "pause", []string{"--plain"})
+	if err != nil || payload["action"] != "pause" || planCapture != nil {
+		t.Fatalf("payload=%v err=%v", payload, err)
+	}
+	if _, err := runPlanTarget(env, "shuffle", []string{"sideways", "--dry-run", "--json"}); err == nil || classifyExitCode(err) != exitUsage {
+		t.Fatalf("expected the target's usage error, got %v", err)
+	}
+}
+
 func TestParsePlanArgs_InvalidJSONBool(t *testing.T) {
 	t.Parallel()
 
@@ -138,3 +249,189 @@ func TestReadAutomationInputFromStdin(t *testing.T) {
 		t.Fatalf("unexpected stdin content: %s", string(b))
 	}
 }
+
+func TestPlaylistFilterAndSort(t *testing.T) {
+	t.Parallel()
+
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	all := []music.UserPlaylist{
+		{Name: "zeta", TrackCount: 3, Folder: "Workouts", Modified: &older},
+		{Name: "Alpha", TrackCount: 10, Smart: true},
+		{Name: "mid", TrackCount: 5, Folder: "workouts", Modified: &newer},
+	}
+	names := func(ps []music.UserPlaylist) string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	if got := names(playlistFilter{smartOnly: true}.apply(all)); got != "Alpha" {
+		t.Fatalf("smart-only=%q", got)
+	}
+	if got := names(playlistFilter{noSmart: true, folder: "WORKOUTS"}.apply(all)); got != "zeta,mid" {
+		t.Fatalf("no-smart folder=%q", got)
+	}
+	for by, want := range map[string]string{
+		"":       "zeta,Alpha,mid",
+		"name":   "Alpha,mid,zeta",
+		"count":  "Alpha,mid,zeta",
+		"recent": "mid,zeta,Alpha",
+	} {
+		ps := append([]music.UserPlaylist(nil), all...)
+		sortPlaylists(ps, by)
+		if got := names(ps); got != want {
+			t.Fatalf("sort %q=%q, want %q", by, got, want)
+		}
+	}
+}
+
+func TestCmdPlaylistsReadsDatesOnlyForRecent(t *testing.T) {
+	origList, origFill, origCached := listPlaylists, fillPlaylistModified, playlistCachedAt
+	t.Cleanup(func() { listPlaylists, fillPlaylistModified, playlistCachedAt = origList, origFill, origCached })
+
+	listPlaylists = func(context.Context, string, int) ([]music.UserPlaylist, error) {
+		return []music.UserPlaylist{{PersistentID: "A", Name: "old"}, {PersistentID: "B", Name: "new"}}, nil
+	}
+	playlistCachedAt = func() (time.Time, bool) { return time.Time{}, false }
+	fills := 0
+	fillPlaylistModified = func(_ context.Context, ps []music.UserPlaylist) error {
+		fills++
+		newer := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+		ps[1].Modified = &newer
+		return nil
+	}
+
+	captureStdout(t, func() { cmdPlaylists(context.Background(), []string{"--sort", "name", "--plain"}) })
+	if fills != 0 {
+		t.Fatalf("--sort name read track dates %d times", fills)
+	}
+	out := captureStdout(t, func() { cmdPlaylists(context.Background(), []string{"--sort", "recent", "--plain"}) })
+	if fills != 1 || !strings.HasPrefix(out, "B\t") {
+		t.Fatalf("fills=%d out=%q, want one read with B first", fills, out)
+	}
+}
+
+func TestExplainHeadless(t *testing.T) {
+	orig := guiSessionManager
+	t.Cleanup(func() { guiSessionManager = orig })
+	scriptErr := &music.ScriptError{Err: errors.New("exit status 1"), Output: "Connection is invalid. (-609)"}
+
+	guiSessionManager = func(context.Context) (string, error) { return "Aqua", nil }
+	if err := explainHeadless(scriptErr); classifyExitCode(err) != exitBackend {
+		t.Fatalf("GUI session: exit=%d err=%v", classifyExitCode(err), err)
+	}
+
+	guiSessionManager = func(context.Context) (string, error) { return "Background", nil }
+	err := explainHeadless(scriptErr)
+	if classifyExitCode(err) != exitNoGUI || classifyErrorCode(err) != "NO_GUI_SESSION" {
+		t.Fatalf("headless: exit=%d code=%s", classifyExitCode(err), classifyErrorCode(err))
+	}
+	if !strings.Contains(formatError(err), "exec --gui-session") {
+		t.Fatalf("message=%q", formatError(err))
+	}
+	if err := explainHeadless(usageErrf("bad flag")); classifyExitCode(err) != exitUsage {
+		t.Fatalf("non-backend errors must pass through, got %v", err)
+	}
+}
+
+func TestGUISessionArgv(t *testing.T) {
+	origManager, origEUID := guiSessionManager, geteuid
+	t.Cleanup(func() { guiSessionManager, geteuid = origManager, origEUID })
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guiSessionManager = func(context.Context) (string, error) { return "Aqua", nil }
+	argv, session, err := guiSessionArgv([]string{"status", "--json"}, "", true)
+	if err != nil || session != "Aqua" || strings.Join(argv, " ") != self+" status --json" {
+		t.Fatalf("GUI session: argv=%q session=%q err=%v", argv, session, err)
+	}
+
+	guiSessionManager = func(context.Context) (string, error) { return "Background", nil }
+	t.Setenv("SUDO_UID", "501")
+	geteuid = func() int { return 501 }
+	if _, _, err := guiSessionArgv([]string{"play", "chill"}, "", true); err == nil || !strings.Contains(err.Error(), "sudo homepodctl exec --gui-session -- play chill") {
+		t.Fatalf("expected a sudo hint, got %v", err)
+	}
+	geteuid = func() int { return 0 }
+	argv, _, err = guiSessionArgv([]string{"/usr/bin/osascript", "-e", "1"}, "", true)
+	want := "launchctl asuser 501 sudo -u #501 -- /usr/bin/osascript -e 1"
+	if err != nil || strings.Join(argv, " ") != want {
+		t.Fatalf("argv=%q err=%v, want %q", argv, err, want)
+	}
+}
+
+func TestPickerModelFiltersAndMoves(t *testing.T) {
+	t.Parallel()
+
+	m := newPickerModel([]pickerItem{
+		{label: "Autumn Jazz"},
+		{label: "Focus Mix", badge: "[smart]"},
+		{label: "Focus", badge: "[genius]"},
+	})
+	if len(m.visible) != 3 {
+		t.Fatalf("empty query should show every item, got %v", m.visible)
+	}
+	for _, key := range decodeKeys([]byte("focus")) {
+		m.handleKey(key)
+	}
+	if m.query != "focus" || len(m.visible) != 2 || m.visible[0] != 2 {
+		t.Fatalf("query=%q visible=%v, want the exact match first", m.query, m.visible)
+	}
+	lines := m.render("")
+	if lines[0] != "> focus" || lines[1] != "> Focus  [genius]" || lines[2] != "  Focus Mix  [smart]" {
+		t.Fatalf("render = %q", lines)
+	}
+	m.handleKey("down")
+	if done, picked := m.handleKey("enter"); !done || picked != 1 {
+		t.Fatalf("enter: done=%v picked=%d", done, picked)
+	}
+	m.handleKey("backspace")
+	if m.query != "focu" || m.cursor != 0 {
+		t.Fatalf("backspace: query=%q cursor=%d", m.query, m.cursor)
+	}
+	m.handleKey("z")
+	if done, _ := m.handleKey("enter"); done || len(m.visible) != 0 {
+		t.Fatalf("enter with no matches must not pick, visible=%v", m.visible)
+	}
+	if done, picked := m.handleKey("esc"); !done || picked != -1 {
+		t.Fatalf("esc: done=%v picked=%d", done, picked)
+	}
+
+	// Non-ASCII input reaches the query as whole runes.
+	m = newPickerModel([]pickerItem{{label: "Café del Mar"}, {label: "Cafeteria"}})
+	for _, key := range decodeKeys([]byte("café")) {
+		m.handleKey(key)
+	}
+	if m.query != "café" || len(m.visible) != 1 || m.visible[0] != 0 {
+		t.Fatalf("query=%q visible=%v", m.query, m.visible)
+	}
+	m.handleKey("backspace")
+	if m.query != "caf" {
+		t.Fatalf("backspace: query=%q", m.query)
+	}
+}
+
+func TestRunPicker(t *testing.T) {
+	t.Parallel()
+
+	items := []pickerItem{{label: "Chill"}, {label: "Chill Vibes"}, {label: "Dinner"}}
+	var out strings.Builder
+	got, err := runPicker(strings.NewReader("vib\r"), &out, "", items)
+	if err != nil || got != 1 {
+		t.Fatalf("runPicker = %d, %v", got, err)
+	}
+	if !strings.HasSuffix(out.String(), "\r\x1b[J") {
+		t.Fatalf("picker was not erased: %q", out.String())
+	}
+	if _, err := runPicker(strings.NewReader("\x1b"), io.Discard, "", items); !errors.Is(err, errPickerCancelled) {
+		t.Fatalf("esc: err=%v", err)
+	}
+	if _, err := runPicker(strings.NewReader("di"), io.Discard, "", items); err == nil {
+		t.Fatal("expected a read error at EOF")
+	}
+}
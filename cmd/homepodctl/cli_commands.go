@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// cliCommand is one top-level command. Its usage, and with it the flags it
+// accepts, comes from the commandDocs entry of the same name.
+type cliCommand struct {
+	Name    string
+	Aliases []string
+	// Raw commands see their arguments unchecked: plan forwards them to
+	// another command and __complete receives partial command lines.
+	Raw    bool
+	Hidden bool
+	// OwnsStdout commands speak a protocol on stdout that --quiet must not
+	// silence.
+	OwnsStdout bool
+	// Timeout is the command's default budget when it is not
+	// defaultCommandTimeout; --timeout still overrides it.
+	Timeout time.Duration
+	Run     func(env *commandEnv, args []string)
+}
+
+// commandTimeout is the budget for the whole command: --timeout when given
+// (raw), else the command's own default, else defaultCommandTimeout.
+func commandTimeout(command cliCommand, raw string) (time.Duration, error) {
+	if raw = strings.TrimSpace(raw); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return 0, usageErrf("invalid --timeout %q (expected duration like 10s)", raw)
+		}
+		return d, nil
+	}
+	if command.Timeout > 0 {
+		return command.Timeout, nil
+	}
+	return defaultCommandTimeout, nil
+}
+
+// commandEnv is what the dispatcher hands a command.
+type commandEnv struct {
+	ctx context.Context
+	// name is the name the command was invoked as (move or handoff, ...).
+	name string
+	cfg  *native.Config
+}
+
+// config loads config.json on first use, so commands that never read it
+// still run with a broken config.
+func (e *commandEnv) config() *native.Config {
+	if e.cfg != nil {
+		return e.cfg
+	}
+	cfg, err := native.LoadConfigOptional()
+	if err != nil {
+		die(err)
+	}
+	e.cfg = cfg
+	debugf("config: default_backend=%q default_rooms=%v aliases=%d", cfg.Defaults.Backend, cfg.Defaults.Rooms, len(cfg.Aliases))
+	return cfg
+}
+
+var cliCommands = []cliCommand{
+	{Name: "help", Run: func(e *commandEnv, args []string) { cmdHelp(args) }},
+	{Name: "version", Run: func(e *commandEnv, args []string) { fmt.Printf("homepodctl %s (%s) %s\n", version, commit, date) }},
+	{Name: "capabilities", Run: func(e *commandEnv, args []string) { cmdCapabilities(e.ctx, args) }},
+	{Name: "__complete", Raw: true, Hidden: true, OwnsStdout: true, Run: func(e *commandEnv, args []string) { cmdComplete(e.ctx, args) }},
+	{Name: "config", Run: func(e *commandEnv, args []string) { cmdConfig(args) }},
+	{Name: "automation", Timeout: longCommandTimeout, Run: func(e *commandEnv, args []string) { cmdAutomation(e.ctx, e.config(), args) }},
+	{Name: "plan", Raw: true}, // Run is set in init
+	{Name: "schema", Run: func(e *commandEnv, args []string) { cmdSchema(args) }},
+	{Name: "completion", Run: func(e *commandEnv, args []string) { cmdCompletion(args) }},
+	{Name: "docs", Run: func(e *commandEnv, args []string) { cmdDocs(args) }},
+	{Name: "setup", Run: func(e *commandEnv, args []string) { cmdSetup(e.ctx, args) }},
+	{Name: "doctor", Run: func(e *commandEnv, args []string) { cmdDoctor(e.ctx, args) }},
+	{Name: "devices", Run: func(e *commandEnv, args []string) { cmdDevices(e.ctx, args) }},
+	{Name: "discover", Run: func(e *commandEnv, args []string) { cmdDiscover(e.ctx, args) }},
+	{Name: "homekit", Run: func(e *commandEnv, args []string) { cmdHomeKit(e.ctx, args) }},
+	{Name: "audio", Run: func(e *commandEnv, args []string) { cmdAudio(e.ctx, e.config(), args) }},
+	{Name: "shortcuts", Run: func(e *commandEnv, args []string) { cmdShortcuts(e.ctx, args) }},
+	{Name: "out", Run: func(e *commandEnv, args []string) { cmdOut(e.ctx, e.config(), args) }},
+	{Name: "move", Aliases: []string{"handoff"}, Run: func(e *commandEnv, args []string) { cmdMove(e.ctx, e.config(), e.name, args) }},
+	{Name: "playlists", Run: func(e *commandEnv, args []string) { cmdPlaylists(e.ctx, args) }},
+	{Name: "cache", Run: func(e *commandEnv, args []string) { cmdCache(e.ctx, args) }},
+	{Name: "search", Run: func(e *commandEnv, args []string) { cmdSearch(e.ctx, args) }},
+	{Name: "catalog", Run: func(e *commandEnv, args []string) { cmdCatalog(e.ctx, e.config(), args) }},
+	{Name: "playlist", Run: func(e *commandEnv, args []string) { cmdPlaylist(e.ctx, args) }},
+	{Name: "status", Aliases: []string{"now"}, Run: func(e *commandEnv, args []string) { cmdStatus(e.ctx, args) }},
+	{Name: "tui", Run: func(e *commandEnv, args []string) { cmdTUI(e.ctx, args) }},
+	{Name: "watch", Run: func(e *commandEnv, args []string) { cmdWatch(e.ctx, args) }},
+	{Name: "scrobble", Run: func(e *commandEnv, args []string) { cmdScrobble(e.ctx, e.config(), args) }},
+	{Name: "rpc", OwnsStdout: true, Run: func(e *commandEnv, args []string) { cmdRPC(e.ctx, e.config(), args) }},
+	{Name: "streamdeck", Run: func(e *commandEnv, args []string) { cmdStreamDeck(e.config(), args) }},
+	{Name: "metrics", Run: func(e *commandEnv, args []string) { cmdMetrics(args) }},
+	{Name: "self-update", Timeout: selfUpdateTimeout, Run: func(e *commandEnv, args []string) { cmdSelfUpdate(e.ctx, args) }},
+	{Name: "daemon", Run: func(e *commandEnv, args []string) { cmdDaemon(args) }},
+	{Name: "aliases", Run: func(e *commandEnv, args []string) { cmdAliases(e.config(), args) }},
+	{Name: "alias", Run: func(e *commandEnv, args []string) { cmdAlias(e.ctx, args) }},
+	{Name: "run", Timeout: longCommandTimeout, Run: func(e *commandEnv, args []string) { cmdRun(e.ctx, e.config(), args) }},
+	{Name: "scene", Timeout: longCommandTimeout, Run: func(e *commandEnv, args []string) { cmdScene(e.ctx, e.config(), args) }},
+	{Name: "history", Run: func(e *commandEnv, args []string) { cmdHistory(args) }},
+	{Name: "state", Run: func(e *commandEnv, args []string) { cmdState(args) }},
+	{Name: "exec"}, // Run is set in init
+	{Name: "undo", Run: func(e *commandEnv, args []string) { cmdUndo(e.ctx, args) }},
+	{Name: "pause", Run: func(e *commandEnv, args []string) { cmdDeviceTransport(e.ctx, e.config(), args, "pause", music.Pause) }},
+	{Name: "stop", Run: func(e *commandEnv, args []string) { cmdDeviceTransport(e.ctx, e.config(), args, "stop", music.Stop) }},
+	{Name: "resume", Run: func(e *commandEnv, args []string) { cmdResume(e.ctx, e.config(), args) }},
+	{Name: "media", Run: func(e *commandEnv, args []string) { cmdMedia(e.ctx, args) }},
+	{Name: "next", Run: func(e *commandEnv, args []string) { cmdTransport(e.ctx, args, "next", music.NextTrack) }},
+	{Name: "prev", Run: func(e *commandEnv, args []string) { cmdTransport(e.ctx, args, "prev", music.PreviousTrack) }},
+	{Name: "love", Run: func(e *commandEnv, args []string) {
+		cmdTransport(e.ctx, args, "love", func(ctx context.Context) error { return setTrackLoved(ctx, true) })
+	}},
+	{Name: "dislike", Run: func(e *commandEnv, args []string) {
+		cmdTransport(e.ctx, args, "dislike", func(ctx context.Context) error { return setTrackDisliked(ctx, true) })
+	}},
+	{Name: "shuffle", Run: func(e *commandEnv, args []string) { cmdShuffle(e.ctx, args) }},
+	{Name: "crossfade", Run: func(e *commandEnv, args []string) { cmdCrossfade(e.ctx, args) }},
+	{Name: "eq", Run: func(e *commandEnv, args []string) { cmdEQ(e.ctx, args) }},
+	{Name: "rate", Run: func(e *commandEnv, args []string) { cmdRate(e.ctx, args) }},
+	{Name: "artwork", Run: func(e *commandEnv, args []string) { cmdArtwork(e.ctx, args) }},
+	{Name: "lyrics", Run: func(e *commandEnv, args []string) { cmdLyrics(e.ctx, args) }},
+	{Name: "play", Run: func(e *commandEnv, args []string) { cmdPlay(e.ctx, e.config(), args) }},
+	{Name: "radio", Run: func(e *commandEnv, args []string) { cmdRadio(e.ctx, e.config(), args) }},
+	{Name: "volume", Aliases: []string{"vol"}, Run: func(e *commandEnv, args []string) { cmdVolume(e.ctx, e.config(), e.name, args) }},
+	{Name: "mixer", Run: func(e *commandEnv, args []string) { cmdMixer(e.ctx, e.config(), args) }},
+	{Name: "mute", Run: func(e *commandEnv, args []string) { cmdMute(e.ctx, e.config(), args) }},
+	{Name: "unmute", Run: func(e *commandEnv, args []string) { cmdUnmute(e.ctx, e.config(), args) }},
+	{Name: "duck", Run: func(e *commandEnv, args []string) { cmdDuck(e.ctx, e.config(), args) }},
+	{Name: "unduck", Run: func(e *commandEnv, args []string) { cmdUnduck(e.ctx, e.config(), args) }},
+	{Name: "announce", Run: func(e *commandEnv, args []string) { cmdAnnounce(e.ctx, e.config(), args) }},
+	{Name: "native-run", Run: func(e *commandEnv, args []string) { cmdNativeRun(e.ctx, args) }},
+	{Name: "config-init", Run: func(e *commandEnv, args []string) { cmdConfigInit() }},
+}
+
+// plan runs other commands from the table and exec looks them up, so their
+// Run is filled in once the table exists; referring to them directly would be
+// an initialization cycle.
+func init() {
+	for i := range cliCommands {
+		switch cliCommands[i].Name {
+		case "plan":
+			cliCommands[i].Run = func(e *commandEnv, args []string) { cmdPlan(e, args) }
+		case "exec":
+			cliCommands[i].Run = func(e *commandEnv, args []string) { cmdExec(e.ctx, args) }
+		}
+	}
+}
+
+func lookupCliCommand(name string) (cliCommand, bool) {
+	for _, c := range cliCommands {
+		if c.Name == name || containsString(c.Aliases, name) {
+			return c, true
+		}
+	}
+	return cliCommand{}, false
+}
+
+// commandUsage returns the usage lines documented for the command name was
+// invoked as, falling back to all of its page's lines.
+func commandUsage(name string) []string {
+	d, ok := lookupCommandDoc(name)
+	if !ok {
+		return nil
+	}
+	var own []string
+	for _, line := range d.Usage {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && containsString(strings.Split(fields[1], "|"), name) {
+			own = append(own, line)
+		}
+	}
+	if len(own) == 0 {
+		return d.Usage
+	}
+	return own
+}
+
+// sharedCommandFlags are accepted after every command: --json and --plain
+// are read by the commands that support them, and hoistGlobalFlags applies
+// the rest as global options (--output only where --json is).
+var sharedCommandFlags = []string{"--json", "--plain", "--dry-run", "--verbose", "--quiet", "--yes", "--timeout", "--output", "--help"}
+
+// checkCommandFlags rejects flags the command's usage lines do not mention,
+// instead of letting the command silently ignore them.
+func checkCommandFlags(name string, args []string) error {
+	usageLines := commandUsage(name)
+	if usageLines == nil {
+		return nil
+	}
+	accepted := map[string]bool{}
+	for _, f := range usageFlags(usageLines) {
+		accepted[f.Name] = true
+	}
+	for _, f := range sharedCommandFlags {
+		accepted[f] = true
+	}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		if !strings.HasPrefix(a, "-") || a == "-" || a == "-h" || isNumericArg(a) {
+			continue
+		}
+		flagName, _, hasVal := strings.Cut(a, "=")
+		def, known := lookupFlagDef(flagName)
+		if known && accepted[flagName] {
+			if def.takesValue() && !hasVal {
+				i++
+			}
+			continue
+		}
+		if !known {
+			// parseArgs reports flags that do not exist at all.
+			continue
+		}
+		return usageErrf("unknown flag for %s: %s\nusage: %s", name, flagName, strings.Join(usageLines, "\n       "))
+	}
+	return nil
+}
+
+// hoistGlobalFlags moves --verbose, --quiet, --yes, and (unless the command has
+// its own) --timeout from after the command name into opts, so they work in
+// either position. --dry-run stays for the commands that read it but also
+// turns on the global dry run, so commands that only honor the global one
+// (config set, config-init) cannot miss it.
+func hoistGlobalFlags(opts *globalOptions, name string, args []string) []string {
+	ownTimeout := false
+	for _, f := range usageFlags(commandUsage(name)) {
+		if f.Name == "--timeout" {
+			ownTimeout = true
+		}
+	}
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case a == "-v" || a == "--verbose":
+			opts.verbose = true
+		case a == "-q" || a == "--quiet":
+			opts.quiet = true
+		case a == "-y" || a == "--yes":
+			opts.yes = true
+		case a == "--dry-run" || a == "--dry-run=true":
+			opts.dryRun = true
+			rest = append(rest, a)
+		case a == "--output" || strings.HasPrefix(a, "--output="):
+			if v, ok := strings.CutPrefix(a, "--output="); ok {
+				opts.output = v
+			} else if i+1 < len(args) {
+				i++
+				opts.output = args[i]
+			} else {
+				rest = append(rest, a)
+			}
+		case (a == "--timeout" || strings.HasPrefix(a, "--timeout=")) && !ownTimeout:
+			if v, ok := strings.CutPrefix(a, "--timeout="); ok {
+				opts.timeout = v
+			} else if i+1 < len(args) {
+				i++
+				opts.timeout = args[i]
+			} else {
+				rest = append(rest, a)
+			}
+		default:
+			rest = append(rest, a)
+			if def, ok := lookupFlagDef(a); ok && def.takesValue() && i+1 < len(args) {
+				i++
+				rest = append(rest, args[i])
+			}
+		}
+	}
+	return rest
+}
+
+// wantsCommandHelp reports whether -h or --help appears among a command's
+// arguments.
+func wantsCommandHelp(args []string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if a == "-h" || a == "--help" {
+			return true
+		}
+	}
+	return false
+}
+
+func isNumericArg(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
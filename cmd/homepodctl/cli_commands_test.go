@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCommandFlags(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"play", []string{"chill", "--room", "Kitchen", "--shuffle", "--json"}, true},
+		{"play", []string{"chill", "--check"}, false},
+		{"pause", []string{"--room", "Kitchen", "--exact"}, true},
+		{"unmute", []string{"Kitchen", "--exact"}, false},
+		{"mute", []string{"Kitchen", "--exact"}, true},
+		{"vol", []string{"-10", "Kitchen", "--backend", "native"}, true},
+		{"status", []string{"--watch", "2s", "--verbose"}, true},
+		{"schema", []string{"--write-dir", "/tmp/x"}, true},
+		{"config", []string{"import", "-", "--merge"}, true},
+		{"native-run", []string{"--shortcut", "x", "--input", "--room"}, true},
+		{"aliases", []string{"--", "--room"}, true},
+	}
+	for _, tc := range cases {
+		err := checkCommandFlags(tc.name, tc.args)
+		if (err == nil) != tc.ok {
+			t.Errorf("checkCommandFlags(%s %v) = %v, want ok=%v", tc.name, tc.args, err, tc.ok)
+		}
+	}
+	err := checkCommandFlags("play", []string{"--check"})
+	if err == nil || !strings.Contains(err.Error(), "usage: homepodctl play <playlist-query>") {
+		t.Fatalf("error should carry the usage lines: %v", err)
+	}
+}
+
+func TestHoistGlobalFlags(t *testing.T) {
+	var opts globalOptions
+	rest := hoistGlobalFlags(&opts, "play", []string{"chill", "--verbose", "-q", "--yes", "--timeout", "5s", "--dry-run", "--shortcut", "-v"})
+	if !opts.verbose || !opts.quiet || !opts.yes || !opts.dryRun || opts.timeout != "5s" {
+		t.Fatalf("opts = %+v", opts)
+	}
+	if got := strings.Join(rest, " "); got != "chill --dry-run --shortcut -v" {
+		t.Fatalf("rest = %q", got)
+	}
+
+	opts = globalOptions{}
+	rest = hoistGlobalFlags(&opts, "status", []string{"--output", "status.json", "--fields", "track"})
+	if opts.output != "status.json" || strings.Join(rest, " ") != "--fields track" {
+		t.Fatalf("--output: opts=%+v rest=%v", opts, rest)
+	}
+
+	opts = globalOptions{}
+	rest = hoistGlobalFlags(&opts, "discover", []string{"--timeout", "2s"})
+	if opts.timeout != "" || len(rest) != 2 {
+		t.Fatalf("discover keeps its own --timeout: opts=%+v rest=%v", opts, rest)
+	}
+}
+
+// Every flag a usage line documents must get through parseArgs, which
+// decides switch or value from flagDefs.
+func TestParseArgsAcceptsDocumentedFlags(t *testing.T) {
+	for _, d := range commandDocs {
+		for _, f := range usageFlags(d.Usage) {
+			args := []string{f.Name}
+			if def, _ := lookupFlagDef(f.Name); def.takesValue() {
+				args = append(args, "x")
+			}
+			flags, positionals, err := parseArgs(args)
+			if err != nil {
+				t.Errorf("%s: parseArgs(%v): %v", d.Name, args, err)
+				continue
+			}
+			if len(positionals) != 0 || !flags.has(strings.TrimLeft(f.Name, "-")) {
+				t.Errorf("%s: parseArgs(%v) = %v, %v", d.Name, args, flags.kv, positionals)
+			}
+		}
+	}
+}
+
+func TestCliCommandsAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, c := range cliCommands {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if seen[name] {
+				t.Errorf("command %q registered twice", name)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	cases := []struct {
+		cmd, raw string
+		want     time.Duration
+	}{
+		{"play", "", defaultCommandTimeout},
+		{"run", "", longCommandTimeout},
+		{"automation", "", longCommandTimeout},
+		{"scene", "", longCommandTimeout},
+		{"self-update", "", selfUpdateTimeout},
+		{"run", "2h", 2 * time.Hour},
+		{"play", "5s", 5 * time.Second},
+	}
+	for _, tc := range cases {
+		c, ok := lookupCliCommand(tc.cmd)
+		if !ok {
+			t.Fatalf("no command %q", tc.cmd)
+		}
+		if got, err := commandTimeout(c, tc.raw); err != nil || got != tc.want {
+			t.Errorf("commandTimeout(%s, %q) = %v, %v; want %v", tc.cmd, tc.raw, got, err, tc.want)
+		}
+	}
+	if _, err := commandTimeout(cliCommand{}, "-1s"); err == nil || classifyExitCode(err) != exitUsage {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+}
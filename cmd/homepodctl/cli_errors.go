@@ -9,6 +9,7 @@ import (
 
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/transport"
 )
 
 type jsonErrorResponse struct {
@@ -40,9 +41,7 @@ func exitCode(code int) {
 
 func emitAndExit(err error) {
 	code := classifyExitCode(err)
-	if verbose {
-		fmt.Fprintf(os.Stderr, "debug: exit_code=%d error_type=%T\n", code, err)
-	}
+	logger.Info("exit", "code", code, "error_type", fmt.Sprintf("%T", err), "error", err.Error())
 	if jsonErrorOut {
 		enc := json.NewEncoder(os.Stderr)
 		enc.SetIndent("", "  ")
@@ -60,20 +59,43 @@ func emitAndExit(err error) {
 	os.Exit(code)
 }
 
+// wantsJSONErrors reports whether args ask for --json, --json-stream, or
+// --output, reading them the way parseArgs does: other flags' values and
+// anything after -- are skipped, and "--json false" turns JSON off. main calls
+// it before any parsing so that even flag errors come back as JSON.
 func wantsJSONErrors(args []string) bool {
-	for _, a := range args {
-		if a == "--json" {
-			return true
+	mode := parsedArgs{kv: map[string][]string{}}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		name, val, hasVal := strings.Cut(a, "=")
+		def, ok := lookupFlagDef(name)
+		if !ok {
+			continue
+		}
+		if name == "--output" {
+			// --output implies --json.
+			mode.kv["json"] = append(mode.kv["json"], "true")
 		}
-		if strings.HasPrefix(a, "--json=") {
-			v := strings.TrimSpace(strings.TrimPrefix(a, "--json="))
-			switch strings.ToLower(v) {
-			case "1", "true", "yes", "on":
-				return true
+		if def.takesValue() {
+			if !hasVal {
+				i++
 			}
+			continue
 		}
+		if name != "--json" && name != "--json-stream" {
+			continue
+		}
+		if !hasVal && i+1 < len(args) && isBoolWord(args[i+1]) {
+			i++
+			val = args[i]
+		}
+		mode.kv["json"] = append(mode.kv["json"], val)
 	}
-	return false
+	on, _ := mode.bool("json")
+	return on
 }
 
 func classifyErrorCode(err error) string {
@@ -88,6 +110,8 @@ func classifyErrorCode(err error) string {
 		return "CONFIG_ERROR"
 	case exitBackend:
 		return "BACKEND_ERROR"
+	case exitNoGUI:
+		return "NO_GUI_SESSION"
 	default:
 		return "GENERIC_ERROR"
 	}
@@ -97,6 +121,13 @@ func formatError(err error) string {
 	if verbose {
 		return err.Error()
 	}
+	var headlessErr *headlessError
+	if errors.As(err, &headlessErr) {
+		return fmt.Sprintf("Music.app and Shortcuts may not answer outside a GUI session (this one is %s, e.g. an ssh login). Run the command from a desktop login, or wrap it: sudo homepodctl exec --gui-session -- <command>.", headlessErr.session)
+	}
+	if errors.Is(err, transport.ErrUnreachable) {
+		return fmt.Sprintf("could not reach %s over SSH (check the host, and that ssh logs in without a prompt). Re-run with --verbose for details.", remoteHost)
+	}
 	var scriptErr *music.ScriptError
 	if errors.As(err, &scriptErr) {
 		if msg := friendlyScriptError(scriptErr.Output); msg != "" {
@@ -153,6 +184,10 @@ func classifyExitCode(err error) int {
 	if errors.As(err, &ue) {
 		return exitUsage
 	}
+	var roomErr *music.UnknownRoomError
+	if errors.As(err, &roomErr) {
+		return exitUsage
+	}
 	var cfgErr *native.ConfigError
 	if errors.As(err, &cfgErr) {
 		return exitConfig
@@ -161,10 +196,18 @@ func classifyExitCode(err error) int {
 	if errors.As(err, &autoValErr) {
 		return exitConfig
 	}
+	var headlessErr *headlessError
+	if errors.As(err, &headlessErr) {
+		return exitNoGUI
+	}
 	var scriptErr *music.ScriptError
 	if errors.As(err, &scriptErr) {
 		return exitBackend
 	}
+	var partialErr *music.PartialSelectionError
+	if errors.As(err, &partialErr) {
+		return exitBackend
+	}
 	var shortcutErr *native.ShortcutError
 	if errors.As(err, &shortcutErr) {
 		return exitBackend
@@ -172,13 +215,6 @@ func classifyExitCode(err error) int {
 	return exitGeneric
 }
 
-func debugf(format string, args ...any) {
-	if !verbose {
-		return
-	}
-	fmt.Fprintf(os.Stderr, "debug: "+format+"\n", args...)
-}
-
 func envTruthy(v string) bool {
 	switch strings.ToLower(strings.TrimSpace(v)) {
 	case "1", "true", "yes", "on":
@@ -0,0 +1,126 @@
+package main
+
+// flagDef defines a command-line flag once for parsing, completion, help, and
+// man pages. Kind names the values it takes (see completionValues); flags
+// without Kind or Enum are switches.
+type flagDef struct {
+	Name string
+	Desc string
+	Kind string
+	Enum []string
+}
+
+// flagDefs holds every flag; which commands accept it comes from their usage
+// lines in commandDocs.
+var flagDefs = []flagDef{
+	{Name: "--help", Desc: "show help"},
+	{Name: "--version", Desc: "show version"},
+	{Name: "--json", Desc: "output JSON"},
+	{Name: "--plain", Desc: "plain output"},
+	{Name: "--verbose", Desc: "verbose diagnostics"},
+	{Name: "--quiet", Desc: "suppress all non-error stdout"},
+	{Name: "--yes", Desc: "accept interactive prompts without asking"},
+	{Name: "--profile", Desc: "config profile", Kind: "profiles"},
+	{Name: "--config", Desc: "config file", Kind: "files"},
+	{Name: "--log-level", Desc: "log level", Enum: []string{"debug", "info", "warn", "error"}},
+	{Name: "--log-format", Desc: "log format", Enum: []string{"text", "json"}},
+	{Name: "--dry-run", Desc: "preview without side effects"},
+	{Name: "--no-cache", Desc: "bypass the playlist cache"},
+	{Name: "--no-launch", Desc: "do not launch Music.app"},
+	{Name: "--retries", Desc: "retries for transient Music.app failures", Kind: "value"},
+	{Name: "--pin", Desc: "save the picked playlist in an alias", Kind: "aliases"},
+	{Name: "--gui-session", Desc: "run in the logged-in user's GUI session"},
+	{Name: "--user", Desc: "user whose GUI session to use", Kind: "value"},
+	{Name: "--host", Desc: "run Music.app and Shortcuts calls on another Mac over SSH", Kind: "remotes"},
+	{Name: "--backend", Desc: "backend", Enum: []string{"airplay", "native"}},
+	{Name: "--room", Desc: "room name", Kind: "rooms"},
+	{Name: "--playlist", Desc: "playlist name", Kind: "playlists"},
+	{Name: "--playlist-id", Desc: "playlist ID", Kind: "value"},
+	{Name: "--shuffle", Desc: "shuffle toggle"},
+	{Name: "--mode", Desc: "shuffle mode", Enum: []string{"songs", "albums", "groupings"}},
+	{Name: "--ui-scripting", Desc: "allow driving Music.app's settings window"},
+	{Name: "--track", Desc: "start at the track with this name", Kind: "value"},
+	{Name: "--track-index", Desc: "start at track N (1-based)", Kind: "value"},
+	{Name: "--resume", Desc: "start at the last played track"},
+	{Name: "--volume", Desc: "volume 0-100", Kind: "value"},
+	{Name: "--watch", Desc: "poll interval", Kind: "value"},
+	{Name: "--json-stream", Desc: "emit NDJSON change events"},
+	{Name: "--listen", Desc: "HTTP listen address", Kind: "value"},
+	{Name: "--write-dir", Desc: "write schemas to directory", Kind: "dirs"},
+	{Name: "--channel", Desc: "release channel", Enum: []string{"stable", "beta"}},
+	{Name: "--check", Desc: "only check for an update"},
+	{Name: "--force", Desc: "override a safety check (dev build, maxVolume, quiet hours)"},
+	{Name: "--query", Desc: "playlist filter", Kind: "value"},
+	{Name: "--limit", Desc: "max results", Kind: "value"},
+	{Name: "--since", Desc: "only entries newer than this duration", Kind: "value"},
+	{Name: "--folder", Desc: "playlist folder", Kind: "folders"},
+	{Name: "--sort", Desc: "sort order", Enum: []string{"name", "count", "recent"}},
+	{Name: "--smart-only", Desc: "only smart playlists"},
+	{Name: "--no-smart", Desc: "skip smart playlists"},
+	{Name: "--shortcut", Desc: "shortcut name", Kind: "value"},
+	{Name: "--include-network", Desc: "include network address"},
+	{Name: "--kind", Desc: "only devices of this kind", Enum: []string{"homepod", "tv", "airport", "computer", "bluetooth", "other"}},
+	{Name: "--only-kind", Desc: "drop rooms whose device is another kind", Enum: []string{"homepod", "tv", "airport", "computer", "bluetooth", "other"}},
+	{Name: "--refresh", Desc: "ask Music.app instead of the cache"},
+	{Name: "--file", Desc: "input file", Kind: "files"},
+	{Name: "-f", Desc: "input file", Kind: "files"},
+	{Name: "--choose", Desc: "pick from matching playlists"},
+	{Name: "--no-input", Desc: "non-interactive mode"},
+	{Name: "--no-restore", Desc: "skip restoring playback position"},
+	{Name: "--strict", Desc: "fail when a room does not join the AirPlay selection"},
+	{Name: "--exact", Desc: "match room names exactly"},
+	{Name: "--synchronized", Desc: "start every room at once"},
+	{Name: "--resolve", Desc: "plan from the file alone or check it against Music.app", Enum: []string{"static", "live"}},
+	{Name: "--sync", Desc: "move Music's master volume and scale every selected output with it"},
+	{Name: "--stdio", Desc: "serve over stdin/stdout"},
+	{Name: "--notify", Desc: "post notifications on track change"},
+	{Name: "--format", Desc: "Go template for each status line", Kind: "value"},
+	{Name: "--fields", Desc: "status blocks to print (player,track,source,volume,outputs,route,connection)", Kind: "value"},
+	{Name: "--term", Desc: "render inline in the terminal"},
+	{Name: "--out", Desc: "output file", Kind: "files"},
+	{Name: "--output", Desc: "write the JSON output to this file atomically", Kind: "files"},
+	{Name: "--width", Desc: "width in terminal cells", Kind: "value"},
+	{Name: "--track-id", Desc: "track persistent ID", Kind: "value"},
+	{Name: "--type", Desc: "search type", Enum: []string{"track", "album", "artist"}},
+	{Name: "--on-track-change", Desc: "hook command", Kind: "value"},
+	{Name: "--on-state-change", Desc: "hook command", Kind: "value"},
+	{Name: "--interval", Desc: "poll interval", Kind: "value"},
+	{Name: "--addr", Desc: "listen address", Kind: "value"},
+	{Name: "--socket", Desc: "daemon socket", Kind: "files"},
+	{Name: "--timeout", Desc: "command or discovery timeout", Kind: "value"},
+	{Name: "--input", Desc: "shortcut input text", Kind: "value"},
+	{Name: "--preset", Desc: "preset name", Enum: []string{"morning", "focus", "winddown", "party", "reset"}},
+	{Name: "--name", Desc: "routine name", Kind: "value"},
+	{Name: "--from", Desc: "source profile", Kind: "profiles"},
+	{Name: "--redact", Desc: "redact secrets"},
+	{Name: "--merge", Desc: "keep existing entries"},
+	{Name: "--no-verify", Desc: "skip playlist and room checks"},
+	{Name: "--path", Desc: "completion file or directory", Kind: "files"},
+	{Name: "--token", Desc: "bearer token for HTTP callers", Kind: "value"},
+	{Name: "--dir", Desc: "routines directory", Kind: "dirs"},
+	{Name: "--stop", Desc: "finish the recording and write the routine"},
+	{Name: "--cancel", Desc: "discard the recording"},
+	{Name: "--to", Desc: "volume to duck to (0-100)", Kind: "value"},
+	{Name: "--for", Desc: "restore ducked volumes after this duration", Kind: "value"},
+	{Name: "--voice", Desc: "say voice for the announcement", Kind: "value"},
+	{Name: "--reset", Desc: "switch the system output back"},
+	{Name: "--station", Desc: "radio station query", Kind: "value"},
+	{Name: "--catalog", Desc: "Apple Music catalog query (artist:, album:, song:, playlist:)", Kind: "value"},
+	{Name: "--app", Desc: "player app", Enum: []string{"music", "spotify"}},
+}
+
+// globalValueFlags take a value before the command name.
+var globalValueFlags = map[string]bool{
+	"--profile": true, "--config": true, "--timeout": true, "--retries": true, "--log-level": true, "--log-format": true, "--host": true,
+}
+
+func lookupFlagDef(name string) (flagDef, bool) {
+	for _, f := range flagDefs {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return flagDef{}, false
+}
+
+func (f flagDef) takesValue() bool { return f.Kind != "" || len(f.Enum) > 0 }
@@ -0,0 +1,1339 @@
+package main
+
+import "strings"
+
+// commandDoc describes one command for `help <command>`, the root usage,
+// `help --json`, and `docs man`. Flags and arguments are read off the usage
+// lines, so adding a flag to Usage is enough to document it everywhere.
+type commandDoc struct {
+	Name string
+	// Aliases are the other command names this page covers.
+	Aliases []string
+	Summary string
+	Usage   []string
+	// Synopsis replaces Usage in the root usage when the full form is too long.
+	Synopsis []string
+	Notes    []string
+	Sections []docSection
+	Examples []string
+}
+
+// docSection is a titled block such as the RPC methods or the config paths.
+type docSection struct {
+	Title string
+	Lines []string
+}
+
+// docFlag and docArg are read off usage lines by usageFlags and usageArgs.
+type docFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	Desc  string `json:"description,omitempty"`
+}
+
+type docArg struct {
+	Name string `json:"name"`
+}
+
+// commandHelp is one command as help --json reports it.
+type commandHelp struct {
+	Name     string       `json:"name"`
+	Aliases  []string     `json:"aliases,omitempty"`
+	Summary  string       `json:"summary"`
+	Usage    []string     `json:"usage"`
+	Args     []docArg     `json:"args,omitempty"`
+	Flags    []docFlag    `json:"flags,omitempty"`
+	Notes    []string     `json:"notes,omitempty"`
+	Sections []docSection `json:"sections,omitempty"`
+	Examples []string     `json:"examples,omitempty"`
+}
+
+type helpIndex struct {
+	Name     string        `json:"name"`
+	Version  string        `json:"version"`
+	Summary  string        `json:"summary"`
+	Usage    []string      `json:"usage"`
+	Flags    []docFlag     `json:"flags"`
+	Notes    []string      `json:"notes"`
+	Commands []commandHelp `json:"commands"`
+}
+
+const rootSummary = "control Apple Music + HomePods (macOS)"
+
+func lookupCommandDoc(name string) (commandDoc, bool) {
+	for _, d := range commandDocs {
+		if d.Name == name || containsString(d.Aliases, name) {
+			return d, true
+		}
+	}
+	return commandDoc{}, false
+}
+
+func (d commandDoc) help() commandHelp {
+	return commandHelp{
+		Name:     d.Name,
+		Aliases:  d.Aliases,
+		Summary:  d.Summary,
+		Usage:    d.Usage,
+		Args:     usageArgs(d.Usage),
+		Flags:    usageFlags(d.Usage),
+		Notes:    d.Notes,
+		Sections: d.Sections,
+		Examples: d.Examples,
+	}
+}
+
+func buildHelpIndex() helpIndex {
+	idx := helpIndex{
+		Name:    "homepodctl",
+		Version: version,
+		Summary: rootSummary,
+		Usage:   rootUsage,
+		Flags:   usageFlags(rootUsage),
+		Notes:   rootNotes,
+	}
+	for _, d := range commandDocs {
+		idx.Commands = append(idx.Commands, d.help())
+	}
+	return idx
+}
+
+// usageWords splits a usage line into words without the grouping brackets,
+// keeping alternatives such as airplay|native together.
+func usageWords(line string) []string {
+	var words []string
+	for _, w := range strings.Fields(line) {
+		w = strings.Trim(w, "[]")
+		// "--" ends the flags (exec -- <command>); it is not one itself.
+		if w != "" && w != "|" && w != "..." && w != "--" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// usageFlags lists the flags named on usage lines in order of appearance,
+// with the value placeholder that follows each one and its description
+// from the completion table.
+func usageFlags(lines []string) []docFlag {
+	var flags []docFlag
+	seen := map[string]bool{}
+	for _, line := range lines {
+		words := usageWords(line)
+		for i, w := range words {
+			if !strings.HasPrefix(w, "-") {
+				continue
+			}
+			value := ""
+			if i+1 < len(words) && takesUsageValue(w) {
+				value = words[i+1]
+			}
+			for _, name := range strings.Split(w, "|") {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				f, _ := lookupFlagDef(name)
+				flags = append(flags, docFlag{Name: name, Value: value, Desc: f.Desc})
+			}
+		}
+	}
+	return flags
+}
+
+func takesUsageValue(word string) bool {
+	f, ok := lookupFlagDef(word)
+	return ok && f.takesValue()
+}
+
+// usageArgs lists the <placeholders> on usage lines that are not flag values.
+func usageArgs(lines []string) []docArg {
+	var args []docArg
+	seen := map[string]bool{}
+	for _, line := range lines {
+		words := usageWords(line)
+		for i, w := range words {
+			if !strings.HasPrefix(w, "<") || w == "<command>" {
+				continue
+			}
+			if i > 0 && takesUsageValue(words[i-1]) {
+				continue
+			}
+			if !seen[w] {
+				seen[w] = true
+				args = append(args, docArg{Name: w})
+			}
+		}
+	}
+	return args
+}
+
+// rootUsage lists the global forms; the root usage follows them with every
+// command's synopsis.
+var rootUsage = []string{
+	"homepodctl [--verbose] [--quiet] --help",
+	"homepodctl [--verbose] [--quiet] --version",
+	"homepodctl [--verbose] [--quiet] <command> [args]",
+	"homepodctl --profile <name> <command> [args]",
+	"homepodctl --dry-run <command> [args]",
+	"homepodctl --yes <command> [args]",
+	"homepodctl --timeout <duration> <command> [args]",
+	"homepodctl --retries <n> <command> [args]",
+	"homepodctl --no-cache <command> [args]",
+	"homepodctl --no-launch <command> [args]",
+	"homepodctl --log-level debug|info|warn|error --log-format text|json <command> [args]",
+	"homepodctl --config <path> <command> [args]",
+	"homepodctl --host <user@host|remote> <command> [args]",
+}
+
+var rootNotes = []string{
+	"backend=airplay uses Music.app AirPlay selection (Mac is the sender).",
+	"backend=native runs a Shortcut you map in the config file (HomePod plays natively if your Shortcut/Scene is set up that way).",
+	"defaults come from config.json (run homepodctl config-init); commands use defaults when flags/args are omitted.",
+	"if no rooms are provided and defaults.rooms is empty, airplay commands fall back to Music.app’s currently selected AirPlay outputs (when possible).",
+	`room names may also be group names from config.json groups (e.g. "downstairs"), which expand to their member rooms.`,
+	`config.json devices maps friendly room names to exact AirPlay device names (e.g. "office" -> "Agis's Office HomePod"); the friendly name works anywhere a room is accepted, so renaming a HomePod only needs that one entry updated.`,
+	`airplay room names match AirPlay devices case-insensitively, and a unique prefix or substring is enough ("bedroom" finds "Bedroom HomePod"); unknown names get "did you mean" suggestions, and --exact turns off partial matches.`,
+	"--verbose (or HOMEPODCTL_VERBOSE=1) prints backend diagnostics to stderr.",
+	"--log-level (default warn, or debug with --verbose) and --log-format text|json control diagnostics; HOMEPODCTL_LOG_FILE appends them to a file instead of stderr (HOMEPODCTL_LOG_LEVEL and HOMEPODCTL_LOG_FORMAT set the defaults). At debug level every AppleScript and Shortcut call is logged with its duration and result.",
+	"--quiet (-q) drops human-readable stdout output so cron and launchd jobs log only their errors (on stderr); --json output is still written, and rpc --stdio keeps its stdout.",
+	"--yes (-y) accepts every interactive prompt without reading stdin: play --choose takes the best match and config wizard keeps each default and writes the config, so scripts and agents never wait on input.",
+	"--verbose, --quiet, --yes, --dry-run, and --timeout also work after the command name; a flag missing from the command's usage is rejected, and <command> --help prints its help page.",
+	"--output <file> after a command with --json output writes that JSON to file instead of stdout (implying --json): it goes to a temporary file in the same directory and is renamed into place only when the command succeeds, so launchd jobs can drop snapshots (status --output ~/status.json) that readers never see half-written. Streams (--watch, --json-stream, watch) reject it.",
+	"--json-stream on status and devices/out list (and --json on watch) writes compact NDJSON, one object per line, so watch loops can be piped to jq -c or a log shipper; status --watch 2s --json-stream prints one status object per tick.",
+	"--timeout <duration> (default 30s; 15m for automation, scene, and run; 10m for self-update) bounds the whole command; defaults.timeouts.applescript and defaults.timeouts.shortcuts in config.json bound each Music.app script or Shortcut run.",
+	"--dry-run before the command previews any mutating command (transport, volume, outputs, aliases, config edits) without side effects; read-only commands run normally, and servers, interactive commands, and artwork/scrobble reject it.",
+	"transient Music.app failures (AppleEvent timeouts such as -1712 while a HomePod wakes up, busy connections) are retried twice with a backoff starting at 150ms, or 1s for AirPlay selection; --retries <n> or defaults.retries.count changes the count (0 disables), defaults.retries.backoff the first wait.",
+	"commands that drive Music.app launch it first (hidden) when it is not running; --no-launch (or HOMEPODCTL_NO_LAUNCH=1) skips that, and defaults.launch picks hidden|foreground|off. status --json reports connection.app as running, launched, or not-running.",
+	"device, playlist, and now-playing reads use JXA with JSON output and retry through AppleScript on failure; defaults.engine (or HOMEPODCTL_ENGINE) set to applescript skips JXA.",
+	"playlist lookups reuse ~/.cache/homepodctl/playlists.json ($XDG_CACHE_HOME/homepodctl) for up to an hour while Music.app reports the same playlist count, and devices, out list, and room completion reuse devices.json for 30 seconds; --no-cache (or HOMEPODCTL_NO_CACHE=1) bypasses both, devices and playlists take --refresh, and homepodctl cache refresh|clear rebuilds or deletes them.",
+	"--profile <name> (or HOMEPODCTL_PROFILE) uses a named config profile instead of the one chosen with config profile switch.",
+	"--config <path> (or HOMEPODCTL_CONFIG) uses that config file and ignores profiles; $XDG_CONFIG_HOME/homepodctl is used as the config dir when it exists.",
+	"--host <user@host|remote> (or HOMEPODCTL_HOST) runs the Music.app and Shortcuts calls on another Mac over ssh, so a laptop can drive the Mac mini the HomePods play from; remote is a name from config.json remotes (host, port, identity). ssh must log in without a prompt (keys or an agent), one connection is shared per command, and artwork and daemon only run locally.",
+	"exit codes: 2 usage/flag errors, 3 config errors, 4 backend command failures, 5 backend failures without a GUI session (e.g. over ssh; see homepodctl exec --gui-session).",
+	"with --json, --json-stream, or --output anywhere on the command line, every failure prints an error response ({ok, error: {code, message, exitCode}}) on stderr instead of an error: line.",
+}
+
+var commandDocs = []commandDoc{
+	{
+		Name:    "help",
+		Summary: "show usage for homepodctl or one command",
+		Usage: []string{
+			"homepodctl help [<command>] [--json]",
+		},
+		Notes: []string{
+			"--json prints the command metadata (usage, arguments, flags, notes, examples) that help and the man pages are rendered from, for wrapper UIs and agents.",
+		},
+		Examples: []string{
+			"homepodctl help play",
+			"homepodctl help --json | jq '.commands[].name'",
+		},
+	},
+	{
+		Name:    "version",
+		Summary: "print the version and commit",
+		Usage: []string{
+			"homepodctl version",
+		},
+	},
+	{
+		Name:    "capabilities",
+		Summary: "report what this machine and build can do",
+		Usage: []string{
+			"homepodctl capabilities [--json] [--plain]",
+		},
+		Notes: []string{
+			"Reports osascript and shortcuts, the Music.app version, whether the config loads, the engine, which backends can run, and the commands and features of this build.",
+			"The JSON carries schemaVersion; it only changes when a field is renamed or removed, so scripts can feature-detect instead of parsing help.",
+			"Never launches Music.app.",
+		},
+		Examples: []string{
+			"homepodctl capabilities",
+			"homepodctl capabilities --json | jq '.backends[] | select(.available) | .name'",
+		},
+	},
+	{
+		Name:    "config",
+		Summary: "inspect and update config values",
+		Usage: []string{
+			"homepodctl config validate [--json]",
+			"homepodctl config get <path> [--json]",
+			"homepodctl config set <path> <value...>",
+			"homepodctl config unset <path>",
+			"homepodctl config list [--json] [<prefix>]",
+			"homepodctl config wizard [--yes]",
+			"homepodctl config profile list [--json]",
+			"homepodctl config profile create <name> [--from <profile>]",
+			"homepodctl config profile switch <name>",
+			"homepodctl config export [--redact]",
+			"homepodctl config import <file|-> [--merge] [--dry-run] [--json]",
+		},
+		Synopsis: []string{
+			"homepodctl config <validate|get|set|unset|list|wizard|profile|export|import> [args]",
+		},
+		Notes: []string{
+			"unset deletes map entries (aliases.<name>, scenes.<name>, groups.<name>, devices.<name>, native mappings, a whole native.playlists.<room>) and clears scalar fields; <rooms path>.<room> removes one room from defaults.rooms, groups.<name>, or aliases.<name>.rooms.",
+			"list prints every populated path with its value (tab-separated, or JSON with --json), optionally limited to a prefix such as aliases.focus.",
+			"wizard asks for default rooms (from Music.app or Bonjour), a default volume, and aliases for your most-played playlists, then writes config.json after confirmation; --yes answers every question with its current value and writes without asking.",
+			`profiles are separate config files (profiles/<name>.json next to config.json, which is the "default" profile); switch makes one active, and --profile or HOMEPODCTL_PROFILE overrides it per command.`,
+			"export prints the full config as JSON; --redact replaces scrobble credentials and URLs, Apple Music tokens, remote hosts and identity files, and hook commands with REDACTED.",
+			"import adds entries from the file and replaces existing ones; --merge keeps existing entries and defaults and only adds new ones. Entries only in the current config are always kept, and REDACTED values are ignored (a redacted hook or remote is skipped).",
+			"validate also reports shortcuts referenced by the config that are not installed (requires the Shortcuts CLI).",
+			`hooks.pre<Command> and hooks.post<Command> run a shell command before or after a command that changes playback (e.g. hooks.postPlay "shortcuts run 'Dim Lights'"); a failing pre hook stops the command, a failing post hook only warns.`,
+		},
+		Sections: []docSection{
+			{Title: "Supported paths", Lines: []string{
+				"defaults.backend",
+				"defaults.engine",
+				"defaults.launch",
+				"defaults.shuffle",
+				"defaults.volume",
+				"defaults.maxVolume",
+				"defaults.rooms",
+				"defaults.timeouts.applescript|shortcuts|hooks",
+				"defaults.retries.count|backoff",
+				"groups.<name>",
+				"devices.<name> (friendly room name -> AirPlay device name)",
+				"volumeOffsets.<room>",
+				"maxVolumes.<room>",
+				"quietHours.<name> <start> <end> (e.g. quietHours.night 22:00 07:00)",
+				"quietHours.<name>.start|end|rooms|maxVolume|play",
+				"hooks.<pre|post><Command> (e.g. hooks.postPlay)",
+				"remotes.<name>.host|port|identity",
+				"scrobble.lastfm.apiKey|apiSecret|sessionKey",
+				"scrobble.listenbrainz.token|url",
+				"appleMusic.developerToken|userToken|storefront",
+				"aliases.<name>.backend",
+				"aliases.<name>.rooms",
+				"aliases.<name>.playlist",
+				"aliases.<name>.playlistId",
+				"aliases.<name>.station",
+				"aliases.<name>.shuffle",
+				"aliases.<name>.shuffleMode",
+				"aliases.<name>.eq",
+				"aliases.<name>.volume",
+				"aliases.<name>.shortcut",
+				"aliases.<name>.sequence",
+				"scenes.<name> (get/unset; edit steps in config.json)",
+				"native.playlists.<room>.<playlist>",
+				"native.playlists.<room>.<playlist>.input",
+				"native.volumeShortcuts.<room>.<0-100>",
+			}},
+		},
+	},
+	{
+		Name:    "automation",
+		Summary: "declarative playback routines (v1)",
+		Usage: []string{
+			"homepodctl automation init --preset <morning|focus|winddown|party|reset> [--name <string>] [--json]",
+			"homepodctl automation validate -f <file|-> [--json]",
+			"homepodctl automation plan -f <file|-> [--resolve static|live] [--json]",
+			"homepodctl automation run -f <file|-> [--dry-run [--resolve static|live]] [--json] [--no-input]",
+			"homepodctl automation history [--name <string>] [--limit N] [--json] [--plain]",
+			"homepodctl automation status [--json] [--plain]",
+			"homepodctl automation serve [--listen <host:port>] [--token <secret>] [--dir <dir>] [--dry-run]",
+			"homepodctl automation record --out <file|-> [--name <string>] [--json]",
+			"homepodctl automation record --stop|--cancel [--json]",
+		},
+		Synopsis: []string{
+			"homepodctl automation <run|validate|plan|init|history|status|serve|record> [args]",
+		},
+		Notes: []string{
+			"run executes steps sequentially and stops on first failed step.",
+			"automation run never prompts for input.",
+			"Use --dry-run to preview resolved actions without executing.",
+			"--resolve live (with plan or run --dry-run) turns the plan into a read-only preflight: it asks Music.app whether each play step's query or playlistId resolves, whether the rooms of play, out.set, and volume.set steps exist and are available, and which volume changes they would make (from -> to, after offsets and caps), listed under each step's preflight. Steps with issues, such as an unmatched playlist, an unknown or offline room, or quiet hours that block play, are marked failed and the command exits 1.",
+			"Use --json --no-input for agent-safe usage.",
+			"notify and webhook steps announce a run or hand off to other systems, and shortcut steps run any Shortcuts shortcut (lights, blinds); their text is a Go template over the status --format fields plus {{.Automation}}.",
+			"A parallel step runs its steps concurrently (concurrency, default 4) and reports each under branches; it fails when any branch fails, or only when all do with failOn: all.",
+			"Every real run (automation run and scene run, not --dry-run) is appended to automation-runs.jsonl in the state directory; history lists recent runs and status shows the last run of each routine.",
+			"serve listens on 127.0.0.1:8765 for POST /run/<routine> (add ?dryRun=true to plan) and GET /routines; a routine is a scene, else <dir>/<routine>.yaml|.yml|.json (dir defaults to routines/ next to config.json). Runs are serialized and answered with the automation run --json object (HTTP 500 when a step failed).",
+			"Callers always send Authorization: Bearer <token>: --token, else HOMEPODCTL_SERVE_TOKEN, else a random per-install token created on first start in the state directory (serve-token; the path is printed on start). Requests get 403 when their Host is a DNS name other than localhost or a .local name (only loopback when listening on loopback), or when they carry another site's Origin.",
+			"record --out starts recording: the play, volume, mute, out, shuffle, and transport commands you run next (from history) become the steps of a routine written by record --stop. Volumes are saved as the levels rooms ended at; other commands are skipped with a warning.",
+		},
+	},
+	{
+		Name:    "plan",
+		Summary: "preview resolved command execution",
+		Usage: []string{
+			"homepodctl plan <command> [args] [--json]",
+		},
+		Synopsis: []string{
+			"homepodctl plan <command> [args]",
+		},
+		Notes: []string{
+			"plan runs the target command in dry-run JSON mode inside the same process, so it works through symlinks and wrapper scripts.",
+			"Commands: play, radio, run, volume, vol, mixer, mute, unmute, duck, unduck, announce, move, handoff, native-run, undo, pause, stop, resume, next, prev, love, dislike, rate, shuffle, crossfade, eq set, out set|add|remove, audio route, media playpause|next|prev, alias add|remove|rename|copy, automation run|validate|plan, scene run, playlist create|add|remove-track, cache refresh|clear.",
+			"use --json for a machine-friendly envelope containing the planned action.",
+		},
+	},
+	{
+		Name:    "schema",
+		Summary: "inspect machine-readable JSON contracts",
+		Usage: []string{
+			"homepodctl schema [<name>] [--json]",
+			"homepodctl schema [<name>] --write-dir <dir> [--json] [--dry-run]",
+		},
+		Notes: []string{
+			"automation-file and config-file describe the files you write (routines and config.json); the other schemas describe command output.",
+			"--write-dir writes <name>.schema.json for each schema (or just <name>), creating the directory.",
+			`Point your editor at them, e.g. a "# yaml-language-server: $schema=<dir>/automation-file.schema.json" line at the top of a routine.`,
+		},
+		Examples: []string{
+			"homepodctl schema",
+			"homepodctl schema action-result --json",
+			"homepodctl schema --write-dir ~/.config/homepodctl/schemas",
+			"homepodctl schema automation-file --write-dir .vscode/schemas",
+		},
+	},
+	{
+		Name:    "completion",
+		Summary: "generate shell completion scripts",
+		Usage: []string{
+			"homepodctl completion <bash|zsh|fish>",
+			"homepodctl completion install <bash|zsh|fish> [--path <file-or-dir>]",
+		},
+		Notes: []string{
+			"The scripts ask homepodctl itself for suggestions each time you press TAB, so they never need regenerating: commands, subcommands, and flags; rooms from the config and, while Music.app is running, its AirPlay devices; aliases, profiles, config paths, and schema names; playlists from the config and the playlist cache (homepodctl cache refresh picks up new ones).",
+			"Completion never launches Music.app.",
+		},
+	},
+	{
+		Name:    "docs",
+		Summary: "generate reference documentation",
+		Usage: []string{
+			"homepodctl docs man --out <dir> [--json] [--dry-run]",
+		},
+		Notes: []string{
+			"man writes homepodctl.1 and one homepodctl-<command>.1 page per command, creating the directory; the pages are rendered from the same metadata as help and help --json.",
+			"Add the parent of <dir> to MANPATH (or write into an existing man1 directory) to read them with man.",
+		},
+		Examples: []string{
+			"homepodctl docs man --out ~/.local/share/man/man1",
+			"homepodctl docs man --out /tmp/man1 --dry-run --json",
+		},
+	},
+	{
+		Name:    "setup",
+		Summary: "onboard and verify local environment",
+		Usage: []string{
+			"homepodctl setup [--backend airplay|native] [--room <name> ...] [--json] [--no-input]",
+		},
+		Notes: []string{
+			"Ensures config exists (same as config-init behavior).",
+			"Runs doctor checks and lists current AirPlay devices.",
+			"Optionally updates defaults via --backend and --room.",
+		},
+	},
+	{
+		Name:    "doctor",
+		Summary: "run environment and config diagnostics",
+		Usage: []string{
+			"homepodctl doctor [--json] [--plain]",
+		},
+		Notes: []string{
+			"network-devices browses Bonjour for AirPlay receivers and warns about any that Music.app does not list.",
+			"automation tells a denied Automation permission (-1743) apart from other Music.app failures and prints the System Settings steps for your terminal app.",
+		},
+	},
+	{
+		Name:    "devices",
+		Summary: "list devices",
+		Usage: []string{
+			"homepodctl devices [--kind <kind>] [--json] [--plain] [--include-network] [--refresh] [--watch <duration>] [--json-stream]",
+		},
+		Notes: []string{
+			"KIND is what Music.app reports (HomePod, Apple TV, AirPort Express, ...); --kind homepod|tv|airport|computer|bluetooth|other lists only that kind, with third-party AirPlay speakers under other.",
+			"The list comes from ~/.cache/homepodctl/devices.json while it is under 30 seconds old; changing outputs or volumes drops it. --refresh asks Music.app regardless, and --watch always does.",
+			"--json entries carry cachedAt, when Music.app reported the device; --verbose prints the listing's age on stderr.",
+		},
+	},
+	{
+		Name:    "discover",
+		Summary: "find AirPlay receivers on the local network",
+		Usage: []string{
+			"homepodctl discover [--timeout <duration>] [--json] [--plain]",
+		},
+		Notes: []string{
+			"Browses Bonjour (_airplay._tcp and _raop._tcp) directly; Music.app does not need to be running.",
+			"Lists name, model, IP address, AirPlay firmware, and OS version when advertised.",
+			"COMPANION marks receivers that also advertise the Companion protocol (_companion-link._tcp).",
+			"--timeout sets how long to listen for answers (default 5s).",
+		},
+		Examples: []string{
+			"homepodctl discover",
+			"homepodctl discover --timeout 2s --json",
+		},
+	},
+	{
+		Name:    "homekit",
+		Summary: "inspect HomeKit accessories on the local network",
+		Usage: []string{
+			"homepodctl homekit accessories [--timeout <duration>] [--json] [--plain]",
+		},
+		Notes: []string{
+			"Browses Bonjour (_hap._tcp) for HomeKit accessories and shows their category, model, and whether they are paired.",
+			"Only the public advertisement is read. homepodctl does not pair as a HomeKit controller, so it cannot read accessory state or run scenes; run scenes through a Shortcut with backend=native.",
+			"--timeout sets how long to listen for answers (default 5s).",
+		},
+		Examples: []string{
+			"homepodctl homekit accessories",
+			"homepodctl homekit accessories --json",
+		},
+	},
+	{
+		Name:    "audio",
+		Summary: "send this Mac's system audio to a HomePod",
+		Usage: []string{
+			"homepodctl audio route <room> [--exact] [--json] [--plain] [--dry-run]",
+			"homepodctl audio route --reset [--json] [--plain] [--dry-run]",
+			"homepodctl audio status [--json] [--plain]",
+		},
+		Notes: []string{
+			"audio route switches the macOS sound output, which carries everything but Music.app's AirPlay (calls, browsers, video), to a room. The room is a device name, device alias, or single-room group matched like other rooms against the system outputs.",
+			"It needs SwitchAudioSource (brew install switchaudio-osx). HomePods are listed as system outputs only while macOS sees them on the network; audio status shows what is there.",
+			"The output before the first route is kept in audio-route.json in the state dir; --reset switches back to it.",
+			"audio does not support --host: it switches the sound output of the Mac running homepodctl.",
+		},
+		Examples: []string{
+			`homepodctl audio route "Living Room"`,
+			"homepodctl audio route --reset",
+		},
+	},
+	{
+		Name:    "shortcuts",
+		Summary: "list installed Shortcuts",
+		Usage: []string{
+			"homepodctl shortcuts list [--json]",
+		},
+		Notes: []string{
+			"Wraps the macOS shortcuts CLI; prints one shortcut name per line, or a JSON array with --json.",
+			"config validate and doctor check every shortcut referenced by aliases, native.playlists, and native.volumeShortcuts against this list.",
+		},
+		Examples: []string{
+			"homepodctl shortcuts list",
+			"homepodctl shortcuts list --json",
+		},
+	},
+	{
+		Name:    "out",
+		Summary: "list/set Music.app AirPlay outputs",
+		Usage: []string{
+			"homepodctl out list [--kind <kind>] [--json] [--plain] [--include-network] [--refresh] [--watch <duration>] [--json-stream] [--dry-run]",
+			"homepodctl out set [--room <name> ...] [<room> ...] [--only-kind <kind>] [--backend airplay] [--strict] [--exact] [--json] [--plain] [--dry-run]",
+			"homepodctl out add|remove [--room <name> ...] [<room> ...] [--strict] [--exact] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"Room names match the AirPlay device names shown by: homepodctl devices (a unique prefix is enough; --exact requires the full name)",
+			"out list --watch 2s redraws the table every interval and marks what changed (came online, got selected, volume); --json-stream prints one NDJSON event per change instead (device.added|removed|online|offline|selected|deselected|volume).",
+			"out set changes Music.app’s current outputs; it does not modify config.json.",
+			"out set --only-kind homepod drops rooms whose device is another kind (say, a TV in a group) with a warning, and fails if none are left.",
+			"Selecting an Apple TV (out set, out add, or play --room) prints a warning: it wakes the Apple TV and often the television it is connected to.",
+			"out add/remove read the current selection and only change the listed rooms, so playback continues.",
+			"Outputs are read back after selecting; rooms that did not join are selected again, then reported as a warning (an error with --strict, written instead of the result). JSON lists each room under outputs.",
+			"Prefer repeatable --room flags; positional rooms are kept for compatibility.",
+		},
+		Examples: []string{
+			"homepodctl out list",
+			"homepodctl out list --watch 2s",
+			"homepodctl out set downstairs --only-kind homepod",
+			`homepodctl devices --json-stream | jq -c 'select(.event == "device.offline")'`,
+			`homepodctl out set --room "Bedroom"`,
+			`homepodctl out set --room "Bedroom" --room "Living Room"`,
+			`homepodctl out add --room "Kitchen"`,
+			`homepodctl out remove --room "Bedroom"`,
+		},
+	},
+	{
+		Name:    "move",
+		Aliases: []string{"handoff"},
+		Summary: "hand playback off from one room to another",
+		Usage: []string{
+			"homepodctl move <from-room> <to-room> [--volume 0-100] [--no-restore] [--strict] [--exact] [--json] [--plain] [--dry-run]",
+			"homepodctl handoff <from-room> <to-room> [--volume 0-100] [--no-restore] [--strict] [--exact] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"Replaces <from-room> with <to-room> in Music.app’s current outputs; other selected outputs stay as they are.",
+			"<to-room> gets the volume <from-room> was playing at unless --volume is passed.",
+			"The playback position is restored after switching; pass --no-restore to skip that step.",
+		},
+		Examples: []string{
+			`homepodctl move "Living Room" "Bedroom"`,
+			"homepodctl handoff Kitchen downstairs --volume 30",
+		},
+	},
+	{
+		Name:    "playlists",
+		Summary: "list playlists",
+		Usage: []string{
+			"homepodctl playlists [--query <substr>] [--folder <name>] [--smart-only|--no-smart] [--sort name|count|recent] [--limit N] [--refresh] [--json] [--plain]",
+		},
+		Notes: []string{
+			"each playlist carries its track count, total time, parent folder, and modified: when a track was last added (Music.app keeps no modification date for playlists).",
+			"--sort name orders A-Z, count by most tracks, and recent by latest addition (reading every track's date added, so it is slower); without --sort playlists keep Music.app's order. Filters and sorting apply before --limit (default 50, 0 for all).",
+			"the list comes from the playlist cache (see homepodctl cache); --refresh rebuilds it first. --json entries carry cachedAt, when the list was read from Music.app, and --verbose prints its age on stderr.",
+		},
+		Examples: []string{
+			"homepodctl playlists --sort recent --limit 10",
+			`homepodctl playlists --folder "Workouts" --no-smart --json`,
+		},
+	},
+	{
+		Name:    "cache",
+		Summary: "manage the playlist and device caches",
+		Usage: []string{
+			"homepodctl cache refresh [--json] [--dry-run]",
+			"homepodctl cache clear [--json] [--dry-run]",
+		},
+		Notes: []string{
+			"play, playlists, run, and automation steps look playlists up through ~/.cache/homepodctl/playlists.json ($XDG_CACHE_HOME/homepodctl when set).",
+			"The cache is rebuilt after an hour or when Music.app's playlist count changes; renaming a playlist does not change the count, so run cache refresh afterwards.",
+			"devices, out list, and room completion read ~/.cache/homepodctl/devices.json while it is under 30 seconds old; any command that lists devices rewrites it, and changing outputs or volumes deletes it.",
+			"refresh and clear act on both files.",
+			"--no-cache before any command (or HOMEPODCTL_NO_CACHE=1) skips the cache for that run.",
+			"With --host, both caches live under hosts/<host>/ in the cache directory, one pair per Mac.",
+		},
+		Examples: []string{
+			"homepodctl cache refresh",
+			"homepodctl --no-cache playlists --query chill",
+		},
+	},
+	{
+		Name:    "search",
+		Summary: "search the local Music library",
+		Usage: []string{
+			"homepodctl search <query> [--type track|album|artist] [--limit N] [--json] [--plain]",
+		},
+		Notes: []string{
+			"--type defaults to track; album and artist results group the matching tracks and list their persistent IDs.",
+			"--limit defaults to 25 (0 = no limit).",
+			"Track persistent IDs work with: homepodctl playlist add <playlist> --track-id <id>",
+		},
+		Examples: []string{
+			`homepodctl search "so what"`,
+			`homepodctl search "kind of blue" --type album --json`,
+		},
+	},
+	{
+		Name:    "catalog",
+		Summary: "search the Apple Music catalog",
+		Usage: []string{
+			"homepodctl catalog search <query> [--limit N] [--json] [--plain]",
+		},
+		Notes: []string{
+			"Searches the whole Apple Music catalog through the Apple Music API, not just your library. Prefix the query with artist:, album:, song:, or playlist: to search one kind; otherwise all four are listed.",
+			"--limit is per kind (default 10, at most 25).",
+			"Needs a MusicKit developer token: config set appleMusic.developerToken <jwt>. appleMusic.storefront picks the country catalog (default us).",
+			"To play a result use play --catalog <query>.",
+		},
+		Examples: []string{
+			`homepodctl catalog search "artist:Khruangbin"`,
+			`homepodctl catalog search "album:Mordechai" --json`,
+		},
+	},
+	{
+		Name:    "playlist",
+		Summary: "create playlists and edit their tracks",
+		Usage: []string{
+			"homepodctl playlist create <name> [--json] [--plain] [--dry-run]",
+			"homepodctl playlist add <playlist> | --playlist-id <id> --track-id <id> [--track-id <id> ...] [--json] [--plain] [--dry-run]",
+			"homepodctl playlist remove-track <playlist> | --playlist-id <id> --track-id <id> [--track-id <id> ...] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"<playlist> must match one user playlist; ambiguous names fail instead of guessing (use --playlist-id).",
+			"--track-id takes a track persistent ID from your library.",
+			"remove-track removes every occurrence of the track from the playlist; the library is not touched.",
+		},
+		Examples: []string{
+			`homepodctl playlist create "Dinner tonight"`,
+			`homepodctl playlist add "Dinner tonight" --track-id 0123456789ABCDEF`,
+		},
+	},
+	{
+		Name:    "status",
+		Aliases: []string{"now"},
+		Summary: "show playback, route, and backend status",
+		Usage: []string{
+			"homepodctl status [--app music|spotify] [--json|--json-stream] [--plain] [--fields <list>] [--format <template>] [--watch <duration> [--notify]] [--dry-run]",
+			"homepodctl now [--app music|spotify] [--json] [--plain] [--fields <list>] [--format <template>] [--watch <duration> [--notify]] [--dry-run]",
+		},
+		Notes: []string{
+			"source reports what Music.app plays from: playlist, album, radio, library, cd, or none; audio another device AirPlays straight to a HomePod bypasses Music.app and is not visible here.",
+			"--app spotify reports Spotify.app: the source kind is spotify and the track's persistentId its spotify:track: URI. Spotify plays to the system sound output, so there are no outputs.",
+			"each output carries Music.app's kind and a normalized type: homepod, tv, mac, speaker, bluetooth, or unknown.",
+			"--fields player,track,source,volume,outputs,route,connection limits the default and --json/--json-stream output to those blocks (ok is always included); it does not apply to --plain.",
+			"--format <template> prints one line per poll from a Go template over .OK, .PlayerState, .Track (.Name .Artist .Album), .Source (.Kind .Name), .Volume, .Outputs (.DeviceName .Volume .Type ...), .Route, and .Connection; join, upper, lower, and trunc <n> are available.",
+		},
+		Examples: []string{
+			"homepodctl status --fields track,outputs",
+			"homepodctl now --json --fields track,source",
+			`homepodctl now --format '{{.Track.Artist}} — {{.Track.Name}} [{{.PlayerState}}]'`,
+			`homepodctl now --watch 5s --format '{{trunc 30 .Track.Name}} {{join .Route ","}}'`,
+		},
+	},
+	{
+		Name:    "tui",
+		Summary: "interactive terminal controller",
+		Usage: []string{
+			"homepodctl tui [--watch <duration>]",
+		},
+		Notes: []string{
+			"--watch sets the now-playing refresh interval (default 2s).",
+			"Requires an interactive terminal.",
+		},
+		Sections: []docSection{
+			{Title: "Keys", Lines: []string{
+				"space        play/pause",
+				"n / p / s    next / previous / stop",
+				"tab          switch between Outputs and Playlists",
+				"up/down, j/k move the cursor",
+				"enter        toggle the output under the cursor, or play the playlist under the cursor",
+				"+ / -        raise/lower the volume of the output under the cursor by 5",
+				"r            refresh playlists and devices",
+				"q            quit",
+			}},
+		},
+	},
+	{
+		Name:    "watch",
+		Summary: "print now-playing changes and run hooks",
+		Usage: []string{
+			"homepodctl watch [--on-track-change <cmd>] [--on-state-change <cmd>] [--interval <duration>] [--json]",
+		},
+		Notes: []string{
+			"Polls Music.app every --interval (default 2s) until interrupted; the first poll is the baseline.",
+			"Hooks run through sh -c with the event in the environment:\n  HOMEPODCTL_EVENT, HOMEPODCTL_STATE, HOMEPODCTL_PREVIOUS_STATE,\n  HOMEPODCTL_TRACK_NAME, HOMEPODCTL_TRACK_ARTIST, HOMEPODCTL_TRACK_ALBUM,\n  HOMEPODCTL_TRACK_ID, HOMEPODCTL_TRACK_DURATION, HOMEPODCTL_POSITION,\n  HOMEPODCTL_PLAYLIST, HOMEPODCTL_PLAYLIST_ID, HOMEPODCTL_OUTPUTS",
+			"Hook output goes to stderr; a failing hook is reported and watching continues.",
+			"--json prints one event object per line.",
+		},
+		Examples: []string{
+			`homepodctl watch --on-track-change 'echo "$HOMEPODCTL_TRACK_NAME" >> ~/played.txt'`,
+			"homepodctl watch --json --interval 5s",
+		},
+	},
+	{
+		Name:    "scrobble",
+		Summary: "submit listens to Last.fm and ListenBrainz",
+		Usage: []string{
+			"homepodctl scrobble daemon [--interval <duration>]",
+			"homepodctl scrobble flush [--json]",
+		},
+		Notes: []string{
+			"daemon polls now playing every --interval (default 5s) and scrobbles a track once it has\nplayed half its length (or 4 minutes); tracks of 30s or less are skipped.",
+			"Listens are queued in scrobble-queue.json in the state dir; anything that fails to send\n(offline, service errors) is retried by the daemon and by flush.",
+			"Configure services with config set:\n  scrobble.lastfm.apiKey, scrobble.lastfm.apiSecret, scrobble.lastfm.sessionKey\n  scrobble.listenbrainz.token, scrobble.listenbrainz.url (optional)",
+		},
+		Examples: []string{
+			"homepodctl config set scrobble.listenbrainz.token <token>",
+			"homepodctl scrobble daemon",
+			"homepodctl scrobble flush --json",
+		},
+	},
+	{
+		Name:    "rpc",
+		Summary: "JSON-RPC 2.0 server over stdio",
+		Usage: []string{
+			"homepodctl rpc --stdio",
+		},
+		Notes: []string{
+			"Reads one JSON-RPC request per line on stdin and writes one response per line on stdout.",
+			"Runs until stdin closes, so editor plugins, scripts, and agents can keep one process around.",
+			"Requests without an id are notifications and get no response.",
+			"Errors carry data.code and data.exitCode matching the CLI's --json errors.",
+		},
+		Sections: []docSection{
+			{Title: "Methods", Lines: []string{
+				"status                                   now playing (same shape as status --json)",
+				"play {playlist|playlistId, rooms?, backend?, volume?, shuffle?, force?, synchronized?}",
+				"volume {value, rooms?, backend?, force?} force goes above maxVolume",
+				"outputs {set?: [rooms]}                  optionally select outputs, then list devices",
+				"automation.run {file|automation, dryRun?}",
+			}},
+		},
+		Examples: []string{
+			`echo '{"jsonrpc":"2.0","id":1,"method":"status"}' | homepodctl rpc --stdio`,
+			`{"jsonrpc":"2.0","id":2,"method":"play","params":{"playlist":"Chill","rooms":["Kitchen"]}}`,
+		},
+	},
+	{
+		Name:    "streamdeck",
+		Summary: "localhost HTTP surface for Stream Deck plugins",
+		Usage: []string{
+			"homepodctl streamdeck serve [--addr <host:port>] [--token <secret>]",
+		},
+		Notes: []string{
+			"Listens on 127.0.0.1:8787 by default, and only ever on a loopback address.",
+			"Every request needs \"Authorization: Bearer <token>\": --token, else HOMEPODCTL_STREAMDECK_TOKEN, else a random per-install token created on first start in the state directory (streamdeck-token; the path is printed on start). Requests whose Host is not loopback or that carry another site's Origin get 403, so web pages cannot drive the endpoints through the browser.",
+			"Every endpoint returns the button state as JSON:\n  {ok, playerState, playing, title, track, artist, rooms: [{name, selected, volume}], error?}",
+			"Failed actions return ok=false with error.code/exitCode (400 for bad input, 502 for backend errors).",
+		},
+		Sections: []docSection{
+			{Title: "Endpoints", Lines: []string{
+				"GET  /state                          now playing and per-room state for dynamic buttons",
+				"POST /actions/playpause              toggle play/pause",
+				"POST /actions/volume/up|down         ?step=5 (default) and optional ?room=<name> (repeatable)",
+				"POST /actions/rooms/<room>/toggle    add or remove a room from the current outputs",
+				"POST /actions/alias/<name>           run a config alias",
+			}},
+		},
+		Examples: []string{
+			"homepodctl streamdeck serve",
+			`curl -X POST -H "Authorization: Bearer $(cat ~/.local/state/homepodctl/streamdeck-token)" 'http://127.0.0.1:8787/actions/volume/up?step=10'`,
+		},
+	},
+	{
+		Name:    "metrics",
+		Summary: "Prometheus exporter for playback and rooms",
+		Usage: []string{
+			"homepodctl metrics serve [--listen <host:port>] [--token <token>]",
+		},
+		Notes: []string{
+			"Listens on 127.0.0.1:9811 by default. To let a Prometheus server on another host scrape it, pass --listen :9811 with --token (or HOMEPODCTL_METRICS_TOKEN) and set the same bearer token in the scrape config; a non-loopback --listen without a token is refused.",
+			"With a token, /metrics answers only requests carrying \"Authorization: Bearer <token>\" and a Host naming this machine.",
+			"Every scrape of /metrics reads Music.app afresh. When Music.app does not answer, homepodctl_up is 0 and the player/device gauges are left out.",
+			"homepodctl_history_commands counts the mutating commands history.jsonl holds, from any homepodctl process. It is a gauge: it drops when history is trimmed or cleared.",
+		},
+		Sections: []docSection{
+			{Title: "Metrics", Lines: []string{
+				"homepodctl_up                                       1 when Music.app answered the scrape",
+				"homepodctl_player_state{state}                      1 for the current state (playing|paused|stopped)",
+				"homepodctl_track_position_seconds                   position in the current track",
+				"homepodctl_track_duration_seconds                   duration of the current track",
+				"homepodctl_device_volume_percent{room,kind}         AirPlay device volume",
+				"homepodctl_device_selected{room}                    1 when the device is a current output",
+				"homepodctl_device_available{room}                   1 when the device is reachable",
+				"homepodctl_selected_outputs                         number of selected outputs",
+				"homepodctl_history_commands{command,result}         commands in history (result=success|failure)",
+			}},
+		},
+		Examples: []string{
+			"homepodctl metrics serve",
+			"homepodctl metrics serve --listen :9811 --token \"$METRICS_TOKEN\"",
+			"curl -s http://127.0.0.1:9811/metrics",
+		},
+	},
+	{
+		Name:    "self-update",
+		Summary: "replace this binary with the latest GitHub release",
+		Usage: []string{
+			"homepodctl self-update [--channel stable|beta] [--check] [--force] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"Checks the GitHub releases of agisilaos/homepodctl; --channel beta includes prereleases.",
+			"The darwin archive for this Mac's architecture is checked against the SHA256SUMS file of the same release before anything is written. That is the only check: releases are not signed, so it catches a corrupt download but not a release replaced together with its SHA256SUMS.",
+			"The new binary is written next to the current one and renamed over it, so a failed update leaves the old binary in place. A binary in a root-owned directory needs sudo.",
+			"Homebrew installs are refused; use brew upgrade homepodctl. Development builds are only replaced with --force.",
+			"--check reports whether an update is available without installing it; --dry-run also shows the path that would be replaced.",
+		},
+		Examples: []string{
+			"homepodctl self-update --check",
+			"homepodctl self-update",
+			"homepodctl self-update --channel beta --json",
+		},
+	},
+	{
+		Name:    "daemon",
+		Summary: "keep a warm AppleScript session for low-latency commands",
+		Usage: []string{
+			"homepodctl daemon serve [--socket <path>] [--interval <duration>]",
+			"homepodctl daemon status [--socket <path>] [--json]",
+		},
+		Notes: []string{
+			"serve keeps one osascript (JXA) process running and executes every script in it, so commands skip the osascript startup and Apple event setup they otherwise pay per call.",
+			"The socket defaults to ~/.local/state/homepodctl/daemon.sock ($XDG_STATE_HOME/homepodctl) and is only accessible to your user.",
+			"Other commands use the daemon automatically while the socket exists, and fall back to osascript when it does not answer. HOMEPODCTL_NO_DAEMON=1 turns that off.",
+			"Opt-in: nothing starts the daemon for you; run it in a terminal or from a launchd agent.",
+			"serve also checks what is playing every --interval (default 30s, 0 turns it off) to keep the track log behind `homepodctl history tracks` filling. It skips the check while Music.app is not running, so the daemon never launches it.",
+			"serve also restores ducked rooms once the until in duck.json passes (checked every 5s), for a duck --for that was killed or an automation duck step with for.",
+		},
+		Examples: []string{
+			"homepodctl daemon serve",
+			"homepodctl daemon status --json",
+			"homepodctl status --watch 1s",
+		},
+	},
+	{
+		Name:    "aliases",
+		Summary: "list aliases",
+		Usage: []string{
+			"homepodctl aliases [--json] [--plain]",
+		},
+	},
+	{
+		Name:    "alias",
+		Summary: "add, remove, rename, or copy aliases",
+		Usage: []string{
+			"homepodctl alias add <name> --playlist <name> | --playlist-id <id> | --station <query> | --shortcut <name> [--backend airplay|native] [--room <name> ...] [--volume 0-100] [--shuffle] [--no-verify] [--json] [--dry-run]",
+			"homepodctl alias remove <name> [--json] [--dry-run]",
+			"homepodctl alias rename <from> <to> [--json] [--dry-run]",
+			"homepodctl alias copy <from> <to> [--json] [--dry-run]",
+		},
+		Notes: []string{
+			"add checks that the playlist (station, or shortcut) and rooms exist before writing config.json; --no-verify skips the check (for example when Music.app is not running).",
+			"Room names may be config groups. --backend defaults to airplay, or native with --shortcut.",
+			"add, rename, and copy refuse to overwrite an existing alias; use alias remove first.",
+			"To change one field of an existing alias, use config set aliases.<name>.<field>.",
+		},
+		Examples: []string{
+			`homepodctl alias add focus --playlist "Deep Focus" --room Bedroom --volume 30`,
+			`homepodctl alias add morning --station "Apple Music 1" --room Kitchen`,
+			"homepodctl alias rename focus deep-work",
+			"homepodctl alias copy deep-work deep-work-kitchen",
+			"homepodctl alias remove deep-work",
+		},
+	},
+	{
+		Name:    "run",
+		Summary: "execute a configured alias",
+		Usage: []string{
+			"homepodctl run <alias> [--force] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"Aliases come from config.json (see homepodctl aliases).",
+			"--dry-run resolves backend/rooms/targets without executing backend calls.",
+			"An alias with a sequence runs each entry in order: another alias (nested sequences expand in place) or an automation file (.yaml, .yml, .json). The run stops at the first failing step and reports every step; --timeout and Ctrl-C stop it the same way. Cycles are rejected.",
+			"Quiet hours apply as for play: --force plays through quiet hours set to play=block and lets the alias volume go above the cap.",
+		},
+		Examples: []string{
+			"homepodctl config set aliases.evening.sequence winddown lights-off ~/routines/night.yaml",
+			"homepodctl run evening --dry-run",
+		},
+	},
+	{
+		Name:    "scene",
+		Summary: "run a multi-step scene from config.json",
+		Usage: []string{
+			"homepodctl scene list [--json] [--plain]",
+			"homepodctl scene run <name> [--dry-run] [--json]",
+		},
+		Synopsis: []string{
+			"homepodctl scene <list|run> [args]",
+		},
+		Notes: []string{
+			"Scenes live under scenes in config.json: an optional description and ordered steps in the automation step format (out.set, play, volume.set, wait, shortcut, notify, ...).",
+			"A scene runs like an automation file named after it whose defaults come from config.json: steps run in order and stop at the first failure, and --dry-run prints the resolved plan.",
+			"config validate checks every scene's steps; config get/unset scenes.<name> show or delete one.",
+		},
+		Examples: []string{
+			`homepodctl scene run movie-night --dry-run`,
+			"homepodctl scene list --json",
+		},
+	},
+	{
+		Name:    "history",
+		Summary: "review executed commands",
+		Usage: []string{
+			"homepodctl history [--limit N] [--json] [--plain]",
+			"homepodctl history tracks [--limit N] [--room <name>] [--since <duration>] [--json] [--plain]",
+		},
+		Notes: []string{
+			"Mutating commands (play, volume, mute, out set/add/remove, move, run, transport, rate, playlist and alias edits, automation run, scene run, native-run) are appended to $XDG_STATE_HOME/homepodctl/history.jsonl (default ~/.local/state/homepodctl/history.jsonl) with their args, resolved result, exit code, and duration.",
+			"Dry runs and read-only commands are not recorded.",
+			"Once history.jsonl passes 2 MiB the oldest entries are dropped, keeping at most the last 1000.",
+			"--limit defaults to 20; 0 shows everything. Entries print oldest first.",
+			"tracks lists the tracks seen playing and the rooms they played in, from tracks.jsonl in the same directory (the last 1000). Commands that already read now playing (status, watch, play, volume, run, ...) log the current track, and so does `homepodctl daemon serve` every 30s. --room keeps tracks that played there; --since keeps those seen within the duration.",
+		},
+		Examples: []string{
+			"homepodctl history",
+			"homepodctl history --limit 5 --json",
+			"homepodctl history tracks --room Kitchen --since 2h",
+		},
+	},
+	{
+		Name:    "state",
+		Summary: "show or clear stored state",
+		Usage: []string{
+			"homepodctl state show [--json] [--plain]",
+			"homepodctl state clear [<name>...] [--json] [--dry-run]",
+		},
+		Notes: []string{
+			"State lives in $XDG_STATE_HOME/homepodctl (default ~/.local/state/homepodctl): history.jsonl, tracks.jsonl, automation-runs.jsonl, automation-recording.json, undo.json, duck.json, mute.json, audio-route.json, daemon.sock, and scrobble-queue.json (mute.json and scrobble-queue.json left next to config.json by older versions are moved there on first use). layout.json records the layout version; a newer one than this build supports is left untouched and writes fail.",
+			"show lists each file with its size and modification time, any files this version does not know, and the state kept elsewhere (the playlist and device caches).",
+			"clear without names removes every state directory file except daemon.sock, the serve tokens, and scrobble-queue.json; name files (including those, or playlists.json) to remove only those.",
+		},
+		Examples: []string{
+			"homepodctl state show",
+			"homepodctl state clear history.jsonl --dry-run",
+		},
+	},
+	{
+		Name:    "exec",
+		Summary: "run a command in the logged-in user's GUI session",
+		Usage: []string{
+			"homepodctl exec --gui-session [--user <name|uid>] [--json] [--dry-run] -- <command> [args]",
+		},
+		Notes: []string{
+			"Over ssh or from a launchd daemon, homepodctl runs outside the user's GUI (Aqua) session and Music.app or Shortcuts may not answer; such failures exit 5 (NO_GUI_SESSION) and doctor warns about the session.",
+			"exec --gui-session runs <command> in the GUI session through launchctl asuser, which needs root: run it with sudo and the command runs as the user who ran sudo (or --user). A homepodctl command name runs this homepodctl; anything else runs as given. In a GUI session the command just runs.",
+			"The command's output and exit status are passed through; --dry-run prints what would run (--json as an object). --timeout (default 30s) bounds the whole run.",
+		},
+		Examples: []string{
+			"sudo homepodctl exec --gui-session -- play chill",
+			"homepodctl exec --gui-session --dry-run -- status --json",
+		},
+	},
+	{
+		Name:    "undo",
+		Summary: "revert the last output, volume, or playlist change",
+		Usage: []string{
+			"homepodctl undo [--json] [--dry-run]",
+		},
+		Notes: []string{
+			"Before play, volume, mute, unmute, out set/add/remove, pause|stop|resume --room, move, and run, homepodctl snapshots Music.app's selected outputs, their volumes, the current playlist, and the player state; the snapshot is kept only if the command succeeds.",
+			"undo restores that snapshot (outputs, then volumes, then the playlist if it changed) and pauses if nothing was playing before.",
+			"undo records its own snapshot, so running it twice re-applies the change.",
+			"Only the most recent change is kept. Commands run with --backend native are not snapshotted.",
+			"The snapshot lives next to history.jsonl as undo.json.",
+		},
+		Examples: []string{
+			"homepodctl undo --dry-run",
+			"homepodctl undo",
+		},
+	},
+	{
+		Name:    "pause",
+		Summary: "pause playback",
+		Usage: []string{
+			"homepodctl pause [--app music|spotify] [--json] [--plain] [--dry-run]",
+			"homepodctl pause|stop --room <name> [--room <name> ...] [--strict] [--exact] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"With --room (airplay), pause and stop silence only those rooms by removing them from Music.app's current outputs; the other rooms keep playing. resume --room adds them back.",
+			"Silencing every selected room this way is refused; run pause without --room instead.",
+		},
+		Examples: []string{
+			"homepodctl pause --room Kitchen",
+			"homepodctl resume --room Kitchen",
+		},
+	},
+	{
+		Name:    "stop",
+		Summary: "stop playback",
+		Usage: []string{
+			"homepodctl stop [--json] [--plain] [--dry-run]",
+			"homepodctl pause|stop --room <name> [--room <name> ...] [--strict] [--exact] [--json] [--plain] [--dry-run]",
+		},
+	},
+	{
+		Name:    "resume",
+		Summary: "resume playback, or bring paused rooms back",
+		Usage: []string{
+			"homepodctl resume [--app music|spotify] [--json] [--plain] [--dry-run]",
+			"homepodctl resume --room <name> [--room <name> ...] [--strict] [--exact] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"Without --room, resume continues playback where it was paused.",
+			"With --room, it adds the rooms back to Music.app's current outputs (undoing pause --room) and reads the outputs back like out add.",
+		},
+	},
+	{
+		Name:    "media",
+		Summary: "play/pause or skip in whichever app is playing",
+		Usage: []string{
+			"homepodctl media playpause|next|prev [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"When the frontmost app is Music, TV, or Spotify, the command goes to it directly. Otherwise homepodctl posts the play/pause, next, or previous media key, which macOS hands to the app that last played audio (a browser tab, a video player).",
+			"playpause toggles, like the key: it resumes a paused app as readily as it pauses a playing one. To pause Music.app without toggling, use `homepodctl pause`.",
+			"Media keys need the Accessibility permission for the terminal (or app) running homepodctl. --dry-run and --json report the frontmost app and whether it got the command directly (via app) or as a key (via media-key).",
+			"media does not support --host: it acts on the frontmost app and media keys of the Mac running homepodctl.",
+		},
+		Examples: []string{
+			"homepodctl media playpause",
+			"homepodctl media next --dry-run --json",
+		},
+	},
+	{
+		Name:    "next",
+		Summary: "next track",
+		Usage: []string{
+			"homepodctl next [--app music|spotify] [--json] [--plain] [--dry-run]",
+		},
+	},
+	{
+		Name:    "prev",
+		Summary: "previous track",
+		Usage: []string{
+			"homepodctl prev [--app music|spotify] [--json] [--plain] [--dry-run]",
+		},
+	},
+	{
+		Name:    "love",
+		Summary: "love current track",
+		Usage: []string{
+			"homepodctl love [--json] [--plain] [--dry-run]",
+		},
+	},
+	{
+		Name:    "dislike",
+		Summary: "dislike current track",
+		Usage: []string{
+			"homepodctl dislike [--json] [--plain] [--dry-run]",
+		},
+	},
+	{
+		Name:    "rate",
+		Summary: "rate current track 0-5",
+		Usage: []string{
+			"homepodctl rate <0-5> [--json] [--plain] [--dry-run]",
+		},
+	},
+	{
+		Name:    "shuffle",
+		Summary: "turn shuffle on or off and pick what it shuffles",
+		Usage: []string{
+			"homepodctl shuffle on|off [--mode songs|albums|groupings] [--json] [--plain] [--dry-run]",
+			"homepodctl shuffle --mode songs|albums|groupings [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"--mode sets Music.app's shuffle mode: single songs, whole albums, or groupings. On its own it also turns shuffle on.",
+			"Aliases take shuffleMode next to shuffle, and automation shuffle.set steps take mode next to enabled.",
+		},
+		Examples: []string{
+			"homepodctl shuffle on",
+			"homepodctl shuffle --mode albums",
+		},
+	},
+	{
+		Name:    "eq",
+		Summary: "list and pick Music.app EQ presets",
+		Usage: []string{
+			"homepodctl eq list [--json] [--plain]",
+			"homepodctl eq set <preset> [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"set matches the preset name ignoring case and turns the equalizer on; the EQ applies to everything Music.app plays, AirPlay outputs included.",
+			"Aliases take eq, so an alias can switch presets as it starts playing.",
+		},
+		Examples: []string{
+			"homepodctl eq list",
+			`homepodctl eq set "Bass Booster"`,
+			"homepodctl config set aliases.party.eq \"Bass Booster\"",
+		},
+	},
+	{
+		Name:    "crossfade",
+		Summary: "set the crossfade between songs",
+		Usage: []string{
+			"homepodctl crossfade <seconds|off> --ui-scripting [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"Seconds are 1-12; off (or 0) turns crossfading off.",
+			"Music.app does not script crossfade, so homepodctl flips it in Music's Playback settings through System Events: the host app needs the Accessibility permission, Music.app comes to the front briefly, and only the English UI is matched. --ui-scripting opts in; both requirements are checked before Music.app is touched.",
+			"Because it takes over the screen, crossfade is not available in aliases or automation, and record skips it.",
+		},
+		Examples: []string{
+			"homepodctl crossfade 6 --ui-scripting",
+			"homepodctl crossfade off --ui-scripting",
+		},
+	},
+	{
+		Name:    "artwork",
+		Summary: "export or show the current track's artwork",
+		Usage: []string{
+			"homepodctl artwork [--out <file>] [--term] [--width <cols>] [--json]",
+		},
+		Notes: []string{
+			"Without --out the image goes to the temp directory as homepodctl-artwork.jpg/.png; the path is printed.",
+			"--term renders inline: iTerm2/WezTerm and kitty image protocols when detected, otherwise ANSI colour blocks.",
+			"--width sets the rendered width in terminal cells (default 32).",
+			"Exits with an error when the current track has no artwork.",
+		},
+		Examples: []string{
+			"homepodctl artwork --out cover.jpg",
+			"homepodctl artwork --term --width 24",
+		},
+	},
+	{
+		Name:    "lyrics",
+		Summary: "print the current track's lyrics",
+		Usage: []string{
+			"homepodctl lyrics [--watch <duration>] [--json]",
+		},
+		Notes: []string{
+			"Lyrics come from the track's lyrics field in Music.app; exits with an error when it is empty.",
+			"--watch polls at the given interval and prints the lyrics again whenever the track changes.",
+			"With --watch --json, one object per track is written as a JSON line.",
+		},
+		Examples: []string{
+			"homepodctl lyrics",
+			"homepodctl lyrics --watch 2s",
+		},
+	},
+	{
+		Name:    "play",
+		Summary: "play an Apple Music playlist",
+		Usage: []string{
+			"homepodctl play <playlist-query> [--backend airplay|native] [--room <name> ...] [--shuffle] [--track <name> | --track-index N | --resume] [--volume 0-100] [--choose] [--no-input] [--yes] [--pin <alias>] [--strict] [--exact] [--synchronized] [--force] [--json] [--plain] [--dry-run]",
+			"homepodctl play --playlist <name> | --playlist-id <id> [--backend airplay|native] [--room <name> ...] [--shuffle] [--track <name> | --track-index N | --resume] [--volume 0-100] [--choose] [--no-input] [--yes] [--pin <alias>] [--strict] [--exact] [--synchronized] [--force] [--json] [--plain] [--dry-run]",
+			"homepodctl play --catalog <query> [--room <name> ...] [--shuffle] [--track <name> | --track-index N] [--volume 0-100] [--pin <alias>] [--strict] [--exact] [--synchronized] [--force] [--json] [--plain] [--dry-run]",
+			"homepodctl play --app spotify <spotify-uri|open.spotify.com-link> [--volume 0-100] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"<playlist-query> is a fuzzy search against your Music.app user playlists.",
+			"If --room is omitted, homepodctl uses defaults.rooms from config.json; if that is empty it falls back to Music.app’s currently selected AirPlay outputs (airplay backend).",
+			"--choose opens a fuzzy picker on stderr when several playlists match: type to filter, arrows to move, enter to pick, esc to cancel. It needs interactive stdin and falls back to a numbered prompt when stderr is not a terminal; --yes picks the best match instead, and --no-input fails.",
+			"--track starts at the track whose name matches (exact first, then the first containing it), --track-index at the Nth track; the rest of the playlist plays after it.",
+			"--resume continues the playlist's most recently played track from its saved position when Music.app keeps one (bookmarkable tracks); otherwise that track finished, so it starts at the next one (the top after the last track, or if nothing was played yet). All three need the airplay backend.",
+			"--pin <alias> saves the playlist play picked (its persistent ID) in the alias once playback starts, so `homepodctl run <alias>` skips the search; a new alias also keeps --room, --volume, and --shuffle. With --dry-run it shows the pick without saving (airplay only).",
+			"--synchronized starts a multi-room play in every room at once: it selects the outputs, waits up to 10s for each room to report selected and available, starts the playlist paused so the devices buffer, then plays (airplay only). Rooms that never get ready fail the play.",
+			"Inside quiet hours (config quietHours) play warns on stderr and holds --volume at their maxVolume; without --volume, rooms already above it are lowered to it before playback starts. Quiet hours set to play=block refuse to start. --force plays anyway at the requested volume. --json and plan output list the active quiet hours under quietHours.",
+			"--catalog plays the best Apple Music catalog match for <query> (artist:, album:, song:, or playlist: narrow the search; see catalog search). Music.app cannot play catalog items through AppleScript, so play adds them to your library first: a catalog playlist as it is, an album, a song, or an artist's top 20 songs into one \"homepodctl Catalog\" playlist, emptied and refilled on every catalog play. It waits up to a minute for iCloud Music Library to sync them. Needs appleMusic.developerToken and appleMusic.userToken (airplay only); --dry-run shows the match without touching the library.",
+			"--app spotify plays a Spotify track, album, artist, playlist, show, or episode URI (open.spotify.com links work too) in Spotify.app, with --volume setting Spotify's own volume. Spotify plays to the system sound output rather than to rooms, so --room does not apply; send it to a HomePod with `homepodctl audio route <room>`. pause, resume, next, prev, volume, and status take --app spotify too (Spotify has no stop).",
+		},
+		Examples: []string{
+			"homepodctl play chill",
+			`homepodctl play "Songs I've been obsessed recently pt. 2"`,
+			"homepodctl play autumn --choose",
+			"homepodctl play autumn --choose --pin autumn",
+			`homepodctl play --room "Bedroom" --playlist-id <PERSISTENT_ID>`,
+			`homepodctl play "Dinner" --track "La Vie en Rose"`,
+			"homepodctl play audiobooks --resume",
+			`homepodctl play "Dinner" --room Kitchen --room "Living Room" --synchronized`,
+			`homepodctl play --catalog "artist:Khruangbin" --room Kitchen`,
+			"homepodctl play --app spotify https://open.spotify.com/playlist/37i9dQZF1DX4sWSpwq3LiO --volume 40",
+		},
+	},
+	{
+		Name:    "radio",
+		Summary: "play an Internet radio station",
+		Usage: []string{
+			"homepodctl radio <station-query> [--room <name> ...] [--volume 0-100] [--strict] [--exact] [--force] [--json] [--plain] [--dry-run]",
+			"homepodctl radio list [--json] [--plain]",
+		},
+		Notes: []string{
+			"Stations are the radio streams Music.app can script: URL tracks in your library (Apple Music radio stations added to it, or streams added with File > Open Stream URL) and the radio tuner's stations. radio list shows them; <station-query> picks the best name match.",
+			"Rooms, --volume, quiet hours, and output verification work as for play (airplay only).",
+			"Aliases take \"station\" in place of a playlist, and automation play steps take station in place of query or playlistId.",
+		},
+		Examples: []string{
+			"homepodctl radio list",
+			`homepodctl radio "Apple Music 1" --room Kitchen --volume 30`,
+		},
+	},
+	{
+		Name:    "volume",
+		Aliases: []string{"vol"},
+		Summary: "set output volume",
+		Usage: []string{
+			"homepodctl volume <0-100|+N|-N> [<room> ...] [--backend airplay|native] [--exact] [--force] [--no-input] [--yes] [--json] [--plain] [--dry-run]",
+			"homepodctl volume <room>=<level> ... [--backend airplay|native] [--exact] [--force] [--no-input] [--yes] [--json] [--plain] [--dry-run]",
+			"homepodctl volume <0-100|+N|-N> --sync [--force] [--no-input] [--yes] [--json] [--plain] [--dry-run]",
+			"homepodctl volume <0-100|+N|-N> --app spotify [--json] [--plain] [--dry-run]",
+			"homepodctl vol <0-100|+N|-N> [<room> ...] [--backend airplay|native] [--exact] [--force] [--no-input] [--yes] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"If no rooms are provided, homepodctl uses defaults.rooms; if empty it uses Music.app’s currently selected outputs (airplay).",
+			"+N/-N change each room relative to its current AirPlay volume (clamped to 0-100); native backend needs absolute values.",
+			"<room>=<level> sets rooms independently in one call; <level> may be absolute or relative (Kitchen=+5).",
+			`volumeOffsets in config.json shift each room’s level (e.g. Kitchen: -10 turns "volume 40" into 30 there; airplay).`,
+			"--sync works like Music.app’s volume slider: the master volume starts at the loudest selected output and every selected output keeps its share of it (airplay only; volumeOffsets are not applied).",
+			"defaults.maxVolume and maxVolumes.<room> cap each room. Above the cap volume asks first on a terminal, and otherwise (or with --no-input) holds the room at the cap; --force or --yes sets the level anyway. play --volume, aliases, and automations are held at the cap unless an automation step sets force: true.",
+			"Active quiet hours (config quietHours) lower the cap of their rooms to their maxVolume for as long as they last.",
+			"--app spotify sets Spotify.app's own volume instead of any room's; it takes no rooms, and +N/-N are relative to Spotify's current volume.",
+		},
+		Examples: []string{
+			"homepodctl volume 35",
+			`homepodctl volume 35 "Living Room"`,
+			"homepodctl volume +5",
+			"homepodctl volume -10 Kitchen",
+			"homepodctl volume Bedroom=30 Kitchen=45",
+			"homepodctl volume 60 --sync",
+		},
+	},
+	{
+		Name:    "mixer",
+		Summary: "show and set every room's volume at once",
+		Usage: []string{
+			"homepodctl mixer [<room>=<0-100|+N|-N|mute> ...] [--exact] [--force] [--no-input] [--yes] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"Without arguments mixer prints the volume of every selected AirPlay output.",
+			"<room>=<level> pairs are set together in one Music.app call; rooms need not be selected, and group names expand to each member room. Levels work as in volume (volumeOffsets, +N/-N, and the volume caps apply), and mute sets 0 and remembers the level for unmute.",
+			"--json lists each room with its volume before and after, and the rooms changed.",
+		},
+		Examples: []string{
+			"homepodctl mixer",
+			`homepodctl mixer Kitchen=40 "Living Room"=55 Bedroom=mute`,
+			"homepodctl mixer Kitchen=+5 --json",
+		},
+	},
+	{
+		Name:    "mute",
+		Aliases: []string{"unmute"},
+		Summary: "silence rooms and restore their previous volume",
+		Usage: []string{
+			"homepodctl mute [<room> ...] [--room <name> ...] [--exact] [--json] [--plain] [--dry-run]",
+			"homepodctl unmute [<room> ...] [--room <name> ...] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"mute remembers each room’s current AirPlay volume in mute.json in the state dir, then sets it to 0.",
+			"unmute restores the remembered volume; without rooms it restores every muted room.",
+			"If no rooms are provided to mute, homepodctl uses defaults.rooms, then Music.app’s currently selected outputs.",
+		},
+		Examples: []string{
+			"homepodctl mute Kitchen",
+			"homepodctl unmute",
+		},
+	},
+	{
+		Name:    "duck",
+		Aliases: []string{"unduck"},
+		Summary: "lower rooms for a while and restore their volume",
+		Usage: []string{
+			"homepodctl duck [<room> ...] [--room <name> ...] [--to <0-100>] [--for <duration>] [--exact] [--json] [--plain] [--dry-run]",
+			"homepodctl unduck [<room> ...] [--room <name> ...] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"duck lowers rooms (default: Music.app's currently selected outputs) to --to (default 15) and remembers each room's volume in duck.json in the state dir. Rooms already at or below --to are left alone.",
+			"unduck restores the remembered volumes; without rooms it restores every ducked room. Ducking a ducked room keeps the volume remembered first.",
+			"--for waits in the foreground for the duration and then unducks the rooms itself, unless an unduck or a later duck has taken over by then. Ctrl-C (or SIGTERM) ends the wait early and restores at once.",
+			"The end time is kept in duck.json as until; if the waiting process is killed, a running `homepodctl daemon serve` restores the rooms once it passes.",
+			"Automations can use the duck (optional value, default 15, and for) and unduck steps, e.g. from a doorbell or phone-call trigger. A duck step's for does not hold up the routine: the daemon restores the rooms, or run unduck.",
+		},
+		Examples: []string{
+			"homepodctl duck --to 10 --for 2m",
+			"homepodctl duck Kitchen Living",
+			"homepodctl unduck",
+		},
+	},
+	{
+		Name:    "announce",
+		Summary: "speak a message on rooms and resume what was playing",
+		Usage: []string{
+			"homepodctl announce <text> [--room <name> ...] [--voice <name>] [--volume <0-100>] [--exact] [--json] [--plain] [--dry-run]",
+		},
+		Notes: []string{
+			"announce turns the text into speech with say on the Mac running Music.app and plays it through Music.app on the rooms (default: defaults.rooms, then the currently selected outputs). Music.app can only play a file by adding it to the library, so the speech is a temporary track that is deleted, with its file, once the announcement ends.",
+			"Music.app has one player, so playback pauses for the announcement. Afterwards the outputs and volumes are restored and an interrupted playlist track restarts where it was; radio and other streams are not restarted.",
+			"--volume sets the rooms' level for the announcement only, held at maxVolume and quiet hours like volume. --voice picks a voice listed by `say -v '?'`.",
+		},
+		Examples: []string{
+			`homepodctl announce "Dinner is ready" --room Kitchen --room "Living Room"`,
+			`homepodctl announce "Leaving in five minutes" --voice Samantha --volume 45`,
+		},
+	},
+	{
+		Name:    "native-run",
+		Summary: "execute a Shortcut by name",
+		Usage: []string{
+			"homepodctl native-run --shortcut <name> [--input <text>] [--json] [--dry-run]",
+		},
+		Notes: []string{
+			`--input passes text to the Shortcut as its input; whatever text the Shortcut outputs is printed (or returned as "output" with --json).`,
+			"--dry-run validates arguments and prints the planned action only.",
+		},
+	},
+	{
+		Name:    "config-init",
+		Summary: "create a starter config file",
+		Usage: []string{
+			"homepodctl config-init",
+		},
+		Notes: []string{
+			"Writes config.json in the config dir (~/.config/homepodctl, or $XDG_CONFIG_HOME/homepodctl when it exists); --config and --profile pick another file.",
+			"If the file already exists, this command is a no-op.",
+			"Edit defaults.rooms to your AirPlay device names (homepodctl devices).",
+		},
+	},
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// launchMode resolves how Music.app is started before commands that need it:
+// --no-launch or HOMEPODCTL_NO_LAUNCH turn it off, otherwise defaults.launch
+// decides (hidden when unset or cfg is nil).
+func launchMode(cfg *native.Config, noLaunch bool) string {
+	if noLaunch || envTruthy(os.Getenv("HOMEPODCTL_NO_LAUNCH")) {
+		return "off"
+	}
+	if cfg != nil && cfg.Defaults.Launch != "" {
+		return cfg.Defaults.Launch
+	}
+	return "hidden"
+}
+
+// needsMusicApp reports whether cmd drives Music.app. Native shortcuts do
+// not, and neither does asking for help.
+func needsMusicApp(cmd string, args []string) bool {
+	switch cmd {
+	case "devices", "playlists", "playlist", "search", "status", "now", "tui", "watch", "scrobble",
+		"out", "move", "handoff", "undo", "next", "prev", "love", "dislike", "rate", "artwork", "lyrics",
+		"shuffle", "crossfade", "eq", "play", "radio", "volume", "vol", "mixer", "mute", "unmute", "duck", "unduck", "announce", "pause", "stop", "resume":
+	default:
+		return false
+	}
+	for _, a := range args {
+		if a == "-h" || a == "--help" {
+			return false
+		}
+	}
+	flags, _, err := parseArgs(args)
+	if err != nil {
+		return false
+	}
+	if app, err := parseApp(flags); err != nil || app != appMusic {
+		return false
+	}
+	backend := strings.TrimSpace(flags.string("backend"))
+	if backend == "" {
+		if cfg, err := loadConfigOptional(); err == nil {
+			backend = cfg.Defaults.Backend
+		}
+	}
+	return backend != "native"
+}
+
+// ensureMusicApp launches Music.app before a command that needs it. A failed
+// launch is only logged; the command then reports its own error.
+func ensureMusicApp(ctx context.Context, cmd string, args []string, mode string) {
+	if mode == "off" || isDryRunInvocation(args) || !needsMusicApp(cmd, args) {
+		return
+	}
+	music.SetLaunchHidden(mode != "foreground")
+	launchCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	launched, err := ensureMusicRunning(launchCtx)
+	if err != nil {
+		debugf("launch: %v", err)
+		return
+	}
+	if launched {
+		debugf("launch: started Music.app (%s)", mode)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// logger receives diagnostics and backend call records. It discards
+// everything until setupLogging runs.
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+type logOptions struct {
+	level  string
+	format string
+	file   string
+}
+
+// resolveLogOptions fills unset flags from HOMEPODCTL_LOG_LEVEL,
+// HOMEPODCTL_LOG_FORMAT, and HOMEPODCTL_LOG_FILE. --verbose implies debug.
+func resolveLogOptions(opts globalOptions) logOptions {
+	lo := logOptions{
+		level:  strings.TrimSpace(opts.logLevel),
+		format: strings.TrimSpace(opts.logFormat),
+		file:   strings.TrimSpace(os.Getenv("HOMEPODCTL_LOG_FILE")),
+	}
+	if lo.level == "" {
+		lo.level = strings.TrimSpace(os.Getenv("HOMEPODCTL_LOG_LEVEL"))
+	}
+	if lo.level == "" && verbose {
+		lo.level = "debug"
+	}
+	if lo.level == "" {
+		lo.level = "warn"
+	}
+	if lo.format == "" {
+		lo.format = strings.TrimSpace(os.Getenv("HOMEPODCTL_LOG_FORMAT"))
+	}
+	if lo.format == "" {
+		lo.format = "text"
+	}
+	return lo
+}
+
+// setupLogging installs the process logger and hands it to the backends. A
+// log file stays open until the process exits so the exit record still lands.
+func setupLogging(lo logOptions) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(lo.level)); err != nil {
+		return usageErrf("invalid --log-level %q (expected debug|info|warn|error)", lo.level)
+	}
+	var w io.Writer = os.Stderr
+	if lo.file != "" {
+		f, err := os.OpenFile(lo.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("open log file: %w", err)
+		}
+		w = f
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch lo.format {
+	case "text":
+		if lo.file == "" {
+			// stderr is read by people; timestamps are noise there.
+			handlerOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			}
+		}
+		h = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		h = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return usageErrf("invalid --log-format %q (expected text|json)", lo.format)
+	}
+	logger = slog.New(h)
+	music.SetLogger(logger)
+	native.SetLogger(logger)
+	return nil
+}
+
+func debugf(format string, args ...any) {
+	logger.Debug(fmt.Sprintf(format, args...))
+}
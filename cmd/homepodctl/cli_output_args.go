@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/agisilaos/homepodctl/internal/catalog"
 	"github.com/agisilaos/homepodctl/internal/music"
 )
 
@@ -16,32 +17,68 @@ func writeJSON(v any) {
 	_ = enc.Encode(v)
 }
 
+// writeJSONLine writes v as one compact line (NDJSON), for --json-stream
+// output that jq -c and log shippers can tail.
+func writeJSONLine(v any) {
+	_ = json.NewEncoder(os.Stdout).Encode(v)
+}
+
 type actionResult struct {
-	OK         bool              `json:"ok"`
-	Action     string            `json:"action"`
-	DryRun     bool              `json:"dryRun,omitempty"`
-	Backend    string            `json:"backend,omitempty"`
-	Rooms      []string          `json:"rooms,omitempty"`
-	Playlist   string            `json:"playlist,omitempty"`
-	PlaylistID string            `json:"playlistId,omitempty"`
-	Shortcut   string            `json:"shortcut,omitempty"`
-	NowPlaying *music.NowPlaying `json:"nowPlaying,omitempty"`
+	OK           bool                 `json:"ok"`
+	Action       string               `json:"action"`
+	DryRun       bool                 `json:"dryRun,omitempty"`
+	Backend      string               `json:"backend,omitempty"`
+	Rooms        []string             `json:"rooms,omitempty"`
+	QuietHours   []quietHoursNotice   `json:"quietHours,omitempty"`
+	Playlist     string               `json:"playlist,omitempty"`
+	PlaylistID   string               `json:"playlistId,omitempty"`
+	Catalog      *catalog.Item        `json:"catalog,omitempty"`
+	Station      string               `json:"station,omitempty"`
+	App          string               `json:"app,omitempty"`
+	URI          string               `json:"uri,omitempty"`
+	Volume       *int                 `json:"volume,omitempty"`
+	Shortcut     string               `json:"shortcut,omitempty"`
+	Output       string               `json:"output,omitempty"`
+	StartTrack   *music.PlaylistTrack `json:"startTrack,omitempty"`
+	Synchronized bool                 `json:"synchronized,omitempty"`
+	Outputs      []music.OutputStatus `json:"outputs,omitempty"`
+	NowPlaying   *music.NowPlaying    `json:"nowPlaying,omitempty"`
+	Pinned       string               `json:"pinned,omitempty"`
+	Hooks        []hookResult         `json:"hooks,omitempty"`
 }
 
 type actionOutput struct {
-	Backend    string
-	DryRun     bool
-	Rooms      []string
+	Backend string
+	DryRun  bool
+	Rooms   []string
+	// QuietHours are the quiet hours in effect for Rooms.
+	QuietHours []quietHoursNotice
 	Playlist   string
 	PlaylistID string
+	// Catalog is the Apple Music catalog item play --catalog picked.
+	Catalog    *catalog.Item
+	Station    string
 	Shortcut   string
-	NowPlaying *music.NowPlaying
+	StartTrack *music.PlaylistTrack
+	// Synchronized marks a play --synchronized start.
+	Synchronized bool
+	Outputs      []music.OutputStatus
+	NowPlaying   *music.NowPlaying
+	// Pinned is the alias play --pin stored the playlist in.
+	Pinned string
+	// App, URI, and Volume (the app's own volume) are set by play and
+	// volume --app spotify.
+	App    string
+	URI    string
+	Volume *int
 }
 
 type outputOptions struct {
 	JSON   bool
 	Plain  bool
 	DryRun bool
+	// Yes mirrors the global --yes.
+	Yes bool
 }
 
 func parseOutputFlags(flags parsedArgs) (bool, bool, error) {
@@ -65,29 +102,63 @@ func parseOutputOptions(flags parsedArgs) (outputOptions, error) {
 	if err != nil {
 		return outputOptions{}, err
 	}
+	yes, _, err := flags.boolStrict("yes")
+	if err != nil {
+		return outputOptions{}, err
+	}
 	return outputOptions{
 		JSON:   jsonOut,
 		Plain:  plainOut,
-		DryRun: dryRun,
+		DryRun: dryRun || dryRunAll,
+		Yes:    yes || assumeYes,
 	}, nil
 }
 
+// checkDryRunSupported rejects the global --dry-run for commands whose side
+// effects cannot be previewed (long-running servers, interactive flows, and
+// commands that write files or submit data).
+func checkDryRunSupported(cmd string, args []string) error {
+	switch cmd {
+	case "tui", "watch", "scrobble", "rpc", "streamdeck", "metrics", "daemon", "setup", "artwork":
+		return usageErrf("%s does not support --dry-run", cmd)
+	case "config":
+		if len(args) > 0 && (args[0] == "wizard" || args[0] == "profile") {
+			return usageErrf("config %s does not support --dry-run", args[0])
+		}
+	}
+	return nil
+}
+
 func writeActionOutput(action string, jsonOut bool, plainOut bool, out actionOutput) {
+	res := actionResult{
+		OK:           true,
+		Action:       action,
+		DryRun:       out.DryRun,
+		Backend:      out.Backend,
+		Rooms:        out.Rooms,
+		QuietHours:   out.QuietHours,
+		Playlist:     out.Playlist,
+		PlaylistID:   out.PlaylistID,
+		Catalog:      out.Catalog,
+		Station:      out.Station,
+		App:          out.App,
+		URI:          out.URI,
+		Volume:       out.Volume,
+		Shortcut:     out.Shortcut,
+		StartTrack:   out.StartTrack,
+		Synchronized: out.Synchronized,
+		Outputs:      out.Outputs,
+		NowPlaying:   out.NowPlaying,
+		Pinned:       out.Pinned,
+	}
+	recordResult(res)
+	res.Hooks = hookResults()
 	if jsonOut {
-		writeJSON(actionResult{
-			OK:         true,
-			Action:     action,
-			DryRun:     out.DryRun,
-			Backend:    out.Backend,
-			Rooms:      out.Rooms,
-			Playlist:   out.Playlist,
-			PlaylistID: out.PlaylistID,
-			Shortcut:   out.Shortcut,
-			NowPlaying: out.NowPlaying,
-		})
+		writeJSON(res)
 		return
 	}
 	if out.NowPlaying != nil {
+		noteTrack(*out.NowPlaying)
 		if quiet && !plainOut {
 			return
 		}
@@ -102,7 +173,7 @@ func writeActionOutput(action string, jsonOut bool, plainOut bool, out actionOut
 		if quiet {
 			return
 		}
-		fmt.Printf("dry-run action=%s backend=%s rooms=%s playlist=%q playlist_id=%q shortcut=%q\n",
+		line := fmt.Sprintf("dry-run action=%s backend=%s rooms=%s playlist=%q playlist_id=%q shortcut=%q",
 			action,
 			out.Backend,
 			strings.Join(out.Rooms, ","),
@@ -110,6 +181,22 @@ func writeActionOutput(action string, jsonOut bool, plainOut bool, out actionOut
 			out.PlaylistID,
 			out.Shortcut,
 		)
+		for _, q := range out.QuietHours {
+			line += fmt.Sprintf(" quiet_hours=%s(%s)", q.Name, q.Window)
+		}
+		if out.Station != "" {
+			line += fmt.Sprintf(" station=%q", out.Station)
+		}
+		if out.App == appSpotify {
+			line += fmt.Sprintf(" app=%s uri=%q", out.App, out.URI)
+			if out.Volume != nil {
+				line += fmt.Sprintf(" volume=%d", *out.Volume)
+			}
+		}
+		if out.Synchronized {
+			line += " synchronized=true"
+		}
+		fmt.Println(line)
 	}
 }
 
@@ -202,6 +289,17 @@ func (p parsedArgs) boolDefault(key string, def bool) bool {
 	return b
 }
 
+// isBoolWord reports whether s can be the value of a switch given as its own
+// argument ("--shuffle false").
+func isBoolWord(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "false", "1", "0", "yes", "no", "y", "n", "on", "off":
+		return true
+	default:
+		return false
+	}
+}
+
 func parseArgs(args []string) (parsedArgs, []string, error) {
 	out := parsedArgs{kv: map[string][]string{}}
 	var positionals []string
@@ -210,15 +308,6 @@ func parseArgs(args []string) (parsedArgs, []string, error) {
 		out.kv[k] = append(out.kv[k], v)
 	}
 
-	isBoolWord := func(s string) bool {
-		switch strings.ToLower(strings.TrimSpace(s)) {
-		case "true", "false", "1", "0", "yes", "no", "y", "n", "on", "off":
-			return true
-		default:
-			return false
-		}
-	}
-
 	for i := 0; i < len(args); i++ {
 		a := args[i]
 		if a == "--" {
@@ -233,61 +322,40 @@ func parseArgs(args []string) (parsedArgs, []string, error) {
 			positionals = append(positionals, a)
 			continue
 		}
-
-		if a == "-f" {
-			if i+1 >= len(args) {
-				return parsedArgs{}, nil, usageErrf("-f requires a value")
-			}
-			i++
-			push("f", args[i])
+		if _, err := strconv.Atoi(a); err == nil {
+			// negative numbers such as relative volumes (-10) are values, not flags.
+			positionals = append(positionals, a)
 			continue
 		}
 
-		if strings.HasPrefix(a, "--") {
-			key := strings.TrimPrefix(a, "--")
-			val := ""
-			if eq := strings.IndexByte(key, '='); eq >= 0 {
-				val = key[eq+1:]
-				key = key[:eq]
+		name, val, hasVal := strings.Cut(a, "=")
+		def, ok := lookupFlagDef(name)
+		if !ok {
+			if strings.HasPrefix(a, "--") {
+				return parsedArgs{}, nil, usageErrf("unknown flag: %s (tip: rooms use --room <name>; run `homepodctl help`)", a)
 			}
-
-			switch key {
-			case "backend", "playlist", "playlist-id", "volume", "value", "room", "query", "limit", "shortcut", "file", "preset", "name", "path", "watch":
-				if key == "room" {
-					if val == "" {
-						if i+1 >= len(args) {
-							return parsedArgs{}, nil, usageErrf("--room requires a value")
-						}
-						i++
-						val = args[i]
-					}
-					push("room", val)
-					continue
-				}
-				if val == "" {
-					if i+1 >= len(args) {
-						return parsedArgs{}, nil, usageErrf("--%s requires a value", key)
-					}
-					i++
-					val = args[i]
-				}
-				push(key, val)
-			case "shuffle", "choose", "json", "plain", "dry-run", "no-input", "include-network":
-				if val == "" && i+1 < len(args) && isBoolWord(args[i+1]) {
-					i++
-					val = args[i]
-				}
-				if val == "" {
-					val = "true"
+			return parsedArgs{}, nil, usageErrf("unknown flag: %s (tip: run `homepodctl help`)", a)
+		}
+		key := strings.TrimLeft(name, "-")
+		if def.takesValue() {
+			if !hasVal {
+				if i+1 >= len(args) {
+					return parsedArgs{}, nil, usageErrf("%s requires a value", name)
 				}
-				push(key, val)
-			default:
-				return parsedArgs{}, nil, usageErrf("unknown flag: %s (tip: rooms use --room <name>; run `homepodctl help`)", a)
+				i++
+				val = args[i]
 			}
+			push(key, val)
 			continue
 		}
-
-		return parsedArgs{}, nil, usageErrf("unknown flag: %s (tip: run `homepodctl help`)", a)
+		if !hasVal && i+1 < len(args) && isBoolWord(args[i+1]) {
+			i++
+			val = args[i]
+		}
+		if val == "" {
+			val = "true"
+		}
+		push(key, val)
 	}
 	return out, positionals, nil
 }
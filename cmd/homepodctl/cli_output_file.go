@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputFile is where --output sends a command's JSON. Stdout goes to a
+// temporary file beside path, renamed over it only once the command
+// succeeds, so a reader never sees a partial or failed snapshot.
+type outputFile struct {
+	path   string
+	tmp    *os.File
+	stdout *os.File
+}
+
+// activeOutputFile is the --output of the running command, if any.
+var activeOutputFile *outputFile
+
+// checkOutputFileSupported rejects --output for commands without --json
+// output and for streams, which never finish a single payload.
+func checkOutputFileSupported(cmd string, args []string) error {
+	hasJSON := false
+	for _, f := range usageFlags(commandUsage(cmd)) {
+		if f.Name == "--json" {
+			hasJSON = true
+		}
+	}
+	if !hasJSON {
+		return usageErrf("%s has no --json output to write with --output", cmd)
+	}
+	if cmd == "watch" {
+		return usageErrf("watch streams events and does not support --output")
+	}
+	for _, a := range args {
+		if a == "--" {
+			break
+		}
+		name, _, _ := strings.Cut(a, "=")
+		if name == "--watch" || name == "--json-stream" {
+			return usageErrf("--output writes one JSON payload; it cannot be combined with %s", name)
+		}
+	}
+	return nil
+}
+
+// beginOutputFile points stdout at a temporary file next to path.
+func beginOutputFile(path string) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return usageErrf("--output needs a file path")
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return usageErrf("--output %s is a directory", path)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("--output: %w", err)
+	}
+	activeOutputFile = &outputFile{path: path, tmp: tmp, stdout: os.Stdout}
+	os.Stdout = tmp
+	return nil
+}
+
+// commitOutputFile restores stdout and renames the payload into place.
+func commitOutputFile() error {
+	f := activeOutputFile
+	if f == nil {
+		return nil
+	}
+	activeOutputFile = nil
+	os.Stdout = f.stdout
+	if err := f.tmp.Chmod(0o644); err != nil {
+		_ = f.tmp.Close()
+		_ = os.Remove(f.tmp.Name())
+		return fmt.Errorf("--output: %w", err)
+	}
+	if err := f.tmp.Close(); err != nil {
+		_ = os.Remove(f.tmp.Name())
+		return fmt.Errorf("--output: %w", err)
+	}
+	if err := os.Rename(f.tmp.Name(), f.path); err != nil {
+		_ = os.Remove(f.tmp.Name())
+		return fmt.Errorf("--output: %w", err)
+	}
+	return nil
+}
+
+// abortOutputFile restores stdout and drops the payload of a failed command,
+// leaving any earlier file at path untouched.
+func abortOutputFile() {
+	f := activeOutputFile
+	if f == nil {
+		return
+	}
+	activeOutputFile = nil
+	os.Stdout = f.stdout
+	_ = f.tmp.Close()
+	_ = os.Remove(f.tmp.Name())
+}
+
+// withJSONFlag adds --json to a command's flags for --output, ahead of any
+// -- separator.
+func withJSONFlag(args []string) []string {
+	out := make([]string, 0, len(args)+1)
+	for i, a := range args {
+		if a == "--" {
+			out = append(out, "--json")
+			return append(out, args[i:]...)
+		}
+		out = append(out, a)
+	}
+	return append(out, "--json")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+// pickerWindow is how many rows the inline picker shows at once.
+const pickerWindow = 10
+
+var (
+	errPickerCancelled = errors.New("selection cancelled")
+	errRawMode         = errors.New("terminal does not support raw input")
+)
+
+type pickerItem struct {
+	label string
+	badge string
+}
+
+// pickerModel is the state of the inline fuzzy picker: the typed query, the
+// items it matches (best first) and the highlighted row.
+type pickerModel struct {
+	items   []pickerItem
+	query   string
+	visible []int
+	cursor  int
+}
+
+func newPickerModel(items []pickerItem) *pickerModel {
+	m := &pickerModel{items: items}
+	m.filter()
+	return m
+}
+
+// filter ranks the items against the query with playlist search scoring. An
+// empty query keeps every item in its original order.
+func (m *pickerModel) filter() {
+	type hit struct{ index, score int }
+	hits := make([]hit, 0, len(m.items))
+	for i, it := range m.items {
+		if m.query == "" {
+			hits = append(hits, hit{index: i})
+			continue
+		}
+		if score := music.MatchScore(m.query, it.label); score > 0 {
+			hits = append(hits, hit{index: i, score: score})
+		}
+	}
+	sort.SliceStable(hits, func(a, b int) bool { return hits[a].score > hits[b].score })
+	m.visible = m.visible[:0]
+	for _, h := range hits {
+		m.visible = append(m.visible, h.index)
+	}
+	m.cursor = 0
+}
+
+// handleKey applies one decoded key. It reports done once the user picks a
+// row (the item index) or cancels (-1).
+func (m *pickerModel) handleKey(key string) (done bool, picked int) {
+	switch key {
+	case "enter":
+		if len(m.visible) == 0 {
+			return false, -1
+		}
+		return true, m.visible[m.cursor]
+	case "esc", "ctrl+c":
+		return true, -1
+	case "up":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "tab":
+		if m.cursor < len(m.visible)-1 {
+			m.cursor++
+		}
+	case "backspace":
+		if r := []rune(m.query); len(r) > 0 {
+			m.query = string(r[:len(r)-1])
+			m.filter()
+		}
+	case "space":
+		m.query += " "
+		m.filter()
+	default:
+		if r, size := utf8.DecodeRuneInString(key); size == len(key) && r != utf8.RuneError && unicode.IsPrint(r) {
+			m.query += key
+			m.filter()
+		}
+	}
+	return false, -1
+}
+
+// render returns the picker's lines: the query, a window of rows around the
+// cursor, and a match count.
+func (m *pickerModel) render(prompt string) []string {
+	lines := []string{fmt.Sprintf("%s> %s", prompt, m.query)}
+	start := m.cursor - pickerWindow/2
+	if start > len(m.visible)-pickerWindow {
+		start = len(m.visible) - pickerWindow
+	}
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(m.visible) && i < start+pickerWindow; i++ {
+		it := m.items[m.visible[i]]
+		line := tuiCursor(i == m.cursor) + " " + it.label
+		if it.badge != "" {
+			line += "  " + it.badge
+		}
+		lines = append(lines, line)
+	}
+	return append(lines, fmt.Sprintf("  %d/%d (type to filter, arrows to move, enter to pick, esc to cancel)", len(m.visible), len(m.items)))
+}
+
+// runPicker draws the picker inline on out and reads raw keys from in until
+// the user picks or cancels. The caller puts the terminal in raw mode. The
+// picker is erased before returning.
+func runPicker(in io.Reader, out io.Writer, prompt string, items []pickerItem) (int, error) {
+	m := newPickerModel(items)
+	drawn := 0
+	erase := func() {
+		if drawn > 0 {
+			fmt.Fprintf(out, "\x1b[%dA", drawn)
+		}
+		fmt.Fprint(out, "\r\x1b[J")
+	}
+	buf := make([]byte, 64)
+	for {
+		erase()
+		lines := m.render(prompt)
+		fmt.Fprint(out, strings.Join(lines, "\r\n"))
+		drawn = len(lines) - 1
+		n, err := in.Read(buf)
+		if err != nil {
+			erase()
+			return -1, fmt.Errorf("read selection: %w", err)
+		}
+		for _, key := range decodeKeys(buf[:n]) {
+			if done, picked := m.handleKey(key); done {
+				erase()
+				if picked < 0 {
+					return -1, errPickerCancelled
+				}
+				return picked, nil
+			}
+		}
+	}
+}
+
+func playlistBadge(p music.UserPlaylist) string {
+	switch {
+	case p.Smart:
+		return "[smart]"
+	case p.Genius:
+		return "[genius]"
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/spotify"
+	"github.com/agisilaos/homepodctl/internal/state"
+	"github.com/agisilaos/homepodctl/internal/transport"
+)
+
+// remoteHost is the ssh destination --host sends Music.app and Shortcuts
+// calls to; empty while they run on this Mac.
+var remoteHost string
+
+// remoteUnsupported lists the commands that cannot run with --host and why.
+var remoteUnsupported = map[string]string{
+	"artwork": "it exports the artwork file on the Mac running Music.app",
+	"daemon":  "the daemon keeps osascript running on this Mac",
+	"audio":   "it switches the sound output of this Mac",
+	"media":   "it acts on the frontmost app and media keys of this Mac",
+}
+
+// applyTransport points the backends at --host (or HOMEPODCTL_HOST): a name
+// from the remotes of cfg (which may be nil) or an ssh destination such as
+// me@mac-mini.
+func applyTransport(cfg *native.Config, cmd, host string) error {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		host = strings.TrimSpace(os.Getenv("HOMEPODCTL_HOST"))
+	}
+	if host == "" {
+		return nil
+	}
+	if why, ok := remoteUnsupported[cmd]; ok {
+		return usageErrf("%s does not support --host (%s)", cmd, why)
+	}
+	ssh, err := resolveRemote(cfg, host)
+	if err != nil {
+		return err
+	}
+	ssh.ControlPath = sshControlPath()
+	music.SetTransport(ssh)
+	native.SetTransport(ssh)
+	spotify.SetTransport(ssh)
+	remoteHost = ssh.Host
+	debugf("transport=%s", ssh)
+	return nil
+}
+
+// resolveRemote looks host up in the remotes of cfg, falling back to using it
+// as the ssh destination itself.
+func resolveRemote(cfg *native.Config, host string) (transport.SSH, error) {
+	if cfg != nil {
+		if r, ok := cfg.Remotes[host]; ok {
+			if err := transport.ValidHost(r.Host); err != nil {
+				return transport.SSH{}, &native.ConfigError{Op: "remote", Err: fmt.Errorf("remotes.%s.host: %w", host, err)}
+			}
+			return transport.SSH{Host: r.Host, Port: r.Port, Identity: expandHomePath(r.Identity)}, nil
+		}
+	}
+	if err := transport.ValidHost(host); err != nil {
+		return transport.SSH{}, usageErrf("invalid --host: %v", err)
+	}
+	return transport.SSH{Host: host}, nil
+}
+
+// sshControlPath is where ssh keeps the shared connection of a command, in
+// the ssh directory of the state dir; empty (no sharing) when that cannot be
+// created.
+func sshControlPath() string {
+	dir, err := state.Path("ssh")
+	if err != nil {
+		return ""
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		debugf("ssh: %v", err)
+		return ""
+	}
+	// %C is ssh's hash of the connection (host, port, user).
+	return dir + string(os.PathSeparator) + "%C"
+}
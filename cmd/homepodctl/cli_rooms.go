@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+// resolveRooms maps room arguments onto AirPlay device names with
+// music.ResolveRoom, keeping their order and count. When the device list
+// cannot be read the rooms pass through unchanged and the command reports its
+// own error later.
+func resolveRooms(ctx context.Context, rooms []string, exact bool) ([]string, error) {
+	if len(rooms) == 0 {
+		return rooms, nil
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil || len(devs) == 0 {
+		debugf("rooms: not resolving %v: devices=%d err=%v", rooms, len(devs), err)
+		return rooms, nil
+	}
+	return resolveRoomNames(rooms, devs, exact)
+}
+
+func resolveRoomNames(rooms []string, devs []music.AirPlayDevice, exact bool) ([]string, error) {
+	out := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		name, err := music.ResolveRoom(room, devs, exact)
+		if err != nil {
+			return nil, err
+		}
+		if name != room {
+			debugf("rooms: %q -> %q", room, name)
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+// resolveOutputRooms is resolveRooms for rooms about to become the AirPlay
+// outputs. With onlyKind set (see music.DeviceKinds), rooms whose device is
+// of another kind are dropped with a warning, and it is an error when none
+// are left or the kinds cannot be read. Apple TVs that remain get a warning:
+// selecting one wakes it, and often the television it is connected to.
+func resolveOutputRooms(ctx context.Context, rooms []string, exact bool, onlyKind string) ([]string, error) {
+	if len(rooms) == 0 {
+		return rooms, nil
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil || len(devs) == 0 {
+		if onlyKind != "" {
+			if err == nil {
+				err = fmt.Errorf("Music.app lists no AirPlay devices")
+			}
+			return nil, fmt.Errorf("--only-kind %s: %w", onlyKind, err)
+		}
+		debugf("rooms: not resolving %v: devices=%d err=%v", rooms, len(devs), err)
+		return rooms, nil
+	}
+	names, err := resolveRoomNames(rooms, devs, exact)
+	if err != nil {
+		return nil, err
+	}
+	kinds := map[string]string{}
+	for _, d := range devs {
+		kinds[d.Name] = music.DeviceKind(d.Kind)
+	}
+	var out, skipped []string
+	for _, name := range names {
+		if onlyKind != "" && kinds[name] != onlyKind {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", name, kinds[name]))
+			continue
+		}
+		out = append(out, name)
+	}
+	if len(skipped) > 0 {
+		if len(out) == 0 {
+			return nil, usageErrf("--only-kind %s leaves no rooms: %s", onlyKind, strings.Join(skipped, ", "))
+		}
+		fmt.Fprintf(os.Stderr, "warning: skipped %s (--only-kind %s)\n", strings.Join(skipped, ", "), onlyKind)
+	}
+	for _, name := range out {
+		if kinds[name] == "tv" {
+			fmt.Fprintf(os.Stderr, "warning: %s is an Apple TV; selecting it can turn on the TV it is connected to (out set --only-kind homepod leaves it out)\n", name)
+		}
+	}
+	return out, nil
+}
+
+// parseDeviceKind reads a --kind or --only-kind value.
+func parseDeviceKind(flags parsedArgs, name string) (string, error) {
+	kind := strings.ToLower(strings.TrimSpace(flags.string(name)))
+	if kind == "" {
+		return "", nil
+	}
+	for _, k := range music.DeviceKinds {
+		if k == kind {
+			return kind, nil
+		}
+	}
+	return "", usageErrf("invalid --%s %q (expected %s)", name, kind, strings.Join(music.DeviceKinds, "|"))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// serveAuth guards the local HTTP servers (streamdeck serve, automation
+// serve, metrics serve with a token). Every request needs the bearer token, a Host that names this
+// machine, and no Origin other than that host: together they stop other
+// local users, web pages posting cross-site (CSRF), and DNS rebinding.
+type serveAuth struct {
+	token string
+	// loopbackOnly limits Host to localhost and loopback addresses. Servers
+	// listening on the network also accept IP literals and .local names.
+	loopbackOnly bool
+}
+
+var errServeForbidden = errors.New("forbidden")
+
+// loadServeToken returns the token a server requires: the --token flag, then
+// the env variable, then a random per-install token kept in the state
+// directory under file (created on first use). path is that file when the
+// token came from it.
+func loadServeToken(flagValue, env, file string) (token, path string, err error) {
+	if token = strings.TrimSpace(flagValue); token != "" {
+		return token, "", nil
+	}
+	if token = strings.TrimSpace(os.Getenv(env)); token != "" {
+		return token, "", nil
+	}
+	if path, err = state.Path(file); err != nil {
+		return "", "", err
+	}
+	b, err := os.ReadFile(path)
+	if err == nil && strings.TrimSpace(string(b)) != "" {
+		return strings.TrimSpace(string(b)), path, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(buf)
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", "", err
+	}
+	return token, path, nil
+}
+
+// check returns why r may not reach the server, or nil.
+func (a serveAuth) check(r *http.Request) error {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if !a.allowedHost(host) {
+		return fmt.Errorf("%w: host %q is not this machine", errServeForbidden, r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return fmt.Errorf("%w: cross-origin request from %q", errServeForbidden, origin)
+		}
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(a.token)) != 1 {
+		return usageErrf("missing or invalid bearer token")
+	}
+	return nil
+}
+
+// allowedHost rejects DNS names an attacker could point at this machine.
+func (a serveAuth) allowedHost(host string) bool {
+	if isLoopbackHost(host) {
+		return true
+	}
+	if a.loopbackOnly {
+		return false
+	}
+	return net.ParseIP(host) != nil || strings.HasSuffix(strings.ToLower(host), ".local")
+}
+
+// status is the HTTP status for an error from check.
+func (a serveAuth) status(err error) int {
+	if errors.Is(err, errServeForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// guiSession is the launchd session of a desktop login; ssh logins and
+// launchd daemons run in Background or System sessions instead.
+const guiSession = "Aqua"
+
+func launchctlManagerName(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "launchctl", "managername").Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// headlessError is a Music.app or Shortcuts failure in a process outside the
+// user's GUI session, where Apple events often cannot reach the apps.
+type headlessError struct {
+	session string
+	err     error
+}
+
+func (e *headlessError) Error() string {
+	return fmt.Sprintf("no GUI session (launchd session %s): %v", e.session, e.err)
+}
+
+func (e *headlessError) Unwrap() error { return e.err }
+
+// headlessSession returns the launchd session name when this process is not
+// in a GUI session. It reports false when the session cannot be told.
+func headlessSession() (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	name, err := guiSessionManager(ctx)
+	if err != nil || name == "" || name == guiSession {
+		return "", false
+	}
+	return name, true
+}
+
+// explainHeadless marks a backend failure as a headlessError when the
+// process has no GUI session, the likely cause over ssh. Failures on a
+// --host Mac are left alone: its session cannot be checked from here.
+func explainHeadless(err error) error {
+	if err == nil || remoteHost != "" {
+		return err
+	}
+	var he *headlessError
+	var scriptErr *music.ScriptError
+	var shortcutErr *native.ShortcutError
+	if errors.As(err, &he) || !errors.As(err, &scriptErr) && !errors.As(err, &shortcutErr) {
+		return err
+	}
+	session, headless := headlessSession()
+	if !headless {
+		return err
+	}
+	return &headlessError{session: session, err: err}
+}
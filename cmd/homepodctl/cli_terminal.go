@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var runStty = func(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// enterRawMode switches the controlling terminal to raw, no-echo input and
+// returns a function that restores the previous settings.
+func enterRawMode() (func(), error) {
+	state, err := runStty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runStty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { _, _ = runStty(state) }, nil
+}
+
+// decodeKeys splits raw terminal input into key names. Printable characters,
+// including multi-byte UTF-8 ones, are returned as-is; control and escape
+// sequences map to names like "up" or "enter".
+func decodeKeys(b []byte) []string {
+	var keys []string
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == 0x1b && i+2 < len(b) && b[i+1] == '[':
+			switch b[i+2] {
+			case 'A':
+				keys = append(keys, "up")
+			case 'B':
+				keys = append(keys, "down")
+			case 'C':
+				keys = append(keys, "right")
+			case 'D':
+				keys = append(keys, "left")
+			}
+			i += 2
+		case c == 0x1b:
+			keys = append(keys, "esc")
+		case c == 0x03:
+			keys = append(keys, "ctrl+c")
+		case c == '\r' || c == '\n':
+			keys = append(keys, "enter")
+		case c == '\t':
+			keys = append(keys, "tab")
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, "backspace")
+		case c == ' ':
+			keys = append(keys, "space")
+		case c >= 0x20 && c < 0x7f:
+			keys = append(keys, string(c))
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(b[i:])
+			if r != utf8.RuneError && unicode.IsPrint(r) {
+				keys = append(keys, string(r))
+			}
+			i += size - 1
+		}
+	}
+	return keys
+}
+
+// detectImageProtocol picks an inline image protocol for the current terminal:
+// "iterm" (iTerm2, WezTerm), "kitty", or "ansi" half-block colour cells.
+func detectImageProtocol(getenv func(string) string) string {
+	switch {
+	case getenv("KITTY_WINDOW_ID") != "" || getenv("TERM") == "xterm-kitty":
+		return "kitty"
+	case getenv("TERM_PROGRAM") == "iTerm.app" || getenv("TERM_PROGRAM") == "WezTerm" || getenv("LC_TERMINAL") == "iTerm2":
+		return "iterm"
+	default:
+		return "ansi"
+	}
+}
+
+// renderImageInline draws an encoded JPEG/PNG image cols cells wide.
+func renderImageInline(w io.Writer, data []byte, protocol string, cols int) error {
+	enc := base64.StdEncoding.EncodeToString(data)
+	switch protocol {
+	case "iterm":
+		_, err := fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;width=%d;preserveAspectRatio=1:%s\a\n", len(data), cols, enc)
+		return err
+	case "kitty":
+		// kitty wants the payload in chunks of at most 4096 bytes; m=1 marks more to come.
+		for i := 0; i < len(enc); i += 4096 {
+			chunk := enc[i:min(i+4096, len(enc))]
+			more := 0
+			if i+4096 < len(enc) {
+				more = 1
+			}
+			ctrl := fmt.Sprintf("m=%d", more)
+			if i == 0 {
+				ctrl = fmt.Sprintf("a=T,f=100,c=%d,m=%d", cols, more)
+			}
+			if _, err := fmt.Fprintf(w, "\x1b_G%s;%s\x1b\\", ctrl, chunk); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintln(w)
+		return err
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		return renderANSIBlocks(w, img, cols)
+	}
+}
+
+// renderANSIBlocks draws img with "▀" cells: the foreground colour is the top
+// pixel and the background the bottom one, so each row covers two pixels.
+func renderANSIBlocks(w io.Writer, img image.Image, cols int) error {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 || cols <= 0 {
+		return nil
+	}
+	height := max(2, cols*b.Dy()/b.Dx())
+	sample := func(x, y int) (uint32, uint32, uint32) {
+		r, g, bl, _ := img.At(b.Min.X+x*b.Dx()/cols, b.Min.Y+y*b.Dy()/height).RGBA()
+		return r >> 8, g >> 8, bl >> 8
+	}
+	var sb strings.Builder
+	for y := 0; y+1 < height; y += 2 {
+		for x := 0; x < cols; x++ {
+			tr, tg, tb := sample(x, y)
+			br, bg, bb := sample(x, y+1)
+			fmt.Fprintf(&sb, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", tr, tg, tb, br, bg, bb)
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
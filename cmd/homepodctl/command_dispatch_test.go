@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
 
@@ -70,6 +77,220 @@ func TestCmdConfigDispatch_SetAndGet(t *testing.T) {
 	}
 }
 
+func TestCmdConfigDispatch_ExportAndImport(t *testing.T) {
+	origLoad := loadConfigOptional
+	origPath := configPath
+	t.Cleanup(func() {
+		loadConfigOptional = origLoad
+		configPath = origPath
+	})
+
+	cfg := &native.Config{
+		Aliases:  map[string]native.Alias{"focus": {Playlist: "Focus"}},
+		Scrobble: &native.ScrobbleConfig{ListenBrainz: native.ListenBrainzConfig{Token: "secret-token"}},
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	loadConfigOptional = func() (*native.Config, error) { return cfg, nil }
+	configPath = func() (string, error) { return path, nil }
+
+	out, recovered := captureStdoutAndRecover(t, func() {
+		cmdConfig([]string{"export", "--redact"})
+	})
+	if recovered != nil {
+		t.Fatalf("unexpected panic from export: %v", recovered)
+	}
+	if strings.Contains(out, "secret-token") || !strings.Contains(out, native.RedactedValue) {
+		t.Fatalf("export output not redacted: %s", out)
+	}
+
+	importPath := filepath.Join(dir, "import.json")
+	if err := os.WriteFile(importPath, []byte(`{"aliases":{"focus":{"playlist":"Other"},"party":{"playlist":"Party"}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, recovered = captureStdoutAndRecover(t, func() {
+		cmdConfig([]string{"import", importPath, "--merge"})
+	})
+	if recovered != nil {
+		t.Fatalf("unexpected panic from import: %v", recovered)
+	}
+	if !strings.Contains(out, "1 added, 0 replaced, 1 skipped") || !strings.Contains(out, "skipped aliases.focus") {
+		t.Fatalf("import output=%q", out)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), `"party"`) || !strings.Contains(string(b), `"playlist": "Focus"`) {
+		t.Fatalf("written config err=%v body=%s", err, b)
+	}
+}
+
+func TestCmdAliasDispatch(t *testing.T) {
+	origLoad := loadConfigOptional
+	origPath := configPath
+	origFind := findPlaylistIDByName
+	origDevices := listAirPlayDevices
+	t.Cleanup(func() {
+		loadConfigOptional = origLoad
+		configPath = origPath
+		findPlaylistIDByName = origFind
+		listAirPlayDevices = origDevices
+	})
+
+	cfg := &native.Config{Groups: map[string][]string{"downstairs": {"Kitchen"}}}
+	path := filepath.Join(t.TempDir(), "config.json")
+	loadConfigOptional = func() (*native.Config, error) { return cfg, nil }
+	configPath = func() (string, error) { return path, nil }
+	findPlaylistIDByName = func(_ context.Context, name string) (string, error) {
+		if name != "Deep Focus" {
+			return "", errors.New("no playlist matches")
+		}
+		return "P1", nil
+	}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Bedroom"}}, nil
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdAlias(context.Background(), []string{"add", "focus", "--playlist", "Deep Focus", "--room", "Bedroom", "--room", "Office"})
+	})
+	if recovered == nil {
+		t.Fatalf("expected unknown room to fail verification")
+	}
+	if _, ok := cfg.Aliases["focus"]; ok {
+		t.Fatalf("alias added despite failed verification")
+	}
+
+	_, recovered = captureStdoutAndRecover(t, func() {
+		cmdAlias(context.Background(), []string{"add", "focus", "--playlist", "Deep Focus", "--room", "bedroom", "--room", "downstairs", "--volume", "30"})
+	})
+	if recovered != nil {
+		t.Fatalf("unexpected panic from add: %v", recovered)
+	}
+	a := cfg.Aliases["focus"]
+	if a.Backend != "airplay" || a.Playlist != "Deep Focus" || len(a.Rooms) != 2 || a.Volume == nil || *a.Volume != 30 {
+		t.Fatalf("added alias=%+v", a)
+	}
+
+	_, recovered = captureStdoutAndRecover(t, func() {
+		cmdAlias(context.Background(), []string{"add", "later", "--playlist", "Unknown", "--no-verify"})
+	})
+	if recovered != nil {
+		t.Fatalf("unexpected panic from add --no-verify: %v", recovered)
+	}
+
+	for _, args := range [][]string{
+		{"rename", "focus", "deep-work"},
+		{"copy", "deep-work", "kitchen"},
+		{"remove", "later"},
+	} {
+		if _, recovered := captureStdoutAndRecover(t, func() { cmdAlias(context.Background(), args) }); recovered != nil {
+			t.Fatalf("unexpected panic from %v: %v", args, recovered)
+		}
+	}
+	if _, recovered := captureStdoutAndRecover(t, func() {
+		cmdAlias(context.Background(), []string{"copy", "kitchen", "deep-work"})
+	}); recovered == nil {
+		t.Fatalf("expected copy onto an existing alias to fail")
+	}
+	var names []string
+	for name := range cfg.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "deep-work,kitchen" {
+		t.Fatalf("aliases=%v", names)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), `"kitchen"`) || strings.Contains(string(b), `"focus"`) {
+		t.Fatalf("written config err=%v body=%s", err, b)
+	}
+}
+
+func TestCmdRunSequence(t *testing.T) {
+	origOutputs := setCurrentOutputs
+	origPlay := playPlaylistByID
+	origNow := getNowPlaying
+	t.Cleanup(func() {
+		setCurrentOutputs = origOutputs
+		playPlaylistByID = origPlay
+		getNowPlaying = origNow
+	})
+
+	var outputs []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		outputs = append(outputs, strings.Join(rooms, "+"))
+		if rooms[0] == "Garage" {
+			return errors.New("device not found")
+		}
+		return nil
+	}
+	playPlaylistByID = func(context.Context, string) error { return nil }
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) { return music.NowPlaying{}, errors.New("not playing") }
+
+	routine := filepath.Join(t.TempDir(), "night.yaml")
+	if err := os.WriteFile(routine, []byte("version: \"1\"\nname: night\nsteps:\n  - type: out.set\n    rooms: [Kitchen]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &native.Config{Aliases: map[string]native.Alias{
+		"winddown": {Backend: "airplay", Rooms: []string{"Bedroom"}, PlaylistID: "P1"},
+		"night":    {Sequence: []string{"winddown", routine}},
+		"evening":  {Sequence: []string{"night", "garage"}},
+		"garage":   {Backend: "airplay", Rooms: []string{"Garage"}, PlaylistID: "P2"},
+	}}
+	if issues := validateConfigValues(cfg); len(issues) != 0 {
+		t.Fatalf("validateConfigValues=%v", issues)
+	}
+
+	out, recovered := captureStdoutAndRecover(t, func() {
+		cmdRun(context.Background(), cfg, []string{"evening", "--dry-run", "--json"})
+	})
+	if recovered != nil {
+		t.Fatalf("unexpected panic from dry-run: %v", recovered)
+	}
+	var res aliasSequenceResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+	if !res.OK || len(res.Steps) != 3 || res.Steps[1].Kind != "automation" || res.Steps[1].Parent != "night" || res.Steps[2].Step != "garage" {
+		t.Fatalf("dry-run result=%+v", res)
+	}
+	if len(outputs) != 0 {
+		t.Fatalf("dry-run changed outputs: %v", outputs)
+	}
+
+	out, recovered = captureStdoutAndRecover(t, func() {
+		cmdRun(context.Background(), cfg, []string{"evening"})
+	})
+	if exit, ok := recovered.(cliExit); !ok || exit.code != exitGeneric {
+		t.Fatalf("recovered=%v, want exit %d", recovered, exitGeneric)
+	}
+	if strings.Join(outputs, ",") != "Bedroom,Kitchen,Garage" {
+		t.Fatalf("outputs=%v", outputs)
+	}
+	if !strings.Contains(out, "3/3 alias garage ok=false error=device not found") {
+		t.Fatalf("run output=%q", out)
+	}
+
+	// A cancelled run (Ctrl-C, --timeout) stops before the next step and
+	// still reports every step.
+	outputs = nil
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	out, recovered = captureStdoutAndRecover(t, func() {
+		cmdRun(cancelled, cfg, []string{"evening"})
+	})
+	if exit, ok := recovered.(cliExit); !ok || exit.code != exitGeneric {
+		t.Fatalf("recovered=%v, want exit %d", recovered, exitGeneric)
+	}
+	if len(outputs) != 0 || !strings.Contains(out, "1/3 alias winddown ok=false error=context canceled") || !strings.Contains(out, "3/3 alias garage ok=false error=skipped") {
+		t.Fatalf("cancelled run outputs=%v out=%q", outputs, out)
+	}
+
+	cfg.Aliases["garage"] = native.Alias{Sequence: []string{"evening"}}
+	if issues := strings.Join(validateConfigValues(cfg), "; "); !strings.Contains(issues, "aliases.evening.sequence has a cycle: evening → garage → evening") {
+		t.Fatalf("cycle issues=%q", issues)
+	}
+}
+
 func TestCmdAutomationDispatch_Direct(t *testing.T) {
 	cfg := &native.Config{}
 
@@ -191,3 +412,433 @@ func captureStderr(t *testing.T, fn func()) string {
 	}
 	return string(buf)
 }
+
+func TestHistoryRecordsMutatingCommands(t *testing.T) {
+	origPath := historyPath
+	t.Cleanup(func() {
+		historyPath = origPath
+		historyRun = nil
+	})
+	path := filepath.Join(t.TempDir(), "state", "history.jsonl")
+	historyPath = func() (string, error) { return path, nil }
+
+	beginHistory("status", nil)
+	finishHistory(0, nil)
+	beginHistory("next", []string{"--dry-run"})
+	finishHistory(0, nil)
+	beginHistory("alias", []string{"list"})
+	finishHistory(0, nil)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("read-only and dry-run commands should not be recorded (stat err=%v)", err)
+	}
+
+	beginHistory("volume", []string{"30", "--room", "Kitchen"})
+	writeActionOutput("volume", false, false, actionOutput{Backend: "airplay", Rooms: []string{"Kitchen"}})
+	finishHistory(0, nil)
+	beginHistory("out", []string{"set", "Office"})
+	finishHistory(exitGeneric, errors.New("room not found"))
+
+	out := captureStdout(t, func() { cmdHistory([]string{"--json", "--limit", "1"}) })
+	var entries []historyEntry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if len(entries) != 1 || entries[0].Command != "out" || entries[0].OK || entries[0].ExitCode != exitGeneric || entries[0].Error == "" {
+		t.Fatalf("entries=%+v", entries)
+	}
+
+	out = captureStdout(t, func() { cmdHistory(nil) })
+	if !strings.Contains(out, "volume 30 --room Kitchen") || !strings.Contains(out, "exit 1: room not found") {
+		t.Fatalf("table=%q", out)
+	}
+	all, err := readHistory(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res actionResult
+	if err := json.Unmarshal(all[0].Result, &res); err != nil || res.Action != "volume" || res.Rooms[0] != "Kitchen" {
+		t.Fatalf("result=%s err=%v", all[0].Result, err)
+	}
+}
+
+func TestHistoryTrimsOldEntries(t *testing.T) {
+	origPath := historyPath
+	t.Cleanup(func() { historyPath = origPath })
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	historyPath = func() (string, error) { return path, nil }
+
+	var buf bytes.Buffer
+	for i := 0; i < 1500; i++ {
+		b, _ := json.Marshal(historyEntry{Command: "next", Error: strings.Repeat("x", 1500)})
+		buf.Write(append(b, '\n'))
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendHistory(historyEntry{Command: "volume", Args: []string{"30"}}); err != nil {
+		t.Fatalf("appendHistory: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() > maxHistorySize/2 {
+		t.Fatalf("size=%d err=%v, want <= %d", fi.Size(), err, maxHistorySize/2)
+	}
+	entries, err := readHistory(0)
+	if err != nil || len(entries) == 0 || len(entries) > maxHistoryEntries {
+		t.Fatalf("entries=%d err=%v", len(entries), err)
+	}
+	if last := entries[len(entries)-1]; last.Command != "volume" {
+		t.Fatalf("newest entry=%+v, want the appended volume", last)
+	}
+}
+
+func TestIsDryRunInvocation(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"--dry-run"}, true},
+		{[]string{"30", "--dry-run=true"}, true},
+		{[]string{"set", "Office", "--dry-run", "true"}, true},
+		{[]string{"--dry-run", "false"}, false},
+		{[]string{"--dry-run=false"}, false},
+		{[]string{"30"}, false},
+	} {
+		if got := isDryRunInvocation(tc.args); got != tc.want {
+			t.Fatalf("isDryRunInvocation(%q)=%v want %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestHistoryTracks(t *testing.T) {
+	origPath, origNow, origEnabled := trackLogPath, timeNow, trackLogEnabled
+	t.Cleanup(func() { trackLogPath, timeNow, trackLogEnabled = origPath, origNow, origEnabled })
+	path := filepath.Join(t.TempDir(), "state", "tracks.jsonl")
+	trackLogPath = func() (string, error) { return path, nil }
+	trackLogEnabled = true
+	start := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) { timeNow = func() time.Time { return start.Add(d) } }
+	np := func(name string, rooms ...string) music.NowPlaying {
+		n := music.NowPlaying{PlayerState: "playing", Track: music.NowPlayingTrack{Name: name, Artist: "Nils Frahm", DurationS: 240}}
+		for _, r := range rooms {
+			n.Outputs = append(n.Outputs, music.AirPlayDevice{Name: r})
+		}
+		return n
+	}
+
+	at(0)
+	noteTrack(np("Says", "Kitchen"))
+	at(time.Minute)
+	noteTrack(np("Says", "Kitchen"))
+	noteTrack(music.NowPlaying{PlayerState: "paused", Track: music.NowPlayingTrack{Name: "Hammers"}})
+	at(5 * time.Minute)
+	noteTrack(np("Says", "Kitchen"))
+	at(2 * time.Hour)
+	noteTrack(np("Hammers", "Bedroom"))
+
+	entries, err := readTrackLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries=%+v, want the repeat after the track ended logged and duplicates skipped", entries)
+	}
+	at(2*time.Hour + time.Minute)
+	out := captureStdout(t, func() { cmdHistory([]string{"tracks", "--room", "kitchen", "--since", "3h", "--limit", "1", "--json"}) })
+	var got []trackLogEntry
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if len(got) != 1 || got[0].Name != "Says" || got[0].Time != "2026-05-01T18:05:00Z" {
+		t.Fatalf("got=%+v", got)
+	}
+	out = captureStdout(t, func() { cmdHistory([]string{"tracks", "--since", "30m", "--plain"}) })
+	if strings.Contains(out, "Says") || !strings.Contains(out, "Hammers") || !strings.Contains(out, "Bedroom") {
+		t.Fatalf("table=%q", out)
+	}
+
+	// Another process logging a track is seen, not overwritten by the
+	// remembered tail.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"time":"2026-05-01T20:02:00Z","name":"Says","artist":"Nils Frahm","rooms":["Kitchen"]}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	at(2*time.Hour + 3*time.Minute)
+	noteTrack(np("Says", "Kitchen"))
+	if entries, err = readTrackLog(); err != nil || len(entries) != 4 {
+		t.Fatalf("entries=%+v err=%v, want the other process's entry kept and the repeat skipped", entries, err)
+	}
+}
+
+func TestLogDaemonTracksSkipsWhenMusicClosed(t *testing.T) {
+	origRunning, origNow := musicAppRunning, getNowPlaying
+	t.Cleanup(func() { musicAppRunning, getNowPlaying = origRunning, origNow })
+	running, polls := false, 0
+	musicAppRunning = func(context.Context) (bool, error) { return running, nil }
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		polls++
+		return music.NowPlaying{PlayerState: "stopped"}, nil
+	}
+	if err := logDaemonTracks(context.Background(), 0); err != nil || polls != 0 {
+		t.Fatalf("closed: polls=%d err=%v", polls, err)
+	}
+	running = true
+	if err := logDaemonTracks(context.Background(), 0); err != nil || polls != 1 {
+		t.Fatalf("running: polls=%d err=%v", polls, err)
+	}
+}
+
+func TestCmdUndoRestoresSnapshot(t *testing.T) {
+	origPath := undoStatePath
+	origNow := getNowPlaying
+	origOutputs := setCurrentOutputs
+	origVolume := setDeviceVolume
+	origPlay := playPlaylistByID
+	origPause := pausePlayback
+	origBatch, origSelect, origStation, origStop := runMusicBatch, selectOutputs, playStationByID, stopPlayback
+	t.Cleanup(func() {
+		undoStatePath = origPath
+		getNowPlaying = origNow
+		setCurrentOutputs = origOutputs
+		setDeviceVolume = origVolume
+		playPlaylistByID = origPlay
+		pausePlayback = origPause
+		runMusicBatch, selectOutputs, playStationByID, stopPlayback = origBatch, origSelect, origStation, origStop
+		pendingUndo, undoDraft = nil, nil
+	})
+	path := filepath.Join(t.TempDir(), "undo.json")
+	undoStatePath = func() (string, error) { return path, nil }
+
+	_, recovered := captureStdoutAndRecover(t, func() { cmdUndo(context.Background(), nil) })
+	if recovered == nil {
+		t.Fatalf("expected nothing-to-undo error")
+	}
+
+	state := music.NowPlaying{
+		PlayerState: "paused",
+		PlaylistID:  "P1",
+		Outputs:     []music.AirPlayDevice{{Name: "Bedroom", Selected: true, Volume: 25}},
+	}
+	reads := 0
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) { reads++; return state, nil }
+	captureUndoSnapshot("volume", []string{"30", "--backend", "native"})
+	if undoDraft != nil {
+		t.Fatalf("native commands should not be snapshotted")
+	}
+	// play reads the state inside its batch, not with a read of its own.
+	runMusicBatch = func(_ context.Context, b *music.Batch) (music.BatchResult, error) {
+		before := state
+		return music.BatchResult{Before: &before}, nil
+	}
+	captureUndoSnapshot("play", []string{"chill", "--room", "Kitchen"})
+	if _, err := runMusicBatch(context.Background(), music.NewBatch().SetOutputs([]string{"Kitchen"})); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 0 || pendingUndo == nil || pendingUndo.PlaylistID != "P1" {
+		t.Fatalf("reads=%d pending=%+v, want the batch's before state", reads, pendingUndo)
+	}
+	commitUndoSnapshot()
+
+	state = music.NowPlaying{
+		PlayerState: "playing",
+		PlaylistID:  "P2",
+		Outputs:     []music.AirPlayDevice{{Name: "Kitchen", Selected: true, Volume: 60}},
+	}
+	var calls []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		calls = append(calls, "outputs:"+strings.Join(rooms, ","))
+		return nil
+	}
+	setDeviceVolume = func(_ context.Context, room string, v int) error {
+		calls = append(calls, "volume:"+room+"="+strconv.Itoa(v))
+		return nil
+	}
+	playPlaylistByID = func(_ context.Context, id string) error {
+		calls = append(calls, "play:"+id)
+		return nil
+	}
+	pausePlayback = func(context.Context) error {
+		calls = append(calls, "pause")
+		return nil
+	}
+
+	out := captureStdout(t, func() { cmdUndo(context.Background(), []string{"--dry-run", "--json"}) })
+	if len(calls) != 0 {
+		t.Fatalf("dry-run changed state: %v", calls)
+	}
+	var res undoResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if !res.DryRun || res.Undid != "play chill --room Kitchen" || res.PlaylistID != "P1" || !res.Paused {
+		t.Fatalf("res=%+v", res)
+	}
+
+	_ = captureStdout(t, func() { cmdUndo(context.Background(), nil) })
+	want := []string{"outputs:Bedroom", "volume:Bedroom=25", "play:P1", "pause"}
+	if strings.Join(calls, " ") != strings.Join(want, " ") {
+		t.Fatalf("calls=%v want %v", calls, want)
+	}
+
+	// A change with no read before it reads the state first, once.
+	reads = 0
+	captureUndoSnapshot("volume", []string{"30", "Kitchen"})
+	if err := setDeviceVolume(context.Background(), "Kitchen", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := setDeviceVolume(context.Background(), "Den", 30); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1 || pendingUndo == nil || pendingUndo.Command != "volume" || pendingUndo.Volumes["Kitchen"] != 60 {
+		t.Fatalf("reads=%d pending=%+v", reads, pendingUndo)
+	}
+}
+
+func TestCmdCache(t *testing.T) {
+	origPath := playlistCachePath
+	origRefresh := refreshPlaylistCache
+	origClear := clearPlaylistCache
+	origDevicePath, origDeviceRefresh, origDeviceClear := deviceCachePath, refreshDeviceCache, clearDeviceCache
+	t.Cleanup(func() {
+		playlistCachePath = origPath
+		refreshPlaylistCache = origRefresh
+		clearPlaylistCache = origClear
+		deviceCachePath, refreshDeviceCache, clearDeviceCache = origDevicePath, origDeviceRefresh, origDeviceClear
+	})
+	playlistCachePath = func() (string, error) { return "/tmp/homepodctl-test/playlists.json", nil }
+	deviceCachePath = func() (string, error) { return "/tmp/homepodctl-test/devices.json", nil }
+	refreshed, cleared := 0, 0
+	refreshPlaylistCache = func(context.Context) ([]music.UserPlaylist, error) {
+		refreshed++
+		return []music.UserPlaylist{{PersistentID: "A", Name: "Focus"}, {PersistentID: "B", Name: "Party"}}, nil
+	}
+	refreshDeviceCache = func(context.Context) ([]music.AirPlayDevice, time.Time, error) {
+		refreshed++
+		return []music.AirPlayDevice{{Name: "Kitchen"}}, time.Now(), nil
+	}
+	clearPlaylistCache = func() error {
+		cleared++
+		return nil
+	}
+	clearDeviceCache = func() error {
+		cleared++
+		return nil
+	}
+
+	out := captureStdout(t, func() { cmdCache(context.Background(), []string{"refresh", "--json"}) })
+	var res cacheResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if refreshed != 2 || res.Action != "refresh" || res.Playlists != 2 || res.Devices != 1 || res.DevicesPath == "" {
+		t.Fatalf("refreshed=%d res=%+v", refreshed, res)
+	}
+
+	out = captureStdout(t, func() { cmdCache(context.Background(), []string{"clear", "--dry-run"}) })
+	if cleared != 0 || !strings.Contains(out, "would clear") {
+		t.Fatalf("cleared=%d out=%q", cleared, out)
+	}
+	_ = captureStdout(t, func() { cmdCache(context.Background(), []string{"clear"}) })
+	if cleared != 2 {
+		t.Fatalf("cleared=%d, want 2", cleared)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() { cmdCache(context.Background(), []string{"purge"}) })
+	if recovered == nil {
+		t.Fatalf("expected unknown subcommand to fail")
+	}
+}
+
+func TestCmdStateShowAndClear(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tmp)
+	origConfig := configPath
+	origCache, origDeviceCache := playlistCachePath, deviceCachePath
+	t.Cleanup(func() {
+		configPath = origConfig
+		playlistCachePath, deviceCachePath = origCache, origDeviceCache
+	})
+	configPath = func() (string, error) { return filepath.Join(tmp, "config.json"), nil }
+	playlistCachePath = func() (string, error) { return filepath.Join(tmp, "playlists.json"), nil }
+	deviceCachePath = func() (string, error) { return filepath.Join(tmp, "devices.json"), nil }
+	dir := filepath.Join(tmp, "homepodctl")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "history.jsonl"), filepath.Join(dir, "undo.json"), filepath.Join(dir, "daemon.sock"), filepath.Join(tmp, "playlists.json")} {
+		if err := os.WriteFile(path, []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := captureStdout(t, func() { cmdState([]string{"show", "--json"}) })
+	var shown stateShowResult
+	if err := json.Unmarshal([]byte(out), &shown); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if shown.Dir != dir || len(shown.Elsewhere) != 2 || !shown.Elsewhere[0].Exists || shown.Elsewhere[1].Exists {
+		t.Fatalf("show=%+v", shown)
+	}
+
+	out = captureStdout(t, func() { cmdState([]string{"clear", "--dry-run"}) })
+	if !strings.Contains(out, "would remove history.jsonl, undo.json") {
+		t.Fatalf("dry-run out=%q", out)
+	}
+	out = captureStdout(t, func() { cmdState([]string{"clear", "--json"}) })
+	var cleared stateClearResult
+	if err := json.Unmarshal([]byte(out), &cleared); err != nil || len(cleared.Removed) != 2 {
+		t.Fatalf("clear=%+v err=%v", cleared, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "daemon.sock")); err != nil {
+		t.Fatalf("daemon.sock removed without being named: %v", err)
+	}
+	_ = captureStdout(t, func() { cmdState([]string{"clear", "playlists.json"}) })
+	if _, err := os.Stat(filepath.Join(tmp, "playlists.json")); !os.IsNotExist(err) {
+		t.Fatalf("playlists.json still present: %v", err)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() { cmdState([]string{"clear", "config.json"}) })
+	if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+		t.Fatalf("recovered=%v", recovered)
+	}
+}
+
+func TestCmdDaemonStatus(t *testing.T) {
+	origPing := pingDaemon
+	origPath := daemonSocketPath
+	t.Cleanup(func() {
+		pingDaemon = origPing
+		daemonSocketPath = origPath
+	})
+	daemonSocketPath = func() (string, error) { return "/tmp/homepodctl-test/daemon.sock", nil }
+
+	pingDaemon = func(context.Context, string) (time.Duration, error) {
+		return 0, errors.New("connect: no such file or directory")
+	}
+	_, recovered := captureStdoutAndRecover(t, func() { cmdDaemon([]string{"status"}) })
+	if recovered == nil {
+		t.Fatalf("expected status to fail when no daemon answers")
+	}
+
+	var pinged string
+	pingDaemon = func(_ context.Context, path string) (time.Duration, error) {
+		pinged = path
+		return 3 * time.Millisecond, nil
+	}
+	out := captureStdout(t, func() { cmdDaemon([]string{"status", "--socket", "/tmp/other.sock", "--json"}) })
+	var res daemonStatusResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if pinged != "/tmp/other.sock" || !res.Running || res.LatencyMS != 3 {
+		t.Fatalf("pinged=%q res=%+v", pinged, res)
+	}
+
+	_, recovered = captureStdoutAndRecover(t, func() { cmdDaemon([]string{"restart"}) })
+	if recovered == nil {
+		t.Fatalf("expected unknown subcommand to fail")
+	}
+}
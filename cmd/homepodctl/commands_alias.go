@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+const aliasUsage = "usage: homepodctl alias <add|remove|rename|copy> [args]"
+
+type aliasEditResult struct {
+	OK     bool          `json:"ok"`
+	Action string        `json:"action"`
+	Name   string        `json:"name"`
+	From   string        `json:"from,omitempty"`
+	Path   string        `json:"path"`
+	DryRun bool          `json:"dryRun,omitempty"`
+	Alias  *native.Alias `json:"alias,omitempty"`
+}
+
+func cmdAlias(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		die(usageErrf(aliasUsage))
+	}
+	sub := args[0]
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		die(err)
+	}
+	if cfg.Aliases == nil {
+		cfg.Aliases = map[string]native.Alias{}
+	}
+
+	res := aliasEditResult{OK: true, Action: "alias." + sub, DryRun: opts.DryRun}
+	switch sub {
+	case "add":
+		if len(positionals) != 1 {
+			die(usageErrf("usage: homepodctl alias add <name> [--playlist <name>|--playlist-id <id>|--shortcut <name>] [--room <name> ...] [--volume <0-100>] [--shuffle] [--backend airplay|native] [--no-verify]"))
+		}
+		name := strings.TrimSpace(positionals[0])
+		if _, ok := cfg.Aliases[name]; ok {
+			die(usageErrf("alias %q already exists (run `homepodctl alias remove %s` first)", name, name))
+		}
+		a, err := aliasFromFlags(flags)
+		if err != nil {
+			die(err)
+		}
+		noVerify, _, err := flags.boolStrict("no-verify")
+		if err != nil {
+			die(err)
+		}
+		if !noVerify {
+			if err := verifyAlias(ctx, cfg, a); err != nil {
+				die(err)
+			}
+		}
+		cfg.Aliases[name] = a
+		res.Name, res.Alias = name, &a
+	case "remove":
+		if len(positionals) != 1 {
+			die(usageErrf("usage: homepodctl alias remove <name>"))
+		}
+		name := positionals[0]
+		if _, ok := cfg.Aliases[name]; !ok {
+			die(usageErrf("unknown alias: %q (run `homepodctl aliases`)", name))
+		}
+		delete(cfg.Aliases, name)
+		res.Name = name
+	case "rename", "copy":
+		if len(positionals) != 2 {
+			die(usageErrf("usage: homepodctl alias %s <from> <to>", sub))
+		}
+		from, to := positionals[0], strings.TrimSpace(positionals[1])
+		a, ok := cfg.Aliases[from]
+		if !ok {
+			die(usageErrf("unknown alias: %q (run `homepodctl aliases`)", from))
+		}
+		if _, exists := cfg.Aliases[to]; exists {
+			die(usageErrf("alias %q already exists", to))
+		}
+		a.Rooms = append([]string(nil), a.Rooms...)
+		cfg.Aliases[to] = a
+		if sub == "rename" {
+			delete(cfg.Aliases, from)
+		}
+		res.Name, res.From, res.Alias = to, from, &a
+	default:
+		die(usageErrf("unknown alias subcommand: %q (%s)", sub, aliasUsage))
+	}
+
+	if issues := validateConfigValues(cfg); len(issues) > 0 {
+		die(usageErrf("updated config is invalid: %s", strings.Join(issues, "; ")))
+	}
+	if res.Path, err = configPath(); err != nil {
+		die(err)
+	}
+	if !opts.DryRun {
+		if err := saveConfig(cfg); err != nil {
+			die(err)
+		}
+	}
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	detail := res.Name
+	if res.From != "" {
+		detail = res.From + " -> " + res.Name
+	}
+	verb := "Updated"
+	if opts.DryRun {
+		verb = "dry-run: would update"
+	}
+	fmt.Printf("%s %s (alias %s %s)\n", verb, res.Path, sub, detail)
+}
+
+// aliasFromFlags builds an alias from `alias add` flags. Exactly one of
+// --playlist, --playlist-id, --station, or --shortcut is required.
+func aliasFromFlags(flags parsedArgs) (native.Alias, error) {
+	a := native.Alias{
+		Backend:    strings.TrimSpace(flags.string("backend")),
+		Playlist:   strings.TrimSpace(flags.string("playlist")),
+		PlaylistID: strings.TrimSpace(flags.string("playlist-id")),
+		Station:    strings.TrimSpace(flags.string("station")),
+		Shortcut:   strings.TrimSpace(flags.string("shortcut")),
+	}
+	set := 0
+	for _, v := range []string{a.Playlist, a.PlaylistID, a.Station, a.Shortcut} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return native.Alias{}, usageErrf("alias add needs exactly one of --playlist, --playlist-id, --station, or --shortcut")
+	}
+	if a.Backend == "" {
+		a.Backend = "airplay"
+		if a.Shortcut != "" {
+			a.Backend = "native"
+		}
+	}
+	for _, room := range flags.strings("room") {
+		if room = strings.TrimSpace(room); room != "" {
+			a.Rooms = append(a.Rooms, room)
+		}
+	}
+	if v, ok, err := flags.intStrict("volume"); err != nil {
+		return native.Alias{}, err
+	} else if ok {
+		a.Volume = &v
+	}
+	if v, ok, err := flags.boolStrict("shuffle"); err != nil {
+		return native.Alias{}, err
+	} else if ok {
+		a.Shuffle = &v
+	}
+	return a, nil
+}
+
+// verifyAlias checks that the alias's playlist, rooms, and shortcut exist.
+// Room names may also be configured groups.
+func verifyAlias(ctx context.Context, cfg *native.Config, a native.Alias) error {
+	const tip = " (use --no-verify to skip this check)"
+	switch {
+	case a.PlaylistID != "":
+		if _, err := findPlaylistNameByID(ctx, a.PlaylistID); err != nil {
+			return fmt.Errorf("playlist id %q not found: %w%s", a.PlaylistID, err, tip)
+		}
+	case a.Playlist != "":
+		if _, err := findPlaylistIDByName(ctx, a.Playlist); err != nil {
+			return fmt.Errorf("playlist %q not found: %w%s", a.Playlist, err, tip)
+		}
+	case a.Station != "":
+		if a.Backend == "native" {
+			return usageErrf("--station needs backend airplay")
+		}
+		if _, err := resolveStation(ctx, a.Station); err != nil {
+			return fmt.Errorf("%w%s", err, tip)
+		}
+	case a.Shortcut != "":
+		installed, err := listShortcuts(ctx)
+		if err != nil {
+			return fmt.Errorf("list shortcuts: %w%s", err, tip)
+		}
+		if missing := native.MissingShortcuts([]native.ShortcutRef{{Name: a.Shortcut}}, installed); len(missing) > 0 {
+			return usageErrf("shortcut %q is not installed%s", a.Shortcut, tip)
+		}
+	}
+
+	var rooms []string
+	for _, room := range a.Rooms {
+		if !isGroupName(cfg, room) {
+			rooms = append(rooms, room)
+		}
+	}
+	if len(rooms) == 0 {
+		return nil
+	}
+	devices, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("list AirPlay devices: %w%s", err, tip)
+	}
+	var unknown []string
+	for _, room := range rooms {
+		found := false
+		for _, d := range devices {
+			if strings.EqualFold(d.Name, room) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, room)
+		}
+	}
+	if len(unknown) > 0 {
+		return usageErrf("unknown room(s): %s (run `homepodctl devices`)%s", strings.Join(unknown, ", "), tip)
+	}
+	return nil
+}
+
+func isGroupName(cfg *native.Config, name string) bool {
+	for g := range cfg.Groups {
+		if strings.EqualFold(g, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+type aliasSequenceStep struct {
+	Index      int    `json:"index"`
+	Step       string `json:"step"`
+	Kind       string `json:"kind"` // alias|automation
+	Parent     string `json:"parent"`
+	OK         bool   `json:"ok"`
+	Skipped    bool   `json:"skipped"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+type aliasSequenceResult struct {
+	OK     bool                `json:"ok"`
+	Action string              `json:"action"`
+	Alias  string              `json:"alias"`
+	DryRun bool                `json:"dryRun,omitempty"`
+	Steps  []aliasSequenceStep `json:"steps"`
+}
+
+// isAutomationFileRef reports whether a sequence entry names an automation
+// file rather than another alias.
+func isAutomationFileRef(step string) bool {
+	switch strings.ToLower(filepath.Ext(step)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func cmdRunSequence(ctx context.Context, cfg *native.Config, aliasName string, opts outputOptions, force bool) {
+	steps, err := planAliasSequence(cfg, aliasName)
+	if err != nil {
+		die(err)
+	}
+	// The command's deadline (longCommandTimeout for run unless --timeout
+	// is set) and Ctrl-C stop the run: the current step fails, the rest are
+	// skipped, and the report below is still written.
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	res := aliasSequenceResult{OK: true, Action: "run", Alias: aliasName, DryRun: opts.DryRun}
+	res.Steps, res.OK = executeAliasSequence(runCtx, cfg, steps, opts.DryRun, force)
+	stop()
+	recordResult(res)
+
+	if opts.JSON {
+		writeJSON(res)
+	} else if !quiet || !res.OK {
+		fmt.Printf("run alias=%q ok=%t steps=%d\n", aliasName, res.OK, len(res.Steps))
+		for _, st := range res.Steps {
+			line := fmt.Sprintf("%d/%d %s %s ok=%t", st.Index+1, len(res.Steps), st.Kind, st.Step, st.OK)
+			if st.Error != "" {
+				line += " error=" + st.Error
+			}
+			fmt.Println(line)
+		}
+	}
+	if !res.OK {
+		exitCode(exitGeneric)
+	}
+}
+
+// planAliasSequence flattens aliasName's sequence, expanding nested sequence
+// aliases in place.
+func planAliasSequence(cfg *native.Config, aliasName string) ([]aliasSequenceStep, error) {
+	if cycle := cfg.AliasCycle(aliasName); cycle != nil {
+		return nil, &native.ConfigError{Op: "alias", Err: fmt.Errorf("alias %q sequence has a cycle: %s", aliasName, strings.Join(cycle, " → "))}
+	}
+	var steps []aliasSequenceStep
+	var expand func(parent string) error
+	expand = func(parent string) error {
+		for _, step := range cfg.Aliases[parent].Sequence {
+			if a, ok := cfg.Aliases[step]; ok {
+				if len(a.Sequence) > 0 {
+					if err := expand(step); err != nil {
+						return err
+					}
+					continue
+				}
+				steps = append(steps, aliasSequenceStep{Index: len(steps), Step: step, Kind: "alias", Parent: parent})
+				continue
+			}
+			if !isAutomationFileRef(step) {
+				return &native.ConfigError{Op: "alias", Err: fmt.Errorf("alias %q sequence step %q is not an alias or automation file (.yaml, .yml, .json)", parent, step)}
+			}
+			steps = append(steps, aliasSequenceStep{Index: len(steps), Step: step, Kind: "automation", Parent: parent})
+		}
+		return nil
+	}
+	if err := expand(aliasName); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// executeAliasSequence runs steps in order and stops at the first failure or
+// once ctx is done, marking the remaining steps as skipped. force is passed
+// on to alias steps.
+func executeAliasSequence(ctx context.Context, cfg *native.Config, steps []aliasSequenceStep, dryRun, force bool) ([]aliasSequenceStep, bool) {
+	out := append([]aliasSequenceStep(nil), steps...)
+	for i := range out {
+		start := time.Now()
+		err := ctx.Err()
+		if err == nil {
+			err = runAliasSequenceStep(ctx, cfg, out[i], dryRun, force)
+		}
+		out[i].DurationMS = time.Since(start).Milliseconds()
+		if err != nil {
+			out[i].Error = err.Error()
+			for j := i + 1; j < len(out); j++ {
+				out[j].Skipped = true
+				out[j].Error = "skipped due to previous step failure"
+			}
+			return out, false
+		}
+		out[i].OK = true
+	}
+	return out, true
+}
+
+func runAliasSequenceStep(ctx context.Context, cfg *native.Config, st aliasSequenceStep, dryRun, force bool) error {
+	if st.Kind == "alias" {
+		_, err := runAlias(ctx, cfg, st.Step, cfg.Aliases[st.Step], dryRun, force)
+		return err
+	}
+	doc, err := loadAutomationFile(st.Step)
+	if err != nil {
+		return err
+	}
+	if err := validateAutomation(doc); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	results, ok := executeAutomationSteps(ctx, cfg, doc)
+	if ok {
+		return nil
+	}
+	for _, r := range results {
+		if !r.OK && !r.Skipped {
+			return fmt.Errorf("automation step %d (%s): %s", r.Index+1, r.Type, r.Error)
+		}
+	}
+	return fmt.Errorf("automation %q failed", st.Step)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/state"
+	"github.com/agisilaos/homepodctl/internal/sysaudio"
+)
+
+// audioRouteState is what audio route --reset switches back to. It lives in
+// the state dir as audio-route.json.
+type audioRouteState struct {
+	Time     string `json:"time"`
+	Output   string `json:"output"`
+	Previous string `json:"previous"`
+}
+
+type audioRouteResult struct {
+	OK       bool   `json:"ok"`
+	Action   string `json:"action"`
+	DryRun   bool   `json:"dryRun,omitempty"`
+	Reset    bool   `json:"reset,omitempty"`
+	Output   string `json:"output"`
+	Previous string `json:"previous,omitempty"`
+}
+
+type audioStatusResult struct {
+	Current string            `json:"current"`
+	Outputs []sysaudio.Output `json:"outputs"`
+	// RoutedFrom is the output audio route --reset would go back to.
+	RoutedFrom string `json:"routedFrom,omitempty"`
+}
+
+func defaultAudioRouteStatePath() (string, error) {
+	return state.Path("audio-route.json")
+}
+
+func loadAudioRouteState() (*audioRouteState, error) {
+	path, err := audioRouteStatePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var st audioRouteState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return &st, nil
+}
+
+func saveAudioRouteState(st *audioRouteState) error {
+	path, err := audioRouteStatePath()
+	if err != nil {
+		return err
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func cmdAudio(ctx context.Context, cfg *native.Config, args []string) {
+	if len(args) == 0 {
+		die(usageErrf("usage: homepodctl audio <route|status> ..."))
+	}
+	switch args[0] {
+	case "route":
+		cmdAudioRoute(ctx, cfg, args[1:])
+	case "status":
+		cmdAudioStatus(ctx, args[1:])
+	default:
+		die(usageErrf("unknown audio subcommand: %q (expected route or status)", args[0]))
+	}
+}
+
+func cmdAudioRoute(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	reset, _, err := flags.boolStrict("reset")
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	if reset != (len(positionals) == 0) || len(positionals) > 1 {
+		die(usageErrf("usage: homepodctl audio route <room> | homepodctl audio route --reset"))
+	}
+	st, err := loadAudioRouteState()
+	if err != nil {
+		die(err)
+	}
+	current, err := currentSystemOutput(ctx)
+	if err != nil {
+		die(err)
+	}
+	res := audioRouteResult{OK: true, Action: "audio route", DryRun: opts.DryRun}
+	if reset {
+		if st == nil {
+			die(usageErrf("nothing to reset (audio route has not switched the system output)"))
+		}
+		res.Reset, res.Output, res.Previous = true, st.Previous, current
+	} else {
+		name, err := resolveSystemOutput(ctx, cfg, positionals[0], exact)
+		if err != nil {
+			die(err)
+		}
+		res.Output, res.Previous = name, current
+		// Routing from one room to another keeps the output from before the
+		// first route for --reset.
+		if st != nil && st.Output == current {
+			res.Previous = st.Previous
+		}
+	}
+	debugf("audio route: current=%q output=%q previous=%q reset=%t", current, res.Output, res.Previous, reset)
+	if !opts.DryRun {
+		if res.Output != current {
+			if err := setSystemOutput(ctx, res.Output); err != nil {
+				die(err)
+			}
+		}
+		if reset {
+			path, err := audioRouteStatePath()
+			if err == nil {
+				err = os.Remove(path)
+			}
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				die(err)
+			}
+		} else if err := saveAudioRouteState(&audioRouteState{Time: timeNow().UTC().Format(time.RFC3339), Output: res.Output, Previous: res.Previous}); err != nil {
+			die(err)
+		}
+	}
+
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	if opts.Plain {
+		fmt.Printf("%s\t%s\n", res.Output, res.Previous)
+		return
+	}
+	prefix := "system audio"
+	if opts.DryRun {
+		prefix = "dry-run: would switch system audio to"
+	}
+	if reset {
+		fmt.Printf("%s: %s (reset)\n", prefix, res.Output)
+		return
+	}
+	fmt.Printf("%s: %s (was %s)\n", prefix, res.Output, res.Previous)
+}
+
+// resolveSystemOutput finds the system output for room, a room, device
+// alias, or single-room group from the config or an output name matched as
+// rooms are.
+func resolveSystemOutput(ctx context.Context, cfg *native.Config, room string, exact bool) (string, error) {
+	rooms := cfg.ExpandRooms([]string{room})
+	if len(rooms) != 1 {
+		return "", usageErrf("system audio goes to one output; %s is a group of %d rooms", room, len(rooms))
+	}
+	outputs, err := listSystemOutputs(ctx)
+	if err != nil {
+		return "", err
+	}
+	devs := make([]music.AirPlayDevice, 0, len(outputs))
+	for _, o := range outputs {
+		devs = append(devs, music.AirPlayDevice{Name: o.Name, Available: true})
+	}
+	name, err := music.ResolveRoom(rooms[0], devs, exact)
+	if err != nil {
+		return "", fmt.Errorf("%w (a HomePod is listed as a system output only while macOS sees it on the network; see homepodctl audio status)", err)
+	}
+	return name, nil
+}
+
+func cmdAudioStatus(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl audio status [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	outputs, err := listSystemOutputs(ctx)
+	if err != nil {
+		die(err)
+	}
+	res := audioStatusResult{Outputs: outputs}
+	if res.Outputs == nil {
+		res.Outputs = []sysaudio.Output{}
+	}
+	for _, o := range outputs {
+		if o.Current {
+			res.Current = o.Name
+		}
+	}
+	if st, err := loadAudioRouteState(); err != nil {
+		debugf("audio status: %v", err)
+	} else if st != nil && st.Output == res.Current {
+		res.RoutedFrom = st.Previous
+	}
+	if jsonOut {
+		writeJSON(res)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "OUTPUT\tCURRENT")
+	}
+	for _, o := range res.Outputs {
+		fmt.Fprintf(tw, "%s\t%t\n", o.Name, o.Current)
+	}
+	_ = tw.Flush()
+	if !plain && res.RoutedFrom != "" {
+		fmt.Printf("routed by homepodctl; audio route --reset returns to %s\n", res.RoutedFrom)
+	}
+}
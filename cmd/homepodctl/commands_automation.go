@@ -29,10 +29,31 @@ type automationStep struct {
 	Rooms      []string `json:"rooms,omitempty" yaml:"rooms,omitempty"`
 	Query      string   `json:"query,omitempty" yaml:"query,omitempty"`
 	PlaylistID string   `json:"playlistId,omitempty" yaml:"playlistId,omitempty"`
+	Station    string   `json:"station,omitempty" yaml:"station,omitempty"`
 	Value      *int     `json:"value,omitempty" yaml:"value,omitempty"`
 	State      string   `json:"state,omitempty" yaml:"state,omitempty"`
+	Until      string   `json:"until,omitempty" yaml:"until,omitempty"`
 	Timeout    string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 	Action     string   `json:"action,omitempty" yaml:"action,omitempty"`
+	Enabled    *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Mode       string   `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Position   *float64 `json:"position,omitempty" yaml:"position,omitempty"`
+	For        string   `json:"for,omitempty" yaml:"for,omitempty"` // duck: restore after this long
+	Title      string   `json:"title,omitempty" yaml:"title,omitempty"`
+	Message    string   `json:"message,omitempty" yaml:"message,omitempty"`
+	URL        string   `json:"url,omitempty" yaml:"url,omitempty"`
+	Payload    any      `json:"payload,omitempty" yaml:"payload,omitempty"`
+	Retries    *int     `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Input      string   `json:"input,omitempty" yaml:"input,omitempty"`
+	Force      bool     `json:"force,omitempty" yaml:"force,omitempty"` // play, volume.set: ignore maxVolume
+	// Synchronized starts a play step in every room at once, like play
+	// --synchronized.
+	Synchronized bool `json:"synchronized,omitempty" yaml:"synchronized,omitempty"`
+	// Steps, Concurrency, and FailOn belong to a parallel block.
+	Steps       []automationStep `json:"steps,omitempty" yaml:"steps,omitempty"`
+	Concurrency *int             `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	FailOn      string           `json:"failOn,omitempty" yaml:"failOn,omitempty"`
 }
 
 type automationStepResult struct {
@@ -44,6 +65,10 @@ type automationStepResult struct {
 	Skipped    bool           `json:"skipped"`
 	Error      string         `json:"error,omitempty"`
 	DurationMS int64          `json:"durationMs"`
+	// Branches reports each step of a parallel block.
+	Branches []automationStepResult `json:"branches,omitempty"`
+	// Preflight is what --resolve live found for the step.
+	Preflight *automationPreflight `json:"preflight,omitempty"`
 }
 
 type automationCommandResult struct {
@@ -65,7 +90,7 @@ type automationInitResult struct {
 
 func cmdAutomation(ctx context.Context, cfg *native.Config, args []string) {
 	if len(args) == 0 {
-		die(usageErrf("usage: homepodctl automation <run|validate|plan|init> [args]"))
+		die(usageErrf("usage: homepodctl automation <run|validate|plan|init|history|status|serve|record> [args]"))
 	}
 	switch args[0] {
 	case "run":
@@ -73,9 +98,17 @@ func cmdAutomation(ctx context.Context, cfg *native.Config, args []string) {
 	case "validate":
 		cmdAutomationValidate(cfg, args[1:])
 	case "plan":
-		cmdAutomationPlan(cfg, args[1:])
+		cmdAutomationPlan(ctx, cfg, args[1:])
 	case "init":
 		cmdAutomationInit(args[1:])
+	case "history":
+		cmdAutomationHistory(args[1:])
+	case "status":
+		cmdAutomationStatus(args[1:])
+	case "serve":
+		cmdAutomationServe(ctx, cfg, args[1:])
+	case "record":
+		cmdAutomationRecord(args[1:])
 	default:
 		die(usageErrf("unknown automation subcommand: %q", args[0]))
 	}
@@ -84,10 +117,10 @@ func cmdAutomation(ctx context.Context, cfg *native.Config, args []string) {
 func cmdAutomationRun(ctx context.Context, cfg *native.Config, args []string) {
 	flags, positionals, err := parseArgs(args)
 	if err != nil {
-		die(usageErrf("usage: homepodctl automation run -f <file|-> [--dry-run] [--json] [--no-input]"))
+		die(usageErrf("usage: homepodctl automation run -f <file|-> [--dry-run [--resolve static|live]] [--json] [--no-input]"))
 	}
 	if len(positionals) != 0 {
-		die(usageErrf("usage: homepodctl automation run -f <file|-> [--dry-run] [--json] [--no-input]"))
+		die(usageErrf("usage: homepodctl automation run -f <file|-> [--dry-run [--resolve static|live]] [--json] [--no-input]"))
 	}
 	filePath, err := parseAutomationFileFlag(flags)
 	if err != nil {
@@ -104,8 +137,6 @@ func cmdAutomationRun(ctx context.Context, cfg *native.Config, args []string) {
 		die(err)
 	}
 
-	mode := "run"
-	steps := resolveAutomationSteps(cfg, doc)
 	dryRun, _, err := flags.boolStrict("dry-run")
 	if err != nil {
 		die(err)
@@ -114,27 +145,82 @@ func cmdAutomationRun(ctx context.Context, cfg *native.Config, args []string) {
 	if err != nil {
 		die(err)
 	}
-	if dryRun {
-		mode = "dry-run"
-		result := buildAutomationResult(mode, doc, steps)
-		emitAutomationResult(result, jsonOut)
+	if _, _, err := flags.boolStrict("no-input"); err != nil {
+		die(err)
+	}
+	live, err := parseResolveMode(flags)
+	if err != nil {
+		die(err)
+	}
+	if live {
+		if !dryRun && !dryRunAll {
+			die(usageErrf("--resolve live needs --dry-run"))
+		}
+		runAutomationPreflight(ctx, cfg, doc, "dry-run", jsonOut)
 		return
 	}
-	if _, _, err := flags.boolStrict("no-input"); err != nil {
+	runAutomationDoc(ctx, cfg, doc, filePath, dryRun || dryRunAll, jsonOut)
+}
+
+// parseResolveMode reads --resolve: static (the default) plans from the
+// file and config alone, live also checks the plan against Music.app.
+func parseResolveMode(flags parsedArgs) (bool, error) {
+	switch mode := strings.TrimSpace(flags.string("resolve")); mode {
+	case "", "static":
+		return false, nil
+	case "live":
+		return true, nil
+	default:
+		return false, usageErrf("invalid --resolve %q (expected static or live)", mode)
+	}
+}
+
+// runAutomationPreflight reports a live plan of doc and fails when a step
+// would not run as planned.
+func runAutomationPreflight(ctx context.Context, cfg *native.Config, doc *automationFile, mode string, jsonOut bool) {
+	steps, ok, err := preflightAutomation(ctx, cfg, doc)
+	if err != nil {
 		die(err)
 	}
-	// automation runs can include waits; use a longer timeout than one-off commands.
-	runCtx, cancel := context.WithTimeout(ctx, 15*time.Minute)
-	defer cancel()
-	executed, ok := executeAutomationSteps(runCtx, cfg, doc)
-	result := buildAutomationResult(mode, doc, executed)
+	result := buildAutomationResult(mode, doc, steps)
 	result.OK = ok
 	emitAutomationResult(result, jsonOut)
+	if !ok {
+		exitCode(exitGeneric)
+	}
+}
+
+// runAutomationDoc plans (dryRun) or runs a validated document and reports
+// it, for automation files and scenes alike. Real runs are also recorded in
+// automation-runs.jsonl under source (the file, or "scene").
+func runAutomationDoc(ctx context.Context, cfg *native.Config, doc *automationFile, source string, dryRun, jsonOut bool) {
+	if dryRun {
+		result := buildAutomationResult("dry-run", doc, resolveAutomationSteps(cfg, doc))
+		emitAutomationResult(result, jsonOut)
+		return
+	}
+	result := runAutomation(ctx, cfg, doc, source)
+	emitAutomationResult(result, jsonOut)
 	if !result.OK {
 		exitCode(exitGeneric)
 	}
 }
 
+// runAutomation executes a validated document, times it, and records it in
+// automation-runs.jsonl under source.
+func runAutomation(ctx context.Context, cfg *native.Config, doc *automationFile, source string) automationCommandResult {
+	started := time.Now().UTC()
+	executed, ok := executeAutomationSteps(ctx, cfg, doc)
+	ended := time.Now().UTC()
+	result := buildAutomationResult("run", doc, executed)
+	result.OK = ok
+	result.StartedAt = started.Format(time.RFC3339)
+	result.EndedAt = ended.Format(time.RFC3339)
+	result.DurationMS = ended.Sub(started).Milliseconds()
+	saveAutomationRun(automationRun{automationCommandResult: result, Source: source})
+	return result
+}
+
 func cmdAutomationValidate(_ *native.Config, args []string) {
 	flags, positionals, err := parseArgs(args)
 	if err != nil {
@@ -165,13 +251,13 @@ func cmdAutomationValidate(_ *native.Config, args []string) {
 	emitAutomationResult(result, jsonOut)
 }
 
-func cmdAutomationPlan(cfg *native.Config, args []string) {
+func cmdAutomationPlan(ctx context.Context, cfg *native.Config, args []string) {
 	flags, positionals, err := parseArgs(args)
 	if err != nil {
-		die(usageErrf("usage: homepodctl automation plan -f <file|-> [--json]"))
+		die(usageErrf("usage: homepodctl automation plan -f <file|-> [--resolve static|live] [--json]"))
 	}
 	if len(positionals) != 0 {
-		die(usageErrf("usage: homepodctl automation plan -f <file|-> [--json]"))
+		die(usageErrf("usage: homepodctl automation plan -f <file|-> [--resolve static|live] [--json]"))
 	}
 	filePath, err := parseAutomationFileFlag(flags)
 	if err != nil {
@@ -187,11 +273,19 @@ func cmdAutomationPlan(cfg *native.Config, args []string) {
 	if err := validateAutomation(doc); err != nil {
 		die(err)
 	}
-	result := buildAutomationResult("plan", doc, resolveAutomationSteps(cfg, doc))
 	jsonOut, _, err := flags.boolStrict("json")
 	if err != nil {
 		die(err)
 	}
+	live, err := parseResolveMode(flags)
+	if err != nil {
+		die(err)
+	}
+	if live {
+		runAutomationPreflight(ctx, cfg, doc, "plan", jsonOut)
+		return
+	}
+	result := buildAutomationResult("plan", doc, resolveAutomationSteps(cfg, doc))
 	emitAutomationResult(result, jsonOut)
 }
 
@@ -262,6 +356,7 @@ func buildAutomationResult(mode string, doc *automationFile, steps []automationS
 }
 
 func emitAutomationResult(result automationCommandResult, jsonOut bool) {
+	recordResult(result)
 	if jsonOut {
 		writeJSON(result)
 		return
@@ -272,6 +367,11 @@ func emitAutomationResult(result automationCommandResult, jsonOut bool) {
 	fmt.Printf("automation name=%q mode=%s ok=%t steps=%d\n", result.Name, result.Mode, result.OK, len(result.Steps))
 	for _, st := range result.Steps {
 		fmt.Printf("%d/%d %s ok=%t\n", st.Index+1, len(result.Steps), st.Type, st.OK)
+		printPreflight("  ", st.Preflight)
+		for _, b := range st.Branches {
+			fmt.Printf("  %d.%d %s ok=%t durationMs=%d\n", st.Index+1, b.Index+1, b.Type, b.OK, b.DurationMS)
+			printPreflight("    ", b.Preflight)
+		}
 	}
 }
 
@@ -15,52 +15,160 @@ func resolveAutomationSteps(cfg *native.Config, doc *automationFile) []automatio
 
 	out := make([]automationStepResult, 0, len(doc.Steps))
 	for i, st := range doc.Steps {
-		resolved := map[string]any{"backend": resolvedDefaults.Backend}
-		switch st.Type {
-		case "out.set":
-			resolved["rooms"] = st.Rooms
-		case "play":
-			if strings.TrimSpace(st.Query) != "" {
-				resolved["query"] = st.Query
-			}
-			if strings.TrimSpace(st.PlaylistID) != "" {
-				resolved["playlistId"] = st.PlaylistID
-			}
-			if resolvedDefaults.Shuffle != nil {
-				resolved["shuffle"] = *resolvedDefaults.Shuffle
-			}
-			if resolvedDefaults.Volume != nil {
-				resolved["volume"] = *resolvedDefaults.Volume
-			}
-			if len(resolvedDefaults.Rooms) > 0 {
-				resolved["rooms"] = resolvedDefaults.Rooms
-			}
-		case "volume.set":
+		out = append(out, resolveAutomationStep(cfg, doc.Name, resolvedDefaults, i, st))
+	}
+	return out
+}
+
+// resolveAutomationStep is the plan entry for one step; a parallel block
+// lists its resolved branches.
+func resolveAutomationStep(cfg *native.Config, name string, resolvedDefaults automationDefaults, i int, st automationStep) automationStepResult {
+	resolved := map[string]any{"backend": resolvedDefaults.Backend}
+	stepRooms := cfg.ExpandRooms(st.Rooms)
+	switch st.Type {
+	case "out.set":
+		resolved["rooms"] = stepRooms
+	case "play":
+		if strings.TrimSpace(st.Query) != "" {
+			resolved["query"] = st.Query
+		}
+		if strings.TrimSpace(st.PlaylistID) != "" {
+			resolved["playlistId"] = st.PlaylistID
+		}
+		if strings.TrimSpace(st.Station) != "" {
+			resolved["station"] = st.Station
+		}
+		if resolvedDefaults.Shuffle != nil {
+			resolved["shuffle"] = *resolvedDefaults.Shuffle
+		}
+		if resolvedDefaults.Volume != nil {
+			resolved["volume"] = *resolvedDefaults.Volume
+		}
+		if len(resolvedDefaults.Rooms) > 0 {
+			resolved["rooms"] = resolvedDefaults.Rooms
+		}
+		if st.Force {
+			resolved["force"] = true
+		}
+		if st.Synchronized {
+			resolved["synchronized"] = true
+		}
+		if q := activeQuietHours(cfg, resolvedDefaults.Rooms); len(q) > 0 {
+			resolved["quietHours"] = q
+		}
+	case "volume.set":
+		if st.Value != nil {
+			resolved["value"] = *st.Value
+		}
+		if st.Force {
+			resolved["force"] = true
+		}
+		rooms := stepRooms
+		if len(rooms) == 0 {
+			rooms = resolvedDefaults.Rooms
+		}
+		if len(rooms) > 0 {
+			resolved["rooms"] = rooms
+		}
+		if q := activeQuietHours(cfg, rooms); len(q) > 0 {
+			resolved["quietHours"] = q
+		}
+	case "duck", "unduck":
+		if st.Type == "duck" {
+			level := defaultDuckLevel
 			if st.Value != nil {
-				resolved["value"] = *st.Value
+				level = *st.Value
 			}
-			if len(st.Rooms) > 0 {
-				resolved["rooms"] = st.Rooms
-			} else if len(resolvedDefaults.Rooms) > 0 {
-				resolved["rooms"] = resolvedDefaults.Rooms
+			resolved["value"] = level
+			if f := strings.TrimSpace(st.For); f != "" {
+				resolved["for"] = f
 			}
-		case "wait":
+		}
+		if len(stepRooms) > 0 {
+			resolved["rooms"] = stepRooms
+		}
+	case "wait":
+		if strings.TrimSpace(st.Until) != "" {
+			resolved["until"] = st.Until
+			if len(stepRooms) > 0 {
+				resolved["rooms"] = stepRooms
+			}
+		} else {
 			resolved["state"] = st.State
+		}
+		resolved["timeout"] = st.Timeout
+	case "transport":
+		resolved["action"] = st.Action
+	case "shuffle.set":
+		if st.Enabled != nil {
+			resolved["enabled"] = *st.Enabled
+		}
+		if st.Mode != "" {
+			resolved["mode"] = st.Mode
+		}
+	case "repeat.set":
+		resolved["mode"] = strings.ToLower(strings.TrimSpace(st.Mode))
+	case "seek":
+		if st.Position != nil {
+			resolved["position"] = *st.Position
+		}
+	case "notify":
+		resolved["title"] = st.Title
+		if strings.TrimSpace(st.Title) == "" {
+			resolved["title"] = name
+		}
+		resolved["message"] = st.Message
+	case "webhook":
+		resolved["url"] = redactWebhookURL(st.URL)
+		resolved["timeout"] = defaultWebhookTimeout.String()
+		if strings.TrimSpace(st.Timeout) != "" {
 			resolved["timeout"] = st.Timeout
-		case "transport":
-			resolved["action"] = st.Action
-		}
-		out = append(out, automationStepResult{
-			Index:      i,
-			Type:       st.Type,
-			Input:      st,
-			Resolved:   resolved,
-			OK:         true,
-			Skipped:    false,
-			DurationMS: 0,
-		})
+		}
+		resolved["retries"] = 0
+		if st.Retries != nil {
+			resolved["retries"] = *st.Retries
+		}
+	case "shortcut":
+		resolved["name"] = st.Name
+		if st.Input != "" {
+			resolved["input"] = st.Input
+		}
+	case "parallel":
+		resolved["concurrency"] = parallelConcurrency(st)
+		resolved["failOn"] = parallelFailOn(st)
 	}
-	return out
+	res := automationStepResult{
+		Index:      i,
+		Type:       st.Type,
+		Input:      redactStepInput(st),
+		Resolved:   resolved,
+		OK:         true,
+		Skipped:    false,
+		DurationMS: 0,
+	}
+	if st.Type == "parallel" {
+		for j, b := range st.Steps {
+			res.Branches = append(res.Branches, resolveAutomationStep(cfg, name, resolvedDefaults, j, b))
+		}
+	}
+	return res
+}
+
+// redactStepInput is st as results report it: webhook URLs lose their query
+// string and credentials, in parallel blocks too, since results end up in
+// --json output, run history, and automation serve responses.
+func redactStepInput(st automationStep) automationStep {
+	if st.URL != "" {
+		st.URL = redactWebhookURL(st.URL)
+	}
+	if len(st.Steps) > 0 {
+		steps := make([]automationStep, len(st.Steps))
+		for i, b := range st.Steps {
+			steps[i] = redactStepInput(b)
+		}
+		st.Steps = steps
+	}
+	return st
 }
 
 func resolveAutomationDefaults(cfg *native.Config, in automationDefaults) automationDefaults {
@@ -74,6 +182,7 @@ func resolveAutomationDefaults(cfg *native.Config, in automationDefaults) automa
 	if len(out.Rooms) == 0 {
 		out.Rooms = append([]string(nil), cfg.Defaults.Rooms...)
 	}
+	out.Rooms = cfg.ExpandRooms(out.Rooms)
 	if out.Volume == nil && cfg.Defaults.Volume != nil {
 		v := *cfg.Defaults.Volume
 		out.Volume = &v
@@ -95,9 +204,14 @@ func executeAutomationSteps(ctx context.Context, cfg *native.Config, doc *automa
 		res := automationStepResult{
 			Index: i,
 			Type:  st.Type,
-			Input: st,
+			Input: redactStepInput(st),
+		}
+		var err error
+		if st.Type == "parallel" {
+			res.Branches, err = executeAutomationParallel(ctx, cfg, doc.Name, defaults, st)
+		} else {
+			err = executeAutomationStep(ctx, cfg, doc.Name, defaults, st)
 		}
-		err := executeAutomationStep(ctx, cfg, defaults, st)
 		res.DurationMS = time.Since(stepStart).Milliseconds()
 		if err != nil {
 			res.OK = false
@@ -109,7 +223,7 @@ func executeAutomationSteps(ctx context.Context, cfg *native.Config, doc *automa
 				results = append(results, automationStepResult{
 					Index:   j,
 					Type:    doc.Steps[j].Type,
-					Input:   doc.Steps[j],
+					Input:   redactStepInput(doc.Steps[j]),
 					OK:      false,
 					Skipped: true,
 					Error:   "skipped due to previous step failure",
@@ -123,32 +237,87 @@ func executeAutomationSteps(ctx context.Context, cfg *native.Config, doc *automa
 	return results, ok
 }
 
-func executeAutomationStep(ctx context.Context, cfg *native.Config, defaults automationDefaults, st automationStep) error {
+// executeAutomationStep runs one step; name is the routine's, for notify,
+// webhook, and shortcut templates.
+func executeAutomationStep(ctx context.Context, cfg *native.Config, name string, defaults automationDefaults, st automationStep) error {
 	backend := strings.TrimSpace(defaults.Backend)
 	if backend == "" {
 		backend = "airplay"
 	}
+	// Groups and aliases expand here; out.set, AirPlay volume.set, and wait
+	// then resolve partial device names the way --room does.
+	st.Rooms = cfg.ExpandRooms(st.Rooms)
 
 	switch st.Type {
 	case "out.set":
 		if backend != "airplay" {
 			return fmt.Errorf("out.set only supports backend=airplay")
 		}
-		return setCurrentOutputs(ctx, st.Rooms)
+		rooms, err := resolveRooms(ctx, st.Rooms, false)
+		if err != nil {
+			return err
+		}
+		return setCurrentOutputs(ctx, rooms)
 	case "play":
 		return executeAutomationPlay(ctx, cfg, backend, defaults, st)
 	case "volume.set":
 		if st.Value == nil {
 			return fmt.Errorf("volume.set requires value")
 		}
-		return executeAutomationVolume(ctx, cfg, backend, defaults, *st.Value, st.Rooms)
+		return executeAutomationVolume(ctx, cfg, backend, defaults, *st.Value, st.Rooms, st.Force)
+	case "duck", "unduck":
+		if backend != "airplay" {
+			return fmt.Errorf("%s only supports backend=airplay", st.Type)
+		}
+		return executeAutomationDuck(ctx, st)
 	case "wait":
+		if strings.TrimSpace(st.Until) != "" {
+			rooms, err := resolveRooms(ctx, st.Rooms, false)
+			if err != nil {
+				return err
+			}
+			return executeAutomationWaitUntil(ctx, cfg, st.Until, st.Timeout, rooms)
+		}
 		return executeAutomationWait(ctx, st.State, st.Timeout)
 	case "transport":
-		if strings.TrimSpace(st.Action) != "stop" {
+		action := strings.TrimSpace(st.Action)
+		if action == "stop" {
+			return stopPlayback(ctx)
+		}
+		fn, ok := transportActions[action]
+		if !ok {
 			return fmt.Errorf("unsupported transport action %q", st.Action)
 		}
-		return stopPlayback(ctx)
+		return fn(ctx)
+	case "shuffle.set":
+		if st.Enabled == nil && st.Mode == "" {
+			return fmt.Errorf("shuffle.set requires enabled or mode")
+		}
+		if st.Mode != "" {
+			if err := setShuffleMode(ctx, st.Mode); err != nil {
+				return err
+			}
+		}
+		if st.Enabled == nil {
+			return nil
+		}
+		return setShuffle(ctx, *st.Enabled)
+	case "repeat.set":
+		return setSongRepeat(ctx, st.Mode)
+	case "seek":
+		if st.Position == nil {
+			return fmt.Errorf("seek requires position")
+		}
+		return setPlayerPosition(ctx, *st.Position)
+	case "notify":
+		return executeAutomationNotify(ctx, name, st)
+	case "webhook":
+		return executeAutomationWebhook(ctx, name, st)
+	case "shortcut":
+		return executeAutomationShortcut(ctx, name, st)
+	case "parallel":
+		_, err := executeAutomationParallel(ctx, cfg, name, defaults, st)
+		return err
 	default:
 		return fmt.Errorf("unsupported step type %q", st.Type)
 	}
@@ -158,21 +327,44 @@ func executeAutomationPlay(ctx context.Context, cfg *native.Config, backend stri
 	switch backend {
 	case "airplay":
 		rooms := append([]string(nil), defaults.Rooms...)
+		quietRooms := rooms
+		if len(quietRooms) == 0 && cfg != nil && len(cfg.QuietHours) > 0 {
+			quietRooms = inferSelectedOutputs(ctx)
+		}
+		if _, err := checkQuietPlay(cfg, quietRooms, st.Force); err != nil {
+			return err
+		}
 		if len(rooms) > 0 {
 			if err := setCurrentOutputs(ctx, rooms); err != nil {
 				return err
 			}
 		}
 		if defaults.Volume != nil && len(rooms) > 0 {
-			if err := setVolumeForRooms(ctx, rooms, *defaults.Volume); err != nil {
+			if err := setVolumeForRooms(ctx, cfg, rooms, *defaults.Volume, st.Force); err != nil {
 				return err
 			}
+		} else if err := lowerQuietVolumes(ctx, cfg, quietRooms, st.Force); err != nil {
+			return err
 		}
 		if defaults.Shuffle != nil {
 			if err := setShuffle(ctx, *defaults.Shuffle); err != nil {
 				return err
 			}
 		}
+		if strings.TrimSpace(st.Station) != "" {
+			station, err := resolveStation(ctx, st.Station)
+			if err != nil {
+				return err
+			}
+			if st.Synchronized {
+				if err := waitOutputsReady(ctx, rooms); err != nil {
+					return err
+				}
+				_, err := startPrimed(ctx, func(b *music.Batch) { b.PlayStation(station.PersistentID) }, 0)
+				return err
+			}
+			return playStationByID(ctx, station.PersistentID)
+		}
 		id := strings.TrimSpace(st.PlaylistID)
 		if id == "" {
 			matches, err := searchPlaylists(ctx, st.Query)
@@ -185,15 +377,31 @@ func executeAutomationPlay(ctx context.Context, cfg *native.Config, backend stri
 			}
 			id = best.PersistentID
 		}
+		if st.Synchronized {
+			if err := waitOutputsReady(ctx, rooms); err != nil {
+				return err
+			}
+			_, err := startPrimed(ctx, func(b *music.Batch) { b.PlayPlaylist(id) }, 0)
+			return err
+		}
 		return playPlaylistByID(ctx, id)
 	case "native":
 		if cfg == nil {
 			return fmt.Errorf("native backend requires config")
 		}
+		if st.Synchronized {
+			return fmt.Errorf("synchronized play only supports backend=airplay")
+		}
+		if strings.TrimSpace(st.Station) != "" {
+			return fmt.Errorf("station play only supports backend=airplay")
+		}
 		rooms := append([]string(nil), defaults.Rooms...)
 		if len(rooms) == 0 {
 			return fmt.Errorf("native play requires rooms")
 		}
+		if _, err := checkQuietPlay(cfg, rooms, st.Force); err != nil {
+			return err
+		}
 		name := strings.TrimSpace(st.Query)
 		if name == "" {
 			var err error
@@ -208,7 +416,9 @@ func executeAutomationPlay(ctx context.Context, cfg *native.Config, backend stri
 	}
 }
 
-func executeAutomationVolume(ctx context.Context, cfg *native.Config, backend string, defaults automationDefaults, value int, overrideRooms []string) error {
+// executeAutomationVolume sets the step's rooms, or the routine's, to value.
+// force lets it go above their maxVolume.
+func executeAutomationVolume(ctx context.Context, cfg *native.Config, backend string, defaults automationDefaults, value int, overrideRooms []string, force bool) error {
 	rooms := append([]string(nil), overrideRooms...)
 	if len(rooms) == 0 {
 		rooms = append(rooms, defaults.Rooms...)
@@ -221,7 +431,11 @@ func executeAutomationVolume(ctx context.Context, cfg *native.Config, backend st
 		if len(rooms) == 0 {
 			return fmt.Errorf("no rooms available for volume.set")
 		}
-		return setVolumeForRooms(ctx, rooms, value)
+		rooms, err := resolveRooms(ctx, rooms, false)
+		if err != nil {
+			return err
+		}
+		return setVolumeForRooms(ctx, cfg, rooms, value, force)
 	case "native":
 		if cfg == nil {
 			return fmt.Errorf("native backend requires config")
@@ -229,7 +443,7 @@ func executeAutomationVolume(ctx context.Context, cfg *native.Config, backend st
 		if len(rooms) == 0 {
 			return fmt.Errorf("native volume.set requires rooms")
 		}
-		return runNativeVolumeShortcuts(ctx, cfg, rooms, value)
+		return runNativeVolumeShortcuts(ctx, cfg, rooms, value, force)
 	default:
 		return fmt.Errorf("unknown backend %q", backend)
 	}
@@ -253,11 +467,8 @@ func executeAutomationWait(ctx context.Context, wantState string, timeoutRaw str
 		if time.Now().After(deadline) {
 			return fmt.Errorf("wait timeout after %s for state=%s", timeout.String(), want)
 		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		if err := sleepCtx(ctx, time.Second); err != nil {
+			return err
 		}
-		sleepFn(1 * time.Second)
 	}
 }
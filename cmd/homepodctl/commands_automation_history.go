@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// automationRun is one line of automation-runs.jsonl: a finished automation
+// or scene run and where it came from.
+type automationRun struct {
+	automationCommandResult
+	Source string `json:"source,omitempty"`
+}
+
+// automationStatusRow is the last run of one routine as `automation status`
+// reports it.
+type automationStatusRow struct {
+	Name       string `json:"name"`
+	Source     string `json:"source,omitempty"`
+	LastRun    string `json:"lastRun"`
+	OK         bool   `json:"ok"`
+	DurationMS int64  `json:"durationMs"`
+	FailedStep string `json:"failedStep,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Runs       int    `json:"runs"`
+	Failures   int    `json:"failures"`
+}
+
+func defaultAutomationRunsPath() (string, error) {
+	return state.Path("automation-runs.jsonl")
+}
+
+// saveAutomationRun appends a finished run to automation-runs.jsonl. Like
+// history, failing to write it never fails the run itself.
+func saveAutomationRun(run automationRun) {
+	if err := appendAutomationRun(run); err != nil {
+		debugf("automation: record run: %v", err)
+	}
+}
+
+func appendAutomationRun(run automationRun) error {
+	path, err := automationRunsPath()
+	if err != nil {
+		return err
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return err
+	}
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readAutomationRuns returns every recorded run, oldest first. Unparseable
+// lines are skipped.
+func readAutomationRuns() ([]automationRun, error) {
+	path, err := automationRunsPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []automationRun{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	runs := []automationRun{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var run automationRun
+		if err := json.Unmarshal(sc.Bytes(), &run); err != nil {
+			debugf("automation: skipping run line: %v", err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// automationRunFailure names the first failing step of a run and its error,
+// "2:volume" style, or returns empty strings for a successful run.
+func automationRunFailure(run automationRun) (string, string) {
+	for _, st := range run.Steps {
+		if !st.OK && !st.Skipped {
+			return fmt.Sprintf("%d:%s", st.Index+1, st.Type), st.Error
+		}
+	}
+	return "", ""
+}
+
+func cmdAutomationHistory(args []string) {
+	const usageLine = "usage: homepodctl automation history [--name <string>] [--limit N] [--json] [--plain]"
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("%s", usageLine))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	limit := 20
+	if n, ok, err := flags.intStrict("limit"); err != nil {
+		die(err)
+	} else if ok {
+		if n < 0 {
+			die(usageErrf("--limit must be >= 0"))
+		}
+		limit = n
+	}
+	name := strings.TrimSpace(flags.string("name"))
+	runs, err := readAutomationRuns()
+	if err != nil {
+		die(err)
+	}
+	if name != "" {
+		matched := []automationRun{}
+		for _, run := range runs {
+			if run.Name == name {
+				matched = append(matched, run)
+			}
+		}
+		runs = matched
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[len(runs)-limit:]
+	}
+	if jsonOut {
+		writeJSON(runs)
+		return
+	}
+	if len(runs) == 0 {
+		if !quiet {
+			path, _ := automationRunsPath()
+			fmt.Printf("No automation runs yet (%s)\n", path)
+		}
+		return
+	}
+	printAutomationHistoryTable(os.Stdout, runs, plain)
+}
+
+func printAutomationHistoryTable(w io.Writer, runs []automationRun, plain bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "TIME\tNAME\tSTEPS\tRESULT\tDURATION")
+	}
+	for _, run := range runs {
+		result := "ok"
+		if !run.OK {
+			result = "failed"
+			if step, msg := automationRunFailure(run); step != "" {
+				result += " at " + step
+				if msg != "" {
+					result += ": " + msg
+				}
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%dms\n", run.StartedAt, run.Name, len(run.Steps), result, run.DurationMS)
+	}
+	_ = tw.Flush()
+}
+
+// automationStatusRows folds the run log into the last run of each routine,
+// sorted by name.
+func automationStatusRows(runs []automationRun) []automationStatusRow {
+	byName := map[string]*automationStatusRow{}
+	for _, run := range runs {
+		row := byName[run.Name]
+		if row == nil {
+			row = &automationStatusRow{Name: run.Name}
+			byName[run.Name] = row
+		}
+		row.Runs++
+		if !run.OK {
+			row.Failures++
+		}
+		row.Source = run.Source
+		row.LastRun = run.StartedAt
+		row.OK = run.OK
+		row.DurationMS = run.DurationMS
+		row.FailedStep, row.Error = automationRunFailure(run)
+	}
+	rows := make([]automationStatusRow, 0, len(byName))
+	for _, row := range byName {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+	return rows
+}
+
+func cmdAutomationStatus(args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl automation status [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	runs, err := readAutomationRuns()
+	if err != nil {
+		die(err)
+	}
+	rows := automationStatusRows(runs)
+	if jsonOut {
+		writeJSON(rows)
+		return
+	}
+	if len(rows) == 0 {
+		if !quiet {
+			path, _ := automationRunsPath()
+			fmt.Printf("No automation runs yet (%s)\n", path)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "NAME\tLAST RUN\tRESULT\tDURATION\tRUNS\tFAILURES")
+	}
+	for _, row := range rows {
+		result := "ok"
+		if !row.OK {
+			result = "failed"
+			if row.FailedStep != "" {
+				result += " at " + row.FailedStep
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%dms\t%d\t%d\n", row.Name, row.LastRun, result, row.DurationMS, row.Runs, row.Failures)
+	}
+	_ = tw.Flush()
+}
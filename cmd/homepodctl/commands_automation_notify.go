@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	maxWebhookTimeout     = 2 * time.Minute
+	maxWebhookRetries     = 5
+)
+
+var webhookClient = &http.Client{}
+
+// automationTemplateData is what notify, webhook, and shortcut templates see:
+// the status --format fields plus the routine's name.
+type automationTemplateData struct {
+	statusTemplateData
+	Automation string
+}
+
+func parseAutomationTemplate(s string) (*template.Template, error) {
+	return template.New("step").Funcs(statusTemplateFuncs).Parse(s)
+}
+
+// automationTemplates lists the templated strings of a notify or webhook
+// step: title and message, or every string in the payload.
+func automationTemplates(st automationStep) []string {
+	if st.Type == "notify" {
+		return []string{st.Title, st.Message}
+	}
+	var out []string
+	walkPayloadStrings(st.Payload, func(s string) string {
+		out = append(out, s)
+		return s
+	})
+	return out
+}
+
+// walkPayloadStrings calls fn on every string in a decoded JSON/YAML value
+// and returns a copy with the strings replaced by fn's results.
+func walkPayloadStrings(v any, fn func(string) string) any {
+	switch v := v.(type) {
+	case string:
+		return fn(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = walkPayloadStrings(e, fn)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = walkPayloadStrings(e, fn)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// automationTemplateRenderer renders step templates against the player
+// status, which it reads at most once and only when a template needs it.
+// A status error is not fatal: the templates see an empty player instead.
+type automationTemplateRenderer struct {
+	ctx    context.Context
+	name   string
+	status *statusResult
+}
+
+func (r *automationTemplateRenderer) statusResult() statusResult {
+	if r.status == nil {
+		res, err := collectStatus(r.ctx)
+		if err != nil {
+			debugf("automation: status for templates: %v", err)
+		}
+		r.status = &res
+	}
+	return *r.status
+}
+
+func (r *automationTemplateRenderer) render(s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := parseAutomationTemplate(s)
+	if err != nil {
+		return "", err
+	}
+	res := r.statusResult()
+	data := automationTemplateData{
+		statusTemplateData: statusTemplateData{
+			OK:          res.OK,
+			PlayerState: res.Player,
+			Outputs:     res.Outputs,
+			Route:       res.Route,
+			Connection:  res.Connection,
+		},
+		Automation: r.name,
+	}
+	if res.Track != nil {
+		data.Track = *res.Track
+	}
+	if res.Source != nil {
+		data.Source = *res.Source
+	}
+	if res.Volume != nil {
+		data.Volume = *res.Volume
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func executeAutomationNotify(ctx context.Context, name string, st automationStep) error {
+	r := &automationTemplateRenderer{ctx: ctx, name: name}
+	title := st.Title
+	if strings.TrimSpace(title) == "" {
+		title = name
+	}
+	title, err := r.render(title)
+	if err != nil {
+		return fmt.Errorf("notify title: %w", err)
+	}
+	message, err := r.render(st.Message)
+	if err != nil {
+		return fmt.Errorf("notify message: %w", err)
+	}
+	return postNotification(ctx, native.Notification{Title: title, Message: message})
+}
+
+// executeAutomationShortcut runs a Shortcuts shortcut, such as a lights or
+// blinds scene, passing the rendered input as its text input.
+func executeAutomationShortcut(ctx context.Context, name string, st automationStep) error {
+	r := &automationTemplateRenderer{ctx: ctx, name: name}
+	input, err := r.render(st.Input)
+	if err != nil {
+		return fmt.Errorf("shortcut input: %w", err)
+	}
+	out, err := runNativeShortcutWithInput(ctx, strings.TrimSpace(st.Name), input)
+	if err != nil {
+		return err
+	}
+	debugf("automation: shortcut %q output=%q", st.Name, out)
+	return nil
+}
+
+// executeAutomationWebhook POSTs the step's payload as JSON, or the routine
+// name and player status when it has none. Network errors, 429s, and 5xx
+// responses are retried up to st.Retries times with a growing pause.
+func executeAutomationWebhook(ctx context.Context, name string, st automationStep) error {
+	r := &automationTemplateRenderer{ctx: ctx, name: name}
+	var payload any
+	if st.Payload == nil {
+		payload = map[string]any{"automation": name, "status": r.statusResult()}
+	} else {
+		var renderErr error
+		payload = walkPayloadStrings(st.Payload, func(s string) string {
+			out, err := r.render(s)
+			if err != nil && renderErr == nil {
+				renderErr = err
+			}
+			return out
+		})
+		if renderErr != nil {
+			return fmt.Errorf("webhook payload: %w", renderErr)
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("webhook payload: %w", err)
+	}
+	timeout := defaultWebhookTimeout
+	if strings.TrimSpace(st.Timeout) != "" {
+		if timeout, err = time.ParseDuration(st.Timeout); err != nil {
+			return err
+		}
+	}
+	retries := 0
+	if st.Retries != nil {
+		retries = *st.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := postWebhook(ctx, st.URL, body, timeout)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		debugf("webhook: attempt %d: %v", attempt+1, err)
+		sleepFn(time.Duration(attempt+1) * time.Second)
+	}
+}
+
+// postWebhook sends one request and reports whether a failure is worth
+// retrying.
+func postWebhook(ctx context.Context, target string, body []byte, timeout time.Duration) (bool, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("POST %s: invalid URL", redactWebhookURL(target))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "homepodctl/"+version)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		// *url.Error quotes the full URL, token and all.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = redactWebhookURL(uerr.URL)
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("POST %s: %s", redactWebhookURL(target), resp.Status)
+}
+
+// redactWebhookURL drops the query string, where webhook tokens often live.
+func redactWebhookURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	u.RawQuery = ""
+	u.User = nil
+	return u.String()
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expected an http or https URL")
+	}
+	return nil
+}
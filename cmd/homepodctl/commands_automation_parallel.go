@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+const (
+	defaultParallelConcurrency = 4
+	maxParallelConcurrency     = 16
+)
+
+func parallelConcurrency(st automationStep) int {
+	if st.Concurrency != nil {
+		return *st.Concurrency
+	}
+	return defaultParallelConcurrency
+}
+
+// parallelFailOn is "any" (the block fails when a branch fails) or "all" (it
+// fails only when every branch does).
+func parallelFailOn(st automationStep) string {
+	if st.FailOn == "" {
+		return "any"
+	}
+	return st.FailOn
+}
+
+// executeAutomationParallel runs a parallel block's steps on at most
+// concurrency workers. Every branch runs to completion whatever the others
+// do, and each reports its own result and timing.
+func executeAutomationParallel(ctx context.Context, cfg *native.Config, name string, defaults automationDefaults, st automationStep) ([]automationStepResult, error) {
+	branches := make([]automationStepResult, len(st.Steps))
+	sem := make(chan struct{}, parallelConcurrency(st))
+	var wg sync.WaitGroup
+	for i, b := range st.Steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			err := executeAutomationStep(ctx, cfg, name, defaults, b)
+			res := automationStepResult{Index: i, Type: b.Type, Input: redactStepInput(b), OK: err == nil, DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				res.Error = err.Error()
+			}
+			branches[i] = res
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, b := range branches {
+		if !b.OK {
+			failed++
+		}
+	}
+	if failed == 0 || (parallelFailOn(st) == "all" && failed < len(branches)) {
+		return branches, nil
+	}
+	return branches, fmt.Errorf("parallel: %d of %d branches failed", failed, len(branches))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// automationPreflight is what --resolve live found for one step by reading
+// Music.app: the playlist or station a play step would start, the rooms it targets, and
+// the volume changes it would make. Issues are what would make the step
+// fail.
+type automationPreflight struct {
+	Playlist *preflightPlaylist `json:"playlist,omitempty"`
+	Station  *preflightPlaylist `json:"station,omitempty"`
+	Rooms    []preflightRoom    `json:"rooms,omitempty"`
+	Volumes  []preflightVolume  `json:"volumes,omitempty"`
+	Issues   []string           `json:"issues,omitempty"`
+}
+
+type preflightPlaylist struct {
+	Query    string `json:"query,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Matches  int    `json:"matches"`
+	Resolved bool   `json:"resolved"`
+}
+
+type preflightRoom struct {
+	Room      string `json:"room"`
+	Device    string `json:"device,omitempty"`
+	Exists    bool   `json:"exists"`
+	Available bool   `json:"available"`
+	Selected  bool   `json:"selected"`
+}
+
+// preflightVolume is a predicted volume change. Limit describes the cap
+// that holds To below the requested level, if any.
+type preflightVolume struct {
+	Room  string `json:"room"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Limit string `json:"limit,omitempty"`
+}
+
+// automationLive is the Music.app state a live plan reads once and then
+// carries from step to step, so a volume.set after a play starts from the
+// level the play would leave.
+type automationLive struct {
+	cfg     *native.Config
+	devices []music.AirPlayDevice
+	volumes map[string]int
+}
+
+// preflightAutomation plans doc like --dry-run and checks each step against
+// live state without changing anything. ok is false when any step has
+// issues.
+func preflightAutomation(ctx context.Context, cfg *native.Config, doc *automationFile) ([]automationStepResult, bool, error) {
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	live := &automationLive{cfg: cfg, devices: devs, volumes: map[string]int{}}
+	for _, d := range devs {
+		live.volumes[d.Name] = d.Volume
+	}
+	defaults := resolveAutomationDefaults(cfg, doc.Defaults)
+	steps := resolveAutomationSteps(cfg, doc)
+	ok := true
+	for i := range steps {
+		if !live.check(ctx, defaults, &steps[i], doc.Steps[i]) {
+			ok = false
+		}
+	}
+	return steps, ok, nil
+}
+
+// check fills in res.Preflight for st and reports whether it has no issues.
+func (l *automationLive) check(ctx context.Context, defaults automationDefaults, res *automationStepResult, st automationStep) bool {
+	if st.Type == "parallel" {
+		ok := true
+		for j := range res.Branches {
+			if !l.check(ctx, defaults, &res.Branches[j], st.Steps[j]) {
+				ok = false
+			}
+		}
+		res.OK = ok
+		return ok
+	}
+	p := &automationPreflight{}
+	airplay := defaults.Backend == "" || defaults.Backend == "airplay"
+	switch st.Type {
+	case "out.set":
+		l.checkRooms(p, l.cfg.ExpandRooms(st.Rooms))
+		l.selectOnly(p.Rooms)
+	case "play":
+		if strings.TrimSpace(st.Station) != "" {
+			p.Station = l.checkStation(ctx, p, st.Station)
+		} else {
+			p.Playlist = l.checkPlaylist(ctx, p, st)
+		}
+		// Without rooms an airplay play keeps whatever is selected, so
+		// there is nothing to check when nothing is.
+		rooms := defaults.Rooms
+		if airplay {
+			rooms = l.targetRooms(rooms)
+		}
+		if airplay && len(rooms) > 0 {
+			l.checkRooms(p, rooms)
+			if defaults.Volume != nil && len(defaults.Rooms) > 0 {
+				l.predictVolumes(p, *defaults.Volume, st.Force)
+			}
+		}
+		for _, q := range activeQuietHours(l.cfg, rooms) {
+			if q.Play == "block" && !st.Force {
+				p.Issues = append(p.Issues, fmt.Sprintf("quiet hours %s (%s) block play in %s", q.Name, q.Window, strings.Join(q.Rooms, ", ")))
+			}
+		}
+	case "volume.set":
+		rooms := l.cfg.ExpandRooms(st.Rooms)
+		if len(rooms) == 0 {
+			rooms = defaults.Rooms
+		}
+		if airplay {
+			rooms = l.targetRooms(rooms)
+			l.checkRooms(p, rooms)
+			if st.Value != nil {
+				l.predictVolumes(p, *st.Value, st.Force)
+			}
+		}
+	default:
+		return true
+	}
+	res.Preflight = p
+	if len(p.Issues) > 0 {
+		res.OK = false
+		res.Error = strings.Join(p.Issues, "; ")
+		return false
+	}
+	return true
+}
+
+// targetRooms is rooms, or the currently selected outputs when rooms is
+// empty, as the airplay steps fall back to.
+func (l *automationLive) targetRooms(rooms []string) []string {
+	if len(rooms) > 0 {
+		return rooms
+	}
+	var selected []string
+	for _, d := range l.devices {
+		if d.Selected {
+			selected = append(selected, d.Name)
+		}
+	}
+	return selected
+}
+
+// selectOnly updates the devices to the selection an out.set of rooms
+// leaves, for the steps after it.
+func (l *automationLive) selectOnly(rooms []preflightRoom) {
+	for i := range l.devices {
+		l.devices[i].Selected = false
+		for _, r := range rooms {
+			if r.Device == l.devices[i].Name {
+				l.devices[i].Selected = true
+			}
+		}
+	}
+}
+
+func (l *automationLive) checkRooms(p *automationPreflight, rooms []string) {
+	if len(rooms) == 0 {
+		p.Issues = append(p.Issues, "no rooms (none given and no AirPlay outputs selected)")
+		return
+	}
+	for _, room := range rooms {
+		r := preflightRoom{Room: room}
+		name, err := music.ResolveRoom(room, l.devices, false)
+		if err != nil {
+			p.Issues = append(p.Issues, err.Error())
+			p.Rooms = append(p.Rooms, r)
+			continue
+		}
+		r.Device, r.Exists = name, true
+		for _, d := range l.devices {
+			if d.Name == name {
+				r.Available, r.Selected = d.Available, d.Selected
+			}
+		}
+		if !r.Available {
+			p.Issues = append(p.Issues, fmt.Sprintf("%s is not available", name))
+		}
+		p.Rooms = append(p.Rooms, r)
+	}
+}
+
+func (l *automationLive) checkPlaylist(ctx context.Context, p *automationPreflight, st automationStep) *preflightPlaylist {
+	if id := strings.TrimSpace(st.PlaylistID); id != "" {
+		pl := &preflightPlaylist{ID: id}
+		name, err := findPlaylistNameByID(ctx, id)
+		if err != nil {
+			p.Issues = append(p.Issues, fmt.Sprintf("playlistId %s: %v", id, err))
+			return pl
+		}
+		pl.Name, pl.Matches, pl.Resolved = name, 1, true
+		return pl
+	}
+	pl := &preflightPlaylist{Query: st.Query}
+	matches, err := searchPlaylists(ctx, st.Query)
+	if err != nil {
+		p.Issues = append(p.Issues, fmt.Sprintf("playlist query %q: %v", st.Query, err))
+		return pl
+	}
+	pl.Matches = len(matches)
+	best, ok := music.PickBestPlaylist(st.Query, matches)
+	if !ok {
+		p.Issues = append(p.Issues, fmt.Sprintf("no playlists match %q", st.Query))
+		return pl
+	}
+	pl.ID, pl.Name, pl.Resolved = best.PersistentID, best.Name, true
+	return pl
+}
+
+func (l *automationLive) checkStation(ctx context.Context, p *automationPreflight, query string) *preflightPlaylist {
+	s := &preflightPlaylist{Query: query}
+	station, err := resolveStation(ctx, query)
+	if err != nil {
+		p.Issues = append(p.Issues, err.Error())
+		return s
+	}
+	s.ID, s.Name, s.Matches, s.Resolved = station.PersistentID, station.Name, 1, true
+	return s
+}
+
+// predictVolumes records the changes setting p's rooms to value would make,
+// with the same per-room offsets and caps as setVolumeForRooms.
+func (l *automationLive) predictVolumes(p *automationPreflight, value int, force bool) {
+	for _, r := range p.Rooms {
+		if !r.Exists {
+			continue
+		}
+		to := l.cfg.AdjustVolume(r.Room, value)
+		v := preflightVolume{Room: r.Device, From: l.volumes[r.Device], To: to}
+		if limit, quiet, ok := volumeLimit(l.cfg, r.Room); ok && !force && to > limit {
+			v.To, v.Limit = limit, limitLabel(limit, quiet)
+		}
+		l.volumes[r.Device] = v.To
+		p.Volumes = append(p.Volumes, v)
+	}
+}
+
+// printPreflight prints a step's live findings under its plan line.
+func printPreflight(indent string, p *automationPreflight) {
+	if p == nil {
+		return
+	}
+	if pl := p.Playlist; pl != nil && pl.Resolved {
+		fmt.Printf("%splaylist=%q id=%s matches=%d\n", indent, pl.Name, pl.ID, pl.Matches)
+	}
+	if s := p.Station; s != nil && s.Resolved {
+		fmt.Printf("%sstation=%q id=%s\n", indent, s.Name, s.ID)
+	}
+	for _, r := range p.Rooms {
+		if r.Exists {
+			fmt.Printf("%sroom=%q available=%t selected=%t\n", indent, r.Device, r.Available, r.Selected)
+		}
+	}
+	for _, v := range p.Volumes {
+		line := fmt.Sprintf("%svolume %s %d -> %d", indent, v.Room, v.From, v.To)
+		if v.Limit != "" {
+			line += " (" + v.Limit + ")"
+		}
+		fmt.Println(line)
+	}
+	for _, issue := range p.Issues {
+		fmt.Printf("%sissue: %s\n", indent, issue)
+	}
+}
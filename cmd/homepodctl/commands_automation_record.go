@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/state"
+	"gopkg.in/yaml.v3"
+)
+
+// automationRecording is the recording in progress, kept in the state
+// directory between `automation record --out` and `automation record --stop`.
+type automationRecording struct {
+	Out       string `json:"out"`
+	Name      string `json:"name"`
+	StartedAt string `json:"startedAt"`
+}
+
+type automationRecordResult struct {
+	OK        bool     `json:"ok"`
+	Action    string   `json:"action"`
+	Out       string   `json:"out"`
+	Name      string   `json:"name"`
+	StartedAt string   `json:"startedAt"`
+	Steps     int      `json:"steps"`
+	Skipped   []string `json:"skipped,omitempty"`
+	// Content is the routine when it goes to stdout (--out -) with --json.
+	Content string `json:"content,omitempty"`
+}
+
+func defaultAutomationRecordingPath() (string, error) {
+	return state.Path("automation-recording.json")
+}
+
+func loadAutomationRecording() (*automationRecording, error) {
+	path, err := automationRecordingPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rec automationRecording
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("read recording %s: %w", path, err)
+	}
+	return &rec, nil
+}
+
+func saveAutomationRecording(rec automationRecording) error {
+	path, err := automationRecordingPath()
+	if err != nil {
+		return err
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return err
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func clearAutomationRecording() error {
+	path, err := automationRecordingPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func cmdAutomationRecord(args []string) {
+	const usageLine = "usage: homepodctl automation record --out <file|-> [--name <string>] | --stop | --cancel [--json]"
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("%s", usageLine))
+	}
+	jsonOut, _, err := flags.boolStrict("json")
+	if err != nil {
+		die(err)
+	}
+	stop, _, err := flags.boolStrict("stop")
+	if err != nil {
+		die(err)
+	}
+	cancel, _, err := flags.boolStrict("cancel")
+	if err != nil {
+		die(err)
+	}
+	out := strings.TrimSpace(flags.string("out"))
+	if (stop && cancel) || ((stop || cancel) && out != "") || (!stop && !cancel && out == "") {
+		die(usageErrf("%s", usageLine))
+	}
+	rec, err := loadAutomationRecording()
+	if err != nil {
+		die(err)
+	}
+
+	var res automationRecordResult
+	var content []byte
+	switch {
+	case stop || cancel:
+		if rec == nil {
+			die(usageErrf("not recording (start with `homepodctl automation record --out <file>`)"))
+		}
+		res = automationRecordResult{OK: true, Action: "record.cancel", Out: rec.Out, Name: rec.Name, StartedAt: rec.StartedAt}
+		if stop {
+			res.Action = "record.stop"
+			if content, res.Steps, res.Skipped, err = finishAutomationRecording(*rec); err != nil {
+				die(err)
+			}
+		}
+		if err := clearAutomationRecording(); err != nil {
+			die(err)
+		}
+	default:
+		if rec != nil {
+			die(usageErrf("already recording to %s since %s (finish with --stop or drop it with --cancel)", rec.Out, rec.StartedAt))
+		}
+		if out != "-" {
+			if out, err = filepath.Abs(expandHomePath(out)); err != nil {
+				die(err)
+			}
+		}
+		name := strings.TrimSpace(flags.string("name"))
+		if name == "" {
+			name = "recorded"
+			if out != "-" {
+				name = strings.TrimSuffix(filepath.Base(out), filepath.Ext(out))
+			}
+		}
+		rec := automationRecording{Out: out, Name: name, StartedAt: time.Now().UTC().Format(time.RFC3339)}
+		if err := saveAutomationRecording(rec); err != nil {
+			die(err)
+		}
+		res = automationRecordResult{OK: true, Action: "record.start", Out: rec.Out, Name: rec.Name, StartedAt: rec.StartedAt}
+	}
+
+	if jsonOut {
+		if res.Out == "-" {
+			res.Content = string(content)
+		}
+		writeJSON(res)
+		return
+	}
+	for _, s := range res.Skipped {
+		fmt.Fprintf(os.Stderr, "warning: skipped %s\n", s)
+	}
+	if res.Out == "-" && content != nil {
+		fmt.Print(string(content))
+		return
+	}
+	if quiet {
+		return
+	}
+	switch res.Action {
+	case "record.start":
+		fmt.Printf("recording to %s; run homepodctl commands, then `homepodctl automation record --stop`\n", res.Out)
+	case "record.stop":
+		fmt.Printf("wrote %s (%d steps)\n", res.Out, res.Steps)
+	default:
+		fmt.Printf("recording to %s cancelled\n", res.Out)
+	}
+}
+
+// finishAutomationRecording turns the commands history recorded since rec
+// started into an automation file, writes it to rec.Out unless that is "-",
+// and returns it with its step count and the commands it skipped.
+func finishAutomationRecording(rec automationRecording) ([]byte, int, []string, error) {
+	started, err := time.Parse(time.RFC3339, rec.StartedAt)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("read recording: startedAt: %w", err)
+	}
+	entries, err := readHistory(0)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	var since []historyEntry
+	for _, e := range entries {
+		if t, err := time.Parse(time.RFC3339, e.Time); err == nil && !t.Before(started) {
+			since = append(since, e)
+		}
+	}
+	steps, skipped := recordedSteps(since)
+	if len(steps) == 0 {
+		return nil, 0, skipped, usageErrf("nothing to record since %s (run play, volume, out, or transport commands first, or drop the recording with --cancel)", rec.StartedAt)
+	}
+	doc := &automationFile{Version: "1", Name: rec.Name, Steps: steps}
+	if err := validateAutomation(doc); err != nil {
+		return nil, 0, skipped, err
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, 0, skipped, fmt.Errorf("encode recording: %w", err)
+	}
+	if rec.Out != "-" {
+		if err := os.WriteFile(rec.Out, b, 0o644); err != nil {
+			return nil, 0, skipped, err
+		}
+	}
+	return b, len(steps), skipped, nil
+}
+
+// recordedSteps converts successful history entries into automation steps.
+// Volumes are recorded as the levels the rooms ended at, so relative changes
+// replay as absolute ones. Commands with no step equivalent are returned as
+// skipped.
+func recordedSteps(entries []historyEntry) ([]automationStep, []string) {
+	var steps []automationStep
+	var skipped []string
+	for _, e := range entries {
+		if !e.OK {
+			continue
+		}
+		command := strings.TrimSpace(e.Command + " " + strings.Join(e.Args, " "))
+		got, ok := recordedEntrySteps(e)
+		if !ok {
+			skipped = append(skipped, command)
+			continue
+		}
+		steps = append(steps, got...)
+	}
+	return steps, skipped
+}
+
+func recordedEntrySteps(e historyEntry) ([]automationStep, bool) {
+	switch e.Command {
+	case "pause", "stop", "resume", "next", "prev":
+		// pause --room and the like change the outputs, which no step does
+		// incrementally.
+		if flags, _, err := parseArgs(e.Args); err != nil || len(flags.strings("room")) > 0 {
+			return nil, false
+		}
+		if e.Command == "resume" {
+			return []automationStep{{Type: "transport", Action: "play"}}, true
+		}
+		return []automationStep{{Type: "transport", Action: e.Command}}, true
+	case "shuffle":
+		var r playbackModeResult
+		if err := json.Unmarshal(e.Result, &r); err != nil {
+			return nil, false
+		}
+		return []automationStep{{Type: "shuffle.set", Enabled: r.Shuffle, Mode: r.ShuffleMode}}, r.Shuffle != nil
+	}
+
+	var r actionResult
+	if err := json.Unmarshal(e.Result, &r); err != nil || (r.Backend != "" && r.Backend != "airplay") {
+		return nil, false
+	}
+	switch e.Command {
+	case "out":
+		if len(r.Rooms) == 0 {
+			return nil, false
+		}
+		return []automationStep{{Type: "out.set", Rooms: r.Rooms}}, true
+	case "play":
+		if r.Playlist == "" && r.PlaylistID == "" {
+			return nil, false
+		}
+		var steps []automationStep
+		if len(r.Rooms) > 0 {
+			steps = append(steps, automationStep{Type: "out.set", Rooms: r.Rooms})
+		}
+		flags, _, _ := parseArgs(e.Args)
+		if v, err := strconv.Atoi(strings.TrimSpace(flags.string("volume"))); err == nil && len(r.Rooms) > 0 {
+			steps = append(steps, automationStep{Type: "volume.set", Value: intPtr(v), Rooms: r.Rooms})
+		}
+		if on, ok := flags.bool("shuffle"); ok {
+			steps = append(steps, automationStep{Type: "shuffle.set", Enabled: boolPtr(on)})
+		}
+		play := automationStep{Type: "play", Query: r.Playlist}
+		if play.Query == "" {
+			play.PlaylistID = r.PlaylistID
+		}
+		return append(steps, play), true
+	case "mute":
+		if len(r.Rooms) == 0 {
+			return nil, false
+		}
+		return []automationStep{{Type: "volume.set", Value: intPtr(0), Rooms: r.Rooms}}, true
+	case "volume", "vol", "unmute":
+		return recordedVolumeSteps(r)
+	}
+	return nil, false
+}
+
+// recordedVolumeSteps reads the rooms' levels after a volume change from its
+// now-playing snapshot, one volume.set per distinct level.
+func recordedVolumeSteps(r actionResult) ([]automationStep, bool) {
+	if r.NowPlaying == nil || len(r.Rooms) == 0 {
+		return nil, false
+	}
+	levels := map[string]int{}
+	for _, d := range r.NowPlaying.Outputs {
+		levels[strings.ToLower(d.Name)] = d.Volume
+	}
+	var steps []automationStep
+	byLevel := map[int]int{}
+	for _, room := range r.Rooms {
+		v, ok := levels[strings.ToLower(room)]
+		if !ok {
+			return nil, false
+		}
+		if i, ok := byLevel[v]; ok {
+			steps[i].Rooms = append(steps[i].Rooms, room)
+			continue
+		}
+		byLevel[v] = len(steps)
+		steps = append(steps, automationStep{Type: "volume.set", Value: intPtr(v), Rooms: []string{room}})
+	}
+	return steps, true
+}
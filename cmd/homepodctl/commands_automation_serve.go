@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+const defaultAutomationServeAddr = "127.0.0.1:8765"
+
+// routineExts are the automation file names serve looks for, in order.
+var routineExts = []string{".yaml", ".yml", ".json"}
+
+var errRoutineNotFound = errors.New("routine not found")
+
+// routineRow is one runnable routine as GET /routines reports it.
+type routineRow struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// automationServer runs routines (config scenes, then automation files in
+// dir) for HTTP callers. Runs are serialized so two routines never fight over
+// the same outputs.
+type automationServer struct {
+	ctx    context.Context
+	cfg    *native.Config
+	dir    string
+	auth   serveAuth
+	dryRun bool
+	mu     sync.Mutex
+}
+
+func cmdAutomationServe(ctx context.Context, cfg *native.Config, args []string) {
+	const usageLine = "usage: homepodctl automation serve [--listen <host:port>] [--token <secret>] [--dir <dir>] [--dry-run]"
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("%s", usageLine))
+	}
+	addr := strings.TrimSpace(flags.string("listen"))
+	if addr == "" {
+		addr = defaultAutomationServeAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		die(usageErrf("invalid --listen %q (expected host:port or :port)", addr))
+	}
+	token, tokenPath, err := loadServeToken(flags.string("token"), "HOMEPODCTL_SERVE_TOKEN", "serve-token")
+	if err != nil {
+		die(err)
+	}
+	dir := strings.TrimSpace(flags.string("dir"))
+	if dir == "" {
+		if dir, err = defaultRoutinesDir(); err != nil {
+			die(err)
+		}
+	}
+	dryRun, _, err := flags.boolStrict("dry-run")
+	if err != nil {
+		die(err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		die(err)
+	}
+	if !quiet {
+		fmt.Printf("automation: serving http://%s/run/<routine> (routines: scenes, %s)\n", ln.Addr(), dir)
+		if tokenPath != "" {
+			fmt.Printf("automation: bearer token in %s\n", tokenPath)
+		}
+	}
+	if cfg == nil {
+		cfg = &native.Config{}
+	}
+	// Runs outlive the command timeout and the caller's connection: a routine
+	// that has started is not stopped halfway because the client hung up.
+	s := &automationServer{ctx: context.WithoutCancel(ctx), cfg: cfg, dir: dir, auth: serveAuth{token: token, loopbackOnly: isLoopbackHost(host)}, dryRun: dryRun || dryRunAll}
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.Serve(ln); err != nil {
+		die(err)
+	}
+}
+
+// defaultRoutinesDir is the routines directory next to config.json.
+func defaultRoutinesDir() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "routines"), nil
+}
+
+func (s *automationServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /run/{routine}", s.authorize(s.handleRun))
+	mux.HandleFunc("GET /routines", s.authorize(s.handleRoutines))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "homepodctl automation server: POST /run/<routine>, GET /routines")
+	})
+	return mux
+}
+
+// authorize requires "Authorization: Bearer <token>", a Host naming this
+// machine, and no foreign Origin; see serveAuth.
+func (s *automationServer) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.auth.check(r); err != nil {
+			status := s.auth.status(err)
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="homepodctl"`)
+			}
+			writeServeError(w, status, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *automationServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("routine")
+	dryRun := s.dryRun
+	if raw := r.URL.Query().Get("dryRun"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeServeError(w, http.StatusBadRequest, usageErrf("invalid dryRun %q (expected true or false)", raw))
+			return
+		}
+		dryRun = dryRun || v
+	}
+	doc, source, err := s.findRoutine(name)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, errRoutineNotFound) {
+			status = http.StatusNotFound
+		}
+		writeServeError(w, status, err)
+		return
+	}
+	debugf("automation serve: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	var result automationCommandResult
+	if dryRun {
+		result = buildAutomationResult("dry-run", doc, resolveAutomationSteps(s.cfg, doc))
+	} else {
+		result = s.run(doc, source)
+	}
+	if !quiet {
+		fmt.Printf("%s run %q mode=%s ok=%t durationMs=%d\n", time.Now().UTC().Format(time.RFC3339), name, result.Mode, result.OK, result.DurationMS)
+	}
+	status := http.StatusOK
+	if !result.OK {
+		status = http.StatusInternalServerError
+	}
+	writeServeJSON(w, status, result)
+}
+
+// run runs one routine at a time; the deferred unlock keeps a panicking run
+// from leaving the server stuck.
+func (s *automationServer) run(doc *automationFile, source string) automationCommandResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(s.ctx, longCommandTimeout)
+	defer cancel()
+	return runAutomation(ctx, s.cfg, doc, source)
+}
+
+func (s *automationServer) handleRoutines(w http.ResponseWriter, r *http.Request) {
+	rows := []routineRow{}
+	seen := map[string]bool{}
+	for _, name := range sceneNames(s.cfg) {
+		rows = append(rows, routineRow{Name: name, Source: "scene"})
+		seen[name] = true
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		writeServeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var files []routineRow
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		name := strings.TrimSuffix(e.Name(), ext)
+		if e.IsDir() || !isRoutineExt(ext) || !validRoutineName(name) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		files = append(files, routineRow{Name: name, Source: filepath.Join(s.dir, e.Name())})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	writeServeJSON(w, http.StatusOK, append(rows, files...))
+}
+
+// findRoutine resolves name to a validated document: a scene in config.json,
+// else <dir>/<name>.yaml, .yml, or .json. Files are read on every request,
+// so edits take effect without a restart.
+func (s *automationServer) findRoutine(name string) (*automationFile, string, error) {
+	if !validRoutineName(name) {
+		return nil, "", fmt.Errorf("%w: %q", errRoutineNotFound, name)
+	}
+	if _, ok := s.cfg.Scenes[name]; ok {
+		doc, err := sceneAutomation(s.cfg, name)
+		return doc, "scene", err
+	}
+	for _, ext := range routineExts {
+		path := filepath.Join(s.dir, name+ext)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		doc, err := loadAutomationFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := validateAutomation(doc); err != nil {
+			return nil, "", err
+		}
+		return doc, path, nil
+	}
+	return nil, "", fmt.Errorf("%w: %q (no scene or file in %s)", errRoutineNotFound, name, s.dir)
+}
+
+// validRoutineName keeps routine names to a single path element.
+func validRoutineName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+func isRoutineExt(ext string) bool {
+	for _, e := range routineExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func writeServeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// writeServeError reports err in the same shape --json errors take on stderr.
+func writeServeError(w http.ResponseWriter, status int, err error) {
+	writeServeJSON(w, status, jsonErrorResponse{Error: jsonErrorPayload{
+		Code:     classifyErrorCode(err),
+		Message:  formatError(err),
+		ExitCode: classifyExitCode(err),
+	}})
+}
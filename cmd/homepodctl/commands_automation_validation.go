@@ -97,11 +97,19 @@ func validateAutomationDefaults(path string, d automationDefaults) error {
 }
 
 func validateAutomationStep(i int, st automationStep) error {
-	path := fmt.Sprintf("steps[%d]", i)
+	return validateAutomationStepAt(fmt.Sprintf("steps[%d]", i), st)
+}
+
+// validateAutomationStepAt validates st, naming fields under path (steps[2],
+// or steps[2].steps[0] inside a parallel block).
+func validateAutomationStepAt(path string, st automationStep) error {
 	t := strings.TrimSpace(st.Type)
 	if t == "" {
 		return automationValidationErrf("%s.type: required", path)
 	}
+	if st.Synchronized && t != "play" {
+		return automationValidationErrf("%s.synchronized: only valid for play", path)
+	}
 	switch t {
 	case "out.set":
 		if len(st.Rooms) == 0 {
@@ -113,10 +121,14 @@ func validateAutomationStep(i int, st automationStep) error {
 			}
 		}
 	case "play":
-		hasQ := strings.TrimSpace(st.Query) != ""
-		hasID := strings.TrimSpace(st.PlaylistID) != ""
-		if hasQ == hasID {
-			return automationValidationErrf("%s: play requires exactly one of query or playlistId", path)
+		set := 0
+		for _, v := range []string{st.Query, st.PlaylistID, st.Station} {
+			if strings.TrimSpace(v) != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return automationValidationErrf("%s: play requires exactly one of query, playlistId, or station", path)
 		}
 	case "volume.set":
 		if st.Value == nil {
@@ -125,11 +137,30 @@ func validateAutomationStep(i int, st automationStep) error {
 		if *st.Value < 0 || *st.Value > 100 {
 			return automationValidationErrf("%s.value: expected 0..100", path)
 		}
+	case "duck":
+		if st.Value != nil && (*st.Value < 0 || *st.Value > 100) {
+			return automationValidationErrf("%s.value: expected 0..100", path)
+		}
+		if raw := strings.TrimSpace(st.For); raw != "" {
+			if d, err := time.ParseDuration(raw); err != nil || d <= 0 {
+				return automationValidationErrf("%s.for: expected a duration like 30s or 10m", path)
+			}
+		}
+	case "unduck":
 	case "wait":
 		s := strings.TrimSpace(st.State)
-		if s != "playing" && s != "paused" && s != "stopped" {
+		u := strings.TrimSpace(st.Until)
+		if (s == "") == (u == "") {
+			return automationValidationErrf("%s: wait requires exactly one of state or until", path)
+		}
+		if s != "" && s != "playing" && s != "paused" && s != "stopped" {
 			return automationValidationErrf("%s.state: expected playing|paused|stopped", path)
 		}
+		if u != "" {
+			if _, err := parseWaitCondition(u); err != nil {
+				return automationValidationErrf("%s.until: %v", path, err)
+			}
+		}
 		if strings.TrimSpace(st.Timeout) == "" {
 			return automationValidationErrf("%s.timeout: required", path)
 		}
@@ -141,8 +172,92 @@ func validateAutomationStep(i int, st automationStep) error {
 			return automationValidationErrf("%s.timeout: expected between 1s and 10m", path)
 		}
 	case "transport":
-		if strings.TrimSpace(st.Action) != "stop" {
-			return automationValidationErrf("%s.action: only \"stop\" is supported in v1", path)
+		if _, ok := transportActions[strings.TrimSpace(st.Action)]; !ok {
+			return automationValidationErrf("%s.action: expected play|pause|playpause|stop|next|prev", path)
+		}
+	case "shuffle.set":
+		m := strings.TrimSpace(st.Mode)
+		if st.Enabled == nil && m == "" {
+			return automationValidationErrf("%s: shuffle.set requires enabled or mode", path)
+		}
+		if m != "" && !isShuffleMode(m) {
+			return automationValidationErrf("%s.mode: expected songs|albums|groupings", path)
+		}
+	case "crossfade.set":
+		// Crossfade drives Music.app's settings window, which an unattended
+		// routine must not take over.
+		return automationValidationErrf("%s.type: crossfade.set is not supported; run homepodctl crossfade --ui-scripting instead", path)
+	case "repeat.set":
+		m := strings.ToLower(strings.TrimSpace(st.Mode))
+		if m != "off" && m != "one" && m != "all" {
+			return automationValidationErrf("%s.mode: expected off|one|all", path)
+		}
+	case "seek":
+		if st.Position == nil {
+			return automationValidationErrf("%s.position: required for seek", path)
+		}
+		if *st.Position < 0 {
+			return automationValidationErrf("%s.position: must be >= 0", path)
+		}
+	case "notify":
+		if strings.TrimSpace(st.Message) == "" {
+			return automationValidationErrf("%s.message: required for notify", path)
+		}
+		if _, err := parseAutomationTemplate(st.Title); err != nil {
+			return automationValidationErrf("%s.title: %v", path, err)
+		}
+		if _, err := parseAutomationTemplate(st.Message); err != nil {
+			return automationValidationErrf("%s.message: %v", path, err)
+		}
+	case "webhook":
+		if strings.TrimSpace(st.URL) == "" {
+			return automationValidationErrf("%s.url: required for webhook", path)
+		}
+		if err := validateWebhookURL(st.URL); err != nil {
+			return automationValidationErrf("%s.url: %v", path, err)
+		}
+		if strings.TrimSpace(st.Timeout) != "" {
+			d, err := time.ParseDuration(st.Timeout)
+			if err != nil {
+				return automationValidationErrf("%s.timeout: invalid duration", path)
+			}
+			if d < time.Second || d > maxWebhookTimeout {
+				return automationValidationErrf("%s.timeout: expected between 1s and %s", path, maxWebhookTimeout)
+			}
+		}
+		if st.Retries != nil && (*st.Retries < 0 || *st.Retries > maxWebhookRetries) {
+			return automationValidationErrf("%s.retries: expected 0..%d", path, maxWebhookRetries)
+		}
+		for _, v := range automationTemplates(st) {
+			if _, err := parseAutomationTemplate(v); err != nil {
+				return automationValidationErrf("%s.payload: %v", path, err)
+			}
+		}
+	case "shortcut":
+		if strings.TrimSpace(st.Name) == "" {
+			return automationValidationErrf("%s.name: required for shortcut", path)
+		}
+		if _, err := parseAutomationTemplate(st.Input); err != nil {
+			return automationValidationErrf("%s.input: %v", path, err)
+		}
+	case "parallel":
+		if len(st.Steps) == 0 {
+			return automationValidationErrf("%s.steps: required for parallel", path)
+		}
+		if st.Concurrency != nil && (*st.Concurrency < 1 || *st.Concurrency > maxParallelConcurrency) {
+			return automationValidationErrf("%s.concurrency: expected 1..%d", path, maxParallelConcurrency)
+		}
+		if st.FailOn != "" && st.FailOn != "any" && st.FailOn != "all" {
+			return automationValidationErrf("%s.failOn: expected any|all", path)
+		}
+		for j, b := range st.Steps {
+			bpath := fmt.Sprintf("%s.steps[%d]", path, j)
+			if strings.TrimSpace(b.Type) == "parallel" {
+				return automationValidationErrf("%s.type: parallel blocks cannot nest", bpath)
+			}
+			if err := validateAutomationStepAt(bpath, b); err != nil {
+				return err
+			}
 		}
 	default:
 		return automationValidationErrf("%s.type: unsupported step type %q", path, st.Type)
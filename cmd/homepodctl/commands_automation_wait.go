@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// waitCondition is a parsed `wait.until` expression.
+type waitCondition struct {
+	Kind  string // track.changed|playlist|output.selected|volume
+	Arg   string
+	Op    string
+	Value int
+	// Rooms are the devices output.selected waits for, once Arg is
+	// resolved; all of them must be selected.
+	Rooms []string
+}
+
+func parseWaitCondition(raw string) (waitCondition, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return waitCondition{}, fmt.Errorf("condition is empty")
+	}
+	kind, rest, _ := strings.Cut(s, " ")
+	rest = strings.TrimSpace(rest)
+	switch kind {
+	case "track.changed":
+		if rest != "" {
+			return waitCondition{}, fmt.Errorf("track.changed takes no argument")
+		}
+		return waitCondition{Kind: kind}, nil
+	case "playlist", "output.selected":
+		if rest == "" {
+			return waitCondition{}, fmt.Errorf("%s requires a name", kind)
+		}
+		return waitCondition{Kind: kind, Arg: strings.Trim(rest, `"'`)}, nil
+	case "volume":
+		fields := strings.Fields(rest)
+		if len(fields) != 2 {
+			return waitCondition{}, fmt.Errorf("volume expects `volume <op> <0-100>`")
+		}
+		switch fields[0] {
+		case ">=", "<=", ">", "<", "==":
+		default:
+			return waitCondition{}, fmt.Errorf("volume operator must be one of >= <= > < ==")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 || n > 100 {
+			return waitCondition{}, fmt.Errorf("volume threshold must be 0..100")
+		}
+		return waitCondition{Kind: kind, Op: fields[0], Value: n}, nil
+	default:
+		return waitCondition{}, fmt.Errorf("unknown condition %q (expected track.changed, playlist, output.selected, volume)", kind)
+	}
+}
+
+func (c waitCondition) String() string {
+	switch c.Kind {
+	case "volume":
+		return fmt.Sprintf("volume %s %d", c.Op, c.Value)
+	case "track.changed":
+		return c.Kind
+	default:
+		return c.Kind + " " + c.Arg
+	}
+}
+
+// met reports whether np satisfies the condition. initialTrack is the track
+// persistent ID observed on the first poll and is only used by track.changed.
+// rooms scopes the volume condition; when empty the average of selected outputs is used.
+func (c waitCondition) met(np music.NowPlaying, initialTrack string, rooms []string) bool {
+	switch c.Kind {
+	case "track.changed":
+		return strings.TrimSpace(np.Track.PersistentID) != strings.TrimSpace(initialTrack)
+	case "playlist":
+		return strings.EqualFold(strings.TrimSpace(np.PlaylistName), c.Arg) || strings.EqualFold(strings.TrimSpace(np.PlaylistID), c.Arg)
+	case "output.selected":
+		want := c.Rooms
+		if len(want) == 0 {
+			want = []string{c.Arg}
+		}
+		for _, room := range want {
+			found := false
+			for _, o := range np.Outputs {
+				if strings.EqualFold(strings.TrimSpace(o.Name), room) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case "volume":
+		if len(rooms) > 0 {
+			for _, room := range rooms {
+				found := false
+				for _, o := range np.Outputs {
+					if strings.EqualFold(strings.TrimSpace(o.Name), room) {
+						found = true
+						if !compareVolume(o.Volume, c.Op, c.Value) {
+							return false
+						}
+					}
+				}
+				if !found {
+					return false
+				}
+			}
+			return true
+		}
+		if len(np.Outputs) == 0 {
+			return false
+		}
+		total := 0
+		for _, o := range np.Outputs {
+			total += o.Volume
+		}
+		return compareVolume(total/len(np.Outputs), c.Op, c.Value)
+	default:
+		return false
+	}
+}
+
+func compareVolume(got int, op string, want int) bool {
+	switch op {
+	case ">=":
+		return got >= want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	case "<":
+		return got < want
+	case "==":
+		return got == want
+	default:
+		return false
+	}
+}
+
+func executeAutomationWaitUntil(ctx context.Context, cfg *native.Config, until string, timeoutRaw string, rooms []string) error {
+	cond, err := parseWaitCondition(until)
+	if err != nil {
+		return err
+	}
+	if cond.Kind == "output.selected" {
+		// The name is a room argument like any other: a device alias, a
+		// group, or a partial device name.
+		if cond.Rooms, err = resolveRooms(ctx, cfg.ExpandRooms([]string{cond.Arg}), false); err != nil {
+			return err
+		}
+	}
+	timeout, err := time.ParseDuration(timeoutRaw)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	initialTrack := ""
+	first := true
+	for {
+		np, err := getNowPlaying(ctx)
+		if err != nil {
+			return err
+		}
+		if first {
+			initialTrack = np.Track.PersistentID
+			first = false
+		}
+		if cond.met(np, initialTrack, rooms) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("wait timeout after %s for %s", timeout.String(), cond.String())
+		}
+		if err := sleepCtx(ctx, time.Second); err != nil {
+			return err
+		}
+	}
+}
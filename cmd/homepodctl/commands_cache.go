@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+type cacheResult struct {
+	OK          bool   `json:"ok"`
+	Action      string `json:"action"`
+	DryRun      bool   `json:"dryRun,omitempty"`
+	Path        string `json:"path"`
+	DevicesPath string `json:"devicesPath"`
+	Playlists   int    `json:"playlists,omitempty"`
+	Devices     int    `json:"devices,omitempty"`
+}
+
+// defaultCacheDir is $XDG_CACHE_HOME/homepodctl, falling back to
+// ~/.cache/homepodctl.
+func defaultCacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "homepodctl"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "homepodctl"), nil
+}
+
+// hostCacheDir is the cache directory for the Mac commands talk to: the
+// cache dir itself locally, hosts/<host> under it with --host, so listings
+// of different Macs never mix.
+func hostCacheDir() (string, error) {
+	dir, err := defaultCacheDir()
+	if err != nil || remoteHost == "" {
+		return dir, err
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._@-", r) {
+			return r
+		}
+		return '_'
+	}, remoteHost)
+	return filepath.Join(dir, "hosts", name), nil
+}
+
+func defaultPlaylistCachePath() (string, error) {
+	dir, err := hostCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "playlists.json"), nil
+}
+
+func defaultDeviceCachePath() (string, error) {
+	dir, err := hostCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "devices.json"), nil
+}
+
+// configureCaches points the music package at playlists.json and
+// devices.json, or leaves every lookup uncached when enabled is false.
+func configureCaches(enabled bool) {
+	if !enabled {
+		music.SetPlaylistCache("", 0)
+		music.SetDeviceCache("", 0)
+		return
+	}
+	path, err := playlistCachePath()
+	if err != nil {
+		debugf("cache: %v", err)
+		return
+	}
+	music.SetPlaylistCache(path, music.DefaultPlaylistCacheTTL)
+	if path, err = deviceCachePath(); err != nil {
+		debugf("cache: %v", err)
+		return
+	}
+	music.SetDeviceCache(path, music.DefaultDeviceCacheTTL)
+}
+
+// reportCacheAge notes on stderr, under --verbose, how old a listing is.
+func reportCacheAge(what string, cachedAt time.Time) {
+	if !verbose || cachedAt.IsZero() {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: age=%s cachedAt=%s\n", what, time.Since(cachedAt).Round(time.Second), cachedAt.UTC().Format(time.RFC3339))
+}
+
+func cmdCache(ctx context.Context, args []string) {
+	const cacheUsage = "usage: homepodctl cache refresh|clear [--json] [--dry-run]"
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 1 {
+		die(usageErrf(cacheUsage))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	path, err := playlistCachePath()
+	if err != nil {
+		die(err)
+	}
+	devicesPath, err := deviceCachePath()
+	if err != nil {
+		die(err)
+	}
+	res := cacheResult{OK: true, Action: positionals[0], DryRun: opts.DryRun, Path: path, DevicesPath: devicesPath}
+	switch positionals[0] {
+	case "refresh":
+		if !opts.DryRun {
+			playlists, err := refreshPlaylistCache(ctx)
+			if err != nil {
+				die(err)
+			}
+			res.Playlists = len(playlists)
+			devices, _, err := refreshDeviceCache(ctx)
+			if err != nil {
+				die(err)
+			}
+			res.Devices = len(devices)
+		}
+	case "clear":
+		if !opts.DryRun {
+			if err := clearPlaylistCache(); err != nil {
+				die(err)
+			}
+			if err := clearDeviceCache(); err != nil {
+				die(err)
+			}
+		}
+	default:
+		die(usageErrf("unknown cache subcommand: %q (%s)", positionals[0], cacheUsage))
+	}
+
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	switch {
+	case opts.DryRun:
+		fmt.Printf("dry-run: would %s %s and %s\n", res.Action, path, devicesPath)
+	case res.Action == "refresh":
+		fmt.Printf("cached %d playlists in %s\n", res.Playlists, path)
+		fmt.Printf("cached %d devices in %s\n", res.Devices, devicesPath)
+	default:
+		fmt.Printf("cleared %s and %s\n", path, devicesPath)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/agisilaos/homepodctl/internal/sysaudio"
+)
+
+// capabilitiesSchemaVersion is bumped whenever a field of capabilitiesReport
+// is renamed or removed; new fields keep the version.
+const capabilitiesSchemaVersion = 1
+
+var musicAppVersion = readMusicAppVersion
+
+// capabilityFeatures names behaviors scripts may want to detect. A name is
+// listed only while the behavior ships, so scripts should check for the
+// names they need rather than compare the whole list.
+var capabilityFeatures = []string{
+	"json-errors", "json-stream", "dry-run", "plan", "undo", "history", "output-verification",
+	"fuzzy-rooms", "device-watch", "metrics", "self-update", "rpc", "automation", "playlist-cache", "help-json", "assume-yes", "state",
+	"remote-host", "gui-session", "audio-route", "catalog", "radio", "media-keys", "spotify",
+}
+
+// backendError rejects a backend other than airplay or native.
+func backendError(backend string) error {
+	return usageErrf("unknown backend: %q", backend)
+}
+
+type capabilityTool struct {
+	Available bool   `json:"available"`
+	Path      string `json:"path,omitempty"`
+}
+
+type capabilityBackend struct {
+	Name      string   `json:"name"`
+	Available bool     `json:"available"`
+	Requires  []string `json:"requires,omitempty"`
+	Actions   []string `json:"actions"`
+	Note      string   `json:"note,omitempty"`
+}
+
+type capabilitiesReport struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	Platform      string `json:"platform"`
+	Music         struct {
+		Installed bool   `json:"installed"`
+		Version   string `json:"version,omitempty"`
+		Running   bool   `json:"running"`
+	} `json:"music"`
+	Config struct {
+		Path   string `json:"path,omitempty"`
+		Loaded bool   `json:"loaded"`
+		Error  string `json:"error,omitempty"`
+	} `json:"config"`
+	Engine   string                    `json:"engine"`
+	Tools    map[string]capabilityTool `json:"tools"`
+	Backends []capabilityBackend       `json:"backends"`
+	Commands []string                  `json:"commands"`
+	Features []string                  `json:"features"`
+}
+
+func cmdCapabilities(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl capabilities [--json] [--plain]"))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	report := collectCapabilities(ctx)
+	if opts.JSON {
+		writeJSON(report)
+		return
+	}
+	printCapabilities(report, opts.Plain)
+}
+
+// collectCapabilities inspects this machine without launching Music.app or
+// failing: anything it cannot determine is reported as unavailable.
+func collectCapabilities(ctx context.Context) capabilitiesReport {
+	var r capabilitiesReport
+	r.SchemaVersion = capabilitiesSchemaVersion
+	r.Version, r.Commit = version, commit
+	r.Platform = runtime.GOOS + "/" + runtime.GOARCH
+	cfg, cfgErr := loadConfigOptional()
+	r.Engine = selectedEngineName(cfg)
+
+	r.Tools = map[string]capabilityTool{}
+	for _, name := range []string{"osascript", "shortcuts", sysaudio.Tool} {
+		path, err := lookPath(name)
+		r.Tools[name] = capabilityTool{Available: err == nil, Path: path}
+	}
+
+	if v, err := musicAppVersion(ctx); err == nil {
+		r.Music.Installed, r.Music.Version = true, v
+	} else {
+		debugf("capabilities: music version: %v", err)
+	}
+	if r.Tools["osascript"].Available {
+		if running, err := musicAppRunning(ctx); err == nil {
+			r.Music.Running = running
+			r.Music.Installed = r.Music.Installed || running
+		}
+	}
+
+	if path, err := configPath(); err == nil {
+		r.Config.Path = path
+	}
+	if cfgErr != nil {
+		r.Config.Error = formatError(cfgErr)
+	} else {
+		r.Config.Loaded = true
+	}
+
+	osascript := r.Tools["osascript"].Available
+	r.Backends = []capabilityBackend{
+		{Name: "airplay", Available: osascript && r.Music.Installed, Requires: []string{"osascript", "Music.app"},
+			Actions: []string{"play", "out", "move", "volume", "mixer", "mute", "duck", "announce", "pause", "stop", "resume", "next", "prev", "status"}},
+		{Name: "native", Available: r.Tools["shortcuts"].Available, Requires: []string{"shortcuts"},
+			Actions: []string{"play", "volume", "native-run"}, Note: "runs the Shortcuts mapped under native in the config"},
+	}
+	for _, c := range topLevelCommands() {
+		r.Commands = append(r.Commands, c.Value)
+	}
+	r.Features = append([]string{}, capabilityFeatures...)
+	return r
+}
+
+func printCapabilities(r capabilitiesReport, plain bool) {
+	yesNo := func(v bool) string {
+		if v {
+			return "yes"
+		}
+		return "no"
+	}
+	music := yesNo(r.Music.Installed)
+	if r.Music.Version != "" {
+		music += " (" + r.Music.Version + ")"
+	}
+	config := yesNo(r.Config.Loaded)
+	if r.Config.Error != "" {
+		config += " (" + r.Config.Error + ")"
+	}
+	var backends []string
+	for _, b := range r.Backends {
+		if b.Available {
+			backends = append(backends, b.Name)
+		}
+	}
+	rows := [][2]string{
+		{"version", r.Version},
+		{"platform", r.Platform},
+		{"engine", r.Engine},
+		{"osascript", yesNo(r.Tools["osascript"].Available)},
+		{"shortcuts", yesNo(r.Tools["shortcuts"].Available)},
+		{"switchaudio", yesNo(r.Tools[sysaudio.Tool].Available)},
+		{"music", music},
+		{"music-running", yesNo(r.Music.Running)},
+		{"config", config},
+		{"backends", strings.Join(backends, ",")},
+		{"features", strings.Join(r.Features, ",")},
+	}
+	if plain {
+		for _, row := range rows {
+			fmt.Printf("%s\t%s\n", row[0], row[1])
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(row[0][:1])+row[0][1:]+":", row[1])
+	}
+	_ = tw.Flush()
+}
+
+// readMusicAppVersion reads Music.app's bundle version from its Info.plist,
+// which works whether or not Music.app is running.
+func readMusicAppVersion(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "plutil", "-extract", "CFBundleShortVersionString", "raw", "-o", "-",
+		"/System/Applications/Music.app/Contents/Info.plist").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
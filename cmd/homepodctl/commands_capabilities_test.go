@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+func TestCollectCapabilities(t *testing.T) {
+	origLookPath := lookPath
+	origVersion := musicAppVersion
+	origRunning := musicAppRunning
+	origLoadConfig := loadConfigOptional
+	t.Cleanup(func() {
+		lookPath = origLookPath
+		musicAppVersion = origVersion
+		musicAppRunning = origRunning
+		loadConfigOptional = origLoadConfig
+	})
+	lookPath = func(name string) (string, error) {
+		if name == "osascript" {
+			return "/usr/bin/osascript", nil
+		}
+		return "", errors.New("not found")
+	}
+	musicAppVersion = func(context.Context) (string, error) { return "1.5.0", nil }
+	musicAppRunning = func(context.Context) (bool, error) { return false, nil }
+	loadConfigOptional = func() (*native.Config, error) { return &native.Config{}, nil }
+
+	r := collectCapabilities(context.Background())
+	if r.SchemaVersion != capabilitiesSchemaVersion || !r.Music.Installed || r.Music.Version != "1.5.0" || !r.Config.Loaded {
+		t.Fatalf("report=%+v", r)
+	}
+	available := map[string]bool{}
+	for _, b := range r.Backends {
+		available[b.Name] = b.Available
+	}
+	if len(r.Backends) != 2 || !available["airplay"] || available["native"] {
+		t.Fatalf("backends=%+v", r.Backends)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"schemaVersion":1`, `"tools":`, `"commands":`, `"features":`} {
+		if !strings.Contains(string(b), key) {
+			t.Fatalf("json missing %s: %s", key, b)
+		}
+	}
+}
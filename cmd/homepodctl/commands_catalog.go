@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/catalog"
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+const (
+	// catalogPlaylist is the one library playlist play --catalog refills
+	// with a catalog song, album, or artist's top songs, so repeated plays
+	// do not leave a playlist behind each.
+	catalogPlaylist = "homepodctl Catalog"
+	// catalogArtistSongs is how many top songs play --catalog adds for an
+	// artist.
+	catalogArtistSongs = 20
+	// Added items take a while to sync from iCloud Music Library into
+	// Music.app; play --catalog polls for them this often, this many times.
+	catalogSyncInterval = 3 * time.Second
+	catalogSyncAttempts = 20
+)
+
+func cmdCatalog(ctx context.Context, cfg *native.Config, args []string) {
+	if len(args) == 0 || args[0] != "search" {
+		die(usageErrf("usage: homepodctl catalog search <query> [--limit N] [--json] [--plain]"))
+	}
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	kind, term := catalog.ParseQuery(strings.Join(positionals, " "))
+	if term == "" {
+		die(usageErrf("usage: homepodctl catalog search <query> [--limit N] [--json] [--plain]"))
+	}
+	limit := 10
+	if v, ok, err := flags.intStrict("limit"); err != nil {
+		die(err)
+	} else if ok {
+		if v < 1 || v > 25 {
+			die(usageErrf("--limit must be 1-25"))
+		}
+		limit = v
+	}
+	client, err := catalogClient(cfg)
+	if err != nil {
+		die(err)
+	}
+	items, err := client.Search(ctx, term, kind, limit)
+	if err != nil {
+		die(err)
+	}
+	if jsonOut {
+		if items == nil {
+			items = []catalog.Item{}
+		}
+		writeJSON(items)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "KIND\tID\tNAME\tARTIST\tALBUM")
+	}
+	for _, it := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", it.Kind, it.ID, it.Name, it.Artist, it.Album)
+	}
+	_ = tw.Flush()
+}
+
+// catalogClient builds an Apple Music API client from the appleMusic config.
+func catalogClient(cfg *native.Config) (*catalog.Client, error) {
+	am := cfg.AppleMusic
+	if am == nil || strings.TrimSpace(am.DeveloperToken) == "" {
+		return nil, usageErrf("no Apple Music developer token configured (set appleMusic.developerToken via `homepodctl config set`)")
+	}
+	return &catalog.Client{DeveloperToken: am.DeveloperToken, UserToken: am.UserToken, Storefront: am.Storefront, Endpoint: catalogEndpoint}, nil
+}
+
+// findCatalogItem searches the catalog for query and returns the result
+// whose name matches the search term best. Ties, and results that match by
+// artist or album rather than name, keep the API's relevance order.
+func findCatalogItem(ctx context.Context, client *catalog.Client, query string) (catalog.Item, error) {
+	kind, term := catalog.ParseQuery(query)
+	if term == "" {
+		return catalog.Item{}, usageErrf("--catalog needs a query, e.g. --catalog \"artist:Khruangbin\"")
+	}
+	items, err := client.Search(ctx, term, kind, 10)
+	if err != nil {
+		return catalog.Item{}, err
+	}
+	if len(items) == 0 {
+		return catalog.Item{}, fmt.Errorf("nothing in the Apple Music catalog matches %q (tip: run `homepodctl catalog search %q`)", query, query)
+	}
+	best, bestScore := items[0], music.MatchScore(term, items[0].Name)
+	for _, it := range items[1:] {
+		if s := music.MatchScore(term, it.Name); s > bestScore {
+			best, bestScore = it, s
+		}
+	}
+	return best, nil
+}
+
+// catalogPlaylistName is the library playlist play --catalog plays for item:
+// a catalog playlist keeps its own name once added to the library.
+func catalogPlaylistName(item catalog.Item) string {
+	if item.Kind == "playlist" {
+		return item.Name
+	}
+	return catalogPlaylist
+}
+
+// catalogLibraryPlaylist makes item playable and returns the persistent ID
+// of its library playlist. AppleScript cannot play catalog items directly,
+// so they are added to the library first: a catalog playlist as it is
+// (reused once in the library), and an artist's top songs, an album, or a
+// song into the shared catalogPlaylist, emptied first so it never goes
+// stale.
+func catalogLibraryPlaylist(ctx context.Context, client *catalog.Client, item catalog.Item) (string, error) {
+	name := catalogPlaylistName(item)
+	if item.Kind == "playlist" {
+		if id, err := exactPlaylistID(ctx, name); err != nil || id != "" {
+			return id, err
+		}
+	}
+	add := []catalog.Item{item}
+	if item.Kind == "artist" {
+		songs, err := client.TopSongs(ctx, item.ID, catalogArtistSongs)
+		if err != nil {
+			return "", err
+		}
+		if len(songs) == 0 {
+			return "", fmt.Errorf("the Apple Music catalog lists no songs for %s", item.Name)
+		}
+		add = songs
+	}
+	debugf("catalog: adding %d %s item(s) for %q to the library", len(add), add[0].Kind, item.Name)
+	if err := client.AddToLibrary(ctx, add); err != nil {
+		if errors.Is(err, catalog.ErrNoUserToken) {
+			return "", usageErrf("playing from the catalog adds %q to your library first, which needs appleMusic.userToken (a Music-User-Token) set via `homepodctl config set`", item.Name)
+		}
+		return "", err
+	}
+
+	var trackIDs []string
+	for attempt := 1; ; attempt++ {
+		var complete bool
+		var err error
+		if item.Kind == "playlist" {
+			id, err := exactPlaylistID(ctx, name)
+			if err != nil || id != "" {
+				return id, err
+			}
+		} else if trackIDs, complete, err = catalogLibraryTracks(ctx, item, add); err != nil {
+			return "", err
+		}
+		// Settle for the songs that arrived if some never do.
+		if complete || (attempt == catalogSyncAttempts && len(trackIDs) > 0) {
+			break
+		}
+		if attempt == catalogSyncAttempts {
+			return "", fmt.Errorf("%s %q was added to your library but has not reached Music.app yet; try again in a minute", item.Kind, item.Name)
+		}
+		debugf("catalog: waiting for library sync (attempt %d, %d track(s) so far)", attempt, len(trackIDs))
+		sleepFn(catalogSyncInterval)
+	}
+	playlistID, err := exactPlaylistID(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if playlistID == "" {
+		p, err := createPlaylist(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		playlistID = p.PersistentID
+	} else if err := clearPlaylist(ctx, playlistID); err != nil {
+		return "", err
+	}
+	for _, id := range trackIDs {
+		if err := addTrackToPlaylist(ctx, playlistID, id); err != nil {
+			return "", err
+		}
+	}
+	return playlistID, nil
+}
+
+// catalogLibraryTracks looks up the library tracks of an added album, or of
+// added songs, and reports whether all of them arrived.
+func catalogLibraryTracks(ctx context.Context, item catalog.Item, songs []catalog.Item) ([]string, bool, error) {
+	if item.Kind == "album" {
+		albums, err := searchLibrary(ctx, item.Name, "album", 0)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, a := range albums {
+			if strings.EqualFold(a.Name, item.Name) && strings.EqualFold(a.Artist, item.Artist) {
+				return a.TrackIDs, len(a.TrackIDs) > 0, nil
+			}
+		}
+		return nil, false, nil
+	}
+	var ids []string
+	for _, s := range songs {
+		tracks, err := searchLibrary(ctx, s.Name, "track", 0)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, t := range tracks {
+			if strings.EqualFold(t.Name, s.Name) && strings.EqualFold(t.Artist, s.Artist) {
+				ids = append(ids, t.PersistentID)
+				break
+			}
+		}
+	}
+	return ids, len(ids) == len(songs), nil
+}
+
+// exactPlaylistID returns the persistent ID of the user playlist named name
+// (ignoring case), or "" when there is none.
+func exactPlaylistID(ctx context.Context, name string) (string, error) {
+	matches, err := searchPlaylists(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range matches {
+		if strings.EqualFold(p.Name, name) {
+			return p.PersistentID, nil
+		}
+	}
+	return "", nil
+}
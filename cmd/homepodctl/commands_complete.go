@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+var (
+	cachedPlaylists    = music.CachedUserPlaylists
+	cachedDevices      = music.CachedAirPlayDevices
+	listConfigProfiles = native.ListProfiles
+)
+
+// Directives end every __complete reply as ":<n>" and tell the shell what to
+// do besides offering the candidates.
+const (
+	completeDirectiveFiles   = 1 // complete file names instead
+	completeDirectiveDirs    = 2 // complete directory names instead
+	completeDirectiveNoSpace = 4 // do not add a space after the candidate
+)
+
+type completionCandidate struct {
+	Value string
+	Desc  string
+}
+
+// topLevelCommands offers every documented command and alias with its help
+// summary, in help order.
+func topLevelCommands() []completionCandidate {
+	var out []completionCandidate
+	for _, d := range commandDocs {
+		out = append(out, completionCandidate{d.Name, d.Summary})
+		for _, a := range d.Aliases {
+			out = append(out, completionCandidate{a, d.Summary})
+		}
+	}
+	return out
+}
+
+// completionSubcommands maps a command path to the words that may follow it.
+var completionSubcommands = map[string][]string{
+	"config":             {"validate", "get", "set", "unset", "list", "wizard", "profile", "export", "import"},
+	"config profile":     {"list", "create", "switch"},
+	"automation":         {"run", "validate", "plan", "init", "history", "status", "serve", "record"},
+	"plan":               planTargetNames(),
+	"plan out":           planTargets["out"],
+	"plan automation":    planTargets["automation"],
+	"plan eq":            planTargets["eq"],
+	"plan alias":         planTargets["alias"],
+	"plan scene":         planTargets["scene"],
+	"plan playlist":      planTargets["playlist"],
+	"plan cache":         planTargets["cache"],
+	"completion":         {"bash", "zsh", "fish", "install"},
+	"completion install": {"bash", "zsh", "fish"},
+	"docs":               {"man"},
+	"homekit":            {"accessories"},
+	"shortcuts":          {"list"},
+	"out":                {"list", "set", "add", "remove"},
+	"playlist":           {"create", "add", "remove-track"},
+	"catalog":            {"search"},
+	"radio":              {"list"},
+	"media":              {"playpause", "next", "prev"},
+	"scrobble":           {"daemon", "flush"},
+	"streamdeck":         {"serve"},
+	"metrics":            {"serve"},
+	"daemon":             {"serve", "status"},
+	"alias":              {"add", "remove", "rename", "copy"},
+	"cache":              {"refresh", "clear"},
+	"state":              {"show", "clear"},
+	"history":            {"tracks"},
+	"eq":                 {"list", "set"},
+	"scene":              {"list", "run"},
+}
+
+// completionPositionals names the values each positional argument of a
+// command path takes; a trailing "..." repeats the last kind.
+var completionPositionals = map[string][]string{
+	"run":                   {"aliases"},
+	"play":                  {"playlists"},
+	"plan play":             {"playlists"},
+	"plan run":              {"aliases"},
+	"move":                  {"rooms", "rooms"},
+	"handoff":               {"rooms", "rooms"},
+	"out set":               {"rooms..."},
+	"out add":               {"rooms..."},
+	"out remove":            {"rooms..."},
+	"plan out set":          {"rooms..."},
+	"plan out add":          {"rooms..."},
+	"plan out remove":       {"rooms..."},
+	"volume":                {"", "rooms..."},
+	"vol":                   {"", "rooms..."},
+	"plan volume":           {"", "rooms..."},
+	"plan vol":              {"", "rooms..."},
+	"mixer":                 {"rooms..."},
+	"mute":                  {"rooms..."},
+	"unmute":                {"rooms..."},
+	"alias remove":          {"aliases"},
+	"alias rename":          {"aliases"},
+	"alias copy":            {"aliases"},
+	"config get":            {"config-paths"},
+	"config unset":          {"config-paths"},
+	"config list":           {"config-paths"},
+	"config set":            {"config-keys"},
+	"config import":         {"files"},
+	"config profile switch": {"profiles"},
+	"schema":                {"schemas"},
+	"eq set":                {"eq-presets"},
+	"scene run":             {"scenes"},
+	"help":                  {"commands"},
+}
+
+// cmdComplete implements the protocol the completion scripts speak:
+// `__complete <words before the cursor...> <current word>` prints one
+// candidate per line (a tab separates an optional description) and then
+// ":<directive>". It is hidden and never fails, so a broken setup costs the
+// user suggestions rather than error noise at the prompt.
+func cmdComplete(ctx context.Context, args []string) {
+	words, cur := args, ""
+	if n := len(args); n > 0 {
+		words, cur = args[:n-1], args[n-1]
+	}
+	cands, directive := completeWords(ctx, words, cur)
+	for _, c := range cands {
+		if c.Desc != "" {
+			fmt.Printf("%s\t%s\n", c.Value, c.Desc)
+		} else {
+			fmt.Println(c.Value)
+		}
+	}
+	fmt.Printf(":%d\n", directive)
+}
+
+func completeWords(ctx context.Context, words []string, cur string) ([]completionCandidate, int) {
+	for i := range words {
+		words[i] = unquoteCompletionWord(words[i])
+	}
+	cur = unquoteCompletionWord(cur)
+
+	// bash splits --flag=value at the "=", so the flag may arrive as
+	// [..., "--flag", "="] with cur holding the value.
+	if cur == "=" && len(words) > 0 {
+		words, cur = append(words, "="), ""
+	}
+	if n := len(words); n >= 2 && words[n-1] == "=" {
+		if f, ok := lookupFlagDef(words[n-2]); ok && f.takesValue() {
+			return completeFlagValue(ctx, f, "", cur)
+		}
+	}
+	if name, value, ok := strings.Cut(cur, "="); ok && strings.HasPrefix(name, "-") {
+		if f, ok := lookupFlagDef(name); ok && f.takesValue() {
+			return completeFlagValue(ctx, f, name+"=", value)
+		}
+		return nil, 0
+	}
+	if n := len(words); n > 0 {
+		if f, ok := lookupFlagDef(words[n-1]); ok && f.takesValue() {
+			return completeFlagValue(ctx, f, "", cur)
+		}
+	}
+
+	// Find the command after the global flags, then walk its subcommands.
+	i := 0
+	for i < len(words) && strings.HasPrefix(words[i], "-") {
+		if globalValueFlags[words[i]] {
+			i++
+		}
+		i++
+	}
+	if i >= len(words) {
+		if strings.HasPrefix(cur, "-") {
+			return completeFlagNames(cur), 0
+		}
+		return filterCompletions(topLevelCommands(), cur), 0
+	}
+	path := words[i]
+	var positionals []string
+	for j := i + 1; j < len(words); j++ {
+		w := words[j]
+		if strings.HasPrefix(w, "-") && w != "-" {
+			if f, ok := lookupFlagDef(w); ok && f.takesValue() && !strings.Contains(w, "=") {
+				j++
+			}
+			continue
+		}
+		if len(positionals) == 0 && containsString(completionSubcommands[path], w) {
+			path += " " + w
+			continue
+		}
+		positionals = append(positionals, w)
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		return completeFlagNames(cur), 0
+	}
+	if subs, ok := completionSubcommands[path]; ok && len(positionals) == 0 {
+		var cands []completionCandidate
+		for _, s := range subs {
+			cands = append(cands, completionCandidate{Value: s})
+		}
+		return filterCompletions(cands, cur), 0
+	}
+	kinds := completionPositionals[path]
+	if len(kinds) == 0 {
+		return nil, 0
+	}
+	kind := ""
+	if n := len(positionals); n < len(kinds) {
+		kind = kinds[n]
+	} else if last := kinds[len(kinds)-1]; strings.HasSuffix(last, "...") {
+		kind = last
+	}
+	return completionValues(ctx, strings.TrimSuffix(kind, "..."), "", cur)
+}
+
+func completeFlagNames(cur string) []completionCandidate {
+	var cands []completionCandidate
+	for _, f := range flagDefs {
+		if f.Name != "-f" {
+			cands = append(cands, completionCandidate{Value: f.Name, Desc: f.Desc})
+		}
+	}
+	return filterCompletions(cands, cur)
+}
+
+func completeFlagValue(ctx context.Context, f flagDef, prefix, cur string) ([]completionCandidate, int) {
+	if len(f.Enum) > 0 {
+		var cands []completionCandidate
+		for _, v := range f.Enum {
+			cands = append(cands, completionCandidate{Value: prefix + v})
+		}
+		return filterCompletions(cands, prefix+cur), 0
+	}
+	return completionValues(ctx, f.Kind, prefix, cur)
+}
+
+// completionValues lists the values of one kind that start with cur, each
+// prefixed with prefix (for --flag=value words).
+func completionValues(ctx context.Context, kind, prefix, cur string) ([]completionCandidate, int) {
+	var words []string
+	switch kind {
+	case "files":
+		return nil, completeDirectiveFiles
+	case "dirs":
+		return nil, completeDirectiveDirs
+	case "rooms":
+		words = completeRooms(ctx)
+	case "playlists":
+		words = completePlaylists(ctx)
+	case "folders":
+		words = completePlaylistFolders()
+	case "eq-presets":
+		words = completeEQPresets(ctx)
+	case "aliases":
+		if cfg, err := loadConfigOptional(); err == nil {
+			words, _, _ = completionData(cfg)
+		}
+	case "scenes":
+		if cfg, err := loadConfigOptional(); err == nil {
+			words = sceneNames(cfg)
+		}
+	case "profiles":
+		if profiles, err := listConfigProfiles(); err == nil {
+			words = profiles
+		}
+	case "remotes":
+		if cfg, err := loadConfigOptional(); err == nil {
+			for name := range cfg.Remotes {
+				words = append(words, name)
+			}
+		}
+	case "schemas":
+		for name := range cliSchemas {
+			words = append(words, name)
+		}
+	case "commands":
+		return filterCompletions(topLevelCommands(), cur), 0
+	case "config-paths", "config-keys":
+		words = completeConfigPaths(kind == "config-keys")
+	default:
+		return nil, 0
+	}
+	cands := make([]completionCandidate, 0, len(words))
+	for _, w := range words {
+		cands = append(cands, completionCandidate{Value: prefix + w})
+	}
+	return filterCompletions(cands, prefix+cur), 0
+}
+
+// completeRooms merges the rooms and groups named in config with the AirPlay
+// devices in the device cache while it is fresh, or else those Music.app
+// lists if it is already running, or else a stale cache.
+func completeRooms(ctx context.Context) []string {
+	var words []string
+	if cfg, err := loadConfigOptional(); err == nil {
+		_, words, _ = completionData(cfg)
+	}
+	devs, cachedAt, ok := cachedDevices()
+	if !ok || time.Since(cachedAt) >= music.DefaultDeviceCacheTTL {
+		listCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		if running, err := musicAppRunning(listCtx); err == nil && running {
+			fresh, err := listAirPlayDevices(listCtx)
+			if err != nil {
+				debugf("__complete: list devices: %v", err)
+			} else {
+				devs = fresh
+			}
+		}
+	}
+	for _, d := range devs {
+		words = append(words, d.Name)
+	}
+	return words
+}
+
+// completeEQPresets lists Music.app's EQ presets if it is already running.
+func completeEQPresets(ctx context.Context) []string {
+	listCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	var words []string
+	if running, err := musicAppRunning(listCtx); err == nil && running {
+		presets, err := listEQPresets(listCtx)
+		if err != nil {
+			debugf("__complete: list EQ presets: %v", err)
+		}
+		for _, p := range presets {
+			words = append(words, p.Name)
+		}
+	}
+	return words
+}
+
+// completePlaylists merges the playlists named in config with the playlist
+// cache. Without a cache it builds one, but only if Music.app is already
+// running and answers quickly; a prompt must not launch Music.app.
+func completePlaylists(ctx context.Context) []string {
+	var words []string
+	if cfg, err := loadConfigOptional(); err == nil {
+		_, _, words = completionData(cfg)
+	}
+	playlists, ok := cachedPlaylists()
+	if !ok {
+		refreshCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if running, err := musicAppRunning(refreshCtx); err == nil && running {
+			fresh, err := refreshPlaylistCache(refreshCtx)
+			if err != nil {
+				debugf("__complete: refresh playlist cache: %v", err)
+			}
+			playlists = fresh
+		}
+	}
+	for _, p := range playlists {
+		words = append(words, p.Name)
+	}
+	return words
+}
+
+// completePlaylistFolders lists the folder names in the playlist cache; it
+// never asks Music.app.
+func completePlaylistFolders() []string {
+	playlists, _ := cachedPlaylists()
+	var words []string
+	for _, p := range playlists {
+		if p.Folder != "" && !containsString(words, p.Folder) {
+			words = append(words, p.Folder)
+		}
+	}
+	return words
+}
+
+// completeConfigPaths offers the populated config paths; for config set it
+// adds the settable scalar paths and the fields of existing aliases.
+func completeConfigPaths(settable bool) []string {
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		return nil
+	}
+	var words []string
+	for _, e := range listConfigPaths(cfg, "") {
+		words = append(words, e.Path)
+	}
+	if !settable {
+		return words
+	}
+	words = append(words,
+		"defaults.backend", "defaults.engine", "defaults.launch", "defaults.shuffle", "defaults.volume", "defaults.maxVolume", "defaults.rooms",
+		"defaults.timeouts.applescript", "defaults.timeouts.shortcuts", "defaults.retries.count", "defaults.retries.backoff",
+		"scrobble.lastfm.apiKey", "scrobble.lastfm.apiSecret", "scrobble.lastfm.sessionKey",
+		"scrobble.listenbrainz.token", "scrobble.listenbrainz.url",
+		"appleMusic.developerToken", "appleMusic.userToken", "appleMusic.storefront")
+	aliases, _, _ := completionData(cfg)
+	for _, a := range aliases {
+		for _, field := range []string{"backend", "rooms", "playlist", "playlistId", "station", "shuffle", "shuffleMode", "eq", "volume", "shortcut", "sequence"} {
+			words = append(words, "aliases."+a+"."+field)
+		}
+	}
+	for name := range cfg.QuietHours {
+		for _, field := range []string{"rooms", "maxVolume", "play"} {
+			words = append(words, "quietHours."+name+"."+field)
+		}
+	}
+	return words
+}
+
+// unquoteCompletionWord undoes the shell quoting a word may still carry
+// while it is being typed: backslash escapes and an opening quote.
+func unquoteCompletionWord(w string) string {
+	if len(w) > 0 && (w[0] == '"' || w[0] == '\'') {
+		q := w[0]
+		w = strings.TrimSuffix(w[1:], string(q))
+	}
+	if !strings.Contains(w, `\`) {
+		return w
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range w {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// filterCompletions keeps the candidates starting with prefix, ignoring
+// case, without duplicates; values without descriptions are sorted.
+func filterCompletions(cands []completionCandidate, prefix string) []completionCandidate {
+	prefix = strings.ToLower(prefix)
+	seen := map[string]bool{}
+	var out []completionCandidate
+	sorted := true
+	for _, c := range cands {
+		c.Value = strings.TrimSpace(c.Value)
+		if c.Value == "" || seen[c.Value] || !strings.HasPrefix(strings.ToLower(c.Value), prefix) {
+			continue
+		}
+		seen[c.Value] = true
+		if c.Desc != "" {
+			sorted = false
+		}
+		out = append(out, c)
+	}
+	if sorted {
+		sort.SliceStable(out, func(i, j int) bool { return strings.ToLower(out[i].Value) < strings.ToLower(out[j].Value) })
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
 )
 
 type configValidateResult struct {
@@ -17,7 +20,7 @@ type configValidateResult struct {
 
 func cmdConfig(args []string) {
 	if len(args) == 0 {
-		die(usageErrf("usage: homepodctl config <validate|get|set> [args]"))
+		die(usageErrf("usage: homepodctl config <validate|get|set|unset|list|wizard|profile|export|import> [args]"))
 	}
 	switch args[0] {
 	case "validate":
@@ -26,30 +29,51 @@ func cmdConfig(args []string) {
 		cmdConfigGet(args[1:])
 	case "set":
 		cmdConfigSet(args[1:])
+	case "unset":
+		cmdConfigUnset(args[1:])
+	case "list":
+		cmdConfigList(args[1:])
+	case "wizard":
+		cmdConfigWizard(args[1:])
+	case "profile":
+		cmdConfigProfile(args[1:])
+	case "export":
+		cmdConfigExport(args[1:])
+	case "import":
+		cmdConfigImport(args[1:])
 	default:
 		die(usageErrf("unknown config subcommand: %q", args[0]))
 	}
 }
 
 func cmdConfigValidate(args []string) {
-	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
-	jsonOut := fs.Bool("json", false, "output JSON")
-	if err := fs.Parse(args); err != nil {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
 		die(usageErrf("usage: homepodctl config validate [--json]"))
 	}
+	jsonOut, _, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
 	cfg, err := loadConfigOptional()
 	if err != nil {
 		die(err)
 	}
 	path, _ := configPath()
 	issues := validateConfigValues(cfg)
+	shortcutsCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	missing, _ := missingShortcutIssues(shortcutsCtx, cfg)
+	cancel()
+	issues = append(issues, missing...)
 	res := configValidateResult{
 		OK:     len(issues) == 0,
 		Path:   path,
 		Errors: issues,
 	}
-	if *jsonOut {
+	if jsonOut {
 		writeJSON(res)
 		return
 	}
@@ -63,6 +87,9 @@ func cmdConfigValidate(args []string) {
 	for _, issue := range res.Errors {
 		fmt.Printf("- %s\n", issue)
 	}
+	if len(missing) > 0 {
+		fmt.Printf("tip: %s\n", missingShortcutTip)
+	}
 	exitCode(exitUsage)
 }
 
@@ -94,22 +121,23 @@ func cmdConfigGet(args []string) {
 	switch v := value.(type) {
 	case []string:
 		fmt.Println(strings.Join(v, "\t"))
+	case native.Scene:
+		writeJSON(v)
 	default:
 		fmt.Printf("%v\n", v)
 	}
 }
 
 func cmdConfigSet(args []string) {
-	fs := flag.NewFlagSet("config set", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
-	if err := fs.Parse(args); err != nil {
-		die(usageErrf("usage: homepodctl config set <path> <value...>"))
+	_, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
 	}
-	if fs.NArg() < 2 {
+	if len(positionals) < 2 {
 		die(usageErrf("usage: homepodctl config set <path> <value...>"))
 	}
-	key := strings.TrimSpace(fs.Arg(0))
-	values := fs.Args()[1:]
+	key := strings.TrimSpace(positionals[0])
+	values := positionals[1:]
 
 	cfg, err := loadConfigOptional()
 	if err != nil {
@@ -126,6 +154,12 @@ func cmdConfigSet(args []string) {
 	if err != nil {
 		die(err)
 	}
+	if dryRunAll {
+		if !quiet {
+			fmt.Printf("dry-run: would update %s (%s)\n", path, key)
+		}
+		return
+	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		die(err)
 	}
@@ -140,3 +174,75 @@ func cmdConfigSet(args []string) {
 		fmt.Printf("Updated %s (%s)\n", path, key)
 	}
 }
+
+func cmdConfigUnset(args []string) {
+	_, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 1 {
+		die(usageErrf("usage: homepodctl config unset <path>"))
+	}
+	key := strings.TrimSpace(positionals[0])
+
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		die(err)
+	}
+	if err := unsetConfigPathValue(cfg, key); err != nil {
+		die(err)
+	}
+	if issues := validateConfigValues(cfg); len(issues) > 0 {
+		die(usageErrf("updated config is invalid: %s", strings.Join(issues, "; ")))
+	}
+	path, _ := configPath()
+	if dryRunAll {
+		if !quiet {
+			fmt.Printf("dry-run: would update %s (unset %s)\n", path, key)
+		}
+		return
+	}
+	if err := saveConfig(cfg); err != nil {
+		die(err)
+	}
+	if !quiet {
+		fmt.Printf("Updated %s (unset %s)\n", path, key)
+	}
+}
+
+func cmdConfigList(args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) > 1 {
+		die(usageErrf("usage: homepodctl config list [--json] [<prefix>]"))
+	}
+	jsonOut, _, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	prefix := ""
+	if len(positionals) == 1 {
+		prefix = positionals[0]
+	}
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		die(err)
+	}
+	entries := listConfigPaths(cfg, prefix)
+	if jsonOut {
+		if entries == nil {
+			entries = []configPathEntry{}
+		}
+		writeJSON(entries)
+		return
+	}
+	for _, e := range entries {
+		value := fmt.Sprintf("%v", e.Value)
+		if rooms, ok := e.Value.([]string); ok {
+			value = strings.Join(rooms, ",")
+		}
+		fmt.Printf("%s\t%s\n", e.Path, value)
+	}
+}
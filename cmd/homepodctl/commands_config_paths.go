@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/transport"
 )
 
 func validateConfigValues(cfg *native.Config) []string {
@@ -18,11 +22,43 @@ func validateConfigValues(cfg *native.Config) []string {
 	if cfg.Defaults.Volume != nil && (*cfg.Defaults.Volume < 0 || *cfg.Defaults.Volume > 100) {
 		issues = append(issues, fmt.Sprintf("defaults.volume must be 0..100, got %d", *cfg.Defaults.Volume))
 	}
+	if cfg.Defaults.MaxVolume != nil && (*cfg.Defaults.MaxVolume < 0 || *cfg.Defaults.MaxVolume > 100) {
+		issues = append(issues, fmt.Sprintf("defaults.maxVolume must be 0..100, got %d", *cfg.Defaults.MaxVolume))
+	}
+	switch cfg.Defaults.Engine {
+	case "", "jxa", "applescript":
+	default:
+		issues = append(issues, fmt.Sprintf("defaults.engine must be jxa|applescript, got %q", cfg.Defaults.Engine))
+	}
+	switch cfg.Defaults.Launch {
+	case "", "hidden", "foreground", "off":
+	default:
+		issues = append(issues, fmt.Sprintf("defaults.launch must be hidden|foreground|off, got %q", cfg.Defaults.Launch))
+	}
 	for i, room := range cfg.Defaults.Rooms {
 		if strings.TrimSpace(room) == "" {
 			issues = append(issues, fmt.Sprintf("defaults.rooms[%d] must be non-empty", i))
 		}
 	}
+	if t := cfg.Defaults.Timeouts; t != nil {
+		for _, key := range []string{"defaults.timeouts.applescript", "defaults.timeouts.shortcuts", "defaults.timeouts.hooks"} {
+			if v := *timeoutConfigField(t, key); v != "" {
+				if _, err := parseConfigTimeout(v); err != nil {
+					issues = append(issues, fmt.Sprintf("%s %v", key, err))
+				}
+			}
+		}
+	}
+	if r := cfg.Defaults.Retries; r != nil {
+		if r.Count != nil && (*r.Count < 0 || *r.Count > maxRetries) {
+			issues = append(issues, fmt.Sprintf("defaults.retries.count must be 0..%d, got %d", maxRetries, *r.Count))
+		}
+		if r.Backoff != "" {
+			if _, err := parseConfigTimeout(r.Backoff); err != nil {
+				issues = append(issues, fmt.Sprintf("defaults.retries.backoff %v", err))
+			}
+		}
+	}
 	for name, a := range cfg.Aliases {
 		if strings.TrimSpace(name) == "" {
 			issues = append(issues, "aliases key must be non-empty")
@@ -38,16 +74,133 @@ func validateConfigValues(cfg *native.Config) []string {
 		if a.Volume != nil && (*a.Volume < 0 || *a.Volume > 100) {
 			issues = append(issues, fmt.Sprintf("aliases.%s.volume must be 0..100, got %d", name, *a.Volume))
 		}
+		if a.ShuffleMode != "" && !isShuffleMode(a.ShuffleMode) {
+			issues = append(issues, fmt.Sprintf("aliases.%s.shuffleMode must be songs|albums|groupings, got %q", name, a.ShuffleMode))
+		}
+		if len(a.Sequence) > 0 && (a.Playlist != "" || a.PlaylistID != "" || a.Station != "" || a.Shortcut != "") {
+			issues = append(issues, fmt.Sprintf("aliases.%s.sequence cannot be combined with playlist, playlistId, station, or shortcut", name))
+		}
+		if a.Station != "" {
+			if a.Playlist != "" || a.PlaylistID != "" || a.Shortcut != "" {
+				issues = append(issues, fmt.Sprintf("aliases.%s.station cannot be combined with playlist, playlistId, or shortcut", name))
+			}
+			if backend := a.Backend; backend == "native" || (backend == "" && cfg.Defaults.Backend == "native") {
+				issues = append(issues, fmt.Sprintf("aliases.%s.station needs backend airplay", name))
+			}
+		}
+		for i, step := range a.Sequence {
+			if _, ok := cfg.Aliases[step]; !ok && !isAutomationFileRef(step) {
+				issues = append(issues, fmt.Sprintf("aliases.%s.sequence[%d] %q is not an alias or automation file (.yaml, .yml, .json)", name, i, step))
+			}
+		}
+		if cycle := cfg.AliasCycle(name); cycle != nil && cycle[0] == name {
+			issues = append(issues, fmt.Sprintf("aliases.%s.sequence has a cycle: %s", name, strings.Join(cycle, " → ")))
+		}
+	}
+	for name := range cfg.Scenes {
+		if strings.TrimSpace(name) == "" {
+			issues = append(issues, "scenes key must be non-empty")
+			continue
+		}
+		if _, err := sceneAutomation(cfg, name); err != nil {
+			issues = append(issues, err.Error())
+		}
+	}
+	for name, members := range cfg.Groups {
+		if strings.TrimSpace(name) == "" {
+			issues = append(issues, "groups key must be non-empty")
+		}
+		if len(members) == 0 {
+			issues = append(issues, fmt.Sprintf("groups.%s must list at least one room", name))
+		}
+		for i, room := range members {
+			if strings.TrimSpace(room) == "" {
+				issues = append(issues, fmt.Sprintf("groups.%s[%d] must be non-empty", name, i))
+			}
+		}
+	}
+	for name, device := range cfg.Devices {
+		if strings.TrimSpace(name) == "" {
+			issues = append(issues, "devices key must be non-empty")
+		}
+		if strings.TrimSpace(device) == "" {
+			issues = append(issues, fmt.Sprintf("devices.%s must name an AirPlay device", name))
+		}
+		for group := range cfg.Groups {
+			if strings.EqualFold(strings.TrimSpace(group), strings.TrimSpace(name)) {
+				issues = append(issues, fmt.Sprintf("devices.%s is also a group name", name))
+			}
+		}
+	}
+	for room, offset := range cfg.VolumeOffsets {
+		if strings.TrimSpace(room) == "" {
+			issues = append(issues, "volumeOffsets room key must be non-empty")
+		}
+		if offset < -100 || offset > 100 {
+			issues = append(issues, fmt.Sprintf("volumeOffsets.%s must be -100..100, got %d", room, offset))
+		}
+	}
+	for room, limit := range cfg.MaxVolumes {
+		if strings.TrimSpace(room) == "" {
+			issues = append(issues, "maxVolumes room key must be non-empty")
+		}
+		if limit < 0 || limit > 100 {
+			issues = append(issues, fmt.Sprintf("maxVolumes.%s must be 0..100, got %d", room, limit))
+		}
+	}
+	for name, q := range cfg.QuietHours {
+		if strings.TrimSpace(name) == "" {
+			issues = append(issues, "quietHours name must be non-empty")
+		}
+		if err := q.Validate(); err != nil {
+			issues = append(issues, fmt.Sprintf("quietHours.%s.%v", name, err))
+		}
+	}
+	for name, command := range cfg.Hooks {
+		if !isHookName(name) {
+			issues = append(issues, fmt.Sprintf("hooks.%s is not a hook (expected pre or post and a command, e.g. postPlay)", name))
+		}
+		if strings.TrimSpace(command) == "" {
+			issues = append(issues, fmt.Sprintf("hooks.%s must be non-empty", name))
+		}
+	}
+	for name, r := range cfg.Remotes {
+		if err := transport.ValidHost(r.Host); err != nil {
+			issues = append(issues, fmt.Sprintf("remotes.%s.host: %v", name, err))
+		}
+		if r.Port < 0 || r.Port > 65535 {
+			issues = append(issues, fmt.Sprintf("remotes.%s.port must be 1..65535, got %d", name, r.Port))
+		}
+	}
+	if sc := cfg.Scrobble; sc != nil {
+		lf := sc.LastFM
+		set := 0
+		for _, v := range []string{lf.APIKey, lf.APISecret, lf.SessionKey} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 0 && set != 3 {
+			issues = append(issues, "scrobble.lastfm needs apiKey, apiSecret, and sessionKey")
+		}
+	}
+	if am := cfg.AppleMusic; am != nil {
+		if am.UserToken != "" && am.DeveloperToken == "" {
+			issues = append(issues, "appleMusic.userToken needs appleMusic.developerToken")
+		}
+		if sf := am.Storefront; sf != "" && (len(sf) != 2 || strings.ToLower(sf) != sf) {
+			issues = append(issues, fmt.Sprintf("appleMusic.storefront must be a two-letter lowercase country code, got %q", sf))
+		}
 	}
 	for room, mappings := range cfg.Native.Playlists {
 		if strings.TrimSpace(room) == "" {
 			issues = append(issues, "native.playlists room key must be non-empty")
 		}
-		for playlist, shortcut := range mappings {
+		for playlist, m := range mappings {
 			if strings.TrimSpace(playlist) == "" {
 				issues = append(issues, fmt.Sprintf("native.playlists.%s playlist key must be non-empty", room))
 			}
-			if strings.TrimSpace(shortcut) == "" {
+			if strings.TrimSpace(m.Shortcut) == "" {
 				issues = append(issues, fmt.Sprintf("native.playlists.%s.%s shortcut must be non-empty", room, playlist))
 			}
 		}
@@ -73,6 +226,10 @@ func getConfigPathValue(cfg *native.Config, key string) (any, error) {
 	switch key {
 	case "defaults.backend":
 		return cfg.Defaults.Backend, nil
+	case "defaults.engine":
+		return cfg.Defaults.Engine, nil
+	case "defaults.launch":
+		return cfg.Defaults.Launch, nil
 	case "defaults.shuffle":
 		return cfg.Defaults.Shuffle, nil
 	case "defaults.volume":
@@ -80,11 +237,160 @@ func getConfigPathValue(cfg *native.Config, key string) (any, error) {
 			return nil, nil
 		}
 		return *cfg.Defaults.Volume, nil
+	case "defaults.maxVolume":
+		if cfg.Defaults.MaxVolume == nil {
+			return nil, nil
+		}
+		return *cfg.Defaults.MaxVolume, nil
 	case "defaults.rooms":
 		return append([]string(nil), cfg.Defaults.Rooms...), nil
+	case "defaults.timeouts.applescript", "defaults.timeouts.shortcuts", "defaults.timeouts.hooks":
+		if cfg.Defaults.Timeouts == nil {
+			return "", nil
+		}
+		return *timeoutConfigField(cfg.Defaults.Timeouts, key), nil
+	case "defaults.retries.count":
+		if cfg.Defaults.Retries == nil || cfg.Defaults.Retries.Count == nil {
+			return nil, nil
+		}
+		return *cfg.Defaults.Retries.Count, nil
+	case "defaults.retries.backoff":
+		if cfg.Defaults.Retries == nil {
+			return "", nil
+		}
+		return cfg.Defaults.Retries.Backoff, nil
 	}
 
 	parts := strings.Split(key, ".")
+	if len(parts) == 2 && parts[0] == "scenes" {
+		sc, ok := cfg.Scenes[parts[1]]
+		if !ok {
+			return nil, usageErrf("unknown scene %q", parts[1])
+		}
+		return sc, nil
+	}
+	if len(parts) >= 2 && parts[0] == "groups" {
+		if len(parts) != 2 {
+			return nil, usageErrf("unsupported config path %q", key)
+		}
+		groupName := strings.TrimSpace(parts[1])
+		if groupName == "" {
+			return nil, usageErrf("group name must be non-empty in path %q", key)
+		}
+		members, ok := cfg.Groups[groupName]
+		if !ok {
+			return nil, usageErrf("unknown group %q", groupName)
+		}
+		return append([]string(nil), members...), nil
+	}
+	if len(parts) >= 2 && parts[0] == "devices" {
+		name := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if name == "" {
+			return nil, usageErrf("device alias must be non-empty in path %q", key)
+		}
+		device, ok := cfg.Devices[name]
+		if !ok {
+			return nil, nil
+		}
+		return device, nil
+	}
+	if len(parts) >= 2 && parts[0] == "volumeOffsets" {
+		room := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if room == "" {
+			return nil, usageErrf("room must be non-empty in path %q", key)
+		}
+		offset, ok := cfg.VolumeOffsets[room]
+		if !ok {
+			return nil, usageErrf("volume offset for room %q not found", room)
+		}
+		return offset, nil
+	}
+	if len(parts) >= 2 && parts[0] == "maxVolumes" {
+		room := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if room == "" {
+			return nil, usageErrf("room must be non-empty in path %q", key)
+		}
+		limit, ok := cfg.MaxVolumes[room]
+		if !ok {
+			return nil, nil
+		}
+		return limit, nil
+	}
+	if len(parts) >= 2 && parts[0] == "quietHours" {
+		q, ok := cfg.QuietHours[parts[1]]
+		if !ok {
+			return nil, usageErrf("unknown quiet hours %q", parts[1])
+		}
+		if len(parts) == 2 {
+			return q, nil
+		}
+		switch strings.Join(parts[2:], ".") {
+		case "start":
+			return q.Start, nil
+		case "end":
+			return q.End, nil
+		case "rooms":
+			return append([]string(nil), q.Rooms...), nil
+		case "maxVolume":
+			if q.MaxVolume == nil {
+				return nil, nil
+			}
+			return *q.MaxVolume, nil
+		case "play":
+			return quietPlayMode(q), nil
+		}
+		return nil, usageErrf("unsupported config path %q", key)
+	}
+	if len(parts) == 2 && parts[0] == "hooks" {
+		if !isHookName(parts[1]) {
+			return nil, usageErrf("unknown hook %q (expected pre or post and a command, e.g. postPlay)", parts[1])
+		}
+		command, ok := cfg.Hooks[parts[1]]
+		if !ok {
+			return nil, nil
+		}
+		return command, nil
+	}
+	if len(parts) == 3 && parts[0] == "remotes" {
+		r, ok := cfg.Remotes[parts[1]]
+		if !ok {
+			return nil, usageErrf("unknown remote %q", parts[1])
+		}
+		switch parts[2] {
+		case "host":
+			return r.Host, nil
+		case "port":
+			if r.Port == 0 {
+				return nil, nil
+			}
+			return r.Port, nil
+		case "identity":
+			return r.Identity, nil
+		}
+		return nil, usageErrf("unsupported config path %q", key)
+	}
+	if len(parts) >= 2 && parts[0] == "scrobble" {
+		sc := cfg.Scrobble
+		if sc == nil {
+			sc = &native.ScrobbleConfig{}
+		}
+		field := scrobbleConfigField(sc, key)
+		if field == nil {
+			return nil, usageErrf("unsupported config path %q", key)
+		}
+		return *field, nil
+	}
+	if len(parts) == 2 && parts[0] == "appleMusic" {
+		am := cfg.AppleMusic
+		if am == nil {
+			am = &native.AppleMusicConfig{}
+		}
+		field := appleMusicConfigField(am, key)
+		if field == nil {
+			return nil, usageErrf("unsupported config path %q", key)
+		}
+		return *field, nil
+	}
 	if len(parts) >= 3 && parts[0] == "aliases" {
 		aliasName := strings.TrimSpace(parts[1])
 		if aliasName == "" {
@@ -106,11 +412,17 @@ func getConfigPathValue(cfg *native.Config, key string) (any, error) {
 			return a.Playlist, nil
 		case "playlistId":
 			return a.PlaylistID, nil
+		case "station":
+			return a.Station, nil
 		case "shuffle":
 			if a.Shuffle == nil {
 				return nil, nil
 			}
 			return *a.Shuffle, nil
+		case "shuffleMode":
+			return a.ShuffleMode, nil
+		case "eq":
+			return a.EQ, nil
 		case "volume":
 			if a.Volume == nil {
 				return nil, nil
@@ -118,12 +430,14 @@ func getConfigPathValue(cfg *native.Config, key string) (any, error) {
 			return *a.Volume, nil
 		case "shortcut":
 			return a.Shortcut, nil
+		case "sequence":
+			return append([]string(nil), a.Sequence...), nil
 		default:
 			return nil, usageErrf("unsupported config path %q", key)
 		}
 	}
 	if len(parts) >= 4 && parts[0] == "native" && parts[1] == "playlists" {
-		if len(parts) != 4 {
+		if len(parts) > 5 || (len(parts) == 5 && parts[4] != "input") {
 			return nil, usageErrf("unsupported config path %q", key)
 		}
 		room := strings.TrimSpace(parts[2])
@@ -131,7 +445,10 @@ func getConfigPathValue(cfg *native.Config, key string) (any, error) {
 		if room == "" || playlist == "" {
 			return nil, usageErrf("native playlists path must include non-empty room and playlist: %q", key)
 		}
-		return cfg.Native.Playlists[room][playlist], nil
+		if len(parts) == 5 {
+			return cfg.Native.Playlists[room][playlist].Input, nil
+		}
+		return cfg.Native.Playlists[room][playlist].Shortcut, nil
 	}
 	if len(parts) >= 4 && parts[0] == "native" && parts[1] == "volumeShortcuts" {
 		if len(parts) != 4 {
@@ -159,6 +476,26 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 		}
 		cfg.Defaults.Backend = v
 		return nil
+	case "defaults.engine":
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if v != "jxa" && v != "applescript" {
+			return usageErrf("%s must be jxa|applescript", key)
+		}
+		cfg.Defaults.Engine = v
+		return nil
+	case "defaults.launch":
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if v != "hidden" && v != "foreground" && v != "off" {
+			return usageErrf("%s must be hidden|foreground|off", key)
+		}
+		cfg.Defaults.Launch = v
+		return nil
 	case "defaults.shuffle":
 		if len(values) != 1 {
 			return usageErrf("%s expects exactly 1 value", key)
@@ -172,20 +509,58 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 			return usageErrf("%s expects boolean true|false", key)
 		}
 		return nil
-	case "defaults.volume":
+	case "defaults.volume", "defaults.maxVolume":
 		if len(values) != 1 {
 			return usageErrf("%s expects exactly 1 value", key)
 		}
+		field := &cfg.Defaults.Volume
+		if key == "defaults.maxVolume" {
+			field = &cfg.Defaults.MaxVolume
+		}
 		v := strings.TrimSpace(values[0])
 		if v == "null" {
-			cfg.Defaults.Volume = nil
+			*field = nil
 			return nil
 		}
 		n, err := strconv.Atoi(v)
 		if err != nil || n < 0 || n > 100 {
 			return usageErrf("%s expects 0..100 or null", key)
 		}
-		cfg.Defaults.Volume = &n
+		*field = &n
+		return nil
+	case "defaults.timeouts.applescript", "defaults.timeouts.shortcuts", "defaults.timeouts.hooks":
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if _, err := parseConfigTimeout(v); err != nil {
+			return usageErrf("%s %v", key, err)
+		}
+		if cfg.Defaults.Timeouts == nil {
+			cfg.Defaults.Timeouts = &native.TimeoutsConfig{}
+		}
+		*timeoutConfigField(cfg.Defaults.Timeouts, key) = v
+		return nil
+	case "defaults.retries.count", "defaults.retries.backoff":
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if cfg.Defaults.Retries == nil {
+			cfg.Defaults.Retries = &native.RetriesConfig{}
+		}
+		if key == "defaults.retries.backoff" {
+			if _, err := parseConfigTimeout(v); err != nil {
+				return usageErrf("%s %v", key, err)
+			}
+			cfg.Defaults.Retries.Backoff = v
+			return nil
+		}
+		n, err := parseRetries(v)
+		if err != nil {
+			return usageErrf("%s %v", key, err)
+		}
+		cfg.Defaults.Retries.Count = &n
 		return nil
 	case "defaults.rooms":
 		rooms := make([]string, 0, len(values))
@@ -201,6 +576,187 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 	}
 
 	parts := strings.Split(key, ".")
+	if parts[0] == "scenes" {
+		return usageErrf("scenes hold automation steps; edit them in config.json (see `homepodctl scene`)")
+	}
+	if len(parts) >= 2 && parts[0] == "groups" {
+		if len(parts) != 2 {
+			return usageErrf("unsupported config path %q", key)
+		}
+		groupName := strings.TrimSpace(parts[1])
+		if groupName == "" {
+			return usageErrf("group name must be non-empty in path %q", key)
+		}
+		if len(values) == 0 {
+			return usageErrf("%s expects at least 1 room", key)
+		}
+		rooms := make([]string, 0, len(values))
+		for _, v := range values {
+			r := strings.TrimSpace(v)
+			if r == "" {
+				return usageErrf("%s values must be non-empty", key)
+			}
+			rooms = append(rooms, r)
+		}
+		if cfg.Groups == nil {
+			cfg.Groups = map[string][]string{}
+		}
+		cfg.Groups[groupName] = rooms
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "devices" {
+		name := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if name == "" {
+			return usageErrf("device alias must be non-empty in path %q", key)
+		}
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 AirPlay device name", key)
+		}
+		device := strings.TrimSpace(values[0])
+		if device == "" {
+			return usageErrf("%s value must be non-empty", key)
+		}
+		if cfg.Devices == nil {
+			cfg.Devices = map[string]string{}
+		}
+		cfg.Devices[name] = device
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "volumeOffsets" {
+		room := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if room == "" {
+			return usageErrf("room must be non-empty in path %q", key)
+		}
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if v == "null" {
+			delete(cfg.VolumeOffsets, room)
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < -100 || n > 100 {
+			return usageErrf("%s expects -100..100 or null", key)
+		}
+		if cfg.VolumeOffsets == nil {
+			cfg.VolumeOffsets = map[string]int{}
+		}
+		cfg.VolumeOffsets[room] = n
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "maxVolumes" {
+		room := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if room == "" {
+			return usageErrf("room must be non-empty in path %q", key)
+		}
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if v == "null" {
+			delete(cfg.MaxVolumes, room)
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 100 {
+			return usageErrf("%s expects 0..100 or null", key)
+		}
+		if cfg.MaxVolumes == nil {
+			cfg.MaxVolumes = map[string]int{}
+		}
+		cfg.MaxVolumes[room] = n
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "quietHours" {
+		return setQuietHoursPath(cfg, key, parts, values)
+	}
+	if len(parts) == 2 && parts[0] == "hooks" {
+		if !isHookName(parts[1]) {
+			return usageErrf("unknown hook %q (expected pre or post and a command, e.g. postPlay)", parts[1])
+		}
+		if len(values) != 1 || strings.TrimSpace(values[0]) == "" {
+			return usageErrf("%s expects exactly 1 non-empty value (quote the command)", key)
+		}
+		if cfg.Hooks == nil {
+			cfg.Hooks = map[string]string{}
+		}
+		cfg.Hooks[parts[1]] = strings.TrimSpace(values[0])
+		return nil
+	}
+	if len(parts) == 3 && parts[0] == "remotes" {
+		name := strings.TrimSpace(parts[1])
+		if name == "" {
+			return usageErrf("remote name must be non-empty in path %q", key)
+		}
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		r := cfg.Remotes[name]
+		switch parts[2] {
+		case "host":
+			if err := transport.ValidHost(v); err != nil {
+				return usageErrf("%s: %v", key, err)
+			}
+			r.Host = v
+		case "port":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 65535 {
+				return usageErrf("%s expects 1..65535", key)
+			}
+			r.Port = n
+		case "identity":
+			r.Identity = v
+		default:
+			return usageErrf("unsupported config path %q", key)
+		}
+		if cfg.Remotes == nil {
+			cfg.Remotes = map[string]native.Remote{}
+		}
+		cfg.Remotes[name] = r
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "scrobble" {
+		sc := cfg.Scrobble
+		if sc == nil {
+			sc = &native.ScrobbleConfig{}
+		}
+		field := scrobbleConfigField(sc, key)
+		if field == nil {
+			return usageErrf("unsupported config path %q", key)
+		}
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if v == "null" {
+			v = ""
+		}
+		*field = v
+		cfg.Scrobble = sc
+		return nil
+	}
+	if len(parts) == 2 && parts[0] == "appleMusic" {
+		am := cfg.AppleMusic
+		if am == nil {
+			am = &native.AppleMusicConfig{}
+		}
+		field := appleMusicConfigField(am, key)
+		if field == nil {
+			return usageErrf("unsupported config path %q", key)
+		}
+		if len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		v := strings.TrimSpace(values[0])
+		if v == "null" {
+			v = ""
+		}
+		*field = v
+		cfg.AppleMusic = am
+		return nil
+	}
 	if len(parts) >= 3 && parts[0] == "aliases" {
 		if len(parts) != 3 {
 			return usageErrf("unsupported config path %q", key)
@@ -244,6 +800,11 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 				return usageErrf("%s expects exactly 1 value", key)
 			}
 			a.PlaylistID = strings.TrimSpace(values[0])
+		case "station":
+			if len(values) != 1 {
+				return usageErrf("%s expects exactly 1 value", key)
+			}
+			a.Station = strings.TrimSpace(values[0])
 		case "shuffle":
 			if len(values) != 1 {
 				return usageErrf("%s expects exactly 1 value", key)
@@ -264,14 +825,28 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 				return usageErrf("%s expects boolean true|false or null", key)
 			}
 			a.Shuffle = &b
-		case "volume":
+		case "shuffleMode":
 			if len(values) != 1 {
 				return usageErrf("%s expects exactly 1 value", key)
 			}
-			v := strings.TrimSpace(values[0])
-			if v == "null" {
-				a.Volume = nil
-				cfg.Aliases[aliasName] = a
+			v := strings.ToLower(strings.TrimSpace(values[0]))
+			if v != "" && !isShuffleMode(v) {
+				return usageErrf("%s must be songs|albums|groupings", key)
+			}
+			a.ShuffleMode = v
+		case "eq":
+			if len(values) != 1 {
+				return usageErrf("%s expects exactly 1 value", key)
+			}
+			a.EQ = strings.TrimSpace(values[0])
+		case "volume":
+			if len(values) != 1 {
+				return usageErrf("%s expects exactly 1 value", key)
+			}
+			v := strings.TrimSpace(values[0])
+			if v == "null" {
+				a.Volume = nil
+				cfg.Aliases[aliasName] = a
 				return nil
 			}
 			n, err := strconv.Atoi(v)
@@ -284,6 +859,16 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 				return usageErrf("%s expects exactly 1 value", key)
 			}
 			a.Shortcut = strings.TrimSpace(values[0])
+		case "sequence":
+			steps := make([]string, 0, len(values))
+			for _, v := range values {
+				step := strings.TrimSpace(v)
+				if step == "" {
+					return usageErrf("%s values must be non-empty", key)
+				}
+				steps = append(steps, step)
+			}
+			a.Sequence = steps
 		default:
 			return usageErrf("unsupported config path %q", key)
 		}
@@ -291,7 +876,7 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 		return nil
 	}
 	if len(parts) >= 4 && parts[0] == "native" && parts[1] == "playlists" {
-		if len(parts) != 4 {
+		if len(parts) > 5 || (len(parts) == 5 && parts[4] != "input") {
 			return usageErrf("unsupported config path %q", key)
 		}
 		if len(values) != 1 {
@@ -299,17 +884,28 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 		}
 		room := strings.TrimSpace(parts[2])
 		playlist := strings.TrimSpace(parts[3])
+		if len(parts) == 5 {
+			m, ok := cfg.Native.Playlists[room][playlist]
+			if !ok {
+				return usageErrf("%s: set native.playlists.%s.%s to a shortcut first", key, room, playlist)
+			}
+			m.Input = values[0]
+			cfg.Native.Playlists[room][playlist] = m
+			return nil
+		}
 		shortcut := strings.TrimSpace(values[0])
 		if room == "" || playlist == "" || shortcut == "" {
 			return usageErrf("%s expects non-empty room, playlist, and shortcut", key)
 		}
 		if cfg.Native.Playlists == nil {
-			cfg.Native.Playlists = map[string]map[string]string{}
+			cfg.Native.Playlists = map[string]map[string]native.PlaylistShortcut{}
 		}
 		if cfg.Native.Playlists[room] == nil {
-			cfg.Native.Playlists[room] = map[string]string{}
+			cfg.Native.Playlists[room] = map[string]native.PlaylistShortcut{}
 		}
-		cfg.Native.Playlists[room][playlist] = shortcut
+		m := cfg.Native.Playlists[room][playlist]
+		m.Shortcut = shortcut
+		cfg.Native.Playlists[room][playlist] = m
 		return nil
 	}
 	if len(parts) >= 4 && parts[0] == "native" && parts[1] == "volumeShortcuts" {
@@ -340,3 +936,616 @@ func setConfigPathValue(cfg *native.Config, key string, values []string) error {
 	}
 	return usageErrf("unsupported config path %q", key)
 }
+
+// setQuietHoursPath handles quietHours.<name> <start> <end>, which creates or
+// moves a window, and quietHours.<name>.<field> for an existing one.
+func setQuietHoursPath(cfg *native.Config, key string, parts []string, values []string) error {
+	name := strings.TrimSpace(parts[1])
+	if name == "" {
+		return usageErrf("quiet hours name must be non-empty in path %q", key)
+	}
+	q, ok := cfg.QuietHours[name]
+	if len(parts) == 2 {
+		if len(values) != 2 {
+			return usageErrf("%s expects <start> <end> (HH:MM, e.g. 22:00 07:00)", key)
+		}
+		q.Start, q.End = strings.TrimSpace(values[0]), strings.TrimSpace(values[1])
+	} else {
+		if !ok {
+			return usageErrf("unknown quiet hours %q (create it with: homepodctl config set quietHours.%s <start> <end>)", name, name)
+		}
+		field := strings.Join(parts[2:], ".")
+		if field != "rooms" && len(values) != 1 {
+			return usageErrf("%s expects exactly 1 value", key)
+		}
+		switch field {
+		case "start", "end":
+			v := strings.TrimSpace(values[0])
+			if _, err := native.ParseClock(v); err != nil {
+				return usageErrf("%s: %v", key, err)
+			}
+			if field == "start" {
+				q.Start = v
+			} else {
+				q.End = v
+			}
+		case "rooms":
+			rooms := make([]string, 0, len(values))
+			for _, v := range values {
+				if r := strings.TrimSpace(v); r != "" {
+					rooms = append(rooms, r)
+				}
+			}
+			q.Rooms = rooms
+		case "maxVolume":
+			v := strings.TrimSpace(values[0])
+			if v == "null" {
+				q.MaxVolume = nil
+				break
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > 100 {
+				return usageErrf("%s expects 0..100 or null", key)
+			}
+			q.MaxVolume = &n
+		case "play":
+			v := strings.TrimSpace(values[0])
+			if v != "warn" && v != "block" {
+				return usageErrf("%s expects warn or block", key)
+			}
+			q.Play = v
+		default:
+			return usageErrf("unsupported config path %q", key)
+		}
+	}
+	if err := q.Validate(); err != nil {
+		return usageErrf("%s: %v", key, err)
+	}
+	if cfg.QuietHours == nil {
+		cfg.QuietHours = map[string]native.QuietHours{}
+	}
+	cfg.QuietHours[name] = q
+	return nil
+}
+
+// quietPlayMode is what play does inside q's window; empty means warn.
+func quietPlayMode(q native.QuietHours) string {
+	if q.Play == "" {
+		return "warn"
+	}
+	return q.Play
+}
+
+// scrobbleConfigField maps scrobble.* paths to their string fields in sc, or
+// returns nil for unknown paths.
+func scrobbleConfigField(sc *native.ScrobbleConfig, key string) *string {
+	switch key {
+	case "scrobble.lastfm.apiKey":
+		return &sc.LastFM.APIKey
+	case "scrobble.lastfm.apiSecret":
+		return &sc.LastFM.APISecret
+	case "scrobble.lastfm.sessionKey":
+		return &sc.LastFM.SessionKey
+	case "scrobble.listenbrainz.token":
+		return &sc.ListenBrainz.Token
+	case "scrobble.listenbrainz.url":
+		return &sc.ListenBrainz.URL
+	}
+	return nil
+}
+
+// appleMusicConfigField maps appleMusic.* paths to their fields in am, or
+// returns nil for unknown paths.
+func appleMusicConfigField(am *native.AppleMusicConfig, key string) *string {
+	switch key {
+	case "appleMusic.developerToken":
+		return &am.DeveloperToken
+	case "appleMusic.userToken":
+		return &am.UserToken
+	case "appleMusic.storefront":
+		return &am.Storefront
+	}
+	return nil
+}
+
+// unsetConfigPathValue removes the value at key: map entries (aliases, scenes,
+// groups, offsets, remotes, native mappings) are deleted, list entries can be removed by name
+// (e.g. defaults.rooms.Kitchen), and scalar fields return to their zero value.
+func unsetConfigPathValue(cfg *native.Config, key string) error {
+	switch key {
+	case "defaults.backend":
+		cfg.Defaults.Backend = ""
+		return nil
+	case "defaults.engine":
+		cfg.Defaults.Engine = ""
+		return nil
+	case "defaults.launch":
+		cfg.Defaults.Launch = ""
+		return nil
+	case "defaults.shuffle":
+		cfg.Defaults.Shuffle = false
+		return nil
+	case "defaults.volume":
+		cfg.Defaults.Volume = nil
+		return nil
+	case "defaults.maxVolume":
+		cfg.Defaults.MaxVolume = nil
+		return nil
+	case "defaults.rooms":
+		cfg.Defaults.Rooms = nil
+		return nil
+	case "defaults.timeouts.applescript", "defaults.timeouts.shortcuts", "defaults.timeouts.hooks":
+		if t := cfg.Defaults.Timeouts; t != nil {
+			*timeoutConfigField(t, key) = ""
+			if *t == (native.TimeoutsConfig{}) {
+				cfg.Defaults.Timeouts = nil
+			}
+		}
+		return nil
+	case "defaults.retries.count", "defaults.retries.backoff":
+		if r := cfg.Defaults.Retries; r != nil {
+			if key == "defaults.retries.count" {
+				r.Count = nil
+			} else {
+				r.Backoff = ""
+			}
+			if r.Count == nil && r.Backoff == "" {
+				cfg.Defaults.Retries = nil
+			}
+		}
+		return nil
+	}
+
+	parts := strings.Split(key, ".")
+	if len(parts) == 2 && parts[0] == "scenes" {
+		if _, ok := cfg.Scenes[parts[1]]; !ok {
+			return usageErrf("unknown scene %q", parts[1])
+		}
+		delete(cfg.Scenes, parts[1])
+		return nil
+	}
+	if len(parts) >= 3 && parts[0] == "defaults" && parts[1] == "rooms" {
+		rooms, err := removeRoom(cfg.Defaults.Rooms, strings.Join(parts[2:], "."), key)
+		if err != nil {
+			return err
+		}
+		cfg.Defaults.Rooms = rooms
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "groups" {
+		groupName := strings.TrimSpace(parts[1])
+		members, ok := cfg.Groups[groupName]
+		if !ok {
+			return usageErrf("unknown group %q", groupName)
+		}
+		if len(parts) == 2 {
+			delete(cfg.Groups, groupName)
+			return nil
+		}
+		rooms, err := removeRoom(members, strings.Join(parts[2:], "."), key)
+		if err != nil {
+			return err
+		}
+		if len(rooms) == 0 {
+			delete(cfg.Groups, groupName)
+			return nil
+		}
+		cfg.Groups[groupName] = rooms
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "devices" {
+		name := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if _, ok := cfg.Devices[name]; !ok {
+			return usageErrf("%s is not set", key)
+		}
+		delete(cfg.Devices, name)
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "volumeOffsets" {
+		room := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if _, ok := cfg.VolumeOffsets[room]; !ok {
+			return usageErrf("%s is not set", key)
+		}
+		delete(cfg.VolumeOffsets, room)
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "maxVolumes" {
+		room := strings.TrimSpace(strings.Join(parts[1:], "."))
+		if _, ok := cfg.MaxVolumes[room]; !ok {
+			return usageErrf("%s is not set", key)
+		}
+		delete(cfg.MaxVolumes, room)
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "quietHours" {
+		q, ok := cfg.QuietHours[parts[1]]
+		if !ok {
+			return usageErrf("unknown quiet hours %q", parts[1])
+		}
+		if len(parts) == 2 {
+			delete(cfg.QuietHours, parts[1])
+			return nil
+		}
+		switch strings.Join(parts[2:], ".") {
+		case "rooms":
+			q.Rooms = nil
+		case "maxVolume":
+			q.MaxVolume = nil
+		case "play":
+			q.Play = ""
+		default:
+			return usageErrf("unsupported config path %q (unset quietHours.%s to remove the window)", key, parts[1])
+		}
+		cfg.QuietHours[parts[1]] = q
+		return nil
+	}
+	if len(parts) == 2 && parts[0] == "hooks" {
+		if _, ok := cfg.Hooks[parts[1]]; !ok {
+			return usageErrf("%s is not set", key)
+		}
+		delete(cfg.Hooks, parts[1])
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "remotes" {
+		r, ok := cfg.Remotes[parts[1]]
+		if !ok {
+			return usageErrf("unknown remote %q", parts[1])
+		}
+		if len(parts) == 2 {
+			delete(cfg.Remotes, parts[1])
+			return nil
+		}
+		switch {
+		case len(parts) == 3 && parts[2] == "port":
+			r.Port = 0
+		case len(parts) == 3 && parts[2] == "identity":
+			r.Identity = ""
+		default:
+			return usageErrf("unsupported config path %q (unset remotes.%s to remove the remote)", key, parts[1])
+		}
+		cfg.Remotes[parts[1]] = r
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "scrobble" {
+		if cfg.Scrobble == nil {
+			if scrobbleConfigField(&native.ScrobbleConfig{}, key) == nil {
+				return usageErrf("unsupported config path %q", key)
+			}
+			return nil
+		}
+		field := scrobbleConfigField(cfg.Scrobble, key)
+		if field == nil {
+			return usageErrf("unsupported config path %q", key)
+		}
+		*field = ""
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "appleMusic" {
+		if appleMusicConfigField(&native.AppleMusicConfig{}, key) == nil {
+			return usageErrf("unsupported config path %q", key)
+		}
+		if cfg.AppleMusic != nil {
+			*appleMusicConfigField(cfg.AppleMusic, key) = ""
+		}
+		return nil
+	}
+	if len(parts) >= 2 && parts[0] == "aliases" {
+		aliasName := strings.TrimSpace(parts[1])
+		a, ok := cfg.Aliases[aliasName]
+		if !ok {
+			return usageErrf("unknown alias %q", aliasName)
+		}
+		if len(parts) == 2 {
+			delete(cfg.Aliases, aliasName)
+			return nil
+		}
+		switch parts[2] {
+		case "rooms":
+			if len(parts) == 3 {
+				a.Rooms = nil
+				break
+			}
+			rooms, err := removeRoom(a.Rooms, strings.Join(parts[3:], "."), key)
+			if err != nil {
+				return err
+			}
+			a.Rooms = rooms
+		case "backend", "playlist", "playlistId", "station", "shuffle", "shuffleMode", "eq", "volume", "shortcut", "sequence":
+			if len(parts) != 3 {
+				return usageErrf("unsupported config path %q", key)
+			}
+			switch parts[2] {
+			case "backend":
+				a.Backend = ""
+			case "playlist":
+				a.Playlist = ""
+			case "playlistId":
+				a.PlaylistID = ""
+			case "station":
+				a.Station = ""
+			case "shuffle":
+				a.Shuffle = nil
+			case "shuffleMode":
+				a.ShuffleMode = ""
+			case "eq":
+				a.EQ = ""
+			case "volume":
+				a.Volume = nil
+			case "shortcut":
+				a.Shortcut = ""
+			case "sequence":
+				a.Sequence = nil
+			}
+		default:
+			return usageErrf("unsupported config path %q", key)
+		}
+		cfg.Aliases[aliasName] = a
+		return nil
+	}
+	if len(parts) >= 3 && parts[0] == "native" && parts[1] == "playlists" {
+		if len(parts) > 5 || (len(parts) == 5 && parts[4] != "input") {
+			return usageErrf("unsupported config path %q", key)
+		}
+		room := strings.TrimSpace(parts[2])
+		mappings, ok := cfg.Native.Playlists[room]
+		if !ok {
+			return usageErrf("%s is not set", key)
+		}
+		if len(parts) == 3 {
+			delete(cfg.Native.Playlists, room)
+			return nil
+		}
+		playlist := strings.TrimSpace(parts[3])
+		m, ok := mappings[playlist]
+		if !ok {
+			return usageErrf("%s is not set", key)
+		}
+		if len(parts) == 5 {
+			m.Input = ""
+			mappings[playlist] = m
+			return nil
+		}
+		delete(mappings, playlist)
+		if len(mappings) == 0 {
+			delete(cfg.Native.Playlists, room)
+		}
+		return nil
+	}
+	if len(parts) >= 3 && parts[0] == "native" && parts[1] == "volumeShortcuts" {
+		if len(parts) > 4 {
+			return usageErrf("unsupported config path %q", key)
+		}
+		room := strings.TrimSpace(parts[2])
+		mappings, ok := cfg.Native.VolumeShortcuts[room]
+		if !ok {
+			return usageErrf("%s is not set", key)
+		}
+		if len(parts) == 3 {
+			delete(cfg.Native.VolumeShortcuts, room)
+			return nil
+		}
+		volumeKey := strings.TrimSpace(parts[3])
+		if _, ok := mappings[volumeKey]; !ok {
+			return usageErrf("%s is not set", key)
+		}
+		delete(mappings, volumeKey)
+		if len(mappings) == 0 {
+			delete(cfg.Native.VolumeShortcuts, room)
+		}
+		return nil
+	}
+	return usageErrf("unsupported config path %q", key)
+}
+
+// removeRoom drops room (case-insensitively) from rooms.
+func removeRoom(rooms []string, room, key string) ([]string, error) {
+	room = strings.TrimSpace(room)
+	out := make([]string, 0, len(rooms))
+	for _, r := range rooms {
+		if !strings.EqualFold(r, room) {
+			out = append(out, r)
+		}
+	}
+	if len(out) == len(rooms) {
+		return nil, usageErrf("%s is not set", key)
+	}
+	return out, nil
+}
+
+type configPathEntry struct {
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// listConfigPaths enumerates every populated config path under prefix (all
+// paths when prefix is empty), sorted by path.
+func listConfigPaths(cfg *native.Config, prefix string) []configPathEntry {
+	var out []configPathEntry
+	add := func(path string, value any) {
+		out = append(out, configPathEntry{Path: path, Value: value})
+	}
+	if cfg.Defaults.Backend != "" {
+		add("defaults.backend", cfg.Defaults.Backend)
+	}
+	if cfg.Defaults.Engine != "" {
+		add("defaults.engine", cfg.Defaults.Engine)
+	}
+	if cfg.Defaults.Launch != "" {
+		add("defaults.launch", cfg.Defaults.Launch)
+	}
+	add("defaults.shuffle", cfg.Defaults.Shuffle)
+	if cfg.Defaults.Volume != nil {
+		add("defaults.volume", *cfg.Defaults.Volume)
+	}
+	if cfg.Defaults.MaxVolume != nil {
+		add("defaults.maxVolume", *cfg.Defaults.MaxVolume)
+	}
+	if t := cfg.Defaults.Timeouts; t != nil {
+		for _, key := range []string{"defaults.timeouts.applescript", "defaults.timeouts.shortcuts", "defaults.timeouts.hooks"} {
+			if v := *timeoutConfigField(t, key); v != "" {
+				add(key, v)
+			}
+		}
+	}
+	if r := cfg.Defaults.Retries; r != nil {
+		if r.Count != nil {
+			add("defaults.retries.count", *r.Count)
+		}
+		if r.Backoff != "" {
+			add("defaults.retries.backoff", r.Backoff)
+		}
+	}
+	if len(cfg.Defaults.Rooms) > 0 {
+		add("defaults.rooms", append([]string(nil), cfg.Defaults.Rooms...))
+	}
+	for name, members := range cfg.Groups {
+		add("groups."+name, append([]string(nil), members...))
+	}
+	for name, device := range cfg.Devices {
+		add("devices."+name, device)
+	}
+	for room, offset := range cfg.VolumeOffsets {
+		add("volumeOffsets."+room, offset)
+	}
+	for room, limit := range cfg.MaxVolumes {
+		add("maxVolumes."+room, limit)
+	}
+	for name, q := range cfg.QuietHours {
+		add("quietHours."+name+".start", q.Start)
+		add("quietHours."+name+".end", q.End)
+		if len(q.Rooms) > 0 {
+			add("quietHours."+name+".rooms", append([]string(nil), q.Rooms...))
+		}
+		if q.MaxVolume != nil {
+			add("quietHours."+name+".maxVolume", *q.MaxVolume)
+		}
+		add("quietHours."+name+".play", quietPlayMode(q))
+	}
+	for name, command := range cfg.Hooks {
+		add("hooks."+name, command)
+	}
+	for name, r := range cfg.Remotes {
+		add("remotes."+name+".host", r.Host)
+		if r.Port != 0 {
+			add("remotes."+name+".port", r.Port)
+		}
+		if r.Identity != "" {
+			add("remotes."+name+".identity", r.Identity)
+		}
+	}
+	for name, sc := range cfg.Scenes {
+		// The step types stand in for the steps; config get shows them whole.
+		types := make([]string, 0, len(sc.Steps))
+		for _, raw := range sc.Steps {
+			var st automationStep
+			_ = json.Unmarshal(raw, &st)
+			types = append(types, st.Type)
+		}
+		add("scenes."+name, types)
+	}
+	if sc := cfg.Scrobble; sc != nil {
+		for _, key := range []string{"scrobble.lastfm.apiKey", "scrobble.lastfm.apiSecret", "scrobble.lastfm.sessionKey", "scrobble.listenbrainz.token", "scrobble.listenbrainz.url"} {
+			if v := *scrobbleConfigField(sc, key); v != "" {
+				add(key, v)
+			}
+		}
+	}
+	if am := cfg.AppleMusic; am != nil {
+		for _, key := range []string{"appleMusic.developerToken", "appleMusic.userToken", "appleMusic.storefront"} {
+			if v := *appleMusicConfigField(am, key); v != "" {
+				add(key, v)
+			}
+		}
+	}
+	for name, a := range cfg.Aliases {
+		base := "aliases." + name + "."
+		if a.Backend != "" {
+			add(base+"backend", a.Backend)
+		}
+		if len(a.Rooms) > 0 {
+			add(base+"rooms", append([]string(nil), a.Rooms...))
+		}
+		if a.Playlist != "" {
+			add(base+"playlist", a.Playlist)
+		}
+		if a.PlaylistID != "" {
+			add(base+"playlistId", a.PlaylistID)
+		}
+		if a.Station != "" {
+			add(base+"station", a.Station)
+		}
+		if a.Shuffle != nil {
+			add(base+"shuffle", *a.Shuffle)
+		}
+		if a.ShuffleMode != "" {
+			add(base+"shuffleMode", a.ShuffleMode)
+		}
+		if a.EQ != "" {
+			add(base+"eq", a.EQ)
+		}
+		if a.Volume != nil {
+			add(base+"volume", *a.Volume)
+		}
+		if a.Shortcut != "" {
+			add(base+"shortcut", a.Shortcut)
+		}
+		if len(a.Sequence) > 0 {
+			add(base+"sequence", append([]string(nil), a.Sequence...))
+		}
+	}
+	for room, mappings := range cfg.Native.Playlists {
+		for playlist, m := range mappings {
+			add("native.playlists."+room+"."+playlist, m.Shortcut)
+			if m.Input != "" {
+				add("native.playlists."+room+"."+playlist+".input", m.Input)
+			}
+		}
+	}
+	for room, mappings := range cfg.Native.VolumeShortcuts {
+		for volumeKey, shortcut := range mappings {
+			add("native.volumeShortcuts."+room+"."+volumeKey, shortcut)
+		}
+	}
+
+	prefix = strings.TrimSuffix(strings.TrimSpace(prefix), ".")
+	filtered := out[:0]
+	for _, e := range out {
+		if prefix == "" || e.Path == prefix || strings.HasPrefix(e.Path, prefix+".") {
+			filtered = append(filtered, e)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Path < filtered[j].Path })
+	return filtered
+}
+
+func timeoutConfigField(t *native.TimeoutsConfig, key string) *string {
+	switch key {
+	case "defaults.timeouts.shortcuts":
+		return &t.Shortcuts
+	case "defaults.timeouts.hooks":
+		return &t.Hooks
+	}
+	return &t.AppleScript
+}
+
+// parseConfigTimeout parses a positive duration such as "20s".
+func parseConfigTimeout(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("must be a positive duration like 20s, got %q", v)
+	}
+	return d, nil
+}
+
+// maxRetries caps --retries and defaults.retries.count; with the doubling
+// backoff, more retries would outlast any reasonable command timeout.
+const maxRetries = 10
+
+// parseRetries parses a retry count in 0..maxRetries.
+func parseRetries(v string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 || n > maxRetries {
+		return 0, fmt.Errorf("must be 0..%d, got %q", maxRetries, v)
+	}
+	return n, nil
+}
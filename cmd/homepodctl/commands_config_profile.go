@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+type profileRow struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Active bool   `json:"active"`
+}
+
+// selectConfigFile applies --config (or HOMEPODCTL_CONFIG). It reports whether
+// a file was pinned, in which case profiles are not consulted.
+func selectConfigFile(flagValue string) (bool, error) {
+	path := strings.TrimSpace(flagValue)
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("HOMEPODCTL_CONFIG"))
+	}
+	if path == "" {
+		return false, nil
+	}
+	if err := native.SetConfigPath(path); err != nil {
+		return false, err
+	}
+	debugf("config: path override=%q (profiles ignored)", path)
+	return true, nil
+}
+
+// selectProfile applies --profile (or HOMEPODCTL_PROFILE) for this process. A
+// named profile must exist, except for the profile subcommands themselves.
+func selectProfile(flagValue, cmd string, args []string) error {
+	name := strings.TrimSpace(flagValue)
+	if name == "" {
+		name = strings.TrimSpace(os.Getenv("HOMEPODCTL_PROFILE"))
+	}
+	if name == "" {
+		return nil
+	}
+	if err := native.SetProfile(name); err != nil {
+		return err
+	}
+	debugf("config: profile=%q", name)
+	if cmd == "config" && len(args) > 0 && args[0] == "profile" {
+		return nil
+	}
+	ok, err := native.ProfileExists(name)
+	if err != nil {
+		return &native.ConfigError{Op: "profile", Err: err}
+	}
+	if !ok {
+		return &native.ConfigError{Op: "profile", Err: fmt.Errorf("profile %q not found (run `homepodctl config profile create %s`)", name, name)}
+	}
+	return nil
+}
+
+func cmdConfigProfile(args []string) {
+	if len(args) == 0 {
+		die(usageErrf("usage: homepodctl config profile <list|create|switch> [args]"))
+	}
+	switch args[0] {
+	case "list":
+		flags, positionals, err := parseArgs(args[1:])
+		if err != nil {
+			die(err)
+		}
+		if len(positionals) != 0 {
+			die(usageErrf("usage: homepodctl config profile list [--json]"))
+		}
+		jsonOut, _, err := parseOutputFlags(flags)
+		if err != nil {
+			die(err)
+		}
+		rows, err := listProfileRows()
+		if err != nil {
+			die(err)
+		}
+		if jsonOut {
+			writeJSON(rows)
+			return
+		}
+		for _, r := range rows {
+			marker := " "
+			if r.Active {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\t%s\n", marker, r.Name, r.Path)
+		}
+	case "create":
+		flags, positionals, err := parseArgs(args[1:])
+		if err != nil {
+			die(err)
+		}
+		if len(positionals) != 1 {
+			die(usageErrf("usage: homepodctl config profile create <name> [--from <profile>]"))
+		}
+		path, err := native.CreateProfile(positionals[0], strings.TrimSpace(flags.string("from")))
+		if err != nil {
+			die(err)
+		}
+		if !quiet {
+			fmt.Printf("Wrote %s\n", path)
+		}
+	case "switch":
+		if len(args) != 2 {
+			die(usageErrf("usage: homepodctl config profile switch <name>"))
+		}
+		if err := native.SwitchProfile(args[1]); err != nil {
+			die(err)
+		}
+		if !quiet {
+			fmt.Printf("switched to profile %s\n", args[1])
+		}
+	default:
+		die(usageErrf("unknown config profile subcommand: %q", args[0]))
+	}
+}
+
+func listProfileRows() ([]profileRow, error) {
+	names, err := native.ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+	current, err := native.CurrentProfile()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]profileRow, 0, len(names))
+	for _, name := range names {
+		path, err := native.ProfilePath(name)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, profileRow{Name: name, Path: path, Active: name == current})
+	}
+	return rows, nil
+}
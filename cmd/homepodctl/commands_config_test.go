@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -29,8 +31,8 @@ func TestValidateConfigValues_FindsMultipleIssues(t *testing.T) {
 			},
 		},
 		Native: native.NativeConfig{
-			Playlists: map[string]map[string]string{
-				"": {"Focus": "x"},
+			Playlists: map[string]map[string]native.PlaylistShortcut{
+				"": {"Focus": {Shortcut: "x"}},
 			},
 			VolumeShortcuts: map[string]map[string]string{
 				"Bedroom": {"999": ""},
@@ -54,7 +56,7 @@ func TestConfigPathGetSet_RoundTrip(t *testing.T) {
 		},
 		Aliases: map[string]native.Alias{},
 		Native: native.NativeConfig{
-			Playlists:       map[string]map[string]string{},
+			Playlists:       map[string]map[string]native.PlaylistShortcut{},
 			VolumeShortcuts: map[string]map[string]string{},
 		},
 	}
@@ -71,6 +73,51 @@ func TestConfigPathGetSet_RoundTrip(t *testing.T) {
 	if err := setConfigPathValue(cfg, "native.volumeShortcuts.Bedroom.30", []string{"BR Vol 30"}); err != nil {
 		t.Fatalf("set native volume mapping: %v", err)
 	}
+	if err := setConfigPathValue(cfg, "groups.downstairs", []string{"Kitchen", "Living Room"}); err != nil {
+		t.Fatalf("set group: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "volumeOffsets.Kitchen", []string{"-10"}); err != nil {
+		t.Fatalf("set volume offset: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "maxVolumes.Bedroom", []string{"35"}); err != nil {
+		t.Fatalf("set max volume: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "defaults.maxVolume", []string{"101"}); err == nil {
+		t.Fatalf("expected defaults.maxVolume above 100 to be rejected")
+	}
+	if err := setConfigPathValue(cfg, "quietHours.night.maxVolume", []string{"20"}); err == nil {
+		t.Fatalf("expected a field of missing quiet hours to be rejected")
+	}
+	if err := setConfigPathValue(cfg, "quietHours.night", []string{"22:00", "07:00"}); err != nil {
+		t.Fatalf("set quiet hours: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "quietHours.night.maxVolume", []string{"20"}); err != nil {
+		t.Fatalf("set quiet hours max volume: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "quietHours.night.play", []string{"mute"}); err == nil {
+		t.Fatalf("expected quiet hours play other than warn|block to be rejected")
+	}
+	if err := setConfigPathValue(cfg, "quietHours.night.end", []string{"22:00"}); err == nil {
+		t.Fatalf("expected an empty quiet hours window to be rejected")
+	}
+	if err := setConfigPathValue(cfg, "scrobble.listenbrainz.token", []string{"tok"}); err != nil {
+		t.Fatalf("set scrobble token: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "hooks.postPlay", []string{"shortcuts run 'Dim Lights'"}); err != nil {
+		t.Fatalf("set hook: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "hooks.postStatus", []string{"true"}); err == nil {
+		t.Fatalf("expected unknown hook to be rejected")
+	}
+	if err := setConfigPathValue(cfg, "remotes.mini.host", []string{"me@mac-mini"}); err != nil {
+		t.Fatalf("set remote host: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "remotes.mini.port", []string{"2222"}); err != nil {
+		t.Fatalf("set remote port: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "remotes.mini.host", []string{"-oProxyCommand=x"}); err == nil {
+		t.Fatalf("expected host starting with - to be rejected")
+	}
 
 	got, err := getConfigPathValue(cfg, "aliases.work.backend")
 	if err != nil || got != "native" {
@@ -84,6 +131,44 @@ func TestConfigPathGetSet_RoundTrip(t *testing.T) {
 	if err != nil || got != "BR Vol 30" {
 		t.Fatalf("get native volume got=%v err=%v", got, err)
 	}
+	got, err = getConfigPathValue(cfg, "groups.downstairs")
+	if rooms, ok := got.([]string); err != nil || !ok || strings.Join(rooms, ",") != "Kitchen,Living Room" {
+		t.Fatalf("get group got=%v err=%v", got, err)
+	}
+	got, err = getConfigPathValue(cfg, "volumeOffsets.Kitchen")
+	if err != nil || got != -10 {
+		t.Fatalf("get volume offset got=%v err=%v", got, err)
+	}
+	if _, err := getConfigPathValue(cfg, "volumeOffsets.Garage"); err == nil || !strings.Contains(err.Error(), `volume offset for room "Garage" not found`) {
+		t.Fatalf("get unknown volume offset err=%v", err)
+	}
+	got, err = getConfigPathValue(cfg, "maxVolumes.Bedroom")
+	if err != nil || got != 35 {
+		t.Fatalf("get max volume got=%v err=%v", got, err)
+	}
+	got, err = getConfigPathValue(cfg, "quietHours.night.maxVolume")
+	if err != nil || got != 20 {
+		t.Fatalf("get quiet hours max volume got=%v err=%v", got, err)
+	}
+	got, err = getConfigPathValue(cfg, "quietHours.night.play")
+	if err != nil || got != "warn" {
+		t.Fatalf("get quiet hours play got=%v err=%v", got, err)
+	}
+	got, err = getConfigPathValue(cfg, "scrobble.listenbrainz.token")
+	if err != nil || got != "tok" {
+		t.Fatalf("get scrobble token got=%v err=%v", got, err)
+	}
+	got, err = getConfigPathValue(cfg, "hooks.postPlay")
+	if err != nil || got != "shortcuts run 'Dim Lights'" {
+		t.Fatalf("get hook got=%v err=%v", got, err)
+	}
+	got, err = getConfigPathValue(cfg, "remotes.mini.port")
+	if err != nil || got != 2222 {
+		t.Fatalf("get remote port got=%v err=%v", got, err)
+	}
+	if err := unsetConfigPathValue(cfg, "remotes.mini.host"); err == nil {
+		t.Fatalf("expected unsetting the remote host alone to be rejected")
+	}
 }
 
 func TestSetConfigPathValue_RejectsInvalidInput(t *testing.T) {
@@ -114,6 +199,13 @@ func TestSetConfigPathValue_Table(t *testing.T) {
 		{name: "defaults rooms", key: "defaults.rooms", values: []string{"Bedroom", "Kitchen"}},
 		{name: "alias playlist id", key: "aliases.evening.playlistId", values: []string{"ABC123"}},
 		{name: "alias shuffle null", key: "aliases.evening.shuffle", values: []string{"null"}},
+		{name: "alias shuffle mode", key: "aliases.evening.shuffleMode", values: []string{"albums"}},
+		{name: "alias eq", key: "aliases.evening.eq", values: []string{"Bass Booster"}},
+		{name: "bad alias shuffle mode", key: "aliases.evening.shuffleMode", values: []string{"artists"}, wantErr: true},
+		{name: "alias crossfade", key: "aliases.evening.crossfade", values: []string{"6"}, wantErr: true},
+		{name: "device alias", key: "devices.office", values: []string{"Agis's Office HomePod"}},
+		{name: "device alias two devices", key: "devices.office", values: []string{"A", "B"}, wantErr: true},
+		{name: "device alias empty", key: "devices.office", values: []string{" "}, wantErr: true},
 		{name: "native playlist mapping", key: "native.playlists.Bedroom.Focus", values: []string{"BR Focus"}},
 		{name: "native volume mapping", key: "native.volumeShortcuts.Bedroom.25", values: []string{"BR Vol 25"}},
 		{name: "bad alias path", key: "aliases..backend", values: []string{"airplay"}, wantErr: true},
@@ -126,7 +218,7 @@ func TestSetConfigPathValue_Table(t *testing.T) {
 			cfg := &native.Config{
 				Aliases: map[string]native.Alias{},
 				Native: native.NativeConfig{
-					Playlists:       map[string]map[string]string{},
+					Playlists:       map[string]map[string]native.PlaylistShortcut{},
 					VolumeShortcuts: map[string]map[string]string{},
 				},
 			}
@@ -138,6 +230,188 @@ func TestSetConfigPathValue_Table(t *testing.T) {
 	}
 }
 
+func TestConfigTimeoutPaths(t *testing.T) {
+	t.Parallel()
+
+	cfg := &native.Config{}
+	if err := setConfigPathValue(cfg, "defaults.timeouts.applescript", []string{"20s"}); err != nil {
+		t.Fatalf("set applescript: %v", err)
+	}
+	for _, bad := range []string{"abc", "0s", "-5s"} {
+		if err := setConfigPathValue(cfg, "defaults.timeouts.shortcuts", []string{bad}); err == nil {
+			t.Fatalf("set shortcuts %q: expected error", bad)
+		}
+	}
+	if v, err := getConfigPathValue(cfg, "defaults.timeouts.applescript"); err != nil || v != "20s" {
+		t.Fatalf("get applescript=%v err=%v", v, err)
+	}
+	if entries := listConfigPaths(cfg, "defaults.timeouts"); len(entries) != 1 || entries[0].Path != "defaults.timeouts.applescript" {
+		t.Fatalf("list=%+v", entries)
+	}
+	cfg.Defaults.Timeouts.Shortcuts = "soon"
+	if issues := strings.Join(validateConfigValues(cfg), "; "); !strings.Contains(issues, "defaults.timeouts.shortcuts") {
+		t.Fatalf("validate issues=%q", issues)
+	}
+	for _, key := range []string{"defaults.timeouts.applescript", "defaults.timeouts.shortcuts"} {
+		if err := unsetConfigPathValue(cfg, key); err != nil {
+			t.Fatalf("unset %s: %v", key, err)
+		}
+	}
+	if cfg.Defaults.Timeouts != nil {
+		t.Fatalf("timeouts=%+v, want nil after unsetting both", cfg.Defaults.Timeouts)
+	}
+}
+
+func TestConfigEnginePath(t *testing.T) {
+	t.Parallel()
+
+	cfg := &native.Config{}
+	if err := setConfigPathValue(cfg, "defaults.engine", []string{"osa"}); err == nil {
+		t.Fatalf("expected invalid engine error")
+	}
+	if err := setConfigPathValue(cfg, "defaults.engine", []string{"applescript"}); err != nil {
+		t.Fatalf("set engine: %v", err)
+	}
+	if v, err := getConfigPathValue(cfg, "defaults.engine"); err != nil || v != "applescript" {
+		t.Fatalf("get engine=%v err=%v", v, err)
+	}
+	cfg.Defaults.Engine = "python"
+	if issues := strings.Join(validateConfigValues(cfg), "; "); !strings.Contains(issues, "defaults.engine") {
+		t.Fatalf("validate issues=%q", issues)
+	}
+	if err := unsetConfigPathValue(cfg, "defaults.engine"); err != nil || cfg.Defaults.Engine != "" {
+		t.Fatalf("unset err=%v engine=%q", err, cfg.Defaults.Engine)
+	}
+}
+
+func TestConfigLaunchPath(t *testing.T) {
+	t.Parallel()
+
+	cfg := &native.Config{}
+	if err := setConfigPathValue(cfg, "defaults.launch", []string{"never"}); err == nil {
+		t.Fatalf("expected invalid launch error")
+	}
+	if err := setConfigPathValue(cfg, "defaults.launch", []string{"off"}); err != nil {
+		t.Fatalf("set launch: %v", err)
+	}
+	if v, err := getConfigPathValue(cfg, "defaults.launch"); err != nil || v != "off" {
+		t.Fatalf("get launch=%v err=%v", v, err)
+	}
+	if err := unsetConfigPathValue(cfg, "defaults.launch"); err != nil || cfg.Defaults.Launch != "" {
+		t.Fatalf("unset err=%v launch=%q", err, cfg.Defaults.Launch)
+	}
+}
+
+func TestConfigRetriesPaths(t *testing.T) {
+	t.Parallel()
+
+	cfg := &native.Config{}
+	if err := setConfigPathValue(cfg, "defaults.retries.count", []string{"0"}); err != nil {
+		t.Fatalf("set count: %v", err)
+	}
+	if err := setConfigPathValue(cfg, "defaults.retries.backoff", []string{"soon"}); err == nil {
+		t.Fatalf("expected invalid backoff error")
+	}
+	if v, err := getConfigPathValue(cfg, "defaults.retries.count"); err != nil || v != 0 {
+		t.Fatalf("get count=%v err=%v", v, err)
+	}
+	if entries := listConfigPaths(cfg, "defaults.retries"); len(entries) != 1 || entries[0].Path != "defaults.retries.count" {
+		t.Fatalf("list=%+v", entries)
+	}
+	bad := 99
+	cfg.Defaults.Retries.Count = &bad
+	if issues := strings.Join(validateConfigValues(cfg), "; "); !strings.Contains(issues, "defaults.retries.count") {
+		t.Fatalf("validate issues=%q", issues)
+	}
+	if err := unsetConfigPathValue(cfg, "defaults.retries.count"); err != nil || cfg.Defaults.Retries != nil {
+		t.Fatalf("unset err=%v retries=%+v", err, cfg.Defaults.Retries)
+	}
+}
+
+func TestUnsetConfigPathValue_Table(t *testing.T) {
+	t.Parallel()
+
+	newConfig := func() *native.Config {
+		vol := 30
+		return &native.Config{
+			Defaults: native.DefaultsConfig{Rooms: []string{"Bedroom", "Kitchen"}, Volume: &vol},
+			Aliases:  map[string]native.Alias{"focus": {Playlist: "Focus", Rooms: []string{"Office", "Den"}, Volume: &vol}},
+			Groups:   map[string][]string{"up": {"Bedroom"}},
+			Devices:  map[string]string{"office": "Office HomePod"},
+			Native: native.NativeConfig{
+				Playlists:       map[string]map[string]native.PlaylistShortcut{"Bedroom": {"Focus": {Shortcut: "BR Focus", Input: "x"}}},
+				VolumeShortcuts: map[string]map[string]string{"Bedroom": {"30": "BR Vol 30"}},
+			},
+		}
+	}
+	tests := []struct {
+		key     string
+		check   func(*native.Config) bool
+		wantErr bool
+	}{
+		{key: "defaults.volume", check: func(c *native.Config) bool { return c.Defaults.Volume == nil }},
+		{key: "defaults.rooms.kitchen", check: func(c *native.Config) bool { return reflect.DeepEqual(c.Defaults.Rooms, []string{"Bedroom"}) }},
+		{key: "aliases.focus", check: func(c *native.Config) bool { _, ok := c.Aliases["focus"]; return !ok }},
+		{key: "aliases.focus.volume", check: func(c *native.Config) bool { return c.Aliases["focus"].Volume == nil }},
+		{key: "aliases.focus.rooms.Den", check: func(c *native.Config) bool { return reflect.DeepEqual(c.Aliases["focus"].Rooms, []string{"Office"}) }},
+		{key: "groups.up.Bedroom", check: func(c *native.Config) bool { _, ok := c.Groups["up"]; return !ok }},
+		{key: "devices.office", check: func(c *native.Config) bool { return len(c.Devices) == 0 }},
+		{key: "devices.den", wantErr: true},
+		{key: "native.playlists.Bedroom.Focus.input", check: func(c *native.Config) bool {
+			return c.Native.Playlists["Bedroom"]["Focus"] == native.PlaylistShortcut{Shortcut: "BR Focus"}
+		}},
+		{key: "native.playlists.Bedroom.Focus", check: func(c *native.Config) bool { return len(c.Native.Playlists) == 0 }},
+		{key: "native.volumeShortcuts.Bedroom", check: func(c *native.Config) bool { return len(c.Native.VolumeShortcuts) == 0 }},
+		{key: "aliases.missing", wantErr: true},
+		{key: "defaults.rooms.Attic", wantErr: true},
+		{key: "native.volumeShortcuts.Bedroom.50", wantErr: true},
+		{key: "defaults.nope", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.key, func(t *testing.T) {
+			cfg := newConfig()
+			err := unsetConfigPathValue(cfg, tc.key)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unsetConfigPathValue err=%v wantErr=%v", err, tc.wantErr)
+			}
+			if tc.check != nil && !tc.check(cfg) {
+				t.Fatalf("unexpected config after unset: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestListConfigPaths(t *testing.T) {
+	t.Parallel()
+
+	vol := 30
+	cfg := &native.Config{
+		Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Bedroom"}},
+		Aliases:  map[string]native.Alias{"focus": {Playlist: "Focus", Volume: &vol}},
+		Native: native.NativeConfig{
+			Playlists: map[string]map[string]native.PlaylistShortcut{"Bedroom": {"Focus": {Shortcut: "BR Focus"}}},
+		},
+	}
+	got := listConfigPaths(cfg, "")
+	want := []configPathEntry{
+		{Path: "aliases.focus.playlist", Value: "Focus"},
+		{Path: "aliases.focus.volume", Value: 30},
+		{Path: "defaults.backend", Value: "airplay"},
+		{Path: "defaults.rooms", Value: []string{"Bedroom"}},
+		{Path: "defaults.shuffle", Value: false},
+		{Path: "native.playlists.Bedroom.Focus", Value: "BR Focus"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("listConfigPaths=%+v, want %+v", got, want)
+	}
+	if got := listConfigPaths(cfg, "aliases.focus."); len(got) != 2 {
+		t.Fatalf("prefix filter=%+v", got)
+	}
+	if got := listConfigPaths(cfg, "alias"); len(got) != 0 {
+		t.Fatalf("partial segment prefix should not match: %+v", got)
+	}
+}
+
 func TestGetConfigPathValue_Table(t *testing.T) {
 	t.Parallel()
 
@@ -162,8 +436,8 @@ func TestGetConfigPathValue_Table(t *testing.T) {
 			},
 		},
 		Native: native.NativeConfig{
-			Playlists: map[string]map[string]string{
-				"Bedroom": {"Deep Focus": "BR Focus"},
+			Playlists: map[string]map[string]native.PlaylistShortcut{
+				"Bedroom": {"Deep Focus": {Shortcut: "BR Focus"}},
 			},
 			VolumeShortcuts: map[string]map[string]string{
 				"Bedroom": {"35": "BR Vol 35"},
@@ -214,7 +488,7 @@ func TestGetConfigPathValue_NilOptionalsAndInvalidShapes(t *testing.T) {
 			},
 		},
 		Native: native.NativeConfig{
-			Playlists:       map[string]map[string]string{},
+			Playlists:       map[string]map[string]native.PlaylistShortcut{},
 			VolumeShortcuts: map[string]map[string]string{},
 		},
 	}
@@ -320,7 +594,7 @@ func TestExecuteAutomationVolume_AirplayUsesGivenRooms(t *testing.T) {
 		return nil
 	}
 
-	err := executeAutomationVolume(context.Background(), nil, "airplay", automationDefaults{}, 35, []string{"Bedroom"})
+	err := executeAutomationVolume(context.Background(), nil, "airplay", automationDefaults{}, 35, []string{"Bedroom"}, false)
 	if err != nil {
 		t.Fatalf("executeAutomationVolume: %v", err)
 	}
@@ -331,16 +605,16 @@ func TestExecuteAutomationVolume_AirplayUsesGivenRooms(t *testing.T) {
 
 func TestExecuteAutomationWait_SuccessAndTimeout(t *testing.T) {
 	origGetNowPlaying := getNowPlaying
-	origSleepFn := sleepFn
+	origSleepCtx := sleepCtx
 	t.Cleanup(func() {
 		getNowPlaying = origGetNowPlaying
-		sleepFn = origSleepFn
+		sleepCtx = origSleepCtx
 	})
 
 	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
 		return music.NowPlaying{PlayerState: "playing"}, nil
 	}
-	sleepFn = func(time.Duration) {}
+	sleepCtx = func(ctx context.Context, _ time.Duration) error { return ctx.Err() }
 	if err := executeAutomationWait(context.Background(), "playing", "50ms"); err != nil {
 		t.Fatalf("executeAutomationWait success: %v", err)
 	}
@@ -352,4 +626,124 @@ func TestExecuteAutomationWait_SuccessAndTimeout(t *testing.T) {
 	if err == nil || !strings.Contains(err.Error(), "wait timeout") {
 		t.Fatalf("expected timeout error, got %v", err)
 	}
+
+	// Cancelling the run interrupts the wait instead of sleeping it out.
+	sleepCtx = sleepContext
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { time.Sleep(20 * time.Millisecond); cancel() }()
+	start := time.Now()
+	if err := executeAutomationWait(ctx, "playing", "1m"); !errors.Is(err, context.Canceled) || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("cancelled wait err=%v after %s", err, time.Since(start))
+	}
+}
+
+func TestRunConfigWizard(t *testing.T) {
+	origList := listAirPlayDevices
+	origMostPlayed := mostPlayedPlaylists
+	t.Cleanup(func() {
+		listAirPlayDevices = origList
+		mostPlayedPlaylists = origMostPlayed
+	})
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Bedroom"}, {Name: "Kitchen"}, {Name: "Living Room"}}, nil
+	}
+	mostPlayedPlaylists = func(context.Context, int) ([]music.UserPlaylist, error) {
+		return []music.UserPlaylist{
+			{PersistentID: "AA11", Name: "Deep Focus", Plays: 40},
+			{PersistentID: "BB22", Name: "Party Mix", Plays: 12},
+		}, nil
+	}
+
+	cfg := &native.Config{Aliases: map[string]native.Alias{"party-mix": {Playlist: "Old"}}}
+	// rooms: 9 is rejected, then 1,3; volume: blank; aliases: 1 and 2 with the
+	// default name, declining to replace the existing party-mix; then confirm.
+	in := strings.NewReader("9\n1,3\n\n1 2\n\n\nn\ny\n")
+	var out strings.Builder
+	save, err := runConfigWizard(context.Background(), in, &out, cfg, "/tmp/config.json", false)
+	if err != nil {
+		t.Fatalf("runConfigWizard: %v\n%s", err, out.String())
+	}
+	if !save {
+		t.Fatalf("save=false, want true")
+	}
+	if got := strings.Join(cfg.Defaults.Rooms, ","); got != "Bedroom,Living Room" {
+		t.Fatalf("rooms=%q", got)
+	}
+	if cfg.Defaults.Volume != nil {
+		t.Fatalf("volume=%v, want unset", *cfg.Defaults.Volume)
+	}
+	if a := cfg.Aliases["deep-focus"]; a.PlaylistID != "AA11" || a.Playlist != "Deep Focus" || a.Backend != "airplay" {
+		t.Fatalf("deep-focus alias=%+v", a)
+	}
+	if a := cfg.Aliases["party-mix"]; a.Playlist != "Old" {
+		t.Fatalf("party-mix was replaced: %+v", a)
+	}
+	if !strings.Contains(out.String(), `invalid choice "9"`) {
+		t.Fatalf("missing validation message:\n%s", out.String())
+	}
+}
+
+func TestRunConfigWizardYesKeepsDefaults(t *testing.T) {
+	origList := listAirPlayDevices
+	origMostPlayed := mostPlayedPlaylists
+	t.Cleanup(func() {
+		listAirPlayDevices = origList
+		mostPlayedPlaylists = origMostPlayed
+	})
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Bedroom"}, {Name: "Kitchen"}}, nil
+	}
+	mostPlayedPlaylists = func(context.Context, int) ([]music.UserPlaylist, error) {
+		return []music.UserPlaylist{{PersistentID: "AA11", Name: "Deep Focus", Plays: 40}}, nil
+	}
+
+	vol := 40
+	cfg := &native.Config{Aliases: map[string]native.Alias{}}
+	cfg.Defaults.Rooms = []string{"Kitchen"}
+	cfg.Defaults.Volume = &vol
+	var out strings.Builder
+	// Nothing is read from in: every question takes its default.
+	save, err := runConfigWizard(context.Background(), strings.NewReader(""), &out, cfg, "/tmp/config.json", true)
+	if err != nil {
+		t.Fatalf("runConfigWizard: %v\n%s", err, out.String())
+	}
+	if !save {
+		t.Fatalf("save=false, want true")
+	}
+	if got := strings.Join(cfg.Defaults.Rooms, ","); got != "Kitchen" {
+		t.Fatalf("rooms=%q", got)
+	}
+	if cfg.Defaults.Volume == nil || *cfg.Defaults.Volume != 40 {
+		t.Fatalf("volume=%v, want 40", cfg.Defaults.Volume)
+	}
+	if len(cfg.Aliases) != 0 {
+		t.Fatalf("aliases=%v, want none", cfg.Aliases)
+	}
+}
+
+func TestSelectProfileRequiresExistingProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOMEPODCTL_PROFILE", "")
+	t.Cleanup(func() { _ = native.SetProfile("") })
+
+	err := selectProfile("travel", "status", nil)
+	var cfgErr *native.ConfigError
+	if !errors.As(err, &cfgErr) || !strings.Contains(err.Error(), `profile "travel" not found`) {
+		t.Fatalf("err=%v, want missing profile ConfigError", err)
+	}
+	if err := selectProfile("travel", "config", []string{"profile", "create", "travel"}); err != nil {
+		t.Fatalf("profile subcommands should not require the profile: %v", err)
+	}
+	if _, err := native.CreateProfile("travel", ""); err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	t.Setenv("HOMEPODCTL_PROFILE", "travel")
+	if err := selectProfile("", "status", nil); err != nil {
+		t.Fatalf("selectProfile from env: %v", err)
+	}
+	if path, _ := native.ConfigPath(); filepath.Base(path) != "travel.json" {
+		t.Fatalf("config path=%q", path)
+	}
 }
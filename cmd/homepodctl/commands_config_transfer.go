@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+type configImportResult struct {
+	OK     bool   `json:"ok"`
+	Path   string `json:"path"`
+	DryRun bool   `json:"dryRun,omitempty"`
+	native.MergeResult
+}
+
+func cmdConfigExport(args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl config export [--redact]"))
+	}
+	redact, _, err := flags.boolStrict("redact")
+	if err != nil {
+		die(err)
+	}
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		die(err)
+	}
+	if redact {
+		cfg = cfg.Redact()
+	}
+	writeJSON(cfg)
+}
+
+func cmdConfigImport(args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 1 {
+		die(usageErrf("usage: homepodctl config import <file|-> [--merge] [--dry-run] [--json]"))
+	}
+	merge, _, err := flags.boolStrict("merge")
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	src, err := readConfigFile(positionals[0])
+	if err != nil {
+		die(err)
+	}
+
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		die(err)
+	}
+	path, err := configPath()
+	if err != nil {
+		die(err)
+	}
+	res := configImportResult{OK: true, Path: path, DryRun: opts.DryRun, MergeResult: cfg.Import(src, merge)}
+	if issues := validateConfigValues(cfg); len(issues) > 0 {
+		die(usageErrf("imported config is invalid: %s", strings.Join(issues, "; ")))
+	}
+	if !opts.DryRun {
+		if err := saveConfig(cfg); err != nil {
+			die(err)
+		}
+	}
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet && len(res.Skipped) == 0 {
+		return
+	}
+	verb := "imported"
+	if opts.DryRun {
+		verb = "dry-run: would import"
+	}
+	fmt.Printf("%s into %s: %d added, %d replaced, %d skipped\n", verb, path, len(res.Added), len(res.Replaced), len(res.Skipped))
+	for _, p := range res.Skipped {
+		fmt.Printf("- skipped %s (already set; import without --merge to replace)\n", p)
+	}
+}
+
+// readConfigFile parses a config JSON file, or stdin for "-".
+func readConfigFile(name string) (*native.Config, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if name == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, &native.ConfigError{Op: "read", Path: name, Err: err}
+	}
+	var cfg native.Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, &native.ConfigError{Op: "parse", Path: name, Err: err}
+	}
+	return &cfg, nil
+}
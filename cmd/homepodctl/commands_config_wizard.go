@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+func cmdConfigWizard(args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl config wizard [--yes]"))
+	}
+	if !opts.Yes && !isInteractiveStdin() {
+		die(usageErrf("config wizard requires interactive stdin (pass --yes to accept the defaults, or use `homepodctl setup --room <name> ...` or `homepodctl config set` in scripts)"))
+	}
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		die(err)
+	}
+	path, err := configPath()
+	if err != nil {
+		die(err)
+	}
+	// The wizard waits on the user, so it must not inherit the per-command timeout.
+	save, err := runConfigWizard(context.Background(), os.Stdin, os.Stderr, cfg, path, opts.Yes)
+	if err != nil {
+		die(err)
+	}
+	if !save {
+		fmt.Fprintln(os.Stderr, "config not written")
+		return
+	}
+	if issues := validateConfigValues(cfg); len(issues) > 0 {
+		die(usageErrf("wizard produced invalid config: %s", strings.Join(issues, "; ")))
+	}
+	if err := saveConfig(cfg); err != nil {
+		die(err)
+	}
+	if !quiet {
+		fmt.Printf("Wrote %s\n", path)
+	}
+}
+
+// runConfigWizard walks through rooms, volume, and playlist aliases, applying
+// answers to cfg. It reports whether the user confirmed writing the config.
+// With yes set every question takes its default without reading in.
+func runConfigWizard(ctx context.Context, in io.Reader, out io.Writer, cfg *native.Config, path string, yes bool) (bool, error) {
+	p := &prompter{in: bufio.NewReader(in), out: out, yes: yes}
+
+	rooms, err := wizardRooms(ctx, p, cfg.Defaults.Rooms)
+	if err != nil {
+		return false, err
+	}
+	cfg.Defaults.Rooms = rooms
+
+	vol, err := wizardVolume(p, cfg.Defaults.Volume)
+	if err != nil {
+		return false, err
+	}
+	cfg.Defaults.Volume = vol
+
+	if err := wizardAliases(ctx, p, cfg); err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(out, "\nrooms: %s\n", strings.Join(cfg.Defaults.Rooms, ", "))
+	if cfg.Defaults.Volume != nil {
+		fmt.Fprintf(out, "volume: %d\n", *cfg.Defaults.Volume)
+	}
+	fmt.Fprintf(out, "aliases: %d\n", len(cfg.Aliases))
+	return p.confirm(fmt.Sprintf("Write %s?", path), true)
+}
+
+func wizardRooms(ctx context.Context, p *prompter, current []string) ([]string, error) {
+	names := wizardDeviceNames(ctx)
+	if len(names) == 0 {
+		fmt.Fprintln(p.out, "No AirPlay devices found; enter room names as they appear in Music.app.")
+		answer, err := p.ask("Default rooms (comma-separated)", strings.Join(current, ", "))
+		if err != nil {
+			return nil, err
+		}
+		return splitList(answer), nil
+	}
+
+	fmt.Fprintln(p.out, "AirPlay devices:")
+	for i, name := range names {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, name)
+	}
+	var def []string
+	for _, room := range current {
+		for i, name := range names {
+			if strings.EqualFold(name, room) {
+				def = append(def, strconv.Itoa(i+1))
+			}
+		}
+	}
+	for {
+		answer, err := p.ask("Default rooms (numbers, comma-separated)", strings.Join(def, ","))
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			return current, nil
+		}
+		picks, err := parseSelection(answer, len(names))
+		if err != nil {
+			fmt.Fprintf(p.out, "%v\n", err)
+			continue
+		}
+		rooms := make([]string, 0, len(picks))
+		for _, i := range picks {
+			rooms = append(rooms, names[i])
+		}
+		return rooms, nil
+	}
+}
+
+// wizardDeviceNames lists devices from Music.app, falling back to Bonjour when
+// Music.app can't be queried.
+func wizardDeviceNames(ctx context.Context) []string {
+	listCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	var names []string
+	devs, err := listAirPlayDevices(listCtx)
+	if err == nil {
+		for _, d := range devs {
+			names = append(names, d.Name)
+		}
+		return names
+	}
+	debugf("wizard: music devices: %v", err)
+	found, err := discoverNetworkDevices(ctx, 3*time.Second)
+	if err != nil {
+		debugf("wizard: network discovery: %v", err)
+		return nil
+	}
+	for _, d := range found {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func wizardVolume(p *prompter, current *int) (*int, error) {
+	def := ""
+	if current != nil {
+		def = strconv.Itoa(*current)
+	}
+	for {
+		answer, err := p.ask("Default volume 0-100 (blank to leave unset)", def)
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			return nil, nil
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 0 || n > 100 {
+			fmt.Fprintf(p.out, "invalid volume %q (expected 0-100)\n", answer)
+			continue
+		}
+		return &n, nil
+	}
+}
+
+func wizardAliases(ctx context.Context, p *prompter, cfg *native.Config) error {
+	listCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	playlists, err := mostPlayedPlaylists(listCtx, 8)
+	if err != nil {
+		fmt.Fprintf(p.out, "Skipping aliases: could not read playlists (%s)\n", formatError(err))
+		return nil
+	}
+	if len(playlists) == 0 {
+		return nil
+	}
+	fmt.Fprintln(p.out, "Most-played playlists:")
+	for i, pl := range playlists {
+		fmt.Fprintf(p.out, "  %d) %s (%d plays)\n", i+1, pl.Name, pl.Plays)
+	}
+	var picks []int
+	for {
+		answer, err := p.ask("Create aliases for (numbers, comma-separated, blank for none)", "")
+		if err != nil {
+			return err
+		}
+		if answer == "" {
+			return nil
+		}
+		if picks, err = parseSelection(answer, len(playlists)); err == nil {
+			break
+		}
+		fmt.Fprintf(p.out, "%v\n", err)
+	}
+	for _, i := range picks {
+		pl := playlists[i]
+		name, err := p.ask(fmt.Sprintf("Alias name for %q", pl.Name), aliasSlug(pl.Name))
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		if _, exists := cfg.Aliases[name]; exists {
+			ok, err := p.confirm(fmt.Sprintf("Alias %q exists. Replace it?", name), false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		cfg.Aliases[name] = native.Alias{Backend: "airplay", Playlist: pl.Name, PlaylistID: pl.PersistentID}
+	}
+	return nil
+}
+
+// aliasSlug turns a playlist name into a lowercase, dash-separated alias name.
+func aliasSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// parseSelection parses 1-based choices like "1,3" or "2 4" into 0-based
+// indexes, dropping duplicates.
+func parseSelection(s string, n int) ([]int, error) {
+	var out []int
+	seen := map[int]bool{}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		i, err := strconv.Atoi(f)
+		if err != nil || i < 1 || i > n {
+			return nil, fmt.Errorf("invalid choice %q (expected 1-%d)", f, n)
+		}
+		if !seen[i] {
+			seen[i] = true
+			out = append(out, i-1)
+		}
+	}
+	return out, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// prompter reads line-based answers for interactive flows. With yes set
+// (--yes) it answers every question itself: ask takes the default and
+// confirm accepts.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	yes bool
+}
+
+// ask prints prompt with def in brackets and returns the trimmed answer, or
+// def when the answer is blank.
+func (p *prompter) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", prompt)
+	}
+	if p.yes {
+		fmt.Fprintln(p.out, def)
+		return def, nil
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", fmt.Errorf("read input: %w", err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (p *prompter) confirm(prompt string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	if p.yes {
+		fmt.Fprintf(p.out, "%s (%s): y\n", prompt, hint)
+		return true, nil
+	}
+	for {
+		answer, err := p.ask(prompt+" ("+hint+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+const daemonUsage = "usage: homepodctl daemon serve|status [--socket <path>] [--interval <duration>] [--json]"
+
+type daemonStatusResult struct {
+	OK        bool   `json:"ok"`
+	Socket    string `json:"socket"`
+	Running   bool   `json:"running"`
+	LatencyMS int64  `json:"latencyMs"`
+}
+
+func defaultDaemonSocketPath() (string, error) {
+	return state.Path("daemon.sock")
+}
+
+// configureDaemonClient routes AppleScript through a running daemon. Only the
+// socket's existence is checked here; an unreachable daemon falls back to
+// osascript per call.
+func configureDaemonClient(cmd string) {
+	if cmd == "daemon" || envTruthy(os.Getenv("HOMEPODCTL_NO_DAEMON")) {
+		return
+	}
+	path, err := daemonSocketPath()
+	if err != nil {
+		return
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		debugf("daemon: using %s", path)
+		music.UseDaemon(path)
+	}
+}
+
+func cmdDaemon(args []string) {
+	if len(args) < 1 {
+		die(usageErrf(daemonUsage))
+	}
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf(daemonUsage))
+	}
+	path := strings.TrimSpace(flags.string("socket"))
+	if path == "" {
+		if path, err = daemonSocketPath(); err != nil {
+			die(err)
+		}
+	}
+	switch args[0] {
+	case "serve":
+		// The daemon polls now playing to fill the track log (history
+		// tracks); --interval 0 turns that off.
+		interval := 30 * time.Second
+		if raw := strings.TrimSpace(flags.string("interval")); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d < 0 {
+				die(usageErrf("invalid --interval %q (expected duration like 30s, or 0 to stop logging tracks)", raw))
+			}
+			interval = d
+		}
+		cmdDaemonServe(path, interval)
+	case "status":
+		jsonOut, _, err := flags.boolStrict("json")
+		if err != nil {
+			die(err)
+		}
+		cmdDaemonStatus(path, jsonOut)
+	default:
+		die(usageErrf("unknown daemon subcommand: %q (%s)", args[0], daemonUsage))
+	}
+}
+
+func cmdDaemonServe(path string, interval time.Duration) {
+	pingCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	_, err := pingDaemon(pingCtx, path)
+	cancel()
+	if err == nil {
+		die(fmt.Errorf("a daemon is already running on %s", path))
+	}
+	// Nothing answered, so a leftover socket is from a daemon that was killed.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		die(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		die(err)
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		die(err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		die(err)
+	}
+	// Anyone who can connect can run AppleScript as this user.
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		die(err)
+	}
+	if !quiet {
+		fmt.Printf("daemon: listening on unix://%s\n", path)
+	}
+	w := music.NewWorker()
+	defer w.Close()
+	if interval > 0 {
+		go func() {
+			_ = logDaemonTracks(context.Background(), interval)
+		}()
+	}
+	go func() {
+		_ = runStatusLoop(context.Background(), duckSweepInterval, func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if res, err := restoreExpiredDuck(ctx); err != nil {
+				debugf("daemon: duck restore: %v", err)
+			} else if len(res.Rooms) > 0 {
+				debugf("daemon: restored ducked rooms %+v", res.Rooms)
+			}
+			return nil
+		})
+	}()
+	if err := music.ServeDaemon(ln, w); err != nil {
+		die(err)
+	}
+}
+
+// duckSweepInterval is how often the daemon looks for a duck whose --for (or
+// for) has passed without a restore.
+const duckSweepInterval = 5 * time.Second
+
+// logDaemonTracks fills the track log every interval, but only while
+// Music.app is running: asking it for now playing would launch it.
+func logDaemonTracks(ctx context.Context, interval time.Duration) error {
+	return runStatusLoop(ctx, interval, func() error {
+		pollCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		defer cancel()
+		if running, err := musicAppRunning(pollCtx); err != nil || !running {
+			debugf("daemon: Music.app not running (err=%v); skipping poll", err)
+			return nil
+		}
+		np, err := getNowPlaying(pollCtx)
+		if err != nil {
+			debugf("daemon: poll failed: %v", err)
+			return nil
+		}
+		noteTrack(np)
+		return nil
+	})
+}
+
+func cmdDaemonStatus(path string, jsonOut bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	latency, err := pingDaemon(ctx, path)
+	if err != nil {
+		die(fmt.Errorf("daemon not running on %s (start it with `homepodctl daemon serve`): %w", path, err))
+	}
+	res := daemonStatusResult{OK: true, Socket: path, Running: true, LatencyMS: latency.Milliseconds()}
+	if jsonOut {
+		writeJSON(res)
+		return
+	}
+	if !quiet {
+		fmt.Printf("daemon: running on %s (ping %dms)\n", path, res.LatencyMS)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+// deviceEvent is emitted when a polled AirPlay device changes.
+type deviceEvent struct {
+	Event          string              `json:"event"` // device.added|device.removed|device.online|device.offline|device.selected|device.deselected|device.volume
+	At             time.Time           `json:"at"`
+	PreviousVolume *int                `json:"previousVolume,omitempty"`
+	Device         music.AirPlayDevice `json:"device"`
+}
+
+// listedDevice is a device in a one-off JSON listing; cachedAt is when
+// Music.app reported it, which is earlier than now when the device cache
+// served the list.
+type listedDevice struct {
+	music.AirPlayDevice
+	CachedAt time.Time `json:"cachedAt"`
+}
+
+// cmdDeviceList implements devices and out list: a one-off table or JSON
+// list, or with --watch/--json-stream a refreshing table or NDJSON events.
+// One-off listings come from the device cache while it is fresh; --refresh
+// asks Music.app regardless. Watching always polls Music.app.
+func cmdDeviceList(ctx context.Context, name string, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl %s [--kind <kind>] [--json] [--plain] [--include-network] [--refresh] [--watch <duration>] [--json-stream]", name))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	includeNetwork, _, err := flags.boolStrict("include-network")
+	if err != nil {
+		die(err)
+	}
+	jsonStream, _, err := flags.boolStrict("json-stream")
+	if err != nil {
+		die(err)
+	}
+	refresh, _, err := flags.boolStrict("refresh")
+	if err != nil {
+		die(err)
+	}
+	kind, err := parseDeviceKind(flags, "kind")
+	if err != nil {
+		die(err)
+	}
+	watch := time.Duration(0)
+	if raw := strings.TrimSpace(flags.string("watch")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --watch %q (expected duration like 2s)", raw))
+		}
+		watch = d
+	}
+	if jsonStream && jsonOut {
+		die(usageErrf("--json and --json-stream are mutually exclusive"))
+	}
+	if jsonStream && watch <= 0 {
+		watch = 2 * time.Second
+	}
+	redact := func(devs []music.AirPlayDevice) []music.AirPlayDevice {
+		if !includeNetwork {
+			for i := range devs {
+				devs[i].NetworkAddress = ""
+			}
+		}
+		return devs
+	}
+
+	if watch <= 0 {
+		list := listDevicesCached
+		if refresh {
+			list = refreshDeviceCache
+		}
+		devs, cachedAt, err := list(ctx)
+		if err != nil {
+			die(err)
+		}
+		reportCacheAge(name, cachedAt)
+		devs = filterDeviceKind(devs, kind)
+		if jsonOut {
+			listed := make([]listedDevice, 0, len(devs))
+			for _, d := range redact(devs) {
+				listed = append(listed, listedDevice{AirPlayDevice: d, CachedAt: cachedAt})
+			}
+			writeJSON(listed)
+			return
+		}
+		printDevicesTable(os.Stdout, devs, plain)
+		return
+	}
+
+	debugf("%s: watch=%s json=%t json-stream=%t", name, watch, jsonOut, jsonStream)
+	// watching runs until interrupted, so it must not inherit the per-command timeout.
+	base := context.WithoutCancel(ctx)
+	inPlace := !plain && isInteractiveStdout()
+	snapshots := 0
+	err = watchDevices(base, watch, func(devs []music.AirPlayDevice, events []deviceEvent) {
+		devs = filterDeviceKind(devs, kind)
+		if kind != "" {
+			kept := events[:0]
+			for _, ev := range events {
+				if music.DeviceKind(ev.Device.Kind) == kind {
+					kept = append(kept, ev)
+				}
+			}
+			events = kept
+		}
+		switch {
+		case jsonStream:
+			for _, ev := range events {
+				ev.Device = redact([]music.AirPlayDevice{ev.Device})[0]
+				writeJSONLine(ev)
+			}
+		case jsonOut:
+			writeJSON(redact(devs))
+		default:
+			snapshots++
+			if inPlace {
+				fmt.Fprint(os.Stdout, "\x1b[H\x1b[2J")
+			} else if snapshots > 1 {
+				fmt.Println()
+			}
+			if !plain {
+				fmt.Printf("--- devices snapshot %d @ %s ---\n", snapshots, time.Now().Format(time.RFC3339))
+			}
+			printDevicesWatchTable(os.Stdout, devs, events, plain, inPlace)
+		}
+	})
+	if err != nil {
+		die(err)
+	}
+}
+
+// filterDeviceKind keeps the devices of kind (see music.DeviceKind), or all
+// of them when kind is empty.
+func filterDeviceKind(devs []music.AirPlayDevice, kind string) []music.AirPlayDevice {
+	if kind == "" {
+		return devs
+	}
+	out := []music.AirPlayDevice{}
+	for _, d := range devs {
+		if music.DeviceKind(d.Kind) == kind {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// watchDevices polls the AirPlay devices every interval until ctx is done. fn
+// gets every snapshot plus the events derived from the previous one; the
+// first snapshot is a baseline and yields no events. Poll errors are logged
+// and skipped, as in watchNowPlaying.
+func watchDevices(ctx context.Context, interval time.Duration, fn func([]music.AirPlayDevice, []deviceEvent)) error {
+	var prev []music.AirPlayDevice
+	first := true
+	return runStatusLoop(ctx, interval, func() error {
+		pollCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		defer cancel()
+		devs, err := listAirPlayDevices(pollCtx)
+		if err != nil {
+			debugf("devices: poll failed: %v", err)
+			return nil
+		}
+		var events []deviceEvent
+		if !first {
+			events = diffDevices(prev, devs, time.Now())
+		}
+		first = false
+		prev = devs
+		fn(devs, events)
+		return nil
+	})
+}
+
+func diffDevices(prev, cur []music.AirPlayDevice, at time.Time) []deviceEvent {
+	key := func(d music.AirPlayDevice) string { return strings.ToLower(strings.TrimSpace(d.Name)) }
+	before := make(map[string]music.AirPlayDevice, len(prev))
+	for _, d := range prev {
+		before[key(d)] = d
+	}
+	var events []deviceEvent
+	seen := map[string]bool{}
+	for _, d := range cur {
+		k := key(d)
+		seen[k] = true
+		old, ok := before[k]
+		if !ok {
+			events = append(events, deviceEvent{Event: "device.added", At: at, Device: d})
+			continue
+		}
+		if d.Available != old.Available {
+			ev := "device.offline"
+			if d.Available {
+				ev = "device.online"
+			}
+			events = append(events, deviceEvent{Event: ev, At: at, Device: d})
+		}
+		if d.Selected != old.Selected {
+			ev := "device.deselected"
+			if d.Selected {
+				ev = "device.selected"
+			}
+			events = append(events, deviceEvent{Event: ev, At: at, Device: d})
+		}
+		if d.Volume != old.Volume {
+			v := old.Volume
+			events = append(events, deviceEvent{Event: "device.volume", At: at, PreviousVolume: &v, Device: d})
+		}
+	}
+	for _, d := range prev {
+		if !seen[key(d)] {
+			events = append(events, deviceEvent{Event: "device.removed", At: at, Device: d})
+		}
+	}
+	return events
+}
+
+// printDevicesWatchTable is printDevicesTable with a CHANGE column naming
+// what changed since the last snapshot, in bold on a terminal.
+func printDevicesWatchTable(w io.Writer, devs []music.AirPlayDevice, events []deviceEvent, plain, color bool) {
+	changes := map[string][]string{}
+	for _, ev := range events {
+		k := strings.ToLower(strings.TrimSpace(ev.Device.Name))
+		change := strings.TrimPrefix(ev.Event, "device.")
+		if ev.PreviousVolume != nil {
+			change = fmt.Sprintf("volume %d->%d", *ev.PreviousVolume, ev.Device.Volume)
+		}
+		changes[k] = append(changes[k], change)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "NAME\tKIND\tAVAILABLE\tSELECTED\tVOLUME\tCHANGE")
+	}
+	row := func(d music.AirPlayDevice, change string) {
+		kind := d.Kind
+		if kind == "" {
+			kind = "unknown"
+		}
+		if color && change != "" {
+			// Last column only, so the escapes do not skew the alignment.
+			change = "\x1b[1m" + change + "\x1b[0m"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%d\t%s\n", d.Name, kind, d.Available, d.Selected, d.Volume, change)
+	}
+	for _, d := range devs {
+		row(d, strings.Join(changes[strings.ToLower(strings.TrimSpace(d.Name))], ", "))
+	}
+	for _, ev := range events {
+		if ev.Event == "device.removed" {
+			row(ev.Device, "removed")
+		}
+	}
+	_ = tw.Flush()
+}
+
+func isInteractiveStdout() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return (info.Mode() & os.ModeCharDevice) != 0
+}
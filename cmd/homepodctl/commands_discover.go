@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/airplay"
+)
+
+func cmdDiscover(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl discover [--timeout <duration>] [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	timeout := 5 * time.Second
+	if raw := strings.TrimSpace(flags.string("timeout")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --timeout %q (expected duration like 5s)", raw))
+		}
+		timeout = d
+	}
+	debugf("discover: timeout=%s", timeout)
+
+	// Browsing is bounded by --timeout, not the per-command deadline.
+	devs, err := discoverNetworkDevices(context.WithoutCancel(ctx), timeout)
+	if err != nil {
+		die(err)
+	}
+	if jsonOut {
+		if devs == nil {
+			devs = []airplay.Device{}
+		}
+		writeJSON(devs)
+		return
+	}
+	printNetworkDevicesTable(os.Stdout, devs, plain)
+}
+
+func printNetworkDevicesTable(w io.Writer, devs []airplay.Device, plain bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "NAME\tMODEL\tADDRESS\tFIRMWARE\tOS\tCOMPANION")
+	}
+	for _, d := range devs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\n", d.Name, dashIfEmpty(d.Model), d.Addr, dashIfEmpty(d.Version), dashIfEmpty(d.OSVersion), d.Companion)
+	}
+	_ = tw.Flush()
+}
+
+func dashIfEmpty(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
+
+// networkDevicesCheck compares receivers found via Bonjour with the AirPlay
+// devices Music.app can see. musicOK reports whether Music.app was reachable.
+func networkDevicesCheck(ctx context.Context, musicOK bool) doctorCheck {
+	found, err := discoverNetworkDevices(ctx, 2*time.Second)
+	if err != nil {
+		return doctorCheck{Name: "network-devices", Status: "warn", Message: fmt.Sprintf("Bonjour discovery failed: %v", err), Tip: "Check local network access for your terminal in System Settings > Privacy & Security."}
+	}
+	if len(found) == 0 {
+		return doctorCheck{Name: "network-devices", Status: "warn", Message: "no AirPlay receivers found on the network", Tip: "Make sure the Mac and HomePods are on the same network."}
+	}
+	if !musicOK {
+		return doctorCheck{Name: "network-devices", Status: "pass", Message: fmt.Sprintf("%d AirPlay receiver(s) on the network", len(found))}
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return doctorCheck{Name: "network-devices", Status: "pass", Message: fmt.Sprintf("%d AirPlay receiver(s) on the network", len(found))}
+	}
+	names := make([]string, 0, len(devs))
+	for _, d := range devs {
+		names = append(names, d.Name)
+	}
+	var missing []string
+	for _, d := range found {
+		if !containsFold(names, d.Name) {
+			missing = append(missing, d.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return doctorCheck{
+			Name:    "network-devices",
+			Status:  "warn",
+			Message: fmt.Sprintf("on the network but not in Music.app: %s", strings.Join(missing, ", ")),
+			Tip:     "Check the device's AirPlay access settings in the Home app, or restart Music.app.",
+		}
+	}
+	return doctorCheck{Name: "network-devices", Status: "pass", Message: fmt.Sprintf("%d AirPlay receiver(s) on the network, all visible in Music.app", len(found))}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type manWriteResult struct {
+	OK     bool     `json:"ok"`
+	Dir    string   `json:"dir"`
+	Files  []string `json:"files"`
+	DryRun bool     `json:"dryRun,omitempty"`
+}
+
+func cmdDocs(args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	jsonOut, _, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	dir := strings.TrimSpace(flags.string("out"))
+	if len(positionals) != 1 || positionals[0] != "man" || dir == "" {
+		die(usageErrf("usage: homepodctl docs man --out <dir> [--json] [--dry-run]"))
+	}
+	res, err := writeManPages(expandHomePath(dir), isDryRunInvocation(args))
+	if err != nil {
+		die(err)
+	}
+	if jsonOut {
+		writeJSON(res)
+		return
+	}
+	verb := "wrote"
+	if res.DryRun {
+		verb = "would write"
+	}
+	for _, f := range res.Files {
+		fmt.Printf("%s %s\n", verb, f)
+	}
+}
+
+// writeManPages writes homepodctl.1 and homepodctl-<command>.1 for every
+// command to dir, creating it if needed.
+func writeManPages(dir string, dryRun bool) (manWriteResult, error) {
+	res := manWriteResult{OK: true, Dir: dir, DryRun: dryRun}
+	pages := map[string]string{"homepodctl.1": renderRootManPage()}
+	names := []string{"homepodctl.1"}
+	for _, d := range commandDocs {
+		name := "homepodctl-" + d.Name + ".1"
+		pages[name] = renderManPage(d)
+		names = append(names, name)
+	}
+	if !dryRun {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return res, err
+		}
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		res.Files = append(res.Files, path)
+		if dryRun {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(pages[name]), 0o644); err != nil {
+			return res, fmt.Errorf("write %s: %w", path, err)
+		}
+	}
+	return res, nil
+}
+
+func renderRootManPage() string {
+	var b strings.Builder
+	writeManHeader(&b, "homepodctl", "homepodctl", rootSummary)
+	writeManLines(&b, "SYNOPSIS", rootUsage)
+	b.WriteString(".SH COMMANDS\n")
+	for _, d := range commandDocs {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", manEscape(strings.Join(append([]string{d.Name}, d.Aliases...), ", ")), manEscape(d.Summary))
+	}
+	writeManFlags(&b, usageFlags(rootUsage))
+	writeManNotes(&b, rootNotes)
+	var seeAlso []string
+	for _, d := range commandDocs {
+		seeAlso = append(seeAlso, `\fB`+manEscape("homepodctl-"+d.Name)+`\fR(1)`)
+	}
+	fmt.Fprintf(&b, ".SH SEE ALSO\n%s\n", strings.Join(seeAlso, ",\n"))
+	return b.String()
+}
+
+func renderManPage(d commandDoc) string {
+	var b strings.Builder
+	names := []string{"homepodctl-" + d.Name}
+	for _, a := range d.Aliases {
+		names = append(names, "homepodctl-"+a)
+	}
+	writeManHeader(&b, "homepodctl-"+d.Name, strings.Join(names, ", "), d.Summary)
+	writeManLines(&b, "SYNOPSIS", d.Usage)
+	writeManFlags(&b, usageFlags(d.Usage))
+	writeManNotes(&b, d.Notes)
+	for _, s := range d.Sections {
+		writeManLines(&b, strings.ToUpper(s.Title), s.Lines)
+	}
+	writeManLines(&b, "EXAMPLES", d.Examples)
+	b.WriteString(".SH SEE ALSO\n\\fBhomepodctl\\fR(1)\n")
+	return b.String()
+}
+
+func writeManHeader(b *strings.Builder, page, names, summary string) {
+	fmt.Fprintf(b, ".TH %s 1 \"\" \"homepodctl %s\" \"homepodctl manual\"\n", strings.ToUpper(manEscape(page)), manEscape(version))
+	fmt.Fprintf(b, ".SH NAME\n%s \\- %s\n", manEscape(names), manEscape(summary))
+}
+
+// writeManLines prints lines verbatim, as usage lines and examples must be.
+func writeManLines(b *strings.Builder, title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, ".SH %s\n.nf\n", title)
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s\n", manEscape(line))
+	}
+	b.WriteString(".fi\n")
+}
+
+func writeManFlags(b *strings.Builder, flags []docFlag) {
+	if len(flags) == 0 {
+		return
+	}
+	b.WriteString(".SH OPTIONS\n")
+	for _, f := range flags {
+		fmt.Fprintf(b, ".TP\n\\fB%s\\fR", manEscape(f.Name))
+		if f.Value != "" {
+			fmt.Fprintf(b, " \\fI%s\\fR", manEscape(f.Value))
+		}
+		b.WriteString("\n")
+		if f.Desc != "" {
+			fmt.Fprintf(b, "%s\n", manEscape(f.Desc))
+		}
+	}
+}
+
+func writeManNotes(b *strings.Builder, notes []string) {
+	if len(notes) == 0 {
+		return
+	}
+	b.WriteString(".SH NOTES\n")
+	for _, note := range notes {
+		first, rest, _ := strings.Cut(note, "\n")
+		fmt.Fprintf(b, ".IP \\(bu 2\n%s\n", manEscape(first))
+		if rest != "" {
+			fmt.Fprintf(b, ".nf\n%s\n.fi\n", manEscape(rest))
+		}
+	}
+}
+
+// manEscape keeps roff from reading text as requests or escapes.
+func manEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandDocsMatchDispatchedCommands(t *testing.T) {
+	documented := map[string]bool{}
+	for _, d := range commandDocs {
+		documented[d.Name] = true
+		for _, a := range d.Aliases {
+			documented[a] = true
+		}
+	}
+	for _, c := range cliCommands {
+		if c.Hidden {
+			continue
+		}
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if !documented[name] {
+				t.Errorf("command %q has no commandDocs entry", name)
+			}
+			delete(documented, name)
+		}
+	}
+	for name := range documented {
+		t.Errorf("commandDocs entry %q is not a command", name)
+	}
+}
+
+func TestCommandDocFlagsAreKnown(t *testing.T) {
+	check := func(where string, lines []string) {
+		for _, f := range usageFlags(lines) {
+			if f.Desc == "" {
+				t.Errorf("%s: flag %s is missing from flagDefs", where, f.Name)
+			}
+		}
+	}
+	check("root", rootUsage)
+	for _, d := range commandDocs {
+		check(d.Name, d.Usage)
+	}
+}
+
+func TestCmdHelpJSON(t *testing.T) {
+	out := captureStdout(t, func() { cmdHelp([]string{"play", "--json"}) })
+	var got commandHelp
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, out)
+	}
+	if got.Name != "play" || len(got.Usage) == 0 {
+		t.Fatalf("help = %+v", got)
+	}
+	if len(got.Args) == 0 || got.Args[0].Name != "<playlist-query>" {
+		t.Fatalf("args = %+v", got.Args)
+	}
+	var room docFlag
+	for _, f := range got.Flags {
+		if f.Name == "--room" {
+			room = f
+		}
+	}
+	if room.Value != "<name>" || room.Desc == "" {
+		t.Fatalf("--room flag = %+v", room)
+	}
+
+	idx := buildHelpIndex()
+	if len(idx.Commands) != len(commandDocs) || len(idx.Flags) == 0 {
+		t.Fatalf("index has %d commands and %d flags", len(idx.Commands), len(idx.Flags))
+	}
+}
+
+func TestWriteManPages(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "man1")
+	res, err := writeManPages(dir, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(res.Files) != len(commandDocs)+1 {
+		t.Fatalf("dry run files = %d", len(res.Files))
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("dry run created %s", dir)
+	}
+
+	if _, err := writeManPages(dir, false); err != nil {
+		t.Fatalf("writeManPages: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "homepodctl-play.1"))
+	if err != nil {
+		t.Fatalf("read play page: %v", err)
+	}
+	page := string(b)
+	for _, want := range []string{
+		".TH HOMEPODCTL\\-PLAY 1",
+		".SH NAME\nhomepodctl\\-play \\- play an Apple Music playlist\n",
+		"\\fB\\-\\-room\\fR \\fI<name>\\fR\n",
+		".SH EXAMPLES\n.nf\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("play page missing %q:\n%s", want, page)
+		}
+	}
+	root, err := os.ReadFile(filepath.Join(dir, "homepodctl.1"))
+	if err != nil {
+		t.Fatalf("read root page: %v", err)
+	}
+	if !strings.Contains(string(root), "\\fBhomepodctl\\-play\\fR(1)") {
+		t.Errorf("root page does not link the play page")
+	}
+}
+
+func TestManEscape(t *testing.T) {
+	if got := manEscape(".hidden --flag 'x' \\n"); got != "\\&.hidden \\-\\-flag 'x' \\en" {
+		t.Fatalf("manEscape = %q", got)
+	}
+}
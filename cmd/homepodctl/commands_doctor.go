@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
 )
 
 type doctorCheck struct {
@@ -68,6 +71,20 @@ func runDoctorChecks(ctx context.Context) doctorReport {
 	} else {
 		add(doctorCheck{Name: "shortcuts", Status: "pass", Message: "shortcuts available"})
 	}
+	// With --host the backends run in the remote Mac's session, not this one.
+	if remoteHost == "" {
+		sessionCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		session, err := guiSessionManager(sessionCtx)
+		cancel()
+		switch {
+		case err != nil || session == "":
+			debugf("doctor: launchctl managername: %v", err)
+		case session == guiSession:
+			add(doctorCheck{Name: "gui-session", Status: "pass", Message: "GUI session (Aqua)"})
+		default:
+			add(doctorCheck{Name: "gui-session", Status: "warn", Message: fmt.Sprintf("no GUI session (launchd session %s)", session), Tip: "Music.app and Shortcuts may not answer from here (e.g. over ssh); run from a desktop login or `sudo homepodctl exec --gui-session -- <command>`."})
+		}
+	}
 
 	path, err := configPath()
 	if err != nil {
@@ -82,11 +99,30 @@ func runDoctorChecks(ctx context.Context) doctorReport {
 		} else {
 			add(doctorCheck{Name: "config", Status: "pass", Message: fmt.Sprintf("aliases=%d", len(cfg.Aliases))})
 		}
+		if cfgErr == nil {
+			shortcutsCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if c, ok := nativeShortcutsCheck(shortcutsCtx, cfg); ok {
+				add(c)
+			}
+			cancel()
+		}
 	}
 
 	backendCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	// Checked before the backend probe, which would launch Music.app.
+	running, err := musicAppRunning(backendCtx)
+	if err != nil {
+		add(doctorCheck{Name: "music-app", Status: "warn", Message: formatError(err)})
+	} else if !running {
+		add(doctorCheck{Name: "music-app", Status: "warn", Message: "Music.app is not running", Tip: "Commands launch it (hidden) unless --no-launch or defaults.launch=off is set."})
+	} else {
+		add(doctorCheck{Name: "music-app", Status: "pass", Message: "Music.app running"})
+	}
+	add(automationCheck(backendCtx, running))
+	musicOK := true
 	if _, err := getNowPlaying(backendCtx); err != nil {
+		musicOK = false
 		add(doctorCheck{
 			Name:    "music-backend",
 			Status:  "warn",
@@ -96,9 +132,85 @@ func runDoctorChecks(ctx context.Context) doctorReport {
 	} else {
 		add(doctorCheck{Name: "music-backend", Status: "pass", Message: "Music backend reachable"})
 	}
+
+	netCtx, cancelNet := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelNet()
+	add(networkDevicesCheck(netCtx, musicOK))
 	return report
 }
 
+// automationCheck reports whether the app hosting homepodctl (the terminal,
+// usually) may send Apple events to Music.app, with the System Settings
+// steps to fix it. It is skipped while Music.app is not running, because the
+// probe would launch it.
+func automationCheck(ctx context.Context, musicRunning bool) doctorCheck {
+	c := doctorCheck{Name: "automation"}
+	if !musicRunning {
+		c.Status, c.Message = "warn", "not checked: Music.app is not running"
+		c.Tip = "Open Music.app and run `homepodctl doctor` again."
+		return c
+	}
+	host, bundleID := automationHost()
+	settings := fmt.Sprintf("System Settings → Privacy & Security → Automation → %s → turn on Music", host)
+	perm, err := probeAutomation(ctx)
+	switch perm {
+	case music.AutomationGranted:
+		c.Status, c.Message = "pass", fmt.Sprintf("%s may control Music.app", host)
+	case music.AutomationDenied:
+		c.Status, c.Message = "fail", fmt.Sprintf("%s is not allowed to control Music.app (-1743)", host)
+		c.Tip = settings + "."
+		if bundleID != "" {
+			c.Tip += fmt.Sprintf(" If %s is not listed, run `tccutil reset AppleEvents %s` and run any homepodctl command to get the prompt again.", host, bundleID)
+		}
+	case music.AutomationUndetermined:
+		c.Status, c.Message = "warn", fmt.Sprintf("%s has not been granted Automation access to Music.app yet (-1744)", host)
+		c.Tip = fmt.Sprintf("Run `homepodctl status` in %s on the Mac's own session and click OK on the prompt (it cannot appear over SSH), or use %s.", host, settings)
+	default:
+		c.Status, c.Message = "warn", "could not determine Automation permission: "+formatError(err)
+		c.Tip = "If commands keep failing, check " + settings + "."
+	}
+	return c
+}
+
+// automationHost names the app macOS attributes our Apple events to, from
+// the environment the terminal sets. The bundle ID is empty when unknown.
+func automationHost() (name, bundleID string) {
+	bundleID = os.Getenv("__CFBundleIdentifier")
+	known := map[string]string{
+		"com.apple.Terminal":      "Terminal",
+		"com.googlecode.iterm2":   "iTerm",
+		"com.microsoft.VSCode":    "Visual Studio Code",
+		"com.github.wez.wezterm":  "WezTerm",
+		"com.mitchellh.ghostty":   "Ghostty",
+		"net.kovidgoyal.kitty":    "kitty",
+		"org.alacritty":           "Alacritty",
+		"dev.warp.Warp-Stable":    "Warp",
+		"com.apple.ScriptEditor2": "Script Editor",
+	}
+	if name, ok := known[bundleID]; ok {
+		return name, bundleID
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "Apple_Terminal":
+		return "Terminal", "com.apple.Terminal"
+	case "iTerm.app":
+		return "iTerm", "com.googlecode.iterm2"
+	case "vscode":
+		return "Visual Studio Code", "com.microsoft.VSCode"
+	case "WezTerm":
+		return "WezTerm", "com.github.wez.wezterm"
+	case "ghostty":
+		return "Ghostty", "com.mitchellh.ghostty"
+	}
+	if os.Getenv("SSH_CONNECTION") != "" {
+		return "sshd-keygen-wrapper", ""
+	}
+	if bundleID != "" {
+		return bundleID, bundleID
+	}
+	return "your terminal app", ""
+}
+
 func printDoctorReport(report doctorReport, plain bool) {
 	if plain {
 		fmt.Println("STATUS\tCHECK\tMESSAGE\tTIP")
@@ -182,6 +182,22 @@ func completionData(cfg *native.Config) (aliases []string, rooms []string, playl
 			roomSet[room] = true
 		}
 	}
+	for group, members := range cfg.Groups {
+		if strings.TrimSpace(group) != "" {
+			roomSet[group] = true
+		}
+		for _, room := range members {
+			room = strings.TrimSpace(room)
+			if room != "" {
+				roomSet[room] = true
+			}
+		}
+	}
+	for name := range cfg.Devices {
+		if strings.TrimSpace(name) != "" {
+			roomSet[name] = true
+		}
+	}
 	for room := range cfg.Native.Playlists {
 		if strings.TrimSpace(room) != "" {
 			roomSet[room] = true
@@ -213,198 +229,114 @@ func completionData(cfg *native.Config) (aliases []string, rooms []string, playl
 	return aliases, rooms, playlists
 }
 
-func joinBashWords(words []string) string {
-	escaped := make([]string, 0, len(words))
-	for _, w := range words {
-		escaped = append(escaped, strings.ReplaceAll(w, " ", `\ `))
-	}
-	return strings.Join(escaped, " ")
-}
-
-func joinZshWords(words []string) string {
-	quoted := make([]string, 0, len(words))
-	for _, w := range words {
-		quoted = append(quoted, "'"+strings.ReplaceAll(w, "'", `'\''`)+"'")
-	}
-	return strings.Join(quoted, " ")
-}
+// The scripts only relay the words on the command line to
+// `homepodctl __complete` (see cmdComplete) and present its answer, so new
+// commands, rooms, and playlists complete without regenerating them.
 
-func completionScript(shell string) (string, error) {
-	cfg, _ := native.LoadConfigOptional()
-	aliases, rooms, playlists := completionData(cfg)
-	aliasBash := joinBashWords(aliases)
-	roomBash := joinBashWords(rooms)
-	playlistBash := joinBashWords(playlists)
-	aliasZsh := joinZshWords(aliases)
-	roomZsh := joinZshWords(rooms)
-	playlistZsh := joinZshWords(playlists)
-
-	switch shell {
-	case "bash":
-		return fmt.Sprintf(`# bash completion for homepodctl
+const bashCompletionScript = `# bash completion for homepodctl
+# Candidates come from "homepodctl __complete <words...> <current word>": one
+# per line, then :<directive> (1 files, 2 directories, 4 no trailing space).
 _homepodctl_completion() {
-  local cur prev
+  local cur="${COMP_WORDS[COMP_CWORD]}"
+  local line directive
+  local -a lines
   COMPREPLY=()
-  cur="${COMP_WORDS[COMP_CWORD]}"
-  prev="${COMP_WORDS[COMP_CWORD-1]}"
-  local aliases="%s"
-  local rooms="%s"
-  local playlists="%s"
-  local presets="morning focus winddown party reset"
-  local cmds="help version config automation plan schema completion setup doctor devices out playlists status now aliases run pause stop next prev play volume vol native-run config-init"
-  if [[ $COMP_CWORD -eq 1 ]]; then
-    COMPREPLY=( $(compgen -W "$cmds --help --version --verbose --quiet" -- "$cur") )
-    return 0
-  fi
-  if [[ "${COMP_WORDS[1]}" == "run" && $COMP_CWORD -eq 2 ]]; then
-    COMPREPLY=( $(compgen -W "$aliases" -- "$cur") )
-    return 0
-  fi
-  if [[ "$prev" == "--room" ]]; then
-    COMPREPLY=( $(compgen -W "$rooms" -- "$cur") )
-    return 0
-  fi
-  if [[ "$prev" == "--playlist" || ( "${COMP_WORDS[1]}" == "play" && $COMP_CWORD -eq 2 ) ]]; then
-    COMPREPLY=( $(compgen -W "$playlists" -- "$cur") )
+  while IFS= read -r line; do
+    lines+=( "$line" )
+  done < <(homepodctl __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null)
+  [[ ${#lines[@]} -gt 0 ]] || return 0
+  directive="${lines[${#lines[@]}-1]#:}"
+  [[ $directive == [0-9]* ]] || return 0
+  unset 'lines[${#lines[@]}-1]'
+  if (( directive & 1 )); then
+    COMPREPLY=( $(compgen -f -- "$cur") )
+    compopt -o filenames 2>/dev/null
     return 0
   fi
-  if [[ "$prev" == "--preset" ]]; then
-    COMPREPLY=( $(compgen -W "$presets" -- "$cur") )
+  if (( directive & 2 )); then
+    COMPREPLY=( $(compgen -d -- "$cur") )
+    compopt -o filenames 2>/dev/null
     return 0
   fi
-  if [[ "${COMP_WORDS[1]}" == "out" && "${COMP_WORDS[2]}" == "set" ]]; then
-    COMPREPLY=( $(compgen -W "$rooms" -- "$cur") )
-    return 0
+  for line in "${lines[@]}"; do
+    COMPREPLY+=( "$(printf '%q' "${line%%$'\t'*}")" )
+  done
+  if (( directive & 4 )); then
+    compopt -o nospace 2>/dev/null
   fi
-  COMPREPLY=( $(compgen -W "--json --plain --help --version --verbose --quiet --backend --room --playlist --playlist-id --shuffle --volume --watch --query --limit --shortcut --include-network --file --dry-run --no-input --preset --name" -- "$cur") )
+  return 0
 }
 complete -F _homepodctl_completion homepodctl
-`, aliasBash, roomBash, playlistBash), nil
-	case "zsh":
-		return fmt.Sprintf(`#compdef homepodctl
+`
+
+const zshCompletionScript = `#compdef homepodctl
+# Candidates come from "homepodctl __complete <words...> <current word>": one
+# per line with an optional tab-separated description, then :<directive>
+# (1 files, 2 directories, 4 no trailing space).
 _homepodctl() {
-  local -a commands
-  local -a opts
-  local -a aliases
-  local -a rooms
-  local -a playlists
-  local -a presets
-  commands=(
-    'help:Show help'
-    'version:Show version'
-    'config:Inspect/update config'
-    'automation:Run automation routines'
-    'plan:Preview command execution'
-    'schema:Show JSON schemas'
-    'completion:Generate shell completion'
-    'setup:Onboard and verify environment'
-    'doctor:Run diagnostics'
-    'devices:List devices'
-    'out:Manage outputs'
-    'playlists:List playlists'
-    'status:Show playback, route, and backend status'
-    'now:Alias of status'
-    'aliases:List aliases'
-    'run:Run alias'
-    'pause:Pause playback'
-    'stop:Stop playback'
-    'next:Next track'
-    'prev:Previous track'
-    'play:Play playlist'
-    'volume:Set volume'
-    'vol:Set volume'
-    'native-run:Run shortcut'
-    'config-init:Write starter config'
-  )
-  aliases=(%s)
-  rooms=(%s)
-  playlists=(%s)
-  presets=('morning' 'focus' 'winddown' 'party' 'reset')
-  opts=(
-    '--version[show version]'
-    '--json[output JSON]'
-    '--plain[plain output]'
-    '--verbose[verbose diagnostics]'
-    '--quiet[suppress non-essential success output]'
-    '--dry-run[preview without side effects]'
-    '--backend[backend]:backend:(airplay native)'
-    '--room[room name]'
-    '--playlist[playlist name]'
-    '--playlist-id[playlist ID]'
-    '--shuffle[shuffle toggle]'
-    '--volume[volume 0-100]'
-    '--watch[poll interval]'
-    '--query[playlist filter]'
-    '--limit[max results]'
-    '--shortcut[shortcut name]'
-    '--include-network[include network address]'
-    '--file[input file]'
-    '--no-input[non-interactive mode]'
-    '--preset[preset name]'
-    '--name[routine name]'
-  )
-  if [[ $CURRENT -eq 3 && ${words[2]} == run ]]; then
-    _describe -t aliases "alias" aliases
-    return
-  fi
-  if [[ ${words[CURRENT-1]} == --room ]]; then
-    _describe -t rooms "room" rooms
+  local -a lines entries
+  local line value desc directive
+  lines=("${(@f)$(homepodctl __complete "${(@)words[2,CURRENT-1]}" "$PREFIX" 2>/dev/null)}")
+  directive=${lines[-1]#:}
+  [[ $directive == <-> ]] || return 1
+  lines=("${(@)lines[1,-2]}")
+  if (( directive & 1 )); then
+    _files
     return
   fi
-  if [[ ${words[CURRENT-1]} == --playlist || ( ${words[2]} == play && $CURRENT -eq 3 ) ]]; then
-    _describe -t playlists "playlist" playlists
+  if (( directive & 2 )); then
+    _files -/
     return
   fi
-  if [[ ${words[CURRENT-1]} == --preset ]]; then
-    _describe -t presets "preset" presets
-    return
+  for line in "${lines[@]}"; do
+    [[ -n $line ]] || continue
+    value=${line%%$'\t'*}
+    desc=""
+    [[ $line == *$'\t'* ]] && desc=${line#*$'\t'}
+    entries+=("${value//:/\\:}${desc:+:$desc}")
+  done
+  if (( directive & 4 )); then
+    _describe -t values 'homepodctl' entries -S ''
+  else
+    _describe -t values 'homepodctl' entries
   fi
-  _arguments $opts '*::command:->command'
-  case $state in
-    command) _describe -t commands "homepodctl command" commands ;;
-  esac
 }
 _homepodctl "$@"
-`, aliasZsh, roomZsh, playlistZsh), nil
+`
+
+const fishCompletionScript = `# fish completion for homepodctl
+# Candidates come from "homepodctl __complete <words...> <current word>": one
+# per line with an optional tab-separated description, then :<directive>
+# (1 files, 2 directories, 4 no trailing space).
+function __homepodctl_complete
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    set -l cur (commandline -ct)
+    set -l out (homepodctl __complete $tokens "$cur" 2>/dev/null)
+    string match -qr '^:[0-9]+$' -- $out[-1]; or return
+    set -l directive (string sub -s 2 -- $out[-1])
+    set -e out[-1]
+    if test (math "bitand($directive, 1)") -ne 0
+        __fish_complete_path "$cur"
+        return
+    end
+    if test (math "bitand($directive, 2)") -ne 0
+        __fish_complete_directories "$cur"
+        return
+    end
+    printf '%s\n' $out
+end
+complete -c homepodctl -f -a '(__homepodctl_complete)'
+`
+
+func completionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletionScript, nil
+	case "zsh":
+		return zshCompletionScript, nil
 	case "fish":
-		var fish strings.Builder
-		fish.WriteString(`# fish completion for homepodctl
-complete -c homepodctl -f -a "help version config automation plan schema completion setup doctor devices out playlists status now aliases run pause stop next prev play volume vol native-run config-init"
-complete -c homepodctl -l version
-complete -c homepodctl -l json
-complete -c homepodctl -l plain
-complete -c homepodctl -l verbose
-complete -c homepodctl -l quiet
-complete -c homepodctl -l backend
-complete -c homepodctl -l room
-complete -c homepodctl -l playlist
-complete -c homepodctl -l playlist-id
-complete -c homepodctl -l shuffle
-complete -c homepodctl -l volume
-complete -c homepodctl -l watch
-complete -c homepodctl -l query
-complete -c homepodctl -l limit
-complete -c homepodctl -l shortcut
-complete -c homepodctl -l include-network
-complete -c homepodctl -l file
-complete -c homepodctl -l dry-run
-complete -c homepodctl -l no-input
-complete -c homepodctl -l preset
-complete -c homepodctl -l name
-complete -c homepodctl -n '__fish_seen_argument --preset' -a "morning focus winddown party reset"
-`)
-		for _, a := range aliases {
-			fish.WriteString(fmt.Sprintf("complete -c homepodctl -n '__fish_seen_subcommand_from run' -a %q\n", a))
-		}
-		for _, r := range rooms {
-			fish.WriteString(fmt.Sprintf("complete -c homepodctl -n '__fish_seen_argument --room' -a %q\n", r))
-			fish.WriteString(fmt.Sprintf("complete -c homepodctl -n '__fish_seen_subcommand_from out; and __fish_seen_subcommand_from set' -a %q\n", r))
-		}
-		for _, p := range playlists {
-			fish.WriteString(fmt.Sprintf("complete -c homepodctl -n '__fish_seen_subcommand_from play' -a %q\n", p))
-			fish.WriteString(fmt.Sprintf("complete -c homepodctl -n '__fish_seen_argument --playlist' -a %q\n", p))
-		}
-		return fish.String(), nil
+		return fishCompletionScript, nil
 	default:
 		return "", usageErrf("unknown shell %q (expected bash, zsh, or fish)", shell)
 	}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/transport"
+)
+
+const execUsage = "usage: homepodctl exec --gui-session [--user <name|uid>] [--json] [--dry-run] -- <command> [args]"
+
+type execResult struct {
+	OK      bool     `json:"ok"`
+	Action  string   `json:"action"`
+	DryRun  bool     `json:"dryRun,omitempty"`
+	Session string   `json:"session,omitempty"`
+	Argv    []string `json:"argv"`
+}
+
+func execGUISessionCommand(ctx context.Context, argv []string) error {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// cmdExec runs a command in the GUI session of the logged-in user, where
+// Music.app and Shortcuts answer scripts, e.g. from an ssh login.
+func cmdExec(ctx context.Context, args []string) {
+	sep := -1
+	for i, a := range args {
+		if a == "--" {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 || sep == len(args)-1 {
+		die(usageErrf("%s", execUsage))
+	}
+	flags, positionals, err := parseArgs(args[:sep])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("%s", execUsage))
+	}
+	gui, _, err := flags.boolStrict("gui-session")
+	if err != nil {
+		die(err)
+	}
+	if !gui {
+		die(usageErrf("exec needs --gui-session (%s)", execUsage))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	argv, session, err := guiSessionArgv(args[sep+1:], strings.TrimSpace(flags.string("user")), !opts.DryRun)
+	if err != nil {
+		die(err)
+	}
+	res := execResult{OK: true, Action: "exec", DryRun: opts.DryRun, Session: session, Argv: argv}
+	if opts.DryRun {
+		if opts.JSON {
+			writeJSON(res)
+		} else {
+			fmt.Printf("dry-run: would run %s\n", quoteArgv(argv))
+		}
+		return
+	}
+	debugf("exec: session=%s argv=%q", session, argv)
+	// The command's own output and exit status are the result, so --json
+	// only applies to --dry-run.
+	if err := runGUISessionCommand(ctx, argv); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			exitCode(exitErr.ExitCode())
+		}
+		die(err)
+	}
+}
+
+// guiSessionArgv returns how to run target in the GUI session, and the
+// session this process is in. A homepodctl command name runs this binary.
+// Outside a GUI session it goes through launchctl asuser, which needs root;
+// needRoot reports that as an error instead of letting launchctl fail.
+func guiSessionArgv(target []string, userFlag string, needRoot bool) ([]string, string, error) {
+	argv := append([]string(nil), target...)
+	if _, known := lookupCliCommand(argv[0]); known {
+		self, err := os.Executable()
+		if err != nil {
+			return nil, "", err
+		}
+		argv = append([]string{self}, argv...)
+	}
+	session, headless := headlessSession()
+	if !headless {
+		return argv, guiSession, nil
+	}
+	uid, err := guiSessionUID(userFlag)
+	if err != nil {
+		return nil, session, err
+	}
+	if needRoot && geteuid() != 0 {
+		return nil, session, fmt.Errorf("no GUI session (launchd session %s) and launchctl asuser needs root; run: sudo homepodctl exec --gui-session -- %s", session, quoteArgv(target))
+	}
+	out := []string{"launchctl", "asuser", uid}
+	if uid != "0" {
+		// Run as the user again rather than as root inside their session.
+		out = append(out, "sudo", "-u", "#"+uid, "--")
+	}
+	return append(out, argv...), session, nil
+}
+
+// guiSessionUID is the user whose session exec joins: --user, else the user
+// who ran sudo, else the current user.
+func guiSessionUID(userFlag string) (string, error) {
+	if userFlag == "" {
+		if uid := os.Getenv("SUDO_UID"); uid != "" {
+			return uid, nil
+		}
+		return strconv.Itoa(os.Getuid()), nil
+	}
+	if _, err := strconv.Atoi(userFlag); err == nil {
+		return userFlag, nil
+	}
+	u, err := user.Lookup(userFlag)
+	if err != nil {
+		return "", usageErrf("unknown --user %q", userFlag)
+	}
+	return u.Uid, nil
+}
+
+func quoteArgv(argv []string) string {
+	words := make([]string, 0, len(argv))
+	for _, a := range argv {
+		words = append(words, transport.ShellQuote(a))
+	}
+	return strings.Join(words, " ")
+}
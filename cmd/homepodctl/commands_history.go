@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// historyEntry is one line of history.jsonl: a mutating command, what it
+// resolved to, and how it ended.
+type historyEntry struct {
+	Time       string          `json:"time"`
+	Command    string          `json:"command"`
+	Args       []string        `json:"args"`
+	OK         bool            `json:"ok"`
+	ExitCode   int             `json:"exitCode"`
+	Error      string          `json:"error,omitempty"`
+	DurationMS int64           `json:"durationMs"`
+	Result     json.RawMessage `json:"result,omitempty"`
+
+	started time.Time
+}
+
+// history.jsonl is trimmed once it grows past maxHistorySize: the newest
+// entries are kept, at most maxHistoryEntries of them and at most half the
+// size, so the file is not rewritten again for a while.
+const (
+	maxHistorySize    = 2 << 20
+	maxHistoryEntries = 1000
+)
+
+// historyRun is the command being recorded; nil when the current command is
+// read-only, a dry run, or history is not started yet.
+var historyRun *historyEntry
+
+func defaultHistoryPath() (string, error) {
+	return state.Path("history.jsonl")
+}
+
+// isHistoryCommand reports whether cmd changes playback, outputs, or the
+// library, and so belongs in the history.
+func isHistoryCommand(cmd string, args []string) bool {
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch cmd {
+	case "play", "radio", "volume", "vol", "mute", "unmute", "duck", "unduck", "announce", "move", "handoff", "run",
+		"pause", "stop", "resume", "next", "prev", "love", "dislike", "rate", "native-run", "undo",
+		"shuffle", "crossfade":
+		return true
+	case "alias":
+		return sub == "add" || sub == "remove" || sub == "rename" || sub == "copy"
+	case "out":
+		return sub == "set" || sub == "add" || sub == "remove"
+	case "audio":
+		return sub == "route"
+	case "media":
+		return sub == "playpause" || sub == "next" || sub == "prev"
+	case "mixer":
+		return hasMixerAssignments(args)
+	case "automation", "scene":
+		return sub == "run"
+	case "playlist":
+		return sub == "create" || sub == "add" || sub == "remove-track"
+	}
+	return false
+}
+
+// isDryRunInvocation reports whether args ask for a dry run, reading
+// --dry-run the way commands do ("--dry-run false" is not one). Args that do
+// not parse are not a dry run; the command rejects them itself.
+func isDryRunInvocation(args []string) bool {
+	if dryRunAll {
+		return true
+	}
+	flags, _, err := parseArgs(args)
+	if err != nil {
+		return false
+	}
+	dryRun, _, err := flags.boolStrict("dry-run")
+	return err == nil && dryRun
+}
+
+func beginHistory(cmd string, args []string) {
+	if !isHistoryCommand(cmd, args) || isDryRunInvocation(args) {
+		return
+	}
+	now := time.Now()
+	historyRun = &historyEntry{
+		Time:    now.UTC().Format(time.RFC3339),
+		Command: cmd,
+		Args:    append([]string{}, args...),
+		started: now,
+	}
+}
+
+// recordResult attaches the command's resolved plan or result to the history
+// entry being recorded, hands it to plan when the command is being planned,
+// and runs the command's post hook with it.
+func recordResult(v any) {
+	if planCapture != nil {
+		planCapture.result, planCapture.ok = v, true
+	}
+	runPostHook(v)
+	if historyRun == nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		debugf("history: encode result: %v", err)
+		return
+	}
+	historyRun.Result = b
+}
+
+// finishHistory appends the recorded command to history.jsonl. Failures to
+// write history never fail the command itself.
+func finishHistory(code int, cmdErr error) {
+	e := historyRun
+	if e == nil {
+		return
+	}
+	historyRun = nil
+	e.OK = code == 0
+	e.ExitCode = code
+	if cmdErr != nil {
+		e.Error = formatError(cmdErr)
+	}
+	e.DurationMS = time.Since(e.started).Milliseconds()
+	if err := appendHistory(*e); err != nil {
+		debugf("history: %v", err)
+	}
+}
+
+func appendHistory(e historyEntry) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() <= maxHistorySize {
+		return err
+	}
+	return trimHistory(path)
+}
+
+// trimHistory rewrites history.jsonl with its newest entries, within
+// maxHistoryEntries and half of maxHistorySize.
+func trimHistory(path string) error {
+	entries, err := readHistory(maxHistoryEntries)
+	if err != nil {
+		return err
+	}
+	lines := make([][]byte, len(entries))
+	size, keep := 0, len(entries)
+	for i := len(entries) - 1; i >= 0; i-- {
+		b, err := json.Marshal(entries[i])
+		if err != nil {
+			return err
+		}
+		if size+len(b)+1 > maxHistorySize/2 {
+			break
+		}
+		lines[i], size, keep = b, size+len(b)+1, i
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*.jsonl")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, b := range lines[keep:] {
+		_, _ = w.Write(append(b, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	debugf("history: trimmed to %d entries", len(entries)-keep)
+	return os.Rename(tmp.Name(), path)
+}
+
+// readHistory returns the last limit entries (all when limit <= 0), oldest
+// first. Unparseable lines are skipped.
+func readHistory(limit int) ([]historyEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []historyEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	entries := []historyEntry{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e historyEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			debugf("history: skipping line: %v", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+func cmdHistory(args []string) {
+	if len(args) > 0 && args[0] == "tracks" {
+		cmdHistoryTracks(args[1:])
+		return
+	}
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl history [tracks] [--limit N] [--json] [--plain]"))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	limit := 20
+	if n, ok, err := flags.intStrict("limit"); err != nil {
+		die(err)
+	} else if ok {
+		if n < 0 {
+			die(usageErrf("--limit must be >= 0"))
+		}
+		limit = n
+	}
+	entries, err := readHistory(limit)
+	if err != nil {
+		die(err)
+	}
+	if opts.JSON {
+		writeJSON(entries)
+		return
+	}
+	if len(entries) == 0 {
+		if !quiet {
+			path, _ := historyPath()
+			fmt.Printf("No history yet (%s)\n", path)
+		}
+		return
+	}
+	printHistoryTable(os.Stdout, entries, opts.Plain)
+}
+
+func printHistoryTable(w io.Writer, entries []historyEntry, plain bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "TIME\tCOMMAND\tRESULT\tDURATION")
+	}
+	for _, e := range entries {
+		result := "ok"
+		if !e.OK {
+			result = fmt.Sprintf("exit %d", e.ExitCode)
+			if e.Error != "" {
+				result += ": " + e.Error
+			}
+		}
+		command := strings.TrimSpace(e.Command + " " + strings.Join(e.Args, " "))
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%dms\n", e.Time, command, result, e.DurationMS)
+	}
+	_ = tw.Flush()
+}
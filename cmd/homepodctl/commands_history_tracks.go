@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// maxTrackLogEntries bounds tracks.jsonl; older tracks are dropped.
+const maxTrackLogEntries = 1000
+
+// trackLogEntry is one line of tracks.jsonl: a track seen playing and the
+// outputs it played on.
+type trackLogEntry struct {
+	Time         string   `json:"time"`
+	Name         string   `json:"name"`
+	Artist       string   `json:"artist,omitempty"`
+	Album        string   `json:"album,omitempty"`
+	PersistentID string   `json:"persistentID,omitempty"`
+	Playlist     string   `json:"playlist,omitempty"`
+	Rooms        []string `json:"rooms,omitempty"`
+}
+
+// trackLogEnabled is set for real invocations, so tests that fake now
+// playing never write the log.
+var trackLogEnabled bool
+
+// trackLogTail remembers the last entry and length of tracks.jsonl as this
+// process last wrote or read it, so a poller (the daemon) does not re-read
+// the whole log on every poll. A size or mtime change means another process
+// wrote it, and the log is read again.
+type trackLogTail struct {
+	path    string
+	size    int64
+	modTime time.Time
+	last    *trackLogEntry
+	count   int
+}
+
+var (
+	trackTailMu sync.Mutex
+	trackTail   trackLogTail
+)
+
+func defaultTrackLogPath() (string, error) {
+	return state.Path("tracks.jsonl")
+}
+
+// noteTrack logs np's track when something is playing. Commands call it with
+// the now-playing snapshot they already have, so the log costs no extra
+// Music.app calls; failures only show up in --verbose.
+func noteTrack(np music.NowPlaying) {
+	if !trackLogEnabled {
+		return
+	}
+	if err := logTrack(np, timeNow()); err != nil {
+		debugf("tracks: %v", err)
+	}
+}
+
+// logTrack appends np's track to tracks.jsonl unless it is the play the last
+// entry already records: the same track on the same rooms, seen again within
+// the track's duration.
+func logTrack(np music.NowPlaying, at time.Time) error {
+	if np.PlayerState != "playing" || trackKey(np.Track) == "" {
+		return nil
+	}
+	e := trackLogEntry{
+		Time:         at.UTC().Format(time.RFC3339),
+		Name:         np.Track.Name,
+		Artist:       np.Track.Artist,
+		Album:        np.Track.Album,
+		PersistentID: np.Track.PersistentID,
+		Playlist:     np.PlaylistName,
+	}
+	for _, o := range np.Outputs {
+		e.Rooms = append(e.Rooms, o.Name)
+	}
+	path, err := trackLogPath()
+	if err != nil {
+		return err
+	}
+	trackTailMu.Lock()
+	defer trackTailMu.Unlock()
+	tail, err := loadTrackLogTail(path)
+	if err != nil {
+		return err
+	}
+	if tail.last != nil && samePlay(*tail.last, e, np.Track.DurationS, at) {
+		return nil
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return err
+	}
+	count := tail.count + 1
+	if tail.count >= maxTrackLogEntries {
+		entries, err := readTrackLog()
+		if err != nil {
+			return err
+		}
+		if len(entries) >= maxTrackLogEntries {
+			entries = entries[len(entries)-maxTrackLogEntries+1:]
+		}
+		if err := rewriteTrackLog(path, append(entries, e)); err != nil {
+			trackTail = trackLogTail{}
+			return err
+		}
+		count = len(entries) + 1
+	} else if err := appendTrackLog(path, e); err != nil {
+		trackTail = trackLogTail{}
+		return err
+	}
+	trackTail = trackLogTail{path: path, last: &e, count: count}
+	if fi, err := os.Stat(path); err == nil {
+		trackTail.size, trackTail.modTime = fi.Size(), fi.ModTime()
+	}
+	return nil
+}
+
+// loadTrackLogTail returns the remembered tail of the log at path, reading
+// the log only when it changed since this process last saw it.
+func loadTrackLogTail(path string) (trackLogTail, error) {
+	fi, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return trackLogTail{}, err
+	}
+	var size int64
+	var modTime time.Time
+	if err == nil {
+		size, modTime = fi.Size(), fi.ModTime()
+	}
+	if trackTail.path == path && trackTail.size == size && trackTail.modTime.Equal(modTime) {
+		return trackTail, nil
+	}
+	entries, err := readTrackLog()
+	if err != nil {
+		return trackLogTail{}, err
+	}
+	trackTail = trackLogTail{path: path, size: size, modTime: modTime, count: len(entries)}
+	if n := len(entries); n > 0 {
+		trackTail.last = &entries[n-1]
+	}
+	return trackTail, nil
+}
+
+func appendTrackLog(path string, e trackLogEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func samePlay(last, e trackLogEntry, durationS float64, at time.Time) bool {
+	if last.PersistentID != e.PersistentID || last.Name != e.Name || last.Artist != e.Artist || last.Album != e.Album {
+		return false
+	}
+	if strings.Join(last.Rooms, "\x00") != strings.Join(e.Rooms, "\x00") {
+		return false
+	}
+	seen, err := time.Parse(time.RFC3339, last.Time)
+	if err != nil {
+		return false
+	}
+	window := time.Duration(durationS * float64(time.Second))
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	return at.Sub(seen) < window
+}
+
+// rewriteTrackLog replaces the log with entries through a temporary file.
+func rewriteTrackLog(path string, entries []trackLogEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tracks-*.jsonl")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readTrackLog returns every logged track, oldest first. Unparseable lines
+// are skipped.
+func readTrackLog() ([]trackLogEntry, error) {
+	path, err := trackLogPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []trackLogEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	entries := []trackLogEntry{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e trackLogEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			debugf("tracks: skipping line: %v", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// filterTrackLog keeps the entries that played in room (any room when empty)
+// at or after since (any time when zero), then the last limit of them (all
+// when limit <= 0).
+func filterTrackLog(entries []trackLogEntry, room string, since time.Time, limit int) []trackLogEntry {
+	out := []trackLogEntry{}
+	for _, e := range entries {
+		if !since.IsZero() {
+			at, err := time.Parse(time.RFC3339, e.Time)
+			if err != nil || at.Before(since) {
+				continue
+			}
+		}
+		if room != "" && !containsFold(e.Rooms, room) {
+			continue
+		}
+		out = append(out, e)
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+func cmdHistoryTracks(args []string) {
+	const usageLine = "usage: homepodctl history tracks [--limit N] [--room <name>] [--since <duration>] [--json] [--plain]"
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf(usageLine))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	limit := 20
+	if n, ok, err := flags.intStrict("limit"); err != nil {
+		die(err)
+	} else if ok {
+		if n < 0 {
+			die(usageErrf("--limit must be >= 0"))
+		}
+		limit = n
+	}
+	var since time.Time
+	if raw := strings.TrimSpace(flags.string("since")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --since %q (expected a duration like 90m or 2h)", raw))
+		}
+		since = timeNow().Add(-d)
+	}
+	entries, err := readTrackLog()
+	if err != nil {
+		die(err)
+	}
+	room := strings.TrimSpace(flags.string("room"))
+	if cfg, err := loadConfigOptional(); err == nil && room != "" {
+		room = cfg.DeviceName(room)
+	}
+	entries = filterTrackLog(entries, room, since, limit)
+	if opts.JSON {
+		writeJSON(entries)
+		return
+	}
+	if len(entries) == 0 {
+		if !quiet {
+			path, _ := trackLogPath()
+			fmt.Printf("No tracks logged yet (%s)\n", path)
+		}
+		return
+	}
+	printTrackLogTable(os.Stdout, entries, opts.Plain)
+}
+
+func printTrackLogTable(w io.Writer, entries []trackLogEntry, plain bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "TIME\tTRACK\tARTIST\tALBUM\tROOMS")
+	}
+	for _, e := range entries {
+		at := e.Time
+		if t, err := time.Parse(time.RFC3339, e.Time); err == nil {
+			at = t.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", at, e.Name, e.Artist, e.Album, strings.Join(e.Rooms, ", "))
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/homekit"
+)
+
+func cmdHomeKit(ctx context.Context, args []string) {
+	if len(args) < 1 || args[0] != "accessories" {
+		die(usageErrf("usage: homepodctl homekit accessories [--timeout <duration>] [--json] [--plain]"))
+	}
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl homekit accessories [--timeout <duration>] [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	timeout := 5 * time.Second
+	if raw := strings.TrimSpace(flags.string("timeout")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --timeout %q (expected duration like 5s)", raw))
+		}
+		timeout = d
+	}
+
+	accs, err := discoverHomeKit(context.WithoutCancel(ctx), timeout)
+	if err != nil {
+		die(err)
+	}
+	if jsonOut {
+		if accs == nil {
+			accs = []homekit.Accessory{}
+		}
+		writeJSON(accs)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "NAME\tCATEGORY\tMODEL\tPAIRED\tADDRESS")
+	}
+	for _, a := range accs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\n", a.Name, a.Category, dashIfEmpty(a.Model), a.Paired, a.Addr)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+const (
+	defaultHookTimeout = 10 * time.Second
+	// maxHookOutput caps the hook output kept in results and logs.
+	maxHookOutput = 4096
+	// hookWaitDelay bounds how long a hook's output is still read after
+	// the hook is killed, e.g. when it left a background child holding the
+	// pipe open.
+	hookWaitDelay = 2 * time.Second
+)
+
+// hookResult is one hook run as --json output and the log report it.
+type hookResult struct {
+	Name       string `json:"name"`
+	Command    string `json:"command"`
+	OK         bool   `json:"ok"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMS int64  `json:"durationMs"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// hookState is the hooks of the command being run; nil when the command is
+// read-only, a dry run, or config.json has no hooks.
+type hookState struct {
+	action  string
+	args    []string
+	hooks   map[string]string
+	timeout time.Duration
+	results []hookResult
+	postRan bool
+}
+
+var hookRun *hookState
+
+func execHookCommand(ctx context.Context, command string, env []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = hookWaitDelay
+	return cmd.CombinedOutput()
+}
+
+// hookAction is the action name hooks use for cmd: "vol" is "volume".
+func hookAction(cmd string) string {
+	if cmd == "vol" {
+		return "volume"
+	}
+	return cmd
+}
+
+// hookName is the config key of a hook, e.g. hookName("post", "native-run")
+// is "postNativeRun".
+func hookName(phase, action string) string {
+	var b strings.Builder
+	b.WriteString(phase)
+	for _, part := range strings.Split(action, "-") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// isHookName reports whether name is pre or post followed by a command that
+// runs hooks.
+func isHookName(name string) bool {
+	for _, action := range hookActions {
+		if name == hookName("pre", action) || name == hookName("post", action) {
+			return true
+		}
+	}
+	return false
+}
+
+// hookActions are the commands that run hooks: the ones history records.
+var hookActions = []string{
+	"play", "radio", "volume", "mixer", "mute", "unmute", "duck", "unduck", "announce", "move", "handoff", "run", "native-run",
+	"pause", "stop", "resume", "next", "prev", "love", "dislike", "rate", "shuffle", "crossfade",
+	"out", "audio", "media", "alias", "automation", "scene", "playlist", "undo",
+}
+
+// beginHooks arms hooks for cmd from cfg, which may be nil.
+func beginHooks(cfg *native.Config, cmd string, args []string) {
+	if !isHistoryCommand(cmd, args) || isDryRunInvocation(args) {
+		return
+	}
+	if cfg == nil || len(cfg.Hooks) == 0 {
+		return
+	}
+	timeout := defaultHookTimeout
+	if t := cfg.Defaults.Timeouts; t != nil && t.Hooks != "" {
+		if d, err := parseConfigTimeout(t.Hooks); err == nil {
+			timeout = d
+		}
+	}
+	hookRun = &hookState{action: hookAction(cmd), args: args, hooks: cfg.Hooks, timeout: timeout}
+}
+
+// runPreHook runs the pre<Action> hook. A failing pre hook stops the command
+// before it changes anything.
+func runPreHook() {
+	h := hookRun
+	if h == nil {
+		return
+	}
+	name := hookName("pre", h.action)
+	res, ran := h.run(name, nil)
+	if ran && !res.OK {
+		die(fmt.Errorf("hooks.%s failed: %s", name, res.Error))
+	}
+}
+
+// runPostHook runs the post<Action> hook once, after the command succeeded,
+// with result (what the command resolved) in its environment. A failing post
+// hook is reported but does not fail the command.
+func runPostHook(result any) {
+	h := hookRun
+	if h == nil || h.postRan {
+		return
+	}
+	h.postRan = true
+	env, ok := hookResultEnv(result)
+	if !ok {
+		return
+	}
+	name := hookName("post", h.action)
+	if res, ran := h.run(name, env); ran && !res.OK {
+		fmt.Fprintf(os.Stderr, "warning: hooks.%s failed: %s\n", name, res.Error)
+	}
+}
+
+// hookResultEnv describes a command's result to its post hook. It reports
+// false for results that say the command failed.
+func hookResultEnv(result any) ([]string, bool) {
+	if result == nil {
+		return nil, true
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return nil, true
+	}
+	var fields map[string]any
+	_ = json.Unmarshal(b, &fields)
+	if ok, isBool := fields["ok"].(bool); isBool && !ok {
+		return nil, false
+	}
+	env := []string{"HOMEPODCTL_RESULT=" + string(b)}
+	if rooms := anyStrings(fields["rooms"]); len(rooms) > 0 {
+		env = append(env, "HOMEPODCTL_ROOMS="+strings.Join(rooms, ","))
+	}
+	for _, f := range []struct{ key, name string }{
+		{"backend", "HOMEPODCTL_BACKEND"},
+		{"playlist", "HOMEPODCTL_PLAYLIST"},
+		{"playlistId", "HOMEPODCTL_PLAYLIST_ID"},
+	} {
+		if v, _ := fields[f.key].(string); v != "" {
+			env = append(env, f.name+"="+v)
+		}
+	}
+	return env, true
+}
+
+// hookResults returns the hooks the current command ran so far.
+func hookResults() []hookResult {
+	if hookRun == nil {
+		return nil
+	}
+	return hookRun.results
+}
+
+// run runs the named hook if config.json sets it, with the action context in
+// HOMEPODCTL_* environment variables.
+func (h *hookState) run(name string, env []string) (hookResult, bool) {
+	command := strings.TrimSpace(h.hooks[name])
+	if command == "" {
+		return hookResult{}, false
+	}
+	env = append([]string{
+		"HOMEPODCTL_HOOK=" + name,
+		"HOMEPODCTL_ACTION=" + h.action,
+		"HOMEPODCTL_ARGS=" + strings.Join(h.args, " "),
+	}, env...)
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	started := time.Now()
+	out, err := runHookCommand(ctx, command, env)
+	res := hookResult{Name: name, Command: command, OK: err == nil, DurationMS: time.Since(started).Milliseconds()}
+	res.Output = strings.TrimSpace(string(out))
+	if len(res.Output) > maxHookOutput {
+		res.Output = res.Output[:maxHookOutput] + "…"
+	}
+	if err != nil {
+		res.ExitCode = -1
+		var exitErr *exec.ExitError
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			res.Error = fmt.Sprintf("timed out after %s", h.timeout)
+		case errors.As(err, &exitErr):
+			res.ExitCode = exitErr.ExitCode()
+			res.Error = fmt.Sprintf("exit status %d", res.ExitCode)
+		default:
+			res.Error = err.Error()
+		}
+		if res.Output != "" {
+			res.Error += ": " + res.Output
+		}
+	}
+	h.results = append(h.results, res)
+	logger.Info("hook", "name", name, "ok", res.OK, "exit_code", res.ExitCode, "duration_ms", res.DurationMS, "output", res.Output)
+	return res, true
+}
@@ -2,79 +2,168 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
 
 func cmdDevices(ctx context.Context, args []string) {
-	fs := flag.NewFlagSet("devices", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
-	jsonOut := fs.Bool("json", false, "output JSON")
-	includeNetwork := fs.Bool("include-network", false, "include network address (MAC) in JSON output")
-	plain := fs.Bool("plain", false, "plain (no header) output")
-	if err := fs.Parse(args); err != nil {
-		exitCode(exitUsage)
-	}
+	cmdDeviceList(ctx, "devices", args)
+}
 
-	devs, err := music.ListAirPlayDevices(ctx)
+func cmdPlaylists(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
 	if err != nil {
 		die(err)
 	}
-	if *jsonOut {
-		if !*includeNetwork {
-			for i := range devs {
-				devs[i].NetworkAddress = ""
-			}
-		}
-		writeJSON(devs)
-		return
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl playlists [--query <substr>] [--folder <name>] [--smart-only|--no-smart] [--sort name|count|recent] [--limit N] [--refresh] [--json] [--plain]"))
 	}
-	printDevicesTable(os.Stdout, devs, *plain)
-}
-
-func cmdPlaylists(ctx context.Context, args []string) {
-	fs := flag.NewFlagSet("playlists", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
-	query := fs.String("query", "", "filter playlists by substring (case-insensitive)")
-	limit := fs.Int("limit", 50, "max playlists to return (0 = no limit)")
-	jsonOut := fs.Bool("json", false, "output JSON")
-	plain := fs.Bool("plain", false, "plain (no header) output")
-	if err := fs.Parse(args); err != nil {
-		exitCode(exitUsage)
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	limit := 50
+	if n, ok, err := flags.intStrict("limit"); err != nil {
+		die(err)
+	} else if ok {
+		limit = n
+	}
+	var filter playlistFilter
+	if filter.smartOnly, _, err = flags.boolStrict("smart-only"); err != nil {
+		die(err)
+	}
+	if filter.noSmart, _, err = flags.boolStrict("no-smart"); err != nil {
+		die(err)
+	}
+	if filter.smartOnly && filter.noSmart {
+		die(usageErrf("--smart-only and --no-smart are mutually exclusive"))
+	}
+	refresh, _, err := flags.boolStrict("refresh")
+	if err != nil {
+		die(err)
+	}
+	filter.folder = strings.TrimSpace(flags.string("folder"))
+	sortBy := strings.TrimSpace(flags.string("sort"))
+	switch sortBy {
+	case "", "name", "count", "recent":
+	default:
+		die(usageErrf("invalid --sort %q (expected name|count|recent)", sortBy))
 	}
 
-	playlists, err := music.ListUserPlaylists(ctx, *query, *limit)
+	if refresh {
+		if _, err := refreshPlaylistCache(ctx); err != nil {
+			die(err)
+		}
+	}
+	// Filter and sort the whole list before applying --limit.
+	playlists, err := listPlaylists(ctx, flags.string("query"), 0)
 	if err != nil {
 		die(err)
 	}
-	if *jsonOut {
-		writeJSON(playlists)
+	cachedAt, ok := playlistCachedAt()
+	if !ok {
+		cachedAt = time.Now().UTC()
+	}
+	reportCacheAge("playlists", cachedAt)
+	playlists = filter.apply(playlists)
+	if sortBy == "recent" {
+		// Dates need every track read, so only this sort pays for them.
+		if err := fillPlaylistModified(ctx, playlists); err != nil {
+			die(err)
+		}
+	}
+	sortPlaylists(playlists, sortBy)
+	if limit > 0 && len(playlists) > limit {
+		playlists = playlists[:limit]
+	}
+	if jsonOut {
+		listed := make([]listedPlaylist, 0, len(playlists))
+		for _, p := range playlists {
+			listed = append(listed, listedPlaylist{UserPlaylist: p, CachedAt: cachedAt})
+		}
+		writeJSON(listed)
 		return
 	}
-	if !*plain {
-		fmt.Println("PERSISTENT_ID\tNAME")
+	if !plain {
+		fmt.Println("PERSISTENT_ID\tNAME\tTRACKS\tTIME\tFOLDER")
 	}
 	for _, p := range playlists {
-		fmt.Printf("%s\t%s\n", p.PersistentID, p.Name)
+		fmt.Printf("%s\t%s\t%d\t%s\t%s\n", p.PersistentID, p.Name, p.TrackCount, formatClock(p.DurationS), p.Folder)
 	}
 }
 
+// listedPlaylist is a playlist in the playlists JSON listing; cachedAt is
+// when the list was read from Music.app.
+type listedPlaylist struct {
+	music.UserPlaylist
+	CachedAt time.Time `json:"cachedAt"`
+}
+
+// playlistFilter holds the playlists filters other than --query, which
+// music.ListUserPlaylists applies.
+type playlistFilter struct {
+	smartOnly bool
+	noSmart   bool
+	folder    string // parent folder name, case-insensitive
+}
+
+func (f playlistFilter) apply(playlists []music.UserPlaylist) []music.UserPlaylist {
+	var out []music.UserPlaylist
+	for _, p := range playlists {
+		if f.smartOnly && !p.Smart || f.noSmart && p.Smart {
+			continue
+		}
+		if f.folder != "" && !strings.EqualFold(p.Folder, f.folder) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// sortPlaylists orders playlists by name (A-Z), count (most tracks first), or
+// recent (latest track added first); "" keeps Music.app's order.
+func sortPlaylists(playlists []music.UserPlaylist, by string) {
+	var less func(a, b music.UserPlaylist) bool
+	switch by {
+	case "name":
+		less = func(a, b music.UserPlaylist) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "count":
+		less = func(a, b music.UserPlaylist) bool { return a.TrackCount > b.TrackCount }
+	case "recent":
+		less = func(a, b music.UserPlaylist) bool {
+			if a.Modified == nil || b.Modified == nil {
+				return a.Modified != nil
+			}
+			return a.Modified.After(*b.Modified)
+		}
+	default:
+		return
+	}
+	sort.SliceStable(playlists, func(i, j int) bool { return less(playlists[i], playlists[j]) })
+}
+
 func cmdAliases(cfg *native.Config, args []string) {
-	fs := flag.NewFlagSet("aliases", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
-	jsonOut := fs.Bool("json", false, "output JSON")
-	plain := fs.Bool("plain", false, "plain (no header) output")
-	if err := fs.Parse(args); err != nil {
-		exitCode(exitUsage)
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl aliases [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
 	}
 	rows := buildAliasRows(cfg)
 	if len(rows) == 0 {
-		if *jsonOut {
+		if jsonOut {
 			writeJSON([]aliasRow{})
 			return
 		}
@@ -88,11 +177,11 @@ func cmdAliases(cfg *native.Config, args []string) {
 		fmt.Println("No aliases configured in config.json")
 		return
 	}
-	if *jsonOut {
+	if jsonOut {
 		writeJSON(rows)
 		return
 	}
-	printAliasesTable(os.Stdout, rows, *plain)
+	printAliasesTable(os.Stdout, rows, plain)
 }
 
 func cmdRun(ctx context.Context, cfg *native.Config, args []string) {
@@ -107,6 +196,10 @@ func cmdRun(ctx context.Context, cfg *native.Config, args []string) {
 	if err != nil {
 		die(err)
 	}
+	force, _, err := flags.boolStrict("force")
+	if err != nil {
+		die(err)
+	}
 	aliasName := positionals[0]
 	a, ok := cfg.Aliases[aliasName]
 	if !ok {
@@ -118,6 +211,20 @@ func cmdRun(ctx context.Context, cfg *native.Config, args []string) {
 		}
 		die(usageErrf("unknown alias: %q (run `homepodctl aliases` or edit config.json)", aliasName))
 	}
+	if len(a.Sequence) > 0 {
+		cmdRunSequence(ctx, cfg, aliasName, opts, force)
+		return
+	}
+	out, err := runAlias(ctx, cfg, aliasName, a, opts.DryRun, force)
+	if err != nil {
+		die(err)
+	}
+	writeActionOutput("run", opts.JSON, opts.Plain, out)
+}
+
+// runAlias runs a single (non-sequence) alias and returns what it did. force
+// lets it play through blocking quiet hours and above maxVolume.
+func runAlias(ctx context.Context, cfg *native.Config, aliasName string, a native.Alias, dryRun, force bool) (actionOutput, error) {
 	backend := a.Backend
 	if backend == "" {
 		backend = cfg.Defaults.Backend
@@ -126,50 +233,72 @@ func cmdRun(ctx context.Context, cfg *native.Config, args []string) {
 	if len(rooms) == 0 {
 		rooms = cfg.Defaults.Rooms
 	}
+	rooms = cfg.ExpandRooms(rooms)
 	if a.Shortcut != "" {
-		if !opts.DryRun {
+		if !dryRun {
 			if err := native.RunShortcut(ctx, a.Shortcut); err != nil {
-				die(err)
+				return actionOutput{}, err
 			}
 		}
-		writeActionOutput("run", opts.JSON, opts.Plain, actionOutput{
-			DryRun:   opts.DryRun,
+		return actionOutput{
+			DryRun:   dryRun,
 			Backend:  backend,
 			Rooms:    rooms,
 			Shortcut: a.Shortcut,
-		})
-		return
+		}, nil
 	}
 	switch backend {
 	case "airplay":
 		if len(rooms) == 0 {
-			die(fmt.Errorf("alias %q requires rooms (set defaults.rooms or alias.rooms)", aliasName))
+			return actionOutput{}, fmt.Errorf("alias %q requires rooms (set defaults.rooms or alias.rooms)", aliasName)
 		}
-		if opts.DryRun {
-			writeActionOutput("run", opts.JSON, opts.Plain, actionOutput{
+		quietHours := activeQuietHours(cfg, rooms)
+		if a.PlaylistID != "" || a.Playlist != "" || a.Station != "" {
+			var err error
+			if quietHours, err = checkQuietPlay(cfg, rooms, force); err != nil {
+				return actionOutput{}, err
+			}
+		}
+		if dryRun {
+			return actionOutput{
 				DryRun:     true,
 				Backend:    backend,
 				Rooms:      rooms,
+				QuietHours: quietHours,
 				Playlist:   a.Playlist,
 				PlaylistID: a.PlaylistID,
-			})
-			return
+				Station:    a.Station,
+			}, nil
 		}
 		if err := setCurrentOutputs(ctx, rooms); err != nil {
-			die(err)
+			return actionOutput{}, err
 		}
 		if a.Volume != nil {
-			if err := setVolumeForRooms(ctx, rooms, *a.Volume); err != nil {
-				die(err)
+			if err := setVolumeForRooms(ctx, cfg, rooms, *a.Volume, force); err != nil {
+				return actionOutput{}, err
 			}
 		} else if cfg.Defaults.Volume != nil {
-			if err := setVolumeForRooms(ctx, rooms, *cfg.Defaults.Volume); err != nil {
-				die(err)
+			if err := setVolumeForRooms(ctx, cfg, rooms, *cfg.Defaults.Volume, force); err != nil {
+				return actionOutput{}, err
+			}
+		} else if a.PlaylistID != "" || a.Playlist != "" || a.Station != "" {
+			if err := lowerQuietVolumes(ctx, cfg, rooms, force); err != nil {
+				return actionOutput{}, err
+			}
+		}
+		if a.ShuffleMode != "" {
+			if err := setShuffleMode(ctx, a.ShuffleMode); err != nil {
+				return actionOutput{}, err
 			}
 		}
 		if a.Shuffle != nil {
 			if err := setShuffle(ctx, *a.Shuffle); err != nil {
-				die(err)
+				return actionOutput{}, err
+			}
+		}
+		if a.EQ != "" {
+			if _, err := setEQPreset(ctx, a.EQ); err != nil {
+				return actionOutput{}, err
 			}
 		}
 		if a.PlaylistID != "" || a.Playlist != "" {
@@ -177,112 +306,145 @@ func cmdRun(ctx context.Context, cfg *native.Config, args []string) {
 			if id == "" {
 				matches, err := searchPlaylists(ctx, a.Playlist)
 				if err != nil {
-					die(err)
+					return actionOutput{}, err
 				}
 				if len(matches) == 0 {
-					die(fmt.Errorf("alias %q playlist %q not found (tip: set playlistId to pin an exact playlist)", aliasName, a.Playlist))
+					return actionOutput{}, fmt.Errorf("alias %q playlist %q not found (tip: set playlistId to pin an exact playlist)", aliasName, a.Playlist)
 				}
 				best, _ := music.PickBestPlaylist(a.Playlist, matches)
 				id = best.PersistentID
 				if len(matches) > 1 {
-					fmt.Fprintf(os.Stderr, "picked %q (%s) for alias %q (set playlistId to pin)\n", best.Name, best.PersistentID, aliasName)
+					fmt.Fprintf(os.Stderr, "picked %q (%s) for alias %q (pin it: homepodctl config set aliases.%s.playlistId %s)\n", best.Name, best.PersistentID, aliasName, aliasName, best.PersistentID)
 				}
 			}
 			if err := playPlaylistByID(ctx, id); err != nil {
-				die(err)
+				return actionOutput{}, err
+			}
+		} else if a.Station != "" {
+			station, err := resolveStation(ctx, a.Station)
+			if err != nil {
+				return actionOutput{}, fmt.Errorf("alias %q: %w", aliasName, err)
+			}
+			if err := playStationByID(ctx, station.PersistentID); err != nil {
+				return actionOutput{}, err
 			}
 		}
-		np, err := getNowPlaying(ctx)
-		if err == nil {
-			writeActionOutput("run", opts.JSON, opts.Plain, actionOutput{
-				Backend:    backend,
-				Rooms:      rooms,
-				PlaylistID: a.PlaylistID,
-				NowPlaying: &np,
-			})
-		} else {
-			writeActionOutput("run", opts.JSON, opts.Plain, actionOutput{
-				Backend:    backend,
-				Rooms:      rooms,
-				PlaylistID: a.PlaylistID,
-			})
+		out := actionOutput{
+			Backend:    backend,
+			Rooms:      rooms,
+			QuietHours: quietHours,
+			PlaylistID: a.PlaylistID,
+			Station:    a.Station,
 		}
+		if np, err := getNowPlaying(ctx); err == nil {
+			out.NowPlaying = &np
+		}
+		return out, nil
 	case "native":
+		if a.Station != "" {
+			return actionOutput{}, fmt.Errorf("alias %q: station needs backend=airplay", aliasName)
+		}
 		if len(rooms) == 0 {
-			die(fmt.Errorf("alias %q requires rooms (set defaults.rooms or alias.rooms)", aliasName))
+			return actionOutput{}, fmt.Errorf("alias %q requires rooms (set defaults.rooms or alias.rooms)", aliasName)
 		}
 		if a.Playlist == "" && a.PlaylistID == "" {
-			die(fmt.Errorf("alias %q requires playlist (native mapping is per room+playlist)", aliasName))
+			return actionOutput{}, fmt.Errorf("alias %q requires playlist (native mapping is per room+playlist)", aliasName)
+		}
+		quietHours, err := checkQuietPlay(cfg, rooms, force)
+		if err != nil {
+			return actionOutput{}, err
 		}
 		name := a.Playlist
-		if opts.DryRun {
+		if dryRun {
 			if name == "" {
 				name = a.PlaylistID
 			}
-			writeActionOutput("run", opts.JSON, opts.Plain, actionOutput{
-				DryRun:   true,
-				Backend:  backend,
-				Rooms:    rooms,
-				Playlist: name,
-			})
-			return
+			return actionOutput{
+				DryRun:     true,
+				Backend:    backend,
+				Rooms:      rooms,
+				QuietHours: quietHours,
+				Playlist:   name,
+			}, nil
 		}
 		if name == "" {
 			name, err = findPlaylistNameByID(ctx, a.PlaylistID)
 			if err != nil {
-				die(err)
+				return actionOutput{}, err
 			}
 		}
 		if err := runNativePlaylistShortcuts(ctx, cfg, rooms, name); err != nil {
-			die(fmt.Errorf("%w (edit config)", err))
+			return actionOutput{}, fmt.Errorf("%w (edit config)", err)
 		}
-		writeActionOutput("run", opts.JSON, opts.Plain, actionOutput{
-			DryRun:   opts.DryRun,
-			Backend:  backend,
-			Rooms:    rooms,
-			Playlist: name,
-		})
+		return actionOutput{
+			Backend:    backend,
+			Rooms:      rooms,
+			QuietHours: quietHours,
+			Playlist:   name,
+		}, nil
 	default:
-		die(fmt.Errorf("unknown backend in alias %q: %q", aliasName, backend))
+		return actionOutput{}, fmt.Errorf("unknown backend in alias %q: %q", aliasName, backend)
 	}
 }
 
 func cmdNativeRun(ctx context.Context, args []string) {
-	fs := flag.NewFlagSet("native-run", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
-	shortcutName := fs.String("shortcut", "", "Shortcut name to run")
-	jsonOut := fs.Bool("json", false, "output JSON")
-	dryRun := fs.Bool("dry-run", false, "resolve and print action without running")
-	if err := fs.Parse(args); err != nil {
-		exitCode(exitUsage)
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl native-run --shortcut <name> [--input <text>] [--json] [--dry-run]"))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
 	}
+	shortcutName := flags.string("shortcut")
+	input := flags.string("input")
 
-	if strings.TrimSpace(*shortcutName) == "" {
+	if strings.TrimSpace(shortcutName) == "" {
 		die(usageErrf("--shortcut is required"))
 	}
-	if !*dryRun {
-		if err := runNativeShortcut(ctx, *shortcutName); err != nil {
+	output := ""
+	if !opts.DryRun {
+		if output, err = runNativeShortcutWithInput(ctx, shortcutName, input); err != nil {
 			die(err)
 		}
 	}
-	if *jsonOut {
-		writeJSON(actionResult{
-			OK:       true,
-			Action:   "native-run",
-			DryRun:   *dryRun,
-			Shortcut: *shortcutName,
-		})
-	} else if *dryRun && !quiet {
-		fmt.Printf("dry-run action=native-run shortcut=%q\n", *shortcutName)
+	res := actionResult{
+		OK:       true,
+		Action:   "native-run",
+		DryRun:   opts.DryRun,
+		Shortcut: shortcutName,
+		Output:   output,
+	}
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+	} else if opts.DryRun && !quiet {
+		fmt.Printf("dry-run action=native-run shortcut=%q input=%q\n", shortcutName, input)
+	} else if output != "" {
+		fmt.Println(output)
 	}
 }
 
 func cmdConfigInit() {
+	if dryRunAll {
+		path, err := configPath()
+		if err != nil {
+			die(err)
+		}
+		if !quiet {
+			fmt.Printf("dry-run: would write %s\n", path)
+		}
+		return
+	}
 	path, err := native.InitConfig()
 	if err != nil {
 		die(err)
 	}
 	if !quiet {
 		fmt.Printf("Wrote %s\n", path)
+		fmt.Println("tip: run `homepodctl config wizard` to pick rooms and aliases interactively")
 	}
 }
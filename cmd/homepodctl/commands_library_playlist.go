@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type playlistEditResult struct {
+	OK         bool     `json:"ok"`
+	Action     string   `json:"action"`
+	DryRun     bool     `json:"dryRun,omitempty"`
+	Playlist   string   `json:"playlist,omitempty"`
+	PlaylistID string   `json:"playlistId,omitempty"`
+	TrackIDs   []string `json:"trackIds,omitempty"`
+	Removed    *int     `json:"removed,omitempty"`
+}
+
+func cmdPlaylist(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		die(usageErrf("usage: homepodctl playlist <create|add|remove-track> [args]"))
+	}
+	sub := args[0]
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+
+	switch sub {
+	case "create":
+		name := strings.TrimSpace(strings.Join(positionals, " "))
+		if name == "" {
+			name = strings.TrimSpace(flags.string("name"))
+		}
+		if name == "" {
+			die(usageErrf("usage: homepodctl playlist create <name> [--json] [--plain] [--dry-run]"))
+		}
+		res := playlistEditResult{OK: true, Action: "playlist.create", DryRun: opts.DryRun, Playlist: name}
+		if !opts.DryRun {
+			p, err := createPlaylist(ctx, name)
+			if err != nil {
+				die(err)
+			}
+			res.PlaylistID = p.PersistentID
+		}
+		writePlaylistEditResult(res, opts)
+	case "add", "remove-track":
+		trackIDs := trimmedNonEmpty(flags.strings("track-id"))
+		if len(trackIDs) == 0 {
+			die(usageErrf("usage: homepodctl playlist %s <playlist> | --playlist-id <id> --track-id <id> [--track-id <id> ...]", sub))
+		}
+		name, id := resolvePlaylistTarget(ctx, flags, positionals)
+		res := playlistEditResult{OK: true, Action: "playlist." + sub, DryRun: opts.DryRun, Playlist: name, PlaylistID: id, TrackIDs: trackIDs}
+		debugf("playlist %s: playlist=%q id=%s tracks=%v", sub, name, id, trackIDs)
+		if opts.DryRun {
+			writePlaylistEditResult(res, opts)
+			return
+		}
+		if sub == "add" {
+			for _, trackID := range trackIDs {
+				if err := addTrackToPlaylist(ctx, id, trackID); err != nil {
+					die(err)
+				}
+			}
+		} else {
+			removed := 0
+			for _, trackID := range trackIDs {
+				n, err := removeTrackFromPlaylist(ctx, id, trackID)
+				if err != nil {
+					die(err)
+				}
+				removed += n
+			}
+			res.Removed = &removed
+		}
+		writePlaylistEditResult(res, opts)
+	default:
+		die(usageErrf("usage: homepodctl playlist <create|add|remove-track> [args]"))
+	}
+}
+
+// resolvePlaylistTarget returns the playlist name and persistent ID for edit
+// commands. Names must match a single playlist; editing never guesses.
+func resolvePlaylistTarget(ctx context.Context, flags parsedArgs, positionals []string) (string, string) {
+	id := strings.TrimSpace(flags.string("playlist-id"))
+	name := strings.TrimSpace(flags.string("playlist"))
+	if name == "" {
+		name = strings.TrimSpace(strings.Join(positionals, " "))
+	}
+	if id != "" {
+		if name == "" {
+			resolved, err := findPlaylistNameByID(ctx, id)
+			if err != nil {
+				die(err)
+			}
+			name = resolved
+		}
+		return name, id
+	}
+	if name == "" {
+		die(usageErrf("playlist is required (pass <playlist>, --playlist, or --playlist-id)"))
+	}
+	id, err := findPlaylistIDByName(ctx, name)
+	if err != nil {
+		die(err)
+	}
+	return name, id
+}
+
+func writePlaylistEditResult(res playlistEditResult, opts outputOptions) {
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	if opts.Plain {
+		fmt.Printf("%s\t%s\t%s\t%s\n", res.Action, res.PlaylistID, res.Playlist, strings.Join(res.TrackIDs, ","))
+		return
+	}
+	if res.DryRun {
+		switch res.Action {
+		case "playlist.create":
+			fmt.Printf("dry-run: would create playlist %q\n", res.Playlist)
+		case "playlist.add":
+			fmt.Printf("dry-run: would add %d track(s) to %q (%s)\n", len(res.TrackIDs), res.Playlist, res.PlaylistID)
+		case "playlist.remove-track":
+			fmt.Printf("dry-run: would remove %d track(s) from %q (%s)\n", len(res.TrackIDs), res.Playlist, res.PlaylistID)
+		}
+		return
+	}
+	switch res.Action {
+	case "playlist.create":
+		fmt.Printf("Created playlist %q (%s)\n", res.Playlist, res.PlaylistID)
+	case "playlist.add":
+		fmt.Printf("Added %d track(s) to %q (%s)\n", len(res.TrackIDs), res.Playlist, res.PlaylistID)
+	case "playlist.remove-track":
+		removed := 0
+		if res.Removed != nil {
+			removed = *res.Removed
+		}
+		fmt.Printf("Removed %d track(s) from %q (%s)\n", removed, res.Playlist, res.PlaylistID)
+	}
+}
+
+func trimmedNonEmpty(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+func cmdSearch(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	query := strings.TrimSpace(strings.Join(positionals, " "))
+	if query == "" {
+		query = strings.TrimSpace(flags.string("query"))
+	}
+	if query == "" {
+		die(usageErrf("usage: homepodctl search <query> [--type track|album|artist] [--limit N] [--json] [--plain]"))
+	}
+	kind := strings.ToLower(strings.TrimSpace(flags.string("type")))
+	if kind == "" {
+		kind = "track"
+	}
+	switch kind {
+	case "track", "album", "artist":
+	default:
+		die(usageErrf("invalid --type %q (expected track|album|artist)", kind))
+	}
+	limit := 25
+	if v, ok, err := flags.intStrict("limit"); err != nil {
+		die(err)
+	} else if ok {
+		if v < 0 {
+			die(usageErrf("--limit must be >= 0"))
+		}
+		limit = v
+	}
+
+	items, err := searchLibrary(ctx, query, kind, limit)
+	if err != nil {
+		die(err)
+	}
+	if jsonOut {
+		if items == nil {
+			items = []music.LibraryItem{}
+		}
+		writeJSON(items)
+		return
+	}
+	printSearchTable(os.Stdout, kind, items, plain)
+}
+
+func printSearchTable(w io.Writer, kind string, items []music.LibraryItem, plain bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	switch kind {
+	case "track":
+		if !plain {
+			fmt.Fprintln(tw, "PERSISTENT_ID\tNAME\tARTIST\tALBUM\tDURATION")
+		}
+		for _, it := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", it.PersistentID, it.Name, it.Artist, it.Album, formatClock(it.DurationS))
+		}
+	case "album":
+		if !plain {
+			fmt.Fprintln(tw, "ALBUM\tARTIST\tTRACKS\tTRACK_IDS")
+		}
+		for _, it := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", it.Name, it.Artist, len(it.TrackIDs), strings.Join(it.TrackIDs, ","))
+		}
+	default:
+		if !plain {
+			fmt.Fprintln(tw, "ARTIST\tTRACKS\tTRACK_IDS")
+		}
+		for _, it := range items {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", it.Name, len(it.TrackIDs), strings.Join(it.TrackIDs, ","))
+		}
+	}
+	_ = tw.Flush()
+}
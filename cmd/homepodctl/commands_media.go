@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/agisilaos/homepodctl/internal/mediakeys"
+)
+
+type mediaResult struct {
+	OK        bool   `json:"ok"`
+	Action    string `json:"action"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+	Key       string `json:"key"` // playpause|next|prev
+	Frontmost string `json:"frontmost,omitempty"`
+	Via       string `json:"via"` // app|media-key
+}
+
+// cmdMedia is media playpause|next|prev: transport for whichever app is
+// playing, not just Music.app.
+func cmdMedia(ctx context.Context, args []string) {
+	const usage = "usage: homepodctl media playpause|next|prev [--json] [--plain] [--dry-run]"
+	if len(args) == 0 {
+		die(usageErrf(usage))
+	}
+	key := args[0]
+	switch key {
+	case mediakeys.PlayPause, mediakeys.Next, mediakeys.Previous:
+	default:
+		die(usageErrf(usage))
+	}
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf(usage))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	route, err := resolveMediaRoute(ctx, key)
+	if err != nil {
+		die(err)
+	}
+	debugf("media: key=%s frontmost=%q via=%s", key, route.Frontmost, route.Via)
+	if !opts.DryRun {
+		if err := sendMediaRoute(ctx, route); err != nil {
+			die(err)
+		}
+	}
+	res := mediaResult{OK: true, Action: "media", DryRun: opts.DryRun, Key: key, Frontmost: route.Frontmost, Via: route.Via}
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	if opts.Plain {
+		fmt.Printf("%s\t%s\t%s\n", res.Key, res.Frontmost, res.Via)
+		return
+	}
+	prefix := "media " + key
+	if opts.DryRun {
+		prefix = "dry-run: would send media " + key
+	}
+	if route.Via == mediakeys.ViaApp {
+		fmt.Printf("%s: %s\n", prefix, route.Frontmost)
+		return
+	}
+	fmt.Printf("%s: media key (frontmost %s)\n", prefix, route.Frontmost)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMetricsAddr = "127.0.0.1:9811"
+	metricsUsage       = "usage: homepodctl metrics serve [--listen <host:port>] [--token <token>]"
+)
+
+func cmdMetrics(args []string) {
+	if len(args) < 1 || args[0] != "serve" {
+		die(usageErrf(metricsUsage))
+	}
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf(metricsUsage))
+	}
+	addr := strings.TrimSpace(flags.string("listen"))
+	if addr == "" {
+		addr = defaultMetricsAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		die(usageErrf("invalid --listen %q (expected host:port or :port)", addr))
+	}
+	// Loopback scrapes need no token, as before. Anywhere else the metrics
+	// (rooms, volumes, player state) are only served with one.
+	var auth *serveAuth
+	token := strings.TrimSpace(flags.string("token"))
+	if token == "" {
+		token = strings.TrimSpace(os.Getenv("HOMEPODCTL_METRICS_TOKEN"))
+	}
+	if token != "" {
+		auth = &serveAuth{token: token, loopbackOnly: isLoopbackHost(host)}
+	} else if !isLoopbackHost(host) {
+		die(usageErrf("--listen %s is reachable from the network; pass --token <token> (or set HOMEPODCTL_METRICS_TOKEN) and give Prometheus the same bearer token", addr))
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		die(err)
+	}
+	if !quiet {
+		fmt.Printf("metrics: serving http://%s/metrics\n", ln.Addr())
+	}
+	srv := &http.Server{Handler: newMetricsHandler(auth), ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.Serve(ln); err != nil {
+		die(err)
+	}
+}
+
+// newMetricsHandler serves Prometheus text-format metrics. Every scrape reads
+// Music.app afresh. When auth is not nil, /metrics requires its bearer token;
+// see serveAuth.
+func newMetricsHandler(auth *serveAuth) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		if auth != nil {
+			if err := auth.check(r); err != nil {
+				status := auth.status(err)
+				if status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="homepodctl"`)
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		defer cancel()
+		debugf("metrics: scrape from %s", r.RemoteAddr)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(collectMetrics(ctx))
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "homepodctl metrics exporter: see /metrics")
+	})
+	return mux
+}
+
+// collectMetrics renders one scrape. Music.app failures are reported through
+// homepodctl_up rather than an HTTP error, so Prometheus keeps the counters.
+func collectMetrics(ctx context.Context) []byte {
+	var b metricsWriter
+	start := time.Now()
+
+	np, npErr := getNowPlaying(ctx)
+	devs, devErr := listAirPlayDevices(ctx)
+	up := 1
+	if npErr != nil || devErr != nil {
+		up = 0
+		debugf("metrics: now playing err=%v devices err=%v", npErr, devErr)
+	}
+	b.help("homepodctl_up", "gauge", "Whether Music.app answered the last scrape.")
+	b.sample("homepodctl_up", nil, float64(up))
+
+	if npErr == nil {
+		b.help("homepodctl_player_state", "gauge", "Music.app player state; 1 for the current state.")
+		for _, state := range []string{"playing", "paused", "stopped"} {
+			b.sample("homepodctl_player_state", []string{"state", state}, boolMetric(np.PlayerState == state))
+		}
+		b.help("homepodctl_track_position_seconds", "gauge", "Playback position in the current track.")
+		b.sample("homepodctl_track_position_seconds", nil, np.PlayerPositionS)
+		b.help("homepodctl_track_duration_seconds", "gauge", "Duration of the current track.")
+		b.sample("homepodctl_track_duration_seconds", nil, np.Track.DurationS)
+	}
+	if devErr == nil {
+		b.help("homepodctl_device_volume_percent", "gauge", "AirPlay device volume, 0-100.")
+		for _, d := range devs {
+			b.sample("homepodctl_device_volume_percent", []string{"room", d.Name, "kind", d.Kind}, float64(d.Volume))
+		}
+		selected := 0
+		b.help("homepodctl_device_selected", "gauge", "Whether the AirPlay device is a current output.")
+		for _, d := range devs {
+			b.sample("homepodctl_device_selected", []string{"room", d.Name}, boolMetric(d.Selected))
+			if d.Selected {
+				selected++
+			}
+		}
+		b.help("homepodctl_device_available", "gauge", "Whether the AirPlay device is reachable.")
+		for _, d := range devs {
+			b.sample("homepodctl_device_available", []string{"room", d.Name}, boolMetric(d.Available))
+		}
+		b.help("homepodctl_selected_outputs", "gauge", "Number of selected AirPlay outputs.")
+		b.sample("homepodctl_selected_outputs", nil, float64(selected))
+	}
+
+	if counts, err := historyCommandCounts(); err != nil {
+		debugf("metrics: history: %v", err)
+	} else {
+		writeHistoryCommands(&b, counts)
+	}
+
+	b.help("homepodctl_scrape_duration_seconds", "gauge", "Time taken to collect these metrics.")
+	b.sample("homepodctl_scrape_duration_seconds", nil, time.Since(start).Seconds())
+	return b.Bytes()
+}
+
+type historyCountKey struct{ command, result string }
+
+// historyCounts caches the command counts of history.jsonl as of its size
+// and mtime, so scrapes only re-read the file after another process wrote it.
+type historyCounts struct {
+	path    string
+	size    int64
+	modTime time.Time
+	counts  map[historyCountKey]int
+}
+
+var (
+	historyCountsMu sync.Mutex
+	historyCountsAt historyCounts
+)
+
+// historyCommandCounts counts the commands history.jsonl currently holds by
+// command and result.
+func historyCommandCounts() (map[historyCountKey]int, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	historyCountsMu.Lock()
+	defer historyCountsMu.Unlock()
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return map[historyCountKey]int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := historyCountsAt
+	if c.counts != nil && c.path == path && c.size == fi.Size() && c.modTime.Equal(fi.ModTime()) {
+		return c.counts, nil
+	}
+	entries, err := readHistory(0)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[historyCountKey]int{}
+	for _, e := range entries {
+		result := "success"
+		if !e.OK {
+			result = "failure"
+		}
+		counts[historyCountKey{e.Command, result}]++
+	}
+	historyCountsAt = historyCounts{path: path, size: fi.Size(), modTime: fi.ModTime(), counts: counts}
+	return counts, nil
+}
+
+// writeHistoryCommands writes the history counts as gauges: they drop when
+// history is trimmed or cleared, so they are not Prometheus counters.
+func writeHistoryCommands(b *metricsWriter, counts map[historyCountKey]int) {
+	keys := make([]historyCountKey, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].command != keys[j].command {
+			return keys[i].command < keys[j].command
+		}
+		return keys[i].result < keys[j].result
+	})
+	b.help("homepodctl_history_commands", "gauge", "Mutating commands in the retained history, by result.")
+	for _, k := range keys {
+		b.sample("homepodctl_history_commands", []string{"command", k.command, "result", k.result}, float64(counts[k]))
+	}
+}
+
+// metricsWriter builds the Prometheus text exposition format.
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+func (b *metricsWriter) help(name, kind, text string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, text, name, kind)
+}
+
+// sample writes one sample; labels are name/value pairs.
+func (b *metricsWriter) sample(name string, labels []string, v float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(b, " %g\n", v)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func boolMetric(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	origNowPlaying := getNowPlaying
+	origList := listAirPlayDevices
+	origPath := historyPath
+	t.Cleanup(func() {
+		getNowPlaying = origNowPlaying
+		listAirPlayDevices = origList
+		historyPath = origPath
+	})
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	historyPath = func() (string, error) { return path, nil }
+	for _, e := range []historyEntry{
+		{Command: "play", OK: true},
+		{Command: "play", OK: true},
+		{Command: "volume", OK: false, ExitCode: 4},
+	} {
+		if err := appendHistory(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{
+			PlayerState:     "playing",
+			PlayerPositionS: 42.5,
+			PlaylistName:    "Chill",
+			Track:           music.NowPlayingTrack{Name: `Say "Hi"`, Artist: "Band", DurationS: 200},
+		}, nil
+	}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Kitchen", Kind: "HomePod", Available: true, Selected: true, Volume: 30},
+			{Name: "Bedroom", Kind: "HomePod", Available: false, Volume: 15},
+		}, nil
+	}
+
+	srv := httptest.NewServer(newMetricsHandler(nil))
+	defer srv.Close()
+	scrape := func() string {
+		t.Helper()
+		resp, err := srv.Client().Get(srv.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Fatalf("content-type=%q", ct)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	body := scrape()
+	for _, want := range []string{
+		"homepodctl_up 1\n",
+		`homepodctl_player_state{state="playing"} 1` + "\n",
+		`homepodctl_player_state{state="paused"} 0` + "\n",
+		"homepodctl_track_position_seconds 42.5\n",
+		`homepodctl_device_volume_percent{room="Kitchen",kind="HomePod"} 30` + "\n",
+		`homepodctl_device_selected{room="Bedroom"} 0` + "\n",
+		`homepodctl_device_available{room="Bedroom"} 0` + "\n",
+		"homepodctl_selected_outputs 1\n",
+		"# TYPE homepodctl_history_commands gauge\n",
+		`homepodctl_history_commands{command="play",result="success"} 2` + "\n",
+		`homepodctl_history_commands{command="volume",result="failure"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Say") || strings.Contains(body, "Chill") {
+		t.Fatalf("track and playlist names should not be labels:\n%s", body)
+	}
+
+	// Counts follow the file, so they drop after history is cleared.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendHistory(historyEntry{Command: "next", OK: true}); err != nil {
+		t.Fatal(err)
+	}
+	body = scrape()
+	if strings.Contains(body, `command="play"`) || !strings.Contains(body, `homepodctl_history_commands{command="next",result="success"} 1`) {
+		t.Fatalf("history counts after clear:\n%s", body)
+	}
+
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{}, errors.New("connection is invalid")
+	}
+	body = scrape()
+	if !strings.Contains(body, "homepodctl_up 0\n") || strings.Contains(body, "homepodctl_player_state") ||
+		!strings.Contains(body, `homepodctl_history_commands{command="next",result="success"} 1`) {
+		t.Fatalf("unexpected metrics while Music.app is down:\n%s", body)
+	}
+}
+
+func TestMetricsHandlerToken(t *testing.T) {
+	origNowPlaying := getNowPlaying
+	origList := listAirPlayDevices
+	origPath := historyPath
+	t.Cleanup(func() {
+		getNowPlaying = origNowPlaying
+		listAirPlayDevices = origList
+		historyPath = origPath
+	})
+	historyPath = func() (string, error) { return filepath.Join(t.TempDir(), "history.jsonl"), nil }
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) { return music.NowPlaying{}, nil }
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) { return nil, nil }
+
+	h := newMetricsHandler(&serveAuth{token: "secret"})
+	for _, tc := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "http://192.168.1.5:9811/metrics", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("auth %q: status=%d want %d", tc.auth, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestMetricsServeRefusesNetworkWithoutToken(t *testing.T) {
+	t.Setenv("HOMEPODCTL_METRICS_TOKEN", "")
+	_, recovered := captureStdoutAndRecover(t, func() { cmdMetrics([]string{"serve", "--listen", ":0"}) })
+	if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage || !strings.Contains(fatal.err.Error(), "--token") {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+}
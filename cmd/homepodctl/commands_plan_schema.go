@@ -1,12 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
@@ -38,7 +35,7 @@ func cmdSchema(args []string) {
 		die(err)
 	}
 	if len(pos) > 1 {
-		die(usageErrf("usage: homepodctl schema [<name>] [--json]"))
+		die(usageErrf("usage: homepodctl schema [<name>] [--json] [--write-dir <dir>]"))
 	}
 
 	names := make([]string, 0, len(cliSchemas))
@@ -47,6 +44,26 @@ func cmdSchema(args []string) {
 	}
 	sort.Strings(names)
 
+	if dir := strings.TrimSpace(flags.string("write-dir")); dir != "" {
+		if len(pos) == 1 {
+			name := strings.TrimSpace(pos[0])
+			if _, ok := cliSchemas[name]; !ok {
+				die(usageErrf("unknown schema %q", name))
+			}
+			names = []string{name}
+		}
+		res, err := writeSchemaFiles(expandHomePath(dir), names, isDryRunInvocation(args))
+		if err != nil {
+			die(err)
+		}
+		if jsonOut {
+			writeJSON(res)
+			return
+		}
+		printSchemaWriteResult(res)
+		return
+	}
+
 	if len(pos) == 0 {
 		if jsonOut {
 			writeJSON(schemaIndex{Schemas: names})
@@ -72,20 +89,49 @@ func cmdSchema(args []string) {
 	writeJSON(schema)
 }
 
-func cmdPlan(args []string) {
+const planUsage = "usage: homepodctl plan <command> [args] [--json] (run `homepodctl help plan` for the commands it accepts)"
+
+// planTargets lists the commands plan accepts and, for commands with
+// subcommands, which ones. Each prints one JSON object with --dry-run --json.
+var planTargets = map[string][]string{
+	"play": nil, "radio": nil, "run": nil, "volume": nil, "vol": nil, "mixer": nil, "mute": nil, "unmute": nil, "duck": nil, "unduck": nil, "announce": nil,
+	"move": nil, "handoff": nil, "native-run": nil, "undo": nil,
+	"pause": nil, "stop": nil, "resume": nil, "next": nil, "prev": nil, "love": nil, "dislike": nil, "rate": nil,
+	"shuffle": nil, "crossfade": nil,
+	"eq":         {"set"},
+	"audio":      {"route"},
+	"media":      {"playpause", "next", "prev"},
+	"out":        {"set", "add", "remove"},
+	"alias":      {"add", "remove", "rename", "copy"},
+	"automation": {"run", "validate", "plan"},
+	"scene":      {"run"},
+	"playlist":   {"create", "add", "remove-track"},
+	"cache":      {"refresh", "clear"},
+}
+
+func planTargetNames() []string {
+	names := make([]string, 0, len(planTargets))
+	for name := range planTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cmdPlan(env *commandEnv, args []string) {
 	jsonOut, pos, err := parsePlanArgs(args)
 	if err != nil {
 		die(err)
 	}
 	if len(pos) < 1 {
-		die(usageErrf("usage: homepodctl plan <run|play|volume|vol|native-run|out set|automation run> [args] [--json]"))
+		die(usageErrf("%s", planUsage))
 	}
 
 	targetCmd, targetArgs, err := normalizePlanTarget(pos[0], pos[1:])
 	if err != nil {
 		die(err)
 	}
-	payload, err := runPlanTarget(targetCmd, targetArgs)
+	payload, err := runPlanTarget(env, targetCmd, targetArgs)
 	if err != nil {
 		die(err)
 	}
@@ -108,7 +154,7 @@ func parsePlanArgs(args []string) (bool, []string, error) {
 			break
 		}
 		if a == "-h" || a == "--help" {
-			return false, nil, usageErrf("usage: homepodctl plan <run|play|volume|vol|native-run|out set|automation run> [args] [--json]")
+			return false, nil, usageErrf("%s", planUsage)
 		}
 		if a == "--json" {
 			jsonOut = true
@@ -129,40 +175,23 @@ func parsePlanArgs(args []string) (bool, []string, error) {
 }
 
 func normalizePlanTarget(cmd string, args []string) (string, []string, error) {
+	subs, ok := planTargets[cmd]
+	if !ok {
+		return "", nil, usageErrf("plan only supports commands with side effects; %q is not one (run `homepodctl help plan`)", cmd)
+	}
 	targetArgs := append([]string(nil), args...)
-	addDryRun := func() {
-		if !hasLongFlag(targetArgs, "dry-run") {
-			targetArgs = append(targetArgs, "--dry-run")
+	if subs != nil {
+		if len(targetArgs) == 0 || !containsString(subs, strings.TrimSpace(targetArgs[0])) {
+			return "", nil, usageErrf("plan only supports `%s %s`", cmd, strings.Join(subs, "|"))
 		}
 	}
-	addJSON := func() {
-		if !hasLongFlag(targetArgs, "json") {
-			targetArgs = append(targetArgs, "--json")
-		}
+	if !hasLongFlag(targetArgs, "dry-run") {
+		targetArgs = append(targetArgs, "--dry-run")
 	}
-
-	switch cmd {
-	case "run", "play", "volume", "vol", "native-run":
-		addDryRun()
-		addJSON()
-		return cmd, targetArgs, nil
-	case "out":
-		if len(targetArgs) == 0 || strings.TrimSpace(targetArgs[0]) != "set" {
-			return "", nil, usageErrf("plan only supports `out set` (usage: homepodctl plan out set --room <name> ...)")
-		}
-		addDryRun()
-		addJSON()
-		return cmd, targetArgs, nil
-	case "automation":
-		if len(targetArgs) == 0 || strings.TrimSpace(targetArgs[0]) != "run" {
-			return "", nil, usageErrf("plan only supports `automation run` (usage: homepodctl plan automation run -f <file>)")
-		}
-		addDryRun()
-		addJSON()
-		return cmd, targetArgs, nil
-	default:
-		return "", nil, usageErrf("plan only supports run, play, volume, vol, native-run, out set, and automation run")
+	if !hasLongFlag(targetArgs, "json") {
+		targetArgs = append(targetArgs, "--json")
 	}
+	return cmd, targetArgs, nil
 }
 
 func hasLongFlag(args []string, name string) bool {
@@ -175,38 +204,82 @@ func hasLongFlag(args []string, name string) bool {
 	return false
 }
 
-func runPlanTarget(cmd string, args []string) (map[string]any, error) {
-	childArgs := append([]string{cmd}, args...)
-	child := exec.Command(os.Args[0], childArgs...)
-	child.Env = os.Environ()
+// planCapture receives the result the planned command records with
+// recordResult; nil unless plan is running a target.
+var planCapture *planResult
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	child.Stdout = &stdout
-	child.Stderr = &stderr
+type planResult struct {
+	result any
+	ok     bool
+}
 
-	if err := child.Run(); err != nil {
-		msg := strings.TrimSpace(stderr.String())
-		if msg == "" {
-			msg = strings.TrimSpace(stdout.String())
-		}
-		if msg == "" {
-			msg = err.Error()
-		}
-		return nil, fmt.Errorf("plan target failed: %s", msg)
+// runPlanTarget runs the target command in this process as a dry run and
+// returns the result it resolved, the same value its --json output and the
+// history entry carry. Nothing the target prints reaches stdout; its usage
+// and exit class carry through, so `plan play` fails exactly as
+// `play --dry-run` would.
+func runPlanTarget(env *commandEnv, cmd string, args []string) (map[string]any, error) {
+	command, ok := lookupCliCommand(cmd)
+	if !ok {
+		return nil, usageErrf("unknown command: %q", cmd)
+	}
+	if err := checkCommandFlags(cmd, args); err != nil {
+		return nil, err
 	}
+	prevDryRun := dryRunAll
+	dryRunAll = true
+	defer func() { dryRunAll = prevDryRun }()
+	capture := &planResult{}
+	planCapture = capture
+	defer func() { planCapture = nil }()
 
-	out := bytes.TrimSpace(stdout.Bytes())
-	if len(out) == 0 {
-		return nil, errors.New("plan target returned empty output")
+	if err := runPlanSilently(func() {
+		command.Run(&commandEnv{ctx: env.ctx, name: cmd, cfg: env.cfg}, args)
+	}); err != nil {
+		return nil, err
+	}
+	if !capture.ok {
+		return nil, fmt.Errorf("%s did not resolve a plan", cmd)
+	}
+	b, err := json.Marshal(capture.result)
+	if err != nil {
+		return nil, fmt.Errorf("encode plan: %w", err)
 	}
 	var payload map[string]any
-	if err := json.Unmarshal(out, &payload); err != nil {
-		return nil, fmt.Errorf("plan target did not return valid JSON: %w", err)
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return nil, fmt.Errorf("encode plan: %w", err)
 	}
 	return payload, nil
 }
 
+// runPlanSilently runs fn with stdout discarded and turns the command's
+// die/exit panics back into errors.
+func runPlanSilently(fn func()) (err error) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		_ = devNull.Close()
+		switch v := recover().(type) {
+		case nil:
+		case cliFatal:
+			err = v.err
+		case cliExit:
+			if v.code != 0 {
+				err = fmt.Errorf("plan target exited with code %d", v.code)
+			}
+		default:
+			panic(v)
+		}
+	}()
+	fn()
+	return nil
+}
+
 func printPlanResponse(resp planResponse) {
 	if resp.Command == "automation" {
 		name, _ := resp.Plan["name"].(string)
@@ -263,6 +336,8 @@ func anyStrings(v any) []string {
 }
 
 var cliSchemas = map[string]map[string]any{
+	"automation-file": automationFileSchema,
+	"config-file":     configFileSchema,
 	"action-result": {
 		"$schema":  "https://json-schema.org/draft/2020-12/schema",
 		"type":     "object",
@@ -275,8 +350,15 @@ var cliSchemas = map[string]map[string]any{
 			"rooms":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
 			"playlist":   map[string]any{"type": "string"},
 			"playlistId": map[string]any{"type": "string"},
+			"catalog":    map[string]any{"type": "object", "description": "Apple Music catalog item play --catalog picked."},
+			"station":    map[string]any{"type": "string", "description": "Radio station radio, run, or a play step played."},
+			"app":        map[string]any{"enum": []any{"spotify"}, "description": "Player other than Music.app that play --app used."},
+			"uri":        map[string]any{"type": "string", "description": "Spotify URI play --app spotify played."},
+			"volume":     map[string]any{"type": "integer", "description": "Spotify's own volume that play or volume --app spotify set."},
 			"shortcut":   map[string]any{"type": "string"},
+			"output":     map[string]any{"type": "string"},
 			"nowPlaying": map[string]any{"type": "object"},
+			"pinned":     map[string]any{"type": "string", "description": "Alias play --pin saved the playlist in."},
 		},
 	},
 	"error-response": {
@@ -3,14 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/agisilaos/homepodctl/internal/native"
 )
 
-func setVolumeForRooms(ctx context.Context, rooms []string, value int) error {
+// setVolumeForRooms sets each room to value, shifted by the room's configured
+// volume offset so rooms land at similar loudness, and held at its maxVolume
+// unless force is set.
+func setVolumeForRooms(ctx context.Context, cfg *native.Config, rooms []string, value int, force bool) error {
 	for _, room := range rooms {
-		if err := setDeviceVolume(ctx, room, value); err != nil {
+		v := cfg.AdjustVolume(room, value)
+		if !force {
+			v = capVolume(cfg, room, v)
+		}
+		debugf("volume: room=%q requested=%d applied=%d", room, value, v)
+		if err := setDeviceVolume(ctx, room, v); err != nil {
 			return err
 		}
 	}
@@ -18,21 +27,39 @@ func setVolumeForRooms(ctx context.Context, rooms []string, value int) error {
 }
 
 func resolveNativePlaylistShortcut(cfg *native.Config, room, playlist string) (string, error) {
-	if cfg == nil {
-		return "", fmt.Errorf("native backend requires config")
+	m, err := resolveNativePlaylistMapping(cfg, room, playlist)
+	if err != nil {
+		return "", err
 	}
-	if cfg.Native.Playlists == nil {
-		return "", fmt.Errorf("no native mapping for room=%q playlist=%q", room, playlist)
+	return m.Shortcut, nil
+}
+
+// resolveNativePlaylistMapping finds the mapping for room+playlist, falling
+// back to "*" entries so one parameterized shortcut can serve many rooms or
+// playlists. {room} and {playlist} in the input are filled in.
+func resolveNativePlaylistMapping(cfg *native.Config, room, playlist string) (native.PlaylistShortcut, error) {
+	if cfg == nil {
+		return native.PlaylistShortcut{}, fmt.Errorf("native backend requires config")
 	}
-	m := cfg.Native.Playlists[room]
-	shortcut := ""
-	if m != nil {
-		shortcut = m[playlist]
+	var keys [][2]string
+	for _, r := range nativeRoomKeys(cfg, room) {
+		keys = append(keys, [2]string{r, playlist}, [2]string{r, "*"})
 	}
-	if strings.TrimSpace(shortcut) == "" {
-		return "", fmt.Errorf("no native mapping for room=%q playlist=%q", room, playlist)
+	for _, key := range append(keys, [2]string{"*", playlist}, [2]string{"*", "*"}) {
+		m, ok := cfg.Native.Playlists[key[0]][key[1]]
+		if !ok || strings.TrimSpace(m.Shortcut) == "" {
+			continue
+		}
+		m.Input = strings.NewReplacer("{room}", room, "{playlist}", playlist).Replace(m.Input)
+		return m, nil
 	}
-	return shortcut, nil
+	return native.PlaylistShortcut{}, fmt.Errorf("no native mapping for room=%q playlist=%q", room, playlist)
+}
+
+// nativeRoomKeys is room followed by its device aliases, the keys a native
+// mapping for room may be configured under.
+func nativeRoomKeys(cfg *native.Config, room string) []string {
+	return append([]string{room}, cfg.DeviceAliases(room)...)
 }
 
 func resolveNativeVolumeShortcut(cfg *native.Config, room string, value int) (string, error) {
@@ -42,10 +69,11 @@ func resolveNativeVolumeShortcut(cfg *native.Config, room string, value int) (st
 	if cfg.Native.VolumeShortcuts == nil {
 		return "", fmt.Errorf("no native volume mapping for room=%q value=%d", room, value)
 	}
-	m := cfg.Native.VolumeShortcuts[room]
 	shortcut := ""
-	if m != nil {
-		shortcut = m[fmt.Sprint(value)]
+	for _, r := range nativeRoomKeys(cfg, room) {
+		if shortcut = cfg.Native.VolumeShortcuts[r][fmt.Sprint(value)]; strings.TrimSpace(shortcut) != "" {
+			break
+		}
 	}
 	if strings.TrimSpace(shortcut) == "" {
 		return "", fmt.Errorf("no native volume mapping for room=%q value=%d", room, value)
@@ -55,20 +83,43 @@ func resolveNativeVolumeShortcut(cfg *native.Config, room string, value int) (st
 
 func runNativePlaylistShortcuts(ctx context.Context, cfg *native.Config, rooms []string, playlist string) error {
 	for _, room := range rooms {
-		shortcut, err := resolveNativePlaylistShortcut(cfg, room, playlist)
+		m, err := resolveNativePlaylistMapping(cfg, room, playlist)
 		if err != nil {
 			return err
 		}
-		if err := runNativeShortcut(ctx, shortcut); err != nil {
+		if m.Input == "" {
+			if err := runNativeShortcut(ctx, m.Shortcut); err != nil {
+				return err
+			}
+			continue
+		}
+		out, err := runNativeShortcutWithInput(ctx, m.Shortcut, m.Input)
+		if err != nil {
 			return err
 		}
+		debugf("native: shortcut=%q input=%q output=%q", m.Shortcut, m.Input, out)
 	}
 	return nil
 }
 
-func runNativeVolumeShortcuts(ctx context.Context, cfg *native.Config, rooms []string, value int) error {
+// capVolume holds v at room's maxVolume, or its quiet-hours cap, warning on
+// stderr when it has to.
+func capVolume(cfg *native.Config, room string, v int) int {
+	limit, quiet, ok := volumeLimit(cfg, room)
+	if !ok || v <= limit {
+		return v
+	}
+	fmt.Fprintf(os.Stderr, "warning: %s held at %s instead of %d\n", room, limitLabel(limit, quiet), v)
+	return limit
+}
+
+func runNativeVolumeShortcuts(ctx context.Context, cfg *native.Config, rooms []string, value int, force bool) error {
 	for _, room := range rooms {
-		shortcut, err := resolveNativeVolumeShortcut(cfg, room, value)
+		v := value
+		if !force {
+			v = capVolume(cfg, room, v)
+		}
+		shortcut, err := resolveNativeVolumeShortcut(cfg, room, v)
 		if err != nil {
 			return err
 		}
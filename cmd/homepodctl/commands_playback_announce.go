@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// announceTail is how long announce waits past the reported length of the
+// speech before restoring, for the AirPlay buffer to drain.
+const announceTail = 1500 * time.Millisecond
+
+type announceResult struct {
+	OK        bool     `json:"ok"`
+	Action    string   `json:"action"`
+	DryRun    bool     `json:"dryRun,omitempty"`
+	Text      string   `json:"text"`
+	Voice     string   `json:"voice,omitempty"`
+	Rooms     []string `json:"rooms"`
+	Volume    *int     `json:"volume,omitempty"`
+	DurationS float64  `json:"durationSeconds,omitempty"`
+	// Outputs and Playlist are what announce restores afterwards; Resumed
+	// is set when the interrupted track played on.
+	Outputs  []string `json:"outputs,omitempty"`
+	Playlist string   `json:"playlist,omitempty"`
+	Resumed  bool     `json:"resumed,omitempty"`
+}
+
+// cmdAnnounce speaks text on rooms through Music.app. Music.app has one
+// player, so whatever plays is paused for the announcement; afterwards the
+// outputs, volumes, and the interrupted track and position come back.
+func cmdAnnounce(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	text := strings.TrimSpace(strings.Join(positionals, " "))
+	if text == "" {
+		die(usageErrf("usage: homepodctl announce <text> [--room <name> ...] [--voice <name>] [--volume <0-100>]"))
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	res := announceResult{OK: true, Action: "announce", DryRun: opts.DryRun, Text: text, Voice: strings.TrimSpace(flags.string("voice"))}
+	if v, ok, err := flags.intStrict("volume"); err != nil {
+		die(err)
+	} else if ok {
+		if v < 0 || v > 100 {
+			die(usageErrf("--volume must be 0-100 (got %d)", v))
+		}
+		res.Volume = &v
+	}
+
+	rooms := cfg.ExpandRooms(flags.strings("room"))
+	if len(rooms) == 0 {
+		rooms = cfg.ExpandRooms(cfg.Defaults.Rooms)
+	}
+	if len(rooms) == 0 {
+		rooms = inferSelectedOutputs(ctx)
+	}
+	if len(rooms) == 0 {
+		die(usageErrf("no rooms provided (pass --room, set defaults.rooms, or select outputs in Music.app)"))
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		die(err)
+	}
+	if res.Rooms, err = resolveRoomNames(rooms, devs, exact); err != nil {
+		die(err)
+	}
+	before, err := getNowPlaying(ctx)
+	if err != nil {
+		die(err)
+	}
+	for _, d := range before.Outputs {
+		res.Outputs = append(res.Outputs, d.Name)
+	}
+	restart := resumableTrack(ctx, before)
+	if restart != nil {
+		res.Playlist = before.PlaylistName
+	}
+	debugf("announce: rooms=%v voice=%q volume=%v before=%s outputs=%v restart=%+v", res.Rooms, res.Voice, res.Volume, before.PlayerState, res.Outputs, restart)
+	if opts.DryRun {
+		writeAnnounceResult(res, opts)
+		return
+	}
+
+	setup := music.NewBatch()
+	if before.PlayerState == "playing" {
+		setup.Pause()
+	}
+	setup.SetOutputs(res.Rooms)
+	if res.Volume != nil {
+		for _, room := range res.Rooms {
+			setup.SetVolume(room, capVolume(cfg, room, cfg.AdjustVolume(room, *res.Volume)))
+		}
+	}
+	_, err = runMusicBatch(ctx, setup)
+	spoke := false
+	if err == nil {
+		spoke = true
+		res.DurationS, err = playSpeech(ctx, text, res.Voice)
+	}
+	if err == nil {
+		sleepFn(announceDuration(text, res.DurationS))
+	}
+	// Put things back even when the announcement failed half-way, and past
+	// the per-command timeout the speech may have used up.
+	resumed, restoreErr := restoreAfterAnnounce(context.WithoutCancel(ctx), before, res.Rooms, devs, restart)
+	if spoke {
+		// The speech file was added to the library to play it; take it out.
+		if err := removeSpeech(context.WithoutCancel(ctx)); err != nil && !quiet {
+			fmt.Fprintf(os.Stderr, "warning: announce: remove the speech track: %v\n", err)
+		}
+	}
+	if err != nil {
+		die(err)
+	}
+	if restoreErr != nil {
+		die(fmt.Errorf("announce: restore: %w", restoreErr))
+	}
+	res.Resumed = resumed
+	writeAnnounceResult(res, opts)
+}
+
+// announceDuration is how long to let the speech play. Music.app may not
+// know the file's length yet right after starting it, in which case it is
+// estimated from the number of words.
+func announceDuration(text string, seconds float64) time.Duration {
+	if seconds <= 0 {
+		seconds = 1 + float64(len(strings.Fields(text)))/2.5
+	}
+	return time.Duration(seconds*float64(time.Second)) + announceTail
+}
+
+// resumableTrack finds the playlist track np is on, so it can be started
+// again after the announcement replaced it. It returns nil when nothing is
+// playing or paused, or the track is not in a playlist (radio, a stream).
+func resumableTrack(ctx context.Context, np music.NowPlaying) *music.PlaylistTrack {
+	if np.PlayerState != "playing" && np.PlayerState != "paused" {
+		return nil
+	}
+	if np.PlaylistID == "" || np.Track.PersistentID == "" {
+		return nil
+	}
+	tracks, err := music.GetPlaylistTracks(ctx, np.PlaylistID)
+	if err != nil {
+		debugf("announce: playlist tracks: %v", err)
+		return nil
+	}
+	for _, t := range tracks {
+		if t.PersistentID == np.Track.PersistentID {
+			return &t
+		}
+	}
+	return nil
+}
+
+// restoreAfterAnnounce puts back the outputs and the volumes of rooms from
+// before the announcement, then restarts the interrupted track at its
+// position, paused again if it was paused. Without a track to restart the
+// player is left stopped at the end of the speech. It reports whether
+// playback resumed.
+func restoreAfterAnnounce(ctx context.Context, before music.NowPlaying, rooms []string, devs []music.AirPlayDevice, restart *music.PlaylistTrack) (bool, error) {
+	b := music.NewBatch()
+	outputs := make([]string, 0, len(before.Outputs))
+	for _, d := range before.Outputs {
+		outputs = append(outputs, d.Name)
+	}
+	b.SetOutputs(outputs)
+	for _, room := range rooms {
+		for _, d := range devs {
+			if d.Name == room {
+				b.SetVolume(room, d.Volume)
+			}
+		}
+	}
+	if restart != nil {
+		b.PlayPlaylistTrack(before.PlaylistID, restart.Index).Seek(before.PlayerPositionS)
+		if before.PlayerState != "playing" {
+			b.Pause()
+		}
+	}
+	debugf("announce: restore=%q", b.Ops())
+	if _, err := runMusicBatch(ctx, b); err != nil {
+		return false, err
+	}
+	return restart != nil && before.PlayerState == "playing", nil
+}
+
+func writeAnnounceResult(res announceResult, opts outputOptions) {
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	if opts.Plain {
+		fmt.Printf("%s\t%s\n", strings.Join(res.Rooms, ","), res.Text)
+		return
+	}
+	prefix := "announced"
+	if res.DryRun {
+		prefix = "dry-run: would announce"
+	}
+	fmt.Printf("%s %q in %s\n", prefix, res.Text, strings.Join(res.Rooms, ", "))
+	if res.Resumed {
+		fmt.Printf("  resumed: %s\n", res.Playlist)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/spotify"
+)
+
+// Players --app picks between. Music.app is the default; Spotify supports
+// play, the transport commands, volume, and status.
+const (
+	appMusic   = "music"
+	appSpotify = "spotify"
+)
+
+// sourceSpotify is the status source kind of whatever Spotify plays.
+const sourceSpotify = "spotify"
+
+// parseApp reads --app, defaulting to Music.app.
+func parseApp(flags parsedArgs) (string, error) {
+	app := strings.ToLower(strings.TrimSpace(flags.string("app")))
+	switch app {
+	case "":
+		return appMusic, nil
+	case appMusic, appSpotify:
+		return app, nil
+	}
+	return "", usageErrf("invalid --app %q (expected music|spotify)", flags.string("app"))
+}
+
+// appTransports are the transport commands of the players other than
+// Music.app.
+var appTransports = map[string]map[string]func(context.Context) error{
+	// Spotify has no stop.
+	appSpotify: {
+		"pause":  spotify.Pause,
+		"resume": spotify.Play,
+		"next":   spotify.Next,
+		"prev":   spotify.Previous,
+	},
+}
+
+// appNowPlaying returns the now-playing reader of app.
+func appNowPlaying(app string) func(context.Context) (music.NowPlaying, error) {
+	if app == appSpotify {
+		return spotifyNowPlaying
+	}
+	return getNowPlaying
+}
+
+// spotifyNowPlaying reads Spotify's player as a music.NowPlaying. Spotify
+// plays to the system sound output, so there are no AirPlay outputs.
+func spotifyNowPlaying(ctx context.Context) (music.NowPlaying, error) {
+	s, err := getSpotifyNowPlaying(ctx)
+	if err != nil {
+		return music.NowPlaying{}, err
+	}
+	np := music.NowPlaying{
+		PlayerState:     s.PlayerState,
+		PlayerPositionS: s.PlayerPositionS,
+		Source:          music.SourceNone,
+		Track: music.NowPlayingTrack{
+			Name:         s.Track.Name,
+			Artist:       s.Track.Artist,
+			Album:        s.Track.Album,
+			DurationS:    s.Track.DurationS,
+			PersistentID: s.Track.ID,
+		},
+	}
+	if s.Track.ID != "" {
+		np.Source = sourceSpotify
+	}
+	return np, nil
+}
+
+// cmdPlaySpotify is play --app spotify <uri>: it plays a Spotify URI or
+// open.spotify.com link, at --volume if given.
+func cmdPlaySpotify(ctx context.Context, flags parsedArgs, positionals []string, opts outputOptions) {
+	for _, name := range []string{"playlist", "playlist-id", "catalog", "choose", "pin", "synchronized", "track", "track-index", "resume", "shuffle"} {
+		if flags.has(name) {
+			die(usageErrf("--%s does not apply to --app spotify", name))
+		}
+	}
+	if flags.has("room") {
+		die(usageErrf("Spotify plays to the system sound output, not to rooms; send it to a room with `homepodctl audio route <room>`"))
+	}
+	if backend := strings.TrimSpace(flags.string("backend")); backend != "" && backend != "airplay" {
+		die(usageErrf("--app spotify needs backend=airplay (got %q)", backend))
+	}
+	if len(positionals) != 1 {
+		die(usageErrf("usage: homepodctl play --app spotify <spotify-uri|open.spotify.com-link> [--volume 0-100]"))
+	}
+	uri, err := spotify.NormalizeURI(positionals[0])
+	if err != nil {
+		die(usageErrf("%v", err))
+	}
+	volume, hasVolume, err := flags.intStrict("volume")
+	if err != nil {
+		die(err)
+	}
+	if hasVolume {
+		if err := validateVolumeLevel(volume, false); err != nil {
+			die(err)
+		}
+	}
+	debugf("play: app=spotify uri=%s volume=%d", uri, volume)
+	out := actionOutput{DryRun: opts.DryRun, App: appSpotify, URI: uri}
+	if hasVolume {
+		out.Volume = &volume
+	}
+	if opts.DryRun {
+		writeActionOutput("play", opts.JSON, opts.Plain, out)
+		return
+	}
+	if hasVolume {
+		if err := setSpotifyVolume(ctx, volume); err != nil {
+			die(err)
+		}
+	}
+	if err := playSpotifyURI(ctx, uri); err != nil {
+		die(err)
+	}
+	if np, err := spotifyNowPlaying(ctx); err == nil {
+		out.NowPlaying = &np
+	}
+	writeActionOutput("play", opts.JSON, opts.Plain, out)
+}
+
+// cmdAppVolume is volume --app spotify: Spotify's own volume, set to a level
+// or by +N/-N.
+func cmdAppVolume(ctx context.Context, app, name string, flags parsedArgs, positionals []string, opts outputOptions) {
+	usageLine := fmt.Sprintf("usage: homepodctl %s <0-100|+N|-N> --app spotify (Spotify has one volume, not one per room)", name)
+	raw := strings.TrimSpace(flags.string("value"))
+	if raw == "" {
+		raw = strings.TrimSpace(flags.string("volume"))
+	}
+	if raw == "" && len(positionals) == 1 {
+		raw, positionals = positionals[0], nil
+	}
+	if flags.has("room") || len(positionals) != 0 {
+		die(usageErrf("%s", usageLine))
+	}
+	value, relative, ok := parseVolumeLevel(raw)
+	if !ok {
+		die(usageErrf("%s", usageLine))
+	}
+	if err := validateVolumeLevel(value, relative); err != nil {
+		die(err)
+	}
+	out := actionOutput{DryRun: opts.DryRun, App: app}
+	if relative || !opts.DryRun {
+		np, err := getSpotifyNowPlaying(ctx)
+		if err != nil {
+			die(err)
+		}
+		if relative {
+			value = max(0, min(100, np.Volume+value))
+		}
+	}
+	out.Volume = &value
+	debugf("%s: app=spotify volume=%d", name, value)
+	if !opts.DryRun {
+		if err := setSpotifyVolume(ctx, value); err != nil {
+			die(err)
+		}
+		if np, err := spotifyNowPlaying(ctx); err == nil {
+			out.NowPlaying = &np
+		}
+	}
+	writeActionOutput(name, opts.JSON, opts.Plain, out)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type artworkResult struct {
+	OK     bool   `json:"ok"`
+	Path   string `json:"path"`
+	Format string `json:"format"` // jpeg|png
+}
+
+func cmdArtwork(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl artwork [--out <file>] [--term] [--width <cols>] [--json]"))
+	}
+	jsonOut, _, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	term, _, err := flags.boolStrict("term")
+	if err != nil {
+		die(err)
+	}
+	if term && jsonOut {
+		die(usageErrf("--term cannot be combined with --json"))
+	}
+	width := 32
+	if n, ok, err := flags.intStrict("width"); err != nil {
+		die(err)
+	} else if ok {
+		if n <= 0 || n > 400 {
+			die(usageErrf("--width must be 1..400"))
+		}
+		width = n
+	}
+
+	out := strings.TrimSpace(flags.string("out"))
+	// --term alone only renders; the exported file is a scratch copy.
+	keep := out != "" || !term
+	path := out
+	if path == "" {
+		path = filepath.Join(os.TempDir(), "homepodctl-artwork")
+	}
+	format, err := exportArtwork(ctx, path)
+	if err != nil {
+		die(err)
+	}
+	if out == "" && keep {
+		final := path + artworkExt(format)
+		if err := os.Rename(path, final); err != nil {
+			die(err)
+		}
+		path = final
+	}
+	debugf("artwork: path=%s format=%s term=%t", path, format, term)
+
+	if term {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			die(err)
+		}
+		if !keep {
+			_ = os.Remove(path)
+		}
+		if err := renderImageInline(os.Stdout, data, detectImageProtocol(os.Getenv), width); err != nil {
+			die(err)
+		}
+	}
+	if jsonOut {
+		writeJSON(artworkResult{OK: true, Path: path, Format: format})
+		return
+	}
+	if keep && !quiet {
+		fmt.Println(path)
+	}
+}
+
+func artworkExt(format string) string {
+	if format == "png" {
+		return ".png"
+	}
+	return ".jpg"
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// defaultDuckLevel is the volume duck lowers rooms to without --to.
+const defaultDuckLevel = 15
+
+// duckState remembers the volumes duck lowered so unduck can restore them.
+// It lives in the state dir as duck.json. Until is when a duck --for
+// restores them on its own.
+type duckState struct {
+	Until string         `json:"until,omitempty"`
+	Rooms map[string]int `json:"rooms"` // device name -> volume before duck
+}
+
+type duckRoom struct {
+	Room string `json:"room"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+type duckResult struct {
+	OK     bool       `json:"ok"`
+	Action string     `json:"action"`
+	DryRun bool       `json:"dryRun,omitempty"`
+	Until  string     `json:"until,omitempty"`
+	Rooms  []duckRoom `json:"rooms"`
+}
+
+func defaultDuckStatePath() (string, error) {
+	return state.Path("duck.json")
+}
+
+func loadDuckState() (*duckState, error) {
+	st := &duckState{Rooms: map[string]int{}}
+	path, err := duckStatePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if st.Rooms == nil {
+		st.Rooms = map[string]int{}
+	}
+	return st, nil
+}
+
+func saveDuckState(st *duckState) error {
+	path, err := duckStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func (st *duckState) lookup(room string) (string, int, bool) {
+	if v, ok := st.Rooms[room]; ok {
+		return room, v, true
+	}
+	for k, v := range st.Rooms {
+		if strings.EqualFold(k, strings.TrimSpace(room)) {
+			return k, v, true
+		}
+	}
+	return "", 0, false
+}
+
+func cmdDuck(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	level := defaultDuckLevel
+	if v, ok, err := flags.intStrict("to"); err != nil {
+		die(err)
+	} else if ok {
+		if v < 0 || v > 100 {
+			die(usageErrf("--to must be 0-100 (got %d)", v))
+		}
+		level = v
+	}
+	var hold time.Duration
+	if raw := strings.TrimSpace(flags.string("for")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --for %q (expected a duration like 30s or 10m)", raw))
+		}
+		hold = d
+	}
+	until := ""
+	if hold > 0 {
+		until = timeNow().Add(hold).UTC().Format(time.RFC3339)
+	}
+	res, err := duckRooms(ctx, muteRooms(cfg, flags, positionals), level, until, exact, opts.DryRun)
+	if err != nil {
+		die(err)
+	}
+	writeDuckResult(res, opts)
+	if hold <= 0 || opts.DryRun {
+		return
+	}
+	// The restore must outlive the per-command timeout, which is meant for
+	// the calls that ducked.
+	debugf("duck: restoring at %s", until)
+	holdDuck(hold)
+	rooms := make([]string, 0, len(res.Rooms))
+	for _, r := range res.Rooms {
+		rooms = append(rooms, r.Room)
+	}
+	if _, err := unduckRooms(context.WithoutCancel(ctx), rooms, until, false); err != nil {
+		die(err)
+	}
+}
+
+// holdDuck waits out duck --for, returning early on SIGINT or SIGTERM so an
+// interrupted duck still restores the rooms.
+func holdDuck(hold time.Duration) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	done := make(chan struct{})
+	go func() {
+		sleepFn(hold)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case s := <-sig:
+		debugf("duck: %v; restoring now", s)
+	}
+}
+
+// restoreExpiredDuck unducks every room once the Until in duck.json has
+// passed, for ducks whose own restore never ran: a duck --for that was
+// killed, or an automation duck step with for. The daemon calls it.
+func restoreExpiredDuck(ctx context.Context) (duckResult, error) {
+	st, err := loadDuckState()
+	if err != nil || st.Until == "" {
+		return duckResult{}, err
+	}
+	until, err := time.Parse(time.RFC3339, st.Until)
+	if err != nil || timeNow().Before(until) {
+		return duckResult{}, err
+	}
+	return unduckRooms(ctx, nil, st.Until, false)
+}
+
+func cmdUnduck(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	res, err := unduckRooms(ctx, muteRooms(cfg, flags, positionals), "", opts.DryRun)
+	if err != nil {
+		die(err)
+	}
+	if len(res.Rooms) == 0 {
+		die(usageErrf("nothing to unduck (no remembered volumes; run `homepodctl duck` first)"))
+	}
+	writeDuckResult(res, opts)
+}
+
+// duckRooms lowers rooms (the selected outputs when empty) to level,
+// remembering each room's volume in duck.json first. Rooms already at or
+// below level are left alone, and ducking a ducked room keeps the level
+// remembered the first time.
+func duckRooms(ctx context.Context, rooms []string, level int, until string, exact, dryRun bool) (duckResult, error) {
+	res := duckResult{OK: true, Action: "duck", DryRun: dryRun, Until: until, Rooms: []duckRoom{}}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return res, err
+	}
+	if len(rooms) == 0 {
+		for _, d := range devs {
+			if d.Selected {
+				rooms = append(rooms, d.Name)
+			}
+		}
+		if len(rooms) == 0 {
+			return res, usageErrf("no rooms to duck (pass room names or select outputs in Music.app)")
+		}
+	}
+	names, err := resolveRoomNames(rooms, devs, exact)
+	if err != nil {
+		return res, err
+	}
+	volumes := map[string]int{}
+	for _, d := range devs {
+		volumes[d.Name] = d.Volume
+	}
+	st, err := loadDuckState()
+	if err != nil {
+		return res, err
+	}
+	for _, name := range names {
+		from := volumes[name]
+		if _, _, ducked := st.lookup(name); !ducked {
+			st.Rooms[name] = from
+		}
+		res.Rooms = append(res.Rooms, duckRoom{Room: name, From: from, To: min(from, level)})
+	}
+	st.Until = until
+	debugf("duck: level=%d rooms=%v remembered=%v", level, names, st.Rooms)
+	if dryRun {
+		return res, nil
+	}
+	// Save first so a failure half-way through still leaves levels to restore.
+	if err := saveDuckState(st); err != nil {
+		return res, err
+	}
+	for _, r := range res.Rooms {
+		if r.To == r.From {
+			continue
+		}
+		if err := setDeviceVolume(ctx, r.Room, r.To); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// unduckRooms restores the remembered volumes of rooms (every ducked room
+// when empty). A timed restore passes the until it ducked with and does
+// nothing once a later duck or an unduck has taken over.
+func unduckRooms(ctx context.Context, rooms []string, until string, dryRun bool) (duckResult, error) {
+	res := duckResult{OK: true, Action: "unduck", DryRun: dryRun, Rooms: []duckRoom{}}
+	st, err := loadDuckState()
+	if err != nil {
+		return res, err
+	}
+	if until != "" && st.Until != until {
+		debugf("unduck: duck until %s was replaced (now %q)", until, st.Until)
+		return res, nil
+	}
+	if len(rooms) == 0 {
+		for room := range st.Rooms {
+			rooms = append(rooms, room)
+		}
+		sort.Strings(rooms)
+	}
+	for _, room := range rooms {
+		key, v, ok := st.lookup(room)
+		if !ok {
+			debugf("unduck: no remembered volume for %q", room)
+			continue
+		}
+		res.Rooms = append(res.Rooms, duckRoom{Room: key, To: v})
+	}
+	if len(res.Rooms) == 0 {
+		return res, nil
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return res, err
+	}
+	for i, r := range res.Rooms {
+		for _, d := range devs {
+			if d.Name == r.Room {
+				res.Rooms[i].From = d.Volume
+			}
+		}
+	}
+	if dryRun {
+		return res, nil
+	}
+	for _, r := range res.Rooms {
+		if err := setDeviceVolume(ctx, r.Room, r.To); err != nil {
+			return res, err
+		}
+		delete(st.Rooms, r.Room)
+	}
+	if len(st.Rooms) == 0 {
+		st.Until = ""
+	}
+	return res, saveDuckState(st)
+}
+
+func writeDuckResult(res duckResult, opts outputOptions) {
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	if opts.Plain {
+		for _, r := range res.Rooms {
+			fmt.Printf("%s\t%d\t%d\n", r.Room, r.From, r.To)
+		}
+		return
+	}
+	parts := make([]string, 0, len(res.Rooms))
+	for _, r := range res.Rooms {
+		parts = append(parts, fmt.Sprintf("%s %d -> %d", r.Room, r.From, r.To))
+	}
+	line := res.Action
+	if res.DryRun {
+		line = "dry-run: would " + res.Action
+	}
+	line += ": " + strings.Join(parts, ", ")
+	if res.Until != "" {
+		if t, err := time.Parse(time.RFC3339, res.Until); err == nil {
+			line += " (until " + t.Local().Format("15:04:05") + ")"
+		}
+	}
+	fmt.Println(line)
+}
+
+// executeAutomationDuck runs a duck or unduck step. A duck step's for is
+// recorded as the Until in duck.json rather than waited out; a running
+// daemon restores the rooms once it passes.
+func executeAutomationDuck(ctx context.Context, st automationStep) error {
+	if st.Type == "unduck" {
+		_, err := unduckRooms(ctx, st.Rooms, "", false)
+		return err
+	}
+	level := defaultDuckLevel
+	if st.Value != nil {
+		level = *st.Value
+	}
+	until := ""
+	if raw := strings.TrimSpace(st.For); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid for %q", raw)
+		}
+		until = timeNow().Add(d).UTC().Format(time.RFC3339)
+	}
+	_, err := duckRooms(ctx, st.Rooms, level, until, false, false)
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+func cmdEQ(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		die(usageErrf("usage: homepodctl eq <list|set> ..."))
+	}
+	sub, rest := args[0], args[1:]
+	flags, positionals, err := parseArgs(rest)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	switch sub {
+	case "list":
+		if len(positionals) != 0 {
+			die(usageErrf("usage: homepodctl eq list [--json] [--plain]"))
+		}
+		presets, err := listEQPresets(ctx)
+		if err != nil {
+			die(err)
+		}
+		if opts.JSON {
+			if presets == nil {
+				presets = []music.EQPreset{}
+			}
+			writeJSON(presets)
+			return
+		}
+		if !opts.Plain {
+			fmt.Println("PRESET\tCURRENT\tCUSTOM")
+		}
+		for _, p := range presets {
+			fmt.Printf("%s\t%t\t%t\n", p.Name, p.Current, p.Modifiable)
+		}
+	case "set":
+		if len(positionals) == 0 {
+			die(usageErrf("usage: homepodctl eq set <preset> [--json] [--plain] [--dry-run]"))
+		}
+		name := strings.TrimSpace(strings.Join(positionals, " "))
+		res := playbackModeResult{OK: true, Action: "eq.set", DryRun: opts.DryRun, EQPreset: name}
+		if !opts.DryRun {
+			if res.EQPreset, err = setEQPreset(ctx, name); err != nil {
+				die(err)
+			}
+		}
+		writePlaybackModeResult(res, opts)
+	default:
+		die(usageErrf("unknown eq subcommand: %q (expected list or set)", sub))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+type lyricsResult struct {
+	OK     bool   `json:"ok"`
+	Track  string `json:"track"`
+	Artist string `json:"artist,omitempty"`
+	Lyrics string `json:"lyrics"`
+}
+
+func cmdLyrics(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl lyrics [--watch <duration>] [--json]"))
+	}
+	jsonOut, _, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	var watch time.Duration
+	if raw := strings.TrimSpace(flags.string("watch")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --watch %q (expected duration like 2s)", raw))
+		}
+		watch = d
+	}
+
+	if watch == 0 {
+		np, err := getNowPlaying(ctx)
+		if err != nil {
+			die(err)
+		}
+		lyrics, err := getLyrics(ctx)
+		if err != nil {
+			die(err)
+		}
+		res := lyricsResult{OK: true, Track: np.Track.Name, Artist: np.Track.Artist, Lyrics: lyrics}
+		if jsonOut {
+			writeJSON(res)
+			return
+		}
+		fmt.Println(res.Lyrics)
+		return
+	}
+
+	// Watch mode runs until interrupted, so it must not inherit the per-command timeout.
+	base := context.WithoutCancel(ctx)
+	enc := json.NewEncoder(os.Stdout)
+	first := true
+	err = watchNowPlaying(base, watch, func(np music.NowPlaying, events []nowPlayingEvent) {
+		if !first && !hasNowPlayingEvent(events, "track.changed") {
+			return
+		}
+		first = false
+		res := fetchLyrics(base, np)
+		if jsonOut {
+			_ = enc.Encode(res)
+			return
+		}
+		fmt.Println(formatLyricsBlock(res))
+	})
+	if err != nil {
+		die(err)
+	}
+}
+
+// fetchLyrics looks up lyrics for the track in np. A track without lyrics is
+// not an error in watch mode; the result just carries empty lyrics.
+func fetchLyrics(ctx context.Context, np music.NowPlaying) lyricsResult {
+	res := lyricsResult{OK: true, Track: np.Track.Name, Artist: np.Track.Artist}
+	callCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	lyrics, err := getLyrics(callCtx)
+	if err != nil && !errors.Is(err, music.ErrNoLyrics) {
+		debugf("lyrics: lookup failed: %v", err)
+		res.OK = false
+	}
+	res.Lyrics = lyrics
+	return res
+}
+
+func formatLyricsBlock(res lyricsResult) string {
+	title := res.Track
+	if title == "" {
+		title = "(nothing playing)"
+	} else if res.Artist != "" {
+		title += " - " + res.Artist
+	}
+	body := res.Lyrics
+	switch {
+	case !res.OK:
+		body = "(lyrics unavailable)"
+	case body == "":
+		body = "(no lyrics)"
+	}
+	return fmt.Sprintf("== %s ==\n%s\n", title, body)
+}
+
+func hasNowPlayingEvent(events []nowPlayingEvent, name string) bool {
+	for _, ev := range events {
+		if ev.Event == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// mixerRoom is one row of the mixer: a selected output, or one the
+// adjustments named. Without adjustments Before and After are equal.
+type mixerRoom struct {
+	Room     string `json:"room"`
+	Selected bool   `json:"selected"`
+	Before   int    `json:"before"`
+	After    int    `json:"after"`
+	Muted    bool   `json:"muted,omitempty"`
+}
+
+type mixerResult struct {
+	OK         bool               `json:"ok"`
+	Action     string             `json:"action"`
+	DryRun     bool               `json:"dryRun,omitempty"`
+	Rooms      []mixerRoom        `json:"rooms"`
+	Changed    []string           `json:"changed,omitempty"`
+	QuietHours []quietHoursNotice `json:"quietHours,omitempty"`
+}
+
+// mixerTarget is one <room>=<level> adjustment; mute remembers the room's
+// level before it (Before) for unmute.
+type mixerTarget struct {
+	volumeTarget
+	Mute   bool
+	Before int
+}
+
+// cmdMixer is mixer: a table of the selected outputs' volumes and, given
+// <room>=<level> pairs, sets them all in one Music.app batch.
+func cmdMixer(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	force, _, err := flags.boolStrict("force")
+	if err != nil {
+		die(err)
+	}
+	noInput, _, err := flags.boolStrict("no-input")
+	if err != nil {
+		die(err)
+	}
+	if backend := strings.TrimSpace(flags.string("backend")); backend != "" && backend != "airplay" {
+		die(usageErrf("mixer needs backend=airplay (got %q)", backend))
+	}
+	adjustments, err := parseMixerAssignments(cfg, positionals)
+	if err != nil {
+		die(err)
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		die(err)
+	}
+	targets, err := resolveMixerTargets(cfg, devs, adjustments, exact)
+	if err != nil {
+		die(err)
+	}
+	volumes := make([]volumeTarget, 0, len(targets))
+	for _, t := range targets {
+		volumes = append(volumes, t.volumeTarget)
+	}
+	if !opts.DryRun {
+		if volumes, err = guardVolumeTargets(cfg, volumes, force, volumePrompter(opts, force, noInput)); err != nil {
+			die(err)
+		}
+		for i := range targets {
+			targets[i].Value = volumes[i].Value
+		}
+	}
+
+	res := mixerResult{OK: true, Action: "mixer", DryRun: opts.DryRun, Rooms: mixerRows(devs, targets)}
+	for _, t := range targets {
+		res.Changed = append(res.Changed, t.Room)
+	}
+	res.QuietHours = activeQuietHours(cfg, res.Changed)
+	debugf("mixer: targets=%v", targets)
+	if !opts.DryRun && len(targets) > 0 {
+		after, err := applyMixerTargets(ctx, targets)
+		if err != nil {
+			die(err)
+		}
+		for i, r := range res.Rooms {
+			if v, ok := after[strings.ToLower(r.Room)]; ok {
+				res.Rooms[i].After = v
+			}
+		}
+	}
+
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	printMixer(res, opts.Plain)
+}
+
+// hasMixerAssignments reports whether mixer args set any level, as opposed
+// to only printing the table.
+func hasMixerAssignments(args []string) bool {
+	_, positionals, err := parseArgs(args)
+	return err == nil && len(positionals) > 0
+}
+
+// parseMixerAssignments parses <room>=<level> pairs as volume does, plus
+// <room>=mute.
+func parseMixerAssignments(cfg *native.Config, args []string) ([]mixerTarget, error) {
+	var out []mixerTarget
+	for _, arg := range args {
+		room, level, ok := strings.Cut(arg, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(level), "mute") && strings.TrimSpace(room) != "" {
+			for _, r := range cfg.ExpandRooms([]string{strings.TrimSpace(room)}) {
+				out = append(out, mixerTarget{volumeTarget: volumeTarget{Room: r}, Mute: true})
+			}
+			continue
+		}
+		targets, err := parseVolumeAssignments(cfg, []string{arg})
+		if err != nil {
+			return nil, usageErrf("invalid mixer level %q (expected <room>=<0-100|+N|-N|mute>, e.g. Kitchen=40)", arg)
+		}
+		for _, t := range targets {
+			out = append(out, mixerTarget{volumeTarget: t})
+		}
+	}
+	return out, nil
+}
+
+// resolveMixerTargets matches each adjustment to a device and turns it into
+// an absolute level: absolute levels get the room's volumeOffset, relative
+// ones apply to the current volume, and mute is 0. A room named twice keeps
+// its last level.
+func resolveMixerTargets(cfg *native.Config, devs []music.AirPlayDevice, adjustments []mixerTarget, exact bool) ([]mixerTarget, error) {
+	current := make(map[string]int, len(devs))
+	for _, d := range devs {
+		current[strings.ToLower(d.Name)] = d.Volume
+	}
+	var out []mixerTarget
+	index := map[string]int{}
+	for _, a := range adjustments {
+		name, err := music.ResolveRoom(a.Room, devs, exact)
+		if err != nil {
+			return nil, err
+		}
+		t := mixerTarget{volumeTarget: volumeTarget{Room: name}, Mute: a.Mute, Before: current[strings.ToLower(name)]}
+		switch {
+		case a.Mute:
+		case a.Relative:
+			t.Value = max(0, min(100, t.Before+a.Value))
+		default:
+			t.Value = cfg.AdjustVolume(name, a.Value)
+		}
+		if i, ok := index[strings.ToLower(name)]; ok {
+			out[i] = t
+			continue
+		}
+		index[strings.ToLower(name)] = len(out)
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// mixerRows lists the selected outputs, then any other device targets
+// adjusts, in Music.app's order.
+func mixerRows(devs []music.AirPlayDevice, targets []mixerTarget) []mixerRoom {
+	byRoom := make(map[string]mixerTarget, len(targets))
+	for _, t := range targets {
+		byRoom[strings.ToLower(t.Room)] = t
+	}
+	rows := []mixerRoom{}
+	for _, selected := range []bool{true, false} {
+		for _, d := range devs {
+			t, adjusted := byRoom[strings.ToLower(d.Name)]
+			if d.Selected != selected || (!selected && !adjusted) {
+				continue
+			}
+			row := mixerRoom{Room: d.Name, Selected: d.Selected, Before: d.Volume, After: d.Volume}
+			if adjusted {
+				row.After, row.Muted = t.Value, t.Mute
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// applyMixerTargets sets every level in one batch and returns the volumes
+// Music.app reports afterwards, keyed by lower-cased device name. Muted
+// rooms are remembered first, so unmute can restore them even if the batch
+// fails half-way.
+func applyMixerTargets(ctx context.Context, targets []mixerTarget) (map[string]int, error) {
+	b := music.NewBatch()
+	var st *muteState
+	for _, t := range targets {
+		b.SetVolume(t.Room, t.Value)
+		if !t.Mute {
+			continue
+		}
+		if st == nil {
+			var err error
+			if st, err = loadMuteState(); err != nil {
+				return nil, err
+			}
+		}
+		// Muting twice must not overwrite the remembered level with 0.
+		if _, _, muted := st.lookup(t.Room); muted && t.Before == 0 {
+			continue
+		}
+		st.Rooms[t.Room] = t.Before
+	}
+	if st != nil {
+		if err := saveMuteState(st); err != nil {
+			return nil, err
+		}
+	}
+	res, err := runMusicBatch(ctx, b.NowPlaying())
+	if err != nil {
+		return nil, err
+	}
+	after := make(map[string]int, len(targets))
+	for _, t := range targets {
+		after[strings.ToLower(t.Room)] = t.Value
+	}
+	if res.NowPlaying != nil {
+		for _, d := range res.NowPlaying.Outputs {
+			after[strings.ToLower(d.Name)] = d.Volume
+		}
+	}
+	return after, nil
+}
+
+func printMixer(res mixerResult, plain bool) {
+	if plain {
+		for _, r := range res.Rooms {
+			fmt.Printf("%s\t%d\t%d\t%t\n", r.Room, r.Before, r.After, r.Selected)
+		}
+		return
+	}
+	if res.DryRun && len(res.Changed) > 0 {
+		fmt.Println("dry-run: would set:")
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(res.Changed) == 0 {
+		fmt.Fprintln(tw, "ROOM\tVOLUME\t")
+		for _, r := range res.Rooms {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", r.Room, r.After, volumeBar(r.After, 20))
+		}
+	} else {
+		fmt.Fprintln(tw, "ROOM\tBEFORE\tAFTER\t")
+		for _, r := range res.Rooms {
+			after := strconv.Itoa(r.After)
+			if r.Muted {
+				after += " (muted)"
+			}
+			if !r.Selected {
+				after += " (not selected)"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", r.Room, r.Before, after, volumeBar(r.After, 20))
+		}
+	}
+	_ = tw.Flush()
+	if len(res.Rooms) == 0 {
+		fmt.Println("no AirPlay outputs selected (select outputs in Music.app or with `homepodctl out set`)")
+	}
+}
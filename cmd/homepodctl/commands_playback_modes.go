@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+// playbackModeResult reports a shuffle, crossfade, or EQ change.
+type playbackModeResult struct {
+	OK          bool         `json:"ok"`
+	Action      string       `json:"action"`
+	DryRun      bool         `json:"dryRun,omitempty"`
+	Shuffle     *bool        `json:"shuffle,omitempty"`
+	ShuffleMode string       `json:"shuffleMode,omitempty"`
+	Crossfade   *int         `json:"crossfadeSeconds,omitempty"` // 0 is off
+	EQPreset    string       `json:"eqPreset,omitempty"`
+	Hooks       []hookResult `json:"hooks,omitempty"`
+}
+
+func cmdShuffle(ctx context.Context, args []string) {
+	const usageLine = "usage: homepodctl shuffle on|off [--mode songs|albums|groupings] [--json] [--plain] [--dry-run]"
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	mode := strings.ToLower(strings.TrimSpace(flags.string("mode")))
+	if flags.has("mode") && !isShuffleMode(mode) {
+		die(usageErrf("invalid --mode %q (expected songs|albums|groupings)", mode))
+	}
+	res := playbackModeResult{OK: true, Action: "shuffle", DryRun: opts.DryRun, ShuffleMode: mode}
+	switch {
+	case len(positionals) == 1 && (positionals[0] == "on" || positionals[0] == "off"):
+		on := positionals[0] == "on"
+		res.Shuffle = &on
+	case len(positionals) == 0 && mode != "":
+		// Picking a mode means shuffling that way.
+		on := true
+		res.Shuffle = &on
+	default:
+		die(usageErrf("%s", usageLine))
+	}
+	debugf("shuffle: enabled=%t mode=%q", *res.Shuffle, mode)
+	if !opts.DryRun {
+		if mode != "" {
+			if err := setShuffleMode(ctx, mode); err != nil {
+				die(err)
+			}
+		}
+		if err := setShuffle(ctx, *res.Shuffle); err != nil {
+			die(err)
+		}
+	}
+	writePlaybackModeResult(res, opts)
+}
+
+func cmdCrossfade(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 1 {
+		die(usageErrf("usage: homepodctl crossfade <seconds|off> --ui-scripting [--json] [--plain] [--dry-run]"))
+	}
+	seconds, err := parseCrossfade(positionals[0])
+	if err != nil {
+		die(usageErrf("%v", err))
+	}
+	// Crossfade clicks through Music.app's settings window, so it only runs
+	// when asked for by name, never from aliases or automations.
+	uiScripting, _, err := flags.boolStrict("ui-scripting")
+	if err != nil {
+		die(err)
+	}
+	if !uiScripting && !opts.DryRun {
+		die(usageErrf("crossfade scripts Music.app's settings window through System Events (Accessibility permission, English UI); pass --ui-scripting to allow it"))
+	}
+	res := playbackModeResult{OK: true, Action: "crossfade", DryRun: opts.DryRun, Crossfade: &seconds}
+	if !opts.DryRun {
+		if err := setCrossfade(ctx, seconds); err != nil {
+			die(err)
+		}
+	}
+	writePlaybackModeResult(res, opts)
+}
+
+func writePlaybackModeResult(res playbackModeResult, opts outputOptions) {
+	recordResult(res)
+	res.Hooks = hookResults()
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	var parts []string
+	if res.DryRun {
+		parts = append(parts, "dry-run")
+	}
+	if res.Shuffle != nil {
+		parts = append(parts, "shuffle="+onOff(*res.Shuffle))
+	}
+	if res.ShuffleMode != "" {
+		parts = append(parts, "mode="+res.ShuffleMode)
+	}
+	if res.Crossfade != nil {
+		v := "off"
+		if *res.Crossfade > 0 {
+			v = fmt.Sprintf("%ds", *res.Crossfade)
+		}
+		parts = append(parts, "crossfade="+v)
+	}
+	if res.EQPreset != "" {
+		parts = append(parts, fmt.Sprintf("eq=%q", res.EQPreset))
+	}
+	line := strings.Join(parts, " ")
+	if opts.Plain {
+		line = strings.Join(parts, "\t")
+	}
+	fmt.Println(line)
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func isShuffleMode(s string) bool {
+	switch s {
+	case music.ShuffleSongs, music.ShuffleAlbums, music.ShuffleGroupings:
+		return true
+	}
+	return false
+}
+
+// parseCrossfade reads a crossfade length: whole seconds up to
+// music.MaxCrossfadeSeconds, with "off" (or 0) turning crossfading off.
+func parseCrossfade(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "off" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "s"))
+	if err != nil || n < 0 || n > music.MaxCrossfadeSeconds {
+		return 0, fmt.Errorf("crossfade must be 0-%d seconds or off (got %q)", music.MaxCrossfadeSeconds, s)
+	}
+	return n, nil
+}
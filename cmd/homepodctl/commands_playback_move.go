@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// cmdMove hands playback off from one room to another: it swaps the AirPlay
+// outputs, carries the source room's volume over, and restores the playback
+// position in case the route change made Music.app jump.
+func cmdMove(ctx context.Context, cfg *native.Config, name string, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 2 {
+		die(usageErrf("usage: homepodctl %s <from-room> <to-room> [--volume 0-100] [--no-restore] [--strict] [--exact] [--json] [--plain] [--dry-run]", name))
+	}
+	noRestore, _, err := flags.boolStrict("no-restore")
+	if err != nil {
+		die(err)
+	}
+	strict, _, err := flags.boolStrict("strict")
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	volume, volumeSet, err := flags.intStrict("volume")
+	if err != nil {
+		die(err)
+	}
+	if volumeSet && (volume < 0 || volume > 100) {
+		die(usageErrf("volume must be 0-100"))
+	}
+	from := cfg.ExpandRooms(positionals[:1])
+	to := cfg.ExpandRooms(positionals[1:])
+	if len(from) == 0 || len(to) == 0 {
+		die(usageErrf("from-room and to-room must be non-empty"))
+	}
+	if from, err = resolveRooms(ctx, from, exact); err != nil {
+		die(err)
+	}
+	if to, err = resolveRooms(ctx, to, exact); err != nil {
+		die(err)
+	}
+
+	np, err := getNowPlaying(ctx)
+	if err != nil {
+		die(err)
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		die(err)
+	}
+	var current []string
+	sourceVolume := -1
+	sourceRoom := ""
+	for _, d := range devs {
+		if d.Selected {
+			current = append(current, d.Name)
+		}
+		if sourceVolume < 0 && containsFold(from, d.Name) {
+			sourceVolume = d.Volume
+			sourceRoom = d.Name
+		}
+	}
+	if sourceVolume < 0 {
+		die(usageErrf("unknown room %q (run `homepodctl devices` to list names)", positionals[0]))
+	}
+	if !volumeSet {
+		// Undo the source room's offset so the target's own offset applies cleanly.
+		volume = max(0, min(100, sourceVolume-cfg.VolumeOffset(sourceRoom)))
+	}
+	next := mergeOutputSelection(current, to, from)
+	debugf("%s: from=%v to=%v current=%v next=%v volume=%d position=%.1f", name, from, to, current, next, volume, np.PlayerPositionS)
+
+	if opts.DryRun {
+		writeActionOutput("move", opts.JSON, opts.Plain, actionOutput{
+			DryRun:   true,
+			Backend:  "airplay",
+			Rooms:    next,
+			Playlist: np.PlaylistName,
+		})
+		return
+	}
+	if err := setCurrentOutputs(ctx, next); err != nil {
+		die(err)
+	}
+	if err := setVolumeForRooms(ctx, cfg, to, volume, false); err != nil {
+		die(err)
+	}
+	if !noRestore && np.PlayerState != "stopped" && np.PlayerPositionS > 0 {
+		if err := setPlayerPosition(ctx, np.PlayerPositionS); err != nil {
+			die(err)
+		}
+	}
+	out := actionOutput{
+		Backend:  "airplay",
+		Rooms:    next,
+		Playlist: np.PlaylistName,
+	}
+	var verifyErr error
+	if after, err := getNowPlaying(ctx); err == nil {
+		out.Outputs, out.NowPlaying, verifyErr = verifyOutputs(ctx, next, &after, strict)
+	}
+	if verifyErr != nil {
+		die(verifyErr)
+	}
+	writeActionOutput("move", opts.JSON, opts.Plain, out)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(s)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// muteState remembers pre-mute volumes so unmute can restore them. It lives
+// in the state dir as mute.json.
+type muteState struct {
+	Rooms map[string]int `json:"rooms"` // device name -> volume before mute
+}
+
+func muteStatePath() (string, error) {
+	return adoptedStatePath("mute.json")
+}
+
+func loadMuteState() (*muteState, error) {
+	st := &muteState{Rooms: map[string]int{}}
+	path, err := muteStatePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, err
+	}
+	if st.Rooms == nil {
+		st.Rooms = map[string]int{}
+	}
+	return st, nil
+}
+
+func saveMuteState(st *muteState) error {
+	path, err := muteStatePath()
+	if err != nil {
+		return err
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func (st *muteState) lookup(room string) (string, int, bool) {
+	if v, ok := st.Rooms[room]; ok {
+		return room, v, true
+	}
+	for k, v := range st.Rooms {
+		if strings.EqualFold(k, strings.TrimSpace(room)) {
+			return k, v, true
+		}
+	}
+	return "", 0, false
+}
+
+func cmdMute(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	rooms := muteRooms(cfg, flags, positionals)
+	if len(rooms) == 0 {
+		rooms = cfg.ExpandRooms(cfg.Defaults.Rooms)
+	}
+	if len(rooms) == 0 {
+		rooms = inferSelectedOutputs(ctx)
+	}
+	if len(rooms) == 0 {
+		die(usageErrf("no rooms provided (pass room names, set defaults.rooms, or select outputs in Music.app)"))
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		die(err)
+	}
+	st, err := loadMuteState()
+	if err != nil {
+		die(err)
+	}
+	byName := map[string]music.AirPlayDevice{}
+	for _, d := range devs {
+		byName[strings.ToLower(strings.TrimSpace(d.Name))] = d
+	}
+	for i, room := range rooms {
+		name, err := music.ResolveRoom(room, devs, exact)
+		if err != nil {
+			die(err)
+		}
+		d := byName[strings.ToLower(strings.TrimSpace(name))]
+		rooms[i] = d.Name
+		// Muting twice must not overwrite the remembered level with 0.
+		if _, _, muted := st.lookup(d.Name); muted && d.Volume == 0 {
+			continue
+		}
+		st.Rooms[d.Name] = d.Volume
+	}
+	debugf("mute: rooms=%v remembered=%v", rooms, st.Rooms)
+	if opts.DryRun {
+		writeActionOutput("mute", opts.JSON, opts.Plain, actionOutput{DryRun: true, Backend: "airplay", Rooms: rooms})
+		return
+	}
+	// Save first so a failure half-way through still leaves levels to restore.
+	if err := saveMuteState(st); err != nil {
+		die(err)
+	}
+	for _, room := range rooms {
+		if err := setDeviceVolume(ctx, room, 0); err != nil {
+			die(err)
+		}
+	}
+	writeActionOutput("mute", opts.JSON, opts.Plain, actionOutput{Backend: "airplay", Rooms: rooms})
+}
+
+func cmdUnmute(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	st, err := loadMuteState()
+	if err != nil {
+		die(err)
+	}
+	rooms := muteRooms(cfg, flags, positionals)
+	if len(rooms) == 0 {
+		for room := range st.Rooms {
+			rooms = append(rooms, room)
+		}
+		sort.Strings(rooms)
+	}
+	restore := map[string]int{}
+	var restored []string
+	for _, room := range rooms {
+		key, v, ok := st.lookup(room)
+		if !ok {
+			debugf("unmute: no remembered volume for %q", room)
+			continue
+		}
+		restore[key] = v
+		restored = append(restored, key)
+	}
+	if len(restored) == 0 {
+		die(usageErrf("nothing to unmute (no remembered volumes; run `homepodctl mute` first)"))
+	}
+	debugf("unmute: restore=%v", restore)
+	if opts.DryRun {
+		writeActionOutput("unmute", opts.JSON, opts.Plain, actionOutput{DryRun: true, Backend: "airplay", Rooms: restored})
+		return
+	}
+	for _, room := range restored {
+		if err := setDeviceVolume(ctx, room, restore[room]); err != nil {
+			die(err)
+		}
+		delete(st.Rooms, room)
+	}
+	if err := saveMuteState(st); err != nil {
+		die(err)
+	}
+	writeActionOutput("unmute", opts.JSON, opts.Plain, actionOutput{Backend: "airplay", Rooms: restored})
+}
+
+func muteRooms(cfg *native.Config, flags parsedArgs, positionals []string) []string {
+	rooms := append([]string(nil), flags.strings("room")...)
+	if len(rooms) == 0 {
+		rooms = append(rooms, positionals...)
+	}
+	return cfg.ExpandRooms(rooms)
+}
@@ -2,48 +2,36 @@ package main
 
 import (
 	"context"
-	"flag"
-	"os"
 	"strings"
 
-	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
 
 func cmdOut(ctx context.Context, cfg *native.Config, args []string) {
 	if len(args) < 1 {
-		die(usageErrf("usage: homepodctl out <list|set> [args]"))
+		die(usageErrf("usage: homepodctl out <list|set|add|remove> [args]"))
 	}
 	switch args[0] {
 	case "list":
-		fs := flag.NewFlagSet("out list", flag.ContinueOnError)
-		fs.SetOutput(os.Stderr)
-		jsonOut := fs.Bool("json", false, "output JSON")
-		includeNetwork := fs.Bool("include-network", false, "include network address (MAC) in JSON output")
-		plain := fs.Bool("plain", false, "plain (no header) output")
-		if err := fs.Parse(args[1:]); err != nil {
-			exitCode(exitUsage)
-		}
-		devs, err := music.ListAirPlayDevices(ctx)
+		cmdDeviceList(ctx, "out list", args[1:])
+	case "set":
+		flags, positionals, err := parseArgs(args[1:])
 		if err != nil {
 			die(err)
 		}
-		if *jsonOut {
-			if !*includeNetwork {
-				for i := range devs {
-					devs[i].NetworkAddress = ""
-				}
-			}
-			writeJSON(devs)
-			return
+		opts, err := parseOutputOptions(flags)
+		if err != nil {
+			die(err)
 		}
-		printDevicesTable(os.Stdout, devs, *plain)
-	case "set":
-		flags, positionals, err := parseArgs(args[1:])
+		strict, _, err := flags.boolStrict("strict")
 		if err != nil {
 			die(err)
 		}
-		opts, err := parseOutputOptions(flags)
+		exact, _, err := flags.boolStrict("exact")
+		if err != nil {
+			die(err)
+		}
+		onlyKind, err := parseDeviceKind(flags, "only-kind")
 		if err != nil {
 			die(err)
 		}
@@ -61,9 +49,13 @@ func cmdOut(ctx context.Context, cfg *native.Config, args []string) {
 		if len(rooms) == 0 {
 			rooms = append(rooms, cfg.Defaults.Rooms...)
 		}
+		rooms = cfg.ExpandRooms(rooms)
 		if len(rooms) == 0 {
 			die(usageErrf("no rooms provided (usage: homepodctl out set --room <name> [--room <name> ...]; tip: run `homepodctl devices` to list names)"))
 		}
+		if rooms, err = resolveOutputRooms(ctx, rooms, exact, onlyKind); err != nil {
+			die(err)
+		}
 		debugf("out set: backend=%s rooms=%v", backend, rooms)
 		if opts.DryRun {
 			writeActionOutput("out.set", opts.JSON, opts.Plain, actionOutput{
@@ -76,19 +68,123 @@ func cmdOut(ctx context.Context, cfg *native.Config, args []string) {
 		if err := setCurrentOutputs(ctx, rooms); err != nil {
 			die(err)
 		}
-		if np, err := getNowPlaying(ctx); err == nil {
-			writeActionOutput("out.set", opts.JSON, opts.Plain, actionOutput{
-				Backend:    backend,
-				Rooms:      rooms,
-				NowPlaying: &np,
-			})
-		} else {
-			writeActionOutput("out.set", opts.JSON, opts.Plain, actionOutput{
-				Backend: backend,
-				Rooms:   rooms,
-			})
-		}
+		writeOutSelection(ctx, "out.set", opts, rooms, strict)
+	case "add", "remove":
+		cmdOutDelta(ctx, cfg, args[0], args[1:])
 	default:
-		die(usageErrf("usage: homepodctl out <list|set> [args]"))
+		die(usageErrf("usage: homepodctl out <list|set|add|remove> [args]"))
+	}
+}
+
+func cmdOutDelta(ctx context.Context, cfg *native.Config, op string, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	strict, _, err := flags.boolStrict("strict")
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	rooms := append([]string(nil), flags.strings("room")...)
+	if len(rooms) == 0 {
+		rooms = append(rooms, positionals...)
+	}
+	rooms = cfg.ExpandRooms(rooms)
+	if len(rooms) == 0 {
+		die(usageErrf("no rooms provided (usage: homepodctl out %s --room <name> [--room <name> ...])", op))
+	}
+	changeOutputs(ctx, "out."+op, op == "add", rooms, opts, strict, exact)
+}
+
+// changeOutputs adds rooms to Music.app's current outputs, or removes them,
+// leaving the other selected rooms playing, and writes the result as action.
+func changeOutputs(ctx context.Context, action string, add bool, rooms []string, opts outputOptions, strict, exact bool) {
+	var err error
+	if add {
+		rooms, err = resolveOutputRooms(ctx, rooms, exact, "")
+	} else {
+		rooms, err = resolveRooms(ctx, rooms, exact)
+	}
+	if err != nil {
+		die(err)
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		die(err)
+	}
+	var current []string
+	for _, d := range devs {
+		if d.Selected {
+			current = append(current, d.Name)
+		}
+	}
+	var next []string
+	if add {
+		next = mergeOutputSelection(current, rooms, nil)
+	} else {
+		next = mergeOutputSelection(current, nil, rooms)
+		if len(next) == 0 {
+			if action != "out.remove" {
+				die(usageErrf("%s --room would silence every selected output (run `homepodctl %s` without --room instead)", action, action))
+			}
+			die(usageErrf("cannot remove every selected output (use `homepodctl out set` to switch rooms or `homepodctl stop` to stop playback)"))
+		}
+	}
+	debugf("%s: current=%v rooms=%v next=%v", action, current, rooms, next)
+	if opts.DryRun {
+		writeActionOutput(action, opts.JSON, opts.Plain, actionOutput{
+			DryRun:  true,
+			Backend: "airplay",
+			Rooms:   next,
+		})
+		return
+	}
+	if err := setCurrentOutputs(ctx, next); err != nil {
+		die(err)
+	}
+	writeOutSelection(ctx, action, opts, next, strict)
+}
+
+// mergeOutputSelection applies add/remove deltas to the current output set,
+// preserving the current order and matching room names case-insensitively.
+func mergeOutputSelection(current, add, remove []string) []string {
+	removed := map[string]bool{}
+	for _, r := range remove {
+		removed[strings.ToLower(strings.TrimSpace(r))] = true
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, r := range append(append([]string(nil), current...), add...) {
+		r = strings.TrimSpace(r)
+		key := strings.ToLower(r)
+		if r == "" || seen[key] || removed[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, r)
+	}
+	return out
+}
+
+// writeOutSelection reads back the outputs after an out set/add/remove,
+// verifies rooms joined, and writes the result. A --strict failure is
+// reported as the error alone, never after an ok result.
+func writeOutSelection(ctx context.Context, action string, opts outputOptions, rooms []string, strict bool) {
+	out := actionOutput{Backend: "airplay", Rooms: rooms}
+	if np, err := getNowPlaying(ctx); err == nil {
+		statuses, after, err := verifyOutputs(ctx, rooms, &np, strict)
+		if err != nil {
+			die(err)
+		}
+		out.Outputs, out.NowPlaying = statuses, after
 	}
+	writeActionOutput(action, opts.JSON, opts.Plain, out)
 }
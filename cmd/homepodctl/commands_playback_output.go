@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +14,42 @@ import (
 	"github.com/agisilaos/homepodctl/internal/native"
 )
 
+// verifyOutputs checks that every room joined after an AirPlay selection,
+// given the outputs Music.app reported afterwards in np. Rooms that did not
+// join are selected again, with read-back and the retry policy. A selection
+// that stays incomplete is a warning, or an error under strict; either way
+// the per-room statuses are returned along with the freshest now playing.
+func verifyOutputs(ctx context.Context, rooms []string, np *music.NowPlaying, strict bool) ([]music.OutputStatus, *music.NowPlaying, error) {
+	if len(rooms) == 0 || np == nil {
+		return nil, np, nil
+	}
+	statuses, err := music.CheckAirPlaySelection(rooms, np.Outputs)
+	if err == nil {
+		return statuses, np, nil
+	}
+	debugf("outputs: %v; selecting again", err)
+	statuses, err = selectOutputs(ctx, rooms)
+	if after, npErr := getNowPlaying(ctx); npErr == nil {
+		np = &after
+		if err == nil {
+			statuses, _ = music.CheckAirPlaySelection(rooms, after.Outputs)
+		}
+	}
+	if err == nil {
+		return statuses, np, nil
+	}
+	if strict {
+		return statuses, np, err
+	}
+	var partial *music.PartialSelectionError
+	if !errors.As(err, &partial) {
+		debugf("outputs: verification failed: %v", err)
+		return statuses, np, nil
+	}
+	fmt.Fprintf(os.Stderr, "warning: %v (use --strict to fail)\n", err)
+	return statuses, np, nil
+}
+
 func printNowPlaying(np music.NowPlaying) {
 	pos := formatClock(np.PlayerPositionS)
 	dur := ""
@@ -67,19 +105,37 @@ func formatClock(seconds float64) string {
 	return fmt.Sprintf("%d:%02d", m, sec)
 }
 
-func choosePlaylist(matches []music.UserPlaylist, allowPrompt bool) (music.UserPlaylist, error) {
+// choosePlaylist asks which of several matches to play. With yes set it
+// takes the best match for query instead of prompting.
+func choosePlaylist(query string, matches []music.UserPlaylist, allowPrompt, yes bool) (music.UserPlaylist, error) {
 	if len(matches) == 1 {
 		return matches[0], nil
 	}
+	if yes {
+		best, ok := music.PickBestPlaylist(query, matches)
+		if !ok {
+			return music.UserPlaylist{}, fmt.Errorf("no playlists match %q", query)
+		}
+		return best, nil
+	}
 	if !allowPrompt {
 		return music.UserPlaylist{}, usageErrf("multiple playlists match; non-interactive mode cannot prompt (use --playlist-id or remove --no-input)")
 	}
 	if !isInteractiveStdin() {
 		return music.UserPlaylist{}, usageErrf("multiple playlists match; --choose requires interactive stdin (use --playlist-id or omit --choose)")
 	}
+	if isInteractiveStderr() && os.Getenv("TERM") != "dumb" {
+		if p, err := pickPlaylist(matches); !errors.Is(err, errRawMode) {
+			return p, err
+		}
+	}
 	fmt.Fprintln(os.Stderr, "Multiple playlists match. Choose one:")
 	for i, p := range matches {
-		fmt.Fprintf(os.Stderr, "  %d) %s\t%s\n", i+1, p.PersistentID, p.Name)
+		line := fmt.Sprintf("  %d) %s\t%s", i+1, p.PersistentID, p.Name)
+		if badge := playlistBadge(p); badge != "" {
+			line += " " + badge
+		}
+		fmt.Fprintln(os.Stderr, line)
 	}
 	fmt.Fprint(os.Stderr, "Enter number: ")
 	var n int
@@ -92,8 +148,36 @@ func choosePlaylist(matches []music.UserPlaylist, allowPrompt bool) (music.UserP
 	return matches[n-1], nil
 }
 
+// pickPlaylist runs the fuzzy picker on the terminal. It returns errRawMode
+// when the terminal cannot switch to raw input.
+func pickPlaylist(matches []music.UserPlaylist) (music.UserPlaylist, error) {
+	restore, err := enterRawMode()
+	if err != nil {
+		debugf("picker: %v", err)
+		return music.UserPlaylist{}, errRawMode
+	}
+	defer restore()
+	items := make([]pickerItem, 0, len(matches))
+	for _, p := range matches {
+		items = append(items, pickerItem{label: p.Name, badge: strings.TrimSpace(playlistBadge(p) + " " + p.PersistentID)})
+	}
+	i, err := runPicker(os.Stdin, os.Stderr, "Multiple playlists match ", items)
+	if err != nil {
+		return music.UserPlaylist{}, err
+	}
+	return matches[i], nil
+}
+
 func isInteractiveStdin() bool {
-	info, err := os.Stdin.Stat()
+	return isTerminal(os.Stdin)
+}
+
+func isInteractiveStderr() bool {
+	return isTerminal(os.Stderr)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
 	if err != nil {
 		return false
 	}
@@ -144,9 +228,15 @@ func buildAliasRows(cfg *native.Config) []aliasRow {
 		if target == "" {
 			target = a.PlaylistID
 		}
+		if a.Station != "" {
+			target = "station:" + a.Station
+		}
 		if a.Shortcut != "" {
 			target = "shortcut:" + a.Shortcut
 		}
+		if len(a.Sequence) > 0 {
+			target = "sequence:" + strings.Join(a.Sequence, ",")
+		}
 		rows = append(rows, aliasRow{
 			Name:    name,
 			Backend: backend,
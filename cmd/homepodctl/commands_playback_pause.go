@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// cmdResume is resume: without --room it resumes playback; with --room it
+// adds the rooms back to the current outputs, undoing pause --room.
+func cmdResume(ctx context.Context, cfg *native.Config, args []string) {
+	flags, _, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	app, err := parseApp(flags)
+	if err != nil {
+		die(err)
+	}
+	if len(flags.strings("room")) == 0 || app != appMusic {
+		cmdTransport(ctx, args, "resume", music.Play)
+		return
+	}
+	cmdRoomTransport(ctx, cfg, args, "resume")
+}
+
+// cmdDeviceTransport runs pause/stop through Music.app, or for some rooms
+// only with --room.
+func cmdDeviceTransport(ctx context.Context, cfg *native.Config, args []string, action string, fn func(context.Context) error) {
+	flags, _, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if app, err := parseApp(flags); err != nil {
+		die(err)
+	} else if app != appMusic {
+		cmdTransport(ctx, args, action, fn)
+		return
+	}
+	if len(flags.strings("room")) > 0 {
+		cmdRoomTransport(ctx, cfg, args, action)
+		return
+	}
+	cmdTransport(ctx, args, action, fn)
+}
+
+// cmdRoomTransport is pause|stop|resume --room over AirPlay. Music.app plays
+// one stream to every selected output, so silencing a room means removing it
+// from the outputs while the other rooms keep playing; resume adds it back.
+func cmdRoomTransport(ctx context.Context, cfg *native.Config, args []string, action string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl %s --room <name> [--room <name> ...] [--strict] [--exact] [--json] [--plain] [--dry-run]", action))
+	}
+	backend := strings.TrimSpace(flags.string("backend"))
+	if backend == "" {
+		backend = cfg.Defaults.Backend
+	}
+	if backend != "" && backend != "airplay" {
+		die(usageErrf("%s --room changes AirPlay outputs and needs backend=airplay (got %q)", action, backend))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	strict, _, err := flags.boolStrict("strict")
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	rooms := cfg.ExpandRooms(flags.strings("room"))
+	if len(rooms) == 0 {
+		die(usageErrf("%s --room needs a room name", action))
+	}
+	changeOutputs(ctx, action, action == "resume", rooms, opts, strict, exact)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/agisilaos/homepodctl/internal/catalog"
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
@@ -19,6 +20,12 @@ func cmdPlay(ctx context.Context, cfg *native.Config, args []string) {
 	if err != nil {
 		die(err)
 	}
+	if app, err := parseApp(flags); err != nil {
+		die(err)
+	} else if app == appSpotify {
+		cmdPlaySpotify(ctx, flags, positionals, opts)
+		return
+	}
 
 	backend := strings.TrimSpace(flags.string("backend"))
 	if backend == "" {
@@ -28,6 +35,7 @@ func cmdPlay(ctx context.Context, cfg *native.Config, args []string) {
 	if len(rooms) == 0 {
 		rooms = append(rooms, cfg.Defaults.Rooms...)
 	}
+	rooms = cfg.ExpandRooms(rooms)
 
 	volume := -1
 	volumeExplicit := false
@@ -55,6 +63,31 @@ func cmdPlay(ctx context.Context, cfg *native.Config, args []string) {
 	if err != nil {
 		die(err)
 	}
+	strict, _, err := flags.boolStrict("strict")
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	force, _, err := flags.boolStrict("force")
+	if err != nil {
+		die(err)
+	}
+	synchronized, _, err := flags.boolStrict("synchronized")
+	if err != nil {
+		die(err)
+	}
+	start, err := parsePlaylistStart(flags)
+	if err != nil {
+		die(err)
+	}
+
+	pin := strings.TrimSpace(flags.string("pin"))
+	if flags.has("pin") && pin == "" {
+		die(usageErrf("--pin needs an alias name"))
+	}
 
 	playlistID := strings.TrimSpace(flags.string("playlist-id"))
 	playlistName := strings.TrimSpace(flags.string("playlist"))
@@ -62,27 +95,73 @@ func cmdPlay(ctx context.Context, cfg *native.Config, args []string) {
 	if query == "" && playlistID == "" && len(positionals) > 0 {
 		query = strings.Join(positionals, " ")
 	}
+	catalogQuery := strings.TrimSpace(flags.string("catalog"))
+	if flags.has("catalog") {
+		switch {
+		case catalogQuery == "":
+			die(usageErrf(`--catalog needs a query, e.g. --catalog "artist:Khruangbin"`))
+		case query != "" || playlistID != "":
+			die(usageErrf("--catalog replaces the playlist query; pass one or the other"))
+		case choose:
+			die(usageErrf("--choose picks among library playlists; --catalog plays the best catalog match"))
+		case backend != "airplay":
+			die(usageErrf("--catalog needs backend=airplay"))
+		}
+	}
 
 	switch backend {
 	case "airplay":
 		if len(rooms) == 0 {
 			rooms = inferSelectedOutputs(ctx)
+		} else if rooms, err = resolveOutputRooms(ctx, rooms, exact, ""); err != nil {
+			die(err)
 		}
-		if opts.DryRun {
+		quietHours, err := checkQuietPlay(cfg, rooms, force)
+		if err != nil {
+			die(err)
+		}
+		var catalogItem *catalog.Item
+		if catalogQuery != "" {
+			client, err := catalogClient(cfg)
+			if err != nil {
+				die(err)
+			}
+			item, err := findCatalogItem(ctx, client, catalogQuery)
+			if err != nil {
+				die(err)
+			}
+			catalogItem, query = &item, catalogPlaylistName(item)
+			if !opts.JSON && !quiet {
+				fmt.Fprintf(os.Stderr, "catalog: %s %q (%s)\n", item.Kind, item.Name, item.ID)
+			}
+			// A dry run leaves the library alone; the playlist may not
+			// exist yet.
+			if !opts.DryRun {
+				if playlistID, err = catalogLibraryPlaylist(ctx, client, item); err != nil {
+					die(err)
+				}
+			}
+		}
+		// A dry run with --pin still resolves the playlist, to show what
+		// would be pinned.
+		if opts.DryRun && (pin == "" || catalogItem != nil) {
 			if strings.TrimSpace(query) == "" && strings.TrimSpace(playlistID) == "" {
 				die(usageErrf("playlist is required (pass <playlist-query>, --playlist, or --playlist-id)"))
 			}
 			writeActionOutput("play", opts.JSON, opts.Plain, actionOutput{
-				DryRun:     true,
-				Backend:    backend,
-				Rooms:      rooms,
-				Playlist:   query,
-				PlaylistID: playlistID,
+				DryRun:       true,
+				Backend:      backend,
+				Rooms:        rooms,
+				QuietHours:   quietHours,
+				Synchronized: synchronized,
+				Playlist:     query,
+				PlaylistID:   playlistID,
+				Catalog:      catalogItem,
 			})
 			return
 		}
 
-		id := playlistID
+		id, picked := playlistID, ""
 		if id == "" {
 			if strings.TrimSpace(query) == "" {
 				die(usageErrf("playlist is required (pass <playlist-query>, --playlist, or --playlist-id)"))
@@ -95,63 +174,133 @@ func cmdPlay(ctx context.Context, cfg *native.Config, args []string) {
 				die(fmt.Errorf("no playlists match %q (tip: run `homepodctl playlists --query %q`)", query, query))
 			}
 			if choose {
-				selected, err := choosePlaylist(matches, !noInput)
+				selected, err := choosePlaylist(query, matches, !noInput, opts.Yes)
 				if err != nil {
 					die(err)
 				}
-				id = selected.PersistentID
-				if len(matches) > 1 {
-					fmt.Fprintf(os.Stderr, "picked %q (%s)\n", selected.Name, selected.PersistentID)
+				id, picked = selected.PersistentID, selected.Name
+				if len(matches) > 1 && pin == "" {
+					fmt.Fprintf(os.Stderr, "picked %q (%s) (use --pin <alias> to keep it)\n", selected.Name, selected.PersistentID)
 				}
 			} else {
 				best, ok := music.PickBestPlaylist(query, matches)
 				if !ok {
 					die(fmt.Errorf("no playlists match %q", query))
 				}
-				id = best.PersistentID
-				if len(matches) > 1 {
-					fmt.Fprintf(os.Stderr, "picked %q (%s) (use --choose to select)\n", best.Name, best.PersistentID)
+				id, picked = best.PersistentID, best.Name
+				if len(matches) > 1 && pin == "" {
+					fmt.Fprintf(os.Stderr, "picked %q (%s) (use --choose to select, --pin <alias> to keep it)\n", best.Name, best.PersistentID)
 				}
 			}
 		}
-		debugf("play: backend=airplay rooms=%v playlist_id=%q query=%q shuffle=%t volume=%d explicit_volume=%t choose=%t", rooms, id, query, shuffle, volume, volumeExplicit, choose)
-
-		// If we have rooms, select outputs first. If we don't, keep Music.app's current outputs.
-		if len(rooms) > 0 {
-			if err := setCurrentOutputs(ctx, rooms); err != nil {
+		// The pin is checked before playing and only saved once playback
+		// started.
+		pinned, err := preparePlaylistPin(pin, id, picked, flags)
+		if err != nil {
+			die(err)
+		}
+		if opts.DryRun {
+			if !opts.JSON && !quiet {
+				fmt.Fprintf(os.Stderr, "dry-run: would pin %s to %s %q\n", pinned.describe(), pinned.kind(), pin)
+			}
+			writeActionOutput("play", opts.JSON, opts.Plain, actionOutput{
+				DryRun:       true,
+				Backend:      backend,
+				Rooms:        rooms,
+				QuietHours:   quietHours,
+				Synchronized: synchronized,
+				Playlist:     query,
+				PlaylistID:   id,
+				Pinned:       pin,
+			})
+			return
+		}
+		var startTrack *music.PlaylistTrack
+		var seek float64
+		if start.isSet() {
+			t, pos, err := start.resolve(ctx, id)
+			if err != nil {
 				die(err)
 			}
+			startTrack, seek = &t, pos
 		}
+		debugf("play: backend=airplay rooms=%v playlist_id=%q query=%q shuffle=%t volume=%d explicit_volume=%t choose=%t start=%+v synchronized=%t", rooms, id, query, shuffle, volume, volumeExplicit, choose, start, synchronized)
+
 		if err := validateAirplayVolumeSelection(volumeExplicit, volume, rooms); err != nil {
 			die(err)
 		}
-		if volume >= 0 && len(rooms) > 0 {
-			if err := setVolumeForRooms(ctx, rooms, volume); err != nil {
+		// One osascript run for the whole flow. With no rooms, SetOutputs keeps
+		// Music.app's current outputs.
+		batch := music.NewBatch().SetOutputs(rooms)
+		if volume >= 0 {
+			for _, room := range rooms {
+				v := cfg.AdjustVolume(room, volume)
+				if !force {
+					v = capVolume(cfg, room, v)
+				}
+				debugf("volume: room=%q requested=%d applied=%d", room, volume, v)
+				batch.SetVolume(room, v)
+			}
+		} else {
+			cuts, err := quietVolumeCuts(ctx, cfg, rooms, force)
+			if err != nil {
 				die(err)
 			}
+			for _, c := range cuts {
+				batch.SetVolume(c.Room, c.Value)
+			}
 		}
-		if err := setShuffle(ctx, shuffle); err != nil {
-			die(err)
+		batch.SetShuffle(shuffle)
+		startPlaylist := func(b *music.Batch) {
+			if startTrack != nil {
+				b.PlayPlaylistTrack(id, startTrack.Index)
+			} else {
+				b.PlayPlaylist(id)
+			}
 		}
-		if err := playPlaylistByID(ctx, id); err != nil {
+		var res music.BatchResult
+		if synchronized {
+			debugf("play: setup=%q", batch.Ops())
+			res, err = syncPlay(ctx, rooms, batch, startPlaylist, seek)
+		} else {
+			startPlaylist(batch)
+			if seek > 0 {
+				batch.Seek(seek)
+			}
+			batch.NowPlaying()
+			debugf("play: batch=%q", batch.Ops())
+			res, err = runMusicBatch(ctx, batch)
+		}
+		if err != nil {
 			die(err)
 		}
-		if np, err := getNowPlaying(ctx); err == nil {
-			writeActionOutput("play", opts.JSON, opts.Plain, actionOutput{
-				Backend:    backend,
-				Rooms:      rooms,
-				Playlist:   query,
-				PlaylistID: id,
-				NowPlaying: &np,
-			})
-		} else {
-			writeActionOutput("play", opts.JSON, opts.Plain, actionOutput{
-				Backend:    backend,
-				Rooms:      rooms,
-				Playlist:   query,
-				PlaylistID: id,
-			})
+		if pinned != nil {
+			if err := saveConfig(pinned.cfg); err != nil {
+				die(err)
+			}
+			if !opts.JSON && !quiet {
+				fmt.Fprintf(os.Stderr, "pinned %s to %s %q (homepodctl run %s)\n", pinned.describe(), pinned.kind(), pin, pin)
+			}
 		}
+		statuses, np, verifyErr := verifyOutputs(ctx, rooms, res.NowPlaying, strict)
+		// Under --strict a missing room fails the command before anything
+		// reports it as ok.
+		if verifyErr != nil {
+			die(verifyErr)
+		}
+		writeActionOutput("play", opts.JSON, opts.Plain, actionOutput{
+			Backend:      backend,
+			Rooms:        rooms,
+			QuietHours:   quietHours,
+			Synchronized: synchronized,
+			Playlist:     query,
+			PlaylistID:   id,
+			Catalog:      catalogItem,
+			StartTrack:   startTrack,
+			Outputs:      statuses,
+			NowPlaying:   np,
+			Pinned:       pin,
+		})
 	case "native":
 		if len(rooms) == 0 {
 			die(usageErrf("no rooms provided (pass --room <name> ... or set defaults.rooms via `homepodctl config-init`)"))
@@ -159,16 +308,30 @@ func cmdPlay(ctx context.Context, cfg *native.Config, args []string) {
 		if strings.TrimSpace(query) == "" && playlistID == "" {
 			die(usageErrf("playlist is required (pass <playlist-query>, --playlist, or --playlist-id)"))
 		}
+		if start.isSet() {
+			die(usageErrf("--track, --track-index, and --resume need backend=airplay"))
+		}
+		if pin != "" {
+			die(usageErrf("--pin needs backend=airplay (it stores the playlist's persistent ID)"))
+		}
+		if synchronized {
+			die(usageErrf("--synchronized needs backend=airplay"))
+		}
+		quietHours, err := checkQuietPlay(cfg, rooms, force)
+		if err != nil {
+			die(err)
+		}
 		if opts.DryRun {
 			name := strings.TrimSpace(query)
 			if name == "" {
 				name = playlistID
 			}
 			writeActionOutput("play", opts.JSON, opts.Plain, actionOutput{
-				DryRun:   true,
-				Backend:  backend,
-				Rooms:    rooms,
-				Playlist: name,
+				DryRun:     true,
+				Backend:    backend,
+				Rooms:      rooms,
+				QuietHours: quietHours,
+				Playlist:   name,
 			})
 			return
 		}
@@ -185,11 +348,159 @@ func cmdPlay(ctx context.Context, cfg *native.Config, args []string) {
 			die(fmt.Errorf("%w (edit config)", err))
 		}
 		writeActionOutput("play", opts.JSON, opts.Plain, actionOutput{
-			Backend:  backend,
-			Rooms:    rooms,
-			Playlist: name,
+			Backend:    backend,
+			Rooms:      rooms,
+			QuietHours: quietHours,
+			Playlist:   name,
 		})
 	default:
-		die(usageErrf("unknown backend: %q", backend))
+		die(backendError(backend))
+	}
+}
+
+// playlistPin is the config play --pin saves: alias name pointing at the
+// playlist play picked.
+type playlistPin struct {
+	cfg     *native.Config
+	id      string
+	name    string
+	created bool
+}
+
+// preparePlaylistPin points alias pin at playlist id (named name when play
+// searched for it). A new alias also takes play's --room, --volume, and
+// --shuffle. It returns nil when pin is empty.
+func preparePlaylistPin(pin, id, name string, flags parsedArgs) (*playlistPin, error) {
+	if pin == "" {
+		return nil, nil
+	}
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Aliases == nil {
+		cfg.Aliases = map[string]native.Alias{}
+	}
+	a, exists := cfg.Aliases[pin]
+	if exists {
+		if a.Shortcut != "" || len(a.Sequence) > 0 || a.Backend == "native" {
+			return nil, usageErrf("alias %q does not play a playlist over AirPlay; pick another --pin name", pin)
+		}
+	} else {
+		a = native.Alias{Backend: "airplay"}
+		for _, room := range flags.strings("room") {
+			if room = strings.TrimSpace(room); room != "" {
+				a.Rooms = append(a.Rooms, room)
+			}
+		}
+		if v, ok, _ := flags.intStrict("volume"); ok {
+			a.Volume = &v
+		}
+		if v, ok, _ := flags.boolStrict("shuffle"); ok {
+			a.Shuffle = &v
+		}
+	}
+	a.PlaylistID = id
+	if name != "" {
+		a.Playlist = name
+	}
+	cfg.Aliases[pin] = a
+	if issues := validateConfigValues(cfg); len(issues) > 0 {
+		return nil, usageErrf("pinning alias %q makes the config invalid: %s", pin, strings.Join(issues, "; "))
+	}
+	return &playlistPin{cfg: cfg, id: id, name: name, created: !exists}, nil
+}
+
+func (p *playlistPin) kind() string {
+	if p.created {
+		return "new alias"
+	}
+	return "alias"
+}
+
+func (p *playlistPin) describe() string {
+	if p.name == "" {
+		return p.id
+	}
+	return fmt.Sprintf("%q (%s)", p.name, p.id)
+}
+
+// playlistStart is where play starts a playlist: at a track matched by name,
+// at a 1-based index, or where it was last played. The zero value starts at
+// the top.
+type playlistStart struct {
+	track  string
+	index  int
+	resume bool
+}
+
+func parsePlaylistStart(flags parsedArgs) (playlistStart, error) {
+	var s playlistStart
+	s.track = strings.TrimSpace(flags.string("track"))
+	if n, ok, err := flags.intStrict("track-index"); err != nil {
+		return s, err
+	} else if ok {
+		if n < 1 {
+			return s, usageErrf("--track-index must be 1 or more")
+		}
+		s.index = n
+	}
+	resume, _, err := flags.boolStrict("resume")
+	if err != nil {
+		return s, err
+	}
+	s.resume = resume
+	set := 0
+	for _, on := range []bool{s.track != "", s.index > 0, s.resume} {
+		if on {
+			set++
+		}
+	}
+	if set > 1 {
+		return s, usageErrf("--track, --track-index, and --resume are mutually exclusive")
+	}
+	return s, nil
+}
+
+func (s playlistStart) isSet() bool {
+	return s.track != "" || s.index > 0 || s.resume
+}
+
+// resolve returns the track of playlist id to start at and the position to
+// seek to within it.
+func (s playlistStart) resolve(ctx context.Context, id string) (music.PlaylistTrack, float64, error) {
+	tracks, err := music.GetPlaylistTracks(ctx, id)
+	if err != nil {
+		return music.PlaylistTrack{}, 0, err
+	}
+	if len(tracks) == 0 {
+		return music.PlaylistTrack{}, 0, fmt.Errorf("playlist %s has no tracks", id)
+	}
+	switch {
+	case s.track != "":
+		t, ok := music.FindPlaylistTrack(tracks, s.track)
+		if !ok {
+			return music.PlaylistTrack{}, 0, fmt.Errorf("no track in the playlist matches %q", s.track)
+		}
+		return t, 0, nil
+	case s.index > 0:
+		if s.index > len(tracks) {
+			return music.PlaylistTrack{}, 0, usageErrf("--track-index %d is past the end of the playlist (%d tracks)", s.index, len(tracks))
+		}
+		return tracks[s.index-1], 0, nil
+	default:
+		t, ok := music.LastPlayedTrack(tracks)
+		if !ok {
+			return tracks[0], 0, nil
+		}
+		if t.BookmarkS > 0 {
+			return t, t.BookmarkS, nil
+		}
+		// Music.app sets the played date when a track finishes, so without a
+		// saved position the next track is where listening stopped.
+		if t.Index < len(tracks) {
+			return tracks[t.Index], 0, nil
+		}
+		return tracks[0], 0, nil
 	}
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// quietHoursNotice is one set of quiet hours in effect for some of the rooms
+// a command targets, as play, run, volume, and plans report it.
+type quietHoursNotice struct {
+	Name      string   `json:"name"`
+	Window    string   `json:"window"`
+	Rooms     []string `json:"rooms"`
+	MaxVolume *int     `json:"maxVolume,omitempty"`
+	Play      string   `json:"play"`
+}
+
+// volumeLimit is room's volume cap right now: maxVolume, lowered by any
+// active quiet hours. quiet names the quiet hours that set it.
+func volumeLimit(cfg *native.Config, room string) (limit int, quiet string, ok bool) {
+	return cfg.MaxVolumeAt(room, timeNow())
+}
+
+// limitLabel describes a cap from volumeLimit for warnings and errors.
+func limitLabel(limit int, quiet string) string {
+	if quiet == "" {
+		return fmt.Sprintf("maxVolume %d", limit)
+	}
+	return fmt.Sprintf("maxVolume %d (quiet hours %s)", limit, quiet)
+}
+
+// activeQuietHours lists the quiet hours in effect for rooms, one notice per
+// set of quiet hours, sorted by name.
+func activeQuietHours(cfg *native.Config, rooms []string) []quietHoursNotice {
+	if cfg == nil || len(cfg.QuietHours) == 0 {
+		return nil
+	}
+	t := timeNow()
+	byName := map[string]*quietHoursNotice{}
+	var names []string
+	for _, room := range rooms {
+		for _, name := range cfg.ActiveQuietHours(room, t) {
+			n, ok := byName[name]
+			if !ok {
+				q := cfg.QuietHours[name]
+				n = &quietHoursNotice{Name: name, Window: q.Window(), MaxVolume: q.MaxVolume, Play: quietPlayMode(q)}
+				byName[name] = n
+				names = append(names, name)
+			}
+			n.Rooms = append(n.Rooms, room)
+		}
+	}
+	sort.Strings(names)
+	out := make([]quietHoursNotice, 0, len(names))
+	for _, name := range names {
+		out = append(out, *byName[name])
+	}
+	return out
+}
+
+// checkQuietPlay is the quiet-hours check before play starts in rooms: it
+// fails when quiet hours there block play (unless force) and otherwise warns
+// on stderr. It returns the quiet hours in effect for the command's output.
+func checkQuietPlay(cfg *native.Config, rooms []string, force bool) ([]quietHoursNotice, error) {
+	notices := activeQuietHours(cfg, rooms)
+	for _, n := range notices {
+		if n.Play == "block" && !force {
+			return nil, fmt.Errorf("quiet hours %s (%s) block play in %s (use --force to play anyway)", n.Name, n.Window, strings.Join(n.Rooms, ", "))
+		}
+	}
+	if quiet {
+		return notices, nil
+	}
+	for _, n := range notices {
+		msg := fmt.Sprintf("warning: quiet hours %s (%s) in %s", n.Name, n.Window, strings.Join(n.Rooms, ", "))
+		if n.MaxVolume != nil && !force {
+			msg += fmt.Sprintf("; volume capped at %d", *n.MaxVolume)
+		}
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	return notices, nil
+}
+
+// quietVolumeCuts lists the rooms in quiet hours whose current volume is
+// above their cap, with the cap as the new level. checkQuietPlay only caps
+// volumes a command sets; without this, play would resume at a daytime level.
+func quietVolumeCuts(ctx context.Context, cfg *native.Config, rooms []string, force bool) ([]volumeTarget, error) {
+	if force || len(activeQuietHours(cfg, rooms)) == 0 {
+		return nil, nil
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var cuts []volumeTarget
+	for _, room := range rooms {
+		if len(cfg.ActiveQuietHours(room, timeNow())) == 0 {
+			continue
+		}
+		limit, _, ok := volumeLimit(cfg, room)
+		if !ok {
+			continue
+		}
+		for _, d := range devs {
+			if strings.EqualFold(d.Name, room) && d.Volume > limit {
+				debugf("quiet hours: room=%q volume=%d lowered=%d", d.Name, d.Volume, limit)
+				cuts = append(cuts, volumeTarget{Room: d.Name, Value: limit})
+			}
+		}
+	}
+	return cuts, nil
+}
+
+// lowerQuietVolumes applies quietVolumeCuts, for flows that set outputs one
+// call at a time rather than in a batch.
+func lowerQuietVolumes(ctx context.Context, cfg *native.Config, rooms []string, force bool) error {
+	cuts, err := quietVolumeCuts(ctx, cfg, rooms, force)
+	if err != nil {
+		return err
+	}
+	for _, c := range cuts {
+		if err := setDeviceVolume(ctx, c.Room, c.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// cmdRadio plays a radio station on rooms. Stations are the Internet radio
+// streams Music.app can script: URL tracks in the library (including Apple
+// Music stations added to it) and the radio tuner.
+func cmdRadio(ctx context.Context, cfg *native.Config, args []string) {
+	if len(args) > 0 && args[0] == "list" {
+		cmdRadioList(ctx, args[1:])
+		return
+	}
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	query := strings.TrimSpace(strings.Join(positionals, " "))
+	if query == "" {
+		die(usageErrf("usage: homepodctl radio <station-query> [--room <name> ...] [--volume 0-100] | homepodctl radio list"))
+	}
+	rooms := append([]string(nil), flags.strings("room")...)
+	if len(rooms) == 0 {
+		rooms = append(rooms, cfg.Defaults.Rooms...)
+	}
+	rooms = cfg.ExpandRooms(rooms)
+	volume := -1
+	volumeExplicit := false
+	if v, ok, err := flags.intStrict("volume"); err != nil {
+		die(err)
+	} else if ok {
+		volume, volumeExplicit = v, true
+	}
+	if volume < 0 && cfg.Defaults.Volume != nil {
+		volume = *cfg.Defaults.Volume
+	}
+	strict, _, err := flags.boolStrict("strict")
+	if err != nil {
+		die(err)
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	force, _, err := flags.boolStrict("force")
+	if err != nil {
+		die(err)
+	}
+
+	if len(rooms) == 0 {
+		rooms = inferSelectedOutputs(ctx)
+	} else if rooms, err = resolveOutputRooms(ctx, rooms, exact, ""); err != nil {
+		die(err)
+	}
+	quietHours, err := checkQuietPlay(cfg, rooms, force)
+	if err != nil {
+		die(err)
+	}
+	if opts.DryRun {
+		writeActionOutput("radio", opts.JSON, opts.Plain, actionOutput{
+			DryRun:     true,
+			Backend:    "airplay",
+			Rooms:      rooms,
+			QuietHours: quietHours,
+			Station:    query,
+		})
+		return
+	}
+	if err := validateAirplayVolumeSelection(volumeExplicit, volume, rooms); err != nil {
+		die(err)
+	}
+	station, err := resolveStation(ctx, query)
+	if err != nil {
+		die(err)
+	}
+	debugf("radio: rooms=%v query=%q station=%+v volume=%d", rooms, query, station, volume)
+
+	batch := music.NewBatch().SetOutputs(rooms)
+	if volume >= 0 {
+		for _, room := range rooms {
+			v := cfg.AdjustVolume(room, volume)
+			if !force {
+				v = capVolume(cfg, room, v)
+			}
+			batch.SetVolume(room, v)
+		}
+	} else {
+		cuts, err := quietVolumeCuts(ctx, cfg, rooms, force)
+		if err != nil {
+			die(err)
+		}
+		for _, c := range cuts {
+			batch.SetVolume(c.Room, c.Value)
+		}
+	}
+	batch.PlayStation(station.PersistentID).NowPlaying()
+	res, err := runMusicBatch(ctx, batch)
+	if err != nil {
+		die(err)
+	}
+	statuses, np, verifyErr := verifyOutputs(ctx, rooms, res.NowPlaying, strict)
+	if verifyErr != nil {
+		die(verifyErr)
+	}
+	writeActionOutput("radio", opts.JSON, opts.Plain, actionOutput{
+		Backend:    "airplay",
+		Rooms:      rooms,
+		QuietHours: quietHours,
+		Station:    station.Name,
+		Outputs:    statuses,
+		NowPlaying: np,
+	})
+}
+
+func cmdRadioList(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl radio list [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	stations, err := listStations(ctx)
+	if err != nil {
+		die(err)
+	}
+	if jsonOut {
+		if stations == nil {
+			stations = []music.Station{}
+		}
+		writeJSON(stations)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "PERSISTENT_ID\tNAME\tSOURCE\tURL")
+	}
+	for _, s := range stations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.PersistentID, s.Name, s.Source, s.URL)
+	}
+	_ = tw.Flush()
+}
+
+// resolveStation picks the station whose name matches query best.
+func resolveStation(ctx context.Context, query string) (music.Station, error) {
+	stations, err := listStations(ctx)
+	if err != nil {
+		return music.Station{}, err
+	}
+	if len(stations) == 0 {
+		return music.Station{}, fmt.Errorf("no radio stations found (add an Apple Music station to your library, or a stream with File > Open Stream URL in Music.app)")
+	}
+	best, ok := music.PickBestStation(query, stations)
+	if !ok {
+		return music.Station{}, fmt.Errorf("no stations match %q (tip: run `homepodctl radio list`)", query)
+	}
+	return best, nil
+}
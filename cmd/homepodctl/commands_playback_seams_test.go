@@ -1,13 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/agisilaos/homepodctl/internal/mediakeys"
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/spotify"
+	"github.com/agisilaos/homepodctl/internal/sysaudio"
 )
 
 func TestCmdTransportUsesGetNowPlayingSeam(t *testing.T) {
@@ -32,6 +46,33 @@ func TestCmdTransportUsesGetNowPlayingSeam(t *testing.T) {
 	}
 }
 
+func TestCmdTransportGlobalDryRunSkipsBackend(t *testing.T) {
+	t.Cleanup(func() { dryRunAll = false })
+	dryRunAll = true
+
+	for _, action := range []string{"next", "pause"} {
+		called := false
+		out := captureStdout(t, func() {
+			cmdTransport(context.Background(), []string{"--json"}, action, func(context.Context) error {
+				called = true
+				return nil
+			})
+		})
+		if called {
+			t.Fatalf("%s: backend called under --dry-run", action)
+		}
+		if !strings.Contains(out, `"dryRun": true`) || !strings.Contains(out, `"action": "`+action+`"`) {
+			t.Fatalf("%s: output=%s", action, out)
+		}
+	}
+	if err := checkDryRunSupported("watch", nil); err == nil {
+		t.Fatalf("expected watch to reject --dry-run")
+	}
+	if err := checkDryRunSupported("config", []string{"set", "defaults.volume", "30"}); err != nil {
+		t.Fatalf("config set should support --dry-run: %v", err)
+	}
+}
+
 func TestCmdOutSetUsesSetCurrentOutputsSeam(t *testing.T) {
 	origSetCurrentOutputs := setCurrentOutputs
 	origGetNowPlaying := getNowPlaying
@@ -94,13 +135,477 @@ func TestCmdOutSetFallsBackToPositionalRooms(t *testing.T) {
 	}
 }
 
+func TestCmdOutSetExpandsGroups(t *testing.T) {
+	origSetCurrentOutputs := setCurrentOutputs
+	t.Cleanup(func() { setCurrentOutputs = origSetCurrentOutputs })
+
+	var got []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		got = append([]string(nil), rooms...)
+		return nil
+	}
+
+	cfg := &native.Config{
+		Defaults: native.DefaultsConfig{Backend: "airplay"},
+		Groups:   map[string][]string{"downstairs": {"Kitchen", "Living Room"}},
+	}
+	_ = captureStdout(t, func() {
+		cmdOut(context.Background(), cfg, []string{"set", "--room", "downstairs", "--room", "Bedroom"})
+	})
+	if strings.Join(got, ",") != "Kitchen,Living Room,Bedroom" {
+		t.Fatalf("expected group expansion, got=%v", got)
+	}
+}
+
+func TestCmdOutSetOnlyKind(t *testing.T) {
+	origListAirPlayDevices := listAirPlayDevices
+	origSetCurrentOutputs := setCurrentOutputs
+	t.Cleanup(func() {
+		listAirPlayDevices = origListAirPlayDevices
+		setCurrentOutputs = origSetCurrentOutputs
+	})
+
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Kitchen", Kind: "HomePod", Available: true},
+			{Name: "Living Room", Kind: "HomePod", Available: true},
+			{Name: "Living Room TV", Kind: "Apple TV", Available: true},
+		}, nil
+	}
+	var got []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		got = append([]string(nil), rooms...)
+		return nil
+	}
+
+	cfg := &native.Config{
+		Defaults: native.DefaultsConfig{Backend: "airplay"},
+		Groups:   map[string][]string{"downstairs": {"Kitchen", "Living Room", "Living Room TV"}},
+	}
+	stderr := captureStderr(t, func() {
+		_ = captureStdout(t, func() {
+			cmdOut(context.Background(), cfg, []string{"set", "downstairs", "--only-kind", "homepod"})
+		})
+	})
+	if strings.Join(got, ",") != "Kitchen,Living Room" {
+		t.Fatalf("rooms=%v", got)
+	}
+	if !strings.Contains(stderr, "skipped Living Room TV (tv)") {
+		t.Fatalf("stderr=%q", stderr)
+	}
+
+	stderr = captureStderr(t, func() {
+		_ = captureStdout(t, func() {
+			cmdOut(context.Background(), cfg, []string{"set", "downstairs"})
+		})
+	})
+	if len(got) != 3 || !strings.Contains(stderr, "Living Room TV is an Apple TV") {
+		t.Fatalf("rooms=%v stderr=%q", got, stderr)
+	}
+
+	if _, err := resolveOutputRooms(context.Background(), []string{"Living Room TV"}, true, "homepod"); err == nil {
+		t.Fatalf("expected an error when --only-kind leaves no rooms")
+	}
+	if got := filterDeviceKind([]music.AirPlayDevice{{Name: "A", Kind: "HomePod"}, {Name: "B", Kind: "Apple TV"}}, "tv"); len(got) != 1 || got[0].Name != "B" {
+		t.Fatalf("filterDeviceKind=%v", got)
+	}
+}
+
+func TestCmdOutAddRemoveUsesCurrentSelection(t *testing.T) {
+	origListAirPlayDevices := listAirPlayDevices
+	origSetCurrentOutputs := setCurrentOutputs
+	origGetNowPlaying := getNowPlaying
+	t.Cleanup(func() {
+		listAirPlayDevices = origListAirPlayDevices
+		setCurrentOutputs = origSetCurrentOutputs
+		getNowPlaying = origGetNowPlaying
+	})
+
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Bedroom", Selected: true},
+			{Name: "Kitchen"},
+			{Name: "Living Room", Selected: true},
+		}, nil
+	}
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{PlayerState: "playing"}, nil
+	}
+	var got []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		got = append([]string(nil), rooms...)
+		return nil
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+	out := captureStdout(t, func() {
+		cmdOut(context.Background(), cfg, []string{"add", "--room", "Kitchen", "--json"})
+	})
+	if strings.Join(got, ",") != "Bedroom,Living Room,Kitchen" {
+		t.Fatalf("add rooms=%v", got)
+	}
+	if !strings.Contains(out, `"action": "out.add"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	_ = captureStdout(t, func() {
+		cmdOut(context.Background(), cfg, []string{"remove", "bedroom"})
+	})
+	if strings.Join(got, ",") != "Living Room" {
+		t.Fatalf("remove rooms=%v", got)
+	}
+}
+
+func TestCmdPauseResumeRoom(t *testing.T) {
+	origListAirPlayDevices := listAirPlayDevices
+	origSetCurrentOutputs := setCurrentOutputs
+	origGetNowPlaying := getNowPlaying
+	t.Cleanup(func() {
+		listAirPlayDevices = origListAirPlayDevices
+		setCurrentOutputs = origSetCurrentOutputs
+		getNowPlaying = origGetNowPlaying
+	})
+
+	selected := map[string]bool{"Kitchen": true, "Living Room": true}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		var devs []music.AirPlayDevice
+		for _, name := range []string{"Kitchen", "Living Room"} {
+			devs = append(devs, music.AirPlayDevice{Name: name, Kind: "HomePod", Available: true, Selected: selected[name]})
+		}
+		return devs, nil
+	}
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{PlayerState: "playing"}, nil
+	}
+	var got []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		got = append([]string(nil), rooms...)
+		selected = map[string]bool{}
+		for _, r := range rooms {
+			selected[r] = true
+		}
+		return nil
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+	out := captureStdout(t, func() {
+		cmdDeviceTransport(context.Background(), cfg, []string{"--room", "kitchen", "--json"}, "pause", func(context.Context) error {
+			t.Fatalf("pause --room should not pause playback")
+			return nil
+		})
+	})
+	if strings.Join(got, ",") != "Living Room" || !strings.Contains(out, `"action": "pause"`) {
+		t.Fatalf("pause rooms=%v output=%s", got, out)
+	}
+
+	_ = captureStdout(t, func() {
+		cmdResume(context.Background(), cfg, []string{"--room", "Kitchen"})
+	})
+	if strings.Join(got, ",") != "Living Room,Kitchen" {
+		t.Fatalf("resume rooms=%v", got)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdDeviceTransport(context.Background(), cfg, []string{"--room", "Kitchen", "--room", "Living Room"}, "stop", nil)
+	})
+	if fatal, ok := recovered.(cliFatal); !ok || !strings.Contains(fatal.err.Error(), "without --room") {
+		t.Fatalf("recovered=%v", recovered)
+	}
+
+	if !isUndoableCommand("pause", []string{"--room", "Kitchen"}) || isUndoableCommand("pause", nil) {
+		t.Fatalf("only pause --room should be undoable")
+	}
+}
+
+func TestCmdPlayRunsOneBatch(t *testing.T) {
+	origSearch := searchPlaylists
+	origBatch := runMusicBatch
+	t.Cleanup(func() {
+		searchPlaylists = origSearch
+		runMusicBatch = origBatch
+	})
+
+	searchPlaylists = func(context.Context, string) ([]music.UserPlaylist, error) {
+		return []music.UserPlaylist{{PersistentID: "PL1", Name: "Chill"}}, nil
+	}
+	var ops []string
+	runMusicBatch = func(_ context.Context, b *music.Batch) (music.BatchResult, error) {
+		ops = b.Ops()
+		return music.BatchResult{NowPlaying: &music.NowPlaying{PlayerState: "playing", PlaylistID: "PL1"}}, nil
+	}
+
+	vol := 40
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Kitchen", "Bedroom"}, Volume: &vol}}
+	out := captureStdout(t, func() { cmdPlay(context.Background(), cfg, []string{"chill", "--json"}) })
+
+	want := "set outputs Kitchen,Bedroom|set volume Kitchen=40|set volume Bedroom=40|set shuffle false|play playlist PL1"
+	if got := strings.Join(ops, "|"); got != want {
+		t.Fatalf("ops=%q, want %q", got, want)
+	}
+	if !strings.Contains(out, `"playlistId": "PL1"`) || !strings.Contains(out, `"playerState": "playing"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestCmdPlaySynchronized(t *testing.T) {
+	origSearch, origBatch := searchPlaylists, runMusicBatch
+	origList, origSleep := listAirPlayDevices, sleepCtx
+	t.Cleanup(func() {
+		searchPlaylists, runMusicBatch = origSearch, origBatch
+		listAirPlayDevices, sleepCtx = origList, origSleep
+	})
+
+	searchPlaylists = func(context.Context, string) ([]music.UserPlaylist, error) {
+		return []music.UserPlaylist{{PersistentID: "PL1", Name: "Chill"}}, nil
+	}
+	var batches []string
+	runMusicBatch = func(_ context.Context, b *music.Batch) (music.BatchResult, error) {
+		batches = append(batches, strings.Join(b.Ops(), "|"))
+		return music.BatchResult{NowPlaying: &music.NowPlaying{PlayerState: "playing", PlaylistID: "PL1"}}, nil
+	}
+	// The first listing resolves the rooms; Bedroom joins on the third.
+	lists := 0
+	readyAt := 3
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		lists++
+		return []music.AirPlayDevice{
+			{Name: "Kitchen", Available: true, Selected: true},
+			{Name: "Bedroom", Available: true, Selected: lists >= readyAt},
+		}, nil
+	}
+	var slept []time.Duration
+	sleepCtx = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Kitchen", "Bedroom"}}}
+	out := captureStdout(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"chill", "--synchronized", "--json"})
+	})
+	want := "set outputs Kitchen,Bedroom|set shuffle false / play playlist PL1|pause|seek 0 / play"
+	if got := strings.Join(batches, " / "); got != want {
+		t.Fatalf("batches=%q, want %q", got, want)
+	}
+	if len(slept) != 2 || slept[0] != syncPollInterval || slept[1] != syncBuffer {
+		t.Fatalf("slept=%v", slept)
+	}
+	if !strings.Contains(out, `"synchronized": true`) || !strings.Contains(out, `"playerState": "playing"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	batches, slept, lists, readyAt = nil, nil, 0, 1000
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"chill", "--synchronized"})
+	})
+	if fatal, ok := recovered.(cliFatal); !ok || !strings.Contains(fatal.err.Error(), "Bedroom not selected and available") {
+		t.Fatalf("recovered=%v", recovered)
+	}
+	if len(batches) != 1 || len(slept) != int(syncReadyTimeout/syncPollInterval) {
+		t.Fatalf("timed out play ran batches=%q slept=%d times", batches, len(slept))
+	}
+
+	// The wait between polls ends as soon as the command's context does.
+	sleepCtx = sleepContext
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := waitOutputsReady(ctx, []string{"Bedroom"}); !errors.Is(err, context.DeadlineExceeded) || time.Since(started) >= syncPollInterval {
+		t.Fatalf("err=%v after %s", err, time.Since(started))
+	}
+}
+
+func TestCmdPlayPinSavesPickedPlaylist(t *testing.T) {
+	origSearch, origBatch := searchPlaylists, runMusicBatch
+	origLoad, origPath := loadConfigOptional, configPath
+	t.Cleanup(func() {
+		searchPlaylists, runMusicBatch = origSearch, origBatch
+		loadConfigOptional, configPath = origLoad, origPath
+	})
+
+	searchPlaylists = func(context.Context, string) ([]music.UserPlaylist, error) {
+		return []music.UserPlaylist{{PersistentID: "PL1", Name: "Chill"}, {PersistentID: "PL2", Name: "Chill Mix"}}, nil
+	}
+	played := false
+	runMusicBatch = func(context.Context, *music.Batch) (music.BatchResult, error) {
+		played = true
+		return music.BatchResult{}, nil
+	}
+	stored := &native.Config{Aliases: map[string]native.Alias{"wake": {Backend: "native", Shortcut: "Morning"}}}
+	loadConfigOptional = func() (*native.Config, error) {
+		b, _ := json.Marshal(stored)
+		var cfg native.Config
+		_ = json.Unmarshal(b, &cfg)
+		return &cfg, nil
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	configPath = func() (string, error) { return path, nil }
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+
+	out := captureStdout(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"chill", "--room", "Kitchen", "--volume", "30", "--pin", "chill", "--dry-run", "--json"})
+	})
+	if played || !strings.Contains(out, `"pinned": "chill"`) || !strings.Contains(out, `"playlistId": "PL1"`) {
+		t.Fatalf("dry run played=%t out=%s", played, out)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote the config: %v", err)
+	}
+
+	_ = captureStdout(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"chill", "--room", "Kitchen", "--volume", "30", "--pin", "chill", "--json"})
+	})
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	var saved native.Config
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	a := saved.Aliases["chill"]
+	if a.PlaylistID != "PL1" || a.Playlist != "Chill" || strings.Join(a.Rooms, ",") != "Kitchen" || a.Volume == nil || *a.Volume != 30 {
+		t.Fatalf("pinned alias=%+v", a)
+	}
+	if _, ok := saved.Aliases["wake"]; !ok {
+		t.Fatalf("other aliases were dropped: %+v", saved.Aliases)
+	}
+
+	played = false
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"chill", "--pin", "wake"})
+	})
+	if fatal, ok := recovered.(cliFatal); !ok || played || !strings.Contains(fatal.err.Error(), "does not play a playlist") {
+		t.Fatalf("pin onto a shortcut alias: played=%t recovered=%v", played, recovered)
+	}
+}
+
+func TestCmdPlayCatalogAddsToLibraryAndPlays(t *testing.T) {
+	origSearch, origLibrary, origCreate, origAdd, origClear := searchPlaylists, searchLibrary, createPlaylist, addTrackToPlaylist, clearPlaylist
+	origBatch, origSleep, origEndpoint := runMusicBatch, sleepFn, catalogEndpoint
+	t.Cleanup(func() {
+		searchPlaylists, searchLibrary, createPlaylist, addTrackToPlaylist, clearPlaylist = origSearch, origLibrary, origCreate, origAdd, origClear
+		runMusicBatch, sleepFn, catalogEndpoint = origBatch, origSleep, origEndpoint
+	})
+
+	var added []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/catalog/us/search":
+			_, _ = io.WriteString(w, `{"results":{"artists":{"data":[{"id":"A2","type":"artists","attributes":{"name":"Khruangbin & Leon Bridges"}},{"id":"A1","type":"artists","attributes":{"name":"Khruangbin"}}]}}}`)
+		case "/v1/catalog/us/artists/A1/view/top-songs":
+			_, _ = io.WriteString(w, `{"data":[{"id":"S1","type":"songs","attributes":{"name":"Maria Tambien","artistName":"Khruangbin"}},{"id":"S2","type":"songs","attributes":{"name":"Time (You and I)","artistName":"Khruangbin"}}]}`)
+		case "/v1/me/library":
+			added = append(added, r.URL.Query().Get("ids[songs]"))
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	catalogEndpoint = srv.URL
+
+	var existing []music.UserPlaylist
+	searchPlaylists = func(context.Context, string) ([]music.UserPlaylist, error) { return existing, nil }
+	var cleared []string
+	clearPlaylist = func(_ context.Context, playlistID string) error {
+		cleared = append(cleared, playlistID)
+		return nil
+	}
+	synced := map[string]bool{"Maria Tambien": true}
+	searchLibrary = func(_ context.Context, query, kind string, _ int) ([]music.LibraryItem, error) {
+		if kind != "track" || !synced[query] {
+			return nil, nil
+		}
+		return []music.LibraryItem{{Kind: "track", PersistentID: "T-" + query, Name: query, Artist: "Khruangbin"}}, nil
+	}
+	var slept int
+	sleepFn = func(time.Duration) {
+		slept++
+		synced["Time (You and I)"] = true
+	}
+	var created string
+	var tracks []string
+	createPlaylist = func(_ context.Context, name string) (music.UserPlaylist, error) {
+		created = name
+		return music.UserPlaylist{PersistentID: "PL9", Name: name}, nil
+	}
+	addTrackToPlaylist = func(_ context.Context, _, trackID string) error {
+		tracks = append(tracks, trackID)
+		return nil
+	}
+	var ops []string
+	runMusicBatch = func(_ context.Context, b *music.Batch) (music.BatchResult, error) {
+		ops = b.Ops()
+		return music.BatchResult{NowPlaying: &music.NowPlaying{PlayerState: "playing", PlaylistID: "PL9"}}, nil
+	}
+
+	cfg := &native.Config{
+		Defaults:   native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Kitchen"}},
+		AppleMusic: &native.AppleMusicConfig{DeveloperToken: "dev"},
+	}
+	out := captureStdout(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"--catalog", "artist:khruangbin", "--dry-run", "--json"})
+	})
+	if ops != nil || added != nil || !strings.Contains(out, `"playlist": "homepodctl Catalog"`) || !strings.Contains(out, `"id": "A1"`) {
+		t.Fatalf("dry run ops=%q added=%q out=%s", ops, added, out)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"--catalog", "artist:khruangbin", "--json"})
+	})
+	if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage || !strings.Contains(fatal.err.Error(), "appleMusic.userToken") {
+		t.Fatalf("recovered=%v", recovered)
+	}
+
+	cfg.AppleMusic.UserToken = "user"
+	out = captureStdout(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"--catalog", "artist:khruangbin", "--json"})
+	})
+	if strings.Join(added, "|") != "S1,S2" || slept != 1 || created != "homepodctl Catalog" || cleared != nil || strings.Join(tracks, ",") != "T-Maria Tambien,T-Time (You and I)" {
+		t.Fatalf("added=%q slept=%d created=%q cleared=%q tracks=%q", added, slept, created, cleared, tracks)
+	}
+	if got := ops[len(ops)-1]; got != "play playlist PL9" {
+		t.Fatalf("ops=%q", ops)
+	}
+	if !strings.Contains(out, `"playlistId": "PL9"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	// A later play empties and refills the same playlist.
+	existing = []music.UserPlaylist{{PersistentID: "PL9", Name: "homepodctl Catalog"}}
+	created, tracks = "", nil
+	_ = captureStdout(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"--catalog", "artist:khruangbin", "--json"})
+	})
+	if created != "" || strings.Join(cleared, ",") != "PL9" || strings.Join(tracks, ",") != "T-Maria Tambien,T-Time (You and I)" {
+		t.Fatalf("refill created=%q cleared=%q tracks=%q", created, cleared, tracks)
+	}
+}
+
+func TestMergeOutputSelection(t *testing.T) {
+	t.Parallel()
+
+	got := mergeOutputSelection([]string{"Bedroom", "Kitchen"}, []string{"kitchen", "Office", "Office"}, nil)
+	if strings.Join(got, ",") != "Bedroom,Kitchen,Office" {
+		t.Fatalf("add got=%v", got)
+	}
+	got = mergeOutputSelection([]string{"Bedroom", "Kitchen"}, nil, []string{"BEDROOM", "Garage"})
+	if strings.Join(got, ",") != "Kitchen" {
+		t.Fatalf("remove got=%v", got)
+	}
+	if got := mergeOutputSelection([]string{"Bedroom"}, nil, []string{"Bedroom"}); len(got) != 0 {
+		t.Fatalf("expected empty selection, got=%v", got)
+	}
+}
+
 func TestChoosePlaylist_NoInput(t *testing.T) {
 	t.Parallel()
 
-	_, err := choosePlaylist([]music.UserPlaylist{
+	_, err := choosePlaylist("focus", []music.UserPlaylist{
 		{Name: "Focus", PersistentID: "A"},
 		{Name: "Focus Mix", PersistentID: "B"},
-	}, false)
+	}, false, false)
 	if err == nil || !strings.Contains(strings.ToLower(err.Error()), "non-interactive") {
 		t.Fatalf("expected non-interactive error, got: %v", err)
 	}
@@ -121,11 +626,776 @@ func TestChoosePlaylist_RequiresInteractiveStdin(t *testing.T) {
 		_ = r.Close()
 	})
 
-	_, err = choosePlaylist([]music.UserPlaylist{
+	_, err = choosePlaylist("focus", []music.UserPlaylist{
 		{Name: "Focus", PersistentID: "A"},
 		{Name: "Focus Mix", PersistentID: "B"},
-	}, true)
+	}, true, false)
 	if err == nil || !strings.Contains(strings.ToLower(err.Error()), "interactive stdin") {
 		t.Fatalf("expected interactive stdin error, got: %v", err)
 	}
 }
+
+func TestChoosePlaylist_YesPicksBestMatch(t *testing.T) {
+	t.Parallel()
+
+	got, err := choosePlaylist("focus mix", []music.UserPlaylist{
+		{Name: "Focus", PersistentID: "A"},
+		{Name: "Focus Mix", PersistentID: "B"},
+	}, false, true)
+	if err != nil {
+		t.Fatalf("choosePlaylist: %v", err)
+	}
+	if got.PersistentID != "B" {
+		t.Fatalf("picked %q, want B", got.PersistentID)
+	}
+}
+
+func TestCmdMoveSwapsOutputsAndCarriesVolumeAndPosition(t *testing.T) {
+	origGetNowPlaying := getNowPlaying
+	origListAirPlayDevices := listAirPlayDevices
+	origSetCurrentOutputs := setCurrentOutputs
+	origSetDeviceVolume := setDeviceVolume
+	origSetPlayerPosition := setPlayerPosition
+	t.Cleanup(func() {
+		getNowPlaying = origGetNowPlaying
+		listAirPlayDevices = origListAirPlayDevices
+		setCurrentOutputs = origSetCurrentOutputs
+		setDeviceVolume = origSetDeviceVolume
+		setPlayerPosition = origSetPlayerPosition
+	})
+
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{PlayerState: "playing", PlayerPositionS: 42.5, PlaylistName: "Chill"}, nil
+	}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Living Room", Selected: true, Volume: 35},
+			{Name: "Bedroom", Volume: 10},
+			{Name: "Office", Selected: true, Volume: 20},
+		}, nil
+	}
+	var gotRooms []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		gotRooms = append([]string(nil), rooms...)
+		return nil
+	}
+	volumes := map[string]int{}
+	setDeviceVolume = func(_ context.Context, room string, value int) error {
+		volumes[room] = value
+		return nil
+	}
+	var gotPosition float64
+	setPlayerPosition = func(_ context.Context, seconds float64) error {
+		gotPosition = seconds
+		return nil
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+	out := captureStdout(t, func() {
+		cmdMove(context.Background(), cfg, "move", []string{"living room", "Bedroom", "--json"})
+	})
+	if strings.Join(gotRooms, ",") != "Office,Bedroom" {
+		t.Fatalf("rooms=%v, want Office,Bedroom", gotRooms)
+	}
+	if len(volumes) != 1 || volumes["Bedroom"] != 35 {
+		t.Fatalf("volumes=%v, want Bedroom=35", volumes)
+	}
+	if gotPosition != 42.5 {
+		t.Fatalf("position=%v, want 42.5", gotPosition)
+	}
+	if !strings.Contains(out, `"action": "move"`) || !strings.Contains(out, `"playlist": "Chill"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	gotPosition = 0
+	_ = captureStdout(t, func() {
+		cmdMove(context.Background(), cfg, "handoff", []string{"Living Room", "Bedroom", "--volume", "20", "--no-restore"})
+	})
+	if volumes["Bedroom"] != 20 {
+		t.Fatalf("explicit volume not applied: %v", volumes)
+	}
+	if gotPosition != 0 {
+		t.Fatalf("--no-restore should skip seek, got position=%v", gotPosition)
+	}
+}
+
+func TestCmdVolumeRelativeAndPerRoom(t *testing.T) {
+	origListAirPlayDevices := listAirPlayDevices
+	origSetDeviceVolume := setDeviceVolume
+	origGetNowPlaying := getNowPlaying
+	t.Cleanup(func() {
+		listAirPlayDevices = origListAirPlayDevices
+		setDeviceVolume = origSetDeviceVolume
+		getNowPlaying = origGetNowPlaying
+	})
+
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Bedroom", Selected: true, Volume: 40},
+			{Name: "Kitchen", Selected: true, Volume: 95},
+		}, nil
+	}
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{}, nil
+	}
+	var got []string
+	setDeviceVolume = func(_ context.Context, room string, value int) error {
+		got = append(got, room+":"+strconv.Itoa(value))
+		return nil
+	}
+
+	cfg := &native.Config{
+		Defaults:      native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Bedroom", "Kitchen"}},
+		VolumeOffsets: map[string]int{"Kitchen": -10},
+	}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"+10"}, want: "Bedroom:50,Kitchen:100"},
+		{args: []string{"-10", "Kitchen"}, want: "Kitchen:85"},
+		{args: []string{"Bedroom=30", "Kitchen=45"}, want: "Bedroom:30,Kitchen:35"},
+		{args: []string{"Bedroom=+5"}, want: "Bedroom:45"},
+	}
+	for _, tc := range tests {
+		got = nil
+		_ = captureStdout(t, func() {
+			cmdVolume(context.Background(), cfg, "volume", tc.args)
+		})
+		if strings.Join(got, ",") != tc.want {
+			t.Fatalf("args=%v got=%v, want %s", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestParseVolumeAssignments_RejectsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{{"=30"}, {"Bedroom=loud"}, {"Bedroom=101"}, {"Bedroom=30", "Kitchen"}} {
+		if _, err := parseVolumeAssignments(nil, args); err == nil {
+			t.Fatalf("args=%v: expected error", args)
+		}
+	}
+}
+
+func TestSyncVolumeTargets(t *testing.T) {
+	t.Parallel()
+
+	devs := []music.AirPlayDevice{
+		{Name: "Kitchen", Selected: true, Volume: 0},
+		{Name: "Bedroom", Selected: true, Volume: 0},
+		{Name: "Office", Volume: 50},
+	}
+	master, targets, err := syncVolumeTargets(devs, 40, false)
+	if err != nil || master != 40 || len(targets) != 2 || targets[0].Value != 40 || targets[1].Value != 40 {
+		t.Fatalf("master=%d targets=%+v err=%v", master, targets, err)
+	}
+	devs[0].Volume, devs[1].Volume = 80, 20
+	master, targets, err = syncVolumeTargets(devs, -90, true)
+	if err != nil || master != 0 || targets[0].Value != 0 || targets[1].Value != 0 {
+		t.Fatalf("master=%d targets=%+v err=%v", master, targets, err)
+	}
+	master, targets, err = syncVolumeTargets(devs, 100, false)
+	if err != nil || master != 100 || targets[0].Value != 100 || targets[1].Value != 25 {
+		t.Fatalf("master=%d targets=%+v err=%v", master, targets, err)
+	}
+	if _, _, err := syncVolumeTargets(devs[2:], 40, false); err == nil {
+		t.Fatalf("expected error with no selected outputs")
+	}
+}
+
+func TestCmdMuteUnmuteRestoresRememberedVolume(t *testing.T) {
+	origConfigPath := configPath
+	origListAirPlayDevices := listAirPlayDevices
+	origSetDeviceVolume := setDeviceVolume
+	t.Cleanup(func() {
+		configPath = origConfigPath
+		listAirPlayDevices = origListAirPlayDevices
+		setDeviceVolume = origSetDeviceVolume
+	})
+
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	configPath = func() (string, error) { return filepath.Join(dir, "config.json"), nil }
+	// A mute.json an older build left next to config.json moves to the
+	// state dir.
+	if err := os.WriteFile(filepath.Join(dir, "mute.json"), []byte(`{"rooms":{"Office":20}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := loadMuteState(); err != nil || st.Rooms["Office"] != 20 {
+		t.Fatalf("legacy state=%+v err=%v", st, err)
+	}
+	if err := saveMuteState(&muteState{Rooms: map[string]int{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "homepodctl", "mute.json")); err != nil {
+		t.Fatalf("mute.json not in the state dir: %v", err)
+	}
+	volumes := map[string]int{"Bedroom": 30, "Kitchen": 55}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Bedroom", Volume: volumes["Bedroom"]},
+			{Name: "Kitchen", Volume: volumes["Kitchen"]},
+		}, nil
+	}
+	setDeviceVolume = func(_ context.Context, room string, value int) error {
+		volumes[room] = value
+		return nil
+	}
+
+	cfg := &native.Config{}
+	_ = captureStdout(t, func() { cmdMute(context.Background(), cfg, []string{"bedroom", "Kitchen"}) })
+	if volumes["Bedroom"] != 0 || volumes["Kitchen"] != 0 {
+		t.Fatalf("mute volumes=%v", volumes)
+	}
+	// A second mute must keep the original levels.
+	_ = captureStdout(t, func() { cmdMute(context.Background(), cfg, []string{"Bedroom"}) })
+
+	_ = captureStdout(t, func() { cmdUnmute(context.Background(), cfg, []string{"Kitchen"}) })
+	if volumes["Kitchen"] != 55 || volumes["Bedroom"] != 0 {
+		t.Fatalf("unmute Kitchen volumes=%v", volumes)
+	}
+	_ = captureStdout(t, func() { cmdUnmute(context.Background(), cfg, nil) })
+	if volumes["Bedroom"] != 30 {
+		t.Fatalf("unmute all volumes=%v", volumes)
+	}
+	st, err := loadMuteState()
+	if err != nil {
+		t.Fatalf("loadMuteState: %v", err)
+	}
+	if len(st.Rooms) != 0 {
+		t.Fatalf("state not cleared: %v", st.Rooms)
+	}
+}
+
+func TestCmdDuckRestoresAfterForAndOnUnduck(t *testing.T) {
+	origDuckStatePath := duckStatePath
+	origListAirPlayDevices := listAirPlayDevices
+	origSetDeviceVolume := setDeviceVolume
+	origSleep := sleepFn
+	t.Cleanup(func() {
+		duckStatePath = origDuckStatePath
+		listAirPlayDevices = origListAirPlayDevices
+		setDeviceVolume = origSetDeviceVolume
+		sleepFn = origSleep
+	})
+
+	path := filepath.Join(t.TempDir(), "duck.json")
+	duckStatePath = func() (string, error) { return path, nil }
+	volumes := map[string]int{"Bedroom": 30, "Kitchen": 55, "Office": 5}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Bedroom", Volume: volumes["Bedroom"], Selected: true},
+			{Name: "Kitchen", Volume: volumes["Kitchen"], Selected: true},
+			{Name: "Office", Volume: volumes["Office"], Selected: true},
+		}, nil
+	}
+	var sets []string
+	setDeviceVolume = func(_ context.Context, room string, value int) error {
+		sets = append(sets, room+"="+strconv.Itoa(value))
+		volumes[room] = value
+		return nil
+	}
+
+	cfg := &native.Config{}
+	out := captureStdout(t, func() { cmdDuck(context.Background(), cfg, []string{"--to", "10", "--json"}) })
+	var res duckResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if len(res.Rooms) != 3 || volumes["Bedroom"] != 10 || volumes["Kitchen"] != 10 || volumes["Office"] != 5 {
+		t.Fatalf("duck res=%+v volumes=%v", res, volumes)
+	}
+	if strings.Join(sets, ",") != "Bedroom=10,Kitchen=10" {
+		t.Fatalf("rooms at or below --to should be left alone: %v", sets)
+	}
+	// Ducking again must keep the levels remembered first.
+	_ = captureStdout(t, func() { cmdDuck(context.Background(), cfg, []string{"kitchen", "--to", "0"}) })
+	_ = captureStdout(t, func() { cmdUnduck(context.Background(), cfg, nil) })
+	if volumes["Bedroom"] != 30 || volumes["Kitchen"] != 55 || volumes["Office"] != 5 {
+		t.Fatalf("unduck volumes=%v", volumes)
+	}
+	_, recovered := captureStdoutAndRecover(t, func() { cmdUnduck(context.Background(), cfg, nil) })
+	if fatal, ok := recovered.(cliFatal); !ok || !strings.Contains(fatal.err.Error(), "nothing to unduck") {
+		t.Fatalf("recovered=%v", recovered)
+	}
+
+	var held time.Duration
+	sleepFn = func(d time.Duration) {
+		held = d
+		if volumes["Kitchen"] != 15 {
+			t.Errorf("kitchen not ducked while held: %v", volumes)
+		}
+	}
+	_ = captureStdout(t, func() { cmdDuck(context.Background(), cfg, []string{"Kitchen", "--for", "2m"}) })
+	if held != 2*time.Minute || volumes["Kitchen"] != 55 {
+		t.Fatalf("held=%s volumes=%v", held, volumes)
+	}
+
+	// A timed restore leaves rooms alone once a later duck has taken over.
+	sleepFn = func(time.Duration) {
+		_ = captureStdout(t, func() { cmdDuck(context.Background(), cfg, []string{"Kitchen", "--to", "5"}) })
+	}
+	_ = captureStdout(t, func() { cmdDuck(context.Background(), cfg, []string{"Kitchen", "--for", "1m"}) })
+	if volumes["Kitchen"] != 5 {
+		t.Fatalf("timed restore should have been skipped: %v", volumes)
+	}
+	st, err := loadDuckState()
+	if err != nil || st.Rooms["Kitchen"] != 55 {
+		t.Fatalf("state=%+v err=%v", st, err)
+	}
+}
+
+func TestRestoreExpiredDuck(t *testing.T) {
+	origDuckStatePath, origList, origSet, origNow := duckStatePath, listAirPlayDevices, setDeviceVolume, timeNow
+	t.Cleanup(func() {
+		duckStatePath, listAirPlayDevices, setDeviceVolume, timeNow = origDuckStatePath, origList, origSet, origNow
+	})
+	path := filepath.Join(t.TempDir(), "duck.json")
+	duckStatePath = func() (string, error) { return path, nil }
+	volumes := map[string]int{"Kitchen": 50}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Kitchen", Volume: volumes["Kitchen"], Selected: true}}, nil
+	}
+	setDeviceVolume = func(_ context.Context, room string, v int) error {
+		volumes[room] = v
+		return nil
+	}
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return start }
+
+	st := automationStep{Type: "duck", Value: intPtr(10), For: "2m"}
+	if err := executeAutomationDuck(context.Background(), st); err != nil || volumes["Kitchen"] != 10 {
+		t.Fatalf("duck step: volumes=%v err=%v", volumes, err)
+	}
+	if res, err := restoreExpiredDuck(context.Background()); err != nil || len(res.Rooms) != 0 || volumes["Kitchen"] != 10 {
+		t.Fatalf("before until: res=%+v volumes=%v err=%v", res, volumes, err)
+	}
+	timeNow = func() time.Time { return start.Add(3 * time.Minute) }
+	if res, err := restoreExpiredDuck(context.Background()); err != nil || len(res.Rooms) != 1 || volumes["Kitchen"] != 50 {
+		t.Fatalf("after until: res=%+v volumes=%v err=%v", res, volumes, err)
+	}
+	if st, err := loadDuckState(); err != nil || st.Until != "" || len(st.Rooms) != 0 {
+		t.Fatalf("state=%+v err=%v", st, err)
+	}
+}
+
+func TestCmdAudioRouteAndReset(t *testing.T) {
+	origList, origCurrent, origSet := listSystemOutputs, currentSystemOutput, setSystemOutput
+	origPath := audioRouteStatePath
+	t.Cleanup(func() {
+		listSystemOutputs, currentSystemOutput, setSystemOutput = origList, origCurrent, origSet
+		audioRouteStatePath = origPath
+	})
+
+	path := filepath.Join(t.TempDir(), "audio-route.json")
+	audioRouteStatePath = func() (string, error) { return path, nil }
+	current := "MacBook Pro Speakers"
+	listSystemOutputs = func(context.Context) ([]sysaudio.Output, error) {
+		var outs []sysaudio.Output
+		for _, name := range []string{"MacBook Pro Speakers", "Kitchen", "Living Room"} {
+			outs = append(outs, sysaudio.Output{Name: name, Current: name == current})
+		}
+		return outs, nil
+	}
+	currentSystemOutput = func(context.Context) (string, error) { return current, nil }
+	var sets []string
+	setSystemOutput = func(_ context.Context, name string) error {
+		sets = append(sets, name)
+		current = name
+		return nil
+	}
+
+	cfg := &native.Config{Groups: map[string][]string{"downstairs": {"Kitchen", "Living Room"}}}
+	out := captureStdout(t, func() { cmdAudio(context.Background(), cfg, []string{"route", "kitchen", "--json"}) })
+	var res audioRouteResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if res.Output != "Kitchen" || res.Previous != "MacBook Pro Speakers" || current != "Kitchen" {
+		t.Fatalf("route res=%+v current=%q", res, current)
+	}
+	// Moving on to another room keeps the output to reset to.
+	_ = captureStdout(t, func() { cmdAudio(context.Background(), cfg, []string{"route", "Living Room"}) })
+	out = captureStdout(t, func() { cmdAudio(context.Background(), cfg, []string{"status", "--json"}) })
+	var status audioStatusResult
+	if err := json.Unmarshal([]byte(out), &status); err != nil || status.Current != "Living Room" || status.RoutedFrom != "MacBook Pro Speakers" {
+		t.Fatalf("status=%+v err=%v", status, err)
+	}
+
+	_ = captureStdout(t, func() { cmdAudio(context.Background(), cfg, []string{"route", "--reset"}) })
+	if current != "MacBook Pro Speakers" || strings.Join(sets, ",") != "Kitchen,Living Room,MacBook Pro Speakers" {
+		t.Fatalf("current=%q sets=%v", current, sets)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state not removed: %v", err)
+	}
+
+	for _, args := range [][]string{{"route", "--reset"}, {"route", "downstairs"}, {"route"}} {
+		_, recovered := captureStdoutAndRecover(t, func() { cmdAudio(context.Background(), cfg, args) })
+		if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+			t.Fatalf("%v: recovered=%#v", args, recovered)
+		}
+	}
+}
+
+func TestCmdPlaylistCreateAddRemove(t *testing.T) {
+	origCreate := createPlaylist
+	origAdd := addTrackToPlaylist
+	origRemove := removeTrackFromPlaylist
+	origFind := findPlaylistIDByName
+	t.Cleanup(func() {
+		createPlaylist = origCreate
+		addTrackToPlaylist = origAdd
+		removeTrackFromPlaylist = origRemove
+		findPlaylistIDByName = origFind
+	})
+
+	createPlaylist = func(_ context.Context, name string) (music.UserPlaylist, error) {
+		return music.UserPlaylist{PersistentID: "PL1", Name: name}, nil
+	}
+	findPlaylistIDByName = func(_ context.Context, name string) (string, error) {
+		if name != "Dinner tonight" {
+			t.Fatalf("unexpected playlist name %q", name)
+		}
+		return "PL1", nil
+	}
+	var added []string
+	addTrackToPlaylist = func(_ context.Context, playlistID, trackID string) error {
+		added = append(added, playlistID+":"+trackID)
+		return nil
+	}
+	removeTrackFromPlaylist = func(context.Context, string, string) (int, error) { return 1, nil }
+
+	out := captureStdout(t, func() {
+		cmdPlaylist(context.Background(), []string{"create", "Dinner", "tonight", "--json"})
+	})
+	if !strings.Contains(out, `"playlistId": "PL1"`) || !strings.Contains(out, `"playlist": "Dinner tonight"`) {
+		t.Fatalf("unexpected create output: %s", out)
+	}
+
+	_ = captureStdout(t, func() {
+		cmdPlaylist(context.Background(), []string{"add", "Dinner tonight", "--track-id", "T1", "--track-id", "T2", "--dry-run"})
+	})
+	if len(added) != 0 {
+		t.Fatalf("dry-run should not add tracks, got=%v", added)
+	}
+	_ = captureStdout(t, func() {
+		cmdPlaylist(context.Background(), []string{"add", "Dinner tonight", "--track-id", "T1", "--track-id", "T2"})
+	})
+	if strings.Join(added, ",") != "PL1:T1,PL1:T2" {
+		t.Fatalf("added=%v", added)
+	}
+
+	out = captureStdout(t, func() {
+		cmdPlaylist(context.Background(), []string{"remove-track", "--playlist-id", "PL1", "--playlist", "Dinner tonight", "--track-id", "T1", "--json"})
+	})
+	if !strings.Contains(out, `"removed": 1`) {
+		t.Fatalf("unexpected remove output: %s", out)
+	}
+}
+
+func TestCmdSearchUsesSearchLibrarySeam(t *testing.T) {
+	orig := searchLibrary
+	t.Cleanup(func() { searchLibrary = orig })
+
+	searchLibrary = func(_ context.Context, query, kind string, limit int) ([]music.LibraryItem, error) {
+		if query != "so what" || kind != "album" || limit != 5 {
+			t.Fatalf("query=%q kind=%q limit=%d", query, kind, limit)
+		}
+		return []music.LibraryItem{{Kind: "album", Name: "Kind of Blue", Artist: "Miles Davis", TrackIDs: []string{"T1", "T2"}}}, nil
+	}
+	out := captureStdout(t, func() {
+		cmdSearch(context.Background(), []string{"so", "what", "--type", "album", "--limit", "5", "--plain"})
+	})
+	if !strings.Contains(out, "Kind of Blue") || !strings.Contains(out, "T1,T2") || strings.Contains(out, "ALBUM") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestCmdRateValidatesAndUsesSeam(t *testing.T) {
+	origRating := setTrackRating
+	origGetNowPlaying := getNowPlaying
+	t.Cleanup(func() {
+		setTrackRating = origRating
+		getNowPlaying = origGetNowPlaying
+	})
+
+	got := -1
+	setTrackRating = func(_ context.Context, stars int) error {
+		got = stars
+		return nil
+	}
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{PlayerState: "playing"}, nil
+	}
+	out := captureStdout(t, func() { cmdRate(context.Background(), []string{"4", "--json"}) })
+	if got != 4 || !strings.Contains(out, `"action": "rate"`) {
+		t.Fatalf("stars=%d out=%s", got, out)
+	}
+}
+
+func TestCmdArtworkWritesFileAndRenders(t *testing.T) {
+	origExportArtwork := exportArtwork
+	t.Cleanup(func() { exportArtwork = origExportArtwork })
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	exportArtwork = func(_ context.Context, path string) (string, error) {
+		return "png", os.WriteFile(path, buf.Bytes(), 0o600)
+	}
+
+	out := filepath.Join(t.TempDir(), "cover.png")
+	got := captureStdout(t, func() {
+		cmdArtwork(context.Background(), []string{"--out", out, "--json"})
+	})
+	if !strings.Contains(got, `"format": "png"`) || !strings.Contains(got, out) {
+		t.Fatalf("unexpected output: %s", got)
+	}
+	if b, err := os.ReadFile(out); err != nil || !bytes.Equal(b, buf.Bytes()) {
+		t.Fatalf("artwork file not written: err=%v", err)
+	}
+
+	var rendered bytes.Buffer
+	if err := renderImageInline(&rendered, buf.Bytes(), "ansi", 4); err != nil {
+		t.Fatalf("renderImageInline ansi: %v", err)
+	}
+	if !strings.Contains(rendered.String(), "\x1b[38;2;255;255;255m\x1b[48;2;255;255;255m▀") {
+		t.Fatalf("unexpected ansi render: %q", rendered.String())
+	}
+	rendered.Reset()
+	if err := renderImageInline(&rendered, buf.Bytes(), "iterm", 4); err != nil || !strings.HasPrefix(rendered.String(), "\x1b]1337;File=inline=1;") {
+		t.Fatalf("unexpected iterm render err=%v out=%q", err, rendered.String())
+	}
+	rendered.Reset()
+	if err := renderImageInline(&rendered, buf.Bytes(), "kitty", 4); err != nil || !strings.HasPrefix(rendered.String(), "\x1b_Ga=T,f=100,c=4,m=0;") {
+		t.Fatalf("unexpected kitty render err=%v out=%q", err, rendered.String())
+	}
+
+	env := map[string]string{"TERM_PROGRAM": "iTerm.app"}
+	if got := detectImageProtocol(func(k string) string { return env[k] }); got != "iterm" {
+		t.Fatalf("detectImageProtocol=%q, want iterm", got)
+	}
+	env = map[string]string{"TERM": "xterm-kitty"}
+	if got := detectImageProtocol(func(k string) string { return env[k] }); got != "kitty" {
+		t.Fatalf("detectImageProtocol=%q, want kitty", got)
+	}
+}
+
+func TestCmdLyricsPrintsCurrentTrack(t *testing.T) {
+	origGetNowPlaying := getNowPlaying
+	origGetLyrics := getLyrics
+	t.Cleanup(func() {
+		getNowPlaying = origGetNowPlaying
+		getLyrics = origGetLyrics
+	})
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{PlayerState: "playing", Track: music.NowPlayingTrack{Name: "Song", Artist: "Band"}}, nil
+	}
+	getLyrics = func(context.Context) (string, error) { return "la la\nla", nil }
+
+	out := captureStdout(t, func() { cmdLyrics(context.Background(), nil) })
+	if out != "la la\nla\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	out = captureStdout(t, func() { cmdLyrics(context.Background(), []string{"--json"}) })
+	if !strings.Contains(out, `"track": "Song"`) || !strings.Contains(out, `"lyrics": "la la\nla"`) {
+		t.Fatalf("unexpected json output: %s", out)
+	}
+
+	getLyrics = func(context.Context) (string, error) { return "", music.ErrNoLyrics }
+	res := fetchLyrics(context.Background(), music.NowPlaying{Track: music.NowPlayingTrack{Name: "Song", Artist: "Band"}})
+	if got := formatLyricsBlock(res); got != "== Song - Band ==\n(no lyrics)\n" {
+		t.Fatalf("unexpected block: %q", got)
+	}
+}
+
+func TestHooksRunAroundCommand(t *testing.T) {
+	origLoad := loadConfigOptional
+	origRunHook := runHookCommand
+	origGetNowPlaying := getNowPlaying
+	t.Cleanup(func() {
+		loadConfigOptional = origLoad
+		runHookCommand = origRunHook
+		getNowPlaying = origGetNowPlaying
+		hookRun = nil
+	})
+	cfg := &native.Config{Hooks: map[string]string{"prePause": "echo before", "postPause": "notify"}}
+	loadConfigOptional = func() (*native.Config, error) { return cfg, nil }
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) { return music.NowPlaying{PlayerState: "paused"}, nil }
+	var ran []string
+	var postEnv []string
+	runHookCommand = func(_ context.Context, command string, env []string) ([]byte, error) {
+		ran = append(ran, command)
+		if command == "notify" {
+			postEnv = env
+			return []byte("lights dimmed"), errors.New("exit status 1")
+		}
+		return []byte("ok"), nil
+	}
+
+	beginHooks(cfg, "pause", nil)
+	runPreHook()
+	out := captureStdout(t, func() {
+		cmdTransport(context.Background(), []string{"--json"}, "pause", func(context.Context) error { return nil })
+	})
+	runPostHook(nil)
+	if strings.Join(ran, ",") != "echo before,notify" {
+		t.Fatalf("ran=%v", ran)
+	}
+	env := strings.Join(postEnv, "\n")
+	if !strings.Contains(env, "HOMEPODCTL_HOOK=postPause") || !strings.Contains(env, "HOMEPODCTL_ACTION=pause") || !strings.Contains(env, `HOMEPODCTL_RESULT={"ok":true,"action":"pause"`) {
+		t.Fatalf("post env=%v", postEnv)
+	}
+	if !strings.Contains(out, `"name": "prePause"`) || !strings.Contains(out, `"error": "exit status 1: lights dimmed"`) {
+		t.Fatalf("hooks missing from output: %s", out)
+	}
+
+	// A failing pre hook stops the command; dry runs run no hooks.
+	hookRun, ran = nil, nil
+	runHookCommand = func(context.Context, string, []string) ([]byte, error) { return nil, errors.New("boom") }
+	beginHooks(cfg, "pause", nil)
+	_, recovered := captureStdoutAndRecover(t, runPreHook)
+	if fatal, ok := recovered.(cliFatal); !ok || !strings.Contains(fatal.err.Error(), "hooks.prePause failed: boom") {
+		t.Fatalf("recovered=%v", recovered)
+	}
+	hookRun = nil
+	beginHooks(cfg, "pause", []string{"--dry-run"})
+	beginHooks(cfg, "status", nil)
+	if hookRun != nil {
+		t.Fatalf("hooks set up for a dry run or read-only command")
+	}
+	if hookName("post", "native-run") != "postNativeRun" || !isHookName("preVolume") || isHookName("preStatus") {
+		t.Fatalf("hook names")
+	}
+}
+
+func TestCmdRadioPlaysStation(t *testing.T) {
+	origStations, origBatch, origList := listStations, runMusicBatch, listAirPlayDevices
+	t.Cleanup(func() { listStations, runMusicBatch, listAirPlayDevices = origStations, origBatch, origList })
+
+	listStations = func(context.Context) ([]music.Station, error) {
+		return []music.Station{
+			{PersistentID: "ST1", Name: "Jazz Radio", Source: "library"},
+			{PersistentID: "ST2", Name: "Apple Music 1", Source: "library"},
+		}, nil
+	}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Kitchen", Available: true, Selected: true}}, nil
+	}
+	var ops []string
+	runMusicBatch = func(_ context.Context, b *music.Batch) (music.BatchResult, error) {
+		ops = b.Ops()
+		return music.BatchResult{NowPlaying: &music.NowPlaying{PlayerState: "playing", Source: "radio", Track: music.NowPlayingTrack{Name: "Apple Music 1"}}}, nil
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Kitchen"}}}
+	out := captureStdout(t, func() {
+		cmdRadio(context.Background(), cfg, []string{"apple music", "--volume", "30", "--json"})
+	})
+	want := "set outputs Kitchen|set volume Kitchen=30|play station ST2"
+	if got := strings.Join(ops, "|"); got != want {
+		t.Fatalf("ops=%q, want %q", got, want)
+	}
+	if !strings.Contains(out, `"station": "Apple Music 1"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdRadio(context.Background(), cfg, []string{"classical"})
+	})
+	if fatal, ok := recovered.(cliFatal); !ok || !strings.Contains(fatal.err.Error(), `no stations match "classical"`) {
+		t.Fatalf("recovered=%v", recovered)
+	}
+}
+
+func TestCmdPlayAppSpotify(t *testing.T) {
+	origPlay, origVolume, origNP := playSpotifyURI, setSpotifyVolume, getSpotifyNowPlaying
+	t.Cleanup(func() {
+		playSpotifyURI, setSpotifyVolume, getSpotifyNowPlaying = origPlay, origVolume, origNP
+	})
+
+	var calls []string
+	playSpotifyURI = func(_ context.Context, uri string) error {
+		calls = append(calls, "play "+uri)
+		return nil
+	}
+	setSpotifyVolume = func(_ context.Context, v int) error {
+		calls = append(calls, "volume "+strconv.Itoa(v))
+		return nil
+	}
+	getSpotifyNowPlaying = func(context.Context) (spotify.NowPlaying, error) {
+		return spotify.NowPlaying{PlayerState: "playing", Volume: 40, Track: spotify.Track{ID: "spotify:track:abc", Name: "So What"}}, nil
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Bedroom"}}}
+	out := captureStdout(t, func() {
+		cmdPlay(context.Background(), cfg, []string{"https://open.spotify.com/album/xyz?si=1", "--app", "spotify", "--volume", "30", "--json"})
+	})
+	if got := strings.Join(calls, "|"); got != "volume 30|play spotify:album:xyz" {
+		t.Fatalf("calls=%q", got)
+	}
+	if !strings.Contains(out, `"app": "spotify"`) || !strings.Contains(out, `"uri": "spotify:album:xyz"`) || !strings.Contains(out, `"source": "spotify"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	calls = nil
+	out = captureStdout(t, func() {
+		cmdVolume(context.Background(), cfg, "volume", []string{"+5", "--app", "spotify", "--json"})
+	})
+	if got := strings.Join(calls, "|"); got != "volume 45" || !strings.Contains(out, `"volume": 45`) {
+		t.Fatalf("calls=%q out=%s", got, out)
+	}
+
+	for _, args := range [][]string{
+		{"spotify:track:abc", "--app", "spotify", "--room", "Kitchen"},
+		{"chill", "--app", "spotify"},
+	} {
+		_, recovered := captureStdoutAndRecover(t, func() {
+			cmdPlay(context.Background(), cfg, args)
+		})
+		if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+			t.Fatalf("%v: recovered=%v", args, recovered)
+		}
+	}
+}
+
+func TestCmdMediaRoutesToFrontmostApp(t *testing.T) {
+	origResolve, origSend := resolveMediaRoute, sendMediaRoute
+	t.Cleanup(func() { resolveMediaRoute, sendMediaRoute = origResolve, origSend })
+
+	resolveMediaRoute = func(_ context.Context, key string) (mediakeys.Route, error) {
+		return mediakeys.Route{Action: key, Frontmost: "Safari", Via: mediakeys.ViaMediaKey}, nil
+	}
+	var sent []mediakeys.Route
+	sendMediaRoute = func(_ context.Context, r mediakeys.Route) error {
+		sent = append(sent, r)
+		return nil
+	}
+	out := captureStdout(t, func() { cmdMedia(context.Background(), []string{"next", "--json"}) })
+	if len(sent) != 1 || sent[0].Action != "next" {
+		t.Fatalf("sent=%+v", sent)
+	}
+	if !strings.Contains(out, `"key": "next"`) || !strings.Contains(out, `"via": "media-key"`) || !strings.Contains(out, `"frontmost": "Safari"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	sent = nil
+	captureStdout(t, func() { cmdMedia(context.Background(), []string{"playpause", "--dry-run"}) })
+	if len(sent) != 0 {
+		t.Fatalf("dry run sent %+v", sent)
+	}
+
+	for _, key := range []string{"stop", "pause"} {
+		_, recovered := captureStdoutAndRecover(t, func() { cmdMedia(context.Background(), []string{key}) })
+		if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+			t.Fatalf("%s: recovered=%v", key, recovered)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+)
+
+// statusTemplateData is what status --format templates see. Track and Source
+// are values, so {{.Track.Name}} prints nothing instead of failing when
+// nothing is playing.
+type statusTemplateData struct {
+	OK          bool
+	PlayerState string
+	Track       statusTrack
+	Source      statusSource
+	Volume      int // average over the outputs, 0 when there are none
+	Outputs     []statusOutput
+	Route       []string
+	Connection  statusConnection
+}
+
+var statusTemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// trunc shortens s to n runes, ending with … when it cut something.
+	"trunc": func(n int, s string) string {
+		r := []rune(s)
+		if n <= 0 || len(r) <= n {
+			return s
+		}
+		return string(r[:n-1]) + "…"
+	},
+}
+
+// parseStatusFormat parses a --format template, reporting syntax mistakes as
+// usage errors before the first poll.
+func parseStatusFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("format").Funcs(statusTemplateFuncs).Parse(format)
+	if err != nil {
+		return nil, usageErrf("invalid --format: %v", err)
+	}
+	return tmpl, nil
+}
+
+// renderStatusFormat renders res through tmpl as one line.
+func renderStatusFormat(tmpl *template.Template, res statusResult) (string, error) {
+	data := statusTemplateData{
+		OK:          res.OK,
+		PlayerState: res.Player,
+		Outputs:     res.Outputs,
+		Route:       res.Route,
+		Connection:  res.Connection,
+	}
+	if res.Track != nil {
+		data.Track = *res.Track
+	}
+	if res.Source != nil {
+		data.Source = *res.Source
+	}
+	if res.Volume != nil {
+		data.Volume = *res.Volume
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", usageErrf("--format: %v", err)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
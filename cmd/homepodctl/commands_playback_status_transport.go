@@ -2,12 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
 )
 
 type statusTrack struct {
@@ -20,12 +26,21 @@ type statusOutput struct {
 	DeviceName string `json:"deviceName"`
 	Room       string `json:"room"`
 	Volume     int    `json:"volume"`
-	Kind       string `json:"kind,omitempty"`
+	Kind       string `json:"kind,omitempty"` // as Music.app reports it
+	Type       string `json:"type,omitempty"` // homepod|tv|mac|speaker|bluetooth|unknown
+}
+
+// statusSource is what Music.app plays from; Name is the playlist, album, or
+// station.
+type statusSource struct {
+	Kind string `json:"kind"` // playlist|album|radio|library|cd|spotify|none|unknown
+	Name string `json:"name,omitempty"`
 }
 
 type statusConnection struct {
-	Music      string `json:"music"`      // connected|unreachable|missing|error
-	Automation string `json:"automation"` // granted|denied|unknown
+	Music      string `json:"music"`         // connected|unreachable|missing|error
+	App        string `json:"app,omitempty"` // running|launched|not-running
+	Automation string `json:"automation"`    // granted|denied|unknown
 	Message    string `json:"message,omitempty"`
 }
 
@@ -33,6 +48,7 @@ type statusResult struct {
 	OK         bool             `json:"ok"`
 	Player     string           `json:"player"`
 	Track      *statusTrack     `json:"track,omitempty"`
+	Source     *statusSource    `json:"source,omitempty"`
 	Volume     *int             `json:"volume,omitempty"`
 	Outputs    []statusOutput   `json:"outputs,omitempty"`
 	Route      []string         `json:"route,omitempty"`
@@ -40,6 +56,11 @@ type statusResult struct {
 }
 
 func collectStatus(ctx context.Context) (statusResult, error) {
+	return collectAppStatus(ctx, appMusic)
+}
+
+// collectAppStatus is collectStatus for the player --app picks.
+func collectAppStatus(ctx context.Context, player string) (statusResult, error) {
 	if _, err := lookPath("osascript"); err != nil {
 		return statusResult{
 			OK:     false,
@@ -52,9 +73,15 @@ func collectStatus(ctx context.Context) (statusResult, error) {
 		}, err
 	}
 
-	np, err := getNowPlaying(ctx)
+	np, err := appNowPlaying(player)(ctx)
 	if err != nil {
 		connection := inferStatusConnection(err)
+		if player == appMusic {
+			if running, runErr := musicAppRunning(ctx); runErr == nil && !running {
+				connection.Music = "unreachable"
+				connection.App = "not-running"
+			}
+		}
 		return statusResult{
 			OK:         false,
 			Player:     "unknown",
@@ -71,6 +98,7 @@ func collectStatus(ctx context.Context) (statusResult, error) {
 			Room:       o.Name,
 			Volume:     o.Volume,
 			Kind:       strings.TrimSpace(o.Kind),
+			Type:       music.DeviceType(o.Kind),
 		})
 		route = append(route, o.Name)
 		totalVolume += o.Volume
@@ -90,15 +118,34 @@ func collectStatus(ctx context.Context) (statusResult, error) {
 		}
 	}
 
+	var source *statusSource
+	if np.Source != "" {
+		source = &statusSource{Kind: np.Source}
+		switch np.Source {
+		case music.SourceAlbum:
+			source.Name = np.Track.Album
+		case music.SourceNone:
+		default:
+			source.Name = np.PlaylistName
+		}
+	}
+
+	noteTrack(np)
+	app := "running"
+	if player == appMusic && musicLaunched() {
+		app = "launched"
+	}
 	return statusResult{
 		OK:      true,
 		Player:  strings.TrimSpace(np.PlayerState),
 		Track:   track,
+		Source:  source,
 		Volume:  volume,
 		Outputs: outs,
 		Route:   route,
 		Connection: statusConnection{
 			Music:      "connected",
+			App:        app,
 			Automation: "granted",
 		},
 	}, nil
@@ -136,29 +183,94 @@ func inferStatusConnection(err error) statusConnection {
 	return c
 }
 
-func printStatus(res statusResult) {
-	fmt.Printf("ok=%t player=%s", res.OK, res.Player)
-	if res.Track != nil && strings.TrimSpace(res.Track.Name) != "" {
+// statusFieldNames are the blocks status --fields can select; ok is always
+// printed.
+var statusFieldNames = []string{"player", "track", "source", "volume", "outputs", "route", "connection"}
+
+// parseStatusFields reads --fields track,outputs into a set, or nil (every
+// block) when raw is empty.
+func parseStatusFields(raw string) (map[string]bool, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	fields := map[string]bool{}
+	for _, f := range splitList(raw) {
+		f = strings.ToLower(f)
+		if !containsString(statusFieldNames, f) {
+			return nil, usageErrf("unknown status field %q (expected %s)", f, strings.Join(statusFieldNames, ","))
+		}
+		fields[f] = true
+	}
+	return fields, nil
+}
+
+// selectStatusFields returns res as JSON limited to ok and the chosen blocks.
+func selectStatusFields(res statusResult, fields map[string]bool) any {
+	if fields == nil {
+		return res
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return res
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return res
+	}
+	out := map[string]json.RawMessage{"ok": all["ok"]}
+	for f := range fields {
+		if v, ok := all[f]; ok {
+			out[f] = v
+		}
+	}
+	return out
+}
+
+func printStatus(res statusResult, fields map[string]bool) {
+	show := func(name string) bool { return fields == nil || fields[name] }
+	fmt.Printf("ok=%t", res.OK)
+	if show("player") {
+		fmt.Printf(" player=%s", res.Player)
+	}
+	if show("track") && res.Track != nil && strings.TrimSpace(res.Track.Name) != "" {
 		fmt.Printf(" track=%q", res.Track.Name)
 	}
-	if res.Track != nil && strings.TrimSpace(res.Track.Artist) != "" {
+	if show("track") && res.Track != nil && strings.TrimSpace(res.Track.Artist) != "" {
 		fmt.Printf(" artist=%q", res.Track.Artist)
 	}
 	fmt.Println()
-	if len(res.Outputs) > 0 {
+	if show("source") && res.Source != nil {
+		fmt.Printf("source=%s", res.Source.Kind)
+		if res.Source.Name != "" {
+			fmt.Printf(" name=%q", res.Source.Name)
+		}
+		fmt.Println()
+	}
+	if show("outputs") && len(res.Outputs) > 0 {
 		parts := make([]string, 0, len(res.Outputs))
 		for _, o := range res.Outputs {
+			if o.Type != "" && o.Type != "unknown" {
+				parts = append(parts, fmt.Sprintf("%s(%s, vol=%d)", o.DeviceName, o.Type, o.Volume))
+				continue
+			}
 			parts = append(parts, fmt.Sprintf("%s(vol=%d)", o.DeviceName, o.Volume))
 		}
 		fmt.Printf("outputs=%s\n", strings.Join(parts, ", "))
 	}
-	if len(res.Route) > 0 {
+	if show("route") && len(res.Route) > 0 {
 		fmt.Printf("route=%s\n", strings.Join(res.Route, ", "))
 	}
-	if res.Volume != nil {
+	if show("volume") && res.Volume != nil {
 		fmt.Printf("volume=%d\n", *res.Volume)
 	}
-	fmt.Printf("music=%s automation=%s\n", res.Connection.Music, res.Connection.Automation)
+	if !show("connection") {
+		return
+	}
+	fmt.Printf("music=%s automation=%s", res.Connection.Music, res.Connection.Automation)
+	if res.Connection.App != "" {
+		fmt.Printf(" app=%s", res.Connection.App)
+	}
+	fmt.Println()
 	if strings.TrimSpace(res.Connection.Message) != "" {
 		fmt.Printf("message=%q\n", res.Connection.Message)
 	}
@@ -200,10 +312,10 @@ func printStatusPlain(res statusResult) {
 func cmdStatus(ctx context.Context, args []string) {
 	flags, positionals, err := parseArgs(args)
 	if err != nil {
-		die(usageErrf("usage: homepodctl status [--json] [--plain] [--watch <duration>]"))
+		die(usageErrf("usage: homepodctl status [--app music|spotify] [--json|--json-stream] [--plain] [--fields <list>] [--format <template>] [--watch <duration>] [--notify] [--dry-run]"))
 	}
 	if len(positionals) != 0 {
-		die(usageErrf("usage: homepodctl status [--json] [--plain] [--watch <duration>]"))
+		die(usageErrf("usage: homepodctl status [--app music|spotify] [--json|--json-stream] [--plain] [--fields <list>] [--format <template>] [--watch <duration>] [--notify] [--dry-run]"))
 	}
 	jsonOut, _, err := flags.boolStrict("json")
 	if err != nil {
@@ -213,6 +325,29 @@ func cmdStatus(ctx context.Context, args []string) {
 	if err != nil {
 		die(err)
 	}
+	jsonStream, _, err := flags.boolStrict("json-stream")
+	if err != nil {
+		die(err)
+	}
+	if jsonStream && jsonOut {
+		die(usageErrf("--json and --json-stream are mutually exclusive"))
+	}
+	fields, err := parseStatusFields(flags.string("fields"))
+	if err != nil {
+		die(err)
+	}
+	if fields != nil && plain && !jsonOut && !jsonStream {
+		die(usageErrf("--fields does not apply to --plain (its columns are fixed)"))
+	}
+	var format *template.Template
+	if raw := flags.string("format"); raw != "" {
+		if jsonOut || jsonStream || plain || fields != nil {
+			die(usageErrf("--format cannot be combined with --json, --json-stream, --plain, or --fields"))
+		}
+		if format, err = parseStatusFormat(raw); err != nil {
+			die(err)
+		}
+	}
 	watch := time.Duration(0)
 	if watchRaw := strings.TrimSpace(flags.string("watch")); watchRaw != "" {
 		parsed, parseErr := time.ParseDuration(watchRaw)
@@ -221,12 +356,53 @@ func cmdStatus(ctx context.Context, args []string) {
 		}
 		watch = parsed
 	}
-	debugf("status: json=%t plain=%t watch=%s", jsonOut, plain, watch.String())
+	notify, _, err := flags.boolStrict("notify")
+	if err != nil {
+		die(err)
+	}
+	if notify && watch <= 0 {
+		die(usageErrf("--notify requires --watch <duration>"))
+	}
+	// status is read-only; under --dry-run only the notifications are skipped.
+	if dryRun, _, err := flags.boolStrict("dry-run"); err != nil {
+		die(err)
+	} else if (dryRun || dryRunAll) && notify {
+		debugf("status: dry-run, not posting notifications")
+		notify = false
+	}
+	app, err := parseApp(flags)
+	if err != nil {
+		die(err)
+	}
+	debugf("status: app=%s json=%t json-stream=%t plain=%t watch=%s notify=%t", app, jsonOut, jsonStream, plain, watch.String(), notify)
+	loopCtx := ctx
+	if watch > 0 {
+		// watching runs until interrupted; each poll gets its own timeout instead.
+		loopCtx = context.WithoutCancel(ctx)
+	}
 	snapshots := 0
+	lastTrack := ""
 	printOnce := func() error {
-		res, err := collectStatus(ctx)
-		if jsonOut {
-			writeJSON(res)
+		pollCtx, cancel := context.WithTimeout(loopCtx, 15*time.Second)
+		defer cancel()
+		res, err := collectAppStatus(pollCtx, app)
+		if notify && res.Track != nil {
+			key := res.Track.Name + "\x00" + res.Track.Artist + "\x00" + res.Track.Album
+			if lastTrack != "" && key != lastTrack {
+				notifyTrackChange(pollCtx, *res.Track)
+			}
+			lastTrack = key
+		}
+		if format != nil {
+			line, fmtErr := renderStatusFormat(format, res)
+			if fmtErr != nil {
+				return fmtErr
+			}
+			fmt.Println(line)
+		} else if jsonStream {
+			writeJSONLine(selectStatusFields(res, fields))
+		} else if jsonOut {
+			writeJSON(selectStatusFields(res, fields))
 		} else if plain {
 			printStatusPlain(res)
 		} else {
@@ -237,15 +413,34 @@ func cmdStatus(ctx context.Context, args []string) {
 				snapshots++
 				fmt.Println(formatStatusSnapshotHeader(time.Now(), snapshots))
 			}
-			printStatus(res)
+			printStatus(res, fields)
 		}
 		return err
 	}
-	if err := runStatusLoop(ctx, watch, printOnce); err != nil {
+	if err := runStatusLoop(loopCtx, watch, printOnce); err != nil {
 		die(err)
 	}
 }
 
+// notifyTrackChange posts a notification for track, with its artwork when
+// Music.app has some. Failures are only logged: a missed notification should
+// not stop the watch.
+func notifyTrackChange(ctx context.Context, track statusTrack) {
+	n := native.Notification{Title: track.Name, Subtitle: track.Artist, Message: track.Album}
+	if n.Message == "" {
+		n.Message = track.Artist
+	}
+	artPath := filepath.Join(os.TempDir(), "homepodctl-notify-artwork")
+	if _, err := exportArtwork(ctx, artPath); err == nil {
+		n.ImagePath = artPath
+	} else {
+		debugf("notify: artwork: %v", err)
+	}
+	if err := postNotification(ctx, n); err != nil {
+		fmt.Fprintf(os.Stderr, "homepodctl: notification failed: %v\n", err)
+	}
+}
+
 func runStatusLoop(ctx context.Context, watch time.Duration, printOnce func() error) error {
 	if watch <= 0 {
 		return printOnce()
@@ -274,18 +469,68 @@ func cmdTransport(ctx context.Context, args []string, action string, fn func(con
 		die(err)
 	}
 	if len(positionals) != 0 {
-		die(usageErrf("usage: homepodctl %s [--json] [--plain]", action))
+		die(usageErrf("usage: homepodctl %s [--json] [--plain] [--dry-run]", action))
 	}
-	jsonOut, plainOut, err := parseOutputFlags(flags)
+	opts, err := parseOutputOptions(flags)
 	if err != nil {
 		die(err)
 	}
+	app, err := parseApp(flags)
+	if err != nil {
+		die(err)
+	}
+	if app != appMusic {
+		if len(flags.strings("room")) > 0 {
+			die(usageErrf("%s --room changes Music.app outputs; it does not apply to --app %s", action, app))
+		}
+		if fn = appTransports[app][action]; fn == nil {
+			die(usageErrf("%s is not supported with --app %s", action, app))
+		}
+	}
+	if opts.DryRun {
+		writeActionOutput(action, opts.JSON, opts.Plain, actionOutput{DryRun: true})
+		return
+	}
 	if err := fn(ctx); err != nil {
 		die(err)
 	}
-	if np, err := getNowPlaying(ctx); err == nil {
+	writeAppTransportOutput(ctx, app, action, opts.JSON, opts.Plain)
+}
+
+func writeTransportOutput(ctx context.Context, action string, jsonOut, plainOut bool) {
+	writeAppTransportOutput(ctx, appMusic, action, jsonOut, plainOut)
+}
+
+func writeAppTransportOutput(ctx context.Context, app, action string, jsonOut, plainOut bool) {
+	if np, err := appNowPlaying(app)(ctx); err == nil {
 		writeActionOutput(action, jsonOut, plainOut, actionOutput{NowPlaying: &np})
 		return
 	}
 	writeActionOutput(action, jsonOut, plainOut, actionOutput{})
 }
+
+func cmdRate(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 1 {
+		die(usageErrf("usage: homepodctl rate <0-5> [--json] [--plain] [--dry-run]"))
+	}
+	stars, err := strconv.Atoi(strings.TrimSpace(positionals[0]))
+	if err != nil || stars < 0 || stars > 5 {
+		die(usageErrf("rating must be 0-5 (got %q)", positionals[0]))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	if opts.DryRun {
+		writeActionOutput("rate", opts.JSON, opts.Plain, actionOutput{DryRun: true})
+		return
+	}
+	if err := setTrackRating(ctx, stars); err != nil {
+		die(err)
+	}
+	writeTransportOutput(ctx, "rate", opts.JSON, opts.Plain)
+}
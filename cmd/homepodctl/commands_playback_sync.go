@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+// A synchronized play waits up to syncReadyTimeout, polling every
+// syncPollInterval, for its rooms to be ready, then lets the paused playback
+// buffer for syncBuffer before starting it.
+const (
+	syncReadyTimeout = 10 * time.Second
+	syncPollInterval = 500 * time.Millisecond
+	syncBuffer       = 1500 * time.Millisecond
+)
+
+// syncPlay is play --synchronized. Music.app streams to each AirPlay device
+// as soon as it joins, so a plain multi-room play can start in one room a
+// second before the others. syncPlay runs setup (outputs, volumes, shuffle),
+// waits for every room to be selected and available, then starts the
+// playlist primed and paused before playing it everywhere at once. The
+// result holds the steps of every batch it ran.
+func syncPlay(ctx context.Context, rooms []string, setup *music.Batch, start func(*music.Batch), seek float64) (music.BatchResult, error) {
+	res, err := runMusicBatch(ctx, setup)
+	if err != nil {
+		return res, err
+	}
+	if err := waitOutputsReady(ctx, rooms); err != nil {
+		return res, err
+	}
+	started, err := startPrimed(ctx, start, seek)
+	started.Steps = append(res.Steps, started.Steps...)
+	return started, err
+}
+
+// waitOutputsReady polls the AirPlay devices until every room reports
+// selected and available.
+func waitOutputsReady(ctx context.Context, rooms []string) error {
+	if len(rooms) == 0 {
+		return nil
+	}
+	var pending []string
+	for waited := time.Duration(0); ; waited += syncPollInterval {
+		devs, err := listAirPlayDevices(ctx)
+		if err != nil {
+			return err
+		}
+		pending = outputsNotReady(rooms, devs)
+		if len(pending) == 0 {
+			return nil
+		}
+		debugf("sync: waiting for %v", pending)
+		if waited+syncPollInterval > syncReadyTimeout {
+			break
+		}
+		if err := sleepCtx(ctx, syncPollInterval); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("synchronized play: %s not selected and available after %s (drop --synchronized to start anyway)", strings.Join(pending, ", "), syncReadyTimeout)
+}
+
+// sleepContext waits d, returning ctx.Err() early once ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// outputsNotReady returns the rooms devs does not list as both selected and
+// available.
+func outputsNotReady(rooms []string, devs []music.AirPlayDevice) []string {
+	var pending []string
+	for _, room := range rooms {
+		ready := false
+		for _, d := range devs {
+			if strings.EqualFold(strings.TrimSpace(d.Name), strings.TrimSpace(room)) {
+				ready = d.Selected && d.Available
+				break
+			}
+		}
+		if !ready {
+			pending = append(pending, room)
+		}
+	}
+	return pending
+}
+
+// startPrimed starts the playlist with start and pauses it in the same
+// osascript run, rewinds to seek, waits syncBuffer for the devices to
+// buffer, then plays and reads now playing.
+func startPrimed(ctx context.Context, start func(*music.Batch), seek float64) (music.BatchResult, error) {
+	prime := music.NewBatch()
+	start(prime)
+	prime.Pause().Seek(seek)
+	debugf("sync: prime=%q", prime.Ops())
+	res, err := runMusicBatch(ctx, prime)
+	if err != nil {
+		return res, err
+	}
+	if err := sleepCtx(ctx, syncBuffer); err != nil {
+		return res, err
+	}
+	played, err := runMusicBatch(ctx, music.NewBatch().Play().NowPlaying())
+	played.Steps = append(res.Steps, played.Steps...)
+	return played, err
+}
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"math"
+	"os"
 	"strconv"
 	"strings"
 
+	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
 
+// volumeTarget is the level requested for one room. Relative targets are
+// deltas against the room's current AirPlay volume.
+type volumeTarget struct {
+	Room     string
+	Value    int
+	Relative bool
+}
+
 func cmdVolume(ctx context.Context, cfg *native.Config, name string, args []string) {
 	flags, positionals, err := parseArgs(args)
 	if err != nil {
@@ -18,99 +30,385 @@ func cmdVolume(ctx context.Context, cfg *native.Config, name string, args []stri
 	if err != nil {
 		die(err)
 	}
+	if app, err := parseApp(flags); err != nil {
+		die(err)
+	} else if app != appMusic {
+		cmdAppVolume(ctx, app, name, flags, positionals, opts)
+		return
+	}
+	exact, _, err := flags.boolStrict("exact")
+	if err != nil {
+		die(err)
+	}
+	syncAll, _, err := flags.boolStrict("sync")
+	if err != nil {
+		die(err)
+	}
+	force, _, err := flags.boolStrict("force")
+	if err != nil {
+		die(err)
+	}
+	noInput, _, err := flags.boolStrict("no-input")
+	if err != nil {
+		die(err)
+	}
+	ask := volumePrompter(opts, force, noInput)
 	backend := strings.TrimSpace(flags.string("backend"))
 	if backend == "" {
 		backend = cfg.Defaults.Backend
 	}
+	usageLine := fmt.Sprintf("usage: homepodctl %s <0-100|+N|-N> [<room> ...] | <room>=<level> ... [--backend airplay|native] [--exact] [--force] [--no-input]", name)
 
-	value := -1
-	if v, ok, err := flags.intStrict("value"); err != nil {
-		die(err)
-	} else if ok {
-		value = v
-	} else if v, ok, err := flags.intStrict("volume"); err != nil {
-		die(err)
-	} else if ok {
-		value = v
+	raw := ""
+	for _, key := range []string{"value", "volume"} {
+		if flags.has(key) {
+			raw = strings.TrimSpace(flags.string(key))
+			if raw == "" {
+				die(usageErrf("--%s requires a value", key))
+			}
+			if _, _, ok := parseVolumeLevel(raw); !ok {
+				die(usageErrf("invalid --%s %q", key, raw))
+			}
+			break
+		}
 	}
-	if value < 0 && len(positionals) > 0 {
-		v, err := strconv.Atoi(positionals[0])
+
+	var targets []volumeTarget
+	if raw == "" && len(positionals) > 0 && strings.Contains(positionals[0], "=") {
+		if syncAll {
+			die(usageErrf("--sync sets one level for every selected output; drop the <room>=<level> pairs"))
+		}
+		targets, err = parseVolumeAssignments(cfg, positionals)
 		if err != nil {
-			die(usageErrf("usage: homepodctl %s <0-100> [<room> ...] [--backend airplay|native]", name))
+			die(err)
+		}
+	} else {
+		if raw == "" {
+			if len(positionals) == 0 {
+				die(usageErrf("%s", usageLine))
+			}
+			raw = positionals[0]
+			positionals = positionals[1:]
+		}
+		value, relative, ok := parseVolumeLevel(raw)
+		if !ok {
+			die(usageErrf("%s", usageLine))
+		}
+		if err := validateVolumeLevel(value, relative); err != nil {
+			die(err)
+		}
+		if syncAll {
+			if len(positionals) > 0 || flags.has("room") {
+				die(usageErrf("--sync scales every selected output; it takes no rooms"))
+			}
+			if backend != "airplay" {
+				die(usageErrf("--sync requires backend=airplay"))
+			}
+			syncVolume(ctx, cfg, name, opts, value, relative, force, ask)
+			return
 		}
-		value = v
-		positionals = positionals[1:]
-	}
-	if value < 0 || value > 100 {
-		die(usageErrf("volume must be 0-100"))
-	}
 
-	rooms := append([]string(nil), flags.strings("room")...)
-	if len(rooms) == 0 && len(positionals) > 0 {
-		rooms = append(rooms, positionals...)
+		rooms := append([]string(nil), flags.strings("room")...)
+		if len(rooms) == 0 && len(positionals) > 0 {
+			rooms = append(rooms, positionals...)
+		}
+		if len(rooms) == 0 {
+			rooms = append(rooms, cfg.Defaults.Rooms...)
+		}
+		rooms = cfg.ExpandRooms(rooms)
+		if len(rooms) == 0 && backend == "airplay" {
+			rooms = inferSelectedOutputs(ctx)
+		}
+		for _, room := range rooms {
+			targets = append(targets, volumeTarget{Room: room, Value: value, Relative: relative})
+		}
 	}
-	if len(rooms) == 0 {
-		rooms = append(rooms, cfg.Defaults.Rooms...)
+	rooms := make([]string, 0, len(targets))
+	for _, t := range targets {
+		rooms = append(rooms, t.Room)
+	}
+	if backend == "airplay" {
+		if rooms, err = resolveRooms(ctx, rooms, exact); err != nil {
+			die(err)
+		}
+		for i := range targets {
+			targets[i].Room = rooms[i]
+		}
 	}
 
 	switch backend {
 	case "airplay":
-		if len(rooms) == 0 {
-			rooms = inferSelectedOutputs(ctx)
-		}
-		if len(rooms) == 0 {
+		if len(targets) == 0 {
 			die(usageErrf("no rooms provided (pass room names, set defaults.rooms via `homepodctl config-init`, or select outputs in Music.app / `homepodctl out set`)"))
 		}
-		debugf("%s: backend=airplay value=%d rooms=%v", name, value, rooms)
+		resolved, err := resolveVolumeTargets(ctx, cfg, targets)
+		if err != nil {
+			die(err)
+		}
+		debugf("%s: backend=airplay targets=%v resolved=%v", name, targets, resolved)
 		if opts.DryRun {
 			writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
-				DryRun:  true,
-				Backend: backend,
-				Rooms:   rooms,
+				DryRun:     true,
+				Backend:    backend,
+				Rooms:      rooms,
+				QuietHours: activeQuietHours(cfg, rooms),
 			})
 			return
 		}
-		if err := setVolumeForRooms(ctx, rooms, value); err != nil {
+		if resolved, err = guardVolumeTargets(cfg, resolved, force, ask); err != nil {
 			die(err)
 		}
+		for _, t := range resolved {
+			if err := setDeviceVolume(ctx, t.Room, t.Value); err != nil {
+				die(err)
+			}
+		}
 		if np, err := getNowPlaying(ctx); err == nil {
 			writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
 				Backend:    backend,
 				Rooms:      rooms,
+				QuietHours: activeQuietHours(cfg, rooms),
 				NowPlaying: &np,
 			})
 		} else {
 			writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
-				Backend: backend,
-				Rooms:   rooms,
+				Backend:    backend,
+				Rooms:      rooms,
+				QuietHours: activeQuietHours(cfg, rooms),
 			})
 		}
 	case "native":
-		debugf("%s: backend=native value=%d rooms=%v", name, value, rooms)
+		for _, t := range targets {
+			if t.Relative {
+				die(usageErrf("relative volume requires backend=airplay (native volume shortcuts are discrete)"))
+			}
+		}
+		debugf("%s: backend=native targets=%v", name, targets)
 		if opts.DryRun {
 			writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
-				DryRun:  true,
-				Backend: backend,
-				Rooms:   rooms,
+				DryRun:     true,
+				Backend:    backend,
+				Rooms:      rooms,
+				QuietHours: activeQuietHours(cfg, rooms),
 			})
 			return
 		}
-		if err := runNativeVolumeShortcuts(ctx, cfg, rooms, value); err != nil {
-			die(fmt.Errorf("%w (config-native volume is discrete)", err))
+		if targets, err = guardVolumeTargets(cfg, targets, force, ask); err != nil {
+			die(err)
+		}
+		for _, t := range targets {
+			if err := runNativeVolumeShortcuts(ctx, cfg, []string{t.Room}, t.Value, true); err != nil {
+				die(fmt.Errorf("%w (config-native volume is discrete)", err))
+			}
 		}
 		if np, err := getNowPlaying(ctx); err == nil {
 			writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
 				Backend:    backend,
 				Rooms:      rooms,
+				QuietHours: activeQuietHours(cfg, rooms),
 				NowPlaying: &np,
 			})
 		} else {
 			writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
-				Backend: backend,
-				Rooms:   rooms,
+				Backend:    backend,
+				Rooms:      rooms,
+				QuietHours: activeQuietHours(cfg, rooms),
 			})
 		}
 	default:
-		die(usageErrf("unknown backend: %q", backend))
+		die(backendError(backend))
+	}
+}
+
+// syncVolume moves Music.app's master volume and scales the selected outputs
+// with it in one batch.
+func syncVolume(ctx context.Context, cfg *native.Config, name string, opts outputOptions, value int, relative, force bool, ask *prompter) {
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		die(err)
+	}
+	master, targets, err := syncVolumeTargets(devs, value, relative)
+	if err != nil {
+		die(err)
+	}
+	rooms := make([]string, 0, len(targets))
+	for _, t := range targets {
+		rooms = append(rooms, t.Room)
+	}
+	debugf("%s: backend=airplay sync master=%d targets=%v", name, master, targets)
+	if opts.DryRun {
+		writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
+			DryRun:     true,
+			Backend:    "airplay",
+			Rooms:      rooms,
+			QuietHours: activeQuietHours(cfg, rooms),
+		})
+		return
+	}
+	if targets, err = guardVolumeTargets(cfg, targets, force, ask); err != nil {
+		die(err)
+	}
+	b := music.NewBatch().SetSoundVolume(master)
+	for _, t := range targets {
+		b.SetVolume(t.Room, t.Value)
+	}
+	res, err := runMusicBatch(ctx, b.NowPlaying())
+	if err != nil {
+		die(err)
+	}
+	writeActionOutput(name, opts.JSON, opts.Plain, actionOutput{
+		Backend:    "airplay",
+		Rooms:      rooms,
+		QuietHours: activeQuietHours(cfg, rooms),
+		NowPlaying: res.NowPlaying,
+	})
+}
+
+// syncVolumeTargets mimics Music.app's volume slider across an AirPlay group:
+// the slider sits at the loudest selected output, and moving it scales every
+// selected output by the same factor. Outputs all at 0 jump straight to the
+// new level. It returns the new master volume and the per-device levels.
+func syncVolumeTargets(devs []music.AirPlayDevice, value int, relative bool) (int, []volumeTarget, error) {
+	var selected []music.AirPlayDevice
+	old := 0
+	for _, d := range devs {
+		if d.Selected {
+			selected = append(selected, d)
+			old = max(old, d.Volume)
+		}
+	}
+	if len(selected) == 0 {
+		return 0, nil, usageErrf("no AirPlay outputs selected (select outputs in Music.app or with `homepodctl out set`)")
+	}
+	master := value
+	if relative {
+		master = max(0, min(100, old+value))
+	}
+	targets := make([]volumeTarget, 0, len(selected))
+	for _, d := range selected {
+		v := master
+		if old > 0 {
+			v = int(math.Round(float64(d.Volume) * float64(master) / float64(old)))
+		}
+		targets = append(targets, volumeTarget{Room: d.Name, Value: max(0, min(100, v))})
+	}
+	return master, targets, nil
+}
+
+// volumePrompter returns the prompter guardVolumeTargets confirms levels
+// above the cap with: none with --force or without a terminal, and one that
+// answers yes itself with --yes.
+func volumePrompter(opts outputOptions, force, noInput bool) *prompter {
+	switch {
+	case force:
+	case opts.Yes:
+		return &prompter{out: os.Stderr, yes: true}
+	case !noInput && isInteractiveStdin():
+		return &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	}
+	return nil
+}
+
+// guardVolumeTargets checks every level against its room's volumeLimit before
+// any is set. Above the cap, force keeps the level; otherwise ask confirms it
+// (declining changes nothing), and without ask the level is held at the cap.
+func guardVolumeTargets(cfg *native.Config, targets []volumeTarget, force bool, ask *prompter) ([]volumeTarget, error) {
+	out := make([]volumeTarget, 0, len(targets))
+	for _, t := range targets {
+		limit, quietName, ok := volumeLimit(cfg, t.Room)
+		switch {
+		case !ok || t.Value <= limit || force:
+		case ask == nil:
+			t.Value = capVolume(cfg, t.Room, t.Value)
+		default:
+			label := limitLabel(limit, quietName)
+			yes, err := ask.confirm(fmt.Sprintf("%s: %d is above %s. Set it anyway?", t.Room, t.Value, label), false)
+			if err != nil {
+				return nil, err
+			}
+			if !yes {
+				return nil, fmt.Errorf("volume unchanged: %d is above the %s of %s (use --force to override)", t.Value, label, t.Room)
+			}
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// parseVolumeLevel parses "30" (absolute) or "+5"/"-10" (relative).
+func parseVolumeLevel(s string) (value int, relative bool, ok bool) {
+	s = strings.TrimSpace(s)
+	relative = strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-")
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false, false
+	}
+	return n, relative, true
+}
+
+func validateVolumeLevel(value int, relative bool) error {
+	if relative {
+		if value < -100 || value > 100 {
+			return usageErrf("relative volume must be -100..+100")
+		}
+		return nil
+	}
+	if value < 0 || value > 100 {
+		return usageErrf("volume must be 0-100")
+	}
+	return nil
+}
+
+// parseVolumeAssignments parses room=level pairs such as Bedroom=30 or
+// Kitchen=+5. Group names expand to each member room.
+func parseVolumeAssignments(cfg *native.Config, args []string) ([]volumeTarget, error) {
+	var targets []volumeTarget
+	for _, arg := range args {
+		room, level, ok := strings.Cut(arg, "=")
+		room = strings.TrimSpace(room)
+		if !ok || room == "" {
+			return nil, usageErrf("invalid room volume %q (expected <room>=<level>, e.g. Bedroom=30)", arg)
+		}
+		value, relative, ok := parseVolumeLevel(level)
+		if !ok {
+			return nil, usageErrf("invalid room volume %q (expected <room>=<level>, e.g. Bedroom=30)", arg)
+		}
+		if err := validateVolumeLevel(value, relative); err != nil {
+			return nil, err
+		}
+		for _, r := range cfg.ExpandRooms([]string{room}) {
+			targets = append(targets, volumeTarget{Room: r, Value: value, Relative: relative})
+		}
+	}
+	return targets, nil
+}
+
+// resolveVolumeTargets turns targets into absolute device volumes. Absolute
+// levels get the room's configured offset; relative levels are applied to the
+// current device volume, read once via listAirPlayDevices.
+func resolveVolumeTargets(ctx context.Context, cfg *native.Config, targets []volumeTarget) ([]volumeTarget, error) {
+	var current map[string]int
+	out := make([]volumeTarget, 0, len(targets))
+	for _, t := range targets {
+		if !t.Relative {
+			out = append(out, volumeTarget{Room: t.Room, Value: cfg.AdjustVolume(t.Room, t.Value)})
+			continue
+		}
+		if current == nil {
+			devs, err := listAirPlayDevices(ctx)
+			if err != nil {
+				return nil, err
+			}
+			current = make(map[string]int, len(devs))
+			for _, d := range devs {
+				current[strings.ToLower(strings.TrimSpace(d.Name))] = d.Volume
+			}
+		}
+		v, ok := current[strings.ToLower(strings.TrimSpace(t.Room))]
+		if !ok {
+			return nil, usageErrf("unknown room %q (run `homepodctl devices` to list names)", t.Room)
+		}
+		out = append(out, volumeTarget{Room: t.Room, Value: max(0, min(100, v+t.Value))})
 	}
+	return out, nil
 }
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    *jsonErrorPayload `json:"data,omitempty"`
+}
+
+type rpcPlayParams struct {
+	Playlist   string   `json:"playlist"`
+	PlaylistID string   `json:"playlistId"`
+	Backend    string   `json:"backend"`
+	Rooms      []string `json:"rooms"`
+	Volume     *int     `json:"volume"`
+	Shuffle    *bool    `json:"shuffle"`
+	Force      bool     `json:"force"`
+	// Synchronized is play --synchronized.
+	Synchronized bool `json:"synchronized"`
+}
+
+type rpcVolumeParams struct {
+	Value   *int     `json:"value"`
+	Backend string   `json:"backend"`
+	Rooms   []string `json:"rooms"`
+	Force   bool     `json:"force"`
+}
+
+type rpcOutputsParams struct {
+	Set []string `json:"set"`
+}
+
+type rpcAutomationParams struct {
+	File       string          `json:"file"`
+	Automation *automationFile `json:"automation"`
+	DryRun     bool            `json:"dryRun"`
+}
+
+func cmdRPC(ctx context.Context, cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	stdio, _, err := flags.boolStrict("stdio")
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 || !stdio {
+		die(usageErrf("usage: homepodctl rpc --stdio"))
+	}
+	// The server lives as long as its client keeps stdin open; each call gets
+	// its own timeout instead of the per-command one.
+	if err := serveRPC(context.WithoutCancel(ctx), cfg, os.Stdin, os.Stdout); err != nil {
+		die(err)
+	}
+}
+
+// serveRPC reads newline-delimited JSON-RPC 2.0 requests from r and writes one
+// response line per request to w. Notifications (no id) get no response.
+func serveRPC(ctx context.Context, cfg *native.Config, r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	enc := json.NewEncoder(w)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			_ = enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: "parse error: " + err.Error()}})
+			continue
+		}
+		debugf("rpc: method=%q id=%s", req.Method, req.ID)
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+		if req.JSONRPC != "2.0" || strings.TrimSpace(req.Method) == "" {
+			resp.Error = &rpcError{Code: rpcInvalidRequest, Message: `invalid request (expected "jsonrpc":"2.0" and a method)`}
+		} else {
+			resp.Result, resp.Error = dispatchRPC(ctx, cfg, req)
+		}
+		if len(req.ID) == 0 {
+			continue
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func dispatchRPC(ctx context.Context, cfg *native.Config, req rpcRequest) (any, *rpcError) {
+	timeout := 30 * time.Second
+	if req.Method == "automation.run" {
+		timeout = 15 * time.Minute
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch req.Method {
+	case "status":
+		np, err := getNowPlaying(callCtx)
+		if err != nil {
+			return nil, rpcErrorFrom(err)
+		}
+		return np, nil
+	case "play":
+		var p rpcPlayParams
+		if rerr := decodeRPCParams(req.Params, &p); rerr != nil {
+			return nil, rerr
+		}
+		if strings.TrimSpace(p.Playlist) == "" && strings.TrimSpace(p.PlaylistID) == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "play requires playlist or playlistId"}
+		}
+		defaults := resolveAutomationDefaults(cfg, automationDefaults{Backend: p.Backend, Rooms: p.Rooms, Volume: p.Volume, Shuffle: p.Shuffle})
+		backend := strings.TrimSpace(defaults.Backend)
+		if backend == "" {
+			backend = "airplay"
+		}
+		st := automationStep{Type: "play", Query: p.Playlist, PlaylistID: p.PlaylistID, Force: p.Force, Synchronized: p.Synchronized}
+		if err := executeAutomationPlay(callCtx, cfg, backend, defaults, st); err != nil {
+			return nil, rpcErrorFrom(err)
+		}
+		return actionResult{OK: true, Action: "play", Backend: backend, Rooms: defaults.Rooms, QuietHours: activeQuietHours(cfg, defaults.Rooms), Playlist: p.Playlist, PlaylistID: p.PlaylistID}, nil
+	case "volume":
+		var p rpcVolumeParams
+		if rerr := decodeRPCParams(req.Params, &p); rerr != nil {
+			return nil, rerr
+		}
+		if p.Value == nil || *p.Value < 0 || *p.Value > 100 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "volume requires value 0..100"}
+		}
+		defaults := resolveAutomationDefaults(cfg, automationDefaults{Backend: p.Backend})
+		backend := strings.TrimSpace(defaults.Backend)
+		if backend == "" {
+			backend = "airplay"
+		}
+		rooms := cfg.ExpandRooms(p.Rooms)
+		if err := executeAutomationVolume(callCtx, cfg, backend, defaults, *p.Value, rooms, p.Force); err != nil {
+			return nil, rpcErrorFrom(err)
+		}
+		if len(rooms) == 0 {
+			rooms = defaults.Rooms
+		}
+		return actionResult{OK: true, Action: "volume", Backend: backend, Rooms: rooms}, nil
+	case "outputs":
+		var p rpcOutputsParams
+		if rerr := decodeRPCParams(req.Params, &p); rerr != nil {
+			return nil, rerr
+		}
+		if p.Set != nil {
+			rooms := cfg.ExpandRooms(p.Set)
+			if len(rooms) == 0 {
+				return nil, &rpcError{Code: rpcInvalidParams, Message: "outputs set requires at least one room"}
+			}
+			if err := setCurrentOutputs(callCtx, rooms); err != nil {
+				return nil, rpcErrorFrom(err)
+			}
+		}
+		devs, err := listAirPlayDevices(callCtx)
+		if err != nil {
+			return nil, rpcErrorFrom(err)
+		}
+		for i := range devs {
+			devs[i].NetworkAddress = ""
+		}
+		return devs, nil
+	case "automation.run":
+		var p rpcAutomationParams
+		if rerr := decodeRPCParams(req.Params, &p); rerr != nil {
+			return nil, rerr
+		}
+		doc := p.Automation
+		if doc == nil {
+			if strings.TrimSpace(p.File) == "" || p.File == "-" {
+				return nil, &rpcError{Code: rpcInvalidParams, Message: "automation.run requires file or automation"}
+			}
+			var err error
+			if doc, err = loadAutomationFile(p.File); err != nil {
+				return nil, rpcErrorFrom(err)
+			}
+		}
+		if err := validateAutomation(doc); err != nil {
+			return nil, rpcErrorFrom(err)
+		}
+		if p.DryRun {
+			return buildAutomationResult("dry-run", doc, resolveAutomationSteps(cfg, doc)), nil
+		}
+		steps, ok := executeAutomationSteps(callCtx, cfg, doc)
+		result := buildAutomationResult("run", doc, steps)
+		result.OK = ok
+		return result, nil
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q (supported: status, play, volume, outputs, automation.run)", req.Method)}
+	}
+}
+
+func decodeRPCParams(raw json.RawMessage, v any) *rpcError {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+// rpcErrorFrom maps command errors onto a JSON-RPC error, carrying the same
+// code and exit code the CLI would report in its --json error output.
+func rpcErrorFrom(err error) *rpcError {
+	code := rpcServerError
+	if classifyExitCode(err) == exitUsage {
+		code = rpcInvalidParams
+	}
+	return &rpcError{
+		Code:    code,
+		Message: formatError(err),
+		Data: &jsonErrorPayload{
+			Code:     classifyErrorCode(err),
+			Message:  formatError(err),
+			ExitCode: classifyExitCode(err),
+		},
+	}
+}
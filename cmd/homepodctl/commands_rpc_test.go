@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+func TestServeRPC(t *testing.T) {
+	origGetNowPlaying := getNowPlaying
+	origSetDeviceVolume := setDeviceVolume
+	t.Cleanup(func() {
+		getNowPlaying = origGetNowPlaying
+		setDeviceVolume = origSetDeviceVolume
+	})
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{PlayerState: "playing", Track: music.NowPlayingTrack{Name: "Song"}}, nil
+	}
+	volumes := map[string]int{}
+	setDeviceVolume = func(_ context.Context, room string, v int) error {
+		volumes[room] = v
+		return nil
+	}
+
+	cfg := &native.Config{}
+	cfg.Defaults.Backend = "airplay"
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"status"}`,
+		`{"jsonrpc":"2.0","id":"v","method":"volume","params":{"value":35,"rooms":["Kitchen"]}}`,
+		`{"jsonrpc":"2.0","method":"volume","params":{"value":20,"rooms":["Bedroom"]}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"nope"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"volume","params":{"value":101}}`,
+		`not json`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := serveRPC(context.Background(), cfg, strings.NewReader(in), &out); err != nil {
+		t.Fatalf("serveRPC: %v", err)
+	}
+
+	type response struct {
+		ID     json.RawMessage `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	var resps []response
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r response
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		resps = append(resps, r)
+	}
+	// The notification (no id) gets no response.
+	if len(resps) != 5 {
+		t.Fatalf("got %d responses, want 5: %s", len(resps), out.String())
+	}
+	if string(resps[0].ID) != "1" || !strings.Contains(string(resps[0].Result), `"Song"`) {
+		t.Fatalf("unexpected status response: %+v", resps[0])
+	}
+	if string(resps[1].ID) != `"v"` || resps[1].Error != nil || volumes["Kitchen"] != 35 || volumes["Bedroom"] != 20 {
+		t.Fatalf("unexpected volume response=%+v volumes=%v", resps[1], volumes)
+	}
+	if resps[2].Error == nil || resps[2].Error.Code != rpcMethodNotFound {
+		t.Fatalf("expected method not found, got %+v", resps[2])
+	}
+	if resps[3].Error == nil || resps[3].Error.Code != rpcInvalidParams {
+		t.Fatalf("expected invalid params, got %+v", resps[3])
+	}
+	if string(resps[4].ID) != "null" || resps[4].Error == nil || resps[4].Error.Code != rpcParseError {
+		t.Fatalf("expected parse error, got %+v", resps[4])
+	}
+}
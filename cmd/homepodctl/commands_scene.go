@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// sceneRow is one scene as `scene list` reports it.
+type sceneRow struct {
+	Name        string `json:"name"`
+	Steps       int    `json:"steps"`
+	Description string `json:"description,omitempty"`
+}
+
+func cmdScene(ctx context.Context, cfg *native.Config, args []string) {
+	if len(args) == 0 {
+		die(usageErrf("usage: homepodctl scene <list|run> [args]"))
+	}
+	switch args[0] {
+	case "list":
+		cmdSceneList(cfg, args[1:])
+	case "run":
+		cmdSceneRun(ctx, cfg, args[1:])
+	default:
+		die(usageErrf("unknown scene subcommand: %q (expected list or run)", args[0]))
+	}
+}
+
+func cmdSceneList(cfg *native.Config, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl scene list [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	rows := make([]sceneRow, 0, len(cfg.Scenes))
+	for _, name := range sceneNames(cfg) {
+		sc := cfg.Scenes[name]
+		rows = append(rows, sceneRow{Name: name, Steps: len(sc.Steps), Description: sc.Description})
+	}
+	if jsonOut {
+		writeJSON(rows)
+		return
+	}
+	if len(rows) == 0 {
+		fmt.Println("No scenes configured in config.json")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "NAME\tSTEPS\tDESCRIPTION")
+	}
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", row.Name, row.Steps, row.Description)
+	}
+	_ = tw.Flush()
+}
+
+func cmdSceneRun(ctx context.Context, cfg *native.Config, args []string) {
+	const usageLine = "usage: homepodctl scene run <name> [--dry-run] [--json]"
+	flags, positionals, err := parseArgs(args)
+	if err != nil || len(positionals) != 1 {
+		die(usageErrf("%s", usageLine))
+	}
+	doc, err := sceneAutomation(cfg, positionals[0])
+	if err != nil {
+		die(err)
+	}
+	dryRun, _, err := flags.boolStrict("dry-run")
+	if err != nil {
+		die(err)
+	}
+	jsonOut, _, err := flags.boolStrict("json")
+	if err != nil {
+		die(err)
+	}
+	runAutomationDoc(ctx, cfg, doc, "scene", dryRun || dryRunAll, jsonOut)
+}
+
+func sceneNames(cfg *native.Config) []string {
+	names := make([]string, 0, len(cfg.Scenes))
+	for name := range cfg.Scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sceneAutomation turns a configured scene into an automation document named
+// after it, so it validates, plans, and runs exactly like an automation file
+// whose defaults come from config.json.
+func sceneAutomation(cfg *native.Config, name string) (*automationFile, error) {
+	sc, ok := cfg.Scenes[name]
+	if !ok {
+		return nil, usageErrf("unknown scene: %q (run `homepodctl scene list` or edit config.json)", name)
+	}
+	doc := &automationFile{Version: "1", Name: name}
+	for i, raw := range sc.Steps {
+		var st automationStep
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return nil, automationValidationErrf("scenes.%s.steps[%d]: %v", name, i, err)
+		}
+		doc.Steps = append(doc.Steps, st)
+	}
+	if err := validateAutomation(doc); err != nil {
+		return nil, automationValidationErrf("scenes.%s.%v", name, err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The file schemas describe what users write rather than what commands
+// print, so editors can validate and complete routine and config files. They
+// mirror validateAutomation and validateConfigValues; keep them in step.
+
+func stringArray() map[string]any {
+	return map[string]any{"type": "array", "items": map[string]any{"type": "string", "minLength": 1}}
+}
+
+func percentInt() map[string]any {
+	return map[string]any{"type": "integer", "minimum": 0, "maximum": 100}
+}
+
+func durationString(desc string) map[string]any {
+	return map[string]any{"type": "string", "pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`, "description": desc}
+}
+
+func clockTime(desc string) map[string]any {
+	return map[string]any{"type": "string", "pattern": `^([01]?[0-9]|2[0-3]):[0-5][0-9]$`, "description": desc}
+}
+
+// requireWhen is an if/then clause: steps of the given type need fields.
+func requireWhen(stepType string, then map[string]any) map[string]any {
+	return map[string]any{
+		"if":   map[string]any{"properties": map[string]any{"type": map[string]any{"const": stepType}}, "required": []any{"type"}},
+		"then": then,
+	}
+}
+
+var automationFileSchema = map[string]any{
+	"$schema":              "https://json-schema.org/draft/2020-12/schema",
+	"title":                "homepodctl automation file",
+	"type":                 "object",
+	"required":             []any{"version", "name", "steps"},
+	"additionalProperties": false,
+	"properties": map[string]any{
+		"version": map[string]any{"const": "1", "description": `Format version; quote it in YAML ("1").`},
+		"name":    map[string]any{"type": "string", "minLength": 1},
+		"defaults": map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"backend": map[string]any{"enum": []any{"airplay", "native"}},
+				"rooms":   stringArray(),
+				"volume":  percentInt(),
+				"shuffle": map[string]any{"type": "boolean"},
+			},
+		},
+		"steps": map[string]any{
+			"type":     "array",
+			"minItems": 1,
+			"items":    map[string]any{"$ref": "#/$defs/step"},
+		},
+	},
+	"$defs": map[string]any{
+		"step": map[string]any{
+			"type":                 "object",
+			"required":             []any{"type"},
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"type":         map[string]any{"enum": []any{"out.set", "play", "volume.set", "duck", "unduck", "wait", "transport", "shuffle.set", "repeat.set", "seek", "notify", "webhook", "shortcut", "parallel"}},
+				"rooms":        stringArray(),
+				"query":        map[string]any{"type": "string", "description": "Playlist name to search for (play)."},
+				"playlistId":   map[string]any{"type": "string", "description": "Playlist persistent ID (play)."},
+				"station":      map[string]any{"type": "string", "description": "Radio station to search for instead of a playlist; airplay only (play)."},
+				"value":        percentInt(),
+				"state":        map[string]any{"enum": []any{"playing", "paused", "stopped"}},
+				"until":        map[string]any{"type": "string", "description": "Condition to wait for, e.g. track-change or position>=30."},
+				"timeout":      durationString("Wait limit, between 1s and 10m (wait), or request timeout, between 1s and 2m (webhook)."),
+				"action":       map[string]any{"enum": []any{"play", "pause", "playpause", "stop", "next", "prev"}},
+				"enabled":      map[string]any{"type": "boolean"},
+				"mode":         map[string]any{"enum": []any{"off", "one", "all", "songs", "albums", "groupings"}, "description": "Repeat mode (repeat.set) or shuffle mode (shuffle.set)."},
+				"position":     map[string]any{"type": "number", "minimum": 0},
+				"for":          durationString("How long to keep rooms ducked; a running daemon restores them (duck)."),
+				"title":        map[string]any{"type": "string", "description": "Notification title template; defaults to the routine name (notify)."},
+				"message":      map[string]any{"type": "string", "minLength": 1, "description": "Notification text, a Go template such as {{.Track.Name}} (notify)."},
+				"url":          map[string]any{"type": "string", "pattern": "^https?://", "description": "Where to POST (webhook)."},
+				"payload":      map[string]any{"description": "JSON body; strings are templates. Defaults to the routine name and player status (webhook)."},
+				"retries":      map[string]any{"type": "integer", "minimum": 0, "maximum": maxWebhookRetries},
+				"name":         map[string]any{"type": "string", "minLength": 1, "description": "Shortcut to run (shortcut)."},
+				"input":        map[string]any{"type": "string", "description": "Text input for the shortcut, a template as for notify (shortcut)."},
+				"force":        map[string]any{"type": "boolean", "description": "Go above the rooms' maxVolume and play through blocking quiet hours (play, volume.set)."},
+				"synchronized": map[string]any{"type": "boolean", "description": "Start play in every room at once, like play --synchronized (play only)."},
+				"steps":        map[string]any{"type": "array", "minItems": 1, "items": map[string]any{"$ref": "#/$defs/step"}, "description": "Steps run concurrently; they cannot be parallel blocks themselves (parallel)."},
+				"concurrency":  map[string]any{"type": "integer", "minimum": 1, "maximum": maxParallelConcurrency, "description": "Most branches running at once, default 4 (parallel)."},
+				"failOn":       map[string]any{"enum": []any{"any", "all"}, "description": "Fail the block when any branch fails (default) or only when all do (parallel)."},
+			},
+			"allOf": []any{
+				requireWhen("out.set", map[string]any{"required": []any{"rooms"}}),
+				requireWhen("play", map[string]any{"oneOf": []any{
+					map[string]any{"required": []any{"query"}, "not": map[string]any{"anyOf": []any{map[string]any{"required": []any{"playlistId"}}, map[string]any{"required": []any{"station"}}}}},
+					map[string]any{"required": []any{"playlistId"}, "not": map[string]any{"anyOf": []any{map[string]any{"required": []any{"query"}}, map[string]any{"required": []any{"station"}}}}},
+					map[string]any{"required": []any{"station"}, "not": map[string]any{"anyOf": []any{map[string]any{"required": []any{"query"}}, map[string]any{"required": []any{"playlistId"}}}}},
+				}}),
+				requireWhen("volume.set", map[string]any{"required": []any{"value"}}),
+				requireWhen("wait", map[string]any{
+					"required": []any{"timeout"},
+					"oneOf": []any{
+						map[string]any{"required": []any{"state"}, "not": map[string]any{"required": []any{"until"}}},
+						map[string]any{"required": []any{"until"}, "not": map[string]any{"required": []any{"state"}}},
+					},
+				}),
+				requireWhen("transport", map[string]any{"required": []any{"action"}}),
+				requireWhen("shuffle.set", map[string]any{
+					"anyOf": []any{
+						map[string]any{"required": []any{"enabled"}},
+						map[string]any{"required": []any{"mode"}},
+					},
+					"properties": map[string]any{"mode": map[string]any{"enum": []any{"songs", "albums", "groupings"}}},
+				}),
+				requireWhen("repeat.set", map[string]any{
+					"required":   []any{"mode"},
+					"properties": map[string]any{"mode": map[string]any{"enum": []any{"off", "one", "all"}}},
+				}),
+				requireWhen("seek", map[string]any{"required": []any{"position"}}),
+				requireWhen("notify", map[string]any{"required": []any{"message"}}),
+				requireWhen("webhook", map[string]any{"required": []any{"url"}}),
+				requireWhen("shortcut", map[string]any{"required": []any{"name"}}),
+				requireWhen("parallel", map[string]any{"required": []any{"steps"}}),
+			},
+		},
+	},
+}
+
+var configFileSchema = map[string]any{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title":   "homepodctl config.json",
+	"type":    "object",
+	"properties": map[string]any{
+		"defaults": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"backend": map[string]any{"enum": []any{"", "airplay", "native"}},
+				"rooms":   stringArray(),
+				"shuffle": map[string]any{"type": "boolean"},
+				"volume":  map[string]any{"oneOf": []any{percentInt(), map[string]any{"type": "null"}}},
+				"maxVolume": map[string]any{
+					"oneOf":       []any{percentInt(), map[string]any{"type": "null"}},
+					"description": "Highest volume any room is set to; the volume command asks before going above it, and everything else clamps to it.",
+				},
+				"timeouts": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"applescript": durationString("Limit for each Music.app call."),
+						"shortcuts":   durationString("Limit for each Shortcuts run."),
+						"hooks":       durationString("Limit for each hook run."),
+					},
+				},
+				"engine": map[string]any{"enum": []any{"", "jxa", "applescript"}},
+				"retries": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"count":   map[string]any{"type": "integer", "minimum": 0, "maximum": maxRetries},
+						"backoff": durationString("First retry delay; doubles per retry."),
+					},
+				},
+				"launch": map[string]any{"enum": []any{"", "hidden", "foreground", "off"}},
+			},
+		},
+		"aliases": map[string]any{
+			"type":                 "object",
+			"additionalProperties": map[string]any{"$ref": "#/$defs/alias"},
+		},
+		"scenes": map[string]any{
+			"type":                 "object",
+			"additionalProperties": map[string]any{"$ref": "#/$defs/scene"},
+		},
+		"groups": map[string]any{
+			"type":                 "object",
+			"description":          "Group name to room names.",
+			"additionalProperties": map[string]any{"type": "array", "minItems": 1, "items": map[string]any{"type": "string", "minLength": 1}},
+		},
+		"devices": map[string]any{
+			"type":                 "object",
+			"description":          "Friendly room name to the exact AirPlay device name it stands for.",
+			"additionalProperties": map[string]any{"type": "string", "minLength": 1},
+		},
+		"volumeOffsets": map[string]any{
+			"type":                 "object",
+			"description":          "Room to offset added to requested volumes.",
+			"additionalProperties": map[string]any{"type": "integer", "minimum": -100, "maximum": 100},
+		},
+		"maxVolumes": map[string]any{
+			"type":                 "object",
+			"description":          "Room to the highest volume allowed there, overriding defaults.maxVolume.",
+			"additionalProperties": percentInt(),
+		},
+		"quietHours": map[string]any{
+			"type":        "object",
+			"description": "Name to a daily window that lowers the volume cap of some rooms and makes play warn or refuse to start.",
+			"additionalProperties": map[string]any{
+				"type":     "object",
+				"required": []string{"start", "end"},
+				"properties": map[string]any{
+					"start":     clockTime("Local time the window opens, HH:MM."),
+					"end":       clockTime("Local time the window closes, HH:MM; before start means it spans midnight."),
+					"rooms":     map[string]any{"type": "array", "items": map[string]any{"type": "string", "minLength": 1}, "description": "Rooms or groups; empty means every room."},
+					"maxVolume": percentInt(),
+					"play":      map[string]any{"enum": []any{"warn", "block"}, "description": "What play does inside the window (default warn); block needs --force."},
+				},
+				"additionalProperties": false,
+			},
+		},
+		"hooks": map[string]any{
+			"type":                 "object",
+			"description":          "Hook name (pre or post and a command, e.g. postPlay) to a shell command.",
+			"propertyNames":        map[string]any{"pattern": "^(pre|post)[A-Z][A-Za-z]*$"},
+			"additionalProperties": map[string]any{"type": "string", "minLength": 1},
+		},
+		"remotes": map[string]any{
+			"type":        "object",
+			"description": "Remote name to a Mac that --host <name> runs Music.app and Shortcuts calls on over SSH.",
+			"additionalProperties": map[string]any{
+				"type":     "object",
+				"required": []string{"host"},
+				"properties": map[string]any{
+					"host":     map[string]any{"type": "string", "minLength": 1, "description": "ssh destination, e.g. me@mac-mini"},
+					"port":     map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+					"identity": map[string]any{"type": "string", "description": "Private key file."},
+				},
+				"additionalProperties": false,
+			},
+		},
+		"scrobble": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"lastfm": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"apiKey":     map[string]any{"type": "string"},
+						"apiSecret":  map[string]any{"type": "string"},
+						"sessionKey": map[string]any{"type": "string"},
+					},
+				},
+				"listenbrainz": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"token": map[string]any{"type": "string"},
+						"url":   map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+		"appleMusic": map[string]any{
+			"type":        "object",
+			"description": "Apple Music API tokens for catalog search and play --catalog.",
+			"properties": map[string]any{
+				"developerToken": map[string]any{"type": "string", "description": "MusicKit developer token (JWT)."},
+				"userToken":      map[string]any{"type": "string", "description": "Music-User-Token; needed to add catalog items to the library."},
+				"storefront":     map[string]any{"type": "string", "pattern": "^[a-z]{2}$", "description": "Storefront country code; defaults to us."},
+			},
+			"additionalProperties": false,
+		},
+		"native": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"playlists": map[string]any{
+					"type":        "object",
+					"description": `Room (or "*") to playlist name (or "*") to the Shortcut to run.`,
+					"additionalProperties": map[string]any{
+						"type":                 "object",
+						"additionalProperties": map[string]any{"$ref": "#/$defs/playlistShortcut"},
+					},
+				},
+				"volumeShortcuts": map[string]any{
+					"type":        "object",
+					"description": `Room to level ("0".."100") to the Shortcut to run.`,
+					"additionalProperties": map[string]any{
+						"type":                 "object",
+						"propertyNames":        map[string]any{"pattern": "^(100|[1-9]?[0-9])$"},
+						"additionalProperties": map[string]any{"type": "string", "minLength": 1},
+					},
+				},
+			},
+		},
+	},
+	"$defs": map[string]any{
+		"scene": map[string]any{
+			"type":                 "object",
+			"required":             []any{"steps"},
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"description": map[string]any{"type": "string"},
+				"steps":       map[string]any{"type": "array", "minItems": 1, "items": map[string]any{"$ref": "#/$defs/step"}},
+			},
+		},
+		"step": automationFileSchema["$defs"].(map[string]any)["step"],
+		"alias": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"backend":     map[string]any{"enum": []any{"", "airplay", "native"}},
+				"rooms":       stringArray(),
+				"playlist":    map[string]any{"type": "string"},
+				"playlistId":  map[string]any{"type": "string"},
+				"station":     map[string]any{"type": "string", "description": "Radio station to play instead of a playlist (airplay)."},
+				"shuffle":     map[string]any{"type": "boolean"},
+				"shuffleMode": map[string]any{"enum": []any{"songs", "albums", "groupings"}},
+				"eq":          map[string]any{"type": "string", "description": "Music.app EQ preset name."},
+				"volume":      percentInt(),
+				"shortcut":    map[string]any{"type": "string"},
+				"sequence":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Aliases or automation files run in order."},
+			},
+		},
+		"playlistShortcut": map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "string", "minLength": 1},
+				map[string]any{
+					"type":     "object",
+					"required": []any{"shortcut"},
+					"properties": map[string]any{
+						"shortcut": map[string]any{"type": "string", "minLength": 1},
+						"input":    map[string]any{"type": "string", "description": "{room} and {playlist} are replaced before the run."},
+					},
+				},
+			},
+		},
+	},
+}
+
+type schemaWriteResult struct {
+	OK     bool     `json:"ok"`
+	Dir    string   `json:"dir"`
+	Files  []string `json:"files"`
+	DryRun bool     `json:"dryRun,omitempty"`
+}
+
+// writeSchemaFiles writes each named schema to <dir>/<name>.schema.json,
+// creating dir if needed.
+func writeSchemaFiles(dir string, names []string, dryRun bool) (schemaWriteResult, error) {
+	res := schemaWriteResult{OK: true, Dir: dir, DryRun: dryRun}
+	if !dryRun {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return res, err
+		}
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name+".schema.json")
+		res.Files = append(res.Files, path)
+		if dryRun {
+			continue
+		}
+		b, err := json.MarshalIndent(cliSchemas[name], "", "  ")
+		if err != nil {
+			return res, err
+		}
+		if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+			return res, fmt.Errorf("write %s: %w", path, err)
+		}
+	}
+	return res, nil
+}
+
+func printSchemaWriteResult(res schemaWriteResult) {
+	verb := "wrote"
+	if res.DryRun {
+		verb = "would write"
+	}
+	for _, f := range res.Files {
+		fmt.Printf("%s %s\n", verb, f)
+	}
+	if len(res.Files) == 0 {
+		fmt.Printf("no schemas to write to %s\n", strings.TrimSpace(res.Dir))
+	}
+}
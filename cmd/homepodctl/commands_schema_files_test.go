@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAutomationFileSchemaMatchesStepStruct(t *testing.T) {
+	step := automationFileSchema["$defs"].(map[string]any)["step"].(map[string]any)
+	props := step["properties"].(map[string]any)
+	st := reflect.TypeOf(automationStep{})
+	for i := 0; i < st.NumField(); i++ {
+		name, _, _ := strings.Cut(st.Field(i).Tag.Get("json"), ",")
+		if _, ok := props[name]; !ok {
+			t.Errorf("step schema lacks %q", name)
+		}
+	}
+	for _, typ := range props["type"].(map[string]any)["enum"].([]any) {
+		err := validateAutomationStep(0, automationStep{Type: typ.(string)})
+		if err != nil && strings.Contains(err.Error(), "unsupported step type") {
+			t.Errorf("schema allows %q but validation rejects it", typ)
+		}
+	}
+}
+
+func TestWriteSchemaFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "schemas")
+	res, err := writeSchemaFiles(dir, []string{"automation-file", "config-file"}, false)
+	if err != nil {
+		t.Fatalf("writeSchemaFiles: %v", err)
+	}
+	if len(res.Files) != 2 {
+		t.Fatalf("files=%v", res.Files)
+	}
+	for _, f := range res.Files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v map[string]any
+		if err := json.Unmarshal(b, &v); err != nil || v["$schema"] == nil {
+			t.Fatalf("%s: err=%v schema=%v", f, err, v["$schema"])
+		}
+	}
+
+	res, err = writeSchemaFiles(filepath.Join(t.TempDir(), "none"), []string{"config-file"}, true)
+	if err != nil || len(res.Files) != 1 {
+		t.Fatalf("dry run res=%+v err=%v", res, err)
+	}
+	if _, err := os.Stat(res.Files[0]); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote %s", res.Files[0])
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/scrobble"
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+type scrobbleFlushResult struct {
+	OK      bool `json:"ok"`
+	Sent    int  `json:"sent"`
+	Pending int  `json:"pending"`
+}
+
+func cmdScrobble(ctx context.Context, cfg *native.Config, args []string) {
+	if len(args) < 1 {
+		die(usageErrf("usage: homepodctl scrobble <daemon|flush> [args]"))
+	}
+	sub := args[0]
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl scrobble <daemon|flush> [args]"))
+	}
+	submitters := scrobblersFromConfig(cfg)
+	if len(submitters) == 0 {
+		die(usageErrf("no scrobbling service configured (set scrobble.lastfm.* or scrobble.listenbrainz.token via `homepodctl config set`)"))
+	}
+	path, err := scrobbleQueuePath()
+	if err != nil {
+		die(err)
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		die(err)
+	}
+	q, err := scrobble.LoadQueue(path)
+	if err != nil {
+		die(err)
+	}
+
+	switch sub {
+	case "daemon":
+		interval := 5 * time.Second
+		if raw := strings.TrimSpace(flags.string("interval")); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				die(usageErrf("invalid --interval %q (expected duration like 5s)", raw))
+			}
+			interval = d
+		}
+		runScrobbleDaemon(context.WithoutCancel(ctx), interval, q, submitters)
+	case "flush":
+		jsonOut, _, err := parseOutputFlags(flags)
+		if err != nil {
+			die(err)
+		}
+		sent, flushErr := q.Flush(ctx, submitters)
+		if err := q.Save(); err != nil {
+			die(err)
+		}
+		if flushErr != nil {
+			die(flushErr)
+		}
+		res := scrobbleFlushResult{OK: true, Sent: sent, Pending: len(q.Pending)}
+		if jsonOut {
+			writeJSON(res)
+			return
+		}
+		if !quiet {
+			fmt.Printf("sent %d listen(s), %d pending\n", res.Sent, res.Pending)
+		}
+	default:
+		die(usageErrf("usage: homepodctl scrobble <daemon|flush> [args]"))
+	}
+}
+
+// runScrobbleDaemon watches now-playing and submits each play once it passes
+// the scrobble threshold. Listens are queued on disk first, so anything that
+// fails to send (offline, service down) is retried on later polls and runs.
+func runScrobbleDaemon(ctx context.Context, interval time.Duration, q *scrobble.Queue, submitters []scrobble.Submitter) {
+	var tracker scrobbleTracker
+	var lastAttempt time.Time
+	err := watchNowPlaying(ctx, interval, func(np music.NowPlaying, _ []nowPlayingEvent) {
+		now := time.Now()
+		ls, ok := tracker.observe(np, now)
+		if ok {
+			debugf("scrobble: queue %q by %q", ls.Track, ls.Artist)
+			q.Add(ls, submitters)
+		}
+		// Retry a backlog at most once a minute; fresh listens go out right away.
+		if len(q.Pending) == 0 || (!ok && now.Sub(lastAttempt) < time.Minute) {
+			return
+		}
+		lastAttempt = now
+		flushCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		sent, flushErr := q.Flush(flushCtx, submitters)
+		if flushErr != nil {
+			fmt.Fprintf(os.Stderr, "homepodctl: scrobble: %v (%d pending)\n", flushErr, len(q.Pending))
+		}
+		if err := q.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "homepodctl: scrobble: save queue: %v\n", err)
+		}
+		if sent > 0 && !quiet {
+			fmt.Printf("scrobbled %d listen(s)\n", sent)
+		}
+	})
+	if err != nil {
+		die(err)
+	}
+}
+
+// scrobbleTracker follows the current play and reports it once, when it
+// becomes eligible.
+type scrobbleTracker struct {
+	key       string
+	lastPos   float64
+	startedAt time.Time
+	done      bool
+}
+
+func (t *scrobbleTracker) observe(np music.NowPlaying, now time.Time) (scrobble.Listen, bool) {
+	key := trackKey(np.Track)
+	if key == "" {
+		return scrobble.Listen{}, false
+	}
+	pos := np.PlayerPositionS
+	// A new track, or the same one restarted (repeat, skip back), is a new play.
+	if key != t.key || pos+30 < t.lastPos {
+		*t = scrobbleTracker{key: key, startedAt: now.Add(-time.Duration(pos * float64(time.Second)))}
+	}
+	t.lastPos = pos
+	if t.done || np.PlayerState != "playing" || !scrobble.Eligible(np.Track.DurationS, pos) {
+		return scrobble.Listen{}, false
+	}
+	t.done = true
+	return scrobble.Listen{
+		Artist:    np.Track.Artist,
+		Track:     np.Track.Name,
+		Album:     np.Track.Album,
+		DurationS: np.Track.DurationS,
+		StartedAt: t.startedAt.UTC().Truncate(time.Second),
+	}, true
+}
+
+func scrobblersFromConfig(cfg *native.Config) []scrobble.Submitter {
+	if cfg == nil || cfg.Scrobble == nil {
+		return nil
+	}
+	var out []scrobble.Submitter
+	lf := cfg.Scrobble.LastFM
+	if lf.APIKey != "" && lf.APISecret != "" && lf.SessionKey != "" {
+		out = append(out, &scrobble.LastFM{APIKey: lf.APIKey, APISecret: lf.APISecret, SessionKey: lf.SessionKey})
+	}
+	if lb := cfg.Scrobble.ListenBrainz; lb.Token != "" {
+		out = append(out, &scrobble.ListenBrainz{Token: lb.Token, Endpoint: lb.URL})
+	}
+	return out
+}
+
+func scrobbleQueuePath() (string, error) {
+	return adoptedStatePath("scrobble-queue.json")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+func TestScrobbleTrackerReportsOncePastHalfway(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	np := music.NowPlaying{PlayerState: "playing", Track: music.NowPlayingTrack{Name: "Song", Artist: "Band", PersistentID: "T1", DurationS: 200}}
+	var tr scrobbleTracker
+
+	np.PlayerPositionS = 10
+	if _, ok := tr.observe(np, now); ok {
+		t.Fatalf("should not scrobble at 10s")
+	}
+	np.PlayerPositionS = 101
+	ls, ok := tr.observe(np, now.Add(91*time.Second))
+	if !ok || ls.Track != "Song" || !ls.StartedAt.Equal(now.Add(-10*time.Second)) {
+		t.Fatalf("unexpected listen ok=%v ls=%+v", ok, ls)
+	}
+	np.PlayerPositionS = 150
+	if _, ok := tr.observe(np, now.Add(140*time.Second)); ok {
+		t.Fatalf("should scrobble a play only once")
+	}
+	// Restarting the same track counts as a new play.
+	np.PlayerPositionS = 0
+	tr.observe(np, now.Add(200*time.Second))
+	np.PlayerPositionS = 120
+	if _, ok := tr.observe(np, now.Add(320*time.Second)); !ok {
+		t.Fatalf("replay should scrobble again")
+	}
+}
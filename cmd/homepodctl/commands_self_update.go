@@ -0,0 +1,331 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const selfUpdateRepo = "agisilaos/homepodctl"
+
+// selfUpdateTimeout replaces defaultCommandTimeout for self-update, which
+// downloads a release archive; each request is still bounded by
+// selfUpdateClient.
+const selfUpdateTimeout = 10 * time.Minute
+
+var (
+	githubAPIBase    = "https://api.github.com"
+	selfUpdateClient = &http.Client{Timeout: 2 * time.Minute}
+	executablePath   = os.Executable
+)
+
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+type selfUpdateResult struct {
+	OK      bool   `json:"ok"`
+	Channel string `json:"channel"`
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+	Updated bool   `json:"updated"`
+	DryRun  bool   `json:"dryRun,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func cmdSelfUpdate(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl self-update [--channel stable|beta] [--check] [--force] [--json] [--dry-run]"))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	channel := strings.TrimSpace(flags.string("channel"))
+	if channel == "" {
+		channel = "stable"
+	}
+	if channel != "stable" && channel != "beta" {
+		die(usageErrf("invalid --channel %q (expected stable|beta)", channel))
+	}
+	check, _, err := flags.boolStrict("check")
+	if err != nil {
+		die(err)
+	}
+	force, _, err := flags.boolStrict("force")
+	if err != nil {
+		die(err)
+	}
+
+	rel, err := latestRelease(ctx, channel)
+	if err != nil {
+		die(err)
+	}
+	res := selfUpdateResult{OK: true, Channel: channel, Current: version, Latest: rel.TagName, DryRun: opts.DryRun}
+	newer := compareVersions(rel.TagName, version) > 0
+	debugf("self-update: channel=%s current=%s latest=%s newer=%t", channel, version, rel.TagName, newer)
+	switch {
+	case version == "dev" && !force:
+		res.Message = "development build; pass --force to replace it with " + rel.TagName
+	case !newer && !force:
+		res.Message = "already up to date"
+	case check:
+		res.Message = rel.TagName + " is available (run homepodctl self-update)"
+	default:
+		path, err := selfUpdateTarget()
+		if err != nil {
+			die(err)
+		}
+		res.Path = path
+		if opts.DryRun {
+			res.Message = fmt.Sprintf("would replace %s with %s", path, rel.TagName)
+			break
+		}
+		if err := installRelease(ctx, rel, path); err != nil {
+			die(err)
+		}
+		res.Updated = true
+		res.Message = fmt.Sprintf("updated %s to %s", path, rel.TagName)
+	}
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if opts.Plain {
+		fmt.Printf("%s\t%s\t%t\t%s\n", res.Current, res.Latest, res.Updated, res.Path)
+		return
+	}
+	fmt.Printf("homepodctl %s (%s channel, latest %s): %s\n", res.Current, res.Channel, res.Latest, res.Message)
+}
+
+// latestRelease returns the newest published release on channel: stable
+// skips prereleases, beta includes them.
+func latestRelease(ctx context.Context, channel string) (githubRelease, error) {
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=30", githubAPIBase, selfUpdateRepo)
+	body, err := selfUpdateGet(ctx, url)
+	if err != nil {
+		return githubRelease{}, fmt.Errorf("list releases: %w", err)
+	}
+	var releases []githubRelease
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return githubRelease{}, fmt.Errorf("list releases: %w", err)
+	}
+	var best *githubRelease
+	for i, r := range releases {
+		if r.Draft || (r.Prerelease && channel != "beta") {
+			continue
+		}
+		if best == nil || compareVersions(r.TagName, best.TagName) > 0 {
+			best = &releases[i]
+		}
+	}
+	if best == nil {
+		return githubRelease{}, fmt.Errorf("no %s release found for %s", channel, selfUpdateRepo)
+	}
+	return *best, nil
+}
+
+// selfUpdateTarget is the running binary, with symlinks resolved. Homebrew
+// installs are left to brew so its records stay correct.
+func selfUpdateTarget() (string, error) {
+	path, err := executablePath()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if strings.Contains(path, "/Cellar/") {
+		return "", usageErrf("%s is managed by Homebrew; run `brew upgrade homepodctl` instead", path)
+	}
+	return path, nil
+}
+
+// installRelease downloads the darwin archive for this architecture, checks
+// it against the release's SHA256SUMS, and renames the extracted binary over
+// path, so a failure at any step leaves the current binary in place.
+func installRelease(ctx context.Context, rel githubRelease, path string) error {
+	name := fmt.Sprintf("homepodctl_%s_darwin_%s.tar.gz", strings.TrimPrefix(rel.TagName, "v"), runtime.GOARCH)
+	archiveURL, sumsURL := rel.assetURL(name), rel.assetURL("SHA256SUMS")
+	if archiveURL == "" {
+		return fmt.Errorf("release %s has no %s", rel.TagName, name)
+	}
+	if sumsURL == "" {
+		return fmt.Errorf("release %s has no SHA256SUMS; refusing to install an unverified binary", rel.TagName)
+	}
+	sums, err := selfUpdateGet(ctx, sumsURL)
+	if err != nil {
+		return fmt.Errorf("download SHA256SUMS: %w", err)
+	}
+	want, err := checksumFor(sums, name)
+	if err != nil {
+		return err
+	}
+	archive, err := selfUpdateGet(ctx, archiveURL)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", name, err)
+	}
+	sum := sha256.Sum256(archive)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	bin, err := extractBinary(archive, "homepodctl")
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".homepodctl-update-*")
+	if err != nil {
+		return fmt.Errorf("write next to %s: %w (try again with sudo)", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o755); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func checksumFor(sums []byte, name string) (string, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("SHA256SUMS has no entry for %s", name)
+}
+
+func extractBinary(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive has no %s binary", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && filepath.Base(hdr.Name) == name {
+			return io.ReadAll(io.LimitReader(tr, 256<<20))
+		}
+	}
+}
+
+func selfUpdateGet(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "homepodctl/"+version)
+	resp, err := selfUpdateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 256<<20))
+}
+
+// compareVersions orders vMAJOR.MINOR.PATCH[-pre] tags; a prerelease sorts
+// before its release, and anything unparseable sorts first.
+func compareVersions(a, b string) int {
+	pa, preA, okA := parseVersion(a)
+	pb, preB, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] > pb[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return strings.Compare(preA, preB)
+}
+
+func parseVersion(v string) ([3]int, string, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	core, pre, _ := strings.Cut(v, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return out, "", false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return out, "", false
+		}
+		out[i] = n
+	}
+	return out, pre, true
+}
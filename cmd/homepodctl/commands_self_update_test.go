@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.0", "v1.10.0", -1},
+		{"v1.2.3", "1.2.3", 0},
+		{"v2.0.0", "v2.0.0-beta.1", 1},
+		{"v2.0.0-beta.2", "v2.0.0-beta.1", 1},
+		{"v0.1.0", "dev", 1},
+	}
+	for _, tc := range cases {
+		if got := compareVersions(tc.a, tc.b); got != tc.want {
+			t.Fatalf("compareVersions(%q, %q)=%d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSelfUpdateInstallsVerifiedRelease(t *testing.T) {
+	origBase, origExe, origVersion := githubAPIBase, executablePath, version
+	t.Cleanup(func() {
+		githubAPIBase, executablePath, version = origBase, origExe, origVersion
+	})
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	bin := []byte("#!/bin/sh\necho new\n")
+	_ = tw.WriteHeader(&tar.Header{Name: "homepodctl", Mode: 0o755, Size: int64(len(bin)), Typeflag: tar.TypeReg})
+	_, _ = tw.Write(bin)
+	_ = tw.Close()
+	_ = gz.Close()
+	name := fmt.Sprintf("homepodctl_1.3.0_darwin_%s.tar.gz", runtime.GOARCH)
+	sum := sha256.Sum256(archive.Bytes())
+	sums := hex.EncodeToString(sum[:]) + "  " + name + "\n"
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/agisilaos/homepodctl/releases":
+			fmt.Fprintf(w, `[
+				{"tag_name":"v1.4.0-beta.1","prerelease":true,"assets":[]},
+				{"tag_name":"v1.3.0","assets":[{"name":%q,"browser_download_url":"%s/a"},{"name":"SHA256SUMS","browser_download_url":"%s/sums"}]},
+				{"tag_name":"v1.2.0","assets":[]}
+			]`, name, srv.URL, srv.URL)
+		case "/a":
+			_, _ = w.Write(archive.Bytes())
+		case "/sums":
+			fmt.Fprint(w, sums)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	githubAPIBase = srv.URL
+	exe := filepath.Join(t.TempDir(), "homepodctl")
+	if err := os.WriteFile(exe, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	executablePath = func() (string, error) { return exe, nil }
+	version = "v1.2.0"
+
+	out := captureStdout(t, func() { cmdSelfUpdate(context.Background(), []string{"--check"}) })
+	if !strings.Contains(out, "v1.3.0 is available") {
+		t.Fatalf("check output=%q", out)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old" {
+		t.Fatalf("--check replaced the binary")
+	}
+
+	sums = strings.Repeat("0", 64) + "  " + name + "\n"
+	_, recovered := captureStdoutAndRecover(t, func() { cmdSelfUpdate(context.Background(), nil) })
+	if fatal, ok := recovered.(cliFatal); !ok || !strings.Contains(fatal.err.Error(), "checksum mismatch") {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old" {
+		t.Fatalf("a failed update replaced the binary")
+	}
+
+	sums = hex.EncodeToString(sum[:]) + "  " + name + "\n"
+	out = captureStdout(t, func() { cmdSelfUpdate(context.Background(), []string{"--json"}) })
+	if !strings.Contains(out, `"updated": true`) || !strings.Contains(out, `"latest": "v1.3.0"`) {
+		t.Fatalf("update output=%s", out)
+	}
+	if got, _ := os.ReadFile(exe); !bytes.Equal(got, bin) {
+		t.Fatalf("binary=%q", got)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(exe)); len(entries) != 1 {
+		t.Fatalf("temp files left behind: %v", entries)
+	}
+}
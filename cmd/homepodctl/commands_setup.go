@@ -51,7 +51,7 @@ func cmdSetup(ctx context.Context, args []string) {
 	configUpdated := false
 	if backend := strings.TrimSpace(flags.string("backend")); backend != "" {
 		if backend != "airplay" && backend != "native" {
-			die(usageErrf("unknown backend: %q", backend))
+			die(backendError(backend))
 		}
 		cfg.Defaults.Backend = backend
 		configUpdated = true
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+func cmdShortcuts(ctx context.Context, args []string) {
+	if len(args) < 1 || args[0] != "list" {
+		die(usageErrf("usage: homepodctl shortcuts list [--json]"))
+	}
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl shortcuts list [--json]"))
+	}
+	jsonOut, _, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	names, err := listShortcuts(ctx)
+	if err != nil {
+		die(err)
+	}
+	if jsonOut {
+		if names == nil {
+			names = []string{}
+		}
+		writeJSON(names)
+		return
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
+
+// missingShortcutIssues checks every shortcut referenced by cfg against the
+// installed ones. It reports ok=false when the Shortcuts CLI can't be queried,
+// in which case the check should be skipped rather than failed.
+func missingShortcutIssues(ctx context.Context, cfg *native.Config) (issues []string, ok bool) {
+	refs := cfg.ShortcutRefs()
+	if len(refs) == 0 {
+		return nil, true
+	}
+	if _, err := lookPath("shortcuts"); err != nil && remoteHost == "" {
+		debugf("shortcuts: CLI not found; skipping shortcut checks")
+		return nil, false
+	}
+	installed, err := listShortcuts(ctx)
+	if err != nil {
+		debugf("shortcuts: list failed: %v", err)
+		return nil, false
+	}
+	for _, r := range native.MissingShortcuts(refs, installed) {
+		issues = append(issues, fmt.Sprintf("%s: shortcut %q not found", r.Path, r.Name))
+	}
+	return issues, true
+}
+
+// nativeShortcutsCheck reports referenced shortcuts that aren't installed.
+// It is omitted when the config references no shortcuts.
+func nativeShortcutsCheck(ctx context.Context, cfg *native.Config) (doctorCheck, bool) {
+	if len(cfg.ShortcutRefs()) == 0 {
+		return doctorCheck{}, false
+	}
+	issues, ok := missingShortcutIssues(ctx, cfg)
+	switch {
+	case !ok:
+		return doctorCheck{Name: "native-shortcuts", Status: "warn", Message: "could not list installed shortcuts", Tip: "Run `shortcuts list` to check the Shortcuts CLI."}, true
+	case len(issues) > 0:
+		return doctorCheck{
+			Name:    "native-shortcuts",
+			Status:  "warn",
+			Message: strings.Join(issues, "; "),
+			Tip:     missingShortcutTip,
+		}, true
+	}
+	return doctorCheck{Name: "native-shortcuts", Status: "pass", Message: fmt.Sprintf("%d referenced shortcut(s) installed", len(cfg.ShortcutRefs()))}, true
+}
+
+const missingShortcutTip = "Create the shortcut in Shortcuts.app, or fix the name with `homepodctl config set` (see `homepodctl shortcuts list`)."
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// stateShowResult is the state directory plus the state homepodctl keeps
+// elsewhere (the playlist and device caches).
+type stateShowResult struct {
+	state.Layout
+	Elsewhere []state.Entry `json:"elsewhere"`
+}
+
+type stateClearResult struct {
+	OK      bool     `json:"ok"`
+	Action  string   `json:"action"`
+	DryRun  bool     `json:"dryRun,omitempty"`
+	Removed []string `json:"removed"`
+}
+
+func cmdState(args []string) {
+	const usageLine = "usage: homepodctl state show|clear [args]"
+	if len(args) == 0 {
+		die(usageErrf("%s", usageLine))
+	}
+	switch args[0] {
+	case "show":
+		cmdStateShow(args[1:])
+	case "clear":
+		cmdStateClear(args[1:])
+	default:
+		die(usageErrf("unknown state subcommand: %q (expected show or clear)", args[0]))
+	}
+}
+
+// stateElsewhere describes the state files outside the state directory.
+func stateElsewhere() []state.Entry {
+	var out []state.Entry
+	if path, err := playlistCachePath(); err == nil {
+		out = append(out, state.Stat("playlists.json", path, "playlist cache (see `homepodctl cache`)"))
+	}
+	if path, err := deviceCachePath(); err == nil {
+		out = append(out, state.Stat("devices.json", path, "device cache (see `homepodctl cache`)"))
+	}
+	return out
+}
+
+func cmdStateShow(args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl state show [--json] [--plain]"))
+	}
+	jsonOut, plain, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	layout, err := state.Describe()
+	if err != nil {
+		die(err)
+	}
+	res := stateShowResult{Layout: layout, Elsewhere: stateElsewhere()}
+	if jsonOut {
+		writeJSON(res)
+		return
+	}
+	if !plain {
+		version := "none yet"
+		if res.Version > 0 {
+			version = fmt.Sprintf("v%d", res.Version)
+		}
+		fmt.Printf("state dir: %s (layout %s)\n", res.Dir, version)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !plain {
+		fmt.Fprintln(tw, "NAME\tSIZE\tMODIFIED\tPATH\tDESCRIPTION")
+	}
+	for _, e := range append(res.Files, res.Elsewhere...) {
+		size, modified := "-", "-"
+		if e.Exists {
+			size, modified = fmt.Sprintf("%dB", e.Size), e.Modified
+		}
+		desc := e.Description
+		if e.Unknown {
+			desc = "(not written by this version)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Name, size, modified, e.Path, desc)
+	}
+	_ = tw.Flush()
+}
+
+func cmdStateClear(args []string) {
+	const usageLine = "usage: homepodctl state clear [<name>...] [--json] [--dry-run]"
+	flags, names, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	// The caches live outside the state directory and are only cleared when
+	// named.
+	var stateNames, paths []string
+	for _, name := range names {
+		found := false
+		for _, e := range stateElsewhere() {
+			if e.Name == name {
+				found = true
+				if e.Exists {
+					paths = append(paths, e.Path)
+				}
+			}
+		}
+		if !found {
+			if !state.IsKnown(name) {
+				die(usageErrf("unknown state file %q (%s; see `homepodctl state show`)", name, usageLine))
+			}
+			stateNames = append(stateNames, name)
+		}
+	}
+	res := stateClearResult{OK: true, Action: "state.clear", DryRun: opts.DryRun, Removed: []string{}}
+	if len(names) == 0 || len(stateNames) > 0 {
+		targets, err := state.Targets(stateNames...)
+		if err != nil {
+			die(err)
+		}
+		paths = append(targets, paths...)
+	}
+	for _, path := range paths {
+		if !opts.DryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				die(err)
+			}
+		}
+		res.Removed = append(res.Removed, path)
+	}
+
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	switch {
+	case len(res.Removed) == 0:
+		fmt.Println("nothing to clear")
+	case opts.DryRun:
+		fmt.Printf("dry-run: would remove %s\n", strings.Join(baseNames(res.Removed), ", "))
+	default:
+		fmt.Printf("removed %s\n", strings.Join(baseNames(res.Removed), ", "))
+	}
+}
+
+// adoptedStatePath returns the state dir path of name, a file older builds
+// kept next to config.json, moving the old copy over on first use.
+func adoptedStatePath(name string) (string, error) {
+	cfgPath, err := configPath()
+	if err != nil {
+		return state.Path(name)
+	}
+	return state.Adopt(filepath.Join(filepath.Dir(cfgPath), name), name)
+}
+
+func baseNames(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, filepath.Base(p))
+	}
+	return out
+}
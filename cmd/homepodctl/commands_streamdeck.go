@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+const defaultStreamDeckAddr = "127.0.0.1:8787"
+
+// streamDeckState is what a Stream Deck plugin needs to render its buttons:
+// play/pause state, a short title, and per-room toggle/volume state.
+type streamDeckState struct {
+	OK          bool              `json:"ok"`
+	PlayerState string            `json:"playerState"`
+	Playing     bool              `json:"playing"`
+	Title       string            `json:"title"`
+	Track       string            `json:"track,omitempty"`
+	Artist      string            `json:"artist,omitempty"`
+	Rooms       []streamDeckRoom  `json:"rooms"`
+	Error       *jsonErrorPayload `json:"error,omitempty"`
+}
+
+type streamDeckRoom struct {
+	Name     string `json:"name"`
+	Selected bool   `json:"selected"`
+	Volume   int    `json:"volume"`
+}
+
+func cmdStreamDeck(cfg *native.Config, args []string) {
+	const usageLine = "usage: homepodctl streamdeck serve [--addr <host:port>] [--token <secret>]"
+	if len(args) < 1 || args[0] != "serve" {
+		die(usageErrf("%s", usageLine))
+	}
+	flags, positionals, err := parseArgs(args[1:])
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("%s", usageLine))
+	}
+	addr := strings.TrimSpace(flags.string("addr"))
+	if addr == "" {
+		addr = defaultStreamDeckAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		die(usageErrf("invalid --addr %q (expected host:port)", addr))
+	}
+	if !isLoopbackHost(host) {
+		die(usageErrf("invalid --addr %q: streamdeck serve only listens on loopback addresses", addr))
+	}
+	token, tokenPath, err := loadServeToken(flags.string("token"), "HOMEPODCTL_STREAMDECK_TOKEN", "streamdeck-token")
+	if err != nil {
+		die(err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		die(err)
+	}
+	if !quiet {
+		fmt.Printf("streamdeck: listening on http://%s\n", ln.Addr())
+		if tokenPath != "" {
+			fmt.Printf("streamdeck: bearer token in %s\n", tokenPath)
+		}
+	}
+	auth := serveAuth{token: token, loopbackOnly: true}
+	srv := &http.Server{Handler: newStreamDeckHandler(cfg, auth), ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.Serve(ln); err != nil {
+		die(err)
+	}
+}
+
+// newStreamDeckHandler serves the localhost surface used by the Stream Deck
+// plugin. Every action responds with the fresh button state. Requests need
+// the bearer token and a loopback Host; see serveAuth.
+func newStreamDeckHandler(cfg *native.Config, auth serveAuth) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /state", func(w http.ResponseWriter, r *http.Request) {
+		writeStreamDeckState(w, r.Context(), nil)
+	})
+	mux.HandleFunc("POST /actions/playpause", func(w http.ResponseWriter, r *http.Request) {
+		streamDeckAction(w, r, func(ctx context.Context) error {
+			return transportActions["playpause"](ctx)
+		})
+	})
+	mux.HandleFunc("POST /actions/volume/{direction}", func(w http.ResponseWriter, r *http.Request) {
+		streamDeckAction(w, r, func(ctx context.Context) error {
+			return streamDeckVolume(ctx, cfg, r.PathValue("direction"), r.URL.Query())
+		})
+	})
+	mux.HandleFunc("POST /actions/rooms/{room}/toggle", func(w http.ResponseWriter, r *http.Request) {
+		streamDeckAction(w, r, func(ctx context.Context) error {
+			return streamDeckToggleRoom(ctx, r.PathValue("room"))
+		})
+	})
+	mux.HandleFunc("POST /actions/alias/{name}", func(w http.ResponseWriter, r *http.Request) {
+		streamDeckAction(w, r, func(ctx context.Context) error {
+			return runAliasAction(ctx, cfg, r.PathValue("name"))
+		})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.check(r); err != nil {
+			debugf("streamdeck: rejected %s %s: %v", r.Method, r.URL.Path, err)
+			writeStreamDeckError(w, auth.status(err), err)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func streamDeckAction(w http.ResponseWriter, r *http.Request, fn func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	debugf("streamdeck: %s %s", r.Method, r.URL.Path)
+	writeStreamDeckState(w, ctx, fn(ctx))
+}
+
+func writeStreamDeckState(w http.ResponseWriter, ctx context.Context, actionErr error) {
+	st := streamDeckState{OK: true}
+	status := http.StatusOK
+	err := actionErr
+	if err == nil {
+		err = fillStreamDeckState(ctx, &st)
+	}
+	if err != nil {
+		status = http.StatusBadGateway
+		if classifyExitCode(err) == exitUsage {
+			status = http.StatusBadRequest
+		}
+		writeStreamDeckError(w, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+func writeStreamDeckError(w http.ResponseWriter, status int, err error) {
+	st := streamDeckState{Error: &jsonErrorPayload{Code: classifyErrorCode(err), Message: formatError(err), ExitCode: classifyExitCode(err)}}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+func fillStreamDeckState(ctx context.Context, st *streamDeckState) error {
+	np, err := getNowPlaying(ctx)
+	if err != nil {
+		return err
+	}
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return err
+	}
+	st.PlayerState = np.PlayerState
+	st.Playing = np.PlayerState == "playing"
+	st.Track = np.Track.Name
+	st.Artist = np.Track.Artist
+	st.Title = np.Track.Name
+	if st.Title == "" {
+		st.Title = np.PlayerState
+	}
+	st.Rooms = make([]streamDeckRoom, 0, len(devs))
+	for _, d := range devs {
+		st.Rooms = append(st.Rooms, streamDeckRoom{Name: d.Name, Selected: d.Selected, Volume: d.Volume})
+	}
+	return nil
+}
+
+// streamDeckVolume nudges the selected outputs (or ?room=) up or down by
+// ?step= (default 5).
+func streamDeckVolume(ctx context.Context, cfg *native.Config, direction string, q url.Values) error {
+	step := 5
+	if raw := strings.TrimSpace(q.Get("step")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 100 {
+			return usageErrf("invalid step %q (expected 1..100)", raw)
+		}
+		step = n
+	}
+	switch direction {
+	case "up":
+	case "down":
+		step = -step
+	default:
+		return usageErrf("unknown volume direction %q (expected up|down)", direction)
+	}
+	rooms := cfg.ExpandRooms(q["room"])
+	if len(rooms) == 0 {
+		rooms = inferSelectedOutputs(ctx)
+	}
+	if len(rooms) == 0 {
+		return usageErrf("no rooms selected")
+	}
+	targets := make([]volumeTarget, 0, len(rooms))
+	for _, room := range rooms {
+		targets = append(targets, volumeTarget{Room: room, Value: step, Relative: true})
+	}
+	resolved, err := resolveVolumeTargets(ctx, cfg, targets)
+	if err != nil {
+		return err
+	}
+	for _, t := range resolved {
+		if err := setDeviceVolume(ctx, t.Room, t.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamDeckToggleRoom adds room to the selected outputs, or removes it when
+// it is already selected (keeping at least one output).
+func streamDeckToggleRoom(ctx context.Context, room string) error {
+	devs, err := listAirPlayDevices(ctx)
+	if err != nil {
+		return err
+	}
+	var current []string
+	for _, d := range devs {
+		if d.Selected {
+			current = append(current, d.Name)
+		}
+	}
+	var next []string
+	if containsFold(current, room) {
+		next = mergeOutputSelection(current, nil, []string{room})
+		if len(next) == 0 {
+			return usageErrf("cannot remove the last selected output %q", room)
+		}
+	} else {
+		next = mergeOutputSelection(current, []string{room}, nil)
+	}
+	return setCurrentOutputs(ctx, next)
+}
+
+// runAliasAction runs a config alias without printing, for non-CLI callers.
+func runAliasAction(ctx context.Context, cfg *native.Config, name string) error {
+	a, ok := cfg.Aliases[name]
+	if !ok {
+		return usageErrf("unknown alias: %q", name)
+	}
+	if a.Shortcut != "" {
+		return runNativeShortcut(ctx, a.Shortcut)
+	}
+	in := automationDefaults{Backend: a.Backend, Rooms: a.Rooms, Volume: a.Volume, Shuffle: a.Shuffle}
+	defaults := resolveAutomationDefaults(cfg, in)
+	if len(defaults.Rooms) == 0 {
+		return fmt.Errorf("alias %q requires rooms (set defaults.rooms or alias.rooms)", name)
+	}
+	if a.Playlist == "" && a.PlaylistID == "" && a.Station == "" {
+		if defaults.Backend == "native" {
+			return fmt.Errorf("alias %q requires playlist (native mapping is per room+playlist)", name)
+		}
+		if err := setCurrentOutputs(ctx, defaults.Rooms); err != nil {
+			return err
+		}
+		if defaults.Volume != nil {
+			return setVolumeForRooms(ctx, cfg, defaults.Rooms, *defaults.Volume, false)
+		}
+		return nil
+	}
+	return executeAutomationPlay(ctx, cfg, defaults.Backend, defaults, automationStep{Type: "play", Query: a.Playlist, PlaylistID: a.PlaylistID, Station: a.Station})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+func TestStreamDeckHandler(t *testing.T) {
+	origGetNowPlaying := getNowPlaying
+	origListAirPlayDevices := listAirPlayDevices
+	origSetCurrentOutputs := setCurrentOutputs
+	origSetDeviceVolume := setDeviceVolume
+	t.Cleanup(func() {
+		getNowPlaying = origGetNowPlaying
+		listAirPlayDevices = origListAirPlayDevices
+		setCurrentOutputs = origSetCurrentOutputs
+		setDeviceVolume = origSetDeviceVolume
+	})
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{
+			PlayerState: "playing",
+			Track:       music.NowPlayingTrack{Name: "Song", Artist: "Band"},
+			Outputs:     []music.AirPlayDevice{{Name: "Kitchen", Selected: true}},
+		}, nil
+	}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{
+			{Name: "Kitchen", Selected: true, Volume: 40},
+			{Name: "Bedroom", Selected: false, Volume: 20},
+		}, nil
+	}
+	var outputs []string
+	setCurrentOutputs = func(_ context.Context, rooms []string) error {
+		outputs = rooms
+		return nil
+	}
+	volumes := map[string]int{}
+	setDeviceVolume = func(_ context.Context, room string, v int) error {
+		volumes[room] = v
+		return nil
+	}
+	srv := httptest.NewServer(newStreamDeckHandler(&native.Config{}, serveAuth{token: "s3cret", loopbackOnly: true}))
+	defer srv.Close()
+	do := func(method, path string, header map[string]string) (*http.Response, error) {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer s3cret")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		if host := header["Host"]; host != "" {
+			req.Host = host
+		}
+		return http.DefaultClient.Do(req)
+	}
+
+	resp, err := do("GET", "/state", nil)
+	if err != nil {
+		t.Fatalf("GET /state: %v", err)
+	}
+	var st streamDeckState
+	_ = json.NewDecoder(resp.Body).Decode(&st)
+	resp.Body.Close()
+	if !st.OK || !st.Playing || st.Title != "Song" || len(st.Rooms) != 2 || st.Rooms[1].Selected {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+
+	resp, err = do("POST", "/actions/rooms/Bedroom/toggle", nil)
+	if err != nil {
+		t.Fatalf("toggle: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Join(outputs, ",") != "Kitchen,Bedroom" {
+		t.Fatalf("toggle status=%d outputs=%v", resp.StatusCode, outputs)
+	}
+
+	resp, err = do("POST", "/actions/volume/up?step=10", nil)
+	if err != nil {
+		t.Fatalf("volume up: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || volumes["Kitchen"] != 50 {
+		t.Fatalf("volume status=%d volumes=%v", resp.StatusCode, volumes)
+	}
+
+	resp, err = do("POST", "/actions/volume/sideways", nil)
+	if err != nil {
+		t.Fatalf("bad volume: %v", err)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&st)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || st.OK || st.Error == nil || st.Error.Code != "USAGE_ERROR" {
+		t.Fatalf("bad direction status=%d state=%+v", resp.StatusCode, st)
+	}
+
+	for name, header := range map[string]map[string]string{
+		"no token":       {"Authorization": ""},
+		"wrong token":    {"Authorization": "Bearer nope"},
+		"foreign origin": {"Origin": "https://evil.example"},
+		"rebound host":   {"Host": "evil.example:8787"},
+	} {
+		outputs = nil
+		resp, err = do("POST", "/actions/rooms/Bedroom/toggle", header)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		resp.Body.Close()
+		want := http.StatusUnauthorized
+		if name == "foreign origin" || name == "rebound host" {
+			want = http.StatusForbidden
+		}
+		if resp.StatusCode != want || outputs != nil {
+			t.Fatalf("%s: status=%d outputs=%v", name, resp.StatusCode, outputs)
+		}
+	}
+	resp, err = do("GET", "/state", map[string]string{"Origin": srv.URL})
+	if err != nil {
+		t.Fatalf("same origin: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("same origin status=%d", resp.StatusCode)
+	}
+}
+
+func TestLoadServeTokenPerInstall(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("HOMEPODCTL_STREAMDECK_TOKEN", "")
+	token, path, err := loadServeToken("", "HOMEPODCTL_STREAMDECK_TOKEN", "streamdeck-token")
+	if err != nil || len(token) != 64 || filepath.Base(path) != "streamdeck-token" {
+		t.Fatalf("token=%q path=%q err=%v", token, path, err)
+	}
+	again, _, err := loadServeToken("", "HOMEPODCTL_STREAMDECK_TOKEN", "streamdeck-token")
+	if err != nil || again != token {
+		t.Fatalf("second load=%q err=%v, want %q", again, err, token)
+	}
+	t.Setenv("HOMEPODCTL_STREAMDECK_TOKEN", "from-env")
+	if got, path, _ := loadServeToken("", "HOMEPODCTL_STREAMDECK_TOKEN", "streamdeck-token"); got != "from-env" || path != "" {
+		t.Fatalf("env token=%q path=%q", got, path)
+	}
+	if got, _, _ := loadServeToken("flag", "HOMEPODCTL_STREAMDECK_TOKEN", "streamdeck-token"); got != "flag" {
+		t.Fatalf("flag token=%q", got)
+	}
+}
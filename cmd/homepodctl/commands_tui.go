@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+const (
+	tuiPaneOutputs = iota
+	tuiPanePlaylists
+)
+
+const tuiPlaylistWindow = 10
+
+type tuiModel struct {
+	NowPlaying *music.NowPlaying
+	Devices    []music.AirPlayDevice
+	Playlists  []music.UserPlaylist
+	Pane       int
+	Cursor     [2]int
+	Message    string
+}
+
+// tuiCommand is the side effect requested by a key press.
+type tuiCommand struct {
+	Kind       string // quit|refresh|transport|outputs|volume|play
+	Action     string
+	Rooms      []string
+	Room       string
+	Volume     int
+	PlaylistID string
+	Playlist   string
+}
+
+func cmdTUI(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl tui [--watch <duration>]"))
+	}
+	interval := 2 * time.Second
+	if raw := strings.TrimSpace(flags.string("watch")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --watch %q (expected duration like 2s)", raw))
+		}
+		interval = d
+	}
+	if !isInteractiveStdin() {
+		die(usageErrf("tui requires an interactive terminal"))
+	}
+	restore, err := enterRawMode()
+	if err != nil {
+		die(fmt.Errorf("enable raw terminal mode: %w", err))
+	}
+	defer restore()
+	fmt.Fprint(os.Stdout, "\x1b[?25l")
+	defer fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[2J\x1b[H")
+
+	// The TUI outlives the per-command timeout; each backend call gets its own deadline.
+	base := context.WithoutCancel(ctx)
+	m := &tuiModel{}
+	m.refresh(base, true)
+
+	input := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(input)
+				return
+			}
+			input <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		drawTUI(os.Stdout, m)
+		select {
+		case b, ok := <-input:
+			if !ok {
+				return
+			}
+			for _, key := range decodeKeys(b) {
+				cmd := m.handleKey(key)
+				if cmd.Kind == "quit" {
+					return
+				}
+				if cmd.Kind != "" {
+					m.apply(base, cmd)
+				}
+			}
+		case <-ticker.C:
+			m.refresh(base, false)
+		}
+	}
+}
+
+func (m *tuiModel) refresh(base context.Context, withPlaylists bool) {
+	ctx, cancel := context.WithTimeout(base, 10*time.Second)
+	defer cancel()
+	if np, err := getNowPlaying(ctx); err == nil {
+		m.NowPlaying = &np
+	} else {
+		m.Message = formatError(err)
+	}
+	if devs, err := listAirPlayDevices(ctx); err == nil {
+		m.Devices = devs
+	} else {
+		m.Message = formatError(err)
+	}
+	if withPlaylists {
+		if playlists, err := listPlaylists(ctx, "", 0); err == nil {
+			m.Playlists = playlists
+		} else {
+			m.Message = formatError(err)
+		}
+	}
+	m.clampCursors()
+}
+
+func (m *tuiModel) apply(base context.Context, cmd tuiCommand) {
+	ctx, cancel := context.WithTimeout(base, 15*time.Second)
+	defer cancel()
+	var err error
+	switch cmd.Kind {
+	case "refresh":
+		m.refresh(base, true)
+		m.Message = "refreshed"
+		return
+	case "transport":
+		fn, ok := transportActions[cmd.Action]
+		if !ok {
+			return
+		}
+		err = fn(ctx)
+		m.Message = cmd.Action
+	case "outputs":
+		err = setCurrentOutputs(ctx, cmd.Rooms)
+		m.Message = "outputs: " + strings.Join(cmd.Rooms, ", ")
+	case "volume":
+		err = setDeviceVolume(ctx, cmd.Room, cmd.Volume)
+		m.Message = fmt.Sprintf("%s volume %d", cmd.Room, cmd.Volume)
+	case "play":
+		err = playPlaylistByID(ctx, cmd.PlaylistID)
+		m.Message = fmt.Sprintf("playing %q", cmd.Playlist)
+	}
+	if err != nil {
+		m.Message = formatError(err)
+	}
+	m.refresh(base, false)
+}
+
+func (m *tuiModel) handleKey(key string) tuiCommand {
+	switch key {
+	case "q", "ctrl+c", "esc":
+		return tuiCommand{Kind: "quit"}
+	case "r":
+		return tuiCommand{Kind: "refresh"}
+	case "space":
+		return tuiCommand{Kind: "transport", Action: "playpause"}
+	case "n":
+		return tuiCommand{Kind: "transport", Action: "next"}
+	case "p":
+		return tuiCommand{Kind: "transport", Action: "prev"}
+	case "s":
+		return tuiCommand{Kind: "transport", Action: "stop"}
+	case "tab", "left", "right":
+		if m.Pane == tuiPaneOutputs {
+			m.Pane = tuiPanePlaylists
+		} else {
+			m.Pane = tuiPaneOutputs
+		}
+	case "up", "k":
+		m.Cursor[m.Pane]--
+		m.clampCursors()
+	case "down", "j":
+		m.Cursor[m.Pane]++
+		m.clampCursors()
+	case "enter":
+		if m.Pane == tuiPanePlaylists {
+			if len(m.Playlists) == 0 {
+				return tuiCommand{}
+			}
+			p := m.Playlists[m.Cursor[tuiPanePlaylists]]
+			return tuiCommand{Kind: "play", PlaylistID: p.PersistentID, Playlist: p.Name}
+		}
+		return m.toggleOutput()
+	case "+", "=", "-", "_":
+		if m.Pane != tuiPaneOutputs || len(m.Devices) == 0 {
+			return tuiCommand{}
+		}
+		d := m.Devices[m.Cursor[tuiPaneOutputs]]
+		v := d.Volume + 5
+		if key == "-" || key == "_" {
+			v = d.Volume - 5
+		}
+		v = max(0, min(100, v))
+		return tuiCommand{Kind: "volume", Room: d.Name, Volume: v}
+	}
+	return tuiCommand{}
+}
+
+func (m *tuiModel) toggleOutput() tuiCommand {
+	if len(m.Devices) == 0 {
+		return tuiCommand{}
+	}
+	target := m.Devices[m.Cursor[tuiPaneOutputs]]
+	var rooms []string
+	for _, d := range m.Devices {
+		selected := d.Selected
+		if d.Name == target.Name {
+			selected = !selected
+		}
+		if selected {
+			rooms = append(rooms, d.Name)
+		}
+	}
+	if len(rooms) == 0 {
+		m.Message = "at least one output must stay selected"
+		return tuiCommand{}
+	}
+	return tuiCommand{Kind: "outputs", Rooms: rooms}
+}
+
+func (m *tuiModel) clampCursors() {
+	sizes := [2]int{len(m.Devices), len(m.Playlists)}
+	for i, n := range sizes {
+		if m.Cursor[i] >= n {
+			m.Cursor[i] = n - 1
+		}
+		if m.Cursor[i] < 0 {
+			m.Cursor[i] = 0
+		}
+	}
+}
+
+func drawTUI(w io.Writer, m *tuiModel) {
+	fmt.Fprint(w, "\x1b[H\x1b[2J"+strings.Join(renderTUI(m), "\r\n")+"\r\n")
+}
+
+func renderTUI(m *tuiModel) []string {
+	lines := []string{
+		"homepodctl tui  q quit · space play/pause · n/p next/prev · s stop · tab switch · ↑/↓ move · enter toggle/play · +/- volume",
+		"",
+	}
+	if np := m.NowPlaying; np != nil {
+		dur := ""
+		if np.Track.DurationS > 0 {
+			dur = "/" + formatClock(np.Track.DurationS)
+		}
+		lines = append(lines, fmt.Sprintf("state=%s pos=%s%s shuffle=%t repeat=%s", np.PlayerState, formatClock(np.PlayerPositionS), dur, np.ShuffleEnabled, np.SongRepeat))
+		if np.Track.Name != "" {
+			lines = append(lines, fmt.Sprintf("track=%q artist=%q album=%q", np.Track.Name, np.Track.Artist, np.Track.Album))
+		}
+		if np.PlaylistName != "" {
+			lines = append(lines, fmt.Sprintf("playlist=%q", np.PlaylistName))
+		}
+	} else {
+		lines = append(lines, "state=unknown")
+	}
+
+	lines = append(lines, "", tuiPaneTitle("Outputs", m.Pane == tuiPaneOutputs))
+	nameWidth := 0
+	for _, d := range m.Devices {
+		nameWidth = max(nameWidth, len([]rune(d.Name)))
+	}
+	for i, d := range m.Devices {
+		check := "[ ]"
+		if d.Selected {
+			check = "[x]"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %-*s %s %3d", tuiCursor(m.Pane == tuiPaneOutputs && m.Cursor[tuiPaneOutputs] == i), check, nameWidth, d.Name, volumeBar(d.Volume, 20), d.Volume))
+	}
+	if len(m.Devices) == 0 {
+		lines = append(lines, "  (no AirPlay devices)")
+	}
+
+	lines = append(lines, "", tuiPaneTitle("Playlists", m.Pane == tuiPanePlaylists))
+	start := max(0, m.Cursor[tuiPanePlaylists]-tuiPlaylistWindow/2)
+	end := min(len(m.Playlists), start+tuiPlaylistWindow)
+	for i := start; i < end; i++ {
+		lines = append(lines, fmt.Sprintf("%s %s", tuiCursor(m.Pane == tuiPanePlaylists && m.Cursor[tuiPanePlaylists] == i), m.Playlists[i].Name))
+	}
+	if len(m.Playlists) == 0 {
+		lines = append(lines, "  (no playlists)")
+	} else {
+		lines = append(lines, fmt.Sprintf("  %d/%d", m.Cursor[tuiPanePlaylists]+1, len(m.Playlists)))
+	}
+	if m.Message != "" {
+		lines = append(lines, "", m.Message)
+	}
+	return lines
+}
+
+func tuiPaneTitle(title string, focused bool) string {
+	if focused {
+		return "\x1b[1m" + title + " *\x1b[0m"
+	}
+	return title
+}
+
+func tuiCursor(active bool) string {
+	if active {
+		return ">"
+	}
+	return " "
+}
+
+func volumeBar(volume int, width int) string {
+	filled := max(0, min(width, volume*width/100))
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	t.Parallel()
+
+	got := decodeKeys([]byte("q \x1b[A\x1b[B\r\t+\x03"))
+	want := []string{"q", "space", "up", "down", "enter", "tab", "+", "ctrl+c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decodeKeys=%v, want %v", got, want)
+	}
+}
+
+func TestTUIModelHandleKey(t *testing.T) {
+	t.Parallel()
+
+	m := &tuiModel{
+		Devices: []music.AirPlayDevice{
+			{Name: "Bedroom", Selected: true, Volume: 40},
+			{Name: "Kitchen", Selected: false, Volume: 98},
+		},
+		Playlists: []music.UserPlaylist{{PersistentID: "P1", Name: "Chill"}},
+	}
+
+	if cmd := m.handleKey("down"); cmd.Kind != "" || m.Cursor[tuiPaneOutputs] != 1 {
+		t.Fatalf("down cmd=%+v cursor=%v", cmd, m.Cursor)
+	}
+	if cmd := m.handleKey("down"); cmd.Kind != "" || m.Cursor[tuiPaneOutputs] != 1 {
+		t.Fatalf("cursor should clamp at last device, got %v", m.Cursor)
+	}
+	cmd := m.handleKey("enter")
+	if cmd.Kind != "outputs" || !reflect.DeepEqual(cmd.Rooms, []string{"Bedroom", "Kitchen"}) {
+		t.Fatalf("toggle cmd=%+v", cmd)
+	}
+	cmd = m.handleKey("+")
+	if cmd.Kind != "volume" || cmd.Room != "Kitchen" || cmd.Volume != 100 {
+		t.Fatalf("volume cmd=%+v", cmd)
+	}
+
+	m.Cursor[tuiPaneOutputs] = 0
+	if cmd := m.handleKey("enter"); cmd.Kind != "" || !strings.Contains(m.Message, "at least one output") {
+		t.Fatalf("deselecting last output should be refused, cmd=%+v message=%q", cmd, m.Message)
+	}
+
+	m.handleKey("tab")
+	cmd = m.handleKey("enter")
+	if cmd.Kind != "play" || cmd.PlaylistID != "P1" {
+		t.Fatalf("play cmd=%+v", cmd)
+	}
+	if cmd := m.handleKey("space"); cmd.Kind != "transport" || cmd.Action != "playpause" {
+		t.Fatalf("space cmd=%+v", cmd)
+	}
+	if cmd := m.handleKey("q"); cmd.Kind != "quit" {
+		t.Fatalf("q cmd=%+v", cmd)
+	}
+}
+
+func TestRenderTUI(t *testing.T) {
+	t.Parallel()
+
+	m := &tuiModel{
+		NowPlaying: &music.NowPlaying{
+			PlayerState:  "playing",
+			PlaylistName: "Chill",
+			Track:        music.NowPlayingTrack{Name: "Song", Artist: "Artist", DurationS: 200},
+		},
+		Devices:   []music.AirPlayDevice{{Name: "Bedroom", Selected: true, Volume: 50}},
+		Playlists: []music.UserPlaylist{{PersistentID: "P1", Name: "Chill"}},
+		Message:   "ok",
+	}
+	out := strings.Join(renderTUI(m), "\n")
+	for _, want := range []string{"state=playing", `track="Song"`, "> [x] Bedroom", "██████████░░░░░░░░░░  50", "  Chill", "1/1", "ok"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("render missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/state"
+)
+
+// undoSnapshot is Music.app's state right before the last successful
+// output, volume, or playlist change. It lives in the state dir as undo.json.
+type undoSnapshot struct {
+	Time        string         `json:"time"`
+	Command     string         `json:"command"`
+	Args        []string       `json:"args"`
+	Outputs     []string       `json:"outputs"`
+	Volumes     map[string]int `json:"volumes"`
+	PlayerState string         `json:"playerState,omitempty"`
+	Playlist    string         `json:"playlist,omitempty"`
+	PlaylistID  string         `json:"playlistId,omitempty"`
+}
+
+type undoResult struct {
+	OK         bool           `json:"ok"`
+	Action     string         `json:"action"`
+	DryRun     bool           `json:"dryRun,omitempty"`
+	Undid      string         `json:"undid"`
+	At         string         `json:"at"`
+	Outputs    []string       `json:"outputs,omitempty"`
+	Volumes    map[string]int `json:"volumes,omitempty"`
+	Playlist   string         `json:"playlist,omitempty"`
+	PlaylistID string         `json:"playlistId,omitempty"`
+	Paused     bool           `json:"paused,omitempty"`
+}
+
+// pendingUndo is captured before the command changes anything and saved
+// only if it succeeds, so failed commands keep the previous undo point.
+// undoDraft is the snapshot armed for the command until Music.app's state
+// fills it in.
+var (
+	pendingUndo *undoSnapshot
+	undoDraft   *undoSnapshot
+)
+
+func defaultUndoStatePath() (string, error) {
+	return state.Path("undo.json")
+}
+
+// isUndoableCommand reports whether cmd changes outputs, volumes, or the
+// playing playlist through Music.app; --app spotify does not.
+func isUndoableCommand(cmd string, args []string) bool {
+	if flags, _, err := parseArgs(args); err == nil {
+		if app, err := parseApp(flags); err != nil || app != appMusic {
+			return false
+		}
+	}
+	switch cmd {
+	case "play", "radio", "volume", "vol", "mute", "unmute", "duck", "unduck", "move", "handoff", "run", "undo":
+	case "pause", "stop", "resume":
+		// only --room changes the outputs.
+		if flags, _, err := parseArgs(args); err != nil || len(flags.strings("room")) == 0 {
+			return false
+		}
+	case "out":
+		if len(args) == 0 || (args[0] != "set" && args[0] != "add" && args[0] != "remove") {
+			return false
+		}
+	case "mixer":
+		if !hasMixerAssignments(args) {
+			return false
+		}
+	default:
+		return false
+	}
+	flags, _, err := parseArgs(args)
+	if err != nil {
+		return false
+	}
+	// native shortcuts never touch Music.app's state.
+	return strings.TrimSpace(flags.string("backend")) != "native"
+}
+
+// captureUndoSnapshot arms the undo snapshot for cmd without reading
+// Music.app up front. The snapshot is taken from the first now-playing read
+// the command makes anyway, or from a read folded into its first batch; a
+// change that comes before either reads the state right then. A command that
+// fails before changing anything costs no extra round-trip.
+func captureUndoSnapshot(cmd string, args []string) {
+	if !isUndoableCommand(cmd, args) || isDryRunInvocation(args) {
+		return
+	}
+	undoDraft = &undoSnapshot{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Command: cmd,
+		Args:    append([]string{}, args...),
+	}
+
+	nowPlaying := getNowPlaying
+	getNowPlaying = func(ctx context.Context) (music.NowPlaying, error) {
+		np, err := nowPlaying(ctx)
+		if err == nil {
+			fillUndoSnapshot(np)
+		}
+		return np, err
+	}
+	runBatch := runMusicBatch
+	runMusicBatch = func(ctx context.Context, b *music.Batch) (music.BatchResult, error) {
+		if undoDraft == nil {
+			return runBatch(ctx, b)
+		}
+		res, err := runBatch(ctx, b.Before())
+		if res.Before != nil {
+			fillUndoSnapshot(*res.Before)
+		} else {
+			debugf("undo: snapshot skipped: no state read before the batch")
+			undoDraft = nil
+		}
+		return res, err
+	}
+	// The remaining changes run one call at a time; read the state before
+	// the first of them if nothing has yet.
+	before := func(ctx context.Context) {
+		if undoDraft == nil {
+			return
+		}
+		snapCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		defer cancel()
+		np, err := nowPlaying(snapCtx)
+		if err != nil {
+			debugf("undo: snapshot skipped: %v", err)
+			undoDraft = nil
+			return
+		}
+		fillUndoSnapshot(np)
+	}
+	setOutputs, selectOuts, setVolume := setCurrentOutputs, selectOutputs, setDeviceVolume
+	playID, playStation, pause, stop := playPlaylistByID, playStationByID, pausePlayback, stopPlayback
+	setCurrentOutputs = func(ctx context.Context, rooms []string) error { before(ctx); return setOutputs(ctx, rooms) }
+	selectOutputs = func(ctx context.Context, rooms []string) ([]music.OutputStatus, error) {
+		before(ctx)
+		return selectOuts(ctx, rooms)
+	}
+	setDeviceVolume = func(ctx context.Context, room string, v int) error { before(ctx); return setVolume(ctx, room, v) }
+	playPlaylistByID = func(ctx context.Context, id string) error { before(ctx); return playID(ctx, id) }
+	playStationByID = func(ctx context.Context, id string) error { before(ctx); return playStation(ctx, id) }
+	pausePlayback = func(ctx context.Context) error { before(ctx); return pause(ctx) }
+	stopPlayback = func(ctx context.Context) error { before(ctx); return stop(ctx) }
+}
+
+// fillUndoSnapshot completes the armed snapshot from np, the state before
+// the command's first change.
+func fillUndoSnapshot(np music.NowPlaying) {
+	snap := undoDraft
+	if snap == nil {
+		return
+	}
+	undoDraft = nil
+	snap.Volumes = map[string]int{}
+	snap.PlayerState, snap.Playlist, snap.PlaylistID = np.PlayerState, np.PlaylistName, np.PlaylistID
+	for _, d := range np.Outputs {
+		snap.Outputs = append(snap.Outputs, d.Name)
+		snap.Volumes[d.Name] = d.Volume
+	}
+	pendingUndo = snap
+}
+
+func commitUndoSnapshot() {
+	snap := pendingUndo
+	if snap == nil {
+		return
+	}
+	pendingUndo = nil
+	if err := saveUndoSnapshot(snap); err != nil {
+		debugf("undo: %v", err)
+	}
+}
+
+func loadUndoSnapshot() (*undoSnapshot, error) {
+	path, err := undoStatePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snap undoSnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+func saveUndoSnapshot(snap *undoSnapshot) error {
+	path, err := undoStatePath()
+	if err != nil {
+		return err
+	}
+	if err := state.Prepare(filepath.Dir(path)); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func cmdUndo(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl undo [--json] [--dry-run]"))
+	}
+	opts, err := parseOutputOptions(flags)
+	if err != nil {
+		die(err)
+	}
+	snap, err := loadUndoSnapshot()
+	if err != nil {
+		die(err)
+	}
+	if snap == nil {
+		die(errors.New("nothing to undo (no output, volume, or playlist change recorded yet)"))
+	}
+
+	res := undoResult{
+		OK:      true,
+		Action:  "undo",
+		DryRun:  opts.DryRun,
+		Undid:   strings.TrimSpace(snap.Command + " " + strings.Join(snap.Args, " ")),
+		At:      snap.Time,
+		Outputs: snap.Outputs,
+		Volumes: snap.Volumes,
+	}
+	current, err := getNowPlaying(ctx)
+	if err != nil {
+		die(err)
+	}
+	restorePlaylist := snap.PlaylistID != "" && snap.PlaylistID != current.PlaylistID
+	if restorePlaylist {
+		res.Playlist, res.PlaylistID = snap.Playlist, snap.PlaylistID
+	}
+	res.Paused = snap.PlayerState != "playing" && (current.PlayerState == "playing" || restorePlaylist)
+
+	if !opts.DryRun {
+		if len(snap.Outputs) > 0 {
+			if err := setCurrentOutputs(ctx, snap.Outputs); err != nil {
+				die(err)
+			}
+		}
+		rooms := make([]string, 0, len(snap.Volumes))
+		for room := range snap.Volumes {
+			rooms = append(rooms, room)
+		}
+		sort.Strings(rooms)
+		for _, room := range rooms {
+			if err := setDeviceVolume(ctx, room, snap.Volumes[room]); err != nil {
+				die(err)
+			}
+		}
+		if restorePlaylist {
+			if err := playPlaylistByID(ctx, snap.PlaylistID); err != nil {
+				die(err)
+			}
+		}
+		if res.Paused {
+			if err := pausePlayback(ctx); err != nil {
+				die(err)
+			}
+		}
+	}
+
+	recordResult(res)
+	if opts.JSON {
+		writeJSON(res)
+		return
+	}
+	if quiet {
+		return
+	}
+	prefix := "undo"
+	if opts.DryRun {
+		prefix = "dry-run: would undo"
+	}
+	fmt.Printf("%s %q from %s\n", prefix, res.Undid, res.At)
+	if len(res.Outputs) > 0 {
+		fmt.Printf("  outputs: %s\n", strings.Join(res.Outputs, ", "))
+	}
+	for _, room := range res.Outputs {
+		if v, ok := res.Volumes[room]; ok {
+			fmt.Printf("  volume %s: %d\n", room, v)
+		}
+	}
+	if restorePlaylist {
+		fmt.Printf("  playlist: %s\n", res.Playlist)
+	}
+	if res.Paused {
+		fmt.Println("  playback: paused")
+	}
+}
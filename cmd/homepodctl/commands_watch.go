@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+// nowPlayingEvent is emitted when the polled now-playing snapshot changes.
+type nowPlayingEvent struct {
+	Event         string           `json:"event"` // track.changed|state.changed
+	At            time.Time        `json:"at"`
+	PreviousState string           `json:"previousState,omitempty"`
+	NowPlaying    music.NowPlaying `json:"nowPlaying"`
+}
+
+var runHook = func(ctx context.Context, command string, env []string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func cmdWatch(ctx context.Context, args []string) {
+	flags, positionals, err := parseArgs(args)
+	if err != nil {
+		die(err)
+	}
+	if len(positionals) != 0 {
+		die(usageErrf("usage: homepodctl watch [--on-track-change <cmd>] [--on-state-change <cmd>] [--interval <duration>] [--json]"))
+	}
+	jsonOut, _, err := parseOutputFlags(flags)
+	if err != nil {
+		die(err)
+	}
+	interval := 2 * time.Second
+	if raw := strings.TrimSpace(flags.string("interval")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			die(usageErrf("invalid --interval %q (expected duration like 2s)", raw))
+		}
+		interval = d
+	}
+	hooks := map[string]string{
+		"track.changed": strings.TrimSpace(flags.string("on-track-change")),
+		"state.changed": strings.TrimSpace(flags.string("on-state-change")),
+	}
+	debugf("watch: interval=%s hooks=%v", interval, hooks)
+
+	// watch runs until interrupted, so it must not inherit the per-command timeout.
+	base := context.WithoutCancel(ctx)
+	err = watchNowPlaying(base, interval, func(_ music.NowPlaying, events []nowPlayingEvent) {
+		for _, ev := range events {
+			if jsonOut {
+				writeJSONLine(ev)
+			} else if !quiet {
+				fmt.Println(formatNowPlayingEvent(ev))
+			}
+			if hook := hooks[ev.Event]; hook != "" {
+				if err := runHook(base, hook, hookEnv(ev)); err != nil {
+					fmt.Fprintf(os.Stderr, "homepodctl: %s hook failed: %v\n", ev.Event, err)
+				}
+			}
+		}
+	})
+	if err != nil {
+		die(err)
+	}
+}
+
+// watchNowPlaying polls now-playing every interval until ctx is done. fn gets
+// every snapshot plus the events derived from the previous one; the first
+// snapshot is a baseline and yields no events. Poll errors are logged and
+// skipped so a busy Music.app does not end the watch.
+func watchNowPlaying(ctx context.Context, interval time.Duration, fn func(music.NowPlaying, []nowPlayingEvent)) error {
+	var prev *music.NowPlaying
+	return runStatusLoop(ctx, interval, func() error {
+		pollCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		defer cancel()
+		np, err := getNowPlaying(pollCtx)
+		if err != nil {
+			debugf("watch: poll failed: %v", err)
+			return nil
+		}
+		events := diffNowPlaying(prev, np, time.Now())
+		prev = &np
+		noteTrack(np)
+		fn(np, events)
+		return nil
+	})
+}
+
+func diffNowPlaying(prev *music.NowPlaying, cur music.NowPlaying, at time.Time) []nowPlayingEvent {
+	if prev == nil {
+		return nil
+	}
+	var events []nowPlayingEvent
+	if k := trackKey(cur.Track); k != "" && k != trackKey(prev.Track) {
+		events = append(events, nowPlayingEvent{Event: "track.changed", At: at, NowPlaying: cur})
+	}
+	if cur.PlayerState != prev.PlayerState {
+		events = append(events, nowPlayingEvent{Event: "state.changed", At: at, PreviousState: prev.PlayerState, NowPlaying: cur})
+	}
+	return events
+}
+
+func trackKey(t music.NowPlayingTrack) string {
+	if id := strings.TrimSpace(t.PersistentID); id != "" {
+		return id
+	}
+	if t.Name == "" {
+		return ""
+	}
+	return t.Name + "\x00" + t.Artist + "\x00" + t.Album
+}
+
+func formatNowPlayingEvent(ev nowPlayingEvent) string {
+	at := ev.At.Format(time.RFC3339)
+	if ev.Event == "state.changed" {
+		return fmt.Sprintf("%s %s %s -> %s", at, ev.Event, ev.PreviousState, ev.NowPlaying.PlayerState)
+	}
+	return fmt.Sprintf("%s %s %q artist=%q album=%q", at, ev.Event, ev.NowPlaying.Track.Name, ev.NowPlaying.Track.Artist, ev.NowPlaying.Track.Album)
+}
+
+// hookEnv exposes the event to hook commands as HOMEPODCTL_* variables.
+func hookEnv(ev nowPlayingEvent) []string {
+	np := ev.NowPlaying
+	var outputs []string
+	for _, o := range np.Outputs {
+		outputs = append(outputs, o.Name)
+	}
+	return []string{
+		"HOMEPODCTL_EVENT=" + ev.Event,
+		"HOMEPODCTL_STATE=" + np.PlayerState,
+		"HOMEPODCTL_PREVIOUS_STATE=" + ev.PreviousState,
+		"HOMEPODCTL_TRACK_NAME=" + np.Track.Name,
+		"HOMEPODCTL_TRACK_ARTIST=" + np.Track.Artist,
+		"HOMEPODCTL_TRACK_ALBUM=" + np.Track.Album,
+		"HOMEPODCTL_TRACK_ID=" + np.Track.PersistentID,
+		"HOMEPODCTL_TRACK_DURATION=" + strconv.FormatFloat(np.Track.DurationS, 'f', -1, 64),
+		"HOMEPODCTL_POSITION=" + strconv.FormatFloat(np.PlayerPositionS, 'f', -1, 64),
+		"HOMEPODCTL_PLAYLIST=" + np.PlaylistName,
+		"HOMEPODCTL_PLAYLIST_ID=" + np.PlaylistID,
+		"HOMEPODCTL_OUTPUTS=" + strings.Join(outputs, ","),
+	}
+}
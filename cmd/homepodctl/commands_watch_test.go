@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+func TestDiffNowPlaying(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	a := music.NowPlaying{PlayerState: "playing", Track: music.NowPlayingTrack{Name: "A", PersistentID: "T1"}}
+	if got := diffNowPlaying(nil, a, at); len(got) != 0 {
+		t.Fatalf("baseline should not emit events, got=%v", got)
+	}
+	b := music.NowPlaying{PlayerState: "paused", Track: music.NowPlayingTrack{Name: "B", PersistentID: "T2"}}
+	got := diffNowPlaying(&a, b, at)
+	if len(got) != 2 || got[0].Event != "track.changed" || got[1].Event != "state.changed" || got[1].PreviousState != "playing" {
+		t.Fatalf("unexpected events: %+v", got)
+	}
+	stopped := music.NowPlaying{PlayerState: "paused"}
+	if got := diffNowPlaying(&b, stopped, at); len(got) != 0 {
+		t.Fatalf("empty track should not emit track.changed, got=%+v", got)
+	}
+}
+
+func TestWatchNowPlayingEmitsTrackChange(t *testing.T) {
+	origGetNowPlaying := getNowPlaying
+	origTicker := newStatusTicker
+	t.Cleanup(func() {
+		getNowPlaying = origGetNowPlaying
+		newStatusTicker = origTicker
+	})
+
+	snapshots := []music.NowPlaying{
+		{PlayerState: "playing", Track: music.NowPlayingTrack{Name: "One", PersistentID: "T1"}},
+		{PlayerState: "playing", Track: music.NowPlayingTrack{Name: "Two", Artist: "Band", PersistentID: "T2"}},
+	}
+	polls := 0
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		np := snapshots[min(polls, len(snapshots)-1)]
+		polls++
+		return np, nil
+	}
+	fake := &fakeStatusTicker{ch: make(chan time.Time)}
+	newStatusTicker = func(time.Duration) statusTicker { return fake }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []nowPlayingEvent
+	done := make(chan error, 1)
+	go func() {
+		done <- watchNowPlaying(ctx, time.Second, func(_ music.NowPlaying, events []nowPlayingEvent) {
+			got = append(got, events...)
+			if len(got) > 0 {
+				cancel()
+			}
+		})
+	}()
+	fake.ch <- time.Now()
+	if err := <-done; err != nil {
+		t.Fatalf("watchNowPlaying: %v", err)
+	}
+	if len(got) != 1 || got[0].Event != "track.changed" || got[0].NowPlaying.Track.Name != "Two" {
+		t.Fatalf("unexpected events: %+v", got)
+	}
+
+	env := strings.Join(hookEnv(got[0]), "\n")
+	for _, want := range []string{"HOMEPODCTL_EVENT=track.changed", "HOMEPODCTL_TRACK_NAME=Two", "HOMEPODCTL_TRACK_ARTIST=Band", "HOMEPODCTL_TRACK_ID=T2"} {
+		if !strings.Contains(env, want) {
+			t.Fatalf("hook env missing %q: %s", want, env)
+		}
+	}
+}
+
+func TestNotifyTrackChangeIncludesArtwork(t *testing.T) {
+	origExportArtwork := exportArtwork
+	origPostNotification := postNotification
+	t.Cleanup(func() {
+		exportArtwork = origExportArtwork
+		postNotification = origPostNotification
+	})
+	exportArtwork = func(context.Context, string) (string, error) { return "jpeg", nil }
+	var got native.Notification
+	postNotification = func(_ context.Context, n native.Notification) error {
+		got = n
+		return nil
+	}
+
+	notifyTrackChange(context.Background(), statusTrack{Name: "Song", Artist: "Band", Album: "LP"})
+	if got.Title != "Song" || got.Subtitle != "Band" || got.Message != "LP" || got.ImagePath == "" {
+		t.Fatalf("unexpected notification: %+v", got)
+	}
+
+	exportArtwork = func(context.Context, string) (string, error) { return "", music.ErrNoArtwork }
+	notifyTrackChange(context.Background(), statusTrack{Name: "Other", Artist: "Band"})
+	if got.Title != "Other" || got.Message != "Band" || got.ImagePath != "" {
+		t.Fatalf("unexpected notification without artwork: %+v", got)
+	}
+}
+
+func TestDiffDevices(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	prev := []music.AirPlayDevice{
+		{Name: "Kitchen", Available: false, Volume: 20},
+		{Name: "Bedroom", Available: true, Selected: true, Volume: 30},
+		{Name: "Office", Available: true},
+	}
+	cur := []music.AirPlayDevice{
+		{Name: "Kitchen", Available: true, Selected: true, Volume: 20},
+		{Name: "Bedroom", Available: true, Selected: true, Volume: 45},
+		{Name: "Patio", Available: true},
+	}
+	var names []string
+	for _, ev := range diffDevices(prev, cur, at) {
+		names = append(names, ev.Event+":"+ev.Device.Name)
+		if ev.Event == "device.volume" && (ev.PreviousVolume == nil || *ev.PreviousVolume != 30) {
+			t.Fatalf("volume event without previous volume: %+v", ev)
+		}
+	}
+	want := "device.online:Kitchen device.selected:Kitchen device.volume:Bedroom device.added:Patio device.removed:Office"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("events=%s\nwant=%s", got, want)
+	}
+	if got := diffDevices(cur, cur, at); len(got) != 0 {
+		t.Fatalf("unchanged devices emitted %+v", got)
+	}
+}
+
+func TestWatchDevicesEmitsChanges(t *testing.T) {
+	origList := listAirPlayDevices
+	origTicker := newStatusTicker
+	t.Cleanup(func() {
+		listAirPlayDevices = origList
+		newStatusTicker = origTicker
+	})
+
+	snapshots := [][]music.AirPlayDevice{
+		{{Name: "Kitchen", Available: true, Volume: 20, NetworkAddress: "aa:bb"}},
+		{{Name: "Kitchen", Available: false, Volume: 20, NetworkAddress: "aa:bb"}},
+	}
+	polls := 0
+	fake := &fakeStatusTicker{ch: make(chan time.Time)}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		devs := snapshots[min(polls, len(snapshots)-1)]
+		polls++
+		return append([]music.AirPlayDevice(nil), devs...), nil
+	}
+	newStatusTicker = func(time.Duration) statusTicker { return fake }
+	go func() {
+		fake.ch <- time.Now()
+	}()
+
+	var events []deviceEvent
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := watchDevices(ctx, time.Second, func(_ []music.AirPlayDevice, evs []deviceEvent) {
+		events = append(events, evs...)
+		if polls == len(snapshots) {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("watchDevices: %v", err)
+	}
+	if len(events) != 1 || events[0].Event != "device.offline" || events[0].Device.Name != "Kitchen" {
+		t.Fatalf("events=%+v", events)
+	}
+}
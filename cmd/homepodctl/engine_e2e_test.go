@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/music/musictest"
+	"github.com/agisilaos/homepodctl/internal/native"
+)
+
+// These tests leave the music seams at their defaults and swap the engine
+// underneath, so each command runs its real path down to Music.app.
+
+func newFakeMusic(t *testing.T) *musictest.Engine {
+	t.Helper()
+	fake := musictest.New(
+		[]music.AirPlayDevice{
+			{Name: "Kitchen", Kind: "HomePod", Available: true, Volume: 20},
+			{Name: "Bedroom", Kind: "HomePod", Available: true, Volume: 25},
+			{Name: "Office", Kind: "computer", Available: true, Selected: true, Volume: 60},
+		},
+		[]music.UserPlaylist{
+			{PersistentID: "PL1", Name: "Chill", Plays: 12},
+			{PersistentID: "PL2", Name: "Focus", Plays: 3},
+		},
+	)
+	fake.Tracks = []music.LibraryItem{
+		{Kind: "track", PersistentID: "T1", Name: "Intro", Artist: "Bonobo", Album: "Migration", DurationS: 200},
+		{Kind: "track", PersistentID: "T2", Name: "Kerala", Artist: "Bonobo", Album: "Migration", DurationS: 240},
+	}
+	fake.PlaylistTracks["PL1"] = []string{"T2"}
+	musictest.Install(t, fake)
+	return fake
+}
+
+func TestEngineEndToEnd_PlayVolumePauseStatus(t *testing.T) {
+	fake := newFakeMusic(t)
+	origLookPath := lookPath
+	t.Cleanup(func() { lookPath = origLookPath })
+	lookPath = func(string) (string, error) { return "/usr/bin/osascript", nil }
+	ctx := context.Background()
+	vol := 40
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Kitchen", "Bedroom"}, Volume: &vol}}
+
+	captureStdout(t, func() { cmdPlay(ctx, cfg, []string{"chill", "--json"}) })
+	captureStdout(t, func() { cmdVolume(ctx, cfg, "volume", []string{"Bedroom=55", "--json"}) })
+	captureStdout(t, func() { cmdTransport(ctx, []string{"--json"}, "pause", music.Pause) })
+
+	out := captureStdout(t, func() { cmdStatus(ctx, []string{"--json"}) })
+	var res statusResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("status json: %v\n%s", err, out)
+	}
+	if res.Player != "paused" || res.Track == nil || res.Track.Name != "Kerala" {
+		t.Fatalf("status=%+v", res)
+	}
+	var outputs []string
+	for _, o := range res.Outputs {
+		outputs = append(outputs, o.Room+"="+strconv.Itoa(o.Volume))
+	}
+	if got := strings.Join(outputs, ","); got != "Kitchen=40,Bedroom=55" {
+		t.Fatalf("outputs=%s", got)
+	}
+	if got := fake.CallsTo("RunBatch"); len(got) != 1 {
+		t.Fatalf("play should run one batch, calls=%v", fake.Calls)
+	}
+}
+
+func TestEngineEndToEnd_PlayStartTrack(t *testing.T) {
+	fake := newFakeMusic(t)
+	fake.PlaylistTracks["PL1"] = []string{"T1", "T2"}
+	ctx := context.Background()
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Kitchen"}}}
+
+	out := captureStdout(t, func() { cmdPlay(ctx, cfg, []string{"chill", "--track", "kerala", "--json"}) })
+	var res actionResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("play json: %v\n%s", err, out)
+	}
+	if res.StartTrack == nil || res.StartTrack.Index != 2 || res.NowPlaying == nil || res.NowPlaying.Track.Name != "Kerala" {
+		t.Fatalf("res=%+v", res)
+	}
+
+	fake.PlayedDates = map[string]time.Time{"T1": time.Now(), "T2": time.Now().Add(-time.Hour)}
+	fake.Bookmarks = map[string]float64{"T1": 30}
+	captureStdout(t, func() { cmdPlay(ctx, cfg, []string{"chill", "--resume", "--json"}) })
+	if got := fake.CallsTo("PlayPlaylistTrack"); len(got) != 2 || got[1] != "PlayPlaylistTrack PL1 1" {
+		t.Fatalf("play calls=%v", got)
+	}
+	if got := fake.CallsTo("SetPlayerPosition"); len(got) != 1 || got[0] != "SetPlayerPosition 30" {
+		t.Fatalf("seek calls=%v", got)
+	}
+	// Without a saved position the last played track finished: start at the
+	// next one, and wrap to the top after the last track.
+	fake.Bookmarks = nil
+	captureStdout(t, func() { cmdPlay(ctx, cfg, []string{"chill", "--resume", "--json"}) })
+	fake.PlayedDates = map[string]time.Time{"T2": time.Now()}
+	captureStdout(t, func() { cmdPlay(ctx, cfg, []string{"chill", "--resume", "--json"}) })
+	if got := fake.CallsTo("PlayPlaylistTrack"); len(got) != 4 || got[2] != "PlayPlaylistTrack PL1 2" || got[3] != "PlayPlaylistTrack PL1 1" {
+		t.Fatalf("play calls=%v", got)
+	}
+	if got := fake.CallsTo("SetPlayerPosition"); len(got) != 1 {
+		t.Fatalf("seek calls=%v", got)
+	}
+
+	for _, args := range [][]string{
+		{"chill", "--track", "kerala", "--resume"},
+		{"chill", "--track-index", "3"},
+		{"chill", "--track-index", "0"},
+		{"chill", "--backend", "native", "--resume"},
+	} {
+		_, recovered := captureStdoutAndRecover(t, func() { cmdPlay(ctx, cfg, args) })
+		fatal, ok := recovered.(cliFatal)
+		if !ok || classifyExitCode(fatal.err) != exitUsage {
+			t.Fatalf("args=%v recovered=%#v", args, recovered)
+		}
+	}
+}
+
+func TestEngineEndToEnd_ShuffleModeAndCrossfade(t *testing.T) {
+	fake := newFakeMusic(t)
+	ctx := context.Background()
+
+	out := captureStdout(t, func() { cmdShuffle(ctx, []string{"--mode", "albums", "--json"}) })
+	var res playbackModeResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("shuffle json: %v\n%s", err, out)
+	}
+	if res.Shuffle == nil || !*res.Shuffle || res.ShuffleMode != "albums" || fake.ShuffleMode != "albums" || !fake.Player.ShuffleEnabled {
+		t.Fatalf("res=%+v fake mode=%q shuffle=%t", res, fake.ShuffleMode, fake.Player.ShuffleEnabled)
+	}
+	if got := captureStdout(t, func() { cmdCrossfade(ctx, []string{"6s", "--ui-scripting"}) }); got != "crossfade=6s\n" || fake.Crossfade != 6 {
+		t.Fatalf("crossfade out=%q fake=%d", got, fake.Crossfade)
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+	alias := native.Alias{Rooms: []string{"Kitchen"}, ShuffleMode: "groupings"}
+	if _, err := runAlias(ctx, cfg, "dinner", alias, false, false); err != nil {
+		t.Fatalf("runAlias: %v", err)
+	}
+	if fake.ShuffleMode != "groupings" || fake.Crossfade != 6 {
+		t.Fatalf("alias mode=%q crossfade=%d", fake.ShuffleMode, fake.Crossfade)
+	}
+
+	for _, run := range []func(){
+		func() { cmdShuffle(ctx, []string{"--mode", "artists"}) },
+		func() { cmdShuffle(ctx, nil) },
+		func() { cmdCrossfade(ctx, []string{"13", "--ui-scripting"}) },
+		func() { cmdCrossfade(ctx, []string{"off"}) },
+	} {
+		_, recovered := captureStdoutAndRecover(t, run)
+		if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+			t.Fatalf("recovered=%#v", recovered)
+		}
+	}
+}
+
+func TestEngineEndToEnd_VolumeSync(t *testing.T) {
+	fake := newFakeMusic(t)
+	ctx := context.Background()
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay", Rooms: []string{"Kitchen"}}}
+	fake.Devices[0].Selected = true // Kitchen at 20, Office at 60
+
+	captureStdout(t, func() { cmdVolume(ctx, cfg, "volume", []string{"30", "--sync", "--json"}) })
+	if fake.SoundVolume != 30 || fake.Devices[0].Volume != 10 || fake.Devices[2].Volume != 30 || fake.Devices[1].Volume != 25 {
+		t.Fatalf("master=%d devices=%+v", fake.SoundVolume, fake.Devices)
+	}
+	captureStdout(t, func() { cmdVolume(ctx, cfg, "volume", []string{"+30", "--sync"}) })
+	if fake.SoundVolume != 60 || fake.Devices[0].Volume != 20 || fake.Devices[2].Volume != 60 {
+		t.Fatalf("master=%d devices=%+v", fake.SoundVolume, fake.Devices)
+	}
+
+	for _, args := range [][]string{
+		{"30", "Kitchen", "--sync"},
+		{"Kitchen=30", "--sync"},
+		{"30", "--sync", "--backend", "native"},
+	} {
+		_, recovered := captureStdoutAndRecover(t, func() { cmdVolume(ctx, cfg, "volume", args) })
+		if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+			t.Fatalf("%v: recovered=%#v", args, recovered)
+		}
+	}
+}
+
+func TestEngineEndToEnd_Mixer(t *testing.T) {
+	fake := newFakeMusic(t)
+	origPath := configPath
+	t.Cleanup(func() { configPath = origPath })
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	configPath = func() (string, error) { return filepath.Join(dir, "config.json"), nil }
+	ctx := context.Background()
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+
+	out := captureStdout(t, func() { cmdMixer(ctx, cfg, []string{"--json"}) })
+	var res mixerResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("mixer json: %v\n%s", err, out)
+	}
+	if len(res.Rooms) != 1 || res.Rooms[0].Room != "Office" || res.Rooms[0].After != 60 || len(res.Changed) != 0 {
+		t.Fatalf("res=%+v", res)
+	}
+
+	out = captureStdout(t, func() { cmdMixer(ctx, cfg, []string{"Office=+5", "kitchen=40", "Bedroom=mute", "--json"}) })
+	res = mixerResult{}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("mixer json: %v\n%s", err, out)
+	}
+	if got := fake.CallsTo("RunBatch"); len(got) != 1 {
+		t.Fatalf("mixer should run one batch, calls=%v", fake.Calls)
+	}
+	if fake.Devices[0].Volume != 40 || fake.Devices[1].Volume != 0 || fake.Devices[2].Volume != 65 {
+		t.Fatalf("devices=%+v", fake.Devices)
+	}
+	want := []mixerRoom{
+		{Room: "Office", Selected: true, Before: 60, After: 65},
+		{Room: "Kitchen", Before: 20, After: 40},
+		{Room: "Bedroom", Before: 25, After: 0, Muted: true},
+	}
+	if !reflect.DeepEqual(res.Rooms, want) {
+		t.Fatalf("rooms=%+v", res.Rooms)
+	}
+	if st, err := loadMuteState(); err != nil || st.Rooms["Bedroom"] != 25 {
+		t.Fatalf("mute state=%+v err=%v", st, err)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() { cmdMixer(ctx, cfg, []string{"Kitchen=loud"}) })
+	if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+}
+
+func TestEngineEndToEnd_AnnounceRestoresPlayback(t *testing.T) {
+	fake := newFakeMusic(t)
+	origSleep := sleepFn
+	t.Cleanup(func() { sleepFn = origSleep })
+	var slept time.Duration
+	var during []music.AirPlayDevice
+	sleepFn = func(d time.Duration) {
+		slept = d
+		during = append([]music.AirPlayDevice(nil), fake.Devices...)
+	}
+	ctx := context.Background()
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+	fake.SpeechS = 3
+	fake.Player = music.NowPlaying{PlayerState: "playing", PlayerPositionS: 42, PlaylistName: "Chill", PlaylistID: "PL1",
+		Track: music.NowPlayingTrack{Name: "Kerala", PersistentID: "T2", DurationS: 240}}
+
+	out := captureStdout(t, func() {
+		cmdAnnounce(ctx, cfg, []string{"Dinner", "is", "ready", "--room", "kitchen", "--volume", "50", "--json"})
+	})
+	var res announceResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("unmarshal: %v (out=%q)", err, out)
+	}
+	if res.Text != "Dinner is ready" || strings.Join(res.Rooms, ",") != "Kitchen" || !res.Resumed || slept != 3*time.Second+announceTail {
+		t.Fatalf("res=%+v slept=%s", res, slept)
+	}
+	if !during[0].Selected || during[2].Selected || during[0].Volume != 50 {
+		t.Fatalf("devices during announcement=%+v", during)
+	}
+	if got := fake.CallsTo("PlaySpeech"); len(got) != 1 {
+		t.Fatalf("PlaySpeech calls=%v", got)
+	}
+	if got := fake.CallsTo("RemoveSpeech"); len(got) != 1 {
+		t.Fatalf("RemoveSpeech calls=%v, want the speech track removed", got)
+	}
+	if fake.Devices[0].Selected || !fake.Devices[2].Selected || fake.Devices[0].Volume != 20 {
+		t.Fatalf("devices after=%+v", fake.Devices)
+	}
+	if p := fake.Player; p.PlayerState != "playing" || p.Track.PersistentID != "T2" || p.PlayerPositionS != 42 {
+		t.Fatalf("player after=%+v", p)
+	}
+
+	// Nothing was playing: the speech plays and the outputs come back.
+	fake.Player = music.NowPlaying{PlayerState: "stopped"}
+	captureStdout(t, func() { cmdAnnounce(ctx, cfg, []string{"Hello", "--room", "Bedroom"}) })
+	if fake.Devices[1].Selected || !fake.Devices[2].Selected || len(fake.CallsTo("PlayPlaylistTrack")) != 1 {
+		t.Fatalf("devices=%+v calls=%v", fake.Devices, fake.Calls)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() { cmdAnnounce(ctx, cfg, []string{"--room", "Kitchen"}) })
+	if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+}
+
+func TestEngineEndToEnd_EQPresets(t *testing.T) {
+	fake := newFakeMusic(t)
+	fake.EQPresets = []music.EQPreset{{Name: "Flat", Current: true}, {Name: "Bass Booster"}, {Name: "Late Night"}}
+	ctx := context.Background()
+
+	out := captureStdout(t, func() { cmdEQ(ctx, []string{"set", "bass", "booster", "--json"}) })
+	var res playbackModeResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("eq set json: %v\n%s", err, out)
+	}
+	if res.Action != "eq.set" || res.EQPreset != "Bass Booster" || !fake.EQPresets[1].Current || fake.EQPresets[0].Current {
+		t.Fatalf("res=%+v presets=%+v", res, fake.EQPresets)
+	}
+	if got := captureStdout(t, func() { cmdEQ(ctx, []string{"list", "--plain"}) }); got != "Flat\tfalse\tfalse\nBass Booster\ttrue\tfalse\nLate Night\tfalse\tfalse\n" {
+		t.Fatalf("eq list=%q", got)
+	}
+
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+	if _, err := runAlias(ctx, cfg, "winddown", native.Alias{Rooms: []string{"Kitchen"}, EQ: "late night"}, false, false); err != nil {
+		t.Fatalf("runAlias: %v", err)
+	}
+	if !fake.EQPresets[2].Current {
+		t.Fatalf("alias eq not applied: %+v", fake.EQPresets)
+	}
+	if _, err := runAlias(ctx, cfg, "party", native.Alias{Rooms: []string{"Kitchen"}, EQ: "Loudness"}, false, false); err == nil || !strings.Contains(err.Error(), "unknown EQ preset") {
+		t.Fatalf("expected unknown preset error, got %v", err)
+	}
+}
+
+func TestEngineEndToEnd_PlaylistEditsAndErrors(t *testing.T) {
+	fake := newFakeMusic(t)
+	ctx := context.Background()
+
+	captureStdout(t, func() { cmdPlaylist(ctx, []string{"create", "Road Trip", "--json"}) })
+	if len(fake.Playlists) != 3 || fake.Playlists[2].Name != "Road Trip" {
+		t.Fatalf("playlists=%+v", fake.Playlists)
+	}
+	id := fake.Playlists[2].PersistentID
+	captureStdout(t, func() { cmdPlaylist(ctx, []string{"add", "--playlist-id", id, "--track-id", "T1", "--json"}) })
+	if got := strings.Join(fake.PlaylistTracks[id], ","); got != "T1" {
+		t.Fatalf("tracks=%s calls=%v", got, fake.Calls)
+	}
+
+	fake.Errors = map[string]error{"SetAirPlayDeviceVolume": errors.New("device is offline")}
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdVolume(ctx, &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}, "volume", []string{"30", "Kitchen"})
+	})
+	fatal, ok := recovered.(cliFatal)
+	if !ok || !strings.Contains(fatal.err.Error(), "device is offline") {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+}
+
+func TestEnsureMusicApp_LaunchesOnlyWhenNeeded(t *testing.T) {
+	fake := newFakeMusic(t)
+	origLoadConfig := loadConfigOptional
+	t.Cleanup(func() { loadConfigOptional = origLoadConfig })
+	loadConfigOptional = func() (*native.Config, error) { return &native.Config{}, nil }
+	ctx := context.Background()
+
+	fake.Running = false
+	ensureMusicApp(ctx, "volume", []string{"30", "--backend", "native"}, "hidden")
+	ensureMusicApp(ctx, "play", []string{"chill"}, "off")
+	ensureMusicApp(ctx, "config", []string{"list"}, "hidden")
+	if len(fake.CallsTo("LaunchApp")) != 0 || fake.Running {
+		t.Fatalf("unexpected launch: calls=%v", fake.Calls)
+	}
+
+	ensureMusicApp(ctx, "play", []string{"chill"}, "foreground")
+	if got := fake.CallsTo("LaunchApp"); len(got) != 1 || got[0] != "LaunchApp false" || !fake.Running {
+		t.Fatalf("launch calls=%v running=%t", got, fake.Running)
+	}
+	ensureMusicApp(ctx, "status", nil, "hidden")
+	if got := fake.CallsTo("LaunchApp"); len(got) != 1 {
+		t.Fatalf("launched a running app: %v", got)
+	}
+}
+
+func TestEngineEndToEnd_OutputSelectionVerified(t *testing.T) {
+	fake := newFakeMusic(t)
+	t.Cleanup(func() { music.SetRetryPolicy(music.DefaultRetryPolicy()) })
+	ctx := context.Background()
+	cfg := &native.Config{}
+
+	// Bedroom ignores the first selection and joins when selected again.
+	fake.JoinFailures = map[string]int{"Bedroom": 1}
+	out := captureStdout(t, func() { cmdOut(ctx, cfg, []string{"set", "Kitchen", "Bedroom", "--json"}) })
+	var res actionResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("json: %v (%s)", err, out)
+	}
+	want := []music.OutputStatus{{Room: "Kitchen", Selected: true}, {Room: "Bedroom", Selected: true}}
+	if !res.OK || len(res.Outputs) != 2 || res.Outputs[0] != want[0] || res.Outputs[1] != want[1] {
+		t.Fatalf("res=%+v", res)
+	}
+	if got := fake.CallsTo("SetCurrentAirPlayDevices"); len(got) != 2 {
+		t.Fatalf("selections=%v", got)
+	}
+
+	// Without --strict a room that never joins is reported, not fatal.
+	music.SetRetryPolicy(music.RetryPolicy{})
+	fake.JoinFailures = map[string]int{"Office": 10}
+	out = captureStdout(t, func() { cmdOut(ctx, cfg, []string{"add", "Office", "--json"}) })
+	res = actionResult{}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("json: %v (%s)", err, out)
+	}
+	if len(res.Outputs) != 3 || res.Outputs[2] != (music.OutputStatus{Room: "Office"}) {
+		t.Fatalf("outputs=%+v", res.Outputs)
+	}
+
+	out, recovered := captureStdoutAndRecover(t, func() { cmdOut(ctx, cfg, []string{"add", "Office", "--strict", "--json"}) })
+	if strings.Contains(out, `"ok": true`) {
+		t.Fatalf("--strict failure wrote an ok result: %s", out)
+	}
+	fatal, ok := recovered.(cliFatal)
+	var partial *music.PartialSelectionError
+	if !ok || !errors.As(fatal.err, &partial) || strings.Join(partial.Missing, ",") != "Office" || classifyExitCode(fatal.err) != exitBackend {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+}
+
+func TestEngineEndToEnd_FuzzyRooms(t *testing.T) {
+	fake := newFakeMusic(t)
+	fake.Devices[1].Name = "Bedroom HomePod"
+	ctx := context.Background()
+	cfg := &native.Config{Defaults: native.DefaultsConfig{Backend: "airplay"}}
+
+	captureStdout(t, func() { cmdVolume(ctx, cfg, "volume", []string{"30", "bedroom", "--json"}) })
+	if got := fake.CallsTo("SetAirPlayDeviceVolume"); len(got) != 1 || got[0] != "SetAirPlayDeviceVolume Bedroom HomePod 30" {
+		t.Fatalf("volume calls=%v", got)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdVolume(ctx, cfg, "volume", []string{"30", "bedroom", "--exact", "--json"})
+	})
+	fatal, ok := recovered.(cliFatal)
+	if !ok || !strings.Contains(fatal.err.Error(), `did you mean "Bedroom HomePod"`) || classifyExitCode(fatal.err) != exitUsage {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+
+	_, recovered = captureStdoutAndRecover(t, func() { cmdOut(ctx, cfg, []string{"set", "Kitchn", "--json"}) })
+	fatal, ok = recovered.(cliFatal)
+	if !ok || !strings.Contains(fatal.err.Error(), `did you mean "Kitchen"`) {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+	if got := fake.CallsTo("SetCurrentAirPlayDevices"); len(got) != 0 {
+		t.Fatalf("selected outputs for an unknown room: %v", got)
+	}
+}
@@ -106,6 +106,14 @@ func TestCLIQuietSuppressesDryRunOutput(t *testing.T) {
 	if strings.TrimSpace(out) != "" {
 		t.Fatalf("expected quiet output to be empty, got: %q", out)
 	}
+	code, out = run("volume", "30", "--dry-run", "--json", "--quiet")
+	if code != 0 || !strings.Contains(out, `"dryRun": true`) {
+		t.Fatalf("quiet should keep --json output: exit=%d out=%q", code, out)
+	}
+	code, out = run("--quiet", "volume", "loud", "--dry-run")
+	if code != exitUsage || !strings.Contains(out, "error:") {
+		t.Fatalf("quiet must keep errors: exit=%d out=%q", code, out)
+	}
 }
 
 func TestCLISetupJSON(t *testing.T) {
@@ -645,21 +653,34 @@ steps:
 		t.Fatalf("automation plan missing steps: %+v", auto.Plan)
 	}
 
-	code, out = run("plan", "automation", "validate", "-f", routinePath)
-	if code != exitUsage {
-		t.Fatalf("plan automation validate exit=%d want=%d out=%s", code, exitUsage, out)
+	code, out = run("plan", "automation", "validate", "-f", routinePath, "--json")
+	if code != 0 {
+		t.Fatalf("plan automation validate exit=%d out=%s", code, out)
 	}
-	if !strings.Contains(strings.ToLower(out), "automation run") {
-		t.Fatalf("unexpected automation non-run output: %s", out)
+	if err := json.Unmarshal([]byte(out), &auto); err != nil || auto.Plan["mode"] != "validate" {
+		t.Fatalf("plan automation validate: err=%v out=%s", err, out)
 	}
 
-	code, out = run("plan", "pause")
+	code, out = run("plan", "next", "--json")
+	if code != 0 {
+		t.Fatalf("plan next exit=%d out=%s", code, out)
+	}
+	if err := json.Unmarshal([]byte(out), &payload); err != nil || payload.Plan["action"] != "next" || payload.Plan["dryRun"] != true {
+		t.Fatalf("plan next: err=%v out=%s", err, out)
+	}
+
+	code, out = run("plan", "status")
 	if code != exitUsage {
 		t.Fatalf("plan unsupported exit=%d want=%d out=%s", code, exitUsage, out)
 	}
 	if !strings.Contains(strings.ToLower(out), "only supports") {
 		t.Fatalf("unexpected unsupported output: %s", out)
 	}
+
+	code, out = run("plan", "out", "list")
+	if code != exitUsage || !strings.Contains(out, "out set|add|remove") {
+		t.Fatalf("plan out list exit=%d out=%s", code, out)
+	}
 }
 
 func TestCLISchemaCommand(t *testing.T) {
@@ -701,3 +722,41 @@ func TestCLISchemaCommand(t *testing.T) {
 		t.Fatalf("unknown schema exit=%d want=%d out=%s", code, exitUsage, out)
 	}
 }
+
+func TestCLIConfigPathOverride(t *testing.T) {
+	bin := buildCLIBinary(t)
+
+	home := t.TempDir()
+	cfgPath := filepath.Join(t.TempDir(), "ci.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"defaults":{"backend":"native","rooms":["Kitchen"]}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	run := func(env []string, args ...string) (int, string) {
+		t.Helper()
+		cmd := exec.Command(bin, args...)
+		cmd.Env = append(append(os.Environ(), "HOME="+home, "HOMEPODCTL_CONFIG=", "HOMEPODCTL_PROFILE="), env...)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return 0, string(out)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), string(out)
+		}
+		t.Fatalf("run %v: %v", args, err)
+		return 1, ""
+	}
+
+	code, out := run(nil, "--config", cfgPath, "config", "get", "defaults.backend")
+	if code != 0 || strings.TrimSpace(out) != "native" {
+		t.Fatalf("--config get exit=%d out=%q", code, out)
+	}
+	code, out = run([]string{"HOMEPODCTL_CONFIG=" + cfgPath}, "config", "validate", "--json")
+	if code != 0 || !strings.Contains(out, cfgPath) {
+		t.Fatalf("HOMEPODCTL_CONFIG validate exit=%d out=%s", code, out)
+	}
+	code, out = run([]string{"HOMEPODCTL_CONFIG=" + cfgPath}, "--profile", "missing", "config", "get", "defaults.rooms")
+	if code != 0 || !strings.Contains(out, "Kitchen") {
+		t.Fatalf("--config should take precedence over --profile: exit=%d out=%q", code, out)
+	}
+}
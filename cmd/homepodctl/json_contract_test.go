@@ -8,7 +8,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/agisilaos/homepodctl/internal/airplay"
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
@@ -55,21 +57,41 @@ func TestGoldenDoctorReportJSON(t *testing.T) {
 	origConfigPath := configPath
 	origLoadConfig := loadConfigOptional
 	origGetNowPlaying := getNowPlaying
+	origListAirPlayDevices := listAirPlayDevices
+	origDiscoverNetworkDevices := discoverNetworkDevices
+	origAppRunning := musicAppRunning
+	origProbeAutomation := probeAutomation
+	origGUISession := guiSessionManager
 	t.Cleanup(func() {
 		lookPath = origLookPath
+		guiSessionManager = origGUISession
+		probeAutomation = origProbeAutomation
 		configPath = origConfigPath
 		loadConfigOptional = origLoadConfig
+		musicAppRunning = origAppRunning
 		getNowPlaying = origGetNowPlaying
+		listAirPlayDevices = origListAirPlayDevices
+		discoverNetworkDevices = origDiscoverNetworkDevices
 	})
 
 	lookPath = func(string) (string, error) { return "/usr/bin/fake", nil }
+	guiSessionManager = func(context.Context) (string, error) { return "Aqua", nil }
 	configPath = func() (string, error) { return "/tmp/homepodctl/config.json", nil }
 	loadConfigOptional = func() (*native.Config, error) {
 		return &native.Config{Aliases: map[string]native.Alias{"bed": {}}}, nil
 	}
+	musicAppRunning = func(context.Context) (bool, error) { return true, nil }
+	probeAutomation = func(context.Context) (music.AutomationPermission, error) { return music.AutomationGranted, nil }
+	t.Setenv("__CFBundleIdentifier", "com.apple.Terminal")
 	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
 		return music.NowPlaying{PlayerState: "playing"}, nil
 	}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Bedroom"}}, nil
+	}
+	discoverNetworkDevices = func(context.Context, time.Duration) ([]airplay.Device, error) {
+		return []airplay.Device{{Name: "Bedroom", Addr: "192.168.1.10", Port: 7000}}, nil
+	}
 
 	report := runDoctorChecks(context.Background())
 	report.CheckedAt = "<timestamp>"
@@ -102,7 +124,7 @@ func TestCLIExitCodeContracts(t *testing.T) {
 		{name: "config usage", args: []string{"config", "set", "defaults.backend", "invalid"}, want: exitUsage},
 		{name: "automation validation", args: []string{"automation", "validate", "-f", bad}, want: exitConfig},
 		{name: "schema unknown", args: []string{"schema", "not-real"}, want: exitUsage},
-		{name: "plan unsupported", args: []string{"plan", "pause"}, want: exitUsage},
+		{name: "plan unsupported", args: []string{"plan", "status"}, want: exitUsage},
 		{name: "native backend failure", args: []string{"native-run", "--shortcut", "__definitely_missing_shortcut__"}, want: exitBackend},
 	}
 	for _, tc := range cases {
@@ -111,6 +133,17 @@ func TestCLIExitCodeContracts(t *testing.T) {
 			if code != tc.want {
 				t.Fatalf("args=%v exit=%d want=%d out=%s", tc.args, code, tc.want, out)
 			}
+			// With --json the same failure must come back as an
+			// error-response carrying the same exit code.
+			args := append(append([]string{}, tc.args...), "--json")
+			code, out = runCLI(t, bin, home, args...)
+			var payload jsonErrorResponse
+			if err := json.Unmarshal([]byte(out), &payload); err != nil {
+				t.Fatalf("args=%v output is not an error-response: %v\n%s", args, err, out)
+			}
+			if code != tc.want || payload.OK || payload.Error.ExitCode != code || payload.Error.Code == "" {
+				t.Fatalf("args=%v exit=%d payload=%+v, want exit %d", args, code, payload, tc.want)
+			}
 		})
 	}
 }
@@ -7,38 +7,124 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/agisilaos/homepodctl/internal/airplay"
+	"github.com/agisilaos/homepodctl/internal/catalog"
+	"github.com/agisilaos/homepodctl/internal/homekit"
+	"github.com/agisilaos/homepodctl/internal/mediakeys"
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
+	"github.com/agisilaos/homepodctl/internal/spotify"
+	"github.com/agisilaos/homepodctl/internal/sysaudio"
 )
 
 var (
-	version              = "dev"
-	commit               = "none"
-	date                 = "unknown"
-	getNowPlaying        = music.GetNowPlaying
-	searchPlaylists      = music.SearchUserPlaylists
-	listAirPlayDevices   = music.ListAirPlayDevices
-	setCurrentOutputs    = music.SetCurrentAirPlayDevices
-	setDeviceVolume      = music.SetAirPlayDeviceVolume
-	setShuffle           = music.SetShuffleEnabled
-	playPlaylistByID     = music.PlayUserPlaylistByPersistentID
-	findPlaylistNameByID = music.FindUserPlaylistNameByPersistentID
-	runNativeShortcut    = native.RunShortcut
-	initConfig           = native.InitConfig
-	stopPlayback         = music.Stop
-	lookPath             = exec.LookPath
-	configPath           = native.ConfigPath
-	loadConfigOptional   = native.LoadConfigOptional
-	newStatusTicker      = func(d time.Duration) statusTicker { return realStatusTicker{ticker: time.NewTicker(d)} }
-	sleepFn              = time.Sleep
-	verbose              bool
-	quiet                bool
-	jsonErrorOut         bool
+	version                    = "dev"
+	commit                     = "none"
+	date                       = "unknown"
+	getNowPlaying              = music.GetNowPlaying
+	searchPlaylists            = music.SearchUserPlaylists
+	listPlaylists              = music.ListUserPlaylists
+	fillPlaylistModified       = music.FillPlaylistModified
+	searchLibrary              = music.SearchLibrary
+	listAirPlayDevices         = music.ListAirPlayDevices
+	setCurrentOutputs          = music.SetCurrentAirPlayDevices
+	selectOutputs              = music.SelectAirPlayDevices
+	setDeviceVolume            = music.SetAirPlayDeviceVolume
+	setShuffle                 = music.SetShuffleEnabled
+	setShuffleMode             = music.SetShuffleMode
+	setCrossfade               = music.SetCrossfade
+	listEQPresets              = music.ListEQPresets
+	setEQPreset                = music.SetEQPreset
+	runMusicBatch              = func(ctx context.Context, b *music.Batch) (music.BatchResult, error) { return b.Run(ctx) }
+	playPlaylistByID           = music.PlayUserPlaylistByPersistentID
+	findPlaylistNameByID       = music.FindUserPlaylistNameByPersistentID
+	findPlaylistIDByName       = music.FindUserPlaylistPersistentIDByName
+	createPlaylist             = music.CreateUserPlaylist
+	addTrackToPlaylist         = music.AddTrackToUserPlaylist
+	removeTrackFromPlaylist    = music.RemoveTrackFromUserPlaylist
+	clearPlaylist              = music.ClearUserPlaylist
+	runNativeShortcut          = native.RunShortcut
+	runNativeShortcutWithInput = native.RunShortcutWithInput
+	listShortcuts              = native.ListShortcuts
+	mostPlayedPlaylists        = music.MostPlayedUserPlaylists
+	initConfig                 = native.InitConfig
+	stopPlayback               = music.Stop
+	setSongRepeat              = music.SetSongRepeat
+	setPlayerPosition          = music.SetPlayerPosition
+	setTrackLoved              = music.SetCurrentTrackLoved
+	setTrackDisliked           = music.SetCurrentTrackDisliked
+	setTrackRating             = music.SetCurrentTrackRating
+	exportArtwork              = music.ExportCurrentArtwork
+	getLyrics                  = music.GetCurrentLyrics
+	playSpeech                 = music.PlaySpeech
+	removeSpeech               = music.RemoveSpeech
+	listStations               = music.ListStations
+	playStationByID            = music.PlayStation
+	playSpotifyURI             = spotify.PlayURI
+	setSpotifyVolume           = spotify.SetVolume
+	getSpotifyNowPlaying       = spotify.GetNowPlaying
+	resolveMediaRoute          = mediakeys.Resolve
+	sendMediaRoute             = mediakeys.Send
+	discoverNetworkDevices     = airplay.DiscoverReceivers
+	discoverHomeKit            = homekit.Discover
+	listSystemOutputs          = sysaudio.Outputs
+	currentSystemOutput        = sysaudio.Current
+	setSystemOutput            = sysaudio.SetOutput
+	catalogEndpoint            = catalog.DefaultEndpoint
+	postNotification           = native.Notify
+	lookPath                   = exec.LookPath
+	configPath                 = native.ConfigPath
+	historyPath                = defaultHistoryPath
+	trackLogPath               = defaultTrackLogPath
+	runHookCommand             = execHookCommand
+	runGUISessionCommand       = execGUISessionCommand
+	guiSessionManager          = launchctlManagerName
+	geteuid                    = os.Geteuid
+	automationRunsPath         = defaultAutomationRunsPath
+	automationRecordingPath    = defaultAutomationRecordingPath
+	undoStatePath              = defaultUndoStatePath
+	duckStatePath              = defaultDuckStatePath
+	audioRouteStatePath        = defaultAudioRouteStatePath
+	playlistCachePath          = defaultPlaylistCachePath
+	refreshPlaylistCache       = music.RefreshPlaylistCache
+	clearPlaylistCache         = music.ClearPlaylistCache
+	playlistCachedAt           = music.PlaylistCachedAt
+	deviceCachePath            = defaultDeviceCachePath
+	listDevicesCached          = music.ListAirPlayDevicesCached
+	refreshDeviceCache         = music.RefreshDeviceCache
+	clearDeviceCache           = music.ClearDeviceCache
+	daemonSocketPath           = defaultDaemonSocketPath
+	pingDaemon                 = music.PingDaemon
+	ensureMusicRunning         = music.EnsureRunning
+	musicAppRunning            = music.AppRunning
+	probeAutomation            = music.ProbeAutomation
+	musicLaunched              = music.Launched
+	pausePlayback              = music.Pause
+	loadConfigOptional         = native.LoadConfigOptional
+	newStatusTicker            = func(d time.Duration) statusTicker { return realStatusTicker{ticker: time.NewTicker(d)} }
+	sleepFn                    = time.Sleep
+	sleepCtx                   = sleepContext
+	timeNow                    = time.Now
+	verbose                    bool
+	quiet                      bool
+	assumeYes                  bool
+	dryRunAll                  bool
+	jsonErrorOut               bool
 )
 
+var transportActions = map[string]func(context.Context) error{
+	"play":      music.Play,
+	"pause":     music.Pause,
+	"playpause": music.PlayPause,
+	"stop":      music.Stop,
+	"next":      music.NextTrack,
+	"prev":      music.PreviousTrack,
+}
+
 type statusTicker interface {
 	Chan() <-chan time.Time
 	Stop()
@@ -56,18 +142,64 @@ func (t realStatusTicker) Stop() {
 	t.ticker.Stop()
 }
 
+// defaultCommandTimeout bounds a whole command unless --timeout overrides it.
+const defaultCommandTimeout = 30 * time.Second
+
+// longCommandTimeout replaces defaultCommandTimeout for commands whose steps
+// may wait on purpose: automation and scene runs, and alias sequences.
+const longCommandTimeout = 15 * time.Minute
+
 const (
 	exitGeneric = 1
 	exitUsage   = 2
 	exitConfig  = 3
 	exitBackend = 4
+	// exitNoGUI is a backend failure in a process without a GUI session
+	// (e.g. over ssh), where Music.app and Shortcuts may not answer.
+	exitNoGUI = 5
 )
 
 type globalOptions struct {
-	help    bool
-	version bool
-	verbose bool
-	quiet   bool
+	help      bool
+	version   bool
+	verbose   bool
+	quiet     bool
+	yes       bool
+	dryRun    bool
+	noCache   bool
+	noLaunch  bool
+	profile   string
+	config    string
+	timeout   string
+	retries   string
+	logLevel  string
+	logFormat string
+	host      string
+	// output is a command's --output file, hoisted like --timeout.
+	output string
+}
+
+func (o *globalOptions) setValue(flag, v string) {
+	switch flag {
+	case "--config":
+		o.config = v
+	case "--timeout":
+		o.timeout = v
+	case "--retries":
+		o.retries = v
+	case "--log-level":
+		o.logLevel = v
+	case "--log-format":
+		o.logFormat = v
+	case "--host":
+		o.host = v
+	default:
+		o.profile = v
+	}
+}
+
+func isGlobalValueFlag(name string) bool {
+	return globalValueFlags[name]
 }
 
 func parseGlobalOptions(args []string) (globalOptions, string, []string, error) {
@@ -89,7 +221,25 @@ func parseGlobalOptions(args []string) (globalOptions, string, []string, error)
 			opts.verbose = true
 		case "-q", "--quiet":
 			opts.quiet = true
+		case "-y", "--yes":
+			opts.yes = true
+		case "--dry-run":
+			opts.dryRun = true
+		case "--no-cache":
+			opts.noCache = true
+		case "--no-launch":
+			opts.noLaunch = true
+		case "--profile", "--config", "--timeout", "--retries", "--log-level", "--log-format", "--host":
+			if i+1 >= len(args) {
+				return globalOptions{}, "", nil, usageErrf("%s requires a value", a)
+			}
+			i++
+			opts.setValue(a, args[i])
 		default:
+			if name, v, ok := strings.Cut(a, "="); ok && isGlobalValueFlag(name) {
+				opts.setValue(name, v)
+				continue
+			}
 			return globalOptions{}, "", nil, usageErrf("unknown global flag: %s (tip: run `homepodctl --help`)", a)
 		}
 	}
@@ -105,10 +255,29 @@ func main() {
 		}
 		switch v := r.(type) {
 		case cliFatal:
+			abortOutputFile()
+			v.err = explainHeadless(v.err)
+			finishHistory(classifyExitCode(v.err), v.err)
 			emitAndExit(v.err)
 		case cliExit:
+			if v.code != 0 {
+				abortOutputFile()
+			} else if err := commitOutputFile(); err != nil {
+				finishHistory(exitGeneric, err)
+				emitAndExit(err)
+			}
+			finishHistory(v.code, nil)
 			os.Exit(v.code)
 		default:
+			abortOutputFile()
+			if jsonErrorOut {
+				// Keep the error-response contract even for bugs; the
+				// stack is logged at debug level (--verbose).
+				logger.Debug("panic", "value", fmt.Sprint(r), "stack", string(debug.Stack()))
+				err := fmt.Errorf("internal error: %v", r)
+				finishHistory(exitGeneric, err)
+				emitAndExit(err)
+			}
 			panic(r)
 		}
 	}()
@@ -123,15 +292,38 @@ func main() {
 		}
 		die(err)
 	}
+	command, known := lookupCliCommand(cmd)
+	if known && !command.Raw {
+		args = hoistGlobalFlags(&opts, cmd, args)
+	}
 	verbose = opts.verbose || envTruthy(os.Getenv("HOMEPODCTL_VERBOSE"))
 	quiet = opts.quiet
-	debugf("command=%q args=%q", cmd, args)
+	assumeYes = opts.yes
+	dryRunAll = opts.dryRun
+	if err := setupLogging(resolveLogOptions(opts)); err != nil {
+		die(err)
+	}
+	started := time.Now()
+	logger.Info("command", "name", cmd, "args", args)
+	pinned, err := selectConfigFile(opts.config)
+	if err != nil {
+		die(err)
+	}
+	if !pinned {
+		if err := selectProfile(opts.profile, cmd, args); err != nil {
+			die(err)
+		}
+	}
 
 	if opts.version {
 		fmt.Printf("homepodctl %s (%s) %s\n", version, commit, date)
 		return
 	}
 
+	if opts.help && known && !command.Hidden {
+		cmdHelp([]string{cmd})
+		return
+	}
 	if opts.help || cmd == "" {
 		usage()
 		if cmd == "" && !opts.help {
@@ -140,78 +332,158 @@ func main() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if !known {
+		if !jsonErrorOut {
+			usage()
+		}
+		die(usageErrf("unknown command: %q (run `homepodctl --help`)", cmd))
+	}
+	if !command.Raw {
+		if wantsCommandHelp(args) {
+			cmdHelp([]string{cmd})
+			return
+		}
+		if err := checkCommandFlags(cmd, args); err != nil {
+			die(err)
+		}
+	}
+	if opts.output != "" {
+		if err := checkOutputFileSupported(cmd, args); err != nil {
+			die(err)
+		}
+		args = withJSONFlag(args)
+	}
+
+	if dryRunAll {
+		if err := checkDryRunSupported(cmd, args); err != nil {
+			die(err)
+		}
+	}
+
+	timeout, err := commandTimeout(command, opts.timeout)
+	if err != nil {
+		die(err)
+	}
+	retries := -1
+	if raw := strings.TrimSpace(opts.retries); raw != "" {
+		n, err := parseRetries(raw)
+		if err != nil {
+			die(usageErrf("invalid --retries: %v", err))
+		}
+		retries = n
+	}
+	// Config errors are left to the commands that need the config; the
+	// global setup below then runs with the defaults.
+	cfg, err := loadConfigOptional()
+	if err != nil {
+		debugf("config: %v", err)
+		cfg = nil
+	}
+	applyConfigTimeouts(cfg)
+	applyRetryPolicy(cfg, retries)
+	applyEngine(cfg)
+	if err := applyTransport(cfg, cmd, opts.host); err != nil {
+		die(err)
+	}
+	// cache refresh/clear always need the cache location, even with --no-cache.
+	noCache := opts.noCache || envTruthy(os.Getenv("HOMEPODCTL_NO_CACHE"))
+	configureCaches(!noCache || cmd == "cache")
+	configureDaemonClient(cmd)
+	beginHistory(cmd, args)
+	trackLogEnabled = true
+	beginHooks(cfg, cmd, args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	ensureMusicApp(ctx, cmd, args, launchMode(cfg, opts.noLaunch))
+	captureUndoSnapshot(cmd, args)
 
-	var cfg *native.Config
-	loadCfg := func() *native.Config {
-		if cfg != nil {
-			return cfg
+	if quiet && !command.OwnsStdout && !wantsJSONErrors(args) {
+		// --quiet drops the human-readable output a command prints to
+		// stdout; --json output, errors and prompts stay visible.
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			os.Stdout = devNull
 		}
-		loadedCfg, cfgErr := native.LoadConfigOptional()
-		if cfgErr != nil {
-			die(cfgErr)
+	}
+	if opts.output != "" {
+		if err := beginOutputFile(opts.output); err != nil {
+			die(err)
 		}
-		cfg = loadedCfg
-		debugf("config: default_backend=%q default_rooms=%v aliases=%d", cfg.Defaults.Backend, cfg.Defaults.Rooms, len(cfg.Aliases))
-		return cfg
 	}
+	runPreHook()
+	command.Run(&commandEnv{ctx: ctx, name: cmd}, args)
+	if err := commitOutputFile(); err != nil {
+		die(err)
+	}
+	runPostHook(nil)
+	commitUndoSnapshot()
+	finishHistory(0, nil)
+	logger.Info("done", "name", cmd, "duration_ms", time.Since(started).Milliseconds())
+}
 
-	switch cmd {
-	case "help":
-		cmdHelp(args)
-	case "version":
-		fmt.Printf("homepodctl %s (%s) %s\n", version, commit, date)
-	case "automation":
-		cmdAutomation(ctx, loadCfg(), args)
-	case "config":
-		cmdConfig(args)
-	case "completion":
-		cmdCompletion(args)
-	case "doctor":
-		cmdDoctor(ctx, args)
-	case "plan":
-		cmdPlan(args)
-	case "schema":
-		cmdSchema(args)
-	case "devices":
-		cmdDevices(ctx, args)
-	case "playlists":
-		cmdPlaylists(ctx, args)
-	case "status":
-		cmdStatus(ctx, args)
-	case "now":
-		cmdStatus(ctx, args)
-	case "out":
-		cmdOut(ctx, loadCfg(), args)
-	case "aliases":
-		cmdAliases(loadCfg(), args)
-	case "run":
-		cmdRun(ctx, loadCfg(), args)
-	case "pause":
-		cmdTransport(ctx, args, "pause", music.Pause)
-	case "stop":
-		cmdTransport(ctx, args, "stop", music.Stop)
-	case "next":
-		cmdTransport(ctx, args, "next", music.NextTrack)
-	case "prev":
-		cmdTransport(ctx, args, "prev", music.PreviousTrack)
-	case "play":
-		cmdPlay(ctx, loadCfg(), args)
-	case "volume":
-		cmdVolume(ctx, loadCfg(), "volume", args)
-	case "vol":
-		cmdVolume(ctx, loadCfg(), "vol", args)
-	case "native-run":
-		cmdNativeRun(ctx, args)
-	case "config-init":
-		cmdConfigInit()
-	case "setup":
-		cmdSetup(ctx, args)
+// applyEngine selects the Music.app engine for reads: HOMEPODCTL_ENGINE,
+// then defaults.engine, then JXA.
+func applyEngine(cfg *native.Config) {
+	name := selectedEngineName(cfg)
+	switch name {
+	case "applescript":
+		music.SetEngine(music.AppleScriptEngine())
 	default:
-		if !jsonErrorOut {
-			usage()
+		music.SetEngine(music.JXAEngine())
+	}
+	debugf("engine=%s", name)
+}
+
+// selectedEngineName is the engine applyEngine picks; cfg may be nil.
+func selectedEngineName(cfg *native.Config) string {
+	name := strings.TrimSpace(os.Getenv("HOMEPODCTL_ENGINE"))
+	if name == "" && cfg != nil {
+		name = cfg.Defaults.Engine
+	}
+	if name != "applescript" {
+		name = "jxa"
+	}
+	return name
+}
+
+// applyRetryPolicy sets how transient Music.app failures are retried:
+// defaults.retries from config, then --retries (flagRetries >= 0) for the
+// count. cfg may be nil.
+func applyRetryPolicy(cfg *native.Config, flagRetries int) {
+	p := music.DefaultRetryPolicy()
+	if cfg != nil && cfg.Defaults.Retries != nil {
+		if n := cfg.Defaults.Retries.Count; n != nil {
+			p.Retries = *n
+		}
+		if v := cfg.Defaults.Retries.Backoff; v != "" {
+			if d, err := parseConfigTimeout(v); err == nil {
+				p.Backoff = d
+			}
+		}
+	}
+	if flagRetries >= 0 {
+		p.Retries = flagRetries
+	}
+	music.SetRetryPolicy(p)
+	debugf("retries=%d backoff=%s", p.Retries, p.Backoff)
+}
+
+// applyConfigTimeouts threads defaults.timeouts into the AppleScript and
+// Shortcuts runners. cfg may be nil.
+func applyConfigTimeouts(cfg *native.Config) {
+	if cfg == nil || cfg.Defaults.Timeouts == nil {
+		return
+	}
+	if v := cfg.Defaults.Timeouts.AppleScript; v != "" {
+		if d, err := parseConfigTimeout(v); err == nil {
+			music.SetScriptTimeout(d)
+			debugf("config: applescript timeout=%s", d)
+		}
+	}
+	if v := cfg.Defaults.Timeouts.Shortcuts; v != "" {
+		if d, err := parseConfigTimeout(v); err == nil {
+			native.SetShortcutTimeout(d)
+			debugf("config: shortcuts timeout=%s", d)
 		}
-		die(usageErrf("unknown command: %q (run `homepodctl --help`)", cmd))
 	}
 }
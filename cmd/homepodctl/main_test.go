@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
@@ -70,6 +72,18 @@ func TestParseArgs_ShortFileFlag(t *testing.T) {
 	}
 }
 
+func TestParseArgs_NegativeNumberIsPositional(t *testing.T) {
+	t.Parallel()
+
+	_, pos, err := parseArgs([]string{"-10", "Kitchen", "--dry-run"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if len(pos) != 2 || pos[0] != "-10" || pos[1] != "Kitchen" {
+		t.Fatalf("pos=%v, want [-10 Kitchen]", pos)
+	}
+}
+
 func TestParseArgs_UnknownFlag(t *testing.T) {
 	t.Parallel()
 
@@ -100,6 +114,157 @@ func TestParseGlobalOptions(t *testing.T) {
 	}
 }
 
+func TestParseGlobalOptions_Profile(t *testing.T) {
+	t.Parallel()
+
+	for _, argv := range [][]string{{"--profile", "office", "status"}, {"--profile=office", "status"}} {
+		opts, cmd, _, err := parseGlobalOptions(argv)
+		if err != nil {
+			t.Fatalf("parseGlobalOptions(%v): %v", argv, err)
+		}
+		if opts.profile != "office" || cmd != "status" {
+			t.Fatalf("parseGlobalOptions(%v): profile=%q cmd=%q", argv, opts.profile, cmd)
+		}
+	}
+	if _, _, _, err := parseGlobalOptions([]string{"--profile"}); err == nil {
+		t.Fatalf("expected error for --profile without a value")
+	}
+}
+
+func TestResolveRemote(t *testing.T) {
+	cfg := &native.Config{Remotes: map[string]native.Remote{"mini": {Host: "me@mac-mini", Port: 2222}}}
+
+	ssh, err := resolveRemote(cfg, "mini")
+	if err != nil || ssh.Host != "me@mac-mini" || ssh.Port != 2222 {
+		t.Fatalf("resolveRemote(mini)=%+v err=%v", ssh, err)
+	}
+	ssh, err = resolveRemote(cfg, "me@studio.local")
+	if err != nil || ssh.Host != "me@studio.local" || ssh.Port != 0 {
+		t.Fatalf("resolveRemote(me@studio.local)=%+v err=%v", ssh, err)
+	}
+	// Without a loaded config (missing or invalid) the name is the destination.
+	if ssh, err := resolveRemote(nil, "mini"); err != nil || ssh.Host != "mini" {
+		t.Fatalf("resolveRemote(nil, mini)=%+v err=%v", ssh, err)
+	}
+	if _, err := resolveRemote(cfg, "-oProxyCommand=x"); classifyExitCode(err) != exitUsage {
+		t.Fatalf("expected usage error for invalid host, got %v", err)
+	}
+	if err := applyTransport(cfg, "artwork", "mini"); err == nil || !strings.Contains(err.Error(), "does not support --host") {
+		t.Fatalf("expected artwork to reject --host, got %v", err)
+	}
+
+	opts, cmd, _, err := parseGlobalOptions([]string{"--host=mini", "status"})
+	if err != nil || opts.host != "mini" || cmd != "status" {
+		t.Fatalf("parseGlobalOptions: host=%q cmd=%q err=%v", opts.host, cmd, err)
+	}
+}
+
+func TestCachePathsKeyedByHost(t *testing.T) {
+	origHost := remoteHost
+	t.Cleanup(func() { remoteHost = origHost })
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+
+	remoteHost = ""
+	local, err := defaultPlaylistCachePath()
+	if err != nil || local != filepath.Join(dir, "homepodctl", "playlists.json") {
+		t.Fatalf("local playlists=%q err=%v", local, err)
+	}
+	remoteHost = "me@mac-mini"
+	playlists, err := defaultPlaylistCachePath()
+	if err != nil || playlists != filepath.Join(dir, "homepodctl", "hosts", "me@mac-mini", "playlists.json") {
+		t.Fatalf("remote playlists=%q err=%v", playlists, err)
+	}
+	devices, err := defaultDeviceCachePath()
+	if err != nil || devices != filepath.Join(dir, "homepodctl", "hosts", "me@mac-mini", "devices.json") {
+		t.Fatalf("remote devices=%q err=%v", devices, err)
+	}
+	remoteHost = "me@[::1]/x"
+	if dir, _ := hostCacheDir(); filepath.Base(dir) != "me@___1__x" {
+		t.Fatalf("sanitized dir=%q", dir)
+	}
+}
+
+func TestParseGlobalOptions_DryRun(t *testing.T) {
+	t.Parallel()
+
+	opts, cmd, args, err := parseGlobalOptions([]string{"--dry-run", "next", "--json"})
+	if err != nil {
+		t.Fatalf("parseGlobalOptions: %v", err)
+	}
+	if !opts.dryRun || cmd != "next" || len(args) != 1 {
+		t.Fatalf("dryRun=%t cmd=%q args=%v", opts.dryRun, cmd, args)
+	}
+}
+
+func TestParseGlobalOptions_NoCache(t *testing.T) {
+	t.Parallel()
+
+	opts, cmd, _, err := parseGlobalOptions([]string{"--no-cache", "play", "chill"})
+	if err != nil {
+		t.Fatalf("parseGlobalOptions: %v", err)
+	}
+	if !opts.noCache || cmd != "play" {
+		t.Fatalf("noCache=%t cmd=%q", opts.noCache, cmd)
+	}
+}
+
+func TestParseGlobalOptions_Retries(t *testing.T) {
+	t.Parallel()
+
+	for _, argv := range [][]string{{"--retries", "4", "play"}, {"--retries=4", "play"}} {
+		opts, cmd, _, err := parseGlobalOptions(argv)
+		if err != nil || opts.retries != "4" || cmd != "play" {
+			t.Fatalf("parseGlobalOptions(%v): retries=%q cmd=%q err=%v", argv, opts.retries, cmd, err)
+		}
+	}
+	for _, bad := range []string{"-1", "11", "many"} {
+		if _, err := parseRetries(bad); err == nil {
+			t.Fatalf("parseRetries(%q): expected error", bad)
+		}
+	}
+}
+
+func TestParseGlobalOptions_Timeout(t *testing.T) {
+	t.Parallel()
+
+	for _, argv := range [][]string{{"--timeout", "10s", "playlists"}, {"--timeout=10s", "playlists"}} {
+		opts, cmd, _, err := parseGlobalOptions(argv)
+		if err != nil {
+			t.Fatalf("parseGlobalOptions(%v): %v", argv, err)
+		}
+		if opts.timeout != "10s" || cmd != "playlists" {
+			t.Fatalf("parseGlobalOptions(%v): timeout=%q cmd=%q", argv, opts.timeout, cmd)
+		}
+	}
+}
+
+func TestSetupLoggingWritesJSONToFile(t *testing.T) {
+	origLogger := logger
+	t.Cleanup(func() {
+		logger = origLogger
+		music.SetLogger(nil)
+		native.SetLogger(nil)
+	})
+
+	path := filepath.Join(t.TempDir(), "homepodctl.log")
+	if err := setupLogging(logOptions{level: "debug", format: "json", file: path}); err != nil {
+		t.Fatalf("setupLogging: %v", err)
+	}
+	debugf("rooms=%d", 2)
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), `"level":"DEBUG","msg":"rooms=2"`) {
+		t.Fatalf("log file err=%v body=%s", err, b)
+	}
+
+	if err := setupLogging(logOptions{level: "loud", format: "text"}); err == nil {
+		t.Fatalf("expected error for invalid level")
+	}
+	if err := setupLogging(logOptions{level: "info", format: "xml"}); err == nil {
+		t.Fatalf("expected error for invalid format")
+	}
+}
+
 func TestParseGlobalOptions_Version(t *testing.T) {
 	t.Parallel()
 
@@ -136,6 +301,18 @@ func TestParseGlobalOptions_Quiet(t *testing.T) {
 	}
 }
 
+func TestParseGlobalOptions_Yes(t *testing.T) {
+	t.Parallel()
+
+	opts, cmd, _, err := parseGlobalOptions([]string{"-y", "config", "wizard"})
+	if err != nil {
+		t.Fatalf("parseGlobalOptions: %v", err)
+	}
+	if !opts.yes || cmd != "config" {
+		t.Fatalf("opts=%+v cmd=%q, want yes and config", opts, cmd)
+	}
+}
+
 func TestParseGlobalOptions_UnknownFlag(t *testing.T) {
 	t.Parallel()
 
@@ -312,11 +489,8 @@ func TestCompletionScript(t *testing.T) {
 		if !strings.Contains(s, "homepodctl") {
 			t.Fatalf("completionScript(%q) missing command name", shell)
 		}
-		if !strings.Contains(s, "dry-run") {
-			t.Fatalf("completionScript(%q) missing dry-run flag", shell)
-		}
-		if !strings.Contains(s, "automation") {
-			t.Fatalf("completionScript(%q) missing automation command", shell)
+		if !strings.Contains(s, "homepodctl __complete") {
+			t.Fatalf("completionScript(%q) does not call __complete", shell)
 		}
 	}
 	if _, err := completionScript("pwsh"); err == nil {
@@ -336,8 +510,8 @@ func TestCompletionData(t *testing.T) {
 			"lr":  {Rooms: []string{"Living Room"}},
 		},
 		Native: native.NativeConfig{
-			Playlists: map[string]map[string]string{
-				"Kitchen": {"Focus": "Y"},
+			Playlists: map[string]map[string]native.PlaylistShortcut{
+				"Kitchen": {"Focus": {Shortcut: "Y"}},
 			},
 		},
 	}
@@ -353,6 +527,128 @@ func TestCompletionData(t *testing.T) {
 	}
 }
 
+func TestCmdCompletePlaylists(t *testing.T) {
+	origLoad := loadConfigOptional
+	origCached := cachedPlaylists
+	origRunning := musicAppRunning
+	t.Cleanup(func() {
+		loadConfigOptional = origLoad
+		cachedPlaylists = origCached
+		musicAppRunning = origRunning
+	})
+	loadConfigOptional = func() (*native.Config, error) {
+		return &native.Config{Aliases: map[string]native.Alias{"am": {Playlist: "Morning Chill"}}}, nil
+	}
+	cachedPlaylists = func() ([]music.UserPlaylist, bool) {
+		return []music.UserPlaylist{{Name: "chillhop"}, {Name: "Focus"}, {Name: "Morning Chill"}}, true
+	}
+	musicAppRunning = func(context.Context) (bool, error) {
+		t.Fatal("Music.app was queried although the cache exists")
+		return false, nil
+	}
+
+	out := captureStdout(t, func() { cmdComplete(context.Background(), []string{"play", "CHI"}) })
+	if out != "chillhop\n:0\n" {
+		t.Fatalf("prefix CHI: %q", out)
+	}
+	out = captureStdout(t, func() { cmdComplete(context.Background(), []string{"--verbose", "play", "--playlist", ""}) })
+	if out != "chillhop\nFocus\nMorning Chill\n:0\n" {
+		t.Fatalf("all: %q", out)
+	}
+	out = captureStdout(t, func() { cmdComplete(context.Background(), []string{"play", "--playlist=Mo"}) })
+	if out != "--playlist=Morning Chill\n:0\n" {
+		t.Fatalf("--playlist=: %q", out)
+	}
+}
+
+func TestCompleteRoomsUsesFreshDeviceCache(t *testing.T) {
+	origLoad, origCached, origRunning, origDevices := loadConfigOptional, cachedDevices, musicAppRunning, listAirPlayDevices
+	t.Cleanup(func() {
+		loadConfigOptional, cachedDevices, musicAppRunning, listAirPlayDevices = origLoad, origCached, origRunning, origDevices
+	})
+	loadConfigOptional = func() (*native.Config, error) { return &native.Config{}, nil }
+	cachedAt := time.Now()
+	cachedDevices = func() ([]music.AirPlayDevice, time.Time, bool) {
+		return []music.AirPlayDevice{{Name: "Kitchen"}}, cachedAt, true
+	}
+	queried := 0
+	musicAppRunning = func(context.Context) (bool, error) { return true, nil }
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		queried++
+		return []music.AirPlayDevice{{Name: "Kitchen"}, {Name: "Office"}}, nil
+	}
+
+	if got := completeRooms(context.Background()); strings.Join(got, ",") != "Kitchen" || queried != 0 {
+		t.Fatalf("fresh cache: got=%v queried=%d", got, queried)
+	}
+	cachedAt = time.Now().Add(-time.Hour)
+	if got := completeRooms(context.Background()); strings.Join(got, ",") != "Kitchen,Office" || queried != 1 {
+		t.Fatalf("stale cache: got=%v queried=%d", got, queried)
+	}
+	musicAppRunning = func(context.Context) (bool, error) { return false, nil }
+	if got := completeRooms(context.Background()); strings.Join(got, ",") != "Kitchen" || queried != 1 {
+		t.Fatalf("Music.app not running: got=%v queried=%d", got, queried)
+	}
+}
+
+func TestCompleteWords(t *testing.T) {
+	origLoad := loadConfigOptional
+	origRunning := musicAppRunning
+	origDevices := listAirPlayDevices
+	t.Cleanup(func() {
+		loadConfigOptional = origLoad
+		musicAppRunning = origRunning
+		listAirPlayDevices = origDevices
+	})
+	loadConfigOptional = func() (*native.Config, error) {
+		return &native.Config{
+			Defaults: native.DefaultsConfig{Rooms: []string{"Bedroom"}},
+			Aliases:  map[string]native.Alias{"focus": {}, "party": {}},
+		}, nil
+	}
+	musicAppRunning = func(context.Context) (bool, error) { return true, nil }
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Living Room"}, {Name: "Bedroom"}}, nil
+	}
+
+	values := func(words []string, cur string) (string, int) {
+		cands, directive := completeWords(context.Background(), words, cur)
+		var vs []string
+		for _, c := range cands {
+			vs = append(vs, c.Value)
+		}
+		return strings.Join(vs, ","), directive
+	}
+	cases := []struct {
+		words     []string
+		cur       string
+		want      string
+		directive int
+	}{
+		{nil, "mu", "mute", 0},
+		{[]string{"--profile", "work"}, "unm", "unmute", 0},
+		{[]string{"run"}, "", "focus,party", 0},
+		{[]string{"out"}, "s", "set", 0},
+		{[]string{"out", "set", "Bedroom"}, "li", "Living Room", 0},
+		{[]string{"move", "Bedroom", "Living Room"}, "", "", 0},
+		{[]string{"volume", "30"}, `Living\ R`, "Living Room", 0},
+		{[]string{"play", "--room"}, "", "Bedroom,Living Room", 0},
+		{[]string{"play", "--room", "="}, "Be", "Bedroom", 0},
+		{[]string{"status"}, "--json-s", "--json-stream", 0},
+		{[]string{"search", "--type"}, "a", "album,artist", 0},
+		{[]string{"automation", "run", "-f"}, "", "", completeDirectiveFiles},
+		{[]string{"schema", "--write-dir"}, "", "", completeDirectiveDirs},
+		{[]string{"alias", "rename"}, "f", "focus", 0},
+		{[]string{"completion", "install"}, "z", "zsh", 0},
+	}
+	for _, tc := range cases {
+		got, directive := values(append([]string{}, tc.words...), tc.cur)
+		if got != tc.want || directive != tc.directive {
+			t.Errorf("complete %v %q = %q :%d, want %q :%d", tc.words, tc.cur, got, directive, tc.want, tc.directive)
+		}
+	}
+}
+
 func TestCompletionInstallPath(t *testing.T) {
 	home := t.TempDir()
 	t.Setenv("HOME", home)
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/agisilaos/homepodctl/internal/airplay"
 	"github.com/agisilaos/homepodctl/internal/music"
 	"github.com/agisilaos/homepodctl/internal/native"
 )
@@ -81,7 +85,7 @@ func TestSetVolumeForRooms(t *testing.T) {
 		return nil
 	}
 
-	err := setVolumeForRooms(context.Background(), []string{"Bedroom", "Kitchen"}, 35)
+	err := setVolumeForRooms(context.Background(), nil, []string{"Bedroom", "Kitchen"}, 35, false)
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -90,10 +94,148 @@ func TestSetVolumeForRooms(t *testing.T) {
 	}
 }
 
+func TestSetVolumeForRoomsAppliesOffsets(t *testing.T) {
+	orig := setDeviceVolume
+	t.Cleanup(func() { setDeviceVolume = orig })
+
+	var got []string
+	setDeviceVolume = func(_ context.Context, room string, value int) error {
+		got = append(got, room+":"+strconv.Itoa(value))
+		return nil
+	}
+
+	cfg := &native.Config{VolumeOffsets: map[string]int{"Kitchen": -10, "Bedroom": 15}}
+	if err := setVolumeForRooms(context.Background(), cfg, []string{"kitchen", "Bedroom", "Office"}, 90, false); err != nil {
+		t.Fatalf("setVolumeForRooms: %v", err)
+	}
+	if strings.Join(got, ",") != "kitchen:80,Bedroom:100,Office:90" {
+		t.Fatalf("calls=%v", got)
+	}
+}
+
+func TestSetVolumeForRoomsHoldsMaxVolume(t *testing.T) {
+	orig := setDeviceVolume
+	t.Cleanup(func() { setDeviceVolume = orig })
+
+	var got []string
+	setDeviceVolume = func(_ context.Context, room string, value int) error {
+		got = append(got, room+":"+strconv.Itoa(value))
+		return nil
+	}
+
+	limit := 50
+	cfg := &native.Config{Defaults: native.DefaultsConfig{MaxVolume: &limit}, MaxVolumes: map[string]int{"Kitchen": 70}}
+	if err := setVolumeForRooms(context.Background(), cfg, []string{"kitchen", "Bedroom"}, 90, false); err != nil {
+		t.Fatalf("setVolumeForRooms: %v", err)
+	}
+	if err := setVolumeForRooms(context.Background(), cfg, []string{"Bedroom"}, 90, true); err != nil {
+		t.Fatalf("setVolumeForRooms force: %v", err)
+	}
+	if strings.Join(got, ",") != "kitchen:70,Bedroom:50,Bedroom:90" {
+		t.Fatalf("calls=%v", got)
+	}
+}
+
+func TestGuardVolumeTargets(t *testing.T) {
+	t.Parallel()
+
+	cfg := &native.Config{MaxVolumes: map[string]int{"Bedroom": 40}}
+	targets := []volumeTarget{{Room: "bedroom", Value: 90}, {Room: "Kitchen", Value: 90}}
+	ask := func(answer string) *prompter {
+		return &prompter{in: bufio.NewReader(strings.NewReader(answer)), out: io.Discard}
+	}
+
+	got, err := guardVolumeTargets(cfg, targets, false, nil)
+	if err != nil || got[0].Value != 40 || got[1].Value != 90 {
+		t.Fatalf("no prompt: got=%v err=%v, want bedroom held at 40", got, err)
+	}
+	if got, err := guardVolumeTargets(cfg, targets, false, ask("y\n")); err != nil || got[0].Value != 90 {
+		t.Fatalf("confirmed: got=%v err=%v", got, err)
+	}
+	if _, err := guardVolumeTargets(cfg, targets, false, ask("\n")); err == nil || !strings.Contains(err.Error(), "volume unchanged") {
+		t.Fatalf("declined: err=%v", err)
+	}
+	if got, err := guardVolumeTargets(cfg, targets, true, nil); err != nil || got[0].Value != 90 {
+		t.Fatalf("force: got=%v err=%v", got, err)
+	}
+	if got, err := guardVolumeTargets(cfg, []volumeTarget{{Room: "Bedroom", Value: 40}}, false, ask("")); err != nil || got[0].Value != 40 {
+		t.Fatalf("at the cap: got=%v err=%v", got, err)
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	orig := timeNow
+	t.Cleanup(func() { timeNow = orig })
+	timeNow = func() time.Time { return time.Date(2026, 3, 1, 23, 30, 0, 0, time.Local) }
+
+	limit, night := 80, 20
+	cfg := &native.Config{
+		Defaults: native.DefaultsConfig{MaxVolume: &limit},
+		QuietHours: map[string]native.QuietHours{
+			"night": {Start: "22:00", End: "07:00", Rooms: []string{"Bedroom"}, MaxVolume: &night, Play: "block"},
+			"lunch": {Start: "12:00", End: "13:00"},
+		},
+	}
+	got, err := guardVolumeTargets(cfg, []volumeTarget{{Room: "bedroom", Value: 50}, {Room: "Kitchen", Value: 50}}, false, nil)
+	if err != nil || got[0].Value != 20 || got[1].Value != 50 {
+		t.Fatalf("guard: got=%v err=%v, want bedroom held at 20", got, err)
+	}
+	ask := &prompter{in: bufio.NewReader(strings.NewReader("\n")), out: io.Discard}
+	if _, err := guardVolumeTargets(cfg, []volumeTarget{{Room: "Bedroom", Value: 50}}, false, ask); err == nil || !strings.Contains(err.Error(), "maxVolume 20 (quiet hours night)") {
+		t.Fatalf("declined: err=%v", err)
+	}
+
+	if _, err := checkQuietPlay(cfg, []string{"Kitchen", "Bedroom"}, false); err == nil || !strings.Contains(err.Error(), "quiet hours night (22:00-07:00) block play in Bedroom") {
+		t.Fatalf("block: err=%v", err)
+	}
+	notices, err := checkQuietPlay(cfg, []string{"Kitchen", "Bedroom"}, true)
+	if err != nil || len(notices) != 1 || notices[0].Name != "night" || strings.Join(notices[0].Rooms, ",") != "Bedroom" {
+		t.Fatalf("force: notices=%+v err=%v", notices, err)
+	}
+	if notices, err := checkQuietPlay(cfg, []string{"Kitchen"}, false); err != nil || len(notices) != 0 {
+		t.Fatalf("outside quiet hours: notices=%+v err=%v", notices, err)
+	}
+
+	step := resolveAutomationStep(cfg, "bedtime", automationDefaults{Backend: "airplay", Rooms: []string{"Bedroom"}}, 0, automationStep{Type: "volume.set", Value: &limit})
+	resolved, _ := step.Resolved.(map[string]any)
+	if q, ok := resolved["quietHours"].([]quietHoursNotice); !ok || len(q) != 1 || q[0].Window != "22:00-07:00" {
+		t.Fatalf("plan resolved=%v", step.Resolved)
+	}
+}
+
+func TestLowerQuietVolumes(t *testing.T) {
+	origNow, origList, origSet := timeNow, listAirPlayDevices, setDeviceVolume
+	t.Cleanup(func() { timeNow, listAirPlayDevices, setDeviceVolume = origNow, origList, origSet })
+	timeNow = func() time.Time { return time.Date(2026, 3, 1, 23, 30, 0, 0, time.Local) }
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Bedroom", Volume: 60}, {Name: "Kitchen", Volume: 70}, {Name: "Den", Volume: 10}}, nil
+	}
+	var calls []string
+	setDeviceVolume = func(_ context.Context, room string, v int) error {
+		calls = append(calls, room+"="+strconv.Itoa(v))
+		return nil
+	}
+
+	night := 20
+	cfg := &native.Config{QuietHours: map[string]native.QuietHours{
+		"night": {Start: "22:00", End: "07:00", Rooms: []string{"Bedroom", "Den"}, MaxVolume: &night},
+	}}
+	if err := lowerQuietVolumes(context.Background(), cfg, []string{"bedroom", "Kitchen", "Den"}, false); err != nil {
+		t.Fatalf("lowerQuietVolumes: %v", err)
+	}
+	if got := strings.Join(calls, ","); got != "Bedroom=20" {
+		t.Fatalf("calls=%s, want only Bedroom lowered", got)
+	}
+	calls = nil
+	if err := lowerQuietVolumes(context.Background(), cfg, []string{"Bedroom"}, true); err != nil || len(calls) != 0 {
+		t.Fatalf("force: calls=%v err=%v", calls, err)
+	}
+}
+
 func TestResolveNativeShortcuts(t *testing.T) {
 	cfg := &native.Config{
 		Native: native.NativeConfig{
-			Playlists:       map[string]map[string]string{"Bedroom": {"Focus": "Focus Shortcut"}},
+			Playlists:       map[string]map[string]native.PlaylistShortcut{"Bedroom": {"Focus": {Shortcut: "Focus Shortcut"}}},
 			VolumeShortcuts: map[string]map[string]string{"Bedroom": {"30": "Volume 30 Shortcut"}},
 		},
 	}
@@ -122,13 +264,33 @@ func TestResolveNativeShortcuts(t *testing.T) {
 	}
 }
 
+func TestResolveNativeShortcutsThroughDeviceAlias(t *testing.T) {
+	cfg := &native.Config{
+		Devices: map[string]string{"office": "Agis's Office HomePod"},
+		Native: native.NativeConfig{
+			Playlists:       map[string]map[string]native.PlaylistShortcut{"office": {"Focus": {Shortcut: "Office Focus"}}},
+			VolumeShortcuts: map[string]map[string]string{"office": {"30": "Office Volume 30"}},
+		},
+	}
+	rooms := cfg.ExpandRooms([]string{"Office"})
+	if len(rooms) != 1 || rooms[0] != "Agis's Office HomePod" {
+		t.Fatalf("rooms=%v", rooms)
+	}
+	if got, err := resolveNativePlaylistShortcut(cfg, rooms[0], "Focus"); err != nil || got != "Office Focus" {
+		t.Fatalf("playlist shortcut=%q err=%v", got, err)
+	}
+	if got, err := resolveNativeVolumeShortcut(cfg, rooms[0], 30); err != nil || got != "Office Volume 30" {
+		t.Fatalf("volume shortcut=%q err=%v", got, err)
+	}
+}
+
 func TestRunNativeShortcutsUsesResolvedMappings(t *testing.T) {
 	orig := runNativeShortcut
 	t.Cleanup(func() { runNativeShortcut = orig })
 
 	cfg := &native.Config{
 		Native: native.NativeConfig{
-			Playlists:       map[string]map[string]string{"Bedroom": {"Focus": "Focus Shortcut"}},
+			Playlists:       map[string]map[string]native.PlaylistShortcut{"Bedroom": {"Focus": {Shortcut: "Focus Shortcut"}}},
 			VolumeShortcuts: map[string]map[string]string{"Bedroom": {"30": "Volume 30 Shortcut"}},
 		},
 	}
@@ -142,7 +304,7 @@ func TestRunNativeShortcutsUsesResolvedMappings(t *testing.T) {
 	if err := runNativePlaylistShortcuts(context.Background(), cfg, []string{"Bedroom"}, "Focus"); err != nil {
 		t.Fatalf("runNativePlaylistShortcuts: %v", err)
 	}
-	if err := runNativeVolumeShortcuts(context.Background(), cfg, []string{"Bedroom"}, 30); err != nil {
+	if err := runNativeVolumeShortcuts(context.Background(), cfg, []string{"Bedroom"}, 30, false); err != nil {
 		t.Fatalf("runNativeVolumeShortcuts: %v", err)
 	}
 	if len(calls) != 2 || calls[0] != "Focus Shortcut" || calls[1] != "Volume 30 Shortcut" {
@@ -150,16 +312,52 @@ func TestRunNativeShortcutsUsesResolvedMappings(t *testing.T) {
 	}
 }
 
+func TestRunNativePlaylistShortcutsWildcardInput(t *testing.T) {
+	origRun := runNativeShortcut
+	origRunWithInput := runNativeShortcutWithInput
+	t.Cleanup(func() {
+		runNativeShortcut = origRun
+		runNativeShortcutWithInput = origRunWithInput
+	})
+
+	cfg := &native.Config{
+		Native: native.NativeConfig{
+			Playlists: map[string]map[string]native.PlaylistShortcut{
+				"Bedroom": {"Focus": {Shortcut: "BR Focus"}},
+				"*":       {"*": {Shortcut: "Play In Room", Input: "{playlist}|{room}"}},
+			},
+		},
+	}
+	var calls []string
+	runNativeShortcut = func(_ context.Context, name string) error {
+		calls = append(calls, name)
+		return nil
+	}
+	runNativeShortcutWithInput = func(_ context.Context, name, input string) (string, error) {
+		calls = append(calls, name+"<"+input)
+		return "ok", nil
+	}
+
+	if err := runNativePlaylistShortcuts(context.Background(), cfg, []string{"Bedroom", "Kitchen"}, "Focus"); err != nil {
+		t.Fatalf("runNativePlaylistShortcuts: %v", err)
+	}
+	if strings.Join(calls, ",") != "BR Focus,Play In Room<Focus|Kitchen" {
+		t.Fatalf("calls=%v", calls)
+	}
+}
+
 func TestRunDoctorChecksUsesInjectedSeams(t *testing.T) {
 	origLookPath := lookPath
 	origConfigPath := configPath
 	origLoadConfigOptional := loadConfigOptional
 	origGetNowPlaying := getNowPlaying
+	origDiscoverNetworkDevices := discoverNetworkDevices
 	t.Cleanup(func() {
 		lookPath = origLookPath
 		configPath = origConfigPath
 		loadConfigOptional = origLoadConfigOptional
 		getNowPlaying = origGetNowPlaying
+		discoverNetworkDevices = origDiscoverNetworkDevices
 	})
 
 	lookPath = func(name string) (string, error) {
@@ -179,6 +377,9 @@ func TestRunDoctorChecksUsesInjectedSeams(t *testing.T) {
 	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
 		return music.NowPlaying{}, errors.New("music unavailable")
 	}
+	discoverNetworkDevices = func(context.Context, time.Duration) ([]airplay.Device, error) {
+		return nil, errors.New("no network")
+	}
 
 	report := runDoctorChecks(context.Background())
 	if report.OK {
@@ -201,6 +402,43 @@ func TestRunDoctorChecksUsesInjectedSeams(t *testing.T) {
 	if statusByName["music-backend"] != "warn" {
 		t.Fatalf("music-backend status=%q", statusByName["music-backend"])
 	}
+	if statusByName["network-devices"] != "warn" {
+		t.Fatalf("network-devices status=%q", statusByName["network-devices"])
+	}
+}
+
+func TestAutomationCheck(t *testing.T) {
+	orig := probeAutomation
+	t.Cleanup(func() { probeAutomation = orig })
+	t.Setenv("__CFBundleIdentifier", "com.googlecode.iterm2")
+
+	probeAutomation = func(context.Context) (music.AutomationPermission, error) {
+		t.Fatal("probe ran while Music.app was not running")
+		return "", nil
+	}
+	if c := automationCheck(context.Background(), false); c.Status != "warn" {
+		t.Fatalf("not running: %+v", c)
+	}
+
+	probeAutomation = func(context.Context) (music.AutomationPermission, error) {
+		return music.AutomationDenied, &music.ScriptError{Err: errors.New("exit status 1"), Output: "Not authorized to send Apple events to Music. (-1743)"}
+	}
+	c := automationCheck(context.Background(), true)
+	if c.Status != "fail" || !strings.Contains(c.Tip, "Automation → iTerm → turn on Music") || !strings.Contains(c.Tip, "tccutil reset AppleEvents com.googlecode.iterm2") {
+		t.Fatalf("denied: %+v", c)
+	}
+
+	probeAutomation = func(context.Context) (music.AutomationPermission, error) {
+		return music.AutomationUndetermined, errors.New("-1744")
+	}
+	if c := automationCheck(context.Background(), true); c.Status != "warn" || !strings.Contains(c.Message, "-1744") {
+		t.Fatalf("undetermined: %+v", c)
+	}
+
+	probeAutomation = func(context.Context) (music.AutomationPermission, error) { return music.AutomationGranted, nil }
+	if c := automationCheck(context.Background(), true); c.Status != "pass" {
+		t.Fatalf("granted: %+v", c)
+	}
 }
 
 type fakeStatusTicker struct {
@@ -283,9 +521,11 @@ func TestCollectStatus_Connected(t *testing.T) {
 				Artist: "Artist",
 				Album:  "Album",
 			},
+			PlaylistName: "Focus",
+			Source:       music.SourcePlaylist,
 			Outputs: []music.AirPlayDevice{
-				{Name: "Bedroom", Volume: 30, Kind: "speaker"},
-				{Name: "Living Room", Volume: 50, Kind: "speaker"},
+				{Name: "Bedroom", Volume: 30, Kind: "HomePod"},
+				{Name: "Living Room", Volume: 50, Kind: "Apple TV"},
 			},
 		}, nil
 	}
@@ -309,6 +549,43 @@ func TestCollectStatus_Connected(t *testing.T) {
 	if len(res.Route) != 2 || res.Route[0] != "Bedroom" || res.Route[1] != "Living Room" {
 		t.Fatalf("route=%v", res.Route)
 	}
+	if res.Source == nil || res.Source.Kind != "playlist" || res.Source.Name != "Focus" {
+		t.Fatalf("source=%+v", res.Source)
+	}
+	if res.Outputs[0].Type != "homepod" || res.Outputs[1].Type != "tv" || res.Outputs[1].Kind != "Apple TV" {
+		t.Fatalf("outputs=%+v", res.Outputs)
+	}
+}
+
+func TestStatusFields(t *testing.T) {
+	if _, err := parseStatusFields("track,lyrics"); err == nil || !strings.Contains(err.Error(), `unknown status field "lyrics"`) {
+		t.Fatalf("err=%v", err)
+	}
+	fields, err := parseStatusFields("Track, outputs")
+	if err != nil || !fields["track"] || !fields["outputs"] || len(fields) != 2 {
+		t.Fatalf("fields=%v err=%v", fields, err)
+	}
+
+	res := statusResult{
+		OK:      true,
+		Player:  "playing",
+		Track:   &statusTrack{Name: "Song", Artist: "Artist"},
+		Outputs: []statusOutput{{DeviceName: "Bedroom", Room: "Bedroom", Volume: 30, Type: "homepod"}},
+		Route:   []string{"Bedroom"},
+	}
+	got := captureStdout(t, func() { writeJSON(selectStatusFields(res, fields)) })
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(got), &payload); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, got)
+	}
+	if len(payload) != 3 || payload["ok"] != true || payload["track"] == nil || payload["outputs"] == nil {
+		t.Fatalf("payload=%v", payload)
+	}
+
+	got = captureStdout(t, func() { printStatus(res, fields) })
+	if got != "ok=true track=\"Song\" artist=\"Artist\"\noutputs=Bedroom(homepod, vol=30)\n" {
+		t.Fatalf("printStatus=%q", got)
+	}
 }
 
 func TestCollectStatus_MissingOsaScript(t *testing.T) {
@@ -385,6 +662,37 @@ func TestCmdStatus_JSONIncludesConnectionState(t *testing.T) {
 	}
 }
 
+func TestCmdStatus_JSONStreamWritesOneLine(t *testing.T) {
+	origLookPath := lookPath
+	origGetNowPlaying := getNowPlaying
+	t.Cleanup(func() {
+		lookPath = origLookPath
+		getNowPlaying = origGetNowPlaying
+	})
+	lookPath = func(string) (string, error) { return "/usr/bin/osascript", nil }
+	getNowPlaying = func(context.Context) (music.NowPlaying, error) {
+		return music.NowPlaying{PlayerState: "playing", Track: music.NowPlayingTrack{Name: "Song"}}, nil
+	}
+
+	out := captureStdout(t, func() {
+		cmdStatus(context.Background(), []string{"--json-stream"})
+	})
+	if strings.Count(out, "\n") != 1 || !strings.HasSuffix(out, "\n") {
+		t.Fatalf("want one NDJSON line, got %q", out)
+	}
+	var payload statusResult
+	if err := json.Unmarshal([]byte(out), &payload); err != nil || payload.Player != "playing" {
+		t.Fatalf("payload=%+v err=%v", payload, err)
+	}
+
+	_, recovered := captureStdoutAndRecover(t, func() {
+		cmdStatus(context.Background(), []string{"--json", "--json-stream"})
+	})
+	if fatal, ok := recovered.(cliFatal); !ok || classifyExitCode(fatal.err) != exitUsage {
+		t.Fatalf("recovered=%#v", recovered)
+	}
+}
+
 func TestFormatStatusSnapshotHeader(t *testing.T) {
 	at := time.Date(2026, 2, 23, 8, 0, 0, 0, time.UTC)
 	got := formatStatusSnapshotHeader(at, 2)
@@ -393,3 +701,96 @@ func TestFormatStatusSnapshotHeader(t *testing.T) {
 		t.Fatalf("header=%q want=%q", got, want)
 	}
 }
+
+func TestNetworkDevicesCheckComparesWithMusic(t *testing.T) {
+	origListAirPlayDevices := listAirPlayDevices
+	origDiscoverNetworkDevices := discoverNetworkDevices
+	t.Cleanup(func() {
+		listAirPlayDevices = origListAirPlayDevices
+		discoverNetworkDevices = origDiscoverNetworkDevices
+	})
+	discoverNetworkDevices = func(context.Context, time.Duration) ([]airplay.Device, error) {
+		return []airplay.Device{
+			{Name: "Bedroom", Addr: "192.168.1.10", Model: "AudioAccessory5,1", Version: "800.72.1"},
+			{Name: "Kitchen", Addr: "192.168.1.11"},
+		}, nil
+	}
+	listAirPlayDevices = func(context.Context) ([]music.AirPlayDevice, error) {
+		return []music.AirPlayDevice{{Name: "Computer"}, {Name: "bedroom"}}, nil
+	}
+
+	c := networkDevicesCheck(context.Background(), true)
+	if c.Status != "warn" || !strings.Contains(c.Message, "not in Music.app: Kitchen") {
+		t.Fatalf("unexpected check: %+v", c)
+	}
+	if c := networkDevicesCheck(context.Background(), false); c.Status != "pass" {
+		t.Fatalf("unexpected check without Music: %+v", c)
+	}
+
+	out := captureStdout(t, func() { cmdDiscover(context.Background(), []string{"--plain"}) })
+	if !strings.Contains(out, "Bedroom  AudioAccessory5,1  192.168.1.10  800.72.1  -  false") {
+		t.Fatalf("unexpected discover output: %q", out)
+	}
+}
+
+func TestNativeShortcutsCheckReportsMissing(t *testing.T) {
+	origLookPath := lookPath
+	origListShortcuts := listShortcuts
+	t.Cleanup(func() {
+		lookPath = origLookPath
+		listShortcuts = origListShortcuts
+	})
+	lookPath = func(string) (string, error) { return "/usr/bin/shortcuts", nil }
+	listShortcuts = func(context.Context) ([]string, error) { return []string{"BR Focus"}, nil }
+
+	if _, ok := nativeShortcutsCheck(context.Background(), &native.Config{}); ok {
+		t.Fatalf("expected check to be omitted without referenced shortcuts")
+	}
+	cfg := &native.Config{Native: native.NativeConfig{
+		Playlists:       map[string]map[string]native.PlaylistShortcut{"Bedroom": {"Focus": {Shortcut: "BR Focus"}}},
+		VolumeShortcuts: map[string]map[string]string{"Bedroom": {"30": "Bedroom Vol 30"}},
+	}}
+	c, ok := nativeShortcutsCheck(context.Background(), cfg)
+	if !ok || c.Status != "warn" || !strings.Contains(c.Message, `native.volumeShortcuts.Bedroom.30: shortcut "Bedroom Vol 30" not found`) || c.Tip == "" {
+		t.Fatalf("check=%+v ok=%t", c, ok)
+	}
+
+	listShortcuts = func(context.Context) ([]string, error) { return []string{"BR Focus", "Bedroom Vol 30"}, nil }
+	if c, _ := nativeShortcutsCheck(context.Background(), cfg); c.Status != "pass" {
+		t.Fatalf("check=%+v", c)
+	}
+}
+
+func TestStatusFormat(t *testing.T) {
+	tmpl, err := parseStatusFormat("{{.Track.Artist}} — {{.Track.Name}} [{{.PlayerState}}] {{join .Route \",\"}} {{trunc 5 .Source.Name}}")
+	if err != nil {
+		t.Fatalf("parseStatusFormat: %v", err)
+	}
+	vol := 40
+	res := statusResult{
+		OK:     true,
+		Player: "playing",
+		Track:  &statusTrack{Name: "Song", Artist: "Artist"},
+		Source: &statusSource{Kind: "playlist", Name: "Deep Focus"},
+		Volume: &vol,
+		Route:  []string{"Bedroom", "Kitchen"},
+	}
+	got, err := renderStatusFormat(tmpl, res)
+	if err != nil || got != "Artist — Song [playing] Bedroom,Kitchen Deep…" {
+		t.Fatalf("render=%q err=%v", got, err)
+	}
+
+	// Nothing playing: track fields render empty instead of failing.
+	got, err = renderStatusFormat(tmpl, statusResult{OK: true, Player: "stopped"})
+	if err != nil || got != " —  [stopped]  " {
+		t.Fatalf("render idle=%q err=%v", got, err)
+	}
+
+	if _, err := parseStatusFormat("{{.Track.Name"); err == nil || classifyExitCode(err) != exitUsage {
+		t.Fatalf("syntax error=%v, want usage error", err)
+	}
+	tmpl, _ = parseStatusFormat("{{.Lyrics}}")
+	if _, err := renderStatusFormat(tmpl, res); err == nil || classifyExitCode(err) != exitUsage {
+		t.Fatalf("unknown field err=%v, want usage error", err)
+	}
+}
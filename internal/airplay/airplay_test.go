@@ -0,0 +1,96 @@
+package airplay
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func appendRecord(t *testing.T, msg []byte, name string, rtype uint16, rdata []byte) []byte {
+	t.Helper()
+	var err error
+	if msg, err = appendDNSName(msg, name); err != nil {
+		t.Fatalf("appendDNSName: %v", err)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, rtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	msg = binary.BigEndian.AppendUint32(msg, 120)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+	return append(msg, rdata...)
+}
+
+func TestMDNSRecordsResolveRAOPService(t *testing.T) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[6:], 4) // ANCOUNT
+
+	ptrOff := len(msg)
+	inst, _ := appendDNSName(nil, "AABBCCDDEEFF@Kitchen._raop._tcp.local.")
+	msg = appendRecord(t, msg, "_raop._tcp.local.", dnsTypePTR, inst)
+
+	// The SRV owner is a compression pointer to the PTR owner's instance name.
+	srv := []byte{0, 0, 0, 0, 0x1B, 0x58}
+	srv, _ = appendDNSName(srv, "Kitchen.local.")
+	instOff := ptrOff + len("_raop._tcp.local.") + 1 + 10
+	msg = append(msg, 0xC0|byte(instOff>>8), byte(instOff))
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeSRV)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	msg = binary.BigEndian.AppendUint32(msg, 120)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(srv)))
+	msg = append(msg, srv...)
+
+	var txt []byte
+	for _, kv := range []string{"am=AudioAccessory5,1", "vs=800.72.1", "pw=false"} {
+		txt = append(append(txt, byte(len(kv))), kv...)
+	}
+	msg = appendRecord(t, msg, "AABBCCDDEEFF@Kitchen._raop._tcp.local.", dnsTypeTXT, txt)
+	msg = appendRecord(t, msg, "Kitchen.local.", dnsTypeA, []byte{192, 168, 1, 20})
+
+	recs := newMDNSRecords()
+	if err := recs.parse(msg); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	svcs := recs.services("_raop._tcp.local.")
+	if len(svcs) != 1 {
+		t.Fatalf("services=%+v", svcs)
+	}
+	dev := deviceFromService(svcs[0])
+	want := Device{Name: "Kitchen", ID: "AABBCCDDEEFF", Host: "Kitchen.local", Addr: "192.168.1.20", Port: 7000, Model: "AudioAccessory5,1", Version: "800.72.1"}
+	if dev != want {
+		t.Fatalf("device=%+v, want %+v", dev, want)
+	}
+
+	if err := newMDNSRecords().parse(msg[:20]); err == nil {
+		t.Fatalf("expected error for truncated message")
+	}
+}
+
+func TestMergeAirPlayAndRAOPRecords(t *testing.T) {
+	dev := deviceFromService(Service{Instance: "AABBCCDDEEFF@Kitchen", Addr: "192.168.1.20", Port: 7000, TXT: map[string]string{"am": "AudioAccessory5,1"}})
+	mergeDevice(&dev, deviceFromAirPlayService(Service{
+		Instance: "Kitchen",
+		Addr:     "192.168.1.20",
+		Port:     7000,
+		TXT:      map[string]string{"deviceid": "aa:bb:cc:dd:ee:ff", "model": "AudioAccessory1,1", "srcvers": "800.72.1", "osvers": "18.1"},
+	}))
+	want := Device{Name: "Kitchen", ID: "AABBCCDDEEFF", Addr: "192.168.1.20", Port: 7000, Model: "AudioAccessory5,1", Version: "800.72.1", OSVersion: "18.1"}
+	if dev != want {
+		t.Fatalf("device=%+v, want %+v", dev, want)
+	}
+}
+
+func TestMergeReceivers(t *testing.T) {
+	devs := mergeReceivers(
+		[]Service{{Instance: "AABBCCDDEEFF@Kitchen", Addr: "192.168.1.20", Port: 7000, TXT: map[string]string{"am": "AudioAccessory5,1"}}},
+		[]Service{
+			{Instance: "Kitchen", Addr: "192.168.1.20", Port: 7000, TXT: map[string]string{"deviceid": "aa:bb:cc:dd:ee:ff", "model": "AudioAccessory1,1", "srcvers": "800.72.1", "osvers": "18.1"}},
+			{Instance: "Bedroom", Addr: "192.168.1.21", Port: 7000},
+		},
+		[]Service{{Instance: "Kitchen"}},
+	)
+	want := []Device{
+		{Name: "Bedroom", Addr: "192.168.1.21", Port: 7000},
+		{Name: "Kitchen", ID: "AABBCCDDEEFF", Addr: "192.168.1.20", Port: 7000, Model: "AudioAccessory5,1", Version: "800.72.1", OSVersion: "18.1", Companion: true},
+	}
+	if len(devs) != len(want) || devs[0] != want[0] || devs[1] != want[1] {
+		t.Fatalf("devices=%+v, want %+v", devs, want)
+	}
+}
@@ -0,0 +1,141 @@
+package airplay
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS-SD service types advertised by AirPlay receivers.
+const (
+	RAOPService    = "_raop._tcp"
+	AirPlayService = "_airplay._tcp"
+	// CompanionService is advertised by devices that accept Companion
+	// (remote control) connections. Controlling them needs pairing, which is
+	// not implemented; discovery only reports support.
+	CompanionService = "_companion-link._tcp"
+)
+
+// Device is an AirPlay audio receiver discovered on the LAN.
+type Device struct {
+	Name      string `json:"name"`
+	ID        string `json:"id,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Addr      string `json:"addr"`
+	Port      int    `json:"port"`
+	Model     string `json:"model,omitempty"`
+	Version   string `json:"version,omitempty"`
+	OSVersion string `json:"osVersion,omitempty"`
+	Password  bool   `json:"password,omitempty"`
+	Companion bool   `json:"companion,omitempty"`
+}
+
+// DiscoverReceivers browses both AirPlay service types and merges instances
+// that describe the same receiver, so devices that only advertise one of them
+// are still listed. Receivers that also advertise the Companion protocol are
+// flagged. It fails only when both AirPlay browses fail.
+func DiscoverReceivers(ctx context.Context, timeout time.Duration) ([]Device, error) {
+	services := []string{RAOPService, AirPlayService, CompanionService}
+	found := make([][]Service, len(services))
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found[i], errs[i] = Browse(ctx, svc, timeout)
+		}()
+	}
+	wg.Wait()
+	if errs[0] != nil && errs[1] != nil {
+		return nil, errs[0]
+	}
+	return mergeReceivers(found[0], found[1], found[2]), nil
+}
+
+// mergeReceivers combines RAOP and AirPlay instances by device name, marking
+// those with a matching Companion instance.
+func mergeReceivers(raop, ap, companion []Service) []Device {
+	byName := map[string]*Device{}
+	var order []string
+	add := func(d Device) {
+		if d.Addr == "" {
+			return
+		}
+		key := strings.ToLower(d.Name)
+		cur, ok := byName[key]
+		if !ok {
+			byName[key] = &d
+			order = append(order, key)
+			return
+		}
+		mergeDevice(cur, d)
+	}
+	for _, s := range raop {
+		add(deviceFromService(s))
+	}
+	for _, s := range ap {
+		add(deviceFromAirPlayService(s))
+	}
+	for _, s := range companion {
+		if d, ok := byName[strings.ToLower(s.Instance)]; ok {
+			d.Companion = true
+		}
+	}
+	sort.Strings(order)
+	out := make([]Device, 0, len(order))
+	for _, key := range order {
+		out = append(out, *byName[key])
+	}
+	return out
+}
+
+// deviceFromAirPlayService maps an _airplay._tcp instance, whose name is the
+// plain device name, onto a Device.
+func deviceFromAirPlayService(s Service) Device {
+	return Device{
+		Name:      s.Instance,
+		ID:        strings.ToUpper(strings.ReplaceAll(s.TXT["deviceid"], ":", "")),
+		Host:      s.Host,
+		Addr:      s.Addr,
+		Port:      s.Port,
+		Model:     s.TXT["model"],
+		Version:   s.TXT["srcvers"],
+		OSVersion: s.TXT["osvers"],
+		Password:  s.TXT["pw"] == "true",
+	}
+}
+
+// mergeDevice fills fields missing from dst with values from src.
+func mergeDevice(dst *Device, src Device) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&dst.ID, src.ID},
+		{&dst.Host, src.Host},
+		{&dst.Model, src.Model},
+		{&dst.Version, src.Version},
+		{&dst.OSVersion, src.OSVersion},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+	dst.Password = dst.Password || src.Password
+}
+
+// deviceFromService maps a RAOP instance ("AABBCCDDEEFF@Kitchen") and its TXT
+// record onto a Device.
+func deviceFromService(s Service) Device {
+	d := Device{Name: s.Instance, Host: s.Host, Addr: s.Addr, Port: s.Port}
+	if id, name, ok := strings.Cut(s.Instance, "@"); ok && name != "" {
+		d.ID, d.Name = id, name
+	}
+	d.Model = s.TXT["am"]
+	d.Version = s.TXT["vs"]
+	d.Password = s.TXT["pw"] == "true"
+	return d
+}
@@ -0,0 +1,296 @@
+package airplay
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Service is one DNS-SD instance found while browsing a service type.
+type Service struct {
+	Instance string            `json:"instance"`
+	Host     string            `json:"host"`
+	Addr     string            `json:"addr"`
+	Port     int               `json:"port"`
+	TXT      map[string]string `json:"txt,omitempty"`
+}
+
+const (
+	dnsTypeA    = 1
+	dnsTypePTR  = 12
+	dnsTypeTXT  = 16
+	dnsTypeAAAA = 28
+	dnsTypeSRV  = 33
+	dnsClassIN  = 1
+	// dnsUnicastResponse asks responders to answer the querier directly
+	// (the "QU" bit from RFC 6762 section 5.4).
+	dnsUnicastResponse = 0x8000
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// listenMDNS opens the socket queries are sent from; tests replace it.
+var listenMDNS = func() (net.PacketConn, error) {
+	return net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+}
+
+// Browse sends a DNS-SD PTR query for service (e.g. "_raop._tcp") on the
+// local network and collects answers until timeout or ctx is done.
+func Browse(ctx context.Context, service string, timeout time.Duration) ([]Service, error) {
+	service = strings.Trim(strings.TrimSpace(service), ".")
+	if service == "" {
+		return nil, fmt.Errorf("service type is required")
+	}
+	fqdn := service + ".local."
+	query, err := buildMDNSQuery(fqdn, dnsTypePTR)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := listenMDNS()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.WriteTo(query, mdnsGroup); err != nil {
+		return nil, err
+	}
+	recs := newMDNSRecords()
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		// Malformed or unrelated packets on the shared port are ignored.
+		_ = recs.parse(buf[:n])
+	}
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, err
+	}
+	return recs.services(fqdn), nil
+}
+
+func buildMDNSQuery(name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+	var err error
+	if msg, err = appendDNSName(msg, name); err != nil {
+		return nil, err
+	}
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN|dnsUnicastResponse)
+	return msg, nil
+}
+
+func appendDNSName(msg []byte, name string) ([]byte, error) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0), nil
+}
+
+type srvRecord struct {
+	target string
+	port   int
+}
+
+// mdnsRecords accumulates records from every response seen during a browse.
+type mdnsRecords struct {
+	ptr  map[string][]string
+	srv  map[string]srvRecord
+	txt  map[string]map[string]string
+	addr map[string][]net.IP
+}
+
+func newMDNSRecords() *mdnsRecords {
+	return &mdnsRecords{
+		ptr:  map[string][]string{},
+		srv:  map[string]srvRecord{},
+		txt:  map[string]map[string]string{},
+		addr: map[string][]net.IP{},
+	}
+}
+
+func (m *mdnsRecords) parse(msg []byte) error {
+	if len(msg) < 12 {
+		return errors.New("short DNS message")
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rr := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	off := 12
+	for i := 0; i < qd; i++ {
+		_, next, err := readDNSName(msg, off)
+		if err != nil {
+			return err
+		}
+		off = next + 4
+	}
+	for i := 0; i < rr; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil {
+			return err
+		}
+		if next+10 > len(msg) {
+			return errors.New("truncated DNS record")
+		}
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		rdlen := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		end := start + rdlen
+		if end > len(msg) {
+			return errors.New("truncated DNS record data")
+		}
+		key := strings.ToLower(name)
+		switch rtype {
+		case dnsTypePTR:
+			target, _, err := readDNSName(msg, start)
+			if err != nil {
+				return err
+			}
+			if !containsString(m.ptr[key], target) {
+				m.ptr[key] = append(m.ptr[key], target)
+			}
+		case dnsTypeSRV:
+			if rdlen < 7 {
+				return errors.New("short SRV record")
+			}
+			target, _, err := readDNSName(msg, start+6)
+			if err != nil {
+				return err
+			}
+			m.srv[key] = srvRecord{target: target, port: int(binary.BigEndian.Uint16(msg[start+4:]))}
+		case dnsTypeTXT:
+			m.txt[key] = parseTXT(msg[start:end])
+		case dnsTypeA, dnsTypeAAAA:
+			ip := net.IP(append([]byte(nil), msg[start:end]...))
+			if !containsIP(m.addr[key], ip) {
+				m.addr[key] = append(m.addr[key], ip)
+			}
+		}
+		off = end
+	}
+	return nil
+}
+
+func (m *mdnsRecords) services(fqdn string) []Service {
+	var out []Service
+	for _, inst := range m.ptr[strings.ToLower(fqdn)] {
+		key := strings.ToLower(inst)
+		svc := Service{
+			Instance: strings.TrimSuffix(strings.TrimSuffix(inst, "."+fqdn), fqdn),
+			TXT:      m.txt[key],
+		}
+		if srv, ok := m.srv[key]; ok {
+			svc.Host = strings.TrimSuffix(srv.target, ".")
+			svc.Port = srv.port
+			svc.Addr = preferredAddr(m.addr[strings.ToLower(srv.target)])
+		}
+		out = append(out, svc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Instance < out[j].Instance })
+	return out
+}
+
+// readDNSName decodes a possibly compressed name at off and returns it with a
+// trailing dot plus the offset just past the name in the original message.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for hops := 0; ; hops++ {
+		if off >= len(msg) || hops > 64 {
+			return "", 0, errors.New("invalid DNS name")
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case l&0xC0 == 0xC0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("invalid DNS name pointer")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, errors.New("invalid DNS label")
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
+
+func parseTXT(data []byte) map[string]string {
+	txt := map[string]string{}
+	for len(data) > 0 {
+		l := int(data[0])
+		if 1+l > len(data) {
+			break
+		}
+		k, v, _ := strings.Cut(string(data[1:1+l]), "=")
+		if k != "" {
+			txt[strings.ToLower(k)] = v
+		}
+		data = data[1+l:]
+	}
+	return txt
+}
+
+func preferredAddr(ips []net.IP) string {
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String()
+		}
+	}
+	if len(ips) > 0 {
+		return ips[0].String()
+	}
+	return ""
+}
+
+func containsString(xs []string, s string) bool {
+	for _, x := range xs {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, x := range ips {
+		if x.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
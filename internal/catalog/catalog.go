@@ -0,0 +1,284 @@
+// Package catalog searches the Apple Music catalog through the Apple Music
+// API and adds catalog items to the user's library. Music.app's AppleScript
+// dictionary only reaches the library, so catalog items have to be added
+// there before they can be played.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultEndpoint   = "https://api.music.apple.com"
+	DefaultStorefront = "us"
+
+	// maxLimit is the most results the search endpoint returns per type.
+	maxLimit = 25
+)
+
+// Kinds are the catalog item kinds, in the order an unprefixed search lists
+// them.
+var Kinds = []string{"artist", "album", "song", "playlist"}
+
+// ErrNoUserToken means a library call was made without a Music-User-Token.
+var ErrNoUserToken = errors.New("adding to the library needs a Music-User-Token")
+
+// Item is a catalog artist, album, song, or playlist.
+type Item struct {
+	Kind      string  `json:"kind"` // artist|album|song|playlist
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Artist    string  `json:"artist,omitempty"` // curator for playlists
+	Album     string  `json:"album,omitempty"`
+	DurationS float64 `json:"durationSeconds,omitempty"`
+	URL       string  `json:"url,omitempty"`
+}
+
+// APIError is a non-2xx response from the Apple Music API.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("apple music api: HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("apple music api: HTTP %d: %s", e.Status, e.Message)
+}
+
+// Client calls the Apple Music API. DeveloperToken (a MusicKit JWT) is
+// required; UserToken is only needed by AddToLibrary.
+type Client struct {
+	DeveloperToken string
+	UserToken      string
+	Storefront     string
+	Endpoint       string
+	HTTP           *http.Client
+}
+
+// ParseQuery splits a query such as "artist:Khruangbin" into a kind and a
+// search term. "track:" is accepted for songs. Without a known prefix kind is
+// empty, which searches every kind.
+func ParseQuery(q string) (kind, term string) {
+	q = strings.TrimSpace(q)
+	prefix, rest, ok := strings.Cut(q, ":")
+	if !ok {
+		return "", q
+	}
+	switch p := strings.ToLower(strings.TrimSpace(prefix)); p {
+	case "artist", "album", "song", "playlist":
+		return p, strings.TrimSpace(rest)
+	case "track":
+		return "song", strings.TrimSpace(rest)
+	}
+	return "", q
+}
+
+// Search searches the catalog for term. kind limits the search to one kind;
+// empty searches all of them. limit applies per kind and is capped at 25.
+func (c *Client) Search(ctx context.Context, term, kind string, limit int) ([]Item, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return nil, fmt.Errorf("search term is required")
+	}
+	kinds := Kinds
+	if kind != "" {
+		if apiType(kind) == "" {
+			return nil, fmt.Errorf("invalid catalog kind %q (expected artist|album|song|playlist)", kind)
+		}
+		kinds = []string{kind}
+	}
+	types := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		types = append(types, apiType(k))
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	limit = min(limit, maxLimit)
+	q := url.Values{}
+	q.Set("term", term)
+	q.Set("types", strings.Join(types, ","))
+	q.Set("limit", strconv.Itoa(limit))
+
+	var body struct {
+		Results map[string]struct {
+			Data []resource `json:"data"`
+		} `json:"results"`
+	}
+	if err := c.get(ctx, "/v1/catalog/"+url.PathEscape(c.storefront())+"/search?"+q.Encode(), &body); err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, t := range types {
+		for _, r := range body.Results[t].Data {
+			items = append(items, r.item())
+		}
+	}
+	return items, nil
+}
+
+// TopSongs returns the most played songs of a catalog artist.
+func (c *Client) TopSongs(ctx context.Context, artistID string, limit int) ([]Item, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(min(limit, maxLimit)))
+	}
+	var body struct {
+		Data []resource `json:"data"`
+	}
+	path := "/v1/catalog/" + url.PathEscape(c.storefront()) + "/artists/" + url.PathEscape(artistID) + "/view/top-songs"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	if err := c.get(ctx, path, &body); err != nil {
+		return nil, err
+	}
+	items := make([]Item, 0, len(body.Data))
+	for _, r := range body.Data {
+		items = append(items, r.item())
+	}
+	return items, nil
+}
+
+// AddToLibrary adds catalog songs, albums, and playlists to the user's
+// library. Artists cannot be added; add their songs instead.
+func (c *Client) AddToLibrary(ctx context.Context, items []Item) error {
+	if strings.TrimSpace(c.UserToken) == "" {
+		return ErrNoUserToken
+	}
+	ids := map[string][]string{}
+	for _, it := range items {
+		t := apiType(it.Kind)
+		if t == "" || it.Kind == "artist" {
+			return fmt.Errorf("cannot add %s %q to the library", it.Kind, it.Name)
+		}
+		ids[t] = append(ids[t], it.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	q := url.Values{}
+	for t, list := range ids {
+		q.Set("ids["+t+"]", strings.Join(list, ","))
+	}
+	return c.do(ctx, http.MethodPost, "/v1/me/library?"+q.Encode(), nil)
+}
+
+func (c *Client) storefront() string {
+	if sf := strings.TrimSpace(c.Storefront); sf != "" {
+		return strings.ToLower(sf)
+	}
+	return DefaultStorefront
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, http.MethodGet, path, out)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	endpoint := strings.TrimRight(strings.TrimSpace(c.Endpoint), "/")
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.DeveloperToken)
+	if c.UserToken != "" {
+		req.Header.Set("Music-User-Token", c.UserToken)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return &APIError{Status: resp.StatusCode, Message: errorMessage(body)}
+	}
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("apple music api: decode %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// errorMessage pulls the first error out of an API error body, falling back
+// to the raw body.
+func errorMessage(body []byte) string {
+	var e struct {
+		Errors []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &e) == nil && len(e.Errors) > 0 {
+		if e.Errors[0].Detail != "" {
+			return e.Errors[0].Detail
+		}
+		return e.Errors[0].Title
+	}
+	s := strings.TrimSpace(string(body))
+	if len(s) > 200 {
+		s = s[:200]
+	}
+	return s
+}
+
+type resource struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Name             string  `json:"name"`
+		ArtistName       string  `json:"artistName"`
+		CuratorName      string  `json:"curatorName"`
+		AlbumName        string  `json:"albumName"`
+		DurationInMillis float64 `json:"durationInMillis"`
+		URL              string  `json:"url"`
+	} `json:"attributes"`
+}
+
+func (r resource) item() Item {
+	a := r.Attributes
+	it := Item{Kind: kindOf(r.Type), ID: r.ID, Name: a.Name, Artist: a.ArtistName, Album: a.AlbumName, URL: a.URL}
+	if it.Artist == "" {
+		it.Artist = a.CuratorName
+	}
+	if a.DurationInMillis > 0 {
+		it.DurationS = a.DurationInMillis / 1000
+	}
+	return it
+}
+
+func apiType(kind string) string {
+	switch kind {
+	case "artist", "album", "song", "playlist":
+		return kind + "s"
+	}
+	return ""
+}
+
+func kindOf(apiType string) string {
+	return strings.TrimSuffix(apiType, "s")
+}
@@ -0,0 +1,89 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct{ in, kind, term string }{
+		{"artist:Khruangbin", "artist", "Khruangbin"},
+		{"Track: Maria Tambien", "song", "Maria Tambien"},
+		{"Mordechai", "", "Mordechai"},
+		{"Re: Stacks", "", "Re: Stacks"},
+	}
+	for _, tc := range cases {
+		if kind, term := ParseQuery(tc.in); kind != tc.kind || term != tc.term {
+			t.Fatalf("ParseQuery(%q)=(%q,%q), want (%q,%q)", tc.in, kind, term, tc.kind, tc.term)
+		}
+	}
+}
+
+func TestSearchTopSongsAndAddToLibrary(t *testing.T) {
+	t.Parallel()
+
+	var added string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer dev" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"errors":[{"title":"Unauthenticated"}]}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/catalog/gb/search":
+			if r.URL.Query().Get("term") != "khruangbin" || r.URL.Query().Get("types") != "artists" || r.URL.Query().Get("limit") != "10" {
+				t.Errorf("search query=%v", r.URL.Query())
+			}
+			_, _ = io.WriteString(w, `{"results":{"artists":{"data":[{"id":"A1","type":"artists","attributes":{"name":"Khruangbin","url":"https://music.apple.com/gb/artist/1"}}]}}}`)
+		case "/v1/catalog/gb/artists/A1/view/top-songs":
+			_, _ = io.WriteString(w, `{"data":[{"id":"S1","type":"songs","attributes":{"name":"Maria Tambien","artistName":"Khruangbin","albumName":"Con Todo El Mundo","durationInMillis":194000}}]}`)
+		case "/v1/me/library":
+			if r.Method != http.MethodPost || r.Header.Get("Music-User-Token") != "user" {
+				t.Errorf("library call method=%s user=%q", r.Method, r.Header.Get("Music-User-Token"))
+			}
+			added = r.URL.Query().Get("ids[songs]")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{DeveloperToken: "dev", Storefront: "GB", Endpoint: srv.URL}
+	items, err := c.Search(context.Background(), "khruangbin", "artist", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(items) != 1 || items[0] != (Item{Kind: "artist", ID: "A1", Name: "Khruangbin", URL: "https://music.apple.com/gb/artist/1"}) {
+		t.Fatalf("items=%+v", items)
+	}
+	songs, err := c.TopSongs(context.Background(), "A1", 5)
+	if err != nil {
+		t.Fatalf("TopSongs: %v", err)
+	}
+	if len(songs) != 1 || songs[0].Kind != "song" || songs[0].Album != "Con Todo El Mundo" || songs[0].DurationS != 194 {
+		t.Fatalf("songs=%+v", songs)
+	}
+	if err := c.AddToLibrary(context.Background(), songs); !errors.Is(err, ErrNoUserToken) {
+		t.Fatalf("err=%v, want ErrNoUserToken", err)
+	}
+	c.UserToken = "user"
+	if err := c.AddToLibrary(context.Background(), songs); err != nil {
+		t.Fatalf("AddToLibrary: %v", err)
+	}
+	if added != "S1" {
+		t.Fatalf("added=%q", added)
+	}
+
+	c.DeveloperToken = "expired"
+	var apiErr *APIError
+	if _, err := c.Search(context.Background(), "khruangbin", "", 0); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized || apiErr.Message != "Unauthenticated" {
+		t.Fatalf("err=%v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Package homekit lists HomeKit accessories from their Bonjour (_hap._tcp)
+// advertisements. It is discovery only: it does not pair as a HAP controller,
+// so it cannot read accessory state or run scenes.
+package homekit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/airplay"
+)
+
+// HAPService is the DNS-SD service type HomeKit accessories advertise on IP
+// networks.
+const HAPService = "_hap._tcp"
+
+// Accessory is a HomeKit accessory as advertised over Bonjour. The record is
+// public; reading characteristics or triggering scenes requires a paired
+// controller session, which this package does not implement.
+type Accessory struct {
+	Name         string `json:"name"`
+	ID           string `json:"id,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Category     string `json:"category"`
+	CategoryID   int    `json:"categoryId,omitempty"`
+	Paired       bool   `json:"paired"`
+	ConfigNumber int    `json:"configNumber,omitempty"`
+	Addr         string `json:"addr"`
+	Port         int    `json:"port"`
+}
+
+// Status flag bit set in the "sf" TXT key while an accessory is unpaired.
+const statusNotPaired = 0x01
+
+var categoryNames = map[int]string{
+	1:  "other",
+	2:  "bridge",
+	5:  "lightbulb",
+	7:  "outlet",
+	8:  "switch",
+	9:  "thermostat",
+	10: "sensor",
+	17: "camera",
+	26: "speaker",
+	32: "television",
+}
+
+// Discover browses for HomeKit accessories on the local network.
+func Discover(ctx context.Context, timeout time.Duration) ([]Accessory, error) {
+	svcs, err := airplay.Browse(ctx, HAPService, timeout)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Accessory, 0, len(svcs))
+	for _, s := range svcs {
+		if s.Addr == "" {
+			continue
+		}
+		out = append(out, accessoryFromService(s))
+	}
+	return out, nil
+}
+
+func accessoryFromService(s airplay.Service) Accessory {
+	a := Accessory{
+		Name:  s.Instance,
+		ID:    strings.ToUpper(s.TXT["id"]),
+		Model: s.TXT["md"],
+		Addr:  s.Addr,
+		Port:  s.Port,
+	}
+	a.CategoryID, _ = strconv.Atoi(s.TXT["ci"])
+	a.Category = categoryNames[a.CategoryID]
+	if a.Category == "" {
+		a.Category = "category-" + strconv.Itoa(a.CategoryID)
+	}
+	a.ConfigNumber, _ = strconv.Atoi(s.TXT["c#"])
+	sf, err := strconv.Atoi(s.TXT["sf"])
+	a.Paired = err == nil && sf&statusNotPaired == 0
+	return a
+}
@@ -0,0 +1,25 @@
+package homekit
+
+import (
+	"testing"
+
+	"github.com/agisilaos/homepodctl/internal/airplay"
+)
+
+func TestAccessoryFromService(t *testing.T) {
+	got := accessoryFromService(airplay.Service{
+		Instance: "Living Room",
+		Addr:     "192.168.1.30",
+		Port:     51826,
+		TXT:      map[string]string{"id": "ab:cd:ef:01:02:03", "md": "Bridge", "ci": "2", "sf": "0", "c#": "12"},
+	})
+	want := Accessory{Name: "Living Room", ID: "AB:CD:EF:01:02:03", Model: "Bridge", Category: "bridge", CategoryID: 2, Paired: true, ConfigNumber: 12, Addr: "192.168.1.30", Port: 51826}
+	if got != want {
+		t.Fatalf("accessory=%+v, want %+v", got, want)
+	}
+
+	got = accessoryFromService(airplay.Service{Instance: "Plug", Addr: "192.168.1.31", TXT: map[string]string{"ci": "99", "sf": "1"}})
+	if got.Paired || got.Category != "category-99" {
+		t.Fatalf("unexpected accessory: %+v", got)
+	}
+}
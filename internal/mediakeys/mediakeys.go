@@ -0,0 +1,125 @@
+// Package mediakeys sends play/pause, next, and previous to whichever app is
+// feeding the speakers. When the frontmost app is a scriptable player (Music,
+// TV, Spotify) the command goes to it over AppleScript; otherwise
+// it is posted as a system media-key event, which macOS delivers to the app
+// that last played audio, such as a browser tab.
+package mediakeys
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/transport"
+)
+
+// Actions the package sends. PlayPause toggles: the media key has no
+// separate pause, so the players get their playpause command too.
+const (
+	PlayPause = "playpause"
+	Next      = "next"
+	Previous  = "prev"
+)
+
+// Ways an action is delivered.
+const (
+	ViaApp      = "app"
+	ViaMediaKey = "media-key"
+)
+
+// Route is where an action goes: the frontmost app, and whether that app
+// gets it over AppleScript or as a media key.
+type Route struct {
+	Action    string `json:"action"`
+	Frontmost string `json:"frontmost,omitempty"`
+	Via       string `json:"via"` // app|media-key
+}
+
+// playerVerbs are the AppleScript commands of the scriptable players, by
+// application name as System Events reports the frontmost process.
+var playerVerbs = map[string]map[string]string{
+	"Music":   {PlayPause: "playpause", Next: "next track", Previous: "previous track"},
+	"TV":      {PlayPause: "playpause", Next: "next track", Previous: "previous track"},
+	"Spotify": {PlayPause: "playpause", Next: "next track", Previous: "previous track"},
+}
+
+// mediaKeys are the NX_KEYTYPE codes of the media keys.
+var mediaKeys = map[string]int{
+	PlayPause: 16,
+	Next:      17,
+	Previous:  18,
+}
+
+var runOSAScript = func(ctx context.Context, script string, args ...string) ([]byte, error) {
+	return runner.Run(ctx, strings.NewReader(script), "osascript", args...)
+}
+
+// runner runs osascript; see SetTransport.
+var runner transport.Runner = transport.Local{}
+
+// SetTransport runs every script through r.
+func SetTransport(r transport.Runner) {
+	runner = r
+}
+
+func run(ctx context.Context, script string, args ...string) (string, error) {
+	out, err := runOSAScript(ctx, script, args...)
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Frontmost returns the name of the frontmost application.
+func Frontmost(ctx context.Context) (string, error) {
+	return run(ctx, `tell application "System Events" to return name of first application process whose frontmost is true`)
+}
+
+// Resolve picks the route for action from the frontmost application.
+func Resolve(ctx context.Context, action string) (Route, error) {
+	if _, ok := mediaKeys[action]; !ok {
+		return Route{}, fmt.Errorf("invalid media action %q (expected playpause|next|prev)", action)
+	}
+	front, err := Frontmost(ctx)
+	if err != nil {
+		return Route{}, fmt.Errorf("frontmost app: %w", err)
+	}
+	r := Route{Action: action, Frontmost: front, Via: ViaMediaKey}
+	if _, ok := playerVerbs[front]; ok {
+		r.Via = ViaApp
+	}
+	return r, nil
+}
+
+// Send delivers r.
+func Send(ctx context.Context, r Route) error {
+	if r.Via == ViaApp {
+		verb, ok := playerVerbs[r.Frontmost][r.Action]
+		if !ok {
+			return fmt.Errorf("%s cannot %s", r.Frontmost, r.Action)
+		}
+		_, err := run(ctx, fmt.Sprintf("tell application %q to %s", r.Frontmost, verb))
+		return err
+	}
+	key, ok := mediaKeys[r.Action]
+	if !ok {
+		return fmt.Errorf("invalid media action %q (expected playpause|next|prev)", r.Action)
+	}
+	_, err := run(ctx, mediaKeyJXA(key), "-l", "JavaScript")
+	return err
+}
+
+// mediaKeyJXA posts a key-down and key-up system-defined event (subtype 8)
+// for the NX_KEYTYPE key code. Posting events needs the Accessibility
+// permission for the app running homepodctl.
+func mediaKeyJXA(key int) string {
+	return fmt.Sprintf(`ObjC.import('Cocoa');
+[0xa, 0xb].forEach(function (state) {
+	var ev = $.NSEvent.otherEventWithTypeLocationModifierFlagsTimestampWindowNumberContextSubtypeData1Data2(
+		14, $.NSMakePoint(0, 0), state << 8, 0, 0, $(), 8, (%d << 16) | (state << 8), -1);
+	$.CGEventPost(0, ev.CGEvent);
+});`, key)
+}
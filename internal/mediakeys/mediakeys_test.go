@@ -0,0 +1,70 @@
+package mediakeys
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestResolveAndSend(t *testing.T) {
+	origRun := runOSAScript
+	t.Cleanup(func() { runOSAScript = origRun })
+
+	front := "Spotify"
+	var sent []string
+	runOSAScript = func(_ context.Context, script string, args ...string) ([]byte, error) {
+		if strings.Contains(script, "frontmost is true") {
+			return []byte(front + "\n"), nil
+		}
+		sent = append(sent, strings.Join(append(args, script), " "))
+		return nil, nil
+	}
+
+	r, err := Resolve(context.Background(), Next)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if r.Via != ViaApp || r.Frontmost != "Spotify" {
+		t.Fatalf("route=%+v", r)
+	}
+	if err := Send(context.Background(), r); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(sent) != 1 || sent[0] != `tell application "Spotify" to next track` {
+		t.Fatalf("sent=%q", sent)
+	}
+
+	front, sent = "Safari", nil
+	r, err = Resolve(context.Background(), PlayPause)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if r.Via != ViaMediaKey {
+		t.Fatalf("route=%+v", r)
+	}
+	if err := Send(context.Background(), r); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], "-l JavaScript ") || !strings.Contains(sent[0], "(16 << 16)") {
+		t.Fatalf("sent=%q", sent)
+	}
+
+	front, sent = "Music", nil
+	r, err = Resolve(context.Background(), PlayPause)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if err := Send(context.Background(), r); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(sent) != 1 || sent[0] != `tell application "Music" to playpause` {
+		t.Fatalf("sent=%q", sent)
+	}
+
+	if _, err := Resolve(context.Background(), "pause"); err == nil {
+		t.Fatalf("expected error for pause, which the media key cannot do")
+	}
+	if _, err := Resolve(context.Background(), "stop"); err == nil {
+		t.Fatalf("expected error for unknown action")
+	}
+}
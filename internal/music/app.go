@@ -0,0 +1,85 @@
+package music
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// launchWait bounds how long EnsureRunning waits for a launched Music.app
+	// to report itself running.
+	launchWait = 10 * time.Second
+	launchPoll = 250 * time.Millisecond
+)
+
+var (
+	launchHidden = true
+	launchedApp  atomic.Bool
+)
+
+// SetLaunchHidden chooses how EnsureRunning starts Music.app: hidden in the
+// background (the default) or activated in the foreground.
+func SetLaunchHidden(hidden bool) {
+	launchHidden = hidden
+}
+
+// AppRunning reports whether Music.app is running, without launching it.
+func AppRunning(ctx context.Context) (bool, error) {
+	return engine.AppRunning(ctx)
+}
+
+// EnsureRunning launches Music.app when it is not running and waits until it
+// is, so the next call does not fail with "connection is invalid". It reports
+// whether it launched the app.
+func EnsureRunning(ctx context.Context) (bool, error) {
+	running, err := engine.AppRunning(ctx)
+	if err != nil {
+		return false, err
+	}
+	if running {
+		return false, nil
+	}
+	logDebug("launching Music.app", "hidden", launchHidden)
+	if err := engine.LaunchApp(ctx, launchHidden); err != nil {
+		return false, fmt.Errorf("launch Music.app: %w", err)
+	}
+	deadline := time.Now().Add(launchWait)
+	for {
+		if running, err := engine.AppRunning(ctx); err == nil && running {
+			launchedApp.Store(true)
+			return true, nil
+		}
+		if time.Now().After(deadline) {
+			return false, fmt.Errorf("Music.app did not start within %s", launchWait)
+		}
+		if err := sleepWithContextFn(ctx, launchPoll); err != nil {
+			return false, err
+		}
+	}
+}
+
+// Launched reports whether EnsureRunning started Music.app in this process.
+func Launched() bool {
+	return launchedApp.Load()
+}
+
+func (appleScriptEngine) AppRunning(ctx context.Context) (bool, error) {
+	// Outside a tell block, so asking does not launch the app.
+	out, err := runAppleScript(ctx, `return application "Music" is running`)
+	if err != nil {
+		return false, err
+	}
+	return parseBool(out), nil
+}
+
+func (appleScriptEngine) LaunchApp(ctx context.Context, hidden bool) error {
+	script := `tell application "Music" to activate`
+	if hidden {
+		// open -g keeps it in the background, -j launches it hidden.
+		script = `do shell script "open -g -j -a Music"`
+	}
+	_, err := runAppleScript(ctx, script)
+	return err
+}
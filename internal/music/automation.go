@@ -0,0 +1,56 @@
+package music
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// AutomationPermission is the macOS privacy (TCC) state of the Automation
+// permission that lets this process's host app send Apple events to Music.
+type AutomationPermission string
+
+const (
+	AutomationGranted AutomationPermission = "granted"
+	// AutomationDenied is error -1743: the user turned the permission off,
+	// or declined the prompt.
+	AutomationDenied AutomationPermission = "denied"
+	// AutomationUndetermined is error -1744: macOS would ask, but could not
+	// show the prompt (for example over SSH).
+	AutomationUndetermined AutomationPermission = "undetermined"
+	// AutomationUnknown means the call failed for another reason, so the
+	// permission state could not be told.
+	AutomationUnknown AutomationPermission = "unknown"
+)
+
+// ClassifyAutomationError reads the permission state from the error of a
+// Music.app call: nil means granted, and osascript's -1743/-1744 (or their
+// messages) mean denied or undetermined.
+func ClassifyAutomationError(err error) AutomationPermission {
+	if err == nil {
+		return AutomationGranted
+	}
+	msg := strings.ToLower(err.Error())
+	var scriptErr *ScriptError
+	if errors.As(err, &scriptErr) {
+		msg += " " + strings.ToLower(scriptErr.Output)
+	}
+	switch {
+	case strings.Contains(msg, "-1743"),
+		strings.Contains(msg, "not authorised"),
+		strings.Contains(msg, "not authorized"),
+		strings.Contains(msg, "not permitted"):
+		return AutomationDenied
+	case strings.Contains(msg, "-1744"),
+		strings.Contains(msg, "consent"):
+		return AutomationUndetermined
+	}
+	return AutomationUnknown
+}
+
+// ProbeAutomation sends Music.app one read-only Apple event and classifies
+// the result. Callers that must not launch Music.app check AppRunning first.
+func ProbeAutomation(ctx context.Context) (AutomationPermission, error) {
+	_, err := engine.Status(ctx)
+	return ClassifyAutomationError(err), err
+}
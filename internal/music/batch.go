@@ -0,0 +1,298 @@
+package music
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Batch composes several Music.app operations into one osascript run, so a
+// play flow pays the interpreter startup once instead of per operation.
+// Operations run in order and the batch stops at the first failure.
+type Batch struct {
+	ops        []batchOp
+	before     bool
+	nowPlaying bool
+	err        error
+}
+
+type batchOp struct {
+	desc   string
+	script string
+	apply  func(context.Context, Engine) error
+}
+
+// BatchStep reports one operation of a batch run. Operations after a failed
+// one are not attempted and have neither OK nor Error set.
+type BatchStep struct {
+	Op    string `json:"op"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type BatchResult struct {
+	Steps      []BatchStep `json:"steps"`
+	Before     *NowPlaying `json:"before,omitempty"`
+	NowPlaying *NowPlaying `json:"nowPlaying,omitempty"`
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// SetOutputs selects exactly deviceNames as Music.app's AirPlay outputs. An
+// empty list is a no-op, as with SetCurrentAirPlayDevices.
+func (b *Batch) SetOutputs(deviceNames []string) *Batch {
+	if len(deviceNames) == 0 {
+		return b
+	}
+	var refs []string
+	for _, name := range deviceNames {
+		refs = append(refs, fmt.Sprintf(`AirPlay device %s`, QuoteAppleScriptString(name)))
+	}
+	return b.add("set outputs "+strings.Join(deviceNames, ","), selectOutputsScript(strings.Join(refs, ", "), retryPolicy),
+		func(ctx context.Context, e Engine) error { return e.SetCurrentAirPlayDevices(ctx, deviceNames) })
+}
+
+func (b *Batch) SetVolume(deviceName string, volume int) *Batch {
+	if volume < 0 || volume > 100 {
+		if b.err == nil {
+			b.err = fmt.Errorf("volume must be 0-100")
+		}
+		return b
+	}
+	return b.add(fmt.Sprintf("set volume %s=%d", deviceName, volume), fmt.Sprintf(`set sound volume of (AirPlay device %s) to %d`, QuoteAppleScriptString(deviceName), volume),
+		func(ctx context.Context, e Engine) error { return e.SetAirPlayDeviceVolume(ctx, deviceName, volume) })
+}
+
+// SetSoundVolume sets Music.app's master volume.
+func (b *Batch) SetSoundVolume(volume int) *Batch {
+	if volume < 0 || volume > 100 {
+		if b.err == nil {
+			b.err = fmt.Errorf("volume must be 0-100")
+		}
+		return b
+	}
+	return b.add(fmt.Sprintf("set sound volume %d", volume), fmt.Sprintf(`set sound volume to %d`, volume),
+		func(ctx context.Context, e Engine) error { return e.SetSoundVolume(ctx, volume) })
+}
+
+func (b *Batch) SetShuffle(enabled bool) *Batch {
+	return b.add("set shuffle "+strconv.FormatBool(enabled), fmt.Sprintf(`set shuffle enabled to %t`, enabled),
+		func(ctx context.Context, e Engine) error { return e.SetShuffleEnabled(ctx, enabled) })
+}
+
+func (b *Batch) PlayPlaylist(persistentID string) *Batch {
+	persistentID = strings.TrimSpace(persistentID)
+	if persistentID == "" {
+		if b.err == nil {
+			b.err = fmt.Errorf("persistentID is required")
+		}
+		return b
+	}
+	return b.add("play playlist "+persistentID, fmt.Sprintf(`play (some user playlist whose persistent ID is %s)`, QuoteAppleScriptString(persistentID)),
+		func(ctx context.Context, e Engine) error { return e.PlayPlaylist(ctx, persistentID) })
+}
+
+// PlayPlaylistTrack starts a playlist at its index-th (1-based) track, like
+// PlayUserPlaylistTrack.
+func (b *Batch) PlayPlaylistTrack(persistentID string, index int) *Batch {
+	persistentID = strings.TrimSpace(persistentID)
+	if persistentID == "" || index < 1 {
+		if b.err == nil {
+			b.err = fmt.Errorf("persistentID and a track index of 1 or more are required")
+		}
+		return b
+	}
+	return b.add(fmt.Sprintf("play playlist %s track %d", persistentID, index), playPlaylistTrackScript(persistentID, index),
+		func(ctx context.Context, e Engine) error { return e.PlayPlaylistTrack(ctx, persistentID, index) })
+}
+
+// PlayStation starts a radio station, like PlayStation.
+func (b *Batch) PlayStation(persistentID string) *Batch {
+	persistentID = strings.TrimSpace(persistentID)
+	if persistentID == "" {
+		if b.err == nil {
+			b.err = fmt.Errorf("persistentID is required")
+		}
+		return b
+	}
+	return b.add("play station "+persistentID, playStationScript(persistentID),
+		func(ctx context.Context, e Engine) error { return e.PlayStation(ctx, persistentID) })
+}
+
+// Seek moves the player position of the current track to seconds.
+func (b *Batch) Seek(seconds float64) *Batch {
+	if seconds < 0 {
+		if b.err == nil {
+			b.err = fmt.Errorf("position must be >= 0")
+		}
+		return b
+	}
+	pos := strconv.FormatFloat(seconds, 'f', -1, 64)
+	return b.add("seek "+pos, "set player position to "+pos,
+		func(ctx context.Context, e Engine) error { return e.SetPlayerPosition(ctx, seconds) })
+}
+
+// Pause pauses the player, keeping the current track and position.
+func (b *Batch) Pause() *Batch {
+	return b.add("pause", "pause",
+		func(ctx context.Context, e Engine) error { return e.Pause(ctx) })
+}
+
+// Play resumes the current track.
+func (b *Batch) Play() *Batch {
+	return b.add("play", "play",
+		func(ctx context.Context, e Engine) error { return e.Play(ctx) })
+}
+
+// NowPlaying reads the player state and selected outputs after the other
+// operations, like GetNowPlaying. A failed read leaves
+// BatchResult.NowPlaying nil without failing the batch.
+func (b *Batch) NowPlaying() *Batch {
+	b.nowPlaying = true
+	return b
+}
+
+// Before reads the player state and selected outputs ahead of the other
+// operations, in the same run, into BatchResult.Before. Like NowPlaying, a
+// failed read leaves it nil without failing the batch.
+func (b *Batch) Before() *Batch {
+	b.before = true
+	return b
+}
+
+// Ops describes the queued operations in run order.
+func (b *Batch) Ops() []string {
+	out := make([]string, 0, len(b.ops))
+	for _, op := range b.ops {
+		out = append(out, op.desc)
+	}
+	return out
+}
+
+func (b *Batch) add(desc, script string, apply func(context.Context, Engine) error) *Batch {
+	b.ops = append(b.ops, batchOp{desc: desc, script: script, apply: apply})
+	return b
+}
+
+func (b *Batch) newResult() BatchResult {
+	res := BatchResult{Steps: make([]BatchStep, len(b.ops))}
+	for i, op := range b.ops {
+		res.Steps[i].Op = op.desc
+	}
+	return res
+}
+
+func (b *Batch) script() string {
+	var sb strings.Builder
+	sb.WriteString("\ntell application \"Music\"\n\tset out to \"\"\n")
+	if b.before {
+		writeNowPlayingRead(&sb, "before", "bdev")
+	}
+	for _, op := range b.ops {
+		fmt.Fprintf(&sb, "\ttry\n\t\t%s\n\t\tset out to out & \"ok\" & linefeed\n\ton error errMsg\n\t\treturn out & \"error\" & tab & errMsg & linefeed\n\tend try\n", op.script)
+	}
+	if b.nowPlaying {
+		writeNowPlayingRead(&sb, "np", "dev")
+	}
+	sb.WriteString("\treturn out\nend tell\n")
+	return sb.String()
+}
+
+// writeNowPlayingRead adds a now-playing read to a batch script: one line
+// tagged npTag, then one tagged devTag per selected output.
+func writeNowPlayingRead(sb *strings.Builder, npTag, devTag string) {
+	sb.WriteString("\ttry")
+	sb.WriteString(nowPlayingFields)
+	fmt.Fprintf(sb, "\t\tset out to out & %q & tab & npLine & linefeed\n", npTag)
+	fmt.Fprintf(sb, "\t\trepeat with d in (every AirPlay device)\n\t\t\tif selected of d then set out to out & %q & tab & %s & linefeed\n\t\tend repeat\n", devTag, airPlayDeviceFields)
+	sb.WriteString("\tend try\n")
+}
+
+// Run executes the batch through the current engine; the AppleScript engine
+// makes a single osascript call. A failed operation is returned as a
+// *ScriptError naming the operation.
+func (b *Batch) Run(ctx context.Context) (BatchResult, error) {
+	if b.err != nil {
+		return b.newResult(), b.err
+	}
+	if len(b.ops) == 0 && !b.nowPlaying && !b.before {
+		return b.newResult(), nil
+	}
+	// Batches usually change outputs or volumes.
+	defer invalidateDeviceCache()
+	return engine.RunBatch(ctx, b)
+}
+
+// RunBatchSteps runs b one operation at a time through e's own methods, with
+// the same stop-at-first-failure result as a native batch.
+func RunBatchSteps(ctx context.Context, e Engine, b *Batch) (BatchResult, error) {
+	res := b.newResult()
+	if b.before {
+		if np, err := e.NowPlaying(ctx); err == nil {
+			res.Before = &np
+		}
+	}
+	for i, op := range b.ops {
+		if err := op.apply(ctx, e); err != nil {
+			res.Steps[i].Error = err.Error()
+			return res, &ScriptError{Err: errors.New(op.desc), Output: err.Error()}
+		}
+		res.Steps[i].OK = true
+	}
+	if b.nowPlaying {
+		if np, err := e.NowPlaying(ctx); err == nil {
+			res.NowPlaying = &np
+		}
+	}
+	return res, nil
+}
+
+func (appleScriptEngine) RunBatch(ctx context.Context, b *Batch) (BatchResult, error) {
+	res := b.newResult()
+	out, err := runAppleScript(ctx, b.script())
+	if err != nil {
+		return res, err
+	}
+
+	next := 0
+	var np *NowPlaying
+	for _, line := range splitNonEmptyLines(out) {
+		kind, rest, _ := strings.Cut(line, "\t")
+		switch strings.TrimSpace(kind) {
+		case "ok":
+			if next < len(res.Steps) {
+				res.Steps[next].OK = true
+				next++
+			}
+		case "error":
+			if next < len(res.Steps) {
+				res.Steps[next].Error = strings.TrimSpace(rest)
+				step := res.Steps[next]
+				return res, &ScriptError{Err: errors.New(step.Op), Output: step.Error}
+			}
+		case "before":
+			parsed := parseNowPlaying(rest)
+			res.Before = &parsed
+		case "bdev":
+			if res.Before != nil {
+				res.Before.Outputs = append(res.Before.Outputs, parseAirPlayDevice(rest))
+			}
+		case "np":
+			parsed := parseNowPlaying(rest)
+			np = &parsed
+		case "dev":
+			if np != nil {
+				np.Outputs = append(np.Outputs, parseAirPlayDevice(rest))
+			}
+		}
+	}
+	if next < len(res.Steps) {
+		return res, fmt.Errorf("batch returned %d of %d step results", next, len(res.Steps))
+	}
+	res.NowPlaying = np
+	return res, nil
+}
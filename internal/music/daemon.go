@@ -0,0 +1,138 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/transport"
+)
+
+// daemonScriptTimeout bounds one script on the daemon side; clients that give
+// up sooner close their connection, which cancels the script.
+const daemonScriptTimeout = 2 * time.Minute
+
+// The daemon protocol is one JSON line each way per connection. An empty
+// script is a ping.
+type daemonRequest struct {
+	Script string `json:"script"`
+}
+
+type daemonResponse struct {
+	OK     bool   `json:"ok"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var daemonSocket string
+
+// errDaemonUnavailable means nothing accepted the connection, so running the
+// script locally instead cannot run it twice.
+var errDaemonUnavailable = errors.New("daemon unavailable")
+
+// UseDaemon sends scripts to the daemon listening on socketPath, falling
+// back to osascript whenever it cannot be reached. An empty path disables it.
+func UseDaemon(socketPath string) {
+	daemonSocket = socketPath
+}
+
+// ServeDaemon answers script requests on ln through w until ln is closed.
+func ServeDaemon(ln net.Listener, w *Worker) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serveDaemonConn(conn, w)
+	}
+}
+
+func serveDaemonConn(conn net.Conn, w *Worker) {
+	defer conn.Close()
+	var req daemonRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	resp := daemonResponse{OK: true}
+	if req.Script != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), daemonScriptTimeout)
+		defer cancel()
+		// The client sends nothing after its request, so a read only returns
+		// once it hangs up.
+		go func() {
+			var b [1]byte
+			_, _ = conn.Read(b[:])
+			cancel()
+		}()
+		out, err := w.Run(ctx, req.Script)
+		resp.Output = string(out)
+		if err != nil {
+			resp.OK = false
+			resp.Error = err.Error()
+		}
+	}
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// PingDaemon checks that a daemon answers on socketPath and returns the
+// round-trip time.
+func PingDaemon(ctx context.Context, socketPath string) (time.Duration, error) {
+	start := time.Now()
+	if _, err := daemonExec(ctx, socketPath, ""); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// execScript runs script through the daemon when one is configured and
+// reachable, otherwise through a fresh osascript process. via names the path
+// taken, for logging.
+func execScript(ctx context.Context, script string) (out []byte, via string, err error) {
+	if daemonSocket != "" && !transport.IsRemote(runner) {
+		out, err := daemonExec(ctx, daemonSocket, script)
+		if !errors.Is(err, errDaemonUnavailable) {
+			return out, "daemon", err
+		}
+	}
+	out, err = runAppleScriptExec(ctx, script)
+	if transport.IsRemote(runner) {
+		return out, runner.String(), err
+	}
+	return out, "osascript", err
+}
+
+func daemonExec(ctx context.Context, socketPath, script string) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(daemonRequest{Script: script}); err != nil {
+		return nil, daemonConnErr(ctx, err)
+	}
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, daemonConnErr(ctx, err)
+	}
+	if !resp.OK {
+		return []byte(resp.Output), errors.New(resp.Error)
+	}
+	return []byte(resp.Output), nil
+}
+
+func daemonConnErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("daemon: %w", err)
+}
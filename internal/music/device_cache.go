@@ -0,0 +1,111 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// DefaultDeviceCacheTTL is how long a cached device list is served to device
+// listings. Availability and selection change often, so it is short.
+const DefaultDeviceCacheTTL = 30 * time.Second
+
+const deviceCacheVersion = 1
+
+type deviceCacheFile struct {
+	Version  int             `json:"version"`
+	CachedAt time.Time       `json:"cachedAt"`
+	Devices  []AirPlayDevice `json:"devices"`
+}
+
+var (
+	deviceCachePath string
+	deviceCacheTTL  = DefaultDeviceCacheTTL
+)
+
+// SetDeviceCache stores every AirPlay device list read from Music.app at path
+// and lets CachedAirPlayDevices serve it for up to ttl. An empty path
+// disables the cache.
+func SetDeviceCache(path string, ttl time.Duration) {
+	deviceCachePath = path
+	if ttl <= 0 {
+		ttl = DefaultDeviceCacheTTL
+	}
+	deviceCacheTTL = ttl
+}
+
+// ListAirPlayDevicesCached lists AirPlay devices for display, serving the
+// cache while it is fresh. cachedAt is when the list was read from Music.app.
+// Anything that acts on devices should call ListAirPlayDevices instead.
+func ListAirPlayDevicesCached(ctx context.Context) (devices []AirPlayDevice, cachedAt time.Time, err error) {
+	if c, ok := readDeviceCache(); ok && time.Since(c.CachedAt) < deviceCacheTTL {
+		logDebug("device cache hit", "age", time.Since(c.CachedAt).Round(time.Second).String())
+		return c.Devices, c.CachedAt, nil
+	}
+	return RefreshDeviceCache(ctx)
+}
+
+// RefreshDeviceCache reads the devices from Music.app, rewriting the cache.
+func RefreshDeviceCache(ctx context.Context) ([]AirPlayDevice, time.Time, error) {
+	devices, err := ListAirPlayDevices(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return devices, time.Now().UTC(), nil
+}
+
+// CachedAirPlayDevices returns the cached device list without asking
+// Music.app, however old it is; ok is false when there is no usable cache.
+func CachedAirPlayDevices() (devices []AirPlayDevice, cachedAt time.Time, ok bool) {
+	c, ok := readDeviceCache()
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	return c.Devices, c.CachedAt, true
+}
+
+// ClearDeviceCache deletes the cache file. A missing file is not an error.
+func ClearDeviceCache() error {
+	if deviceCachePath == "" {
+		return nil
+	}
+	if err := os.Remove(deviceCachePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func readDeviceCache() (deviceCacheFile, bool) {
+	var c deviceCacheFile
+	if deviceCachePath == "" {
+		return c, false
+	}
+	b, err := os.ReadFile(deviceCachePath)
+	if err != nil {
+		return c, false
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.Version != deviceCacheVersion {
+		return c, false
+	}
+	return c, true
+}
+
+// storeDeviceCache records a fresh device list; failures only cost a cache
+// miss later.
+func storeDeviceCache(devices []AirPlayDevice) {
+	if deviceCachePath == "" {
+		return
+	}
+	if err := writeCacheFile(deviceCachePath, deviceCacheFile{Version: deviceCacheVersion, CachedAt: time.Now().UTC(), Devices: devices}); err != nil {
+		logDebug("device cache write failed", "error", err.Error())
+	}
+}
+
+// invalidateDeviceCache drops the cache after a change to the outputs or
+// their volumes, so the next listing asks Music.app.
+func invalidateDeviceCache() {
+	if err := ClearDeviceCache(); err != nil {
+		logDebug("device cache clear failed", "error", err.Error())
+	}
+}
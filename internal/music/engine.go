@@ -0,0 +1,114 @@
+package music
+
+import (
+	"context"
+	"time"
+)
+
+// Engine performs Music.app operations. The package-level functions validate
+// their arguments and delegate here, so swapping the engine (see SetEngine and
+// the musictest package) moves every caller without touching call sites.
+//
+// The AppleScript engine parses tab-separated osascript output; the JXA engine
+// returns JSON for reads and uses AppleScript for everything else, and when a
+// JXA call fails.
+type Engine interface {
+	// AppRunning reports whether Music.app is running without launching it;
+	// LaunchApp starts it, in the background when hidden is set.
+	AppRunning(ctx context.Context) (bool, error)
+	LaunchApp(ctx context.Context, hidden bool) error
+
+	ListAirPlayDevices(ctx context.Context) ([]AirPlayDevice, error)
+	SetCurrentAirPlayDevices(ctx context.Context, deviceNames []string) error
+	SetAirPlayDeviceVolume(ctx context.Context, deviceName string, volume int) error
+	// SetSoundVolume sets Music.app's master volume, the in-app slider.
+	SetSoundVolume(ctx context.Context, volume int) error
+
+	SetShuffleEnabled(ctx context.Context, enabled bool) error
+	SetShuffleMode(ctx context.Context, mode string) error
+	SetSongRepeat(ctx context.Context, mode string) error
+	// SetCrossfade crossfades songs for seconds, or turns crossfading off
+	// when seconds is 0.
+	SetCrossfade(ctx context.Context, seconds int) error
+	SetPlayerPosition(ctx context.Context, seconds float64) error
+
+	// ListEQPresets returns Music.app's EQ presets, marking the current one;
+	// SetEQPreset selects the preset named exactly name and turns the EQ on.
+	ListEQPresets(ctx context.Context) ([]EQPreset, error)
+	SetEQPreset(ctx context.Context, name string) error
+
+	SetCurrentTrackLoved(ctx context.Context, loved bool) error
+	SetCurrentTrackDisliked(ctx context.Context, disliked bool) error
+	SetCurrentTrackRating(ctx context.Context, stars int) error
+	ExportCurrentArtwork(ctx context.Context, path string) (string, error)
+	CurrentLyrics(ctx context.Context) (string, error)
+	// PlaySpeech speaks text with say (in voice, or the system voice when
+	// empty) into an audio file and plays it, returning its length in
+	// seconds.
+	PlaySpeech(ctx context.Context, text, voice string) (float64, error)
+	// RemoveSpeech deletes the track and file PlaySpeech played.
+	RemoveSpeech(ctx context.Context) error
+
+	// ListUserPlaylists returns every user playlist, unfiltered and uncached.
+	ListUserPlaylists(ctx context.Context) ([]UserPlaylist, error)
+	// PlaylistPlayCounts returns every regular playlist with Plays set to the
+	// summed play count of its tracks, zero included.
+	PlaylistPlayCounts(ctx context.Context) ([]UserPlaylist, error)
+	// PlaylistsLastAdded returns, by persistent ID, when a track was last
+	// added to each user playlist that has tracks.
+	PlaylistsLastAdded(ctx context.Context) (map[string]time.Time, error)
+	PlaylistName(ctx context.Context, persistentID string) (string, error)
+	PlayPlaylist(ctx context.Context, persistentID string) error
+	// ListPlaylistTracks returns a playlist's tracks in playlist order;
+	// PlayPlaylistTrack starts the playlist at its index-th (1-based) track.
+	ListPlaylistTracks(ctx context.Context, persistentID string) ([]PlaylistTrack, error)
+	PlayPlaylistTrack(ctx context.Context, persistentID string, index int) error
+	CreateUserPlaylist(ctx context.Context, name string) (UserPlaylist, error)
+	AddTrackToUserPlaylist(ctx context.Context, playlistID, trackID string) error
+	RemoveTrackFromUserPlaylist(ctx context.Context, playlistID, trackID string) (int, error)
+	ClearUserPlaylist(ctx context.Context, playlistID string) error
+	// SearchTracks returns the library tracks matching query; only is the
+	// Music.app search scope (songs, albums, or artists).
+	SearchTracks(ctx context.Context, query, only string) ([]LibraryItem, error)
+	// ListStations returns the library's URL tracks and the radio tuner's
+	// stations; PlayStation plays one of them.
+	ListStations(ctx context.Context) ([]Station, error)
+	PlayStation(ctx context.Context, persistentID string) error
+
+	Play(ctx context.Context) error
+	PlayPause(ctx context.Context) error
+	Pause(ctx context.Context) error
+	Stop(ctx context.Context) error
+	NextTrack(ctx context.Context) error
+	PreviousTrack(ctx context.Context) error
+
+	Status(ctx context.Context) (Status, error)
+	NowPlaying(ctx context.Context) (NowPlaying, error)
+	// RunBatch runs a validated, non-empty batch. Engines without a native
+	// batch path can use RunBatchSteps.
+	RunBatch(ctx context.Context, b *Batch) (BatchResult, error)
+}
+
+var engine Engine = appleScriptEngine{}
+
+// SetEngine selects the engine behind the package-level functions. A nil
+// engine restores the AppleScript engine.
+func SetEngine(e Engine) {
+	if e == nil {
+		e = appleScriptEngine{}
+	}
+	engine = e
+}
+
+// CurrentEngine returns the engine the package-level functions use.
+func CurrentEngine() Engine {
+	return engine
+}
+
+// AppleScriptEngine returns the engine that parses tab-separated AppleScript
+// output.
+func AppleScriptEngine() Engine {
+	return appleScriptEngine{}
+}
+
+type appleScriptEngine struct{}
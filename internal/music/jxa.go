@@ -0,0 +1,188 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jxaPrelude is shared by the JXA scripts. Collection properties are read in
+// bulk (one Apple event per property, not per item), and get/bulk turn
+// missing values into defaults instead of errors.
+const jxaPrelude = `
+const m = Application('Music');
+const get = (f, d) => { try { const v = f(); return v === undefined || v === null ? d : v; } catch (e) { return d; } };
+const bulk = (f) => get(f, []);
+function devices() {
+	const ds = m.airplayDevices;
+	const names = bulk(() => ds.name());
+	const kind = bulk(() => ds.kind());
+	const available = bulk(() => ds.available());
+	const selected = bulk(() => ds.selected());
+	const active = bulk(() => ds.active());
+	const volume = bulk(() => ds.soundVolume());
+	const addr = bulk(() => ds.networkAddress());
+	const pid = bulk(() => ds.persistentID());
+	return names.map((name, i) => ({
+		name: name,
+		kind: String(get(() => kind[i], '')),
+		available: !!available[i],
+		selected: !!selected[i],
+		active: !!active[i],
+		volume: get(() => volume[i], 0),
+		networkAddress: String(get(() => addr[i], '')),
+		persistentID: String(get(() => pid[i], '')),
+	}));
+}
+`
+
+const jxaDevicesScript = jxaPrelude + `JSON.stringify(devices());`
+
+const jxaPlaylistsScript = jxaPrelude + `
+const ps = m.userPlaylists;
+const ids = bulk(() => ps.persistentID());
+const names = bulk(() => ps.name());
+const smart = bulk(() => ps.smart());
+const genius = bulk(() => ps.genius());
+const duration = bulk(() => ps.duration());
+JSON.stringify(ids.map((id, i) => {
+	const p = ps[i];
+	return {
+		persistentID: id,
+		name: names[i],
+		smart: !!smart[i],
+		genius: !!genius[i],
+		trackCount: get(() => p.tracks.length, 0),
+		durationSeconds: get(() => duration[i], 0),
+		folder: String(get(() => p.parent.name(), '')),
+	};
+}));
+`
+
+const jxaPlaylistsLastAddedScript = jxaPrelude + `
+const ps = m.userPlaylists;
+const ids = bulk(() => ps.persistentID());
+const out = {};
+ids.forEach((id, i) => {
+	const added = bulk(() => ps[i].tracks.dateAdded()).map((d) => (d ? d.getTime() : 0));
+	const newest = added.length ? Math.max(...added) : 0;
+	if (newest) out[id] = new Date(newest).toISOString();
+});
+JSON.stringify(out);
+`
+
+const jxaNowPlayingScript = jxaPrelude + `
+const np = {
+	playerState: String(get(() => m.playerState(), '')),
+	playerPositionSeconds: get(() => m.playerPosition(), 0),
+	shuffleEnabled: !!get(() => m.shuffleEnabled(), false),
+	songRepeat: String(get(() => m.songRepeat(), '')),
+	track: {durationSeconds: 0},
+	outputs: devices().filter((d) => d.selected),
+};
+const p = get(() => m.currentPlaylist(), null);
+if (p) {
+	np.playlistName = get(() => p.name(), '');
+	np.playlistPersistentID = get(() => p.persistentID(), '');
+	np.playlistClass = String(get(() => p.class(), ''));
+}
+const t = get(() => m.currentTrack(), null);
+if (t) {
+	np.track = {
+		name: get(() => t.name(), ''),
+		artist: get(() => t.artist(), ''),
+		album: get(() => t.album(), ''),
+		durationSeconds: get(() => t.duration(), 0),
+		persistentID: get(() => t.persistentID(), ''),
+	};
+	np.trackClass = String(get(() => t.class(), ''));
+}
+JSON.stringify(np);
+`
+
+// JXAEngine returns an engine that reads devices, playlists, and now playing
+// through JavaScript for Automation and decodes its JSON output, so names
+// containing tabs or newlines survive intact. A failed JXA read is retried
+// once through the AppleScript engine, which also handles every other
+// operation.
+func JXAEngine() Engine {
+	return jxaEngine{Engine: appleScriptEngine{}}
+}
+
+type jxaEngine struct {
+	Engine // fallback, and everything without a JXA script
+}
+
+func (e jxaEngine) ListAirPlayDevices(ctx context.Context) ([]AirPlayDevice, error) {
+	var devices []AirPlayDevice
+	if err := runJXA(ctx, jxaDevicesScript, &devices); err != nil {
+		if !e.shouldFallBack(ctx, "devices", err) {
+			return nil, err
+		}
+		return e.Engine.ListAirPlayDevices(ctx)
+	}
+	return devices, nil
+}
+
+func (e jxaEngine) ListUserPlaylists(ctx context.Context) ([]UserPlaylist, error) {
+	var playlists []UserPlaylist
+	if err := runJXA(ctx, jxaPlaylistsScript, &playlists); err != nil {
+		if !e.shouldFallBack(ctx, "playlists", err) {
+			return nil, err
+		}
+		return e.Engine.ListUserPlaylists(ctx)
+	}
+	return playlists, nil
+}
+
+func (e jxaEngine) PlaylistsLastAdded(ctx context.Context) (map[string]time.Time, error) {
+	var added map[string]time.Time
+	if err := runJXA(ctx, jxaPlaylistsLastAddedScript, &added); err != nil {
+		if !e.shouldFallBack(ctx, "playlist dates", err) {
+			return nil, err
+		}
+		return e.Engine.PlaylistsLastAdded(ctx)
+	}
+	return added, nil
+}
+
+func (e jxaEngine) NowPlaying(ctx context.Context) (NowPlaying, error) {
+	var out struct {
+		NowPlaying
+		PlaylistClass string `json:"playlistClass"`
+		TrackClass    string `json:"trackClass"`
+	}
+	if err := runJXA(ctx, jxaNowPlayingScript, &out); err != nil {
+		if !e.shouldFallBack(ctx, "now playing", err) {
+			return NowPlaying{}, err
+		}
+		return e.Engine.NowPlaying(ctx)
+	}
+	np := out.NowPlaying
+	np.Source = playbackSource(out.PlaylistClass, out.TrackClass, np.PlaylistName, np.Track)
+	return np, nil
+}
+
+func (e jxaEngine) shouldFallBack(ctx context.Context, what string, err error) bool {
+	if e.Engine == nil || ctx.Err() != nil {
+		return false
+	}
+	logDebug("jxa failed, falling back to applescript", "call", what, "error", err.Error())
+	return true
+}
+
+// runJXA runs js through AppleScript's `run script ... in "JavaScript"`, so
+// JXA shares retries, timeouts, logging, and the daemon with AppleScript, and
+// decodes the JSON it returns into v.
+func runJXA(ctx context.Context, js string, v any) error {
+	out, err := runAppleScript(ctx, "run script "+QuoteAppleScriptString(js)+` in "JavaScript"`)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), v); err != nil {
+		return fmt.Errorf("decode JXA output: %w", err)
+	}
+	return nil
+}
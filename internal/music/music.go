@@ -2,14 +2,18 @@ package music
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"os/exec"
+	"log/slog"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+
+	"github.com/agisilaos/homepodctl/internal/transport"
 )
 
 type AirPlayDevice struct {
@@ -24,10 +28,31 @@ type AirPlayDevice struct {
 }
 
 type UserPlaylist struct {
-	PersistentID string `json:"persistentID"`
-	Name         string `json:"name"`
-	Smart        bool   `json:"smart"`
-	Genius       bool   `json:"genius"`
+	PersistentID string  `json:"persistentID"`
+	Name         string  `json:"name"`
+	Smart        bool    `json:"smart"`
+	Genius       bool    `json:"genius"`
+	Plays        int     `json:"plays,omitempty"`
+	TrackCount   int     `json:"trackCount,omitempty"`
+	DurationS    float64 `json:"durationSeconds,omitempty"`
+	Folder       string  `json:"folder,omitempty"` // name of the parent folder
+	// Modified is when a track was last added to the playlist; Music.app
+	// keeps no modification date for playlists themselves. Reading it means
+	// reading every track's date, so listings leave it unset and
+	// FillPlaylistModified sets it on demand.
+	Modified *time.Time `json:"modified,omitempty"`
+}
+
+// LibraryItem is one library search hit. Track hits carry the track's
+// persistent ID; album and artist hits group the matching tracks.
+type LibraryItem struct {
+	Kind         string   `json:"kind"` // track|album|artist
+	PersistentID string   `json:"persistentID,omitempty"`
+	Name         string   `json:"name"`
+	Artist       string   `json:"artist,omitempty"`
+	Album        string   `json:"album,omitempty"`
+	DurationS    float64  `json:"durationSeconds,omitempty"`
+	TrackIDs     []string `json:"trackIDs,omitempty"`
 }
 
 type Status struct {
@@ -44,10 +69,70 @@ type NowPlaying struct {
 	SongRepeat      string          `json:"songRepeat"`
 	PlaylistName    string          `json:"playlistName,omitempty"`
 	PlaylistID      string          `json:"playlistPersistentID,omitempty"`
+	Source          string          `json:"source,omitempty"` // playlist|album|radio|library|cd|none|unknown
 	Track           NowPlayingTrack `json:"track"`
 	Outputs         []AirPlayDevice `json:"outputs"`
 }
 
+// Playback sources reported in NowPlaying.Source. Music.app never sees audio
+// that another device AirPlays straight to a receiver, so that shows up as
+// SourceNone (or whatever Music.app last played).
+const (
+	SourcePlaylist = "playlist"
+	SourceAlbum    = "album"
+	SourceRadio    = "radio"
+	SourceLibrary  = "library"
+	SourceCD       = "cd"
+	SourceNone     = "none"
+	SourceUnknown  = "unknown"
+)
+
+// playbackSource derives NowPlaying.Source from the classes of the current
+// playlist and track, which AppleScript spells "user playlist" and JXA
+// "userPlaylist". Playing an album makes the current playlist a plain
+// playlist named after the album; a user or library playlist that happens to
+// share the album's name is still reported as such.
+func playbackSource(playlistClass, trackClass, playlistName string, track NowPlayingTrack) string {
+	norm := func(s string) string { return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), " ", "")) }
+	pc, tc := norm(playlistClass), norm(trackClass)
+	switch {
+	case pc == "" && tc == "":
+		return SourceNone
+	case pc == "radiotunerplaylist" || tc == "urltrack":
+		return SourceRadio
+	case pc == "audiocdplaylist" || tc == "audiocdtrack":
+		return SourceCD
+	case pc == "playlist" && track.Album != "" && strings.EqualFold(strings.TrimSpace(playlistName), strings.TrimSpace(track.Album)):
+		return SourceAlbum
+	case pc == "libraryplaylist":
+		return SourceLibrary
+	case pc == "userplaylist" || pc == "subscriptionplaylist" || pc == "playlist":
+		return SourcePlaylist
+	default:
+		return SourceUnknown
+	}
+}
+
+// DeviceType maps an AirPlay device kind as Music.app reports it ("HomePod",
+// "Apple TV", "computer", ... or JXA's "homePod", "appleTV") to homepod, tv,
+// mac, speaker, bluetooth, or unknown.
+func DeviceType(kind string) string {
+	switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(kind), " ", "")) {
+	case "homepod":
+		return "homepod"
+	case "appletv":
+		return "tv"
+	case "computer":
+		return "mac"
+	case "airportexpress", "airplaydevice":
+		return "speaker"
+	case "bluetoothdevice":
+		return "bluetooth"
+	default:
+		return "unknown"
+	}
+}
+
 type NowPlayingTrack struct {
 	Name         string  `json:"name,omitempty"`
 	Artist       string  `json:"artist,omitempty"`
@@ -63,25 +148,58 @@ type ScriptError struct {
 
 var (
 	runAppleScriptExec = func(ctx context.Context, script string) ([]byte, error) {
-		cmd := exec.CommandContext(ctx, "osascript")
-		cmd.Stdin = strings.NewReader(script)
-		return cmd.CombinedOutput()
+		return runner.Run(ctx, strings.NewReader(script), "osascript")
 	}
 	sleepWithContextFn = sleepWithContext
+	scriptTimeout      time.Duration
+	logger             *slog.Logger
 )
 
+// runner runs the backend programs; see SetTransport.
+var runner transport.Runner = transport.Local{}
+
+// SetLogger records each osascript call (script hash, duration, result) at
+// debug level on l. A nil logger disables the records.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// SetTransport runs every script through r, e.g. on another Mac over SSH.
+// The daemon is only used with the local transport.
+func SetTransport(r transport.Runner) {
+	runner = r
+}
+
+// SetScriptTimeout bounds each osascript attempt to d (zero means only the
+// caller's context applies). A timed-out attempt is not retried.
+func SetScriptTimeout(d time.Duration) {
+	scriptTimeout = d
+}
+
 func (e *ScriptError) Error() string {
 	return fmt.Sprintf("osascript failed: %v: %s", e.Err, e.Output)
 }
 
 func (e *ScriptError) Unwrap() error { return e.Err }
 
+// airPlayDeviceFields is the AppleScript expression for one AirPlay device d
+// as a tab-separated line; parseAirPlayDevice reads it back.
+const airPlayDeviceFields = `(name of d) & tab & (kind of d as text) & tab & (available of d as text) & tab & (selected of d as text) & tab & (active of d as text) & tab & (sound volume of d as text) & tab & (network address of d as text) & tab & (persistent ID of d as text)`
+
 func ListAirPlayDevices(ctx context.Context) ([]AirPlayDevice, error) {
+	devices, err := engine.ListAirPlayDevices(ctx)
+	if err == nil {
+		storeDeviceCache(devices)
+	}
+	return devices, err
+}
+
+func (appleScriptEngine) ListAirPlayDevices(ctx context.Context) ([]AirPlayDevice, error) {
 	out, err := runAppleScript(ctx, `
 tell application "Music"
 	set out to ""
 	repeat with d in (every AirPlay device)
-		set out to out & (name of d) & tab & (kind of d as text) & tab & (available of d as text) & tab & (selected of d as text) & tab & (active of d as text) & tab & (sound volume of d as text) & tab & (network address of d as text) & tab & (persistent ID of d as text) & linefeed
+		set out to out & `+airPlayDeviceFields+` & linefeed
 	end repeat
 	return out
 end tell
@@ -91,38 +209,47 @@ end tell
 	}
 	var devices []AirPlayDevice
 	for _, line := range splitNonEmptyLines(out) {
-		parts := strings.Split(line, "\t")
-		for len(parts) < 8 {
-			parts = append(parts, "")
-		}
-		vol, _ := strconv.Atoi(strings.TrimSpace(parts[5]))
-		devices = append(devices, AirPlayDevice{
-			Name:           strings.TrimSpace(parts[0]),
-			Kind:           strings.TrimSpace(parts[1]),
-			Available:      parseBool(parts[2]),
-			Selected:       parseBool(parts[3]),
-			Active:         parseBool(parts[4]),
-			Volume:         vol,
-			NetworkAddress: strings.TrimSpace(parts[6]),
-			PersistentID:   strings.TrimSpace(parts[7]),
-		})
+		devices = append(devices, parseAirPlayDevice(line))
 	}
 	return devices, nil
 }
 
+func parseAirPlayDevice(line string) AirPlayDevice {
+	parts := strings.Split(line, "\t")
+	for len(parts) < 8 {
+		parts = append(parts, "")
+	}
+	vol, _ := strconv.Atoi(strings.TrimSpace(parts[5]))
+	return AirPlayDevice{
+		Name:           strings.TrimSpace(parts[0]),
+		Kind:           strings.TrimSpace(parts[1]),
+		Available:      parseBool(parts[2]),
+		Selected:       parseBool(parts[3]),
+		Active:         parseBool(parts[4]),
+		Volume:         vol,
+		NetworkAddress: strings.TrimSpace(parts[6]),
+		PersistentID:   strings.TrimSpace(parts[7]),
+	}
+}
+
 func SetCurrentAirPlayDevices(ctx context.Context, deviceNames []string) error {
 	if len(deviceNames) == 0 {
 		return nil
 	}
+	defer invalidateDeviceCache()
+	return engine.SetCurrentAirPlayDevices(ctx, deviceNames)
+}
+
+func (appleScriptEngine) SetCurrentAirPlayDevices(ctx context.Context, deviceNames []string) error {
 	var refs []string
 	for _, name := range deviceNames {
-		refs = append(refs, fmt.Sprintf(`AirPlay device %s`, quoteAppleScriptString(name)))
+		refs = append(refs, fmt.Sprintf(`AirPlay device %s`, QuoteAppleScriptString(name)))
 	}
-	_, err := runAppleScript(ctx, fmt.Sprintf(`
+	_, err := runAppleScriptWithPolicy(ctx, fmt.Sprintf(`
 tell application "Music"
 	set current AirPlay devices to {%s}
 end tell
-`, strings.Join(refs, ", ")))
+`, strings.Join(refs, ", ")), retryPolicy.forOutputs())
 	return err
 }
 
@@ -130,15 +257,40 @@ func SetAirPlayDeviceVolume(ctx context.Context, deviceName string, volume int)
 	if volume < 0 || volume > 100 {
 		return fmt.Errorf("volume must be 0-100")
 	}
+	defer invalidateDeviceCache()
+	return engine.SetAirPlayDeviceVolume(ctx, deviceName, volume)
+}
+
+func (appleScriptEngine) SetAirPlayDeviceVolume(ctx context.Context, deviceName string, volume int) error {
 	_, err := runAppleScript(ctx, fmt.Sprintf(`
 tell application "Music"
 	set sound volume of (AirPlay device %s) to %d
 end tell
-`, quoteAppleScriptString(deviceName), volume))
+`, QuoteAppleScriptString(deviceName), volume))
+	return err
+}
+
+func SetSoundVolume(ctx context.Context, volume int) error {
+	if volume < 0 || volume > 100 {
+		return fmt.Errorf("volume must be 0-100")
+	}
+	return engine.SetSoundVolume(ctx, volume)
+}
+
+func (appleScriptEngine) SetSoundVolume(ctx context.Context, volume int) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set sound volume to %d
+end tell
+`, volume))
 	return err
 }
 
 func SetShuffleEnabled(ctx context.Context, enabled bool) error {
+	return engine.SetShuffleEnabled(ctx, enabled)
+}
+
+func (appleScriptEngine) SetShuffleEnabled(ctx context.Context, enabled bool) error {
 	val := "false"
 	if enabled {
 		val = "true"
@@ -151,19 +303,574 @@ end tell
 	return err
 }
 
+// Shuffle modes: what Music.app shuffles when shuffle is on.
+const (
+	ShuffleSongs     = "songs"
+	ShuffleAlbums    = "albums"
+	ShuffleGroupings = "groupings"
+)
+
+// SetShuffleMode sets the shuffle mode; it does not turn shuffle on.
+func SetShuffleMode(ctx context.Context, mode string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case ShuffleSongs, ShuffleAlbums, ShuffleGroupings:
+	default:
+		return fmt.Errorf("shuffle mode must be songs|albums|groupings")
+	}
+	return engine.SetShuffleMode(ctx, mode)
+}
+
+func (appleScriptEngine) SetShuffleMode(ctx context.Context, mode string) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set shuffle mode to %s
+end tell
+`, mode))
+	return err
+}
+
+// MaxCrossfadeSeconds is the longest crossfade Music.app's settings offer.
+const MaxCrossfadeSeconds = 12
+
+// SetCrossfade crossfades songs for seconds (1-12), or turns crossfading off
+// when seconds is 0.
+func SetCrossfade(ctx context.Context, seconds int) error {
+	if seconds < 0 || seconds > MaxCrossfadeSeconds {
+		return fmt.Errorf("crossfade must be 0-%d seconds", MaxCrossfadeSeconds)
+	}
+	return engine.SetCrossfade(ctx, seconds)
+}
+
+// SetCrossfade drives the Playback pane of Music.app's settings through
+// System Events, because crossfade is not in Music.app's scripting
+// dictionary. It needs the Accessibility permission and matches the English
+// "Crossfade" label, and checks both before Music.app is brought forward.
+func (appleScriptEngine) SetCrossfade(ctx context.Context, seconds int) error {
+	out, err := runAppleScript(ctx, `
+set langs to ""
+try
+	set langs to do shell script "defaults read com.apple.Music AppleLanguages 2>/dev/null || defaults read -g AppleLanguages"
+end try
+tell application "System Events" to set trusted to UI elements enabled
+return (trusted as text) & tab & langs
+`)
+	if err != nil {
+		return err
+	}
+	if err := checkUIScripting(out); err != nil {
+		return err
+	}
+	_, err = runAppleScript(ctx, fmt.Sprintf(`
+set wantOn to %t
+tell application "Music" to activate
+tell application "System Events" to tell process "Music"
+	keystroke "," using command down
+	repeat 50 times
+		if exists (first window whose name is not "Music") then exit repeat
+		delay 0.1
+	end repeat
+	set w to (first window whose name is not "Music")
+	click button "Playback" of toolbar 1 of w
+	delay 0.3
+	set w to front window
+	set cb to missing value
+	set sl to missing value
+	repeat with el in (entire contents of w)
+		if cb is missing value and class of el is checkbox and (name of el as text) contains "Crossfade" then set cb to contents of el
+		if sl is missing value and class of el is slider then set sl to contents of el
+	end repeat
+	if cb is missing value then error "Crossfade setting not found in Music settings"
+	if ((value of cb) as integer is 1) is not wantOn then click cb
+	if wantOn and sl is not missing value then set value of sl to %d
+	keystroke "w" using command down
+end tell
+`, seconds > 0, seconds))
+	return err
+}
+
+// checkUIScripting reads "<UI elements enabled>\t<AppleLanguages>" and
+// reports why the settings UI cannot be scripted: no Accessibility
+// permission, or a UI language other than English.
+func checkUIScripting(out string) error {
+	trusted, langs, _ := strings.Cut(strings.TrimSpace(out), "\t")
+	if !parseBool(trusted) {
+		return fmt.Errorf("crossfade needs the Accessibility permission for the app running homepodctl (System Settings > Privacy & Security > Accessibility)")
+	}
+	// defaults prints a plist array: ( "en-US", "de-DE" ).
+	lang, _, _ := strings.Cut(strings.Trim(strings.TrimSpace(langs), "()"), ",")
+	lang = strings.Trim(strings.TrimSpace(lang), `"`)
+	if lang != "" && !strings.HasPrefix(strings.ToLower(lang), "en") {
+		return fmt.Errorf("crossfade only matches Music.app's English settings, but its language is %s", lang)
+	}
+	return nil
+}
+
+func SetSongRepeat(ctx context.Context, mode string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "off", "one", "all":
+	default:
+		return fmt.Errorf("repeat mode must be off|one|all")
+	}
+	return engine.SetSongRepeat(ctx, mode)
+}
+
+func (appleScriptEngine) SetSongRepeat(ctx context.Context, mode string) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set song repeat to %s
+end tell
+`, mode))
+	return err
+}
+
+func SetPlayerPosition(ctx context.Context, seconds float64) error {
+	if seconds < 0 {
+		return fmt.Errorf("position must be >= 0")
+	}
+	return engine.SetPlayerPosition(ctx, seconds)
+}
+
+func (appleScriptEngine) SetPlayerPosition(ctx context.Context, seconds float64) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set player position to %s
+end tell
+`, strconv.FormatFloat(seconds, 'f', -1, 64)))
+	return err
+}
+
+// EQPreset is one of Music.app's equalizer presets.
+type EQPreset struct {
+	Name       string `json:"name"`
+	Modifiable bool   `json:"modifiable"` // user-made presets are modifiable
+	Current    bool   `json:"current,omitempty"`
+}
+
+// ListEQPresets returns Music.app's EQ presets in its menu order.
+func ListEQPresets(ctx context.Context) ([]EQPreset, error) {
+	return engine.ListEQPresets(ctx)
+}
+
+func (appleScriptEngine) ListEQPresets(ctx context.Context) ([]EQPreset, error) {
+	out, err := runAppleScript(ctx, `
+tell application "Music"
+	set cur to ""
+	try
+		if EQ enabled then set cur to name of current EQ preset
+	end try
+	set out to ""
+	repeat with p in (every EQ preset)
+		set out to out & (name of p) & tab & (modifiable of p as text) & tab & (((name of p) is cur) as text) & linefeed
+	end repeat
+	return out
+end tell
+`)
+	if err != nil {
+		return nil, err
+	}
+	var presets []EQPreset
+	for _, line := range splitNonEmptyLines(out) {
+		parts := strings.Split(line, "\t")
+		for len(parts) < 3 {
+			parts = append(parts, "")
+		}
+		presets = append(presets, EQPreset{
+			Name:       strings.TrimSpace(parts[0]),
+			Modifiable: parseBool(parts[1]),
+			Current:    parseBool(parts[2]),
+		})
+	}
+	return presets, nil
+}
+
+// SetEQPreset selects the EQ preset whose name matches name (ignoring case)
+// and turns the equalizer on. It returns the preset's name as Music.app
+// spells it.
+func SetEQPreset(ctx context.Context, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("EQ preset name is required")
+	}
+	presets, err := engine.ListEQPresets(ctx)
+	if err != nil {
+		return "", err
+	}
+	p, ok := FindEQPreset(presets, name)
+	if !ok {
+		var names []string
+		for _, p := range presets {
+			names = append(names, p.Name)
+		}
+		return "", fmt.Errorf("unknown EQ preset %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return p.Name, engine.SetEQPreset(ctx, p.Name)
+}
+
+// FindEQPreset returns the preset named name, ignoring case and spacing.
+func FindEQPreset(presets []EQPreset, name string) (EQPreset, bool) {
+	target := strings.ToLower(canonicalizeName(name))
+	for _, p := range presets {
+		if strings.ToLower(canonicalizeName(p.Name)) == target {
+			return p, true
+		}
+	}
+	return EQPreset{}, false
+}
+
+func (appleScriptEngine) SetEQPreset(ctx context.Context, name string) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set current EQ preset to EQ preset %s
+	set EQ enabled to true
+end tell
+`, QuoteAppleScriptString(name)))
+	return err
+}
+
+// SetCurrentTrackLoved marks the current track loved (or clears it). Music.app
+// clears disliked when loved is set.
+func SetCurrentTrackLoved(ctx context.Context, loved bool) error {
+	return engine.SetCurrentTrackLoved(ctx, loved)
+}
+
+func (appleScriptEngine) SetCurrentTrackLoved(ctx context.Context, loved bool) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set loved of current track to %t
+end tell
+`, loved))
+	return err
+}
+
+func SetCurrentTrackDisliked(ctx context.Context, disliked bool) error {
+	return engine.SetCurrentTrackDisliked(ctx, disliked)
+}
+
+func (appleScriptEngine) SetCurrentTrackDisliked(ctx context.Context, disliked bool) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set disliked of current track to %t
+end tell
+`, disliked))
+	return err
+}
+
+// SetCurrentTrackRating sets the current track's star rating (0-5). Music.app
+// stores ratings as 0-100, 20 per star.
+func SetCurrentTrackRating(ctx context.Context, stars int) error {
+	if stars < 0 || stars > 5 {
+		return fmt.Errorf("rating must be 0-5")
+	}
+	return engine.SetCurrentTrackRating(ctx, stars)
+}
+
+func (appleScriptEngine) SetCurrentTrackRating(ctx context.Context, stars int) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set rating of current track to %d
+end tell
+`, stars*20))
+	return err
+}
+
+// ErrNoArtwork is returned when the current track has no artwork.
+var ErrNoArtwork = errors.New("current track has no artwork")
+
+// ExportCurrentArtwork writes the current track's first artwork to path and
+// returns its format ("jpeg" or "png").
+func ExportCurrentArtwork(ctx context.Context, path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", fmt.Errorf("artwork path is required")
+	}
+	return engine.ExportCurrentArtwork(ctx, path)
+}
+
+func (appleScriptEngine) ExportCurrentArtwork(ctx context.Context, path string) (string, error) {
+	out, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	if not (exists current track) then return ""
+	set arts to artworks of current track
+	if (count of arts) is 0 then return ""
+	set art to item 1 of arts
+	set fmt to (format of art) as text
+	set pic to raw data of art
+end tell
+set f to open for access (POSIX file %s) with write permission
+try
+	set eof f to 0
+	write pic to f
+	close access f
+on error errMsg number errNum
+	close access f
+	error errMsg number errNum
+end try
+return fmt
+`, QuoteAppleScriptString(path)))
+	if err != nil {
+		return "", err
+	}
+	format := strings.TrimSpace(out)
+	if format == "" {
+		return "", ErrNoArtwork
+	}
+	if strings.Contains(strings.ToUpper(format), "PNG") {
+		return "png", nil
+	}
+	return "jpeg", nil
+}
+
+// ErrNoLyrics is returned when the current track has no lyrics.
+var ErrNoLyrics = errors.New("current track has no lyrics")
+
+// GetCurrentLyrics returns the lyrics stored on the current track, with line
+// endings normalized to "\n".
+func GetCurrentLyrics(ctx context.Context) (string, error) {
+	return engine.CurrentLyrics(ctx)
+}
+
+func (appleScriptEngine) CurrentLyrics(ctx context.Context) (string, error) {
+	out, err := runAppleScript(ctx, `
+tell application "Music"
+	if not (exists current track) then return ""
+	return (lyrics of current track) as text
+end tell
+`)
+	if err != nil {
+		return "", err
+	}
+	lyrics := strings.ReplaceAll(out, "\r\n", "\n")
+	lyrics = strings.TrimSpace(strings.ReplaceAll(lyrics, "\r", "\n"))
+	if lyrics == "" {
+		return "", ErrNoLyrics
+	}
+	return lyrics, nil
+}
+
+// PlaySpeech speaks text into an AIFF file in the temporary items of the Mac
+// running Music.app and plays it on the current outputs. It returns the
+// length Music.app reports for the file, 0 if it has none yet.
+//
+// Playing a file adds it to the library, so callers must call RemoveSpeech
+// once the announcement is over.
+func PlaySpeech(ctx context.Context, text, voice string) (float64, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, fmt.Errorf("text is required")
+	}
+	return engine.PlaySpeech(ctx, text, strings.TrimSpace(voice))
+}
+
+func (appleScriptEngine) PlaySpeech(ctx context.Context, text, voice string) (float64, error) {
+	using := ""
+	if voice != "" {
+		using = " using " + QuoteAppleScriptString(voice)
+	}
+	out, err := runAppleScript(ctx, fmt.Sprintf(`
+set p to (POSIX path of (path to temporary items)) & "%s.aiff"
+say %s%s saving to (POSIX file p)
+set f to (POSIX file p) as alias
+tell application "Music"
+	play f
+	if not (exists current track) then return 0
+	return duration of current track
+end tell
+`, speechName, QuoteAppleScriptString(text), using))
+	if err != nil {
+		return 0, err
+	}
+	return parseFloatLoose(out), nil
+}
+
+// speechName names the announcement file and so the library track Music.app
+// makes for it.
+const speechName = "homepodctl-announce"
+
+// RemoveSpeech deletes the library tracks PlaySpeech left behind, and the
+// speech file. Tracks are matched by name and file location, so tracks from
+// earlier announcements that were never removed go too.
+func RemoveSpeech(ctx context.Context) error {
+	return engine.RemoveSpeech(ctx)
+}
+
+func (appleScriptEngine) RemoveSpeech(ctx context.Context) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+set p to (POSIX path of (path to temporary items)) & "%[1]s.aiff"
+tell application "Music"
+	repeat with t in (get every file track of library playlist 1 whose name is "%[1]s")
+		try
+			if POSIX path of (location of t) is p then delete t
+		end try
+	end repeat
+end tell
+do shell script "rm -f " & quoted form of p
+`, speechName))
+	return err
+}
+
 func PlayUserPlaylistByPersistentID(ctx context.Context, persistentID string) error {
 	persistentID = strings.TrimSpace(persistentID)
 	if persistentID == "" {
 		return fmt.Errorf("persistentID is required")
 	}
+	return engine.PlayPlaylist(ctx, persistentID)
+}
+
+func (appleScriptEngine) PlayPlaylist(ctx context.Context, persistentID string) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	play (some user playlist whose persistent ID is %s)
+end tell
+`, QuoteAppleScriptString(persistentID)))
+	return err
+}
+
+// PlaylistTrack is one entry of a user playlist.
+type PlaylistTrack struct {
+	Index        int        `json:"index"` // 1-based position in the playlist
+	PersistentID string     `json:"persistentID"`
+	Name         string     `json:"name"`
+	Artist       string     `json:"artist,omitempty"`
+	DurationS    float64    `json:"durationSeconds,omitempty"`
+	PlayedAt     *time.Time `json:"playedAt,omitempty"`
+	// BookmarkS is where playback stopped last time, kept by Music.app only
+	// for bookmarkable tracks (audiobooks, podcasts, or tracks set to
+	// remember their position).
+	BookmarkS float64 `json:"bookmarkSeconds,omitempty"`
+}
+
+// GetPlaylistTracks returns the tracks of a user playlist in playlist order.
+func GetPlaylistTracks(ctx context.Context, persistentID string) ([]PlaylistTrack, error) {
+	persistentID = strings.TrimSpace(persistentID)
+	if persistentID == "" {
+		return nil, fmt.Errorf("persistentID is required")
+	}
+	return engine.ListPlaylistTracks(ctx, persistentID)
+}
+
+func (appleScriptEngine) ListPlaylistTracks(ctx context.Context, persistentID string) ([]PlaylistTrack, error) {
+	// Properties are fetched for every track at once, which is far faster
+	// than one Apple event per track. Played dates are reported as seconds
+	// before now, as in ListUserPlaylists.
+	out, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set p to (some user playlist whose persistent ID is %s)
+	set ids to persistent ID of every track of p
+	set names to name of every track of p
+	set artists to artist of every track of p
+	set durs to duration of every track of p
+	set played to played date of every track of p
+	set marks to bookmark of every track of p
+	set markable to bookmarkable of every track of p
+	set nowDate to current date
+	set out to ""
+	repeat with i from 1 to count of ids
+		set tAge to ""
+		set pd to item i of played
+		if pd is not missing value then set tAge to (((nowDate - pd) as integer) as text)
+		set tMark to 0
+		if item i of markable then set tMark to item i of marks
+		set out to out & i & tab & (item i of ids) & tab & (item i of names) & tab & (item i of artists) & tab & (item i of durs) & tab & tAge & tab & tMark & linefeed
+	end repeat
+	return out
+end tell
+`, QuoteAppleScriptString(persistentID)))
+	if err != nil {
+		return nil, err
+	}
+	return parsePlaylistTracks(out, time.Now()), nil
+}
+
+func parsePlaylistTracks(out string, now time.Time) []PlaylistTrack {
+	var tracks []PlaylistTrack
+	for _, line := range splitNonEmptyLines(out) {
+		parts := strings.Split(line, "\t")
+		for len(parts) < 7 {
+			parts = append(parts, "")
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			continue
+		}
+		t := PlaylistTrack{
+			Index:        index,
+			PersistentID: strings.TrimSpace(parts[1]),
+			Name:         strings.TrimSpace(parts[2]),
+			Artist:       strings.TrimSpace(parts[3]),
+			DurationS:    parseFloatLoose(parts[4]),
+			BookmarkS:    parseFloatLoose(parts[6]),
+		}
+		if age, err := strconv.Atoi(strings.TrimSpace(parts[5])); err == nil {
+			played := now.Add(-time.Duration(age) * time.Second).UTC().Truncate(time.Second)
+			t.PlayedAt = &played
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+// PlayUserPlaylistTrack starts a user playlist at its index-th (1-based)
+// track; playback continues through the rest of the playlist.
+func PlayUserPlaylistTrack(ctx context.Context, persistentID string, index int) error {
+	persistentID = strings.TrimSpace(persistentID)
+	if persistentID == "" {
+		return fmt.Errorf("persistentID is required")
+	}
+	if index < 1 {
+		return fmt.Errorf("track index must be 1 or more")
+	}
+	return engine.PlayPlaylistTrack(ctx, persistentID, index)
+}
+
+func (appleScriptEngine) PlayPlaylistTrack(ctx context.Context, persistentID string, index int) error {
 	_, err := runAppleScript(ctx, fmt.Sprintf(`
 tell application "Music"
-	play (some user playlist whose persistent ID is %s)
+	%s
 end tell
-`, quoteAppleScriptString(persistentID)))
+`, playPlaylistTrackScript(persistentID, index)))
 	return err
 }
 
+func playPlaylistTrackScript(persistentID string, index int) string {
+	return fmt.Sprintf(`play track %d of (some user playlist whose persistent ID is %s)`, index, QuoteAppleScriptString(persistentID))
+}
+
+// FindPlaylistTrack picks the track whose name matches query: an exact
+// (canonical, case-insensitive) match wins, then the first track in
+// playlist order whose name contains it.
+func FindPlaylistTrack(tracks []PlaylistTrack, query string) (PlaylistTrack, bool) {
+	target := strings.ToLower(canonicalizeName(query))
+	if target == "" {
+		return PlaylistTrack{}, false
+	}
+	for _, t := range tracks {
+		if strings.ToLower(canonicalizeName(t.Name)) == target {
+			return t, true
+		}
+	}
+	for _, t := range tracks {
+		if strings.Contains(strings.ToLower(canonicalizeName(t.Name)), target) {
+			return t, true
+		}
+	}
+	return PlaylistTrack{}, false
+}
+
+// LastPlayedTrack returns the track played most recently, or false when
+// none of them was ever played.
+func LastPlayedTrack(tracks []PlaylistTrack) (PlaylistTrack, bool) {
+	var last PlaylistTrack
+	found := false
+	for _, t := range tracks {
+		if t.PlayedAt != nil && (!found || t.PlayedAt.After(*last.PlayedAt)) {
+			last, found = t, true
+		}
+	}
+	return last, found
+}
+
 func FindUserPlaylistPersistentIDByName(ctx context.Context, name string) (string, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
@@ -209,11 +916,15 @@ func FindUserPlaylistPersistentIDByName(ctx context.Context, name string) (strin
 }
 
 func FindUserPlaylistNameByPersistentID(ctx context.Context, persistentID string) (string, error) {
+	return engine.PlaylistName(ctx, persistentID)
+}
+
+func (appleScriptEngine) PlaylistName(ctx context.Context, persistentID string) (string, error) {
 	out, err := runAppleScript(ctx, fmt.Sprintf(`
 tell application "Music"
 	return name of (some user playlist whose persistent ID is %s)
 end tell
-`, quoteAppleScriptString(persistentID)))
+`, QuoteAppleScriptString(persistentID)))
 	if err != nil {
 		return "", err
 	}
@@ -228,11 +939,39 @@ func ListUserPlaylists(ctx context.Context, query string, limit int) ([]UserPlay
 	query = strings.TrimSpace(query)
 	needle := strings.ToLower(query)
 
+	all, err := cachedUserPlaylists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var playlists []UserPlaylist
+	for _, p := range all {
+		if needle != "" && !strings.Contains(strings.ToLower(p.Name), needle) {
+			continue
+		}
+		playlists = append(playlists, p)
+		if limit > 0 && len(playlists) >= limit {
+			break
+		}
+	}
+	return playlists, nil
+}
+
+// listAllUserPlaylists enumerates every user playlist through Music.app,
+// bypassing the cache.
+func listAllUserPlaylists(ctx context.Context) ([]UserPlaylist, error) {
+	return engine.ListUserPlaylists(ctx)
+}
+
+func (appleScriptEngine) ListUserPlaylists(ctx context.Context) ([]UserPlaylist, error) {
 	out, err := runAppleScript(ctx, `
 tell application "Music"
 	set out to ""
 	repeat with p in (every user playlist)
-		set out to out & (persistent ID of p) & tab & (name of p) & tab & (smart of p as text) & tab & (genius of p as text) & linefeed
+		set pFolder to ""
+		try
+			set pFolder to (name of parent of p)
+		end try
+		set out to out & (persistent ID of p) & tab & (name of p) & tab & (smart of p as text) & tab & (genius of p as text) & tab & (count of tracks of p) & tab & ((duration of p) as integer) & tab & pFolder & linefeed
 	end repeat
 	return out
 end tell
@@ -244,22 +983,128 @@ end tell
 	var playlists []UserPlaylist
 	for _, line := range splitNonEmptyLines(out) {
 		parts := strings.Split(line, "\t")
-		for len(parts) < 4 {
+		for len(parts) < 7 {
 			parts = append(parts, "")
 		}
+		count, _ := strconv.Atoi(strings.TrimSpace(parts[4]))
 		p := UserPlaylist{
 			PersistentID: strings.TrimSpace(parts[0]),
 			Name:         strings.TrimSpace(parts[1]),
 			Smart:        parseBool(parts[2]),
 			Genius:       parseBool(parts[3]),
+			TrackCount:   count,
+			DurationS:    parseFloatLoose(parts[5]),
+			Folder:       strings.TrimSpace(parts[6]),
 		}
-		if needle != "" && !strings.Contains(strings.ToLower(p.Name), needle) {
+		playlists = append(playlists, p)
+	}
+	return playlists, nil
+}
+
+// FillPlaylistModified sets Modified on each of playlists from one pass over
+// the library's track dates; playlists without tracks keep it unset.
+func FillPlaylistModified(ctx context.Context, playlists []UserPlaylist) error {
+	added, err := engine.PlaylistsLastAdded(ctx)
+	if err != nil {
+		return err
+	}
+	for i, p := range playlists {
+		if t, ok := added[p.PersistentID]; ok {
+			playlists[i].Modified = &t
+		}
+	}
+	return nil
+}
+
+func (appleScriptEngine) PlaylistsLastAdded(ctx context.Context) (map[string]time.Time, error) {
+	// Dates are reported as seconds before now, which needs no locale-aware
+	// date parsing.
+	out, err := runAppleScript(ctx, `
+tell application "Music"
+	set out to ""
+	set nowDate to current date
+	repeat with p in (every user playlist)
+		try
+			set newest to missing value
+			repeat with d in (get date added of every track of p)
+				if newest is missing value or d > newest then set newest to (contents of d)
+			end repeat
+			if newest is not missing value then set out to out & (persistent ID of p) & tab & (((nowDate - newest) as integer) as text) & linefeed
+		end try
+	end repeat
+	return out
+end tell
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	added := map[string]time.Time{}
+	for _, line := range splitNonEmptyLines(out) {
+		id, ageText, ok := strings.Cut(line, "\t")
+		age, err := strconv.Atoi(strings.TrimSpace(ageText))
+		if !ok || err != nil {
 			continue
 		}
-		playlists = append(playlists, p)
-		if limit > 0 && len(playlists) >= limit {
-			break
+		added[strings.TrimSpace(id)] = now.Add(-time.Duration(age) * time.Second).UTC().Truncate(time.Second)
+	}
+	return added, nil
+}
+
+// MostPlayedUserPlaylists returns regular (non-smart, non-Genius) user
+// playlists ordered by the summed play count of their tracks, skipping
+// playlists that were never played.
+func MostPlayedUserPlaylists(ctx context.Context, limit int) ([]UserPlaylist, error) {
+	all, err := engine.PlaylistPlayCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var playlists []UserPlaylist
+	for _, p := range all {
+		if p.Plays > 0 {
+			playlists = append(playlists, p)
+		}
+	}
+	sort.SliceStable(playlists, func(i, j int) bool { return playlists[i].Plays > playlists[j].Plays })
+	if limit > 0 && len(playlists) > limit {
+		playlists = playlists[:limit]
+	}
+	return playlists, nil
+}
+
+func (appleScriptEngine) PlaylistPlayCounts(ctx context.Context) ([]UserPlaylist, error) {
+	out, err := runAppleScript(ctx, `
+tell application "Music"
+	set out to ""
+	repeat with p in (every user playlist whose smart is false and genius is false)
+		set n to 0
+		try
+			repeat with c in (get played count of every track of p)
+				set n to n + c
+			end repeat
+		end try
+		set out to out & (persistent ID of p) & tab & (name of p) & tab & n & linefeed
+	end repeat
+	return out
+end tell
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	var playlists []UserPlaylist
+	for _, line := range splitNonEmptyLines(out) {
+		parts := strings.Split(line, "\t")
+		if len(parts) < 3 {
+			continue
 		}
+		plays, _ := strconv.Atoi(strings.TrimSpace(parts[2]))
+		playlists = append(playlists, UserPlaylist{
+			PersistentID: strings.TrimSpace(parts[0]),
+			Name:         strings.TrimSpace(parts[1]),
+			Plays:        plays,
+		})
 	}
 	return playlists, nil
 }
@@ -336,7 +1181,219 @@ func PickBestPlaylist(query string, matches []UserPlaylist) (UserPlaylist, bool)
 	return best, true
 }
 
+// MatchScore scores how well name matches query the way playlist search
+// does: exact, then prefix, substring, and subsequence matches, ignoring case.
+// Zero means no match.
+func MatchScore(query, name string) int {
+	return scoreMatch(strings.ToLower(canonicalizeName(query)), strings.ToLower(canonicalizeName(name)))
+}
+
+// SearchLibrary searches the local library (library playlist 1) for query.
+// kind is track, album, or artist; limit <= 0 means no limit.
+func SearchLibrary(ctx context.Context, query, kind string, limit int) ([]LibraryItem, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind == "" {
+		kind = "track"
+	}
+	only := map[string]string{"track": "songs", "album": "albums", "artist": "artists"}[kind]
+	if only == "" {
+		return nil, fmt.Errorf("invalid search type %q (expected track|album|artist)", kind)
+	}
+	tracks, err := engine.SearchTracks(ctx, query, only)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []LibraryItem
+	index := map[string]int{}
+	for _, track := range tracks {
+		if kind == "track" {
+			items = append(items, track)
+			if limit > 0 && len(items) >= limit {
+				break
+			}
+			continue
+		}
+		key, item := strings.ToLower(track.Artist), LibraryItem{Kind: kind, Name: track.Artist}
+		if kind == "album" {
+			key = strings.ToLower(track.Album + "\x00" + track.Artist)
+			item = LibraryItem{Kind: kind, Name: track.Album, Artist: track.Artist}
+		}
+		i, ok := index[key]
+		if !ok {
+			if limit > 0 && len(items) >= limit {
+				continue
+			}
+			i = len(items)
+			index[key] = i
+			items = append(items, item)
+		}
+		items[i].TrackIDs = append(items[i].TrackIDs, track.PersistentID)
+	}
+	return items, nil
+}
+
+func (appleScriptEngine) SearchTracks(ctx context.Context, query, only string) ([]LibraryItem, error) {
+	out, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set out to ""
+	repeat with t in (search library playlist 1 for %s only %s)
+		set out to out & (persistent ID of t) & tab & (name of t) & tab & (artist of t) & tab & (album of t) & tab & (duration of t as text) & linefeed
+	end repeat
+	return out
+end tell
+`, QuoteAppleScriptString(query), only))
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []LibraryItem
+	for _, line := range splitNonEmptyLines(out) {
+		parts := strings.Split(line, "\t")
+		for len(parts) < 5 {
+			parts = append(parts, "")
+		}
+		tracks = append(tracks, LibraryItem{
+			Kind:         "track",
+			PersistentID: strings.TrimSpace(parts[0]),
+			Name:         strings.TrimSpace(parts[1]),
+			Artist:       strings.TrimSpace(parts[2]),
+			Album:        strings.TrimSpace(parts[3]),
+			DurationS:    parseFloatLoose(parts[4]),
+		})
+	}
+	return tracks, nil
+}
+
+func CreateUserPlaylist(ctx context.Context, name string) (UserPlaylist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return UserPlaylist{}, fmt.Errorf("playlist name is required")
+	}
+	return engine.CreateUserPlaylist(ctx, name)
+}
+
+func (appleScriptEngine) CreateUserPlaylist(ctx context.Context, name string) (UserPlaylist, error) {
+	out, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set p to make new user playlist with properties {name:%s}
+	return persistent ID of p
+end tell
+`, QuoteAppleScriptString(name)))
+	if err != nil {
+		return UserPlaylist{}, err
+	}
+	return UserPlaylist{PersistentID: strings.TrimSpace(out), Name: name}, nil
+}
+
+// AddTrackToUserPlaylist copies a library track into the playlist. Music.app
+// allows duplicates, so adding the same track twice adds it twice.
+func AddTrackToUserPlaylist(ctx context.Context, playlistID, trackID string) error {
+	playlistID = strings.TrimSpace(playlistID)
+	trackID = strings.TrimSpace(trackID)
+	if playlistID == "" || trackID == "" {
+		return fmt.Errorf("playlist and track persistent IDs are required")
+	}
+	return engine.AddTrackToUserPlaylist(ctx, playlistID, trackID)
+}
+
+func (appleScriptEngine) AddTrackToUserPlaylist(ctx context.Context, playlistID, trackID string) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set p to (some user playlist whose persistent ID is %s)
+	duplicate (some track of library playlist 1 whose persistent ID is %s) to p
+end tell
+`, QuoteAppleScriptString(playlistID), QuoteAppleScriptString(trackID)))
+	return err
+}
+
+// RemoveTrackFromUserPlaylist removes every occurrence of the track from the
+// playlist and returns how many were removed. The track stays in the library.
+func RemoveTrackFromUserPlaylist(ctx context.Context, playlistID, trackID string) (int, error) {
+	playlistID = strings.TrimSpace(playlistID)
+	trackID = strings.TrimSpace(trackID)
+	if playlistID == "" || trackID == "" {
+		return 0, fmt.Errorf("playlist and track persistent IDs are required")
+	}
+	return engine.RemoveTrackFromUserPlaylist(ctx, playlistID, trackID)
+}
+
+func (appleScriptEngine) RemoveTrackFromUserPlaylist(ctx context.Context, playlistID, trackID string) (int, error) {
+	out, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	set p to (some user playlist whose persistent ID is %s)
+	set matches to (every track of p whose persistent ID is %s)
+	set n to count of matches
+	repeat with t in matches
+		delete t
+	end repeat
+	return n
+end tell
+`, QuoteAppleScriptString(playlistID), QuoteAppleScriptString(trackID)))
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected remove output %q", strings.TrimSpace(out))
+	}
+	return n, nil
+}
+
+// ClearUserPlaylist removes every track from the playlist, leaving the
+// playlist itself and the tracks in the library.
+func ClearUserPlaylist(ctx context.Context, playlistID string) error {
+	playlistID = strings.TrimSpace(playlistID)
+	if playlistID == "" {
+		return fmt.Errorf("playlist persistent ID is required")
+	}
+	return engine.ClearUserPlaylist(ctx, playlistID)
+}
+
+func (appleScriptEngine) ClearUserPlaylist(ctx context.Context, playlistID string) error {
+	_, err := runAppleScript(ctx, fmt.Sprintf(`
+tell application "Music"
+	delete every track of (some user playlist whose persistent ID is %s)
+end tell
+`, QuoteAppleScriptString(playlistID)))
+	return err
+}
+
+func Play(ctx context.Context) error {
+	return engine.Play(ctx)
+}
+
+func (appleScriptEngine) Play(ctx context.Context) error {
+	_, err := runAppleScript(ctx, `
+tell application "Music"
+	play
+end tell
+`)
+	return err
+}
+
+func PlayPause(ctx context.Context) error {
+	return engine.PlayPause(ctx)
+}
+
+func (appleScriptEngine) PlayPause(ctx context.Context) error {
+	_, err := runAppleScript(ctx, `
+tell application "Music"
+	playpause
+end tell
+`)
+	return err
+}
+
 func Pause(ctx context.Context) error {
+	return engine.Pause(ctx)
+}
+
+func (appleScriptEngine) Pause(ctx context.Context) error {
 	_, err := runAppleScript(ctx, `
 tell application "Music"
 	pause
@@ -346,6 +1403,10 @@ end tell
 }
 
 func Stop(ctx context.Context) error {
+	return engine.Stop(ctx)
+}
+
+func (appleScriptEngine) Stop(ctx context.Context) error {
 	_, err := runAppleScript(ctx, `
 tell application "Music"
 	stop
@@ -355,6 +1416,10 @@ end tell
 }
 
 func NextTrack(ctx context.Context) error {
+	return engine.NextTrack(ctx)
+}
+
+func (appleScriptEngine) NextTrack(ctx context.Context) error {
 	_, err := runAppleScript(ctx, `
 tell application "Music"
 	next track
@@ -364,6 +1429,10 @@ end tell
 }
 
 func PreviousTrack(ctx context.Context) error {
+	return engine.PreviousTrack(ctx)
+}
+
+func (appleScriptEngine) PreviousTrack(ctx context.Context) error {
 	_, err := runAppleScript(ctx, `
 tell application "Music"
 	previous track
@@ -373,6 +1442,10 @@ end tell
 }
 
 func GetStatus(ctx context.Context) (Status, error) {
+	return engine.Status(ctx)
+}
+
+func (appleScriptEngine) Status(ctx context.Context) (Status, error) {
 	out, err := runAppleScript(ctx, `
 tell application "Music"
 	set ps to (player state as text)
@@ -402,9 +1475,10 @@ end tell
 	}, nil
 }
 
-func GetNowPlaying(ctx context.Context) (NowPlaying, error) {
-	out, err := runAppleScript(ctx, `
-tell application "Music"
+// nowPlayingFields sets npLine to the player state, current playlist, and
+// current track (with the classes of both) as a tab-separated line;
+// parseNowPlaying reads it back.
+const nowPlayingFields = `
 	set ps to (player state as text)
 	set pos to (player position as text)
 	set sh to (shuffle enabled as text)
@@ -416,6 +1490,8 @@ tell application "Music"
 	set tAlbum to ""
 	set tDur to "0"
 	set tPID to ""
+	set pClass to ""
+	set tClass to ""
 	try
 		set pName to (name of current playlist as text)
 		set pID to (persistent ID of current playlist as text)
@@ -427,14 +1503,43 @@ tell application "Music"
 		set tDur to (duration of current track as text)
 		set tPID to (persistent ID of current track as text)
 	end try
-	return ps & tab & pos & tab & sh & tab & rep & tab & pName & tab & pID & tab & tName & tab & tArtist & tab & tAlbum & tab & tDur & tab & tPID
+	try
+		set pClass to (class of current playlist as text)
+	end try
+	try
+		set tClass to (class of current track as text)
+	end try
+	set npLine to ps & tab & pos & tab & sh & tab & rep & tab & pName & tab & pID & tab & tName & tab & tArtist & tab & tAlbum & tab & tDur & tab & tPID & tab & pClass & tab & tClass
+`
+
+func GetNowPlaying(ctx context.Context) (NowPlaying, error) {
+	return engine.NowPlaying(ctx)
+}
+
+func (e appleScriptEngine) NowPlaying(ctx context.Context) (NowPlaying, error) {
+	out, err := runAppleScript(ctx, `
+tell application "Music"`+nowPlayingFields+`	return npLine
 end tell
 `)
 	if err != nil {
 		return NowPlaying{}, err
 	}
-	parts := strings.Split(strings.TrimSpace(out), "\t")
-	for len(parts) < 11 {
+	np := parseNowPlaying(out)
+
+	devs, err := e.ListAirPlayDevices(ctx)
+	if err == nil {
+		for _, d := range devs {
+			if d.Selected {
+				np.Outputs = append(np.Outputs, d)
+			}
+		}
+	}
+	return np, nil
+}
+
+func parseNowPlaying(line string) NowPlaying {
+	parts := strings.Split(strings.TrimSpace(line), "\t")
+	for len(parts) < 13 {
 		parts = append(parts, "")
 	}
 	np := NowPlaying{
@@ -452,73 +1557,60 @@ end tell
 			PersistentID: strings.TrimSpace(parts[10]),
 		},
 	}
-
-	devs, err := ListAirPlayDevices(ctx)
-	if err == nil {
-		for _, d := range devs {
-			if d.Selected {
-				np.Outputs = append(np.Outputs, d)
-			}
-		}
-	}
-	return np, nil
+	np.Source = playbackSource(parts[11], parts[12], np.PlaylistName, np.Track)
+	return np
 }
 
 func runAppleScript(ctx context.Context, script string) (string, error) {
+	return runAppleScriptWithPolicy(ctx, script, retryPolicy)
+}
+
+func runAppleScriptWithPolicy(ctx context.Context, script string, p RetryPolicy) (string, error) {
 	var lastErr error
-	for attempt := 0; attempt < 3; attempt++ {
-		out, err := runAppleScriptExec(ctx, script)
+	for attempt := 0; attempt <= p.Retries; attempt++ {
+		out, err := runAppleScriptAttempt(ctx, script)
 		if err == nil {
 			return string(out), nil
 		}
 		trimmed := strings.TrimSpace(string(out))
 		lastErr = &ScriptError{Err: err, Output: trimmed}
-		if !shouldRetryAppleScript(err, trimmed) || attempt == 2 {
+		if attempt == p.Retries || !p.retryable(err, trimmed) {
 			return "", lastErr
 		}
-		if err := sleepWithContextFn(ctx, retryBackoff(attempt)); err != nil {
+		logDebug("retrying applescript", "retry", attempt+1, "retries", p.Retries, "error", trimmed)
+		if err := sleepWithContextFn(ctx, p.backoff(attempt)); err != nil {
 			return "", err
 		}
 	}
 	return "", lastErr
 }
 
-func shouldRetryAppleScript(err error, output string) bool {
-	if err == nil {
-		return false
-	}
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return false
-	}
-	msg := strings.ToLower(strings.TrimSpace(output))
-	if msg == "" {
-		var exitErr *exec.ExitError
-		return errors.As(err, &exitErr)
+func runAppleScriptAttempt(ctx context.Context, script string) ([]byte, error) {
+	attemptCtx := ctx
+	if scriptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, scriptTimeout)
+		defer cancel()
 	}
-	transientMarkers := []string{
-		"connection is invalid",
-		"appleevent timed out",
-		"event timed out",
-		"timed out",
-		"resource busy",
-		"busy",
-		"(-1712)",
-	}
-	for _, marker := range transientMarkers {
-		if strings.Contains(msg, marker) {
-			return true
-		}
+	start := time.Now()
+	out, via, err := execScript(attemptCtx, script)
+	if err != nil && scriptTimeout > 0 && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s (defaults.timeouts.applescript): %w", scriptTimeout, context.DeadlineExceeded)
 	}
-	return false
+	logScriptCall(script, via, time.Since(start), err)
+	return out, err
 }
 
-func retryBackoff(attempt int) time.Duration {
-	switch attempt {
-	case 0:
-		return 150 * time.Millisecond
-	default:
-		return 400 * time.Millisecond
+func logScriptCall(script, via string, d time.Duration, err error) {
+	if logger == nil {
+		return
+	}
+	sum := sha256.Sum256([]byte(script))
+	attrs := []any{"script", hex.EncodeToString(sum[:6]), "via", via, "duration_ms", d.Milliseconds(), "ok", err == nil}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
 	}
+	logger.Debug("applescript", attrs...)
 }
 
 func sleepWithContext(ctx context.Context, d time.Duration) error {
@@ -541,7 +1633,8 @@ func escapeAppleScriptString(s string) string {
 	return s
 }
 
-func quoteAppleScriptString(s string) string {
+// QuoteAppleScriptString returns s as an AppleScript string literal.
+func QuoteAppleScriptString(s string) string {
 	return `"` + escapeAppleScriptString(s) + `"`
 }
 
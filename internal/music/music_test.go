@@ -1,8 +1,17 @@
 package music
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -162,6 +171,160 @@ func TestRunAppleScript_RetriesTransientThenSucceeds(t *testing.T) {
 	}
 }
 
+func TestEnsureRunning_LaunchesHiddenAndWaits(t *testing.T) {
+	origExec := runAppleScriptExec
+	origSleep := sleepWithContextFn
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		sleepWithContextFn = origSleep
+		launchedApp.Store(false)
+	})
+	sleepWithContextFn = func(context.Context, time.Duration) error { return nil }
+
+	running := "true"
+	var scripts []string
+	runAppleScriptExec = func(_ context.Context, script string) ([]byte, error) {
+		scripts = append(scripts, script)
+		if strings.Contains(script, "open -g -j -a Music") {
+			return nil, nil
+		}
+		out := running
+		if len(scripts) >= 4 {
+			out = "true"
+		}
+		return []byte(out), nil
+	}
+	if launched, err := EnsureRunning(context.Background()); err != nil || launched || len(scripts) != 1 {
+		t.Fatalf("running app: launched=%t err=%v scripts=%d", launched, err, len(scripts))
+	}
+
+	running, scripts = "false", nil
+	// not running, launch, still not running, then running.
+	launched, err := EnsureRunning(context.Background())
+	if err != nil || !launched || !Launched() || len(scripts) != 4 {
+		t.Fatalf("launched=%t err=%v scripts=%q", launched, err, scripts)
+	}
+}
+
+func TestCheckAirPlaySelection(t *testing.T) {
+	devices := []AirPlayDevice{
+		{Name: "Kitchen", Selected: true},
+		{Name: "Bedroom"},
+	}
+	statuses, err := CheckAirPlaySelection([]string{"kitchen", "Bedroom", "Office"}, devices)
+	want := []OutputStatus{{Room: "kitchen", Selected: true}, {Room: "Bedroom"}, {Room: "Office"}}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("statuses=%+v", statuses)
+	}
+	var partial *PartialSelectionError
+	if !errors.As(err, &partial) || strings.Join(partial.Missing, ",") != "Bedroom,Office" {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err := CheckAirPlaySelection([]string{"Kitchen"}, devices); err != nil {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestResolveRoom(t *testing.T) {
+	devices := []AirPlayDevice{
+		{Name: "Bedroom HomePod"},
+		{Name: "Kitchen"},
+		{Name: "Living Room"},
+		{Name: "Living Room TV"},
+	}
+	cases := []struct {
+		room, want string
+		exact      bool
+		errPart    string
+	}{
+		{room: "kitchen", want: "Kitchen"},
+		{room: "bedroom", want: "Bedroom HomePod"},
+		{room: "living room", want: "Living Room"},
+		{room: "homepod", want: "Bedroom HomePod"},
+		{room: "bedroom", exact: true, errPart: `did you mean "Bedroom HomePod"`},
+		{room: "Kitchen", exact: true, want: "Kitchen"},
+		{room: "Kitchn", errPart: `did you mean "Kitchen"`},
+		{room: "living", errPart: "ambiguous"},
+		{room: "Garage", errPart: "homepodctl devices"},
+	}
+	for _, tc := range cases {
+		got, err := ResolveRoom(tc.room, devices, tc.exact)
+		if tc.errPart != "" {
+			var roomErr *UnknownRoomError
+			if !errors.As(err, &roomErr) || !strings.Contains(err.Error(), tc.errPart) {
+				t.Fatalf("%q exact=%t: err=%v, want %q", tc.room, tc.exact, err, tc.errPart)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("%q exact=%t: got %q err=%v, want %q", tc.room, tc.exact, got, err, tc.want)
+		}
+	}
+}
+
+func TestDeviceKind(t *testing.T) {
+	for kind, want := range map[string]string{
+		"HomePod":          "homepod",
+		"Apple TV":         "tv",
+		"AirPort Express":  "airport",
+		"computer":         "computer",
+		"Bluetooth device": "bluetooth",
+		"AirPlay device":   "other",
+		"":                 "other",
+	} {
+		if got := DeviceKind(kind); got != want {
+			t.Fatalf("DeviceKind(%q)=%q, want %q", kind, got, want)
+		}
+	}
+}
+
+func TestRetryPolicy_CountBackoffAndOutputs(t *testing.T) {
+	origExec := runAppleScriptExec
+	origSleep := sleepWithContextFn
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		sleepWithContextFn = origSleep
+		SetRetryPolicy(DefaultRetryPolicy())
+	})
+
+	attempts := 0
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
+		attempts++
+		return []byte("AppleEvent timed out (-1712)"), errors.New("boom")
+	}
+	var waits []time.Duration
+	sleepWithContextFn = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	SetRetryPolicy(RetryPolicy{Retries: 4, Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond})
+	if _, err := runAppleScript(context.Background(), `return 1`); err == nil {
+		t.Fatalf("expected error after retries")
+	}
+	if attempts != 5 || fmt.Sprint(waits) != "[100ms 200ms 300ms 300ms]" {
+		t.Fatalf("attempts=%d waits=%v", attempts, waits)
+	}
+
+	attempts, waits = 0, nil
+	if err := SetCurrentAirPlayDevices(context.Background(), []string{"Kitchen"}); err == nil {
+		t.Fatalf("expected selection error")
+	}
+	if attempts != 5 || waits[0] != time.Second {
+		t.Fatalf("selection attempts=%d waits=%v", attempts, waits)
+	}
+	if script := NewBatch().SetOutputs([]string{"Kitchen"}).script(); !strings.Contains(script, "repeat with attempt from 1 to 5") || !strings.Contains(script, "delay 1") {
+		t.Fatalf("batch script lacks retry loop:\n%s", script)
+	}
+
+	attempts = 0
+	SetRetryPolicy(RetryPolicy{Retries: 0})
+	_, _ = runAppleScript(context.Background(), `return 1`)
+	if attempts != 1 || strings.Contains(NewBatch().SetOutputs([]string{"Kitchen"}).script(), "repeat with attempt") {
+		t.Fatalf("retries disabled: attempts=%d", attempts)
+	}
+}
+
 func TestRunAppleScript_FailFastOnPermanentError(t *testing.T) {
 	origExec := runAppleScriptExec
 	origSleep := sleepWithContextFn
@@ -186,13 +349,62 @@ func TestRunAppleScript_FailFastOnPermanentError(t *testing.T) {
 	}
 }
 
+func TestRunAppleScript_LogsCalls(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		SetLogger(nil)
+	})
+
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) { return []byte("ok"), nil }
+
+	if _, err := runAppleScript(context.Background(), `return "ok"`); err != nil {
+		t.Fatalf("runAppleScript: %v", err)
+	}
+	line := buf.String()
+	for _, want := range []string{`"msg":"applescript"`, `"script":"`, `"duration_ms":`, `"ok":true`} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("log line %q missing %s", line, want)
+		}
+	}
+}
+
+func TestRunAppleScript_TimeoutIsNotRetried(t *testing.T) {
+	origExec := runAppleScriptExec
+	origSleep := sleepWithContextFn
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		sleepWithContextFn = origSleep
+		SetScriptTimeout(0)
+	})
+
+	attempts := 0
+	runAppleScriptExec = func(ctx context.Context, _ string) ([]byte, error) {
+		attempts++
+		<-ctx.Done()
+		return []byte("timed out"), errors.New("signal: killed")
+	}
+	sleepWithContextFn = func(context.Context, time.Duration) error { return nil }
+	SetScriptTimeout(10 * time.Millisecond)
+
+	_, err := runAppleScript(context.Background(), `delay 60`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v, want deadline exceeded", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("attempts=%d, want 1", attempts)
+	}
+}
+
 func TestListUserPlaylists_QueryAndLimit(t *testing.T) {
 	origExec := runAppleScriptExec
 	t.Cleanup(func() { runAppleScriptExec = origExec })
 
 	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
 		return []byte(strings.Join([]string{
-			"AA11\tFocus\ttrue\tfalse",
+			"AA11\tFocus\ttrue\tfalse\t12\t2400\tWork",
 			"BB22\tDeep Focus\tfalse\tfalse",
 			"CC33\tParty\tfalse\ttrue",
 			"",
@@ -209,6 +421,152 @@ func TestListUserPlaylists_QueryAndLimit(t *testing.T) {
 	if got[0].PersistentID != "AA11" || got[0].Name != "Focus" || !got[0].Smart || got[0].Genius {
 		t.Fatalf("unexpected playlist: %+v", got[0])
 	}
+	if got[0].TrackCount != 12 || got[0].DurationS != 2400 || got[0].Folder != "Work" {
+		t.Fatalf("unexpected details: %+v", got[0])
+	}
+	if got[0].Modified != nil {
+		t.Fatalf("modified=%v, want unset (FillPlaylistModified reads it)", got[0].Modified)
+	}
+}
+
+func TestFillPlaylistModified(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
+		return []byte("AA11\t3600\nCC33\tbad\n"), nil
+	}
+
+	playlists := []UserPlaylist{{PersistentID: "AA11"}, {PersistentID: "BB22"}, {PersistentID: "CC33"}}
+	if err := FillPlaylistModified(context.Background(), playlists); err != nil {
+		t.Fatalf("FillPlaylistModified: %v", err)
+	}
+	if m := playlists[0].Modified; m == nil || time.Since(*m) < 59*time.Minute || time.Since(*m) > 61*time.Minute {
+		t.Fatalf("modified=%v, want about an hour ago", m)
+	}
+	if playlists[1].Modified != nil || playlists[2].Modified != nil {
+		t.Fatalf("unexpected dates: %+v", playlists)
+	}
+}
+
+func TestListUserPlaylists_UsesCacheUntilCountChanges(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		SetPlaylistCache("", 0)
+	})
+	SetPlaylistCache(filepath.Join(t.TempDir(), "playlists.json"), time.Hour)
+
+	listing := "AA11\tFocus\tfalse\tfalse\n"
+	count := "1"
+	enumerations := 0
+	runAppleScriptExec = func(_ context.Context, script string) ([]byte, error) {
+		if strings.Contains(script, "count of user playlists") {
+			return []byte(count), nil
+		}
+		enumerations++
+		return []byte(listing), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := ListUserPlaylists(context.Background(), "", 0)
+		if err != nil {
+			t.Fatalf("ListUserPlaylists: %v", err)
+		}
+		if len(got) != 1 || got[0].Name != "Focus" {
+			t.Fatalf("got=%+v", got)
+		}
+	}
+	if enumerations != 1 {
+		t.Fatalf("enumerations=%d, want 1 (second call should hit the cache)", enumerations)
+	}
+
+	listing += "BB22\tParty\tfalse\tfalse\n"
+	count = "2"
+	got, err := SearchUserPlaylists(context.Background(), "party")
+	if err != nil {
+		t.Fatalf("SearchUserPlaylists: %v", err)
+	}
+	if enumerations != 2 || len(got) != 1 || got[0].PersistentID != "BB22" {
+		t.Fatalf("enumerations=%d got=%+v, want a rebuild after the count changed", enumerations, got)
+	}
+
+	if err := ClearPlaylistCache(); err != nil {
+		t.Fatalf("ClearPlaylistCache: %v", err)
+	}
+	if _, err := ListUserPlaylists(context.Background(), "", 0); err != nil {
+		t.Fatalf("ListUserPlaylists: %v", err)
+	}
+	if enumerations != 3 {
+		t.Fatalf("enumerations=%d, want 3 after clearing the cache", enumerations)
+	}
+}
+
+func TestListAirPlayDevicesCached(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		SetDeviceCache("", 0)
+	})
+	SetDeviceCache(filepath.Join(t.TempDir(), "devices.json"), time.Minute)
+
+	lists := 0
+	runAppleScriptExec = func(_ context.Context, script string) ([]byte, error) {
+		if strings.Contains(script, "every AirPlay device") {
+			lists++
+			return []byte("Kitchen\tHomePod\ttrue\tfalse\tfalse\t40\t\tK1\n"), nil
+		}
+		return nil, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		got, cachedAt, err := ListAirPlayDevicesCached(context.Background())
+		if err != nil {
+			t.Fatalf("ListAirPlayDevicesCached: %v", err)
+		}
+		if len(got) != 1 || got[0].Name != "Kitchen" || time.Since(cachedAt) > time.Minute {
+			t.Fatalf("got=%+v cachedAt=%v", got, cachedAt)
+		}
+	}
+	if lists != 1 {
+		t.Fatalf("lists=%d, want 1 (second call should hit the cache)", lists)
+	}
+	if _, _, err := RefreshDeviceCache(context.Background()); err != nil || lists != 2 {
+		t.Fatalf("RefreshDeviceCache: lists=%d err=%v", lists, err)
+	}
+
+	if err := SetCurrentAirPlayDevices(context.Background(), []string{"Kitchen"}); err != nil {
+		t.Fatalf("SetCurrentAirPlayDevices: %v", err)
+	}
+	if _, _, ok := CachedAirPlayDevices(); ok {
+		t.Fatal("changing the outputs should drop the device cache")
+	}
+	if _, _, err := ListAirPlayDevicesCached(context.Background()); err != nil || lists != 3 {
+		t.Fatalf("lists=%d err=%v, want a fresh listing after the change", lists, err)
+	}
+}
+
+func TestMostPlayedUserPlaylists(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
+		return []byte(strings.Join([]string{
+			"AA11\tFocus\t12",
+			"BB22\tNever Played\t0",
+			"CC33\tParty\t40",
+			"DD44\tChill\t7",
+			"",
+		}, "\n")), nil
+	}
+
+	got, err := MostPlayedUserPlaylists(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("MostPlayedUserPlaylists: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "Party" || got[0].Plays != 40 || got[1].Name != "Focus" {
+		t.Fatalf("unexpected playlists: %+v", got)
+	}
 }
 
 func TestFindUserPlaylistPersistentIDByName(t *testing.T) {
@@ -348,3 +706,715 @@ func TestGetNowPlaying_SelectedOutputsAndDeviceFailure(t *testing.T) {
 		t.Fatalf("outputs=%v, want empty when device listing fails", np.Outputs)
 	}
 }
+
+func TestPlaybackSource(t *testing.T) {
+	t.Parallel()
+
+	album := NowPlayingTrack{Name: "Song", Album: "Blue"}
+	tests := []struct {
+		playlistClass, trackClass, playlist string
+		want                                string
+	}{
+		{"user playlist", "file track", "Focus", SourcePlaylist},
+		{"subscriptionPlaylist", "sharedTrack", "Today's Hits", SourcePlaylist},
+		{"library playlist", "file track", "Library", SourceLibrary},
+		{"playlist", "file track", "Blue", SourceAlbum},
+		{"user playlist", "file track", "Blue", SourcePlaylist},
+		{"library playlist", "file track", "Blue", SourceLibrary},
+		{"radio tuner playlist", "URL track", "Internet Radio", SourceRadio},
+		{"", "urlTrack", "", SourceRadio},
+		{"audio CD playlist", "audio CD track", "Blue", SourceCD},
+		{"", "", "", SourceNone},
+		{"folder playlist", "file track", "Stuff", SourceUnknown},
+	}
+	for _, tc := range tests {
+		if got := playbackSource(tc.playlistClass, tc.trackClass, tc.playlist, album); got != tc.want {
+			t.Fatalf("playbackSource(%q, %q, %q)=%q want %q", tc.playlistClass, tc.trackClass, tc.playlist, got, tc.want)
+		}
+	}
+
+	np := parseNowPlaying("playing\t1\tfalse\toff\tChill\tPL1\tSong\tArtist\tAlbum\t200\tT1\tuser playlist\tfile track")
+	if np.Source != SourcePlaylist {
+		t.Fatalf("parsed source=%q", np.Source)
+	}
+}
+
+func TestJXAEngine_NowPlayingSource(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	playlistClass := "userPlaylist"
+	runAppleScriptExec = func(_ context.Context, script string) ([]byte, error) {
+		if strings.Contains(script, "currentTrack") {
+			return []byte(`{"playerState":"playing","playlistName":"Blue","playlistClass":"` + playlistClass + `","track":{"name":"Song","album":"Blue"},"trackClass":"fileTrack","outputs":[]}`), nil
+		}
+		return []byte(`[]`), nil
+	}
+	for class, want := range map[string]string{"userPlaylist": SourcePlaylist, "playlist": SourceAlbum} {
+		playlistClass = class
+		np, err := JXAEngine().NowPlaying(context.Background())
+		if err != nil || np.Source != want {
+			t.Fatalf("class %s: source=%q err=%v, want %q", class, np.Source, err, want)
+		}
+	}
+}
+
+func TestDeviceType(t *testing.T) {
+	t.Parallel()
+
+	for kind, want := range map[string]string{
+		"HomePod": "homepod", "homePod": "homepod", "Apple TV": "tv", "appleTV": "tv",
+		"computer": "mac", "AirPort Express": "speaker", "AirPlay device": "speaker",
+		"Bluetooth device": "bluetooth", "": "unknown", "unknown": "unknown",
+	} {
+		if got := DeviceType(kind); got != want {
+			t.Fatalf("DeviceType(%q)=%q want %q", kind, got, want)
+		}
+	}
+}
+
+func TestSetSongRepeat_ValidatesMode(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		return nil, nil
+	}
+	if err := SetSongRepeat(context.Background(), " ALL "); err != nil {
+		t.Fatalf("SetSongRepeat: %v", err)
+	}
+	if !strings.Contains(script, "set song repeat to all") {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if err := SetSongRepeat(context.Background(), "twice"); err == nil {
+		t.Fatalf("expected error for invalid mode")
+	}
+}
+
+func TestEQPresets_ListAndSet(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		if strings.Contains(s, "every EQ preset") {
+			return []byte("Flat\tfalse\ttrue\nBass Booster\tfalse\tfalse\nMine\ttrue\tfalse\n"), nil
+		}
+		return nil, nil
+	}
+
+	presets, err := ListEQPresets(context.Background())
+	if err != nil {
+		t.Fatalf("ListEQPresets: %v", err)
+	}
+	if len(presets) != 3 || !presets[0].Current || presets[1].Current || !presets[2].Modifiable {
+		t.Fatalf("presets=%+v", presets)
+	}
+	name, err := SetEQPreset(context.Background(), "bass  booster")
+	if err != nil || name != "Bass Booster" {
+		t.Fatalf("SetEQPreset name=%q err=%v", name, err)
+	}
+	if !strings.Contains(script, `set current EQ preset to EQ preset "Bass Booster"`) || !strings.Contains(script, "set EQ enabled to true") {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if _, err := SetEQPreset(context.Background(), "Loudness War"); err == nil || !strings.Contains(err.Error(), "available: Flat, Bass Booster, Mine") {
+		t.Fatalf("expected unknown preset error, got %v", err)
+	}
+}
+
+func TestSetShuffleModeAndCrossfade(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		if strings.Contains(s, "UI elements enabled") {
+			return []byte("true\t(\n    \"en-GB\"\n)\n"), nil
+		}
+		script = s
+		return nil, nil
+	}
+	if err := SetShuffleMode(context.Background(), " Albums "); err != nil {
+		t.Fatalf("SetShuffleMode: %v", err)
+	}
+	if !strings.Contains(script, "set shuffle mode to albums") {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if err := SetShuffleMode(context.Background(), "artists"); err == nil {
+		t.Fatalf("expected error for invalid shuffle mode")
+	}
+
+	if err := SetCrossfade(context.Background(), 6); err != nil {
+		t.Fatalf("SetCrossfade: %v", err)
+	}
+	if !strings.Contains(script, `tell application "System Events"`) || !strings.Contains(script, "set wantOn to true") || !strings.Contains(script, "set value of sl to 6") {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if err := SetCrossfade(context.Background(), 0); err != nil || !strings.Contains(script, "set wantOn to false") {
+		t.Fatalf("SetCrossfade off: err=%v script=%s", err, script)
+	}
+	for _, n := range []int{-1, 13} {
+		if err := SetCrossfade(context.Background(), n); err == nil {
+			t.Fatalf("expected error for %d seconds", n)
+		}
+	}
+}
+
+func TestSetCrossfadeChecksUIScriptingFirst(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	for _, tc := range []struct {
+		out, want string
+	}{
+		{out: "false\t(\n    \"en-US\"\n)", want: "Accessibility"},
+		{out: "true\t(\n    \"de-DE\",\n    \"en-US\"\n)", want: "de-DE"},
+	} {
+		var scripts int
+		runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+			scripts++
+			return []byte(tc.out), nil
+		}
+		err := SetCrossfade(context.Background(), 6)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("out=%q: err=%v, want %q", tc.out, err, tc.want)
+		}
+		if scripts != 1 {
+			t.Fatalf("out=%q: ran %d scripts, want only the check", tc.out, scripts)
+		}
+	}
+	if err := checkUIScripting("true\t"); err != nil {
+		t.Fatalf("unknown language: %v", err)
+	}
+}
+
+func TestPlaylistEditing_Scripts(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		switch {
+		case strings.Contains(s, "make new user playlist"):
+			return []byte("NEW1\n"), nil
+		case strings.Contains(s, "delete t"):
+			return []byte("2\n"), nil
+		}
+		return nil, nil
+	}
+
+	p, err := CreateUserPlaylist(context.Background(), ` Dinner "tonight" `)
+	if err != nil {
+		t.Fatalf("CreateUserPlaylist: %v", err)
+	}
+	if p.PersistentID != "NEW1" || p.Name != `Dinner "tonight"` {
+		t.Fatalf("unexpected playlist: %+v", p)
+	}
+	if !strings.Contains(script, `{name:"Dinner \"tonight\""}`) {
+		t.Fatalf("name not escaped: %s", script)
+	}
+
+	if err := AddTrackToUserPlaylist(context.Background(), "NEW1", "TRK9"); err != nil {
+		t.Fatalf("AddTrackToUserPlaylist: %v", err)
+	}
+	if !strings.Contains(script, `persistent ID is "TRK9"`) || !strings.Contains(script, "duplicate") {
+		t.Fatalf("unexpected add script: %s", script)
+	}
+
+	n, err := RemoveTrackFromUserPlaylist(context.Background(), "NEW1", "TRK9")
+	if err != nil || n != 2 {
+		t.Fatalf("RemoveTrackFromUserPlaylist n=%d err=%v", n, err)
+	}
+	if err := ClearUserPlaylist(context.Background(), "NEW1"); err != nil {
+		t.Fatalf("ClearUserPlaylist: %v", err)
+	}
+	if !strings.Contains(script, `delete every track of (some user playlist whose persistent ID is "NEW1")`) {
+		t.Fatalf("unexpected clear script: %s", script)
+	}
+	if err := AddTrackToUserPlaylist(context.Background(), "NEW1", " "); err == nil {
+		t.Fatalf("expected error for empty track id")
+	}
+}
+
+func TestPlaylistTracks_ParseFindAndResume(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var scripts []string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		scripts = append(scripts, s)
+		if strings.Contains(s, "played date of every track") {
+			return []byte("1\tT1\tIntro\tBand\t61.5\t\t0\n2\tT2\tSong Two\tBand\t200\t3600\t0\n3\tT3\tSong Two (Live)\tBand\t210\t60\t42.5\n"), nil
+		}
+		return nil, nil
+	}
+
+	tracks, err := GetPlaylistTracks(context.Background(), "PL1")
+	if err != nil {
+		t.Fatalf("GetPlaylistTracks: %v", err)
+	}
+	if len(tracks) != 3 || tracks[0].PlayedAt != nil || tracks[0].DurationS != 61.5 || tracks[2].BookmarkS != 42.5 {
+		t.Fatalf("tracks=%+v", tracks)
+	}
+	if got, ok := FindPlaylistTrack(tracks, "song two"); !ok || got.Index != 2 {
+		t.Fatalf("exact match=%+v ok=%v", got, ok)
+	}
+	if got, ok := FindPlaylistTrack(tracks, "live"); !ok || got.Index != 3 {
+		t.Fatalf("substring match=%+v ok=%v", got, ok)
+	}
+	if _, ok := FindPlaylistTrack(tracks, "missing"); ok {
+		t.Fatalf("expected no match")
+	}
+	if got, ok := LastPlayedTrack(tracks); !ok || got.Index != 3 {
+		t.Fatalf("last played=%+v ok=%v", got, ok)
+	}
+	if _, ok := LastPlayedTrack(tracks[:1]); ok {
+		t.Fatalf("expected no played track")
+	}
+
+	if err := PlayUserPlaylistTrack(context.Background(), "PL1", 0); err == nil {
+		t.Fatalf("expected error for track index 0")
+	}
+	if err := PlayUserPlaylistTrack(context.Background(), "PL1", 3); err != nil {
+		t.Fatalf("PlayUserPlaylistTrack: %v", err)
+	}
+	if last := scripts[len(scripts)-1]; !strings.Contains(last, `play track 3 of (some user playlist whose persistent ID is "PL1")`) {
+		t.Fatalf("unexpected play script: %s", last)
+	}
+
+	b := NewBatch().PlayPlaylistTrack("PL1", 3).Seek(42.5)
+	if ops := strings.Join(b.Ops(), ","); ops != "play playlist PL1 track 3,seek 42.5" {
+		t.Fatalf("ops=%q", ops)
+	}
+	b = NewBatch().PlayPlaylist("PL1").Pause().Seek(0).Play()
+	if ops := strings.Join(b.Ops(), ","); ops != "play playlist PL1,pause,seek 0,play" {
+		t.Fatalf("ops=%q", ops)
+	}
+	if _, err := NewBatch().PlayPlaylistTrack("PL1", 0).Run(context.Background()); err == nil {
+		t.Fatalf("expected error for track index 0")
+	}
+}
+
+func TestSearchLibrary_TracksAndGrouping(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		return []byte(strings.Join([]string{
+			"T1\tSo What\tMiles Davis\tKind of Blue\t562.0",
+			"T2\tBlue in Green\tMiles Davis\tKind of Blue\t337.5",
+			"T3\tBlue Train\tJohn Coltrane\tBlue Train\t643",
+			"",
+		}, "\n")), nil
+	}
+
+	tracks, err := SearchLibrary(context.Background(), "blue", "", 2)
+	if err != nil {
+		t.Fatalf("SearchLibrary: %v", err)
+	}
+	if !strings.Contains(script, `for "blue" only songs`) {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if len(tracks) != 2 || tracks[1].PersistentID != "T2" || tracks[1].DurationS != 337.5 {
+		t.Fatalf("unexpected tracks: %+v", tracks)
+	}
+
+	albums, err := SearchLibrary(context.Background(), "blue", "album", 0)
+	if err != nil {
+		t.Fatalf("SearchLibrary album: %v", err)
+	}
+	if !strings.Contains(script, "only albums") {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if len(albums) != 2 || albums[0].Name != "Kind of Blue" || strings.Join(albums[0].TrackIDs, ",") != "T1,T2" {
+		t.Fatalf("unexpected albums: %+v", albums)
+	}
+
+	if _, err := SearchLibrary(context.Background(), "blue", "genre", 0); err == nil {
+		t.Fatalf("expected error for invalid type")
+	}
+}
+
+func TestSetCurrentTrackRating_ScalesStars(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		return nil, nil
+	}
+	if err := SetCurrentTrackRating(context.Background(), 4); err != nil {
+		t.Fatalf("SetCurrentTrackRating: %v", err)
+	}
+	if !strings.Contains(script, "set rating of current track to 80") {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if err := SetCurrentTrackRating(context.Background(), 6); err == nil {
+		t.Fatalf("expected error for rating > 5")
+	}
+	if err := SetCurrentTrackLoved(context.Background(), true); err != nil || !strings.Contains(script, "set loved of current track to true") {
+		t.Fatalf("unexpected loved script=%s err=%v", script, err)
+	}
+}
+
+func TestExportCurrentArtwork(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	out := "«class PNG »\n"
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		return []byte(out), nil
+	}
+	format, err := ExportCurrentArtwork(context.Background(), `/tmp/a "b".png`)
+	if err != nil || format != "png" {
+		t.Fatalf("format=%q err=%v", format, err)
+	}
+	if !strings.Contains(script, `POSIX file "/tmp/a \"b\".png"`) {
+		t.Fatalf("unexpected script: %s", script)
+	}
+
+	out = "JPEG picture\n"
+	if format, err := ExportCurrentArtwork(context.Background(), "/tmp/a.jpg"); err != nil || format != "jpeg" {
+		t.Fatalf("format=%q err=%v", format, err)
+	}
+	out = "\n"
+	if _, err := ExportCurrentArtwork(context.Background(), "/tmp/a.jpg"); !errors.Is(err, ErrNoArtwork) {
+		t.Fatalf("err=%v, want ErrNoArtwork", err)
+	}
+}
+
+func TestGetCurrentLyrics(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	out := "First line\rSecond line\r\rChorus\n"
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
+		return []byte(out), nil
+	}
+	lyrics, err := GetCurrentLyrics(context.Background())
+	if err != nil {
+		t.Fatalf("err=%v", err)
+	}
+	if lyrics != "First line\nSecond line\n\nChorus" {
+		t.Fatalf("lyrics=%q", lyrics)
+	}
+	out = "\n"
+	if _, err := GetCurrentLyrics(context.Background()); !errors.Is(err, ErrNoLyrics) {
+		t.Fatalf("err=%v, want ErrNoLyrics", err)
+	}
+}
+
+func TestPlaySpeech(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		return []byte("2,5\n"), nil
+	}
+	d, err := PlaySpeech(context.Background(), ` Dinner is "ready" `, "Samantha")
+	if err != nil || d != 2.5 {
+		t.Fatalf("d=%v err=%v", d, err)
+	}
+	if !strings.Contains(script, `say "Dinner is \"ready\"" using "Samantha" saving to`) || !strings.Contains(script, "play f") {
+		t.Fatalf("unexpected script: %s", script)
+	}
+	if _, err := PlaySpeech(context.Background(), "Hi", ""); err != nil || strings.Contains(script, "using") {
+		t.Fatalf("err=%v script=%s", err, script)
+	}
+	if _, err := PlaySpeech(context.Background(), "  ", ""); err == nil {
+		t.Fatalf("expected an error for empty text")
+	}
+}
+
+func TestRemoveSpeech(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		return nil, nil
+	}
+	if err := RemoveSpeech(context.Background()); err != nil {
+		t.Fatalf("RemoveSpeech: %v", err)
+	}
+	for _, want := range []string{`"homepodctl-announce.aiff"`, `whose name is "homepodctl-announce"`, "delete t", `"rm -f " & quoted form of p`} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script lacks %q: %s", want, script)
+		}
+	}
+}
+
+func TestListStationsAndPickBest(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
+		return []byte("AAA1\tApple Music 1\tmissing value\tlibrary\nBBB2\tFIP\thttps://icecast.radiofrance.fr/fip-hifi.aac\ttuner\n"), nil
+	}
+	stations, err := ListStations(context.Background())
+	if err != nil {
+		t.Fatalf("ListStations: %v", err)
+	}
+	want := []Station{
+		{PersistentID: "AAA1", Name: "Apple Music 1", Source: "library"},
+		{PersistentID: "BBB2", Name: "FIP", URL: "https://icecast.radiofrance.fr/fip-hifi.aac", Source: "tuner"},
+	}
+	if !reflect.DeepEqual(stations, want) {
+		t.Fatalf("stations=%+v", stations)
+	}
+	if s, ok := PickBestStation("apple music", stations); !ok || s.PersistentID != "AAA1" {
+		t.Fatalf("pick=%+v ok=%t", s, ok)
+	}
+	if _, ok := PickBestStation("jazz24", stations); ok {
+		t.Fatalf("expected no match")
+	}
+}
+
+func TestBatch_RunSingleScript(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	calls := 0
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		calls++
+		script = s
+		return []byte(strings.Join([]string{
+			"ok", "ok", "ok", "ok",
+			"np\tplaying\t1.5\ttrue\toff\tChill\tPL1\tSong\tArtist\tAlbum\t200\tTR1",
+			"dev\tKitchen\tHomePod\ttrue\ttrue\ttrue\t30\t\tD1",
+			"",
+		}, "\n")), nil
+	}
+
+	b := NewBatch().SetOutputs([]string{"Kitchen"}).SetVolume("Kitchen", 30).SetShuffle(true).PlayPlaylist("PL1").NowPlaying()
+	res, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("calls=%d, want 1", calls)
+	}
+	for _, want := range []string{`set current AirPlay devices to {AirPlay device "Kitchen"}`, `set sound volume of (AirPlay device "Kitchen") to 30`, "set shuffle enabled to true", `persistent ID is "PL1"`, "set ps to (player state as text)"} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script missing %q:\n%s", want, script)
+		}
+	}
+	if len(res.Steps) != 4 || !res.Steps[3].OK || res.Steps[3].Op != "play playlist PL1" {
+		t.Fatalf("steps=%+v", res.Steps)
+	}
+	if res.NowPlaying == nil || res.NowPlaying.PlaylistID != "PL1" || len(res.NowPlaying.Outputs) != 1 || res.NowPlaying.Outputs[0].Volume != 30 {
+		t.Fatalf("nowPlaying=%+v", res.NowPlaying)
+	}
+}
+
+func TestBatch_RunStopsAtFailedStep(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
+		return []byte("ok\nerror\tCan't get AirPlay device \"Attic\".\n"), nil
+	}
+	res, err := NewBatch().SetOutputs([]string{"Kitchen"}).SetVolume("Attic", 20).SetShuffle(false).Run(context.Background())
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) || !strings.Contains(err.Error(), "set volume Attic=20") {
+		t.Fatalf("err=%v", err)
+	}
+	if !res.Steps[0].OK || res.Steps[1].Error == "" || res.Steps[2].OK || res.Steps[2].Error != "" {
+		t.Fatalf("steps=%+v", res.Steps)
+	}
+
+	if _, err := NewBatch().SetVolume("Kitchen", 101).Run(context.Background()); err == nil {
+		t.Fatalf("expected out-of-range volume to fail before running")
+	}
+}
+
+func TestBatch_BeforeReadsStateFirst(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var script string
+	runAppleScriptExec = func(_ context.Context, s string) ([]byte, error) {
+		script = s
+		return []byte(strings.Join([]string{
+			"before\tpaused\t12\tfalse\toff\tChill\tPL1\tSong\tArtist\tAlbum\t200\tTR1",
+			"bdev\tBedroom\tHomePod\ttrue\ttrue\ttrue\t25\t\tD2",
+			"error\tCan't get AirPlay device \"Attic\".",
+			"",
+		}, "\n")), nil
+	}
+	res, err := NewBatch().SetOutputs([]string{"Attic"}).Before().Run(context.Background())
+	if err == nil {
+		t.Fatalf("expected the failed step")
+	}
+	if i, j := strings.Index(script, `"before"`), strings.Index(script, "set current AirPlay devices"); i < 0 || i > j {
+		t.Fatalf("state is not read first:\n%s", script)
+	}
+	if b := res.Before; b == nil || b.PlaylistID != "PL1" || len(b.Outputs) != 1 || b.Outputs[0].Volume != 25 {
+		t.Fatalf("before=%+v", res.Before)
+	}
+}
+
+// fakeWorker answers each request line with the script upper-cased, or an
+// error for scripts starting with "fail".
+func fakeWorker() *Worker {
+	return &Worker{start: func() (io.WriteCloser, io.Reader, func(), error) {
+		reqR, reqW := io.Pipe()
+		respR, respW := io.Pipe()
+		go func() {
+			sc := bufio.NewScanner(reqR)
+			for sc.Scan() {
+				var req workerRequest
+				_ = json.Unmarshal(sc.Bytes(), &req)
+				resp := workerResponse{OK: true, Output: strings.ToUpper(req.Script)}
+				if strings.HasPrefix(req.Script, "fail") {
+					resp = workerResponse{Output: "execution error: boom (-1728)"}
+				}
+				b, _ := json.Marshal(resp)
+				if _, err := respW.Write(append(b, '\n')); err != nil {
+					return
+				}
+			}
+		}()
+		stop := func() {
+			_ = reqR.Close()
+			_ = respW.Close()
+		}
+		return reqW, respR, stop, nil
+	}}
+}
+
+func TestDaemonServesScriptsAndFallsBack(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		UseDaemon("")
+	})
+	localCalls := 0
+	runAppleScriptExec = func(context.Context, string) ([]byte, error) {
+		localCalls++
+		return []byte("local"), nil
+	}
+
+	sock := filepath.Join(t.TempDir(), "d.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	w := fakeWorker()
+	defer w.Close()
+	go func() { _ = ServeDaemon(ln, w) }()
+	UseDaemon(sock)
+
+	if _, err := PingDaemon(context.Background(), sock); err != nil {
+		t.Fatalf("PingDaemon: %v", err)
+	}
+	out, err := runAppleScript(context.Background(), "return 1")
+	if err != nil || out != "RETURN 1" || localCalls != 0 {
+		t.Fatalf("out=%q err=%v localCalls=%d", out, err, localCalls)
+	}
+	_, err = runAppleScript(context.Background(), "fail now")
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) || !strings.Contains(scriptErr.Output, "-1728") {
+		t.Fatalf("err=%v", err)
+	}
+
+	_ = ln.Close()
+	out, err = runAppleScript(context.Background(), "return 1")
+	if err != nil || out != "local" || localCalls != 1 {
+		t.Fatalf("fallback out=%q err=%v localCalls=%d", out, err, localCalls)
+	}
+}
+
+func TestJXAEngine_DecodesJSONAndFallsBack(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	jxaFails := false
+	var jxaCalls, asCalls int
+	runAppleScriptExec = func(_ context.Context, script string) ([]byte, error) {
+		if strings.Contains(script, `in "JavaScript"`) {
+			jxaCalls++
+			if jxaFails {
+				return []byte("execution error: Error: SyntaxError (-2700)"), errors.New("exit status 1")
+			}
+			switch {
+			case strings.Contains(script, "m.userPlaylists"):
+				return []byte(`[{"persistentID":"AA11","name":"Tabs\tand\nnewlines","smart":true,"genius":false}]`), nil
+			case strings.Contains(script, "currentTrack"):
+				return []byte(`{"playerState":"playing","playerPositionSeconds":12.5,"shuffleEnabled":true,"songRepeat":"all","playlistName":"Chill","playlistPersistentID":"PL1","track":{"name":"Song","durationSeconds":200},"outputs":[{"name":"Kitchen","selected":true,"volume":35}]}`), nil
+			}
+			return []byte(`[{"name":"Kitchen","kind":"HomePod","available":true,"selected":true,"active":true,"volume":35,"networkAddress":"","persistentID":"D1"}]`), nil
+		}
+		asCalls++
+		return []byte("Bedroom\tHomePod\ttrue\tfalse\tfalse\t20\t\tD2\n"), nil
+	}
+
+	e := JXAEngine()
+	playlists, err := e.ListUserPlaylists(context.Background())
+	if err != nil || len(playlists) != 1 || playlists[0].Name != "Tabs\tand\nnewlines" || !playlists[0].Smart {
+		t.Fatalf("playlists=%+v err=%v", playlists, err)
+	}
+	np, err := e.NowPlaying(context.Background())
+	if err != nil || np.PlaylistID != "PL1" || np.PlayerPositionS != 12.5 || np.SongRepeat != "all" || len(np.Outputs) != 1 || np.Outputs[0].Volume != 35 {
+		t.Fatalf("np=%+v err=%v", np, err)
+	}
+	devs, err := e.ListAirPlayDevices(context.Background())
+	if err != nil || len(devs) != 1 || devs[0].PersistentID != "D1" || asCalls != 0 {
+		t.Fatalf("devs=%+v err=%v asCalls=%d", devs, err, asCalls)
+	}
+
+	jxaFails = true
+	devs, err = e.ListAirPlayDevices(context.Background())
+	if err != nil || len(devs) != 1 || devs[0].Name != "Bedroom" || asCalls != 1 {
+		t.Fatalf("fallback devs=%+v err=%v asCalls=%d", devs, err, asCalls)
+	}
+}
+
+func TestSetEngineRoutesPublicReads(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() {
+		runAppleScriptExec = origExec
+		SetEngine(nil)
+	})
+	var scripts []string
+	runAppleScriptExec = func(_ context.Context, script string) ([]byte, error) {
+		scripts = append(scripts, script)
+		return []byte(`[{"name":"Kitchen","selected":true}]`), nil
+	}
+	SetEngine(JXAEngine())
+	devs, err := ListAirPlayDevices(context.Background())
+	if err != nil || len(devs) != 1 || len(scripts) != 1 || !strings.Contains(scripts[0], `in "JavaScript"`) {
+		t.Fatalf("devs=%+v err=%v scripts=%d", devs, err, len(scripts))
+	}
+}
+
+func TestClassifyAutomationError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want AutomationPermission
+	}{
+		{nil, AutomationGranted},
+		{&ScriptError{Err: errors.New("exit status 1"), Output: "execution error: Not authorized to send Apple events to Music. (-1743)"}, AutomationDenied},
+		{errors.New("osascript: Not authorised to send Apple events"), AutomationDenied},
+		{&ScriptError{Err: errors.New("exit status 1"), Output: "(-1744)"}, AutomationUndetermined},
+		{errors.New("Music got an error: AppleEvent timed out. (-1712)"), AutomationUnknown},
+	}
+	for _, tc := range cases {
+		if got := ClassifyAutomationError(tc.err); got != tc.want {
+			t.Errorf("ClassifyAutomationError(%v)=%q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,698 @@
+// Package musictest provides an in-memory music.Engine, so commands can be
+// exercised end to end without macOS or Music.app.
+package musictest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+)
+
+// Engine is an in-memory Music.app. Set the exported fields before use and
+// inspect them (or Calls) afterwards; methods lock mu, so read fields only
+// once the code under test is done.
+type Engine struct {
+	mu sync.Mutex
+
+	Devices   []music.AirPlayDevice
+	Playlists []music.UserPlaylist
+	// Tracks is the library. PlaylistTracks maps a playlist persistent ID to
+	// its track IDs in order, duplicates included.
+	Tracks         []music.LibraryItem
+	PlaylistTracks map[string][]string
+	// PlayedDates and Bookmarks hold a track's last played date and saved
+	// position, by track ID.
+	PlayedDates map[string]time.Time
+	Bookmarks   map[string]float64
+
+	// Running is whether Music.app is running; LaunchApp sets it.
+	Running bool
+	// Player is the player state; its Outputs are derived from Devices.
+	Player   music.NowPlaying
+	Loved    bool
+	Disliked bool
+	Rating   int
+	Lyrics   string
+	// SoundVolume is Music.app's master volume.
+	SoundVolume int
+	// ShuffleMode and Crossfade (seconds, 0 for off) are Music.app settings
+	// the player state does not report.
+	ShuffleMode string
+	Crossfade   int
+	// EQPresets are Music.app's presets; SetEQPreset marks one Current.
+	EQPresets []music.EQPreset
+	Artwork   []byte // written as JPEG by ExportCurrentArtwork
+	// SpeechS is the length of every announcement PlaySpeech plays.
+	SpeechS float64
+	// Stations are the library's URL tracks and the radio tuner's stations.
+	Stations []music.Station
+
+	// JoinFailures makes the named device ignore that many selections before
+	// it joins, the way a HomePod waking from standby can.
+	JoinFailures map[string]int
+	// Errors makes the named method (e.g. "SetAirPlayDeviceVolume") fail.
+	Errors map[string]error
+	// Calls records each method call as "Method arg1 arg2".
+	Calls []string
+
+	nextID int
+}
+
+var _ music.Engine = (*Engine)(nil)
+
+// New returns an engine with the given AirPlay devices and playlists and a
+// stopped player.
+func New(devices []music.AirPlayDevice, playlists []music.UserPlaylist) *Engine {
+	return &Engine{
+		Devices:        devices,
+		Playlists:      playlists,
+		PlaylistTracks: map[string][]string{},
+		Running:        true,
+		Player:         music.NowPlaying{PlayerState: "stopped", SongRepeat: "off"},
+	}
+}
+
+// Install makes e the engine behind the music package until the test ends.
+func Install(t interface{ Cleanup(func()) }, e *Engine) {
+	prev := music.CurrentEngine()
+	music.SetEngine(e)
+	t.Cleanup(func() { music.SetEngine(prev) })
+}
+
+func (e *Engine) call(name string, args ...any) error {
+	parts := []string{name}
+	for _, a := range args {
+		parts = append(parts, fmt.Sprint(a))
+	}
+	e.Calls = append(e.Calls, strings.Join(parts, " "))
+	return e.Errors[name]
+}
+
+// CallsTo returns the recorded calls of the named method.
+func (e *Engine) CallsTo(name string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []string
+	for _, c := range e.Calls {
+		if c == name || strings.HasPrefix(c, name+" ") {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (e *Engine) device(name string) (*music.AirPlayDevice, error) {
+	for i := range e.Devices {
+		if e.Devices[i].Name == name {
+			return &e.Devices[i], nil
+		}
+	}
+	return nil, fmt.Errorf("AirPlay device %q not found", name)
+}
+
+func (e *Engine) playlist(id string) (*music.UserPlaylist, error) {
+	for i := range e.Playlists {
+		if e.Playlists[i].PersistentID == id {
+			return &e.Playlists[i], nil
+		}
+	}
+	return nil, fmt.Errorf("user playlist %q not found", id)
+}
+
+func (e *Engine) track(id string) (music.LibraryItem, error) {
+	for _, t := range e.Tracks {
+		if t.PersistentID == id {
+			return t, nil
+		}
+	}
+	return music.LibraryItem{}, fmt.Errorf("track %q not found", id)
+}
+
+func (e *Engine) AppRunning(context.Context) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("AppRunning"); err != nil {
+		return false, err
+	}
+	return e.Running, nil
+}
+
+func (e *Engine) LaunchApp(_ context.Context, hidden bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("LaunchApp", hidden); err != nil {
+		return err
+	}
+	e.Running = true
+	return nil
+}
+
+func (e *Engine) ListAirPlayDevices(context.Context) ([]music.AirPlayDevice, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("ListAirPlayDevices"); err != nil {
+		return nil, err
+	}
+	return append([]music.AirPlayDevice(nil), e.Devices...), nil
+}
+
+func (e *Engine) SetCurrentAirPlayDevices(_ context.Context, deviceNames []string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetCurrentAirPlayDevices", strings.Join(deviceNames, ",")); err != nil {
+		return err
+	}
+	want := map[string]bool{}
+	for _, name := range deviceNames {
+		if _, err := e.device(name); err != nil {
+			return err
+		}
+		if e.JoinFailures[name] > 0 {
+			e.JoinFailures[name]--
+			continue
+		}
+		want[name] = true
+	}
+	for i := range e.Devices {
+		e.Devices[i].Selected = want[e.Devices[i].Name]
+		e.Devices[i].Active = want[e.Devices[i].Name] && e.Player.PlayerState == "playing"
+	}
+	return nil
+}
+
+func (e *Engine) SetAirPlayDeviceVolume(_ context.Context, deviceName string, volume int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetAirPlayDeviceVolume", deviceName, volume); err != nil {
+		return err
+	}
+	d, err := e.device(deviceName)
+	if err != nil {
+		return err
+	}
+	d.Volume = volume
+	return nil
+}
+
+func (e *Engine) SetSoundVolume(_ context.Context, volume int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetSoundVolume", volume); err != nil {
+		return err
+	}
+	e.SoundVolume = volume
+	return nil
+}
+
+func (e *Engine) SetShuffleEnabled(_ context.Context, enabled bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetShuffleEnabled", enabled); err != nil {
+		return err
+	}
+	e.Player.ShuffleEnabled = enabled
+	return nil
+}
+
+func (e *Engine) SetShuffleMode(_ context.Context, mode string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetShuffleMode", mode); err != nil {
+		return err
+	}
+	e.ShuffleMode = mode
+	return nil
+}
+
+func (e *Engine) SetCrossfade(_ context.Context, seconds int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetCrossfade", seconds); err != nil {
+		return err
+	}
+	e.Crossfade = seconds
+	return nil
+}
+
+func (e *Engine) ListEQPresets(context.Context) ([]music.EQPreset, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("ListEQPresets"); err != nil {
+		return nil, err
+	}
+	return append([]music.EQPreset(nil), e.EQPresets...), nil
+}
+
+func (e *Engine) SetEQPreset(_ context.Context, name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetEQPreset", name); err != nil {
+		return err
+	}
+	found := false
+	for i := range e.EQPresets {
+		e.EQPresets[i].Current = e.EQPresets[i].Name == name
+		found = found || e.EQPresets[i].Current
+	}
+	if !found {
+		return fmt.Errorf("EQ preset %q not found", name)
+	}
+	return nil
+}
+
+func (e *Engine) SetSongRepeat(_ context.Context, mode string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetSongRepeat", mode); err != nil {
+		return err
+	}
+	e.Player.SongRepeat = mode
+	return nil
+}
+
+func (e *Engine) SetPlayerPosition(_ context.Context, seconds float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetPlayerPosition", seconds); err != nil {
+		return err
+	}
+	e.Player.PlayerPositionS = seconds
+	return nil
+}
+
+func (e *Engine) SetCurrentTrackLoved(_ context.Context, loved bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetCurrentTrackLoved", loved); err != nil {
+		return err
+	}
+	e.Loved = loved
+	if loved {
+		e.Disliked = false
+	}
+	return nil
+}
+
+func (e *Engine) SetCurrentTrackDisliked(_ context.Context, disliked bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetCurrentTrackDisliked", disliked); err != nil {
+		return err
+	}
+	e.Disliked = disliked
+	if disliked {
+		e.Loved = false
+	}
+	return nil
+}
+
+func (e *Engine) SetCurrentTrackRating(_ context.Context, stars int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SetCurrentTrackRating", stars); err != nil {
+		return err
+	}
+	e.Rating = stars
+	return nil
+}
+
+func (e *Engine) ExportCurrentArtwork(_ context.Context, path string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("ExportCurrentArtwork", path); err != nil {
+		return "", err
+	}
+	if len(e.Artwork) == 0 {
+		return "", music.ErrNoArtwork
+	}
+	if err := os.WriteFile(path, e.Artwork, 0o644); err != nil {
+		return "", err
+	}
+	return "jpeg", nil
+}
+
+// PlaySpeech plays an announcement track SpeechS seconds long.
+func (e *Engine) PlaySpeech(_ context.Context, text, voice string) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("PlaySpeech", text, voice); err != nil {
+		return 0, err
+	}
+	e.Player.PlaylistName, e.Player.PlaylistID = "", ""
+	e.Player.Source = music.SourceLibrary
+	e.Player.PlayerPositionS = 0
+	e.Player.Track = music.NowPlayingTrack{Name: "homepodctl-announce", DurationS: e.SpeechS}
+	e.setState("playing")
+	return e.SpeechS, nil
+}
+
+// RemoveSpeech records the call; PlaySpeech adds nothing to Tracks.
+func (e *Engine) RemoveSpeech(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.call("RemoveSpeech")
+}
+
+func (e *Engine) ListStations(context.Context) ([]music.Station, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("ListStations"); err != nil {
+		return nil, err
+	}
+	return append([]music.Station(nil), e.Stations...), nil
+}
+
+func (e *Engine) PlayStation(_ context.Context, persistentID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("PlayStation", persistentID); err != nil {
+		return err
+	}
+	for _, s := range e.Stations {
+		if s.PersistentID == persistentID {
+			e.Player.PlaylistName, e.Player.PlaylistID = "", ""
+			e.Player.Source = music.SourceRadio
+			e.Player.PlayerPositionS = 0
+			e.Player.Track = music.NowPlayingTrack{Name: s.Name, PersistentID: s.PersistentID}
+			e.setState("playing")
+			return nil
+		}
+	}
+	return fmt.Errorf("station %s not found", persistentID)
+}
+
+func (e *Engine) CurrentLyrics(context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("CurrentLyrics"); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(e.Lyrics) == "" {
+		return "", music.ErrNoLyrics
+	}
+	return e.Lyrics, nil
+}
+
+func (e *Engine) ListUserPlaylists(context.Context) ([]music.UserPlaylist, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("ListUserPlaylists"); err != nil {
+		return nil, err
+	}
+	out := make([]music.UserPlaylist, 0, len(e.Playlists))
+	for _, p := range e.Playlists {
+		p.Plays, p.Modified = 0, nil
+		if ids := e.PlaylistTracks[p.PersistentID]; len(ids) > 0 {
+			p.TrackCount, p.DurationS = len(ids), 0
+			for _, id := range ids {
+				if t, err := e.track(id); err == nil {
+					p.DurationS += t.DurationS
+				}
+			}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (e *Engine) PlaylistPlayCounts(context.Context) ([]music.UserPlaylist, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("PlaylistPlayCounts"); err != nil {
+		return nil, err
+	}
+	var out []music.UserPlaylist
+	for _, p := range e.Playlists {
+		if !p.Smart && !p.Genius {
+			out = append(out, music.UserPlaylist{PersistentID: p.PersistentID, Name: p.Name, Plays: p.Plays})
+		}
+	}
+	return out, nil
+}
+
+func (e *Engine) PlaylistsLastAdded(context.Context) (map[string]time.Time, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("PlaylistsLastAdded"); err != nil {
+		return nil, err
+	}
+	added := map[string]time.Time{}
+	for _, p := range e.Playlists {
+		if p.Modified != nil {
+			added[p.PersistentID] = *p.Modified
+		}
+	}
+	return added, nil
+}
+
+func (e *Engine) PlaylistName(_ context.Context, persistentID string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("PlaylistName", persistentID); err != nil {
+		return "", err
+	}
+	p, err := e.playlist(persistentID)
+	if err != nil {
+		return "", err
+	}
+	return p.Name, nil
+}
+
+func (e *Engine) PlayPlaylist(_ context.Context, persistentID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("PlayPlaylist", persistentID); err != nil {
+		return err
+	}
+	p, err := e.playlist(persistentID)
+	if err != nil {
+		return err
+	}
+	e.startPlaylist(p, 1)
+	return nil
+}
+
+// startPlaylist plays p from its index-th (1-based) track.
+func (e *Engine) startPlaylist(p *music.UserPlaylist, index int) {
+	e.Player.PlaylistName, e.Player.PlaylistID = p.Name, p.PersistentID
+	e.Player.Source = music.SourcePlaylist
+	e.Player.PlayerPositionS = 0
+	e.Player.Track = music.NowPlayingTrack{}
+	if ids := e.PlaylistTracks[p.PersistentID]; index <= len(ids) {
+		if t, err := e.track(ids[index-1]); err == nil {
+			e.Player.Track = music.NowPlayingTrack{Name: t.Name, Artist: t.Artist, Album: t.Album, DurationS: t.DurationS, PersistentID: t.PersistentID}
+		}
+	}
+	e.setState("playing")
+}
+
+func (e *Engine) ListPlaylistTracks(_ context.Context, persistentID string) ([]music.PlaylistTrack, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("ListPlaylistTracks", persistentID); err != nil {
+		return nil, err
+	}
+	if _, err := e.playlist(persistentID); err != nil {
+		return nil, err
+	}
+	var tracks []music.PlaylistTrack
+	for i, id := range e.PlaylistTracks[persistentID] {
+		t, err := e.track(id)
+		if err != nil {
+			return nil, err
+		}
+		pt := music.PlaylistTrack{Index: i + 1, PersistentID: t.PersistentID, Name: t.Name, Artist: t.Artist, DurationS: t.DurationS, BookmarkS: e.Bookmarks[id]}
+		if played, ok := e.PlayedDates[id]; ok {
+			pt.PlayedAt = &played
+		}
+		tracks = append(tracks, pt)
+	}
+	return tracks, nil
+}
+
+func (e *Engine) PlayPlaylistTrack(_ context.Context, persistentID string, index int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("PlayPlaylistTrack", persistentID, index); err != nil {
+		return err
+	}
+	p, err := e.playlist(persistentID)
+	if err != nil {
+		return err
+	}
+	if index < 1 || index > len(e.PlaylistTracks[persistentID]) {
+		return fmt.Errorf("playlist %q has no track %d", p.Name, index)
+	}
+	e.startPlaylist(p, index)
+	return nil
+}
+
+func (e *Engine) CreateUserPlaylist(_ context.Context, name string) (music.UserPlaylist, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("CreateUserPlaylist", name); err != nil {
+		return music.UserPlaylist{}, err
+	}
+	e.nextID++
+	p := music.UserPlaylist{PersistentID: fmt.Sprintf("FAKE%012X", e.nextID), Name: name}
+	e.Playlists = append(e.Playlists, p)
+	return p, nil
+}
+
+func (e *Engine) AddTrackToUserPlaylist(_ context.Context, playlistID, trackID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("AddTrackToUserPlaylist", playlistID, trackID); err != nil {
+		return err
+	}
+	if _, err := e.playlist(playlistID); err != nil {
+		return err
+	}
+	if _, err := e.track(trackID); err != nil {
+		return err
+	}
+	if e.PlaylistTracks == nil {
+		e.PlaylistTracks = map[string][]string{}
+	}
+	e.PlaylistTracks[playlistID] = append(e.PlaylistTracks[playlistID], trackID)
+	return nil
+}
+
+func (e *Engine) RemoveTrackFromUserPlaylist(_ context.Context, playlistID, trackID string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("RemoveTrackFromUserPlaylist", playlistID, trackID); err != nil {
+		return 0, err
+	}
+	if _, err := e.playlist(playlistID); err != nil {
+		return 0, err
+	}
+	var kept []string
+	removed := 0
+	for _, id := range e.PlaylistTracks[playlistID] {
+		if id == trackID {
+			removed++
+			continue
+		}
+		kept = append(kept, id)
+	}
+	e.PlaylistTracks[playlistID] = kept
+	return removed, nil
+}
+
+func (e *Engine) ClearUserPlaylist(_ context.Context, playlistID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("ClearUserPlaylist", playlistID); err != nil {
+		return err
+	}
+	if _, err := e.playlist(playlistID); err != nil {
+		return err
+	}
+	delete(e.PlaylistTracks, playlistID)
+	return nil
+}
+
+// SearchTracks matches query case-insensitively against the field that only
+// scopes: track names for songs, albums, or artists.
+func (e *Engine) SearchTracks(_ context.Context, query, only string) ([]music.LibraryItem, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("SearchTracks", query, only); err != nil {
+		return nil, err
+	}
+	needle := strings.ToLower(query)
+	var out []music.LibraryItem
+	for _, t := range e.Tracks {
+		field := t.Name
+		switch only {
+		case "albums":
+			field = t.Album
+		case "artists":
+			field = t.Artist
+		}
+		if strings.Contains(strings.ToLower(field), needle) {
+			t.Kind = "track"
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (e *Engine) transport(name, state string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call(name); err != nil {
+		return err
+	}
+	switch {
+	case state == "toggle" && e.Player.PlayerState == "playing":
+		e.setState("paused")
+	case state == "toggle":
+		e.setState("playing")
+	case state != "":
+		e.setState(state)
+	}
+	return nil
+}
+
+func (e *Engine) setState(state string) {
+	e.Player.PlayerState = state
+	for i := range e.Devices {
+		e.Devices[i].Active = e.Devices[i].Selected && state == "playing"
+	}
+}
+
+func (e *Engine) Play(context.Context) error  { return e.transport("Play", "playing") }
+func (e *Engine) Pause(context.Context) error { return e.transport("Pause", "paused") }
+func (e *Engine) Stop(context.Context) error  { return e.transport("Stop", "stopped") }
+
+func (e *Engine) PlayPause(context.Context) error { return e.transport("PlayPause", "toggle") }
+
+func (e *Engine) NextTrack(context.Context) error     { return e.transport("NextTrack", "") }
+func (e *Engine) PreviousTrack(context.Context) error { return e.transport("PreviousTrack", "") }
+
+func (e *Engine) Status(context.Context) (music.Status, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("Status"); err != nil {
+		return music.Status{}, err
+	}
+	return music.Status{
+		PlayerState: e.Player.PlayerState,
+		TrackName:   e.Player.Track.Name,
+		Artist:      e.Player.Track.Artist,
+		Album:       e.Player.Track.Album,
+	}, nil
+}
+
+func (e *Engine) NowPlaying(context.Context) (music.NowPlaying, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("NowPlaying"); err != nil {
+		return music.NowPlaying{}, err
+	}
+	np := e.Player
+	np.Outputs = nil
+	for _, d := range e.Devices {
+		if d.Selected {
+			np.Outputs = append(np.Outputs, d)
+		}
+	}
+	return np, nil
+}
+
+func (e *Engine) RunBatch(ctx context.Context, b *music.Batch) (music.BatchResult, error) {
+	e.mu.Lock()
+	err := e.call("RunBatch", strings.Join(b.Ops(), "; "))
+	e.mu.Unlock()
+	if err != nil {
+		return music.BatchResult{}, err
+	}
+	return music.RunBatchSteps(ctx, e, b)
+}
@@ -0,0 +1,169 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPlaylistCacheTTL is how long a cached playlist list is trusted
+// before it is rebuilt even if the playlist count did not change.
+const DefaultPlaylistCacheTTL = time.Hour
+
+// playlistCacheVersion changes whenever UserPlaylist gains fields, so caches
+// written without them are rebuilt instead of served.
+const playlistCacheVersion = 3
+
+type playlistCacheFile struct {
+	Version   int            `json:"version"`
+	CachedAt  time.Time      `json:"cachedAt"`
+	Count     int            `json:"count"`
+	Playlists []UserPlaylist `json:"playlists"`
+}
+
+var (
+	playlistCachePath string
+	playlistCacheTTL  = DefaultPlaylistCacheTTL
+)
+
+// SetPlaylistCache makes playlist lookups reuse the list stored at path for
+// up to ttl, as long as Music.app still reports the same playlist count. An
+// empty path disables the cache.
+func SetPlaylistCache(path string, ttl time.Duration) {
+	playlistCachePath = path
+	if ttl <= 0 {
+		ttl = DefaultPlaylistCacheTTL
+	}
+	playlistCacheTTL = ttl
+}
+
+// CountUserPlaylists returns the number of user playlists; it is much cheaper
+// than enumerating them.
+func CountUserPlaylists(ctx context.Context) (int, error) {
+	out, err := runAppleScript(ctx, `
+tell application "Music"
+	return count of user playlists
+end tell
+`)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+// RefreshPlaylistCache rebuilds the cache from Music.app and returns the
+// fresh list.
+func RefreshPlaylistCache(ctx context.Context) ([]UserPlaylist, error) {
+	playlists, err := listAllUserPlaylists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if playlistCachePath != "" {
+		if err := writePlaylistCache(playlists); err != nil {
+			return nil, err
+		}
+	}
+	return playlists, nil
+}
+
+// ClearPlaylistCache deletes the cache file. A missing file is not an error.
+func ClearPlaylistCache() error {
+	if playlistCachePath == "" {
+		return nil
+	}
+	if err := os.Remove(playlistCachePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CachedUserPlaylists returns the cached playlist list without asking
+// Music.app, however old it is; ok is false when there is no usable cache.
+func CachedUserPlaylists() (playlists []UserPlaylist, ok bool) {
+	if playlistCachePath == "" {
+		return nil, false
+	}
+	c, ok := readPlaylistCache()
+	if !ok {
+		return nil, false
+	}
+	return c.Playlists, true
+}
+
+// PlaylistCachedAt returns when the cached playlist list was read from
+// Music.app; ok is false when there is no usable cache.
+func PlaylistCachedAt() (cachedAt time.Time, ok bool) {
+	if playlistCachePath == "" {
+		return time.Time{}, false
+	}
+	c, ok := readPlaylistCache()
+	return c.CachedAt, ok
+}
+
+func cachedUserPlaylists(ctx context.Context) ([]UserPlaylist, error) {
+	if playlistCachePath == "" {
+		return listAllUserPlaylists(ctx)
+	}
+	if c, ok := readPlaylistCache(); ok && time.Since(c.CachedAt) < playlistCacheTTL {
+		n, err := CountUserPlaylists(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if n == c.Count {
+			logDebug("playlist cache hit", "count", n)
+			return c.Playlists, nil
+		}
+		logDebug("playlist cache stale", "cached", c.Count, "count", n)
+	}
+	playlists, err := listAllUserPlaylists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePlaylistCache(playlists); err != nil {
+		logDebug("playlist cache write failed", "error", err.Error())
+	}
+	return playlists, nil
+}
+
+func readPlaylistCache() (playlistCacheFile, bool) {
+	var c playlistCacheFile
+	b, err := os.ReadFile(playlistCachePath)
+	if err != nil {
+		return c, false
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.Version != playlistCacheVersion {
+		return c, false
+	}
+	return c, true
+}
+
+func writePlaylistCache(playlists []UserPlaylist) error {
+	return writeCacheFile(playlistCachePath, playlistCacheFile{Version: playlistCacheVersion, CachedAt: time.Now().UTC(), Count: len(playlists), Playlists: playlists})
+}
+
+// writeCacheFile replaces the cache file at path with v as JSON, through a
+// temporary file so readers never see a partial write.
+func writeCacheFile(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func logDebug(msg string, args ...any) {
+	if logger != nil {
+		logger.Debug(msg, args...)
+	}
+}
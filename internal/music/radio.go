@@ -0,0 +1,110 @@
+package music
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Station is an Internet radio stream Music.app can play: a URL track in the
+// library, such as an Apple Music radio station added to it or a stream
+// added with File > Open Stream URL, or a station of the radio tuner.
+type Station struct {
+	PersistentID string `json:"persistentID"`
+	Name         string `json:"name"`
+	URL          string `json:"url,omitempty"`
+	Source       string `json:"source"` // library|tuner
+}
+
+// ListStations returns the URL tracks of the library followed by the
+// radio tuner's stations.
+func ListStations(ctx context.Context) ([]Station, error) {
+	return engine.ListStations(ctx)
+}
+
+func (appleScriptEngine) ListStations(ctx context.Context) ([]Station, error) {
+	out, err := runAppleScript(ctx, `
+tell application "Music"
+	set out to ""
+	repeat with t in (every URL track of library playlist 1)
+		set out to out & (persistent ID of t) & tab & (name of t) & tab & (address of t) & tab & "library" & linefeed
+	end repeat
+	try
+		repeat with p in radio tuner playlists
+			repeat with t in (every URL track of p)
+				set out to out & (persistent ID of t) & tab & (name of t) & tab & (address of t) & tab & "tuner" & linefeed
+			end repeat
+		end repeat
+	end try
+	return out
+end tell
+`)
+	if err != nil {
+		return nil, err
+	}
+	var stations []Station
+	for _, line := range splitNonEmptyLines(out) {
+		parts := strings.Split(line, "\t")
+		if len(parts) < 4 {
+			continue
+		}
+		url := strings.TrimSpace(parts[2])
+		if url == "missing value" {
+			url = ""
+		}
+		stations = append(stations, Station{
+			PersistentID: strings.TrimSpace(parts[0]),
+			Name:         strings.TrimSpace(parts[1]),
+			URL:          url,
+			Source:       strings.TrimSpace(parts[3]),
+		})
+	}
+	return stations, nil
+}
+
+// PickBestStation returns the station whose name matches query best, the
+// way play picks playlists.
+func PickBestStation(query string, stations []Station) (Station, bool) {
+	var best Station
+	bestScore := 0
+	for _, s := range stations {
+		if score := MatchScore(query, s.Name); score > bestScore {
+			best, bestScore = s, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+// PlayStation starts the station with the given persistent ID.
+func PlayStation(ctx context.Context, persistentID string) error {
+	persistentID = strings.TrimSpace(persistentID)
+	if persistentID == "" {
+		return fmt.Errorf("persistentID is required")
+	}
+	return engine.PlayStation(ctx, persistentID)
+}
+
+func (appleScriptEngine) PlayStation(ctx context.Context, persistentID string) error {
+	_, err := runAppleScript(ctx, "\ntell application \"Music\"\n\t"+playStationScript(persistentID)+"\nend tell\n")
+	return err
+}
+
+// playStationScript finds a station in the library, then in the radio
+// tuner, and plays it. It runs inside a tell block.
+func playStationScript(persistentID string) string {
+	id := QuoteAppleScriptString(persistentID)
+	return fmt.Sprintf(`set st to missing value
+	try
+		set st to (first URL track of library playlist 1 whose persistent ID is %[1]s)
+	end try
+	if st is missing value then
+		repeat with p in radio tuner playlists
+			try
+				set st to (first URL track of p whose persistent ID is %[1]s)
+				exit repeat
+			end try
+		end repeat
+	end if
+	if st is missing value then error "station " & %[1]s & " not found"
+	play st`, id)
+}
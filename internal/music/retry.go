@@ -0,0 +1,134 @@
+package music
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agisilaos/homepodctl/internal/transport"
+)
+
+// RetryPolicy controls how failed osascript calls are retried.
+type RetryPolicy struct {
+	// Retries is how many times a failed call is retried; 0 disables retries.
+	Retries int
+	// Backoff is the wait before the first retry. It doubles on each further
+	// retry, up to MaxBackoff when that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable classifies a failure from its error and osascript output. Nil
+	// retries AppleEvent timeouts (-1712), busy or invalid connections, and
+	// exits without output; cancellations and deadlines are never retried.
+	Retryable func(err error, output string) bool
+}
+
+// outputSelectBackoff is the shortest wait between AirPlay selection retries.
+// A HomePod waking from standby takes a second or two to accept a selection,
+// so shorter waits just spend the retries on -1712 timeouts.
+const outputSelectBackoff = time.Second
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Retries: 2, Backoff: 150 * time.Millisecond, MaxBackoff: 2 * time.Second}
+}
+
+var retryPolicy = DefaultRetryPolicy()
+
+// SetRetryPolicy replaces the policy used for every osascript call. Negative
+// counts and durations are treated as zero.
+func SetRetryPolicy(p RetryPolicy) {
+	p.Retries = max(p.Retries, 0)
+	p.Backoff = max(p.Backoff, 0)
+	p.MaxBackoff = max(p.MaxBackoff, 0)
+	retryPolicy = p
+}
+
+func (p RetryPolicy) retryable(err error, output string) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err, output)
+	}
+	return shouldRetryAppleScript(err, output)
+}
+
+// backoff returns the wait before retry number attempt+1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < attempt; i++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// forOutputs stretches the backoff for AirPlay selection, see
+// outputSelectBackoff.
+func (p RetryPolicy) forOutputs() RetryPolicy {
+	if p.Retries == 0 || p.Backoff >= outputSelectBackoff {
+		return p
+	}
+	p.Backoff = outputSelectBackoff
+	if p.MaxBackoff > 0 && p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
+	}
+	return p
+}
+
+// selectOutputsScript selects the AirPlay devices in refs inside a tell
+// block. Within a batch there is no Go-side retry, so timeouts (-1712) are
+// retried in AppleScript with the output backoff.
+func selectOutputsScript(refs string, p RetryPolicy) string {
+	stmt := fmt.Sprintf(`set current AirPlay devices to {%s}`, refs)
+	p = p.forOutputs()
+	if p.Retries == 0 {
+		return stmt
+	}
+	tries := p.Retries + 1
+	delay := strconv.FormatFloat(p.Backoff.Seconds(), 'f', -1, 64)
+	return fmt.Sprintf(`repeat with attempt from 1 to %d
+			try
+				%s
+				exit repeat
+			on error errMsg number errNum
+				if attempt is %d or errNum is not -1712 then error errMsg number errNum
+				delay %s
+			end try
+		end repeat`, tries, stmt, tries, delay)
+}
+
+func shouldRetryAppleScript(err error, output string) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, transport.ErrUnreachable) {
+		return false
+	}
+	msg := strings.ToLower(strings.TrimSpace(output))
+	if msg == "" {
+		var exitErr *exec.ExitError
+		return errors.As(err, &exitErr)
+	}
+	transientMarkers := []string{
+		"connection is invalid",
+		"appleevent timed out",
+		"event timed out",
+		"timed out",
+		"resource busy",
+		"busy",
+		"(-1712)",
+		"(-600)",
+	}
+	for _, marker := range transientMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
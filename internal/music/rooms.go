@@ -0,0 +1,152 @@
+package music
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UnknownRoomError reports a room name that matches no AirPlay device, or
+// more than one equally well. Suggestions holds the closest device names.
+type UnknownRoomError struct {
+	Room        string
+	Suggestions []string
+	Ambiguous   bool
+}
+
+func (e *UnknownRoomError) Error() string {
+	quoted := make([]string, len(e.Suggestions))
+	for i, s := range e.Suggestions {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	switch {
+	case e.Ambiguous:
+		return fmt.Sprintf("room %q is ambiguous: matches %s (use the full name)", e.Room, strings.Join(quoted, ", "))
+	case len(quoted) > 0:
+		return fmt.Sprintf("unknown room %q (did you mean %s?)", e.Room, strings.Join(quoted, " or "))
+	default:
+		return fmt.Sprintf("unknown room %q (run `homepodctl devices` to list names)", e.Room)
+	}
+}
+
+// DeviceKinds are the kinds DeviceKind sorts AirPlay devices into.
+var DeviceKinds = []string{"homepod", "tv", "airport", "computer", "bluetooth", "other"}
+
+// DeviceKind maps the kind Music.app reports for an AirPlay device ("HomePod",
+// "Apple TV", "AirPort Express", ...) to one of DeviceKinds. Third-party
+// AirPlay speakers and unknown kinds are "other".
+func DeviceKind(kind string) string {
+	k := strings.ToLower(kind)
+	switch {
+	case strings.Contains(k, "homepod"):
+		return "homepod"
+	case strings.Contains(k, "tv"):
+		return "tv"
+	case strings.Contains(k, "airport"):
+		return "airport"
+	case strings.Contains(k, "computer"):
+		return "computer"
+	case strings.Contains(k, "bluetooth"):
+		return "bluetooth"
+	default:
+		return "other"
+	}
+}
+
+// maxRoomSuggestions caps the names listed in an UnknownRoomError.
+const maxRoomSuggestions = 3
+
+// ResolveRoom maps a room argument to the name of an AirPlay device. Names
+// match case-insensitively after canonicalization (see PickBestPlaylist).
+// Unless exact is set, a name that is a prefix or substring of exactly one
+// best-scoring device resolves to it, so "bedroom" finds "Bedroom HomePod".
+// Anything else returns an *UnknownRoomError with suggestions.
+func ResolveRoom(room string, devices []AirPlayDevice, exact bool) (string, error) {
+	target := strings.ToLower(canonicalizeName(room))
+	for _, d := range devices {
+		if strings.ToLower(canonicalizeName(d.Name)) == target {
+			return d.Name, nil
+		}
+	}
+	type scored struct {
+		name  string
+		score int
+	}
+	var matches []scored
+	for _, d := range devices {
+		if s := scoreMatch(target, strings.ToLower(canonicalizeName(d.Name))); s > 0 {
+			matches = append(matches, scored{d.Name, s})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	// Prefix and substring matches score above 1100 (see scoreMatch);
+	// subsequence matches are too loose to act on.
+	if !exact && len(matches) > 0 && matches[0].score > 1100 {
+		if len(matches) == 1 || matches[1].score < matches[0].score {
+			return matches[0].name, nil
+		}
+		var tied []string
+		for _, m := range matches {
+			if m.score == matches[0].score {
+				tied = append(tied, m.name)
+			}
+		}
+		return "", &UnknownRoomError{Room: room, Suggestions: tied, Ambiguous: true}
+	}
+
+	var suggestions []string
+	for _, m := range matches {
+		suggestions = append(suggestions, m.name)
+	}
+	if len(suggestions) == 0 {
+		suggestions = closestNames(target, devices)
+	}
+	if len(suggestions) > maxRoomSuggestions {
+		suggestions = suggestions[:maxRoomSuggestions]
+	}
+	return "", &UnknownRoomError{Room: room, Suggestions: suggestions}
+}
+
+// closestNames returns the device names within a small edit distance of
+// target, closest first, to catch typos like "Bedrom".
+func closestNames(target string, devices []AirPlayDevice) []string {
+	type scored struct {
+		name string
+		dist int
+	}
+	var near []scored
+	limit := max(2, len([]rune(target))/3)
+	for _, d := range devices {
+		if dist := editDistance(target, strings.ToLower(canonicalizeName(d.Name))); dist <= limit {
+			near = append(near, scored{d.Name, dist})
+		}
+	}
+	sort.SliceStable(near, func(i, j int) bool { return near[i].dist < near[j].dist })
+	names := make([]string, len(near))
+	for i, n := range near {
+		names[i] = n.name
+	}
+	return names
+}
+
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,79 @@
+package music
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OutputStatus reports whether one requested AirPlay device ended up
+// selected.
+type OutputStatus struct {
+	Room     string `json:"room"`
+	Selected bool   `json:"selected"`
+}
+
+// PartialSelectionError lists the requested AirPlay devices that Music.app
+// did not select. Music.app accepts the selection without complaint when a
+// device fails to join, so this only shows up by reading the devices back.
+type PartialSelectionError struct {
+	Missing []string
+}
+
+func (e *PartialSelectionError) Error() string {
+	return fmt.Sprintf("AirPlay selection incomplete: %s did not join", strings.Join(e.Missing, ", "))
+}
+
+// CheckAirPlaySelection compares the requested device names against devices
+// as read back from Music.app (ListAirPlayDevices or NowPlaying.Outputs). It
+// returns one status per requested name, and a *PartialSelectionError when
+// any is not selected.
+func CheckAirPlaySelection(deviceNames []string, devices []AirPlayDevice) ([]OutputStatus, error) {
+	statuses := make([]OutputStatus, 0, len(deviceNames))
+	var missing []string
+	for _, name := range deviceNames {
+		selected := false
+		for _, d := range devices {
+			if d.Selected && strings.EqualFold(strings.TrimSpace(d.Name), strings.TrimSpace(name)) {
+				selected = true
+				break
+			}
+		}
+		statuses = append(statuses, OutputStatus{Room: name, Selected: selected})
+		if !selected {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return statuses, &PartialSelectionError{Missing: missing}
+	}
+	return statuses, nil
+}
+
+// SelectAirPlayDevices selects deviceNames like SetCurrentAirPlayDevices,
+// then reads the devices back and selects again while some did not join,
+// following the retry policy with the AirPlay selection backoff. A selection
+// that stays incomplete returns the statuses with a *PartialSelectionError.
+func SelectAirPlayDevices(ctx context.Context, deviceNames []string) ([]OutputStatus, error) {
+	if len(deviceNames) == 0 {
+		return nil, nil
+	}
+	p := retryPolicy.forOutputs()
+	for attempt := 0; ; attempt++ {
+		if err := SetCurrentAirPlayDevices(ctx, deviceNames); err != nil {
+			return nil, err
+		}
+		devices, err := engine.ListAirPlayDevices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		statuses, err := CheckAirPlaySelection(deviceNames, devices)
+		if err == nil || attempt >= p.Retries {
+			return statuses, err
+		}
+		logDebug("airplay selection incomplete, selecting again", "error", err.Error(), "retry", attempt+1)
+		if err := sleepWithContextFn(ctx, p.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
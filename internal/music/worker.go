@@ -0,0 +1,183 @@
+package music
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// workerJXA runs inside one long-lived `osascript -l JavaScript` process. It
+// reads {"script": ...} lines from stdin and compiles and executes each with
+// NSAppleScript in-process, so the interpreter start and the Apple event
+// session with Music.app are paid once instead of per call.
+const workerJXA = `
+ObjC.import('Foundation');
+function run() {
+	const stdin = $.NSFileHandle.fileHandleWithStandardInput;
+	const stdout = $.NSFileHandle.fileHandleWithStandardOutput;
+	let buf = '';
+	for (;;) {
+		const data = stdin.availableData;
+		if (data.length === 0) {
+			return;
+		}
+		buf += $.NSString.alloc.initWithDataEncoding(data, $.NSUTF8StringEncoding).js;
+		let nl;
+		while ((nl = buf.indexOf('\n')) >= 0) {
+			const line = buf.slice(0, nl);
+			buf = buf.slice(nl + 1);
+			let resp;
+			try {
+				const req = JSON.parse(line);
+				const errInfo = Ref();
+				const result = $.NSAppleScript.alloc.initWithSource(req.script).executeAndReturnError(errInfo);
+				if (result.isNil()) {
+					const info = errInfo[0];
+					const msg = ObjC.unwrap(info.objectForKey('NSAppleScriptErrorMessage'));
+					const num = ObjC.unwrap(info.objectForKey('NSAppleScriptErrorNumber'));
+					resp = {ok: false, output: 'execution error: ' + msg + ' (' + num + ')'};
+				} else {
+					const s = result.stringValue;
+					resp = {ok: true, output: s.isNil() ? '' : s.js};
+				}
+			} catch (e) {
+				resp = {ok: false, output: String(e)};
+			}
+			stdout.writeData($(JSON.stringify(resp) + '\n').dataUsingEncoding($.NSUTF8StringEncoding));
+		}
+	}
+}
+`
+
+type workerRequest struct {
+	Script string `json:"script"`
+}
+
+type workerResponse struct {
+	OK     bool   `json:"ok"`
+	Output string `json:"output"`
+}
+
+// Worker keeps one osascript process alive and runs scripts through it one at
+// a time. A crashed or stuck process is replaced on the next Run.
+type Worker struct {
+	mu    sync.Mutex
+	start func() (io.WriteCloser, io.Reader, func(), error)
+
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stop   func()
+}
+
+func NewWorker() *Worker {
+	return &Worker{start: startWorkerProcess}
+}
+
+func startWorkerProcess() (io.WriteCloser, io.Reader, func(), error) {
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-e", workerJXA)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, err
+	}
+	stop := func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	return stdin, stdout, stop, nil
+}
+
+// Run executes script in the worker. Like osascript, a failed script returns
+// its error text as output alongside a non-nil error.
+func (w *Worker) Run(ctx context.Context, script string) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop == nil {
+		stdin, stdout, stop, err := w.start()
+		if err != nil {
+			return nil, fmt.Errorf("start osascript worker: %w", err)
+		}
+		w.stdin, w.stdout, w.stop = stdin, bufio.NewReader(stdout), stop
+	}
+
+	req, err := json.Marshal(workerRequest{Script: script})
+	if err != nil {
+		return nil, err
+	}
+	type reply struct {
+		resp workerResponse
+		err  error
+	}
+	done := make(chan reply, 1)
+	go func() {
+		if _, err := w.stdin.Write(append(req, '\n')); err != nil {
+			done <- reply{err: err}
+			return
+		}
+		line, err := w.stdout.ReadBytes('\n')
+		if err != nil {
+			done <- reply{err: err}
+			return
+		}
+		var resp workerResponse
+		err = json.Unmarshal(line, &resp)
+		done <- reply{resp: resp, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// The process is mid-script; the only way to get it back is to kill it.
+		w.reset()
+		<-done
+		return nil, ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			w.reset()
+			return nil, fmt.Errorf("osascript worker: %w", r.err)
+		}
+		if !r.resp.OK {
+			return []byte(r.resp.Output), errors.New(firstLine(r.resp.Output))
+		}
+		return []byte(r.resp.Output), nil
+	}
+}
+
+// Close stops the worker process.
+func (w *Worker) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reset()
+	return nil
+}
+
+func (w *Worker) reset() {
+	if w.stop == nil {
+		return
+	}
+	_ = w.stdin.Close()
+	w.stop()
+	w.stdin, w.stdout, w.stop = nil, nil, nil
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	if s == "" {
+		return "script failed"
+	}
+	return s
+}
@@ -5,39 +5,153 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/agisilaos/homepodctl/internal/music"
+	"github.com/agisilaos/homepodctl/internal/transport"
 )
 
 type Config struct {
-	Defaults DefaultsConfig   `json:"defaults"`
-	Aliases  map[string]Alias `json:"aliases"`
-	Native   NativeConfig     `json:"native"`
+	Defaults      DefaultsConfig        `json:"defaults"`
+	Aliases       map[string]Alias      `json:"aliases"`
+	Scenes        map[string]Scene      `json:"scenes,omitempty"`
+	Groups        map[string][]string   `json:"groups,omitempty"`        // group name -> room names
+	Devices       map[string]string     `json:"devices,omitempty"`       // friendly room name -> exact AirPlay device name
+	VolumeOffsets map[string]int        `json:"volumeOffsets,omitempty"` // room -> offset added to requested volumes
+	MaxVolumes    map[string]int        `json:"maxVolumes,omitempty"`    // room -> highest volume allowed, overriding defaults.maxVolume
+	QuietHours    map[string]QuietHours `json:"quietHours,omitempty"`    // policy name -> daily window that caps volume
+	Hooks         map[string]string     `json:"hooks,omitempty"`         // hook name (prePlay, postStop, ...) -> shell command
+	Remotes       map[string]Remote     `json:"remotes,omitempty"`       // remote name -> Mac reached with --host <name>
+	Scrobble      *ScrobbleConfig       `json:"scrobble,omitempty"`
+	AppleMusic    *AppleMusicConfig     `json:"appleMusic,omitempty"`
+	Native        NativeConfig          `json:"native"`
+}
+
+// Remote is another Mac that runs the Music.app and Shortcuts calls of
+// `homepodctl --host <name>` over SSH.
+type Remote struct {
+	Host     string `json:"host"`               // ssh destination, e.g. me@mac-mini
+	Port     int    `json:"port,omitempty"`     // ssh port when not 22
+	Identity string `json:"identity,omitempty"` // private key file
+}
+
+// ScrobbleConfig holds credentials for `homepodctl scrobble`. A service is
+// enabled when its credentials are set.
+type ScrobbleConfig struct {
+	LastFM       LastFMConfig       `json:"lastfm"`
+	ListenBrainz ListenBrainzConfig `json:"listenbrainz"`
+}
+
+type LastFMConfig struct {
+	APIKey     string `json:"apiKey,omitempty"`
+	APISecret  string `json:"apiSecret,omitempty"`
+	SessionKey string `json:"sessionKey,omitempty"`
+}
+
+type ListenBrainzConfig struct {
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty"` // optional, defaults to api.listenbrainz.org
+}
+
+// AppleMusicConfig holds the Apple Music API tokens for `homepodctl catalog`
+// and `play --catalog`. The developer token (a MusicKit JWT) is enough to
+// search; adding catalog items to the library also needs the user token.
+type AppleMusicConfig struct {
+	DeveloperToken string `json:"developerToken,omitempty"`
+	UserToken      string `json:"userToken,omitempty"`
+	Storefront     string `json:"storefront,omitempty"` // optional, defaults to us
 }
 
 type DefaultsConfig struct {
-	Backend string   `json:"backend"`
-	Rooms   []string `json:"rooms"`
-	Shuffle bool     `json:"shuffle"`
-	Volume  *int     `json:"volume"` // 0-100
+	Backend   string          `json:"backend"`
+	Rooms     []string        `json:"rooms"`
+	Shuffle   bool            `json:"shuffle"`
+	Volume    *int            `json:"volume"`              // 0-100
+	MaxVolume *int            `json:"maxVolume,omitempty"` // optional, 0-100; highest volume any room is set to
+	Timeouts  *TimeoutsConfig `json:"timeouts,omitempty"`  // optional
+	Engine    string          `json:"engine,omitempty"`    // jxa|applescript; empty means jxa
+	Retries   *RetriesConfig  `json:"retries,omitempty"`   // optional
+	Launch    string          `json:"launch,omitempty"`    // hidden|foreground|off; empty means hidden
+}
+
+// RetriesConfig tunes retries of transient Music.app failures such as
+// AppleEvent timeouts (-1712). Count 0 disables retries; Backoff is a Go
+// duration such as "300ms" and doubles per retry.
+type RetriesConfig struct {
+	Count   *int   `json:"count,omitempty"`
+	Backoff string `json:"backoff,omitempty"`
+}
+
+// TimeoutsConfig bounds each backend call, as Go durations such as "20s".
+type TimeoutsConfig struct {
+	AppleScript string `json:"applescript,omitempty"`
+	Shortcuts   string `json:"shortcuts,omitempty"`
+	Hooks       string `json:"hooks,omitempty"`
 }
 
 type Alias struct {
-	Backend    string   `json:"backend"`              // airplay|native
-	Rooms      []string `json:"rooms"`                // optional
-	Playlist   string   `json:"playlist,omitempty"`   // optional
-	PlaylistID string   `json:"playlistId,omitempty"` // optional
-	Shuffle    *bool    `json:"shuffle,omitempty"`    // optional
-	Volume     *int     `json:"volume,omitempty"`     // optional
-	Shortcut   string   `json:"shortcut,omitempty"`   // optional, runs shortcuts directly
+	Backend     string   `json:"backend"`               // airplay|native
+	Rooms       []string `json:"rooms"`                 // optional
+	Playlist    string   `json:"playlist,omitempty"`    // optional
+	PlaylistID  string   `json:"playlistId,omitempty"`  // optional
+	Station     string   `json:"station,omitempty"`     // optional, radio station query (airplay)
+	Shuffle     *bool    `json:"shuffle,omitempty"`     // optional
+	ShuffleMode string   `json:"shuffleMode,omitempty"` // optional, songs|albums|groupings
+	EQ          string   `json:"eq,omitempty"`          // optional, Music.app EQ preset name
+	Volume      *int     `json:"volume,omitempty"`      // optional
+	Shortcut    string   `json:"shortcut,omitempty"`    // optional, runs shortcuts directly
+	Sequence    []string `json:"sequence,omitempty"`    // optional, other aliases or automation files run in order
+}
+
+// Scene is an ordered list of automation steps (the automation file step
+// schema) kept in config.json and run by name. Steps stay raw JSON here; the
+// CLI decodes and validates them.
+type Scene struct {
+	Description string            `json:"description,omitempty"`
+	Steps       []json.RawMessage `json:"steps"`
 }
 
 type NativeConfig struct {
-	Playlists       map[string]map[string]string `json:"playlists"`       // room -> playlist name -> shortcut name
-	VolumeShortcuts map[string]map[string]string `json:"volumeShortcuts"` // room -> "0".."100" -> shortcut name (discrete)
+	Playlists       map[string]map[string]PlaylistShortcut `json:"playlists"`       // room (or "*") -> playlist name (or "*") -> shortcut
+	VolumeShortcuts map[string]map[string]string           `json:"volumeShortcuts"` // room -> "0".."100" -> shortcut name (discrete)
+}
+
+// PlaylistShortcut is the Shortcut a native playlist mapping runs. In
+// config.json it is either the shortcut name or {"shortcut": ..., "input": ...};
+// {room} and {playlist} in input are replaced before the shortcut runs.
+type PlaylistShortcut struct {
+	Shortcut string `json:"shortcut"`
+	Input    string `json:"input,omitempty"`
+}
+
+func (p *PlaylistShortcut) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*p = PlaylistShortcut{Shortcut: name}
+		return nil
+	}
+	type plain PlaylistShortcut
+	var v plain
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("native playlist mapping must be a shortcut name or {\"shortcut\", \"input\"}: %w", err)
+	}
+	*p = PlaylistShortcut(v)
+	return nil
+}
+
+// MarshalJSON keeps mappings without input in the plain string form.
+func (p PlaylistShortcut) MarshalJSON() ([]byte, error) {
+	if p.Input == "" {
+		return json.Marshal(p.Shortcut)
+	}
+	type plain PlaylistShortcut
+	return json.Marshal(plain(p))
 }
 
 type ConfigError struct {
@@ -63,24 +177,82 @@ type ShortcutError struct {
 
 var (
 	runShortcutExec = func(ctx context.Context, name string) ([]byte, error) {
-		cmd := exec.CommandContext(ctx, "shortcuts", "run", name)
-		return cmd.CombinedOutput()
+		return runner.Run(ctx, nil, "shortcuts", "run", name)
+	}
+	runShortcutArgsExec = func(ctx context.Context, args ...string) ([]byte, error) {
+		return runner.Run(ctx, nil, "shortcuts", args...)
+	}
+	runRemoteShortcutExec = func(ctx context.Context, name, input string) ([]byte, error) {
+		hasInput := "0"
+		if input != "" {
+			hasInput = "1"
+		}
+		return runner.Run(ctx, strings.NewReader(input), "/bin/sh", "-c", remoteShortcutScript, "homepodctl", name, hasInput)
 	}
 	sleepWithContextFn = sleepWithContext
+	shortcutTimeout    time.Duration
+	logger             *slog.Logger
+	lookPathFn         = exec.LookPath
+	runNotifyExec      = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, name, args...).CombinedOutput()
+	}
 )
 
+// runner runs the backend programs; see SetTransport.
+var runner transport.Runner = transport.Local{}
+
+// Notification is a macOS user notification.
+type Notification struct {
+	Title     string
+	Subtitle  string
+	Message   string
+	ImagePath string // optional, only shown by terminal-notifier
+}
+
 func (e *ShortcutError) Error() string {
 	return fmt.Sprintf("shortcuts run %q failed: %v: %s", e.Name, e.Err, e.Output)
 }
 
 func (e *ShortcutError) Unwrap() error { return e.Err }
 
+// configPathOverride is set from --config / HOMEPODCTL_CONFIG and replaces
+// profile-based lookup entirely.
+var configPathOverride string
+
+// SetConfigPath makes ConfigPath return path for this process. A leading "~/"
+// expands to the home directory; relative paths are made absolute.
+func SetConfigPath(path string) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		configPathOverride = ""
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return &ConfigError{Op: "resolve", Err: err}
+		}
+		path = filepath.Join(home, rest)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return &ConfigError{Op: "resolve", Path: path, Err: err}
+	}
+	configPathOverride = abs
+	return nil
+}
+
+// ConfigPath returns the config file set with SetConfigPath, or else the file
+// of the active profile (see CurrentProfile).
 func ConfigPath() (string, error) {
-	dir, err := os.UserConfigDir()
+	if configPathOverride != "" {
+		return configPathOverride, nil
+	}
+	name, err := CurrentProfile()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(dir, "homepodctl", "config.json"), nil
+	return ProfilePath(name)
 }
 
 func LoadConfig() (*Config, error) {
@@ -98,7 +270,7 @@ func LoadConfig() (*Config, error) {
 	}
 	normalizeConfig(&cfg)
 	if cfg.Native.Playlists == nil {
-		cfg.Native.Playlists = map[string]map[string]string{}
+		cfg.Native.Playlists = map[string]map[string]PlaylistShortcut{}
 	}
 	if cfg.Native.VolumeShortcuts == nil {
 		cfg.Native.VolumeShortcuts = map[string]map[string]string{}
@@ -168,12 +340,12 @@ func InitConfig() (string, error) {
 			},
 		},
 		Native: NativeConfig{
-			Playlists: map[string]map[string]string{
+			Playlists: map[string]map[string]PlaylistShortcut{
 				"Bedroom": {
-					"Example Playlist": "BR Play Example Playlist",
+					"Example Playlist": {Shortcut: "BR Play Example Playlist"},
 				},
 				"Living Room": {
-					"Example Playlist": "LR Play Example Playlist",
+					"Example Playlist": {Shortcut: "LR Play Example Playlist"},
 				},
 			},
 			VolumeShortcuts: map[string]map[string]string{
@@ -199,7 +371,7 @@ func InitConfig() (string, error) {
 
 func normalizeConfig(cfg *Config) {
 	if cfg.Native.Playlists == nil {
-		cfg.Native.Playlists = map[string]map[string]string{}
+		cfg.Native.Playlists = map[string]map[string]PlaylistShortcut{}
 	}
 	if cfg.Native.VolumeShortcuts == nil {
 		cfg.Native.VolumeShortcuts = map[string]map[string]string{}
@@ -207,15 +379,410 @@ func normalizeConfig(cfg *Config) {
 	if cfg.Aliases == nil {
 		cfg.Aliases = map[string]Alias{}
 	}
+	if cfg.Scenes == nil {
+		cfg.Scenes = map[string]Scene{}
+	}
+	if cfg.Groups == nil {
+		cfg.Groups = map[string][]string{}
+	}
+	if cfg.Devices == nil {
+		cfg.Devices = map[string]string{}
+	}
+	if cfg.VolumeOffsets == nil {
+		cfg.VolumeOffsets = map[string]int{}
+	}
+	if cfg.MaxVolumes == nil {
+		cfg.MaxVolumes = map[string]int{}
+	}
+	if cfg.QuietHours == nil {
+		cfg.QuietHours = map[string]QuietHours{}
+	}
+	if cfg.Hooks == nil {
+		cfg.Hooks = map[string]string{}
+	}
+	if cfg.Remotes == nil {
+		cfg.Remotes = map[string]Remote{}
+	}
 	if cfg.Defaults.Backend == "" {
 		cfg.Defaults.Backend = "airplay"
 	}
 }
 
+// AliasCycle reports a cycle reachable from alias name through sequence
+// entries, as the alias names along it ending with the repeated one (e.g.
+// [evening winddown evening]). It returns nil when there is no cycle.
+func (c *Config) AliasCycle(name string) []string {
+	var path []string
+	onPath := map[string]bool{}
+	done := map[string]bool{}
+	var visit func(string) []string
+	visit = func(n string) []string {
+		if onPath[n] {
+			return append(append([]string(nil), path...), n)
+		}
+		if done[n] {
+			return nil
+		}
+		a, ok := c.Aliases[n]
+		if !ok {
+			return nil
+		}
+		onPath[n] = true
+		path = append(path, n)
+		for _, step := range a.Sequence {
+			if cycle := visit(step); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		onPath[n] = false
+		done[n] = true
+		return nil
+	}
+	cycle := visit(name)
+	if cycle == nil {
+		return nil
+	}
+	// Trim the lead-in so the cycle starts at the repeated alias.
+	last := cycle[len(cycle)-1]
+	for i, n := range cycle {
+		if n == last {
+			return cycle[i:]
+		}
+	}
+	return cycle
+}
+
+// ExpandRooms replaces group names with their member rooms and device
+// aliases with the AirPlay device names they stand for. Other names pass
+// through unchanged; the result keeps first-seen order without duplicates.
+// Group names and aliases match case-insensitively.
+func (c *Config) ExpandRooms(rooms []string) []string {
+	if len(rooms) == 0 {
+		return rooms
+	}
+	out := make([]string, 0, len(rooms))
+	seen := map[string]bool{}
+	add := func(room string) {
+		room = c.DeviceName(room)
+		key := strings.ToLower(room)
+		if room == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		out = append(out, room)
+	}
+	for _, room := range rooms {
+		if members, ok := c.group(room); ok {
+			for _, m := range members {
+				add(m)
+			}
+			continue
+		}
+		add(room)
+	}
+	return out
+}
+
+func (c *Config) group(name string) ([]string, bool) {
+	if c == nil || len(c.Groups) == 0 {
+		return nil, false
+	}
+	name = strings.TrimSpace(name)
+	if members, ok := c.Groups[name]; ok {
+		return members, true
+	}
+	for k, members := range c.Groups {
+		if strings.EqualFold(k, name) {
+			return members, true
+		}
+	}
+	return nil, false
+}
+
+// DeviceName returns the AirPlay device name that devices.<name> maps name
+// to, or name itself (trimmed) when it is not a device alias. Aliases match
+// case-insensitively.
+func (c *Config) DeviceName(name string) string {
+	name = strings.TrimSpace(name)
+	if c == nil || len(c.Devices) == 0 {
+		return name
+	}
+	if device, ok := c.Devices[name]; ok {
+		return strings.TrimSpace(device)
+	}
+	for k, device := range c.Devices {
+		if strings.EqualFold(k, name) {
+			return strings.TrimSpace(device)
+		}
+	}
+	return name
+}
+
+// DeviceAliases returns the sorted device aliases that map to device.
+func (c *Config) DeviceAliases(device string) []string {
+	if c == nil {
+		return nil
+	}
+	device = strings.TrimSpace(device)
+	var names []string
+	for name, d := range c.Devices {
+		if strings.EqualFold(strings.TrimSpace(d), device) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sameRoom reports whether a config key names room, directly or through a
+// device alias on either side.
+func (c *Config) sameRoom(key, room string) bool {
+	return strings.EqualFold(c.DeviceName(key), c.DeviceName(room))
+}
+
+// VolumeOffset returns the configured offset for room (0 when unset). Room
+// names match case-insensitively and through device aliases.
+func (c *Config) VolumeOffset(room string) int {
+	if c == nil || len(c.VolumeOffsets) == 0 {
+		return 0
+	}
+	room = strings.TrimSpace(room)
+	if off, ok := c.VolumeOffsets[room]; ok {
+		return off
+	}
+	for k, off := range c.VolumeOffsets {
+		if c.sameRoom(k, room) {
+			return off
+		}
+	}
+	return 0
+}
+
+// MaxVolume returns the highest volume allowed for room: maxVolumes.<room>,
+// else defaults.maxVolume. ok is false when neither is set. Room names match
+// case-insensitively and through device aliases.
+func (c *Config) MaxVolume(room string) (limit int, ok bool) {
+	if c == nil {
+		return 0, false
+	}
+	room = strings.TrimSpace(room)
+	if limit, ok := c.MaxVolumes[room]; ok {
+		return limit, true
+	}
+	for k, limit := range c.MaxVolumes {
+		if c.sameRoom(k, room) {
+			return limit, true
+		}
+	}
+	if c.Defaults.MaxVolume != nil {
+		return *c.Defaults.MaxVolume, true
+	}
+	return 0, false
+}
+
+// AdjustVolume applies the room's volume offset to value, clamped to 0-100.
+func (c *Config) AdjustVolume(room string, value int) int {
+	return max(0, min(100, value+c.VolumeOffset(room)))
+}
+
+// Notify posts n with terminal-notifier when it is installed (which can show
+// an image), falling back to osascript's display notification.
+func Notify(ctx context.Context, n Notification) error {
+	if path, err := lookPathFn("terminal-notifier"); err == nil {
+		args := []string{"-title", n.Title, "-message", n.Message, "-group", "homepodctl"}
+		if n.Subtitle != "" {
+			args = append(args, "-subtitle", n.Subtitle)
+		}
+		if n.ImagePath != "" {
+			args = append(args, "-contentImage", n.ImagePath)
+		}
+		if out, err := runNotifyExec(ctx, path, args...); err != nil {
+			return fmt.Errorf("terminal-notifier failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	script := fmt.Sprintf("display notification %s with title %s", music.QuoteAppleScriptString(n.Message), music.QuoteAppleScriptString(n.Title))
+	if n.Subtitle != "" {
+		script += " subtitle " + music.QuoteAppleScriptString(n.Subtitle)
+	}
+	if out, err := runNotifyExec(ctx, "osascript", "-e", script); err != nil {
+		return fmt.Errorf("display notification failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ListShortcuts returns the names of the shortcuts installed for the current
+// user, as reported by `shortcuts list`.
+func ListShortcuts(ctx context.Context) ([]string, error) {
+	out, err := runShortcutArgsExec(ctx, "list")
+	if err != nil {
+		return nil, &ShortcutError{Name: "list", Err: err, Output: strings.TrimSpace(string(out))}
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// ShortcutRef is a shortcut name referenced by the config, with the config
+// path that references it.
+type ShortcutRef struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+}
+
+// ShortcutRefs lists every shortcut referenced by aliases, native.playlists,
+// and native.volumeShortcuts, sorted by path.
+func (c *Config) ShortcutRefs() []ShortcutRef {
+	var refs []ShortcutRef
+	for name, a := range c.Aliases {
+		if strings.TrimSpace(a.Shortcut) != "" {
+			refs = append(refs, ShortcutRef{Path: "aliases." + name + ".shortcut", Name: a.Shortcut})
+		}
+	}
+	for room, byPlaylist := range c.Native.Playlists {
+		for playlist, m := range byPlaylist {
+			if strings.TrimSpace(m.Shortcut) != "" {
+				refs = append(refs, ShortcutRef{Path: "native.playlists." + room + "." + playlist, Name: m.Shortcut})
+			}
+		}
+	}
+	for room, byLevel := range c.Native.VolumeShortcuts {
+		for level, name := range byLevel {
+			if strings.TrimSpace(name) != "" {
+				refs = append(refs, ShortcutRef{Path: "native.volumeShortcuts." + room + "." + level, Name: name})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Path < refs[j].Path })
+	return refs
+}
+
+// MissingShortcuts returns the refs whose shortcut is not in installed.
+// Names are compared case-insensitively.
+func MissingShortcuts(refs []ShortcutRef, installed []string) []ShortcutRef {
+	have := make(map[string]bool, len(installed))
+	for _, name := range installed {
+		have[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	var missing []ShortcutRef
+	for _, r := range refs {
+		if !have[strings.ToLower(strings.TrimSpace(r.Name))] {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
 func RunShortcut(ctx context.Context, name string) error {
+	return runShortcutRetrying(ctx, name, func(ctx context.Context) ([]byte, error) { return runShortcutExec(ctx, name) })
+}
+
+// remoteShortcutScript runs shortcut $1 on a remote Mac, with stdin as its
+// text input when $2 is 1, and prints its text output. The files only exist
+// there, so the exchange goes through stdin and stdout.
+const remoteShortcutScript = `d=$(mktemp -d) || exit 1
+trap 'rm -rf "$d"' EXIT
+if [ "$2" = 1 ]; then
+	cat > "$d/input.txt" || exit 1
+	shortcuts run "$1" --output-path "$d/output.txt" --output-type public.plain-text --input-path "$d/input.txt" || exit
+else
+	shortcuts run "$1" --output-path "$d/output.txt" --output-type public.plain-text || exit
+fi
+cat "$d/output.txt" 2>/dev/null
+exit 0`
+
+// SetTransport runs every shortcuts call through r, e.g. on another Mac over
+// SSH. Notifications are always posted on this Mac.
+func SetTransport(r transport.Runner) {
+	runner = r
+}
+
+// RunShortcutWithInput runs a shortcut with input as its text input (omitted
+// when empty) and returns the shortcut's text output.
+func RunShortcutWithInput(ctx context.Context, name, input string) (string, error) {
+	if transport.IsRemote(runner) {
+		var out []byte
+		err := runShortcutRetrying(ctx, name, func(ctx context.Context) ([]byte, error) {
+			b, err := runRemoteShortcutExec(ctx, name, input)
+			out = b
+			return b, err
+		})
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	dir, err := os.MkdirTemp("", "homepodctl-shortcut-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	outPath := filepath.Join(dir, "output.txt")
+	args := []string{"run", name, "--output-path", outPath, "--output-type", "public.plain-text"}
+	if input != "" {
+		inPath := filepath.Join(dir, "input.txt")
+		if err := os.WriteFile(inPath, []byte(input), 0o600); err != nil {
+			return "", err
+		}
+		args = append(args, "--input-path", inPath)
+	}
+	if err := runShortcutRetrying(ctx, name, func(ctx context.Context) ([]byte, error) { return runShortcutArgsExec(ctx, args...) }); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(outPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// Shortcuts that end without output leave no file behind.
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// SetLogger records each shortcuts run (name, duration, result) at debug
+// level on l. A nil logger disables the records.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// SetShortcutTimeout bounds each shortcuts run attempt to d (zero means only
+// the caller's context applies). A timed-out attempt is not retried.
+func SetShortcutTimeout(d time.Duration) {
+	shortcutTimeout = d
+}
+
+func runShortcutAttempt(ctx context.Context, name string, run func(context.Context) ([]byte, error)) ([]byte, error) {
+	attemptCtx := ctx
+	if shortcutTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, shortcutTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	out, err := run(attemptCtx)
+	if err != nil && shortcutTimeout > 0 && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s (defaults.timeouts.shortcuts): %w", shortcutTimeout, context.DeadlineExceeded)
+	}
+	if logger != nil {
+		attrs := []any{"name", name, "duration_ms", time.Since(start).Milliseconds(), "ok", err == nil}
+		if err != nil {
+			attrs = append(attrs, "error", err.Error())
+		}
+		logger.Debug("shortcut", attrs...)
+	}
+	return out, err
+}
+
+func runShortcutRetrying(ctx context.Context, name string, run func(context.Context) ([]byte, error)) error {
 	var lastErr error
 	for attempt := 0; attempt < 3; attempt++ {
-		out, err := runShortcutExec(ctx, name)
+		out, err := runShortcutAttempt(ctx, name, run)
 		if err == nil {
 			return nil
 		}
@@ -239,7 +806,7 @@ func shouldRetryShortcut(err error, output string) bool {
 	if err == nil {
 		return false
 	}
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, transport.ErrUnreachable) {
 		return false
 	}
 	msg := strings.ToLower(strings.TrimSpace(output))
@@ -2,11 +2,16 @@ package native
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/agisilaos/homepodctl/internal/transport"
 )
 
 func TestLoadConfigOptional_MissingConfig(t *testing.T) {
@@ -91,6 +96,74 @@ func TestLoadConfigOptional_ValidConfig(t *testing.T) {
 	}
 }
 
+func TestExpandRooms(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Groups: map[string][]string{
+		"downstairs": {"Kitchen", "Living Room"},
+		"upstairs":   {"Bedroom", "Office"},
+	}}
+	got := cfg.ExpandRooms([]string{"Downstairs", "Bedroom", "kitchen"})
+	want := []string{"Kitchen", "Living Room", "Bedroom"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("ExpandRooms=%v, want %v", got, want)
+	}
+	if got := (*Config)(nil).ExpandRooms([]string{"Bedroom"}); len(got) != 1 || got[0] != "Bedroom" {
+		t.Fatalf("nil config ExpandRooms=%v", got)
+	}
+}
+
+func TestDeviceAliases(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		Devices: map[string]string{
+			"office":  "Agis's Office HomePod",
+			"kitchen": "Kitchen HomePod",
+			"study":   "Agis's Office HomePod",
+		},
+		Groups:        map[string][]string{"work": {"Office", "study"}},
+		VolumeOffsets: map[string]int{"kitchen": -10},
+		MaxVolumes:    map[string]int{"Agis's Office HomePod": 40},
+	}
+	got := cfg.ExpandRooms([]string{"Kitchen", "work", "Bedroom"})
+	want := []string{"Kitchen HomePod", "Agis's Office HomePod", "Bedroom"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("ExpandRooms=%v, want %v", got, want)
+	}
+	if got := cfg.DeviceAliases("agis's office homepod"); strings.Join(got, ",") != "office,study" {
+		t.Fatalf("DeviceAliases=%v, want [office study]", got)
+	}
+	if got := cfg.VolumeOffset("Kitchen HomePod"); got != -10 {
+		t.Fatalf("VolumeOffset(Kitchen HomePod)=%d, want -10", got)
+	}
+	if limit, ok := cfg.MaxVolume("office"); !ok || limit != 40 {
+		t.Fatalf("MaxVolume(office)=%d,%v, want 40,true", limit, ok)
+	}
+}
+
+func TestAliasCycle(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Aliases: map[string]Alias{
+		"evening":  {Sequence: []string{"winddown", "lights"}},
+		"winddown": {Playlist: "Calm"},
+		"lights":   {Shortcut: "Lights Off"},
+		"loop":     {Sequence: []string{"a"}},
+		"a":        {Sequence: []string{"b", "routine.yaml"}},
+		"b":        {Sequence: []string{"a"}},
+	}}
+	if got := cfg.AliasCycle("evening"); got != nil {
+		t.Fatalf("AliasCycle(evening)=%v, want nil", got)
+	}
+	if got := cfg.AliasCycle("loop"); strings.Join(got, ",") != "a,b,a" {
+		t.Fatalf("AliasCycle(loop)=%v, want [a b a]", got)
+	}
+	if got := cfg.AliasCycle("missing"); got != nil {
+		t.Fatalf("AliasCycle(missing)=%v, want nil", got)
+	}
+}
+
 func TestShouldRetryShortcut(t *testing.T) {
 	t.Parallel()
 
@@ -153,3 +226,174 @@ func TestRunShortcut_FailFastOnPermanentError(t *testing.T) {
 		t.Fatalf("attempts=%d, want 1", attempts)
 	}
 }
+
+func TestRunShortcut_TimeoutIsNotRetried(t *testing.T) {
+	origExec := runShortcutExec
+	origSleep := sleepWithContextFn
+	t.Cleanup(func() {
+		runShortcutExec = origExec
+		sleepWithContextFn = origSleep
+		SetShortcutTimeout(0)
+	})
+
+	attempts := 0
+	runShortcutExec = func(ctx context.Context, _ string) ([]byte, error) {
+		attempts++
+		<-ctx.Done()
+		return []byte("timed out"), errors.New("signal: killed")
+	}
+	sleepWithContextFn = func(context.Context, time.Duration) error { return nil }
+	SetShortcutTimeout(10 * time.Millisecond)
+
+	err := RunShortcut(context.Background(), "Slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v, want deadline exceeded", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("attempts=%d, want 1", attempts)
+	}
+}
+
+func TestNotifyPrefersTerminalNotifier(t *testing.T) {
+	origLookPath := lookPathFn
+	origExec := runNotifyExec
+	t.Cleanup(func() {
+		lookPathFn = origLookPath
+		runNotifyExec = origExec
+	})
+	var gotName string
+	var gotArgs []string
+	runNotifyExec = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		gotName, gotArgs = name, args
+		return nil, nil
+	}
+
+	lookPathFn = func(string) (string, error) { return "/opt/bin/terminal-notifier", nil }
+	n := Notification{Title: "Song", Subtitle: "Band", Message: "LP", ImagePath: "/tmp/art"}
+	if err := Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	joined := strings.Join(gotArgs, " ")
+	if gotName != "/opt/bin/terminal-notifier" || !strings.Contains(joined, "-contentImage /tmp/art") || !strings.Contains(joined, "-subtitle Band") {
+		t.Fatalf("unexpected terminal-notifier call: %s %v", gotName, gotArgs)
+	}
+
+	lookPathFn = func(string) (string, error) { return "", errors.New("not found") }
+	n.Title = `Say "Hi"`
+	if err := Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify fallback: %v", err)
+	}
+	if gotName != "osascript" || len(gotArgs) != 2 || gotArgs[1] != `display notification "LP" with title "Say \"Hi\"" subtitle "Band"` {
+		t.Fatalf("unexpected osascript call: %s %v", gotName, gotArgs)
+	}
+}
+
+func TestRunShortcutWithInputCapturesOutput(t *testing.T) {
+	origExec := runShortcutArgsExec
+	t.Cleanup(func() { runShortcutArgsExec = origExec })
+
+	var gotInput string
+	runShortcutArgsExec = func(_ context.Context, args ...string) ([]byte, error) {
+		flags := map[string]string{}
+		for i := 2; i+1 < len(args); i += 2 {
+			flags[args[i]] = args[i+1]
+		}
+		if args[0] != "run" || args[1] != "Play In Room" {
+			t.Fatalf("unexpected args: %v", args)
+		}
+		b, err := os.ReadFile(flags["--input-path"])
+		if err != nil {
+			t.Fatalf("read input: %v", err)
+		}
+		gotInput = string(b)
+		return nil, os.WriteFile(flags["--output-path"], []byte("Playing Focus\n"), 0o600)
+	}
+
+	out, err := RunShortcutWithInput(context.Background(), "Play In Room", "Focus|Bedroom")
+	if err != nil {
+		t.Fatalf("RunShortcutWithInput: %v", err)
+	}
+	if gotInput != "Focus|Bedroom" || out != "Playing Focus" {
+		t.Fatalf("input=%q output=%q", gotInput, out)
+	}
+}
+
+// stdinRunner records what a remote run was given.
+type stdinRunner struct {
+	stdin string
+	args  []string
+	out   string
+}
+
+func (r *stdinRunner) Run(_ context.Context, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	b, _ := io.ReadAll(stdin)
+	r.stdin, r.args = string(b), append([]string{name}, args...)
+	return []byte(r.out), nil
+}
+
+func (r *stdinRunner) String() string { return "ssh test" }
+
+func TestRunShortcutWithInputRemote(t *testing.T) {
+	r := &stdinRunner{out: "Playing Focus\n"}
+	SetTransport(r)
+	t.Cleanup(func() { SetTransport(transport.Local{}) })
+
+	out, err := RunShortcutWithInput(context.Background(), "Play In Room", "Focus|Bedroom")
+	if err != nil {
+		t.Fatalf("RunShortcutWithInput: %v", err)
+	}
+	if out != "Playing Focus" || r.stdin != "Focus|Bedroom" {
+		t.Fatalf("output=%q stdin=%q", out, r.stdin)
+	}
+	if len(r.args) != 6 || r.args[0] != "/bin/sh" || r.args[4] != "Play In Room" || r.args[5] != "1" {
+		t.Fatalf("unexpected args: %q", r.args)
+	}
+}
+
+func TestPlaylistShortcutJSONForms(t *testing.T) {
+	var m map[string]PlaylistShortcut
+	if err := json.Unmarshal([]byte(`{"Focus":"BR Focus","*":{"shortcut":"Play In Room","input":"{playlist}|{room}"}}`), &m); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if m["Focus"].Shortcut != "BR Focus" || m["*"].Input != "{playlist}|{room}" {
+		t.Fatalf("unexpected mappings: %+v", m)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(b) != `{"*":{"shortcut":"Play In Room","input":"{playlist}|{room}"},"Focus":"BR Focus"}` {
+		t.Fatalf("marshal=%s", b)
+	}
+}
+
+func TestMissingShortcuts(t *testing.T) {
+	origExec := runShortcutArgsExec
+	t.Cleanup(func() { runShortcutArgsExec = origExec })
+	runShortcutArgsExec = func(_ context.Context, args ...string) ([]byte, error) {
+		if len(args) != 1 || args[0] != "list" {
+			t.Fatalf("unexpected args: %v", args)
+		}
+		return []byte("BR Focus\nbedroom vol 30\n\n"), nil
+	}
+	installed, err := ListShortcuts(context.Background())
+	if err != nil {
+		t.Fatalf("ListShortcuts: %v", err)
+	}
+
+	cfg := &Config{
+		Aliases: map[string]Alias{"wake": {Shortcut: "Morning"}},
+		Native: NativeConfig{
+			Playlists:       map[string]map[string]PlaylistShortcut{"Bedroom": {"Focus": {Shortcut: "BR Focus"}}},
+			VolumeShortcuts: map[string]map[string]string{"Bedroom": {"30": "Bedroom Vol 30", "50": "Bedroom Vol 50"}},
+		},
+	}
+	missing := MissingShortcuts(cfg.ShortcutRefs(), installed)
+	want := []ShortcutRef{
+		{Path: "aliases.wake.shortcut", Name: "Morning"},
+		{Path: "native.volumeShortcuts.Bedroom.50", Name: "Bedroom Vol 50"},
+	}
+	if len(missing) != len(want) || missing[0] != want[0] || missing[1] != want[1] {
+		t.Fatalf("missing=%+v, want %+v", missing, want)
+	}
+}
@@ -0,0 +1,202 @@
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile is the profile stored in config.json itself.
+const DefaultProfile = "default"
+
+var (
+	profileNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	// profileOverride is set from --profile / HOMEPODCTL_PROFILE and takes
+	// precedence over the profile recorded by SwitchProfile.
+	profileOverride string
+)
+
+// SetProfile selects the profile used by ConfigPath for this process. An
+// empty name falls back to the switched-to profile.
+func SetProfile(name string) error {
+	name = strings.TrimSpace(name)
+	if name != "" && !profileNameRe.MatchString(name) {
+		return &ConfigError{Op: "profile", Err: fmt.Errorf("invalid profile name %q (use letters, digits, - and _)", name)}
+	}
+	profileOverride = name
+	return nil
+}
+
+// CurrentProfile returns the active profile: the SetProfile override, else the
+// one recorded by SwitchProfile, else DefaultProfile.
+func CurrentProfile() (string, error) {
+	if profileOverride != "" {
+		return profileOverride, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "current-profile"))
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultProfile, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(string(b))
+	if !profileNameRe.MatchString(name) {
+		return DefaultProfile, nil
+	}
+	return name, nil
+}
+
+// ProfilePath returns the config file for a profile: config.json for the
+// default profile, profiles/<name>.json otherwise.
+func ProfilePath(name string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	if name == "" || name == DefaultProfile {
+		return filepath.Join(dir, "config.json"), nil
+	}
+	return filepath.Join(dir, "profiles", name+".json"), nil
+}
+
+// ProfileExists reports whether a profile's config file exists. The default
+// profile always exists.
+func ProfileExists(name string) (bool, error) {
+	if name == "" || name == DefaultProfile {
+		return true, nil
+	}
+	path, err := ProfilePath(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListProfiles returns the default profile followed by every profile file,
+// sorted by name.
+func ListProfiles() ([]string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "profiles"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok || !profileNameRe.MatchString(name) || name == DefaultProfile {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...), nil
+}
+
+// CreateProfile writes a new profile file. With from set, the new profile
+// starts as a copy of that profile; otherwise it starts empty.
+func CreateProfile(name, from string) (string, error) {
+	if !profileNameRe.MatchString(name) || name == DefaultProfile {
+		return "", &ConfigError{Op: "profile", Err: fmt.Errorf("invalid profile name %q (use letters, digits, - and _)", name)}
+	}
+	path, err := ProfilePath(name)
+	if err != nil {
+		return "", &ConfigError{Op: "resolve", Err: err}
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", &ConfigError{Op: "profile", Path: path, Err: fmt.Errorf("profile %q already exists", name)}
+	}
+	cfg := &Config{}
+	normalizeConfig(cfg)
+	if from != "" {
+		if ok, err := ProfileExists(from); err != nil || !ok {
+			return "", &ConfigError{Op: "profile", Err: fmt.Errorf("profile %q not found", from)}
+		}
+		src, err := ProfilePath(from)
+		if err != nil {
+			return "", &ConfigError{Op: "resolve", Err: err}
+		}
+		b, err := os.ReadFile(src)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", &ConfigError{Op: "read", Path: src, Err: err}
+		}
+		if err == nil {
+			if err := json.Unmarshal(b, cfg); err != nil {
+				return "", &ConfigError{Op: "parse", Path: src, Err: err}
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", &ConfigError{Op: "mkdir", Path: filepath.Dir(path), Err: err}
+	}
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return "", &ConfigError{Op: "write", Path: path, Err: err}
+	}
+	return path, nil
+}
+
+// SwitchProfile records name as the profile used when no override is set.
+func SwitchProfile(name string) error {
+	ok, err := ProfileExists(name)
+	if err != nil {
+		return &ConfigError{Op: "profile", Err: err}
+	}
+	if !ok {
+		return &ConfigError{Op: "profile", Err: fmt.Errorf("profile %q not found (run `homepodctl config profile create %s`)", name, name)}
+	}
+	dir, err := configDir()
+	if err != nil {
+		return &ConfigError{Op: "resolve", Err: err}
+	}
+	marker := filepath.Join(dir, "current-profile")
+	if name == DefaultProfile {
+		if err := os.Remove(marker); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return &ConfigError{Op: "write", Path: marker, Err: err}
+		}
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return &ConfigError{Op: "mkdir", Path: dir, Err: err}
+	}
+	if err := os.WriteFile(marker, []byte(name+"\n"), 0o600); err != nil {
+		return &ConfigError{Op: "write", Path: marker, Err: err}
+	}
+	return nil
+}
+
+// configDir returns the homepodctl config directory. $XDG_CONFIG_HOME/homepodctl
+// wins when it exists, so dotfile setups work on macOS too; otherwise it is
+// under os.UserConfigDir.
+func configDir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdg) {
+		dir := filepath.Join(xdg, "homepodctl")
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "homepodctl"), nil
+}
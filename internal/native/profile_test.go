@@ -0,0 +1,96 @@
+package native
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProfilesCreateSwitchAndList(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Cleanup(func() { profileOverride = "" })
+
+	defaultPath, err := ConfigPath()
+	if err != nil {
+		t.Fatalf("ConfigPath: %v", err)
+	}
+	if filepath.Base(defaultPath) != "config.json" {
+		t.Fatalf("default path=%q", defaultPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(defaultPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(defaultPath, []byte(`{"defaults":{"rooms":["Bedroom"]}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	officePath, err := CreateProfile("office", DefaultProfile)
+	if err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	if _, err := CreateProfile("office", ""); err == nil {
+		t.Fatalf("expected error creating an existing profile")
+	}
+	if _, err := CreateProfile("../x", ""); err == nil {
+		t.Fatalf("expected error for invalid profile name")
+	}
+	if err := SwitchProfile("travel"); err == nil {
+		t.Fatalf("expected error switching to a missing profile")
+	}
+	if err := SwitchProfile("office"); err != nil {
+		t.Fatalf("SwitchProfile: %v", err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if got, _ := ConfigPath(); got != officePath || !reflect.DeepEqual(cfg.Defaults.Rooms, []string{"Bedroom"}) {
+		t.Fatalf("path=%q rooms=%v", got, cfg.Defaults.Rooms)
+	}
+
+	if err := SetProfile(DefaultProfile); err != nil {
+		t.Fatalf("SetProfile: %v", err)
+	}
+	if got, _ := ConfigPath(); got != defaultPath {
+		t.Fatalf("override path=%q, want %q", got, defaultPath)
+	}
+
+	names, err := ListProfiles()
+	if err != nil {
+		t.Fatalf("ListProfiles: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"default", "office"}) {
+		t.Fatalf("profiles=%v", names)
+	}
+}
+
+func TestConfigPathOverrides(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	t.Cleanup(func() { configPathOverride = "" })
+
+	xdgDir := filepath.Join(home, "xdg", "homepodctl")
+	if err := os.MkdirAll(xdgDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ConfigPath(); got != filepath.Join(xdgDir, "config.json") {
+		t.Fatalf("xdg path=%q", got)
+	}
+
+	if err := SetConfigPath("~/dotfiles/homepodctl.json"); err != nil {
+		t.Fatalf("SetConfigPath: %v", err)
+	}
+	if got, _ := ConfigPath(); got != filepath.Join(home, "dotfiles", "homepodctl.json") {
+		t.Fatalf("override path=%q", got)
+	}
+	if err := SetConfigPath(""); err != nil {
+		t.Fatalf("SetConfigPath: %v", err)
+	}
+	if got, _ := ConfigPath(); got != filepath.Join(xdgDir, "config.json") {
+		t.Fatalf("cleared override path=%q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package native
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window during which volume is capped in some rooms
+// and play warns or refuses to start.
+type QuietHours struct {
+	Start     string   `json:"start"`               // HH:MM, local time
+	End       string   `json:"end"`                 // HH:MM; before start means the window spans midnight
+	Rooms     []string `json:"rooms,omitempty"`     // rooms or groups; empty means every room
+	MaxVolume *int     `json:"maxVolume,omitempty"` // optional, 0-100; highest volume inside the window
+	Play      string   `json:"play,omitempty"`      // warn|block; empty means warn
+}
+
+// ParseClock parses "HH:MM" (24-hour) into minutes after midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate reports the first problem with q, naming fields as they appear in
+// config.json.
+func (q QuietHours) Validate() error {
+	start, err := ParseClock(q.Start)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	end, err := ParseClock(q.End)
+	if err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if start == end {
+		return fmt.Errorf("start and end are both %s", q.Start)
+	}
+	if q.MaxVolume != nil && (*q.MaxVolume < 0 || *q.MaxVolume > 100) {
+		return fmt.Errorf("maxVolume must be 0-100")
+	}
+	switch q.Play {
+	case "", "warn", "block":
+	default:
+		return fmt.Errorf("play must be warn or block")
+	}
+	return nil
+}
+
+// Window is the policy's time range, e.g. "22:00-07:00".
+func (q QuietHours) Window() string {
+	return strings.TrimSpace(q.Start) + "-" + strings.TrimSpace(q.End)
+}
+
+// Blocks reports whether play refuses to start inside the window.
+func (q QuietHours) Blocks() bool {
+	return q.Play == "block"
+}
+
+// ActiveAt reports whether t falls inside the window. An invalid window is
+// never active.
+func (q QuietHours) ActiveAt(t time.Time) bool {
+	start, err := ParseClock(q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(q.End)
+	if err != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// ActiveQuietHours returns the names of the quiet hours covering room at t,
+// sorted. Rooms, groups and device aliases in a policy match room
+// case-insensitively.
+func (c *Config) ActiveQuietHours(room string, t time.Time) []string {
+	if c == nil {
+		return nil
+	}
+	room = strings.TrimSpace(room)
+	var names []string
+	for name, q := range c.QuietHours {
+		if !q.ActiveAt(t) || !c.quietCovers(q, room) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Config) quietCovers(q QuietHours, room string) bool {
+	if len(q.Rooms) == 0 {
+		return true
+	}
+	room = c.DeviceName(room)
+	for _, r := range c.ExpandRooms(q.Rooms) {
+		if strings.EqualFold(r, room) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxVolumeAt is MaxVolume with the caps of the quiet hours active at t
+// applied; the lowest cap wins. quiet names the quiet hours that set limit,
+// or is empty when the regular cap did.
+func (c *Config) MaxVolumeAt(room string, t time.Time) (limit int, quiet string, ok bool) {
+	limit, ok = c.MaxVolume(room)
+	for _, name := range c.ActiveQuietHours(room, t) {
+		q := c.QuietHours[name]
+		if q.MaxVolume == nil || (ok && *q.MaxVolume >= limit) {
+			continue
+		}
+		limit, quiet, ok = *q.MaxVolume, name, true
+	}
+	return limit, quiet, ok
+}
@@ -0,0 +1,100 @@
+package native
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func at(clock string) time.Time {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestQuietHoursActiveAt(t *testing.T) {
+	t.Parallel()
+	overnight := QuietHours{Start: "22:00", End: "07:00"}
+	daytime := QuietHours{Start: "13:00", End: "15:30"}
+	cases := []struct {
+		q    QuietHours
+		at   string
+		want bool
+	}{
+		{overnight, "21:59", false},
+		{overnight, "22:00", true},
+		{overnight, "03:00", true},
+		{overnight, "06:59", true},
+		{overnight, "07:00", false},
+		{daytime, "12:59", false},
+		{daytime, "14:00", true},
+		{daytime, "15:30", false},
+		{QuietHours{Start: "bad", End: "07:00"}, "03:00", false},
+	}
+	for _, tc := range cases {
+		if got := tc.q.ActiveAt(at(tc.at)); got != tc.want {
+			t.Errorf("%s at %s = %t, want %t", tc.q.Window(), tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestQuietHoursValidate(t *testing.T) {
+	t.Parallel()
+	loud := 120
+	for _, q := range []QuietHours{
+		{Start: "25:00", End: "07:00"},
+		{Start: "22:00", End: ""},
+		{Start: "22:00", End: "22:00"},
+		{Start: "22:00", End: "07:00", MaxVolume: &loud},
+		{Start: "22:00", End: "07:00", Play: "mute"},
+	} {
+		if err := q.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", q)
+		}
+	}
+	if err := (QuietHours{Start: "22:00", End: "7:00", Play: "block"}).Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestMaxVolumeAt(t *testing.T) {
+	t.Parallel()
+	regular, night, nursery := 80, 30, 10
+	cfg := &Config{
+		Defaults: DefaultsConfig{MaxVolume: &regular},
+		Groups:   map[string][]string{"upstairs": {"Bedroom", "Nursery"}},
+		QuietHours: map[string]QuietHours{
+			"night":   {Start: "22:00", End: "07:00", MaxVolume: &night},
+			"nursery": {Start: "19:00", End: "08:00", Rooms: []string{"nursery"}, MaxVolume: &nursery, Play: "block"},
+			"naps":    {Start: "13:00", End: "15:00", Rooms: []string{"upstairs"}},
+		},
+	}
+	cases := []struct {
+		room, at  string
+		limit     int
+		quiet     string
+		active    []string
+		wantLimit bool
+	}{
+		{"Kitchen", "12:00", 80, "", nil, true},
+		{"Kitchen", "23:00", 30, "night", []string{"night"}, true},
+		{"Nursery", "20:00", 10, "nursery", []string{"nursery"}, true},
+		{"Nursery", "23:00", 10, "nursery", []string{"night", "nursery"}, true},
+		{"Bedroom", "14:00", 80, "", []string{"naps"}, true},
+	}
+	for _, tc := range cases {
+		limit, quiet, ok := cfg.MaxVolumeAt(tc.room, at(tc.at))
+		if limit != tc.limit || quiet != tc.quiet || ok != tc.wantLimit {
+			t.Errorf("MaxVolumeAt(%s, %s) = %d, %q, %t; want %d, %q, %t", tc.room, tc.at, limit, quiet, ok, tc.limit, tc.quiet, tc.wantLimit)
+		}
+		if got := cfg.ActiveQuietHours(tc.room, at(tc.at)); !reflect.DeepEqual(got, tc.active) {
+			t.Errorf("ActiveQuietHours(%s, %s) = %v, want %v", tc.room, tc.at, got, tc.active)
+		}
+	}
+	cfg.Defaults.MaxVolume = nil
+	if limit, quiet, ok := cfg.MaxVolumeAt("Kitchen", at("23:30")); !ok || limit != 30 || quiet != "night" {
+		t.Fatalf("without defaults.maxVolume: got %d, %q, %t", limit, quiet, ok)
+	}
+}
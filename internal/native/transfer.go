@@ -0,0 +1,199 @@
+package native
+
+import "sort"
+
+// RedactedValue replaces secrets in redacted exports. Importing it leaves the
+// existing value untouched.
+const RedactedValue = "REDACTED"
+
+// Redact returns a copy of c with scrobble credentials, service URLs, Apple
+// Music tokens, remote hosts and identity files, and hook commands replaced
+// by RedactedValue.
+func (c *Config) Redact() *Config {
+	out := *c
+	var secrets []*string
+	if c.Remotes != nil {
+		out.Remotes = make(map[string]Remote, len(c.Remotes))
+		for name, r := range c.Remotes {
+			for _, s := range []*string{&r.Host, &r.Identity} {
+				if *s != "" {
+					*s = RedactedValue
+				}
+			}
+			out.Remotes[name] = r
+		}
+	}
+	if c.Hooks != nil {
+		out.Hooks = make(map[string]string, len(c.Hooks))
+		for name, command := range c.Hooks {
+			if command != "" {
+				command = RedactedValue
+			}
+			out.Hooks[name] = command
+		}
+	}
+	if c.Scrobble != nil {
+		scrobble := *c.Scrobble
+		out.Scrobble = &scrobble
+		secrets = append(secrets,
+			&out.Scrobble.LastFM.APIKey,
+			&out.Scrobble.LastFM.APISecret,
+			&out.Scrobble.LastFM.SessionKey,
+			&out.Scrobble.ListenBrainz.Token,
+			&out.Scrobble.ListenBrainz.URL,
+		)
+	}
+	if c.AppleMusic != nil {
+		am := *c.AppleMusic
+		out.AppleMusic = &am
+		secrets = append(secrets, &out.AppleMusic.DeveloperToken, &out.AppleMusic.UserToken)
+	}
+	for _, s := range secrets {
+		if *s != "" {
+			*s = RedactedValue
+		}
+	}
+	return &out
+}
+
+// MergeResult lists the config paths an import added, replaced, or skipped.
+type MergeResult struct {
+	Added    []string `json:"added,omitempty"`
+	Replaced []string `json:"replaced,omitempty"`
+	Skipped  []string `json:"skipped,omitempty"`
+}
+
+// Import applies src onto c. Entries only in c are always kept. With merge set,
+// entries that already exist in c (aliases, groups, devices, volume offsets and caps,
+// hooks, remotes, native mappings, credentials) are kept and reported as skipped;
+// otherwise src replaces them. Defaults are only taken from src when not
+// merging. Redacted values never overwrite existing ones; redacted hooks and
+// remotes are skipped.
+func (c *Config) Import(src *Config, merge bool) MergeResult {
+	normalizeConfig(c)
+	var res MergeResult
+	put := func(path string, exists bool, set func()) {
+		switch {
+		case !exists:
+			set()
+			res.Added = append(res.Added, path)
+		case merge:
+			res.Skipped = append(res.Skipped, path)
+		default:
+			set()
+			res.Replaced = append(res.Replaced, path)
+		}
+	}
+
+	if !merge {
+		c.Defaults = src.Defaults
+	}
+	for name, a := range src.Aliases {
+		_, ok := c.Aliases[name]
+		put("aliases."+name, ok, func() { c.Aliases[name] = a })
+	}
+	for name, sc := range src.Scenes {
+		_, ok := c.Scenes[name]
+		put("scenes."+name, ok, func() { c.Scenes[name] = sc })
+	}
+	for name, rooms := range src.Groups {
+		_, ok := c.Groups[name]
+		put("groups."+name, ok, func() { c.Groups[name] = rooms })
+	}
+	for name, device := range src.Devices {
+		_, ok := c.Devices[name]
+		put("devices."+name, ok, func() { c.Devices[name] = device })
+	}
+	for room, off := range src.VolumeOffsets {
+		_, ok := c.VolumeOffsets[room]
+		put("volumeOffsets."+room, ok, func() { c.VolumeOffsets[room] = off })
+	}
+	for room, limit := range src.MaxVolumes {
+		_, ok := c.MaxVolumes[room]
+		put("maxVolumes."+room, ok, func() { c.MaxVolumes[room] = limit })
+	}
+	for name, q := range src.QuietHours {
+		_, ok := c.QuietHours[name]
+		put("quietHours."+name, ok, func() { c.QuietHours[name] = q })
+	}
+	for name, command := range src.Hooks {
+		if command == RedactedValue {
+			res.Skipped = append(res.Skipped, "hooks."+name)
+			continue
+		}
+		_, ok := c.Hooks[name]
+		put("hooks."+name, ok, func() { c.Hooks[name] = command })
+	}
+	for name, r := range src.Remotes {
+		if r.Host == RedactedValue || r.Identity == RedactedValue {
+			res.Skipped = append(res.Skipped, "remotes."+name)
+			continue
+		}
+		_, ok := c.Remotes[name]
+		put("remotes."+name, ok, func() { c.Remotes[name] = r })
+	}
+	for room, byPlaylist := range src.Native.Playlists {
+		for playlist, m := range byPlaylist {
+			_, ok := c.Native.Playlists[room][playlist]
+			put("native.playlists."+room+"."+playlist, ok, func() {
+				if c.Native.Playlists[room] == nil {
+					c.Native.Playlists[room] = map[string]PlaylistShortcut{}
+				}
+				c.Native.Playlists[room][playlist] = m
+			})
+		}
+	}
+	for room, byLevel := range src.Native.VolumeShortcuts {
+		for level, name := range byLevel {
+			_, ok := c.Native.VolumeShortcuts[room][level]
+			put("native.volumeShortcuts."+room+"."+level, ok, func() {
+				if c.Native.VolumeShortcuts[room] == nil {
+					c.Native.VolumeShortcuts[room] = map[string]string{}
+				}
+				c.Native.VolumeShortcuts[room][level] = name
+			})
+		}
+	}
+	if src.Scrobble != nil {
+		if c.Scrobble == nil {
+			c.Scrobble = &ScrobbleConfig{}
+		}
+		for _, f := range []struct {
+			path     string
+			dst, src *string
+		}{
+			{"scrobble.lastfm.apiKey", &c.Scrobble.LastFM.APIKey, &src.Scrobble.LastFM.APIKey},
+			{"scrobble.lastfm.apiSecret", &c.Scrobble.LastFM.APISecret, &src.Scrobble.LastFM.APISecret},
+			{"scrobble.lastfm.sessionKey", &c.Scrobble.LastFM.SessionKey, &src.Scrobble.LastFM.SessionKey},
+			{"scrobble.listenbrainz.token", &c.Scrobble.ListenBrainz.Token, &src.Scrobble.ListenBrainz.Token},
+			{"scrobble.listenbrainz.url", &c.Scrobble.ListenBrainz.URL, &src.Scrobble.ListenBrainz.URL},
+		} {
+			if *f.src == "" || *f.src == RedactedValue || *f.src == *f.dst {
+				continue
+			}
+			put(f.path, *f.dst != "", func() { *f.dst = *f.src })
+		}
+	}
+	if src.AppleMusic != nil {
+		if c.AppleMusic == nil {
+			c.AppleMusic = &AppleMusicConfig{}
+		}
+		for _, f := range []struct {
+			path     string
+			dst, src *string
+		}{
+			{"appleMusic.developerToken", &c.AppleMusic.DeveloperToken, &src.AppleMusic.DeveloperToken},
+			{"appleMusic.userToken", &c.AppleMusic.UserToken, &src.AppleMusic.UserToken},
+			{"appleMusic.storefront", &c.AppleMusic.Storefront, &src.AppleMusic.Storefront},
+		} {
+			if *f.src == "" || *f.src == RedactedValue || *f.src == *f.dst {
+				continue
+			}
+			put(f.path, *f.dst != "", func() { *f.dst = *f.src })
+		}
+	}
+	sort.Strings(res.Added)
+	sort.Strings(res.Replaced)
+	sort.Strings(res.Skipped)
+	return res
+}
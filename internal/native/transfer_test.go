@@ -0,0 +1,94 @@
+package native
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactLeavesOriginalIntact(t *testing.T) {
+	cfg := &Config{Scrobble: &ScrobbleConfig{LastFM: LastFMConfig{APIKey: "key"}, ListenBrainz: ListenBrainzConfig{Token: "tok"}}}
+	red := cfg.Redact()
+	if red.Scrobble.LastFM.APIKey != RedactedValue || red.Scrobble.ListenBrainz.Token != RedactedValue || red.Scrobble.LastFM.APISecret != "" {
+		t.Fatalf("redacted=%+v", red.Scrobble)
+	}
+	if cfg.Scrobble.LastFM.APIKey != "key" {
+		t.Fatalf("original modified: %+v", cfg.Scrobble)
+	}
+}
+
+func TestRedactAppleMusicTokens(t *testing.T) {
+	cfg := &Config{AppleMusic: &AppleMusicConfig{DeveloperToken: "jwt", Storefront: "gb"}}
+	red := cfg.Redact()
+	if red.AppleMusic.DeveloperToken != RedactedValue || red.AppleMusic.UserToken != "" || red.AppleMusic.Storefront != "gb" {
+		t.Fatalf("redacted=%+v", red.AppleMusic)
+	}
+	if cfg.AppleMusic.DeveloperToken != "jwt" {
+		t.Fatalf("original modified: %+v", cfg.AppleMusic)
+	}
+}
+
+func TestRedactRemotesAndHooks(t *testing.T) {
+	cfg := &Config{
+		Remotes: map[string]Remote{"studio": {Host: "me@mac-mini", Port: 2222, Identity: "~/.ssh/studio"}},
+		Hooks:   map[string]string{"postPlay": "curl -H 'Authorization: secret' https://example.com"},
+	}
+	red := cfg.Redact()
+	if r := red.Remotes["studio"]; r.Host != RedactedValue || r.Identity != RedactedValue || r.Port != 2222 {
+		t.Fatalf("remote=%+v", r)
+	}
+	if red.Hooks["postPlay"] != RedactedValue {
+		t.Fatalf("hooks=%+v", red.Hooks)
+	}
+	if cfg.Remotes["studio"].Host != "me@mac-mini" || cfg.Hooks["postPlay"] == RedactedValue {
+		t.Fatalf("original modified: %+v %+v", cfg.Remotes, cfg.Hooks)
+	}
+
+	dst := &Config{Hooks: map[string]string{"postPlay": "notify"}}
+	res := dst.Import(red, false)
+	if !reflect.DeepEqual(res.Skipped, []string{"hooks.postPlay", "remotes.studio"}) || len(res.Added) != 0 {
+		t.Fatalf("import result=%+v", res)
+	}
+	if dst.Hooks["postPlay"] != "notify" || len(dst.Remotes) != 0 {
+		t.Fatalf("redacted values imported: %+v %+v", dst.Hooks, dst.Remotes)
+	}
+}
+
+func TestImportMergeKeepsExisting(t *testing.T) {
+	newCfg := func() *Config {
+		cfg := &Config{
+			Defaults: DefaultsConfig{Backend: "airplay", Rooms: []string{"Bedroom"}},
+			Aliases:  map[string]Alias{"focus": {Playlist: "Focus"}},
+			Scrobble: &ScrobbleConfig{LastFM: LastFMConfig{APIKey: "key"}},
+		}
+		normalizeConfig(cfg)
+		return cfg
+	}
+	src := &Config{
+		Defaults: DefaultsConfig{Backend: "native", Rooms: []string{"Office"}},
+		Aliases:  map[string]Alias{"focus": {Playlist: "Deep Focus"}, "party": {Playlist: "Party"}},
+		Native:   NativeConfig{Playlists: map[string]map[string]PlaylistShortcut{"Office": {"Focus": {Shortcut: "Office Focus"}}}},
+		Scrobble: &ScrobbleConfig{LastFM: LastFMConfig{APIKey: RedactedValue, APISecret: "secret"}},
+	}
+
+	cfg := newCfg()
+	res := cfg.Import(src, true)
+	want := MergeResult{
+		Added:   []string{"aliases.party", "native.playlists.Office.Focus", "scrobble.lastfm.apiSecret"},
+		Skipped: []string{"aliases.focus"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("merge result=%+v, want %+v", res, want)
+	}
+	if cfg.Aliases["focus"].Playlist != "Focus" || cfg.Defaults.Backend != "airplay" || cfg.Scrobble.LastFM.APIKey != "key" {
+		t.Fatalf("merge clobbered existing values: %+v", cfg)
+	}
+
+	cfg = newCfg()
+	res = cfg.Import(src, false)
+	if !reflect.DeepEqual(res.Replaced, []string{"aliases.focus"}) || cfg.Aliases["focus"].Playlist != "Deep Focus" || cfg.Defaults.Backend != "native" {
+		t.Fatalf("import result=%+v cfg=%+v", res, cfg)
+	}
+	if cfg.Scrobble.LastFM.APIKey != "key" {
+		t.Fatalf("redacted value overwrote existing key: %+v", cfg.Scrobble)
+	}
+}
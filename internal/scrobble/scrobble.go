@@ -0,0 +1,343 @@
+package scrobble
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLastFMEndpoint       = "https://ws.audioscrobbler.com/2.0/"
+	DefaultListenBrainzEndpoint = "https://api.listenbrainz.org"
+
+	// lastFMBatchSize is the maximum number of scrobbles per track.scrobble call.
+	lastFMBatchSize = 50
+)
+
+// Listen is one finished play to submit.
+type Listen struct {
+	Artist    string    `json:"artist"`
+	Track     string    `json:"track"`
+	Album     string    `json:"album,omitempty"`
+	DurationS float64   `json:"durationSeconds,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Submitter sends listens to one scrobbling service.
+type Submitter interface {
+	Name() string
+	Submit(ctx context.Context, listens []Listen) error
+}
+
+// ServiceError is returned when a service answers with a non-success status.
+type ServiceError struct {
+	Service string
+	Status  int
+	Message string
+}
+
+func (e *ServiceError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: HTTP %d", e.Service, e.Status)
+	}
+	return fmt.Sprintf("%s: HTTP %d: %s", e.Service, e.Status, e.Message)
+}
+
+// BatchError is returned by a Submit that sends in batches when a batch
+// failed after earlier ones were accepted: the first Sent listens went
+// through, the rest did not.
+type BatchError struct {
+	Sent int
+	Err  error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%v (after %d listen(s) were accepted)", e.Err, e.Sent)
+}
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// Eligible reports whether a play has lasted long enough to scrobble: the
+// track is longer than 30 seconds and has played half its length (capped at
+// four minutes, matching Last.fm's rule).
+func Eligible(durationS, playedS float64) bool {
+	if durationS <= 30 {
+		return false
+	}
+	return playedS >= min(durationS/2, 240)
+}
+
+type LastFM struct {
+	APIKey     string
+	APISecret  string
+	SessionKey string
+	Endpoint   string
+	Client     *http.Client
+}
+
+func (l *LastFM) Name() string { return "lastfm" }
+
+func (l *LastFM) Submit(ctx context.Context, listens []Listen) error {
+	for start := 0; start < len(listens); start += lastFMBatchSize {
+		batch := listens[start:min(start+lastFMBatchSize, len(listens))]
+		params := map[string]string{
+			"method":  "track.scrobble",
+			"api_key": l.APIKey,
+			"sk":      l.SessionKey,
+		}
+		for i, ls := range batch {
+			idx := "[" + strconv.Itoa(i) + "]"
+			params["artist"+idx] = ls.Artist
+			params["track"+idx] = ls.Track
+			params["timestamp"+idx] = strconv.FormatInt(ls.StartedAt.Unix(), 10)
+			if ls.Album != "" {
+				params["album"+idx] = ls.Album
+			}
+			if ls.DurationS > 0 {
+				params["duration"+idx] = strconv.Itoa(int(ls.DurationS))
+			}
+		}
+		params["api_sig"] = lastFMSignature(params, l.APISecret)
+
+		form := url.Values{}
+		for k, v := range params {
+			form.Set(k, v)
+		}
+		form.Set("format", "json")
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointOr(l.Endpoint, DefaultLastFMEndpoint), strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err := do(l.Client, req, l.Name()); err != nil {
+			if start > 0 {
+				return &BatchError{Sent: start, Err: err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// lastFMSignature signs params as described in the Last.fm API docs: keys
+// sorted, key and value concatenated, secret appended, md5 hex encoded.
+func lastFMSignature(params map[string]string, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k == "format" || k == "callback" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(params[k])
+	}
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+type ListenBrainz struct {
+	Token    string
+	Endpoint string
+	Client   *http.Client
+}
+
+func (l *ListenBrainz) Name() string { return "listenbrainz" }
+
+type listenBrainzPayload struct {
+	ListenType string               `json:"listen_type"`
+	Payload    []listenBrainzListen `json:"payload"`
+}
+
+type listenBrainzListen struct {
+	ListenedAt    int64                 `json:"listened_at"`
+	TrackMetadata listenBrainzTrackMeta `json:"track_metadata"`
+}
+
+type listenBrainzTrackMeta struct {
+	ArtistName     string         `json:"artist_name"`
+	TrackName      string         `json:"track_name"`
+	ReleaseName    string         `json:"release_name,omitempty"`
+	AdditionalInfo map[string]any `json:"additional_info,omitempty"`
+}
+
+func (l *ListenBrainz) Submit(ctx context.Context, listens []Listen) error {
+	if len(listens) == 0 {
+		return nil
+	}
+	body := listenBrainzPayload{ListenType: "single"}
+	if len(listens) > 1 {
+		body.ListenType = "import"
+	}
+	for _, ls := range listens {
+		meta := listenBrainzTrackMeta{ArtistName: ls.Artist, TrackName: ls.Track, ReleaseName: ls.Album}
+		info := map[string]any{"media_player": "Apple Music", "submission_client": "homepodctl"}
+		if ls.DurationS > 0 {
+			info["duration_ms"] = int64(ls.DurationS * 1000)
+		}
+		meta.AdditionalInfo = info
+		body.Payload = append(body.Payload, listenBrainzListen{ListenedAt: ls.StartedAt.Unix(), TrackMetadata: meta})
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(endpointOr(l.Endpoint, DefaultListenBrainzEndpoint), "/") + "/1/submit-listens"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+l.Token)
+	return do(l.Client, req, l.Name())
+}
+
+func endpointOr(v, def string) string {
+	if v = strings.TrimSpace(v); v != "" {
+		return v
+	}
+	return def
+}
+
+func do(client *http.Client, req *http.Request, service string) error {
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	return &ServiceError{Service: service, Status: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
+
+// Retryable reports whether a failed submission should stay queued. Client
+// errors (bad credentials, rejected payloads) are dropped so one bad entry
+// cannot block the queue forever.
+func Retryable(err error) bool {
+	var se *ServiceError
+	if errors.As(err, &se) {
+		return se.Status == http.StatusTooManyRequests || se.Status >= 500
+	}
+	return err != nil
+}
+
+// QueuedListen is a listen waiting to be delivered to Service.
+type QueuedListen struct {
+	Service string `json:"service"`
+	Listen
+}
+
+// Queue is the on-disk backlog of listens that could not be submitted yet.
+type Queue struct {
+	Path    string         `json:"-"`
+	Pending []QueuedListen `json:"pending"`
+}
+
+func LoadQueue(path string) (*Queue, error) {
+	q := &Queue{Path: path}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, q); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return q, nil
+}
+
+func (q *Queue) Save() error {
+	if err := os.MkdirAll(filepath.Dir(q.Path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := q.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.Path)
+}
+
+// Add queues ls for every submitter.
+func (q *Queue) Add(ls Listen, submitters []Submitter) {
+	for _, s := range submitters {
+		q.Pending = append(q.Pending, QueuedListen{Service: s.Name(), Listen: ls})
+	}
+}
+
+// Flush submits pending listens per service. Accepted listens leave the
+// queue, including the batches a BatchError reports as sent; the rest stay
+// queued when the error is retryable. The first error is returned.
+func (q *Queue) Flush(ctx context.Context, submitters []Submitter) (int, error) {
+	byService := map[string][]Listen{}
+	for _, p := range q.Pending {
+		byService[p.Service] = append(byService[p.Service], p.Listen)
+	}
+	var keep []QueuedListen
+	var firstErr error
+	sent := 0
+	known := map[string]bool{}
+	for _, s := range submitters {
+		known[s.Name()] = true
+		listens := byService[s.Name()]
+		if len(listens) == 0 {
+			continue
+		}
+		err := s.Submit(ctx, listens)
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) && batchErr.Sent > 0 && batchErr.Sent <= len(listens) {
+			sent += batchErr.Sent
+			listens = listens[batchErr.Sent:]
+		}
+		switch {
+		case err == nil:
+			sent += len(listens)
+		case Retryable(err):
+			for _, ls := range listens {
+				keep = append(keep, QueuedListen{Service: s.Name(), Listen: ls})
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		default:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%w (dropped %d listen(s))", err, len(listens))
+			}
+		}
+	}
+	// Keep entries for services that are not configured right now.
+	for _, p := range q.Pending {
+		if !known[p.Service] {
+			keep = append(keep, p)
+		}
+	}
+	q.Pending = keep
+	return sent, firstErr
+}
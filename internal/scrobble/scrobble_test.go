@@ -0,0 +1,170 @@
+package scrobble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEligible(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		duration, played float64
+		want             bool
+	}{
+		{duration: 200, played: 99, want: false},
+		{duration: 200, played: 100, want: true},
+		{duration: 20, played: 20, want: false},
+		{duration: 900, played: 240, want: true},
+	}
+	for _, tc := range cases {
+		if got := Eligible(tc.duration, tc.played); got != tc.want {
+			t.Fatalf("Eligible(%v,%v)=%v, want %v", tc.duration, tc.played, got, tc.want)
+		}
+	}
+}
+
+func TestLastFMSubmitSignsRequest(t *testing.T) {
+	t.Parallel()
+
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		_, _ = io.WriteString(w, `{"scrobbles":{}}`)
+	}))
+	defer srv.Close()
+
+	lf := &LastFM{APIKey: "key", APISecret: "secret", SessionKey: "sk", Endpoint: srv.URL}
+	started := time.Unix(1700000000, 0)
+	if err := lf.Submit(context.Background(), []Listen{{Artist: "Band", Track: "Song", Album: "LP", DurationS: 200, StartedAt: started}}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if form.Get("method") != "track.scrobble" || form.Get("artist[0]") != "Band" || form.Get("timestamp[0]") != "1700000000" || form.Get("format") != "json" {
+		t.Fatalf("unexpected form: %v", form)
+	}
+	params := map[string]string{}
+	for k := range form {
+		if k != "api_sig" {
+			params[k] = form.Get(k)
+		}
+	}
+	if want := lastFMSignature(params, "secret"); form.Get("api_sig") != want {
+		t.Fatalf("api_sig=%q, want %q", form.Get("api_sig"), want)
+	}
+}
+
+func TestListenBrainzSubmit(t *testing.T) {
+	t.Parallel()
+
+	var auth string
+	var body listenBrainzPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/submit-listens" {
+			t.Errorf("path=%q", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	lb := &ListenBrainz{Token: "tok", Endpoint: srv.URL}
+	listens := []Listen{{Artist: "A", Track: "One", StartedAt: time.Unix(10, 0)}, {Artist: "B", Track: "Two", StartedAt: time.Unix(20, 0)}}
+	if err := lb.Submit(context.Background(), listens); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if auth != "Token tok" {
+		t.Fatalf("authorization=%q", auth)
+	}
+	if body.ListenType != "import" || len(body.Payload) != 2 || body.Payload[1].TrackMetadata.TrackName != "Two" || body.Payload[0].ListenedAt != 10 {
+		t.Fatalf("unexpected payload: %+v", body)
+	}
+}
+
+type fakeSubmitter struct {
+	name string
+	err  error
+	got  []Listen
+}
+
+func (f *fakeSubmitter) Name() string { return f.name }
+
+func (f *fakeSubmitter) Submit(_ context.Context, listens []Listen) error {
+	f.got = append(f.got, listens...)
+	return f.err
+}
+
+func TestQueueFlushKeepsRetryableFailures(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := LoadQueue(path)
+	if err != nil {
+		t.Fatalf("LoadQueue: %v", err)
+	}
+	ok := &fakeSubmitter{name: "ok"}
+	offline := &fakeSubmitter{name: "offline", err: errors.New("dial tcp: no route to host")}
+	rejected := &fakeSubmitter{name: "rejected", err: &ServiceError{Service: "rejected", Status: http.StatusBadRequest}}
+	subs := []Submitter{ok, offline, rejected}
+	q.Add(Listen{Artist: "A", Track: "T", StartedAt: time.Unix(1, 0)}, subs)
+	q.Pending = append(q.Pending, QueuedListen{Service: "unconfigured", Listen: Listen{Track: "X"}})
+
+	sent, err := q.Flush(context.Background(), subs)
+	if err == nil {
+		t.Fatalf("expected flush error")
+	}
+	if sent != 1 || len(ok.got) != 1 {
+		t.Fatalf("sent=%d ok.got=%v", sent, ok.got)
+	}
+	if len(q.Pending) != 2 || q.Pending[0].Service != "offline" || q.Pending[1].Service != "unconfigured" {
+		t.Fatalf("unexpected pending: %+v", q.Pending)
+	}
+	if err := q.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	reloaded, err := LoadQueue(path)
+	if err != nil {
+		t.Fatalf("LoadQueue: %v", err)
+	}
+	if len(reloaded.Pending) != 2 || reloaded.Pending[0].Track != "T" {
+		t.Fatalf("unexpected reloaded queue: %+v", reloaded.Pending)
+	}
+}
+
+func TestLastFMPartialBatchFailureRequeuesTheRest(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	lfm := &LastFM{APIKey: "k", APISecret: "s", SessionKey: "sk", Endpoint: srv.URL}
+	q := &Queue{Path: filepath.Join(t.TempDir(), "queue.json")}
+	for i := 0; i < 2*lastFMBatchSize+10; i++ {
+		q.Add(Listen{Artist: "A", Track: strconv.Itoa(i), StartedAt: time.Unix(int64(i), 0)}, []Submitter{lfm})
+	}
+	sent, err := q.Flush(context.Background(), []Submitter{lfm})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Sent != lastFMBatchSize || !Retryable(err) {
+		t.Fatalf("err=%v", err)
+	}
+	if sent != lastFMBatchSize || len(q.Pending) != lastFMBatchSize+10 || q.Pending[0].Track != strconv.Itoa(lastFMBatchSize) {
+		t.Fatalf("sent=%d pending=%d first=%+v", sent, len(q.Pending), q.Pending[0])
+	}
+}
@@ -0,0 +1,185 @@
+// Package spotify drives Spotify.app over AppleScript: play a Spotify URI,
+// the transport commands, the app volume, and what is playing. Spotify does
+// not script its output device; it plays to the macOS sound output, which
+// can be a HomePod (see package sysaudio).
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/agisilaos/homepodctl/internal/transport"
+)
+
+// Track is Spotify's current track. ID is its spotify:track: URI.
+type Track struct {
+	ID        string  `json:"id,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Artist    string  `json:"artist,omitempty"`
+	Album     string  `json:"album,omitempty"`
+	DurationS float64 `json:"durationSeconds"`
+}
+
+// NowPlaying is Spotify's player state.
+type NowPlaying struct {
+	PlayerState     string  `json:"playerState"` // playing|paused|stopped
+	PlayerPositionS float64 `json:"playerPositionSeconds"`
+	Volume          int     `json:"volume"`
+	Track           Track   `json:"track"`
+}
+
+// uriKinds are the Spotify URI kinds play accepts.
+var uriKinds = map[string]bool{
+	"track": true, "album": true, "artist": true, "playlist": true, "show": true, "episode": true,
+}
+
+var runAppleScriptExec = func(ctx context.Context, script string) ([]byte, error) {
+	return runner.Run(ctx, strings.NewReader(script), "osascript")
+}
+
+// runner runs osascript; see SetTransport.
+var runner transport.Runner = transport.Local{}
+
+// SetTransport runs every script through r, e.g. on another Mac over SSH.
+func SetTransport(r transport.Runner) {
+	runner = r
+}
+
+func runAppleScript(ctx context.Context, script string) (string, error) {
+	out, err := runAppleScriptExec(ctx, script)
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", fmt.Errorf("spotify: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("spotify: %w", err)
+	}
+	return string(out), nil
+}
+
+// NormalizeURI turns a Spotify URI or an open.spotify.com link into a
+// spotify:<kind>:<id> URI.
+func NormalizeURI(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	var kind, id string
+	if strings.HasPrefix(s, "spotify:") {
+		parts := strings.Split(s, ":")
+		if len(parts) == 3 {
+			kind, id = parts[1], parts[2]
+		}
+	} else if u, err := url.Parse(s); err == nil && strings.EqualFold(u.Host, "open.spotify.com") {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		// Localized links carry a prefix such as /intl-de/.
+		if len(parts) == 3 && strings.HasPrefix(parts[0], "intl-") {
+			parts = parts[1:]
+		}
+		if len(parts) == 2 {
+			kind, id = parts[0], parts[1]
+		}
+	}
+	if !uriKinds[kind] || id == "" {
+		return "", fmt.Errorf("invalid Spotify URI %q (expected spotify:<track|album|artist|playlist|show|episode>:<id> or an open.spotify.com link)", s)
+	}
+	return "spotify:" + kind + ":" + id, nil
+}
+
+// PlayURI plays a Spotify URI; see NormalizeURI.
+func PlayURI(ctx context.Context, uri string) error {
+	uri, err := NormalizeURI(uri)
+	if err != nil {
+		return err
+	}
+	_, err = runAppleScript(ctx, fmt.Sprintf(`
+tell application "Spotify"
+	play track %q
+end tell
+`, uri))
+	return err
+}
+
+// Play resumes playback.
+func Play(ctx context.Context) error { return command(ctx, "play") }
+
+// Pause pauses playback.
+func Pause(ctx context.Context) error { return command(ctx, "pause") }
+
+// Next skips to the next track.
+func Next(ctx context.Context) error { return command(ctx, "next track") }
+
+// Previous goes back to the previous track.
+func Previous(ctx context.Context) error { return command(ctx, "previous track") }
+
+func command(ctx context.Context, verb string) error {
+	_, err := runAppleScript(ctx, "\ntell application \"Spotify\"\n\t"+verb+"\nend tell\n")
+	return err
+}
+
+// SetVolume sets Spotify's own volume, 0-100.
+func SetVolume(ctx context.Context, volume int) error {
+	if volume < 0 || volume > 100 {
+		return fmt.Errorf("volume must be 0-100")
+	}
+	return command(ctx, "set sound volume to "+strconv.Itoa(volume))
+}
+
+// GetNowPlaying reads the player state, volume, and current track.
+func GetNowPlaying(ctx context.Context) (NowPlaying, error) {
+	out, err := runAppleScript(ctx, `
+tell application "Spotify"
+	set ps to (player state as string)
+	set pos to player position
+	set vol to sound volume
+	set tID to ""
+	set tName to ""
+	set tArtist to ""
+	set tAlbum to ""
+	set tDur to 0
+	try
+		set t to current track
+		set tID to id of t
+		set tName to name of t
+		set tArtist to artist of t
+		set tAlbum to album of t
+		set tDur to duration of t
+	end try
+	return ps & tab & pos & tab & vol & tab & tID & tab & tName & tab & tArtist & tab & tAlbum & tab & tDur
+end tell
+`)
+	if err != nil {
+		return NowPlaying{}, err
+	}
+	return parseNowPlaying(out), nil
+}
+
+func parseNowPlaying(line string) NowPlaying {
+	parts := strings.Split(strings.TrimSpace(line), "\t")
+	for len(parts) < 8 {
+		parts = append(parts, "")
+	}
+	vol, _ := strconv.Atoi(strings.TrimSpace(parts[2]))
+	return NowPlaying{
+		PlayerState:     strings.TrimSpace(parts[0]),
+		PlayerPositionS: parseFloat(parts[1]),
+		Volume:          vol,
+		Track: Track{
+			ID:     strings.TrimSpace(parts[3]),
+			Name:   strings.TrimSpace(parts[4]),
+			Artist: strings.TrimSpace(parts[5]),
+			Album:  strings.TrimSpace(parts[6]),
+			// Spotify reports durations in milliseconds.
+			DurationS: parseFloat(parts[7]) / 1000,
+		},
+	}
+}
+
+// parseFloat reads a number AppleScript printed, which uses a decimal comma
+// in some locales.
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
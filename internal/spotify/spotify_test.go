@@ -0,0 +1,57 @@
+package spotify
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeURI(t *testing.T) {
+	cases := map[string]string{
+		"spotify:playlist:37i9dQZF1DX4sWSpwq3LiO":                       "spotify:playlist:37i9dQZF1DX4sWSpwq3LiO",
+		"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC?si=abc":  "spotify:track:4uLU6hMCjMI75M1A2tKUQC",
+		"https://open.spotify.com/intl-de/album/1DFixLWuPkv3KT3TnV35m3": "spotify:album:1DFixLWuPkv3KT3TnV35m3",
+		" https://open.spotify.com/show/5CfCWKI5pZ28U0uOzXkDHe ":        "spotify:show:5CfCWKI5pZ28U0uOzXkDHe",
+	}
+	for in, want := range cases {
+		got, err := NormalizeURI(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeURI(%q)=%q,%v want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "chill", "spotify:user:me", "https://example.com/track/x", "spotify:track:"} {
+		if _, err := NormalizeURI(bad); err == nil {
+			t.Errorf("NormalizeURI(%q): expected error", bad)
+		}
+	}
+}
+
+func TestPlayURIAndNowPlaying(t *testing.T) {
+	origExec := runAppleScriptExec
+	t.Cleanup(func() { runAppleScriptExec = origExec })
+
+	var scripts []string
+	runAppleScriptExec = func(_ context.Context, script string) ([]byte, error) {
+		scripts = append(scripts, script)
+		if strings.Contains(script, "current track") {
+			return []byte("playing\t12,5\t40\tspotify:track:abc\tSo What\tMiles Davis\tKind of Blue\t562000\n"), nil
+		}
+		return nil, nil
+	}
+	if err := PlayURI(context.Background(), "https://open.spotify.com/track/abc"); err != nil {
+		t.Fatalf("PlayURI: %v", err)
+	}
+	if !strings.Contains(scripts[0], `play track "spotify:track:abc"`) {
+		t.Fatalf("play script:\n%s", scripts[0])
+	}
+	if err := SetVolume(context.Background(), 101); err == nil {
+		t.Fatalf("expected error for volume 101")
+	}
+	np, err := GetNowPlaying(context.Background())
+	if err != nil {
+		t.Fatalf("GetNowPlaying: %v", err)
+	}
+	if np.PlayerState != "playing" || np.PlayerPositionS != 12.5 || np.Volume != 40 || np.Track.Name != "So What" || np.Track.DurationS != 562 {
+		t.Fatalf("np=%+v", np)
+	}
+}
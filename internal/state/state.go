@@ -0,0 +1,233 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// LayoutVersion is the version of the state directory layout this build
+// reads and writes. It is recorded in layout.json the first time the
+// directory is prepared.
+const LayoutVersion = 1
+
+const layoutFile = "layout.json"
+
+// ErrNewerLayout means the state directory was written by a newer homepodctl.
+var ErrNewerLayout = errors.New("state directory uses a newer layout")
+
+// File is one known file in the state directory.
+type File struct {
+	Name        string
+	Description string
+	// Keep marks files Clear leaves alone unless named, such as the socket
+	// of a running daemon.
+	Keep bool
+}
+
+// Files lists what homepodctl keeps in the state directory.
+var Files = []File{
+	{Name: "history.jsonl", Description: "commands that changed playback, outputs, or the library"},
+	{Name: "tracks.jsonl", Description: "tracks seen playing, for history tracks"},
+	{Name: "automation-runs.jsonl", Description: "finished automation and scene runs"},
+	{Name: "automation-recording.json", Description: "automation recording in progress"},
+	{Name: "undo.json", Description: "playback state before the last undoable command"},
+	{Name: "duck.json", Description: "volumes to restore after duck"},
+	{Name: "mute.json", Description: "volumes to restore on unmute"},
+	{Name: "audio-route.json", Description: "system output to return to on audio route --reset"},
+	{Name: "daemon.sock", Description: "socket of a running daemon", Keep: true},
+	{Name: "scrobble-queue.json", Description: "listens not yet sent to the scrobbling services", Keep: true},
+	{Name: "streamdeck-token", Description: "bearer token streamdeck serve requires", Keep: true},
+	{Name: "serve-token", Description: "bearer token automation serve requires", Keep: true},
+}
+
+// Entry is a state file as Describe reports it.
+type Entry struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+	Exists      bool   `json:"exists"`
+	Size        int64  `json:"size,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+	// Unknown marks files in the state directory that are not in Files.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Layout describes the state directory and its files.
+type Layout struct {
+	Dir     string  `json:"dir"`
+	Version int     `json:"version"`
+	Files   []Entry `json:"files"`
+}
+
+type layoutMarker struct {
+	Version int `json:"version"`
+}
+
+// Dir returns $XDG_STATE_HOME/homepodctl, falling back to
+// ~/.local/state/homepodctl.
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "homepodctl"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "homepodctl"), nil
+}
+
+// Path returns the path of name in the state directory.
+func Path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Adopt returns the path of name in the state directory, first moving legacy
+// there (where an older homepodctl kept the file) if only legacy exists.
+func Adopt(legacy, name string) (string, error) {
+	path, err := Path(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		return path, nil
+	}
+	if _, err := os.Lstat(legacy); err != nil {
+		return path, nil
+	}
+	if err := Prepare(filepath.Dir(path)); err != nil {
+		return "", err
+	}
+	if err := os.Rename(legacy, path); err != nil {
+		return "", fmt.Errorf("move %s to the state directory: %w", legacy, err)
+	}
+	return path, nil
+}
+
+// Prepare creates dir if needed and records the layout version in it. It
+// fails with ErrNewerLayout when a newer homepodctl owns the directory.
+func Prepare(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	version, err := readVersion(dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > LayoutVersion:
+		return fmt.Errorf("%w: %s has version %d, this build supports %d", ErrNewerLayout, dir, version, LayoutVersion)
+	case version == 0:
+		b, _ := json.Marshal(layoutMarker{Version: LayoutVersion})
+		return os.WriteFile(filepath.Join(dir, layoutFile), append(b, '\n'), 0o644)
+	}
+	return nil
+}
+
+// readVersion returns the layout version recorded in dir, or 0 when none is.
+func readVersion(dir string) (int, error) {
+	b, err := os.ReadFile(filepath.Join(dir, layoutFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var m layoutMarker
+	if err := json.Unmarshal(b, &m); err != nil {
+		return 0, fmt.Errorf("read %s: %w", filepath.Join(dir, layoutFile), err)
+	}
+	return m.Version, nil
+}
+
+// Describe reports the state directory: every known file, present or not,
+// then any other files found there.
+func Describe() (Layout, error) {
+	dir, err := Dir()
+	if err != nil {
+		return Layout{}, err
+	}
+	version, err := readVersion(dir)
+	if err != nil {
+		return Layout{}, err
+	}
+	l := Layout{Dir: dir, Version: version, Files: []Entry{}}
+	known := map[string]bool{layoutFile: true}
+	for _, f := range Files {
+		known[f.Name] = true
+		l.Files = append(l.Files, Stat(f.Name, filepath.Join(dir, f.Name), f.Description))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return Layout{}, err
+	}
+	var unknown []Entry
+	for _, e := range entries {
+		if known[e.Name()] || e.IsDir() {
+			continue
+		}
+		en := Stat(e.Name(), filepath.Join(dir, e.Name()), "")
+		en.Unknown = true
+		unknown = append(unknown, en)
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Name < unknown[j].Name })
+	l.Files = append(l.Files, unknown...)
+	return l, nil
+}
+
+// Stat describes the file at path, which need not exist.
+func Stat(name, path, description string) Entry {
+	e := Entry{Name: name, Path: path, Description: description}
+	if fi, err := os.Stat(path); err == nil {
+		e.Exists = true
+		e.Size = fi.Size()
+		e.Modified = fi.ModTime().UTC().Format(time.RFC3339)
+	}
+	return e
+}
+
+// Targets returns the existing files to clear for names: the named state
+// files, or every known file except the Keep ones when names is empty.
+// Unknown names are an error.
+func Targets(names ...string) ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		for _, f := range Files {
+			if !f.Keep {
+				names = append(names, f.Name)
+			}
+		}
+	}
+	paths := []string{}
+	for _, name := range names {
+		if !IsKnown(name) {
+			return nil, fmt.Errorf("unknown state file %q", name)
+		}
+		path := filepath.Join(dir, name)
+		if _, err := os.Lstat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// IsKnown reports whether name is one of Files.
+func IsKnown(name string) bool {
+	for _, f := range Files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareRecordsLayoutVersion(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "homepodctl")
+	if err := Prepare(dir); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if v, err := readVersion(dir); err != nil || v != LayoutVersion {
+		t.Fatalf("version=%d err=%v", v, err)
+	}
+	if err := Prepare(dir); err != nil {
+		t.Fatalf("Prepare again: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, layoutFile), []byte(`{"version":99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Prepare(dir); !errors.Is(err, ErrNewerLayout) {
+		t.Fatalf("expected ErrNewerLayout, got %v", err)
+	}
+}
+
+func TestAdoptMovesLegacyFile(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tmp)
+	legacy := filepath.Join(tmp, "config", "mute.json")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path, err := Adopt(legacy, "mute.json")
+	if err != nil || path != filepath.Join(tmp, "homepodctl", "mute.json") {
+		t.Fatalf("path=%q err=%v", path, err)
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "old" {
+		t.Fatalf("moved file=%q err=%v", b, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("legacy file still present: %v", err)
+	}
+
+	// A file already in the state directory wins over a legacy one.
+	if err := os.WriteFile(legacy, []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Adopt(legacy, "mute.json"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "old" {
+		t.Fatalf("state file overwritten: %q", b)
+	}
+}
+
+func TestDescribeAndTargets(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tmp)
+	dir := filepath.Join(tmp, "homepodctl")
+	if err := Prepare(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"history.jsonl", "daemon.sock", "old.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := Describe()
+	if err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if l.Dir != dir || l.Version != LayoutVersion || len(l.Files) != len(Files)+1 {
+		t.Fatalf("layout=%+v", l)
+	}
+	if got := l.Files[0]; got.Name != "history.jsonl" || !got.Exists || got.Size != 1 {
+		t.Fatalf("history entry=%+v", got)
+	}
+	if got := l.Files[len(l.Files)-1]; got.Name != "old.json" || !got.Unknown {
+		t.Fatalf("unknown entry=%+v", got)
+	}
+
+	paths, err := Targets()
+	if err != nil || len(paths) != 1 || filepath.Base(paths[0]) != "history.jsonl" {
+		t.Fatalf("default targets=%v err=%v", paths, err)
+	}
+	paths, err = Targets("daemon.sock", "undo.json")
+	if err != nil || len(paths) != 1 || filepath.Base(paths[0]) != "daemon.sock" {
+		t.Fatalf("named targets=%v err=%v", paths, err)
+	}
+	if _, err := Targets("old.json"); err == nil {
+		t.Fatalf("expected unknown name to be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+// Package sysaudio reads and switches the macOS system sound output, where
+// audio from apps other than Music.app (calls, browsers, video) goes.
+// AirPlay receivers such as HomePods show up there like any other output
+// device. It drives the SwitchAudioSource CLI (Homebrew switchaudio-osx),
+// which wraps the CoreAudio default-device calls.
+package sysaudio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Tool is the CLI the package runs.
+const Tool = "SwitchAudioSource"
+
+// ErrNotInstalled means SwitchAudioSource is not on PATH.
+var ErrNotInstalled = errors.New("SwitchAudioSource not found (install it with `brew install switchaudio-osx`)")
+
+// Output is a system sound output device.
+type Output struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+}
+
+var (
+	lookPathFn = exec.LookPath
+	runExec    = func(ctx context.Context, path string, args ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, path, args...).CombinedOutput()
+	}
+)
+
+func run(ctx context.Context, args ...string) (string, error) {
+	path, err := lookPathFn(Tool)
+	if err != nil {
+		return "", ErrNotInstalled
+	}
+	out, err := runExec(ctx, path, args...)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", Tool, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// Outputs lists the system output devices, marking the current one.
+func Outputs(ctx context.Context) ([]Output, error) {
+	out, err := run(ctx, "-a", "-t", "output")
+	if err != nil {
+		return nil, err
+	}
+	current, err := Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []Output
+	for _, line := range strings.Split(out, "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		outputs = append(outputs, Output{Name: name, Current: name == current})
+	}
+	return outputs, nil
+}
+
+// Current returns the name of the current system output device.
+func Current(ctx context.Context) (string, error) {
+	out, err := run(ctx, "-c", "-t", "output")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// SetOutput makes the device named exactly name the system output.
+func SetOutput(ctx context.Context, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("output name is required")
+	}
+	_, err := run(ctx, "-s", name, "-t", "output")
+	return err
+}
@@ -0,0 +1,44 @@
+package sysaudio
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOutputsAndSetOutput(t *testing.T) {
+	origLookPath, origExec := lookPathFn, runExec
+	t.Cleanup(func() { lookPathFn, runExec = origLookPath, origExec })
+
+	lookPathFn = func(string) (string, error) { return "/opt/homebrew/bin/SwitchAudioSource", nil }
+	var calls []string
+	runExec = func(_ context.Context, _ string, args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " "))
+		switch args[0] {
+		case "-a":
+			return []byte("MacBook Pro Speakers\nKitchen\n\n"), nil
+		case "-c":
+			return []byte("MacBook Pro Speakers\n"), nil
+		}
+		return nil, nil
+	}
+	outs, err := Outputs(context.Background())
+	if err != nil {
+		t.Fatalf("Outputs: %v", err)
+	}
+	if len(outs) != 2 || !outs[0].Current || outs[1].Current || outs[1].Name != "Kitchen" {
+		t.Fatalf("outputs=%+v", outs)
+	}
+	if err := SetOutput(context.Background(), " Kitchen "); err != nil {
+		t.Fatalf("SetOutput: %v", err)
+	}
+	if got := calls[len(calls)-1]; got != "-s Kitchen -t output" {
+		t.Fatalf("set call=%q", got)
+	}
+
+	lookPathFn = func(string) (string, error) { return "", errors.New("not found") }
+	if _, err := Current(context.Background()); !errors.Is(err, ErrNotInstalled) {
+		t.Fatalf("err=%v, want ErrNotInstalled", err)
+	}
+}
@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Runner runs the backend programs (osascript, shortcuts) on the Mac that
+// has Music.app open: this one, or another one over SSH.
+type Runner interface {
+	// Run runs name with args, feeding it stdin when non-nil, and returns
+	// its combined output.
+	Run(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error)
+	// String names the transport for logs, e.g. "local" or "ssh me@mini".
+	String() string
+}
+
+// Local runs programs on this Mac.
+type Local struct{}
+
+func (Local) Run(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	return cmd.CombinedOutput()
+}
+
+func (Local) String() string { return "local" }
+
+// IsRemote reports whether r runs programs on another Mac.
+func IsRemote(r Runner) bool {
+	_, local := r.(Local)
+	return r != nil && !local
+}
+
+// SSH runs programs on Host through the system ssh client, so keys, agents,
+// and ~/.ssh/config apply as usual. Authentication must not prompt.
+type SSH struct {
+	Host     string // user@host, host, or a Host alias from ~/.ssh/config
+	Port     int    // optional
+	Identity string // optional private key file
+	// ControlPath, when set, shares one connection across the calls of a
+	// command (ssh ControlMaster) so each call does not pay the handshake.
+	ControlPath string
+}
+
+// ErrUnreachable means ssh could not connect to or authenticate with the
+// host, so nothing ran there.
+var ErrUnreachable = errors.New("remote host unreachable")
+
+// sshConnectFailed is the exit status ssh uses for its own errors.
+const sshConnectFailed = 255
+
+// ValidHost reports whether host can be passed to ssh as a destination.
+func ValidHost(host string) error {
+	switch {
+	case strings.TrimSpace(host) == "":
+		return errors.New("host must be non-empty")
+	case strings.HasPrefix(host, "-"):
+		return fmt.Errorf("invalid host %q (must not start with -)", host)
+	case strings.ContainsAny(host, " \t\r\n"):
+		return fmt.Errorf("invalid host %q (must not contain spaces)", host)
+	}
+	return nil
+}
+
+// Args returns the ssh arguments that run name with args on s.Host.
+func (s SSH) Args(name string, args ...string) []string {
+	out := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if s.Port > 0 {
+		out = append(out, "-p", strconv.Itoa(s.Port))
+	}
+	if s.Identity != "" {
+		out = append(out, "-i", s.Identity)
+	}
+	if s.ControlPath != "" {
+		out = append(out, "-o", "ControlMaster=auto", "-o", "ControlPersist=60s", "-o", "ControlPath="+s.ControlPath)
+	}
+	// The remote shell joins the command back into one string, so every
+	// word is quoted for it.
+	words := []string{ShellQuote(name)}
+	for _, a := range args {
+		words = append(words, ShellQuote(a))
+	}
+	return append(out, "--", s.Host, strings.Join(words, " "))
+}
+
+func (s SSH) Run(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	if err := ValidHost(s.Host); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "ssh", s.Args(name, args...)...)
+	cmd.Stdin = stdin
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == sshConnectFailed {
+		return out, fmt.Errorf("%w: ssh %s: %s", ErrUnreachable, s.Host, strings.TrimSpace(string(out)))
+	}
+	return out, err
+}
+
+func (s SSH) String() string { return "ssh " + s.Host }
+
+// ShellQuote quotes s for a POSIX shell.
+func ShellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSSHArgs(t *testing.T) {
+	s := SSH{Host: "me@mini", Port: 2222, Identity: "/k", ControlPath: "/tmp/ssh/%C"}
+	got := s.Args("shortcuts", "run", "Living Room 40%", "it's")
+	want := []string{
+		"-o", "BatchMode=yes", "-o", "ConnectTimeout=10",
+		"-p", "2222", "-i", "/k",
+		"-o", "ControlMaster=auto", "-o", "ControlPersist=60s", "-o", "ControlPath=/tmp/ssh/%C",
+		"--", "me@mini", `shortcuts run 'Living Room 40%' 'it'\''s'`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Args:\n got %q\nwant %q", got, want)
+	}
+
+	got = SSH{Host: "mini"}.Args("osascript")
+	want = []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "--", "mini", "osascript"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Args:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"":             "''",
+		"plain-word_1": "plain-word_1",
+		"a b":          "'a b'",
+		"$HOME":        "'$HOME'",
+		"a'b":          `'a'\''b'`,
+		"x\ny":         "'x\ny'",
+	} {
+		if got := ShellQuote(in); got != want {
+			t.Errorf("ShellQuote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidHost(t *testing.T) {
+	for _, host := range []string{"mini", "me@mac-mini.local", "me@10.0.0.2"} {
+		if err := ValidHost(host); err != nil {
+			t.Errorf("ValidHost(%q) = %v", host, err)
+		}
+	}
+	for _, host := range []string{"", "  ", "-oProxyCommand=x", "me@mini extra"} {
+		if err := ValidHost(host); err == nil {
+			t.Errorf("ValidHost(%q) = nil, want error", host)
+		}
+	}
+}
+
+func TestIsRemote(t *testing.T) {
+	if IsRemote(Local{}) || IsRemote(nil) {
+		t.Fatal("Local and nil must not be remote")
+	}
+	if !IsRemote(SSH{Host: "mini"}) {
+		t.Fatal("SSH must be remote")
+	}
+}